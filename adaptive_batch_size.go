@@ -0,0 +1,166 @@
+package ghostferry
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AdaptiveBatchSizer adjusts the number of rows selected per batch of each
+// table, so that the batches of both narrow and wide tables take about
+// TargetDuration to read and write and hold at most MaxBatchBytes of row
+// data. The rows of a batch are locked on the source for this duration.
+//
+// The size of a table starts at the configured batch size, or at the size
+// estimated from the average size of its rows, at most doubles after every
+// batch, and shrinks to the estimated size right away.
+type AdaptiveBatchSizer struct {
+	// Optional: no target duration if zero.
+	TargetDuration time.Duration
+
+	// Optional: no memory budget if zero.
+	MaxBatchBytes uint64
+
+	// If set, a batch with a row holding more bytes than this makes the next
+	// batch of the table read a single row, regardless of MinBatchSize, so
+	// that the rows with huge values are read one at a time.
+	//
+	// Optional: no large rows if zero.
+	LargeRowBytes uint64
+
+	MinBatchSize uint64
+	MaxBatchSize uint64
+
+	mutex        sync.Mutex
+	sizes        map[string]uint64
+	initialSizes map[string]uint64
+}
+
+// The batch size to use for the next batch of the table.
+func (s *AdaptiveBatchSizer) BatchSize(table string, initialSize uint64) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if size, exists := s.sizes[table]; exists {
+		return size
+	}
+
+	if s.initialSizes == nil {
+		s.initialSizes = make(map[string]uint64)
+	}
+	if _, exists := s.initialSizes[table]; !exists {
+		s.initialSizes[table] = initialSize
+	}
+
+	return s.clamp(initialSize)
+}
+
+// Adjusts the batch size of the table from the rows, the bytes and the
+// duration of a batch read with the given size. Returns the new size.
+func (s *AdaptiveBatchSizer) Observe(table string, size uint64, rows int, bytes uint64, duration time.Duration) uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.sizes == nil {
+		s.sizes = make(map[string]uint64)
+	}
+
+	// The last batch of a table is usually empty, and says nothing about the
+	// size of its rows.
+	if rows == 0 {
+		return s.clamp(size)
+	}
+
+	estimate := math.Inf(1)
+
+	if s.TargetDuration > 0 && duration > 0 {
+		rowDuration := float64(duration) / float64(rows)
+		estimate = math.Min(estimate, float64(s.TargetDuration)/rowDuration)
+	}
+
+	if s.MaxBatchBytes > 0 && bytes > 0 {
+		rowBytes := float64(bytes) / float64(rows)
+		estimate = math.Min(estimate, float64(s.MaxBatchBytes)/rowBytes)
+	}
+
+	newSize := size
+	if !math.IsInf(estimate, 1) {
+		newSize = uint64(math.Max(estimate, 1))
+		if newSize > 2*size {
+			newSize = 2 * size
+		}
+	} else if initial, exists := s.initialSizes[table]; exists && size < initial {
+		// Without a target, the batches shrunk by a large row grow back to
+		// the initial size.
+		newSize = 2 * size
+		if newSize > initial {
+			newSize = initial
+		}
+	}
+
+	newSize = s.clamp(newSize)
+	s.sizes[table] = newSize
+
+	metrics.Gauge("AdaptiveBatchSize", float64(newSize), []MetricTag{{"table", table}}, 1.0)
+	return newSize
+}
+
+// Lowers the initial batch size of the table so that its first batch holds
+// at most MaxBatchBytes, from the average size of its rows, such as the
+// AVG_ROW_LENGTH of information_schema. Must be called before the table is
+// iterated.
+func (s *AdaptiveBatchSizer) EstimateFromAverageRow(table string, initialSize, rowBytes uint64) {
+	if s.MaxBatchBytes == 0 || rowBytes == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.sizes[table]; exists {
+		return
+	}
+
+	if s.sizes == nil {
+		s.sizes = make(map[string]uint64)
+	}
+
+	size := s.clamp(initialSize)
+	if estimate := s.MaxBatchBytes / rowBytes; estimate < size {
+		size = s.clamp(estimate)
+		if size == 0 {
+			size = 1
+		}
+	}
+	s.sizes[table] = size
+}
+
+// Makes the next batch of the table read a single row if the largest row of
+// the last batch is larger than LargeRowBytes. Must be called after Observe.
+// Returns whether the row is large.
+func (s *AdaptiveBatchSizer) ObserveLargestRow(table string, rowBytes uint64) bool {
+	if s.LargeRowBytes == 0 || rowBytes <= s.LargeRowBytes {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.sizes == nil {
+		s.sizes = make(map[string]uint64)
+	}
+	s.sizes[table] = 1
+
+	metrics.Gauge("AdaptiveBatchSize", 1, []MetricTag{{"table", table}}, 1.0)
+	return true
+}
+
+func (s *AdaptiveBatchSizer) clamp(size uint64) uint64 {
+	if s.MinBatchSize > 0 && size < s.MinBatchSize {
+		return s.MinBatchSize
+	}
+	if s.MaxBatchSize > 0 && size > s.MaxBatchSize {
+		return s.MaxBatchSize
+	}
+	return size
+}
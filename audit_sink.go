@@ -0,0 +1,254 @@
+package ghostferry
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AuditSourceBinlog = "binlog"
+	AuditSourceCopy   = "copy"
+)
+
+// A single change written to the target, as recorded in the audit log.
+// Values are keyed by the source column names. Binary values that are not
+// valid UTF-8 are encoded as base64 strings.
+type AuditRecord struct {
+	Time           time.Time              `json:"time"`
+	Source         string                 `json:"source"`
+	Type           string                 `json:"type"`
+	Database       string                 `json:"database"`
+	Table          string                 `json:"table"`
+	TargetDatabase string                 `json:"target_database"`
+	TargetTable    string                 `json:"target_table"`
+	PK             uint64                 `json:"pk"`
+	Before         map[string]interface{} `json:"before,omitempty"`
+	After          map[string]interface{} `json:"after,omitempty"`
+	BinlogPosition *mysql.Position        `json:"binlog_position,omitempty"`
+	FerryId        string                 `json:"ferry_id,omitempty"`
+
+	// Set on the inserts that may not have been applied: the INSERT IGNORE
+	// statements writing them to the target ignored some of their rows, as
+	// they conflicted with rows of the target, but do not tell which.
+	Attempted bool `json:"attempted,omitempty"`
+}
+
+// AuditSink writes every change applied to the target as a line of JSON,
+// rotating to a new file once the current one reaches MaxFileSize. The
+// records are only written after the change is committed on the target, so
+// the audit log never contains a change that was not written. The inserts
+// written by a statement that ignored some of its rows are marked as
+// Attempted, as they may not have been applied. A change that is applied
+// more than once, for instance when a binlog position is replayed after a
+// resume, is recorded every time.
+type AuditSink struct {
+	Directory   string
+	MaxFileSize int64
+
+	// Recorded in every record, see Config.FerryId.
+	FerryId string
+
+	logger *logrus.Entry
+
+	mutex       sync.Mutex
+	file        *os.File
+	writer      *bufio.Writer
+	fileSize    int64
+	fileCounter int
+}
+
+func (s *AuditSink) Initialize() error {
+	s.logger = logrus.WithField("tag", "audit_sink")
+
+	err := os.MkdirAll(s.Directory, 0755)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rotate()
+}
+
+// Records the rows of the batch, as Attempted if set.
+func (s *AuditSink) RecordRowBatch(batch *RowBatch, targetDb, targetTable string, attempted bool) error {
+	table := batch.TableSchema()
+	records := make([]*AuditRecord, 0, batch.Size())
+
+	for _, row := range batch.Values() {
+		var pk uint64
+		if batch.ValuesContainPk() {
+			var err error
+			pk, err = row.GetUint64(batch.PkIndex())
+			if err != nil {
+				return err
+			}
+		}
+
+		records = append(records, &AuditRecord{
+			Source:    AuditSourceCopy,
+			Type:      "insert",
+			PK:        pk,
+			After:     auditValues(table, row),
+			Attempted: attempted,
+		})
+	}
+
+	return s.write(table, targetDb, targetTable, records)
+}
+
+// Records the event, as Attempted if set.
+func (s *AuditSink) RecordDMLEvent(ev DMLEvent, targetDb, targetTable string, attempted bool) error {
+	table := ev.TableSchema()
+
+	// The rows of the tables without a key are recorded without a PK, like
+	// the copied rows without one.
+	var pk uint64
+	if !IsFullRowMatchTable(table) {
+		var err error
+		pk, err = ev.PK()
+		if err != nil {
+			return err
+		}
+	}
+
+	pos := ev.BinlogPosition()
+	record := &AuditRecord{
+		Source:         AuditSourceBinlog,
+		PK:             pk,
+		Before:         auditValues(table, ev.OldValues()),
+		After:          auditValues(table, ev.NewValues()),
+		BinlogPosition: &pos,
+		Attempted:      attempted,
+	}
+
+	switch ev.(type) {
+	case *BinlogInsertEvent:
+		record.Type = "insert"
+	case *BinlogUpdateEvent:
+		record.Type = "update"
+	case *BinlogDeleteEvent:
+		record.Type = "delete"
+	default:
+		return fmt.Errorf("unknown event type %T", ev)
+	}
+
+	return s.write(table, targetDb, targetTable, []*AuditRecord{record})
+}
+
+func (s *AuditSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closeFile()
+}
+
+func (s *AuditSink) write(table *schema.Table, targetDb, targetTable string, records []*AuditRecord) error {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, record := range records {
+		record.Time = now
+		record.Database = table.Schema
+		record.Table = table.Name
+		record.TargetDatabase = targetDb
+		record.TargetTable = targetTable
+		record.FerryId = s.FerryId
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		// A new file is also opened if the sink was closed, as tables may
+		// still be copied after the run, see Ferry.RunStandaloneDataCopy.
+		if s.file == nil || (s.fileSize > 0 && s.fileSize+int64(len(line)) > s.MaxFileSize) {
+			err = s.rotate()
+			if err != nil {
+				return err
+			}
+		}
+
+		n, err := s.writer.Write(line)
+		s.fileSize += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.writer.Flush()
+}
+
+func (s *AuditSink) rotate() error {
+	err := s.closeFile()
+	if err != nil {
+		return err
+	}
+
+	s.fileCounter++
+	path := filepath.Join(s.Directory, fmt.Sprintf("audit-%s-%04d.jsonl", time.Now().UTC().Format("20060102T150405Z"), s.fileCounter))
+
+	s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.writer = bufio.NewWriter(s.file)
+	s.fileSize = 0
+	s.logger.WithField("file", path).Info("writing audit log")
+	return nil
+}
+
+func (s *AuditSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.writer.Flush()
+	if err == nil {
+		err = s.file.Sync()
+	}
+
+	closeErr := s.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	s.file = nil
+	s.writer = nil
+	return err
+}
+
+func auditValues(table *schema.Table, row RowData) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(row))
+	for i, value := range row {
+		if i >= len(table.Columns) {
+			break
+		}
+
+		if b, ok := value.([]byte); ok && utf8.Valid(b) {
+			value = string(b)
+		}
+		values[table.Columns[i].Name] = value
+	}
+
+	return values
+}
@@ -0,0 +1,173 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync"
+)
+
+const DefaultTableWeight = 1
+
+// BatchScheduler limits the number of batches being copied at the same time
+// and hands out the slots to the tables waiting for one using a smooth
+// weighted round-robin. A table with a weight of 3 gets three batches copied
+// for every batch of a table with a weight of 1 while both are waiting, so a
+// single huge table cannot starve the others of connections.
+//
+// The weights and the concurrency can be changed while the tables are being
+// copied.
+type BatchScheduler struct {
+	concurrency int
+
+	mutex *sync.Mutex
+	cond  *sync.Cond
+
+	inFlight       int
+	weights        map[string]int
+	currentWeights map[string]int
+	waiting        map[string]int
+	granted        map[string]int
+}
+
+func NewBatchScheduler(concurrency int) *BatchScheduler {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	mutex := &sync.Mutex{}
+	return &BatchScheduler{
+		concurrency:    concurrency,
+		mutex:          mutex,
+		cond:           sync.NewCond(mutex),
+		weights:        make(map[string]int),
+		currentWeights: make(map[string]int),
+		waiting:        make(map[string]int),
+		granted:        make(map[string]int),
+	}
+}
+
+// Sets the weight of a table, which must be at least 1. Tables without a
+// weight have the DefaultTableWeight.
+func (s *BatchScheduler) SetTableWeight(table string, weight int) error {
+	if weight < 1 {
+		return fmt.Errorf("weight of table %s must be at least 1, got %d", table, weight)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.weights[table] = weight
+	return nil
+}
+
+// Changes the number of batches copied at the same time. The batches in
+// flight are left to finish when the concurrency is lowered.
+func (s *BatchScheduler) SetConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.concurrency = concurrency
+	s.dispatch()
+}
+
+func (s *BatchScheduler) Concurrency() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.concurrency
+}
+
+func (s *BatchScheduler) TableWeight(table string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.weightOf(table)
+}
+
+// Blocks until the table is given a slot to copy a batch. Release must be
+// called once the batch is copied.
+func (s *BatchScheduler) Acquire(table string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.waiting[table]++
+	s.dispatch()
+
+	for s.granted[table] == 0 {
+		s.cond.Wait()
+	}
+
+	s.granted[table]--
+}
+
+func (s *BatchScheduler) Release(table string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.inFlight--
+	s.dispatch()
+}
+
+// Grants the free slots to the waiting tables. Must be called with the mutex
+// held.
+func (s *BatchScheduler) dispatch() {
+	dispatched := false
+
+	for s.inFlight < s.concurrency {
+		table, ok := s.pick()
+		if !ok {
+			break
+		}
+
+		s.waiting[table]--
+		if s.waiting[table] == 0 {
+			delete(s.waiting, table)
+		}
+
+		s.granted[table]++
+		s.inFlight++
+		dispatched = true
+	}
+
+	if dispatched {
+		s.cond.Broadcast()
+	}
+}
+
+// Picks the next waiting table using the smooth weighted round-robin used by
+// nginx: every waiting table accumulates its weight and the table with the
+// highest total is picked and has its total reduced by the sum of the
+// weights. Ties are broken by table name to keep the order deterministic.
+func (s *BatchScheduler) pick() (string, bool) {
+	if len(s.waiting) == 0 {
+		return "", false
+	}
+
+	var picked string
+	totalWeight := 0
+
+	for table := range s.waiting {
+		weight := s.weightOf(table)
+		s.currentWeights[table] += weight
+		totalWeight += weight
+
+		if picked == "" ||
+			s.currentWeights[table] > s.currentWeights[picked] ||
+			(s.currentWeights[table] == s.currentWeights[picked] && table < picked) {
+			picked = table
+		}
+	}
+
+	s.currentWeights[picked] -= totalWeight
+	return picked, true
+}
+
+func (s *BatchScheduler) weightOf(table string) int {
+	if weight, exists := s.weights[table]; exists {
+		return weight
+	}
+	return DefaultTableWeight
+}
@@ -14,52 +14,230 @@ type BatchWriter struct {
 
 	DatabaseRewrites map[string]string
 	TableRewrites    map[string]string
+	Throttler        Throttler
+	RateLimiter      *RateLimiter
 
 	WriteRetries int
 
+	// If set, replaces WriteRetries.
+	WriteRetryPolicy *RetryPolicy
+
+	// Generates the queries writing the batches.
+	//
+	// Optional: defaults to MySQLDialect.
+	Dialect SQLDialect
+
+	// If set, every batch is written to a temporary staging table before
+	// being moved to the target table, see writeStagedRowBatch.
+	StageRowBatches bool
+
+	// If set, the batches are written with LOAD DATA LOCAL INFILE, except
+	// for the tables with columns whose values cannot be loaded from text.
+	LoadDataInfile bool
+
+	// If set, every row is recorded after it is written to the target.
+	AuditSink *AuditSink
+
+	// If set, the primary keys and foreign keys of the remapped tables are
+	// replaced before the batches are written.
+	PrimaryKeyRemapper *PrimaryKeyRemapper
+
+	// If set, the rows holding more bytes than this are written with a
+	// statement of their own, so that a batch with a few huge BLOB or TEXT
+	// values does not exceed the max_allowed_packet of the target.
+	LargeRowBytes uint64
+
+	// If set, the rows skipped by the INSERT IGNORE statements are counted.
+	IgnoredRows *IgnoredRowsCounter
+
+	// If set, prepended to every statement, see Config.CommentTargetStatements.
+	StatementComment string
+
+	// If set, the rows written to the target tables are counted, see
+	// TargetRowGuard.
+	TargetWrites *TargetWriteCounter
+
+	loadDataDisabled int32
+
 	mut        sync.RWMutex
 	statements map[string]*sql.Stmt
+	gipk       *targetGIPKTracker
 	logger     *logrus.Entry
 }
 
 func (w *BatchWriter) Initialize() {
 	w.statements = make(map[string]*sql.Stmt)
+	w.gipk = &targetGIPKTracker{DB: w.DB}
 	w.logger = logrus.WithField("tag", "batch_writer")
+
+	if w.Dialect == nil {
+		w.Dialect = MySQLDialect{}
+	}
 }
 
 func (w *BatchWriter) WriteRowBatch(batch *RowBatch) error {
-	return WithRetries(w.WriteRetries, 0, w.logger, "write batch to target", func() error {
-		if batch.Size() == 0 {
-			return nil
+	if batch.Size() == 0 {
+		return nil
+	}
+
+	db := batch.TableSchema().Schema
+	if targetDbName, exists := w.DatabaseRewrites[db]; exists {
+		db = targetDbName
+	}
+
+	table := batch.TableSchema().Name
+	if targetTableName, exists := w.TableRewrites[table]; exists {
+		table = targetTableName
+	}
+
+	tags := []MetricTag{
+		MetricTag{"table", batch.TableSchema().Name},
+		MetricTag{"source", "table"},
+	}
+
+	var err error
+	var inserted insertCounts
+	metrics.Measure("WriteBatch", tags, 1.0, func() {
+		inserted, err = w.writeRowBatch(batch, db, table)
+	})
+	if err != nil {
+		return err
+	}
+
+	metrics.Count("RowsWritten", int64(batch.Size()), tags, 1.0)
+	metrics.CountTable("Table.RowsCopied", batch.TableSchema().String(), int64(batch.Size()))
+
+	if w.AuditSink == nil {
+		return nil
+	}
+
+	err = w.AuditSink.RecordRowBatch(batch, db, table, inserted.ignoredSome(db+"."+table))
+	if err != nil {
+		return fmt.Errorf("during recording batch in audit log: %v", err)
+	}
+
+	return nil
+}
+
+// Returns the rows inserted, if counted, see newInsertCounts.
+func (w *BatchWriter) writeRowBatch(batch *RowBatch, db, table string) (insertCounts, error) {
+	var inserted insertCounts
+	err := retryPolicyOrDefault(w.WriteRetryPolicy, w.WriteRetries).Do(nil, w.logger, "write batch to target", func() error {
+		inserted = newInsertCounts(w.IgnoredRows, w.AuditSink)
+
+		if w.Throttler != nil {
+			WaitForThrottle(w.Throttler)
 		}
 
-		db := batch.TableSchema().Schema
-		if targetDbName, exists := w.DatabaseRewrites[db]; exists {
-			db = targetDbName
+		if w.RateLimiter != nil {
+			w.RateLimiter.Wait(int64(batch.Size()), rowBatchSize(batch))
 		}
 
-		table := batch.TableSchema().Name
-		if targetTableName, exists := w.TableRewrites[table]; exists {
-			table = targetTableName
+		writtenBatch := batch
+		if w.PrimaryKeyRemapper != nil {
+			var err error
+			writtenBatch, err = w.PrimaryKeyRemapper.RemapRowBatch(batch)
+			if err != nil {
+				return fmt.Errorf("during remapping primary keys: %v", err)
+			}
 		}
 
-		query, args, err := batch.AsSQLQuery(&schema.Table{Schema: db, Name: table})
+		writtenBatch, err := writtenBatch.withEncodedColumns()
 		if err != nil {
-			return fmt.Errorf("during generating sql query: %v", err)
+			return err
 		}
 
-		stmt, err := w.stmtFor(query)
-		if err != nil {
-			return fmt.Errorf("during preparing query (%s): %v", query, err)
+		if writesToMySQL(w.Dialect) && HasGeneratedColumns(writtenBatch.TableSchema()) {
+			writtenBatch = writtenBatch.withoutGeneratedColumns()
 		}
 
-		_, err = stmt.Exec(args...)
-		if err != nil {
-			return fmt.Errorf("during exec query (%s): %v", query, err)
+		if w.Dialect.Name() == DialectMySQL {
+
+			omitGIPK, err := w.gipk.omitGIPK(batch.TableSchema(), db, table)
+			if err != nil {
+				return fmt.Errorf("during checking target table for generated invisible primary key: %v", err)
+			}
+			if omitGIPK {
+				writtenBatch = writtenBatch.withoutGIPK()
+			}
+		}
+
+		if w.LargeRowBytes == 0 {
+			return w.writeRows(writtenBatch, db, table, inserted)
+		}
+
+		// The rows are written with INSERT IGNORE, so the statements do not
+		// have to be in a transaction: the retry writes all of them again.
+		for _, split := range writtenBatch.splitLargeRows(w.LargeRowBytes) {
+			if split.Size() == 1 && uint64(rowDataSize(split.Values()[0])) > w.LargeRowBytes {
+				metrics.Count("LargeRowsWritten", 1, []MetricTag{{"table", batch.TableSchema().Name}}, 1.0)
+			}
+
+			err = w.writeRows(split, db, table, inserted)
+			if err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
+	if err != nil || w.IgnoredRows == nil {
+		return inserted, err
+	}
+
+	return inserted, w.IgnoredRows.record(AuditSourceCopy, inserted)
+}
+
+// Writes the rows to the target table. The rows inserted are added to
+// inserted, if not nil.
+func (w *BatchWriter) writeRows(batch *RowBatch, db, table string, inserted insertCounts) error {
+	w.TargetWrites.Start(db+"."+table, int64(batch.Size()))
+	defer w.TargetWrites.Finish(db+"."+table, int64(batch.Size()))
+
+	if w.StageRowBatches {
+		return w.writeStagedRowBatch(batch, db, table, inserted)
+	}
+
+	if w.canLoadRowBatch(batch) {
+		loaded, err := w.loadRowBatch(batch, db, table, inserted)
+		if loaded || err != nil {
+			return err
+		}
+	}
+
+	query, args, err := w.Dialect.RowBatchQuery(batch, &schema.Table{Schema: db, Name: table})
+	if err != nil {
+		return wrapError(err, "during generating sql query")
+	}
+	query = commentStatement(w.StatementComment, query)
+
+	stmt, err := w.stmtFor(query)
+	if err != nil {
+		return wrapError(err, "during preparing query (%s)", query)
+	}
+
+	result, err := stmt.Exec(args...)
+	if err != nil {
+		return wrapError(err, "during exec query (%s)", query)
+	}
+
+	return addInsertedRows(inserted, db+"."+table, batch.Size(), result)
+}
+
+// Adds the rows inserted by a statement attempting to insert the given
+// number of rows, if inserted is not nil.
+func addInsertedRows(inserted insertCounts, table string, attempted int, result sql.Result) error {
+	if inserted == nil {
+		return nil
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	inserted.add(table, int64(attempted), affected)
+	return nil
 }
 
 func (w *BatchWriter) stmtFor(query string) (*sql.Stmt, error) {
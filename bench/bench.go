@@ -0,0 +1,263 @@
+package bench
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/copydb"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// The rows inserted or updated by a single statement.
+	generateBatchSize = 1000
+
+	// The largest size of the payloads inserted by a single statement.
+	maxInsertBytes = 1024 * 1024
+)
+
+// BenchFerry generates synthetic tables on the source, copies them to the
+// target while timing every phase of the run, so the throughput of
+// Ghostferry can be measured on a given setup and compared across versions.
+//
+// The run has three phases, each measured on its own:
+//
+//  1. the rows of the tables are copied, while the source is not written to;
+//  2. UpdatedRows rows are updated on the source, and their binlog events
+//     are applied to the target until the cutover;
+//  3. all the rows are verified by the IterativeVerifier.
+//
+// The source and the target must be throwaway databases, as the Database is
+// dropped on both of them.
+type BenchFerry struct {
+	Ferry  *ghostferry.Ferry
+	config *Config
+	logger *logrus.Entry
+}
+
+// The throughput of a phase of the run.
+type PhaseResult struct {
+	Rows          int64   `json:"rows"`
+	Seconds       float64 `json:"seconds"`
+	RowsPerSecond float64 `json:"rows_per_second"`
+}
+
+func newPhaseResult(rows int64, duration time.Duration) PhaseResult {
+	result := PhaseResult{
+		Rows:    rows,
+		Seconds: duration.Seconds(),
+	}
+
+	if duration > 0 {
+		result.RowsPerSecond = float64(rows) / duration.Seconds()
+	}
+
+	return result
+}
+
+type Result struct {
+	Copy         PhaseResult `json:"copy"`
+	BinlogApply  PhaseResult `json:"binlog_apply"`
+	Verification PhaseResult `json:"verification"`
+}
+
+func NewFerry(config *Config) *BenchFerry {
+	return &BenchFerry{
+		Ferry: &ghostferry.Ferry{
+			Config: config.Config,
+		},
+		config: config,
+	}
+}
+
+func (this *BenchFerry) Initialize() error {
+	this.logger = logrus.WithField("tag", "bench")
+	return this.Ferry.Initialize()
+}
+
+// Drops and generates the Database on the source, with the same empty
+// tables on the target. Must be called before Start, which loads the
+// schema of the generated tables.
+func (this *BenchFerry) Generate() error {
+	for _, db := range []*sql.DB{this.Ferry.SourceDB, this.Ferry.TargetDB} {
+		err := this.createDatabase(db)
+		if err != nil {
+			return err
+		}
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < this.config.Tables; i++ {
+		this.logger.WithField("table", this.tableName(i)).Info("generating rows")
+
+		err := this.insertRows(i, random)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (this *BenchFerry) Start() error {
+	return this.Ferry.Start()
+}
+
+// Runs the ferry and returns the throughput of every phase. Returns an error
+// if the target does not match the source after the run.
+func (this *BenchFerry) Run() (Result, error) {
+	var result Result
+
+	ferryWG := &sync.WaitGroup{}
+	ferryWG.Add(1)
+
+	start := time.Now()
+	go func() {
+		defer ferryWG.Done()
+		this.Ferry.Run()
+	}()
+
+	this.Ferry.WaitUntilRowCopyIsComplete()
+	generatedRows := int64(this.config.Tables * this.config.RowsPerTable)
+	result.Copy = newPhaseResult(generatedRows, time.Since(start))
+	this.logger.WithField("result", result.Copy).Info("copied rows")
+
+	// The time to update the rows is included, as their events are applied
+	// while they are updated.
+	start = time.Now()
+	err := this.updateRows()
+	if err != nil {
+		return result, err
+	}
+
+	this.Ferry.WaitUntilBinlogStreamerCatchesUp()
+	this.Ferry.FlushBinlogAndStopStreaming()
+	ferryWG.Wait()
+	result.BinlogApply = newPhaseResult(int64(this.config.UpdatedRows), time.Since(start))
+	this.logger.WithField("result", result.BinlogApply).Info("applied binlog events")
+
+	verifier, err := copydb.NewVerifier(this.Ferry, this.config.copydbConfig)
+	if err != nil {
+		return result, err
+	}
+
+	start = time.Now()
+	verificationResult, err := verifier.(*ghostferry.IterativeVerifier).VerifyOnce()
+	if err != nil {
+		return result, err
+	}
+
+	if !verificationResult.DataCorrect {
+		return result, fmt.Errorf("target does not match source: %s", verificationResult.Message)
+	}
+
+	result.Verification = newPhaseResult(generatedRows, time.Since(start))
+	this.logger.WithField("result", result.Verification).Info("verified rows")
+
+	return result, nil
+}
+
+func (this *BenchFerry) tableName(i int) string {
+	return fmt.Sprintf("bench_%d", i)
+}
+
+func (this *BenchFerry) quotedTableName(i int) string {
+	return ghostferry.QuotedTableNameFromString(this.config.Database, this.tableName(i))
+}
+
+func (this *BenchFerry) createDatabase(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", this.config.Database))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE `%s`", this.config.Database))
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < this.config.Tables; i++ {
+		_, err = db.Exec(fmt.Sprintf(
+			"CREATE TABLE %s (id BIGINT NOT NULL AUTO_INCREMENT, data TEXT NOT NULL, counter BIGINT NOT NULL DEFAULT 0, PRIMARY KEY (id))",
+			this.quotedTableName(i),
+		))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (this *BenchFerry) insertRows(table int, random *rand.Rand) error {
+	rowsPerInsert := maxInsertBytes / (this.config.RowSize + 1)
+	if rowsPerInsert > generateBatchSize {
+		rowsPerInsert = generateBatchSize
+	}
+	if rowsPerInsert < 1 {
+		rowsPerInsert = 1
+	}
+
+	query := "INSERT INTO " + this.quotedTableName(table) + " (data) VALUES "
+	for inserted := 0; inserted < this.config.RowsPerTable; inserted += rowsPerInsert {
+		rows := rowsPerInsert
+		if remaining := this.config.RowsPerTable - inserted; remaining < rows {
+			rows = remaining
+		}
+
+		placeholders := make([]string, rows)
+		args := make([]interface{}, rows)
+		for i := range args {
+			placeholders[i] = "(?)"
+			args[i] = randomPayload(random, this.config.RowSize)
+		}
+
+		_, err := this.Ferry.SourceDB.Exec(query+strings.Join(placeholders, ","), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Updates the first rows of every table, UpdatedRows in total, so every
+// updated row yields one binlog event.
+func (this *BenchFerry) updateRows() error {
+	for table := 0; table < this.config.Tables; table++ {
+		rows := this.config.UpdatedRows / this.config.Tables
+		if table < this.config.UpdatedRows%this.config.Tables {
+			rows++
+		}
+
+		query := "UPDATE " + this.quotedTableName(table) + " SET counter = counter + 1 WHERE id BETWEEN ? AND ?"
+		for updated := 0; updated < rows; updated += generateBatchSize {
+			last := updated + generateBatchSize
+			if last > rows {
+				last = rows
+			}
+
+			_, err := this.Ferry.SourceDB.Exec(query, updated+1, last)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+const payloadLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randomPayload(random *rand.Rand, size int) string {
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = payloadLetters[random.Intn(len(payloadLetters))]
+	}
+	return string(payload)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bench"
+	"github.com/sirupsen/logrus"
+)
+
+func usage() {
+	fmt.Printf("ghostferry-bench built with ghostferry %s\n", ghostferry.VersionString)
+	fmt.Printf("Usage: %s [OPTIONS] path/to/config/file.json\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+var verbose bool
+
+func init() {
+	flag.BoolVar(&verbose, "verbose", false, "Show verbose logging output")
+}
+
+func errorAndExit(msg string) {
+	fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+	os.Exit(1)
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	configFilePath := flag.Arg(0)
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		errorAndExit(fmt.Sprintf("%s does not exist", configFilePath))
+	}
+
+	if verbose {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	// Default values for configurations
+	config := &bench.Config{
+		Config: &ghostferry.Config{
+			Source: ghostferry.DatabaseConfig{
+				Port: 3306,
+				User: "ghostferry",
+			},
+
+			Target: ghostferry.DatabaseConfig{
+				Port: 3306,
+				User: "ghostferry",
+			},
+
+			MyServerId: 99399,
+		},
+	}
+
+	// Open and parse configurations
+	f, err := os.Open(configFilePath)
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to open file: %v", err))
+	}
+
+	parser := json.NewDecoder(f)
+	err = parser.Decode(&config)
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to parse config file: %v", err))
+	}
+
+	err = config.InitializeAndValidateConfig()
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to validate config: %v", err))
+	}
+
+	if config.StatsDAddress != "" {
+		_, err = ghostferry.InitializeStatsDMetrics("bench", config.Config, nil)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to initialize metrics: %v", err))
+		}
+	}
+
+	ferry := bench.NewFerry(config)
+
+	err = ferry.Initialize()
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to initialize ferry: %v", err))
+	}
+
+	err = ferry.Generate()
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to generate tables: %v", err))
+	}
+
+	err = ferry.Start()
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to start ferry: %v", err))
+	}
+
+	result, err := ferry.Run()
+	ghostferry.StopAndFlushMetrics()
+
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to benchmark: %v", err))
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to encode result: %v", err))
+	}
+
+	fmt.Println(string(output))
+}
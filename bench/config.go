@@ -0,0 +1,114 @@
+package bench
+
+import (
+	"fmt"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/copydb"
+)
+
+const (
+	DefaultDatabase     = "ghostferry_bench"
+	DefaultTables       = 4
+	DefaultRowsPerTable = 100000
+	DefaultRowSize      = 256
+	DefaultUpdatedRows  = 100000
+
+	// The largest payload that fits in a TEXT column.
+	maxRowSize = 65535
+)
+
+type Config struct {
+	*ghostferry.Config
+
+	// The database generated on the source and the target. It is dropped
+	// and created again on both of them before every run, so it must not
+	// be used for anything else.
+	//
+	// Optional: defaults to ghostferry_bench.
+	Database string
+
+	// The number of tables generated on the source.
+	//
+	// Optional: defaults to 4.
+	Tables int
+
+	// The number of rows generated in every table, before the rows are
+	// copied.
+	//
+	// Optional: defaults to 100000.
+	RowsPerTable int
+
+	// The size in bytes of the payload of every row.
+	//
+	// Optional: defaults to 256.
+	RowSize int
+
+	// The number of rows updated on the source once they are copied, spread
+	// over the tables, whose binlog events are applied to the target.
+	//
+	// Optional: defaults to 100000.
+	UpdatedRows int
+
+	copydbConfig *copydb.Config
+}
+
+func (c *Config) InitializeAndValidateConfig() error {
+	if c.Database == "" {
+		c.Database = DefaultDatabase
+	}
+
+	if c.Tables == 0 {
+		c.Tables = DefaultTables
+	}
+
+	if c.RowsPerTable == 0 {
+		c.RowsPerTable = DefaultRowsPerTable
+	}
+
+	if c.RowSize == 0 {
+		c.RowSize = DefaultRowSize
+	}
+
+	if c.UpdatedRows == 0 {
+		c.UpdatedRows = DefaultUpdatedRows
+	}
+
+	if c.Tables < 0 {
+		return fmt.Errorf("Tables must be positive")
+	}
+
+	if c.RowsPerTable < 0 {
+		return fmt.Errorf("RowsPerTable must be positive")
+	}
+
+	if c.RowSize < 0 || c.RowSize > maxRowSize {
+		return fmt.Errorf("RowSize must be between 1 and %d", maxRowSize)
+	}
+
+	if c.UpdatedRows < 0 {
+		return fmt.Errorf("UpdatedRows must be positive")
+	}
+
+	if c.UpdatedRows > c.Tables*c.RowsPerTable {
+		return fmt.Errorf("UpdatedRows cannot exceed the %d generated rows", c.Tables*c.RowsPerTable)
+	}
+
+	if c.ContinuousReplication {
+		return fmt.Errorf("ContinuousReplication cannot be used to benchmark")
+	}
+
+	// The row copy is timed until it completes, and the rows are verified
+	// after the run.
+	c.AutomaticCutover = true
+
+	c.copydbConfig = &copydb.Config{
+		Config: c.Config,
+		Databases: copydb.FilterAndRewriteConfigs{
+			Whitelist: []string{c.Database},
+		},
+		VerifierType: copydb.VerifierTypeIterative,
+	}
+
+	return c.copydbConfig.InitializeAndValidateConfig()
+}
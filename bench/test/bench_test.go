@@ -0,0 +1,122 @@
+package test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/bench"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type BenchConfigTestSuite struct {
+	suite.Suite
+	config *bench.Config
+}
+
+func (t *BenchConfigTestSuite) SetupTest() {
+	t.config = &bench.Config{
+		Config: testhelpers.NewTestConfig(),
+	}
+}
+
+func (t *BenchConfigTestSuite) TestDefaults() {
+	t.Require().Nil(t.config.InitializeAndValidateConfig())
+
+	t.Require().Equal(bench.DefaultDatabase, t.config.Database)
+	t.Require().Equal(bench.DefaultTables, t.config.Tables)
+	t.Require().Equal(bench.DefaultRowsPerTable, t.config.RowsPerTable)
+	t.Require().Equal(bench.DefaultRowSize, t.config.RowSize)
+	t.Require().Equal(bench.DefaultUpdatedRows, t.config.UpdatedRows)
+	t.Require().True(t.config.AutomaticCutover)
+}
+
+func (t *BenchConfigTestSuite) TestOnlyCopiesBenchDatabase() {
+	t.config.Database = "bench"
+	t.Require().Nil(t.config.InitializeAndValidateConfig())
+
+	dbs, err := t.config.TableFilter.ApplicableDatabases([]string{"bench", "other"})
+	t.Require().Nil(err)
+	t.Require().Equal([]string{"bench"}, dbs)
+}
+
+func (t *BenchConfigTestSuite) TestRowSizeMustFitTextColumn() {
+	t.config.RowSize = 65536
+	err := t.config.InitializeAndValidateConfig()
+	t.Require().EqualError(err, "RowSize must be between 1 and 65535")
+}
+
+func (t *BenchConfigTestSuite) TestUpdatedRowsCannotExceedGeneratedRows() {
+	t.config.Tables = 2
+	t.config.RowsPerTable = 10
+	t.config.UpdatedRows = 21
+	err := t.config.InitializeAndValidateConfig()
+	t.Require().EqualError(err, "UpdatedRows cannot exceed the 20 generated rows")
+}
+
+func (t *BenchConfigTestSuite) TestRejectsContinuousReplication() {
+	t.config.ContinuousReplication = true
+	err := t.config.InitializeAndValidateConfig()
+	t.Require().EqualError(err, "ContinuousReplication cannot be used to benchmark")
+}
+
+func TestBenchConfig(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, new(BenchConfigTestSuite))
+}
+
+type BenchTestSuite struct {
+	suite.Suite
+	config *bench.Config
+}
+
+func (t *BenchTestSuite) SetupTest() {
+	t.config = &bench.Config{
+		Config:       testhelpers.NewTestConfig(),
+		Database:     "gftest_bench",
+		Tables:       2,
+		RowsPerTable: 250,
+		RowSize:      64,
+		UpdatedRows:  101,
+	}
+	t.config.DataIterationBatchSize = 50
+	t.Require().Nil(t.config.InitializeAndValidateConfig())
+}
+
+func (t *BenchTestSuite) TearDownTest() {
+	ferry := &ghostferry.Ferry{Config: t.config.Config}
+	t.Require().Nil(ferry.Initialize())
+
+	for _, db := range []*sql.DB{ferry.SourceDB, ferry.TargetDB} {
+		_, err := db.Exec("DROP DATABASE IF EXISTS gftest_bench")
+		t.Require().Nil(err)
+	}
+}
+
+func (t *BenchTestSuite) TestReportsThroughputOfEveryPhase() {
+	ferry := bench.NewFerry(t.config)
+	t.Require().Nil(ferry.Initialize())
+	t.Require().Nil(ferry.Generate())
+	t.Require().Nil(ferry.Start())
+
+	result, err := ferry.Run()
+	t.Require().Nil(err)
+
+	t.Require().Equal(int64(500), result.Copy.Rows)
+	t.Require().Equal(int64(101), result.BinlogApply.Rows)
+	t.Require().Equal(int64(500), result.Verification.Rows)
+	t.Require().True(result.Copy.RowsPerSecond > 0)
+	t.Require().True(result.BinlogApply.RowsPerSecond > 0)
+	t.Require().True(result.Verification.RowsPerSecond > 0)
+
+	var count int
+	row := ferry.Ferry.TargetDB.QueryRow("SELECT COUNT(*) FROM gftest_bench.bench_1 WHERE counter = 1")
+	t.Require().Nil(row.Scan(&count))
+	t.Require().Equal(50, count)
+}
+
+func TestBench(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, new(BenchTestSuite))
+}
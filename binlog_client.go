@@ -0,0 +1,144 @@
+package ghostferry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// The name of the binlog client implemented with the vendored
+// siddontang/go-mysql replication package, used by default.
+const BinlogClientGoMySQL = "go-mysql"
+
+// BinlogClient reads the binlog of the source as a replica would. It is the
+// only part of the BinlogStreamer that speaks the replication protocol, so
+// the library implementing it can be replaced by registering another client
+// with RegisterBinlogClient and selecting it with Config.BinlogClient.
+//
+// The events are still those of the replication package, which the
+// BinlogStreamer, the binlog filters and the DMLEvents decode: a client
+// built on another library, such as go-mysql-org/go-mysql, converts its
+// events to them.
+type BinlogClient interface {
+	// Starts streaming the binlog from the position, which is at a
+	// transaction boundary.
+	StartSync(pos mysql.Position) (BinlogEventStream, error)
+
+	// Closes the connection to the source. The client is not used again.
+	Close()
+}
+
+// The events streamed by a BinlogClient.
+type BinlogEventStream interface {
+	// Returns the next event, waiting for it until the context is done, in
+	// which case the error of the context is returned.
+	GetEvent(ctx context.Context) (*replication.BinlogEvent, error)
+}
+
+// How a BinlogClient connects to the source. A new client is created from
+// it on every reconnection, as the credentials may have been rotated.
+type BinlogClientConfig struct {
+	ServerID  uint32
+	Host      string
+	Port      uint16
+	User      string
+	Password  string
+	TLSConfig *tls.Config
+
+	// The flavor of the source, FlavorMySQL or FlavorMariaDB.
+	Flavor string
+
+	// Streams the rows events undecoded, for the binlog filter of
+	// Config.FilterBinlogBeforeDecoding to decode.
+	RawModeEnabled bool
+}
+
+// Creates a client streaming the binlog of the source.
+type BinlogClientFactory func(config BinlogClientConfig) (BinlogClient, error)
+
+var (
+	binlogClientsMutex sync.RWMutex
+	binlogClients      = map[string]BinlogClientFactory{
+		BinlogClientGoMySQL: NewGoMySQLBinlogClient,
+	}
+)
+
+// Registers a binlog client under a name, usually from the init function of
+// the package implementing it. Like RegisterPlugin, this panics if the
+// factory is nil or if the name is already registered.
+func RegisterBinlogClient(name string, factory BinlogClientFactory) {
+	binlogClientsMutex.Lock()
+	defer binlogClientsMutex.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("ghostferry: nil factory for binlog client %s", name))
+	}
+
+	if _, exists := binlogClients[name]; exists {
+		panic(fmt.Sprintf("ghostferry: binlog client %s is already registered", name))
+	}
+
+	binlogClients[name] = factory
+}
+
+// Returns the names of the registered binlog clients, sorted.
+func RegisteredBinlogClients() []string {
+	binlogClientsMutex.RLock()
+	defer binlogClientsMutex.RUnlock()
+
+	names := make([]string, 0, len(binlogClients))
+	for name := range binlogClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func binlogClientFactory(name string) (BinlogClientFactory, error) {
+	binlogClientsMutex.RLock()
+	defer binlogClientsMutex.RUnlock()
+
+	factory, exists := binlogClients[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown binlog client %s, registered: %v", name, RegisteredBinlogClients())
+	}
+	return factory, nil
+}
+
+// The BinlogClient of the vendored siddontang/go-mysql replication package.
+type goMySQLBinlogClient struct {
+	syncer *replication.BinlogSyncer
+}
+
+func NewGoMySQLBinlogClient(config BinlogClientConfig) (BinlogClient, error) {
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:       config.ServerID,
+		Host:           config.Host,
+		Port:           config.Port,
+		User:           config.User,
+		Password:       config.Password,
+		TLSConfig:      config.TLSConfig,
+		UseDecimal:     true,
+		Flavor:         config.Flavor,
+		RawModeEnabled: config.RawModeEnabled,
+	})
+
+	return &goMySQLBinlogClient{syncer: syncer}, nil
+}
+
+func (c *goMySQLBinlogClient) StartSync(pos mysql.Position) (BinlogEventStream, error) {
+	streamer, err := c.syncer.StartSync(pos)
+	if err != nil {
+		return nil, err
+	}
+	return streamer, nil
+}
+
+func (c *goMySQLBinlogClient) Close() {
+	c.syncer.Close()
+}
@@ -0,0 +1,91 @@
+package ghostferry
+
+import (
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+)
+
+// binlogRowsFilter decodes the events streamed in raw mode, in which the
+// syncer only decodes the format description and rotate events. The rows
+// events of the tables that are not ferried are left undecoded, which saves
+// most of the decoding work when only a few tables of a busy server are
+// ferried.
+type binlogRowsFilter struct {
+	parser  *replication.BinlogParser
+	format  *replication.FormatDescriptionEvent
+	tracked func(schemaName, tableName string) bool
+
+	// Whether the table of each table id of the current statement is
+	// tracked, as announced by the table map events.
+	trackedTableIds map[uint64]bool
+}
+
+func newBinlogRowsFilter(tracked func(schemaName, tableName string) bool) *binlogRowsFilter {
+	parser := replication.NewBinlogParser()
+	parser.SetUseDecimal(true)
+
+	return &binlogRowsFilter{
+		parser:          parser,
+		tracked:         tracked,
+		trackedTableIds: make(map[uint64]bool),
+	}
+}
+
+// Decodes a raw event. The rows events of the untracked tables are returned
+// undecoded, as a GenericEvent, along with true.
+func (f *binlogRowsFilter) Decode(ev *replication.BinlogEvent) (*replication.BinlogEvent, bool, error) {
+	switch e := ev.Event.(type) {
+	case *replication.FormatDescriptionEvent:
+		// The parser needs the format to decode the following events.
+		f.format = e
+		_, err := f.parser.Parse(ev.RawData)
+		return ev, false, err
+	case *replication.GenericEvent:
+	default:
+		return ev, false, nil
+	}
+
+	if isRowsEventType(ev.Header.EventType) && f.format != nil {
+		tableIdSize := 6
+		if f.format.EventTypeHeaderLengths[ev.Header.EventType-1] == 6 {
+			tableIdSize = 4
+		}
+
+		postHeader := ev.RawData[replication.EventHeaderSize:]
+		if len(postHeader) >= tableIdSize {
+			tableId := mysql.FixedLengthInt(postHeader[:tableIdSize])
+			if !f.trackedTableIds[tableId] {
+				return ev, true, nil
+			}
+		}
+	}
+
+	decoded, err := f.parser.Parse(ev.RawData)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if tableMap, ok := decoded.Event.(*replication.TableMapEvent); ok {
+		schemaName, tableName := string(tableMap.Schema), string(tableMap.Table)
+		f.trackedTableIds[tableMap.TableID] = !IsGhostferryTable(tableName) && f.tracked(schemaName, tableName)
+	}
+
+	return decoded, false, nil
+}
+
+func isRowsEventType(eventType replication.EventType) bool {
+	switch eventType {
+	case replication.WRITE_ROWS_EVENTv0,
+		replication.UPDATE_ROWS_EVENTv0,
+		replication.DELETE_ROWS_EVENTv0,
+		replication.WRITE_ROWS_EVENTv1,
+		replication.UPDATE_ROWS_EVENTv1,
+		replication.DELETE_ROWS_EVENTv1,
+		replication.WRITE_ROWS_EVENTv2,
+		replication.UPDATE_ROWS_EVENTv2,
+		replication.DELETE_ROWS_EVENTv2:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,108 @@
+package ghostferry
+
+import (
+	"fmt"
+
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// Maps the columns of the rows events of a table altered on the source after
+// its schema was loaded to the columns of the loaded schema, which are the
+// columns of the target. Only the changes that keep every loaded column with
+// the same type can be mapped, such as added or reordered columns. The
+// values of the added columns are not written, as the target does not have
+// them.
+type binlogColumnMapping struct {
+	eventColumnCount int
+
+	// The index in the rows of the events of every loaded column.
+	indexes []int
+}
+
+func newBinlogColumnMapping(loaded, altered *schema.Table) (*binlogColumnMapping, error) {
+	alteredColumns := make(map[string]int, len(altered.Columns))
+	for i, column := range altered.Columns {
+		alteredColumns[column.Name] = i
+	}
+
+	mapping := &binlogColumnMapping{
+		eventColumnCount: len(altered.Columns),
+		indexes:          make([]int, len(loaded.Columns)),
+	}
+
+	for i, column := range loaded.Columns {
+		j, exists := alteredColumns[column.Name]
+		if !exists {
+			return nil, fmt.Errorf("column %s was dropped or renamed", column.Name)
+		}
+
+		alteredColumn := altered.Columns[j]
+		if normalizeColumnType(column.RawType) != normalizeColumnType(alteredColumn.RawType) {
+			return nil, fmt.Errorf("column %s was changed from %s to %s", column.Name, column.RawType, alteredColumn.RawType)
+		}
+
+		mapping.indexes[i] = j
+	}
+
+	return mapping, nil
+}
+
+func (m *binlogColumnMapping) remap(row []interface{}) []interface{} {
+	remapped := make([]interface{}, len(m.indexes))
+	for i, j := range m.indexes {
+		remapped[i] = row[j]
+	}
+	return remapped
+}
+
+// Maps the rows of the event to the loaded columns of the table if the
+// table was altered on the source since its schema was loaded. The altered
+// schema is read from the source, and only used if it has the columns of the
+// event, as the source may have been altered again since the event. An
+// error is returned if the change cannot be mapped.
+func (s *BinlogStreamer) remapAlteredColumns(table *schema.Table, rowsEvent *replication.RowsEvent) error {
+	if len(rowsEvent.Rows) == 0 || len(rowsEvent.Rows[0]) == len(table.Columns) {
+		return nil
+	}
+
+	eventColumnCount := len(rowsEvent.Rows[0])
+	mapping, exists := s.columnMappings[table.String()]
+	if !exists || mapping.eventColumnCount != eventColumnCount {
+		altered, err := schema.NewTableFromSqlDB(s.Db, table.Schema, table.Name)
+		if err != nil {
+			return fmt.Errorf("failed to reload the schema of %s, whose events have %d columns instead of %d: %v", table.String(), eventColumnCount, len(table.Columns), err)
+		}
+
+		if len(altered.Columns) != eventColumnCount {
+			return NewClassifiedError(ErrorClassSchemaMismatch, fmt.Errorf("table %s has %d columns but event has %d columns instead, and %d columns on the source", table.String(), len(table.Columns), eventColumnCount, len(altered.Columns)))
+		}
+
+		mapping, err = newBinlogColumnMapping(table, altered)
+		if err != nil {
+			return NewClassifiedError(ErrorClassSchemaMismatch, fmt.Errorf("table %s was altered on the source in a way that cannot be replicated: %v", table.String(), err))
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"table":         table.String(),
+			"loadedColumns": len(table.Columns),
+			"eventColumns":  eventColumnCount,
+		}).Warn("table was altered on the source, only replicating the columns of the target")
+		metrics.Count("BinlogStreamer.SchemaChange", 1, []MetricTag{{"table", table.Name}}, 1.0)
+
+		if s.columnMappings == nil {
+			s.columnMappings = make(map[string]*binlogColumnMapping)
+		}
+		s.columnMappings[table.String()] = mapping
+	}
+
+	for i, row := range rowsEvent.Rows {
+		if len(row) != mapping.eventColumnCount {
+			return NewClassifiedError(ErrorClassSchemaMismatch, fmt.Errorf("table %s has %d columns but event has %d columns instead", table.String(), mapping.eventColumnCount, len(row)))
+		}
+		rowsEvent.Rows[i] = mapping.remap(row)
+	}
+
+	return nil
+}
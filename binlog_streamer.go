@@ -5,6 +5,9 @@ import (
 	"crypto/tls"
 	"database/sql"
 	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/siddontang/go-mysql/mysql"
@@ -20,10 +23,38 @@ type BinlogStreamer struct {
 	ErrorHandler ErrorHandler
 	Filter       CopyFilter
 
+	ExpressionFilter *ExpressionEventFilter
+
 	TableSchema TableSchemaCache
 
-	binlogSyncer               *replication.BinlogSyncer
-	binlogStreamer             *replication.BinlogStreamer
+	// The flavor of the source, FlavorMySQL or FlavorMariaDB, which
+	// changes how the binlog is requested and how the transactions start.
+	//
+	// Optional: defaults to FlavorMySQL.
+	Flavor string
+
+	// The number of times to reconnect to the source and resume streaming
+	// from the last transaction boundary if reading the binlog fails. A
+	// value of 0 makes the first failure fatal.
+	ReconnectAttempts int
+
+	// If set, replaces ReconnectAttempts, its MaxAttempts being the number
+	// of times to reconnect.
+	ReconnectRetryPolicy *RetryPolicy
+
+	// The rows events originating from these servers are skipped, see
+	// ReverseReplicationConfig.
+	IgnoredServerIds []uint32
+
+	// If set, notified of the failures to read the binlog.
+	Notifier *Notifier
+
+	// If set, the streamed positions and the times of their events are
+	// recorded in it.
+	Timeline *BinlogTimeline
+
+	binlogClient               BinlogClient
+	binlogEvents               BinlogEventStream
 	lastStreamedBinlogPosition mysql.Position
 	targetBinlogPosition       mysql.Position
 	lastProcessedEventTime     time.Time
@@ -31,6 +62,30 @@ type BinlogStreamer struct {
 
 	stopRequested bool
 
+	// Set when the streamer is asked to stop as soon as possible, as opposed
+	// to stopping at a target position with FlushAndStop. The streamer only
+	// stops at a transaction boundary, as resuming from the middle of a
+	// transaction would miss the table map events that precede its rows
+	// events.
+	interruptRequested    int32
+	atTransactionBoundary bool
+
+	// The position of the last transaction boundary that was streamed. This
+	// is where the streaming is resumed from after a reconnection.
+	lastResumableBinlogPosition mysql.Position
+
+	// Set if Config.FilterBinlogBeforeDecoding, in which case the events
+	// are streamed undecoded and decoded by the filter.
+	rowsFilter *binlogRowsFilter
+
+	// The events of the transaction being streamed, delivered to the
+	// listeners at its commit if Config.PreserveSourceTransactions.
+	pendingTransactionEvents []DMLEvent
+
+	// The mappings of the columns of the tables altered on the source since
+	// their schema was loaded, see remapAlteredColumns.
+	columnMappings map[string]*binlogColumnMapping
+
 	logger         *logrus.Entry
 	eventListeners []func([]DMLEvent) error
 }
@@ -41,7 +96,7 @@ func (s *BinlogStreamer) Initialize() (err error) {
 	return nil
 }
 
-func (s *BinlogStreamer) createBinlogSyncer() error {
+func (s *BinlogStreamer) createBinlogClient() error {
 	var err error
 	var tlsConfig *tls.Config
 
@@ -60,39 +115,119 @@ func (s *BinlogStreamer) createBinlogSyncer() error {
 		}
 	}
 
-	syncerConfig := replication.BinlogSyncerConfig{
-		ServerID:   s.Config.MyServerId,
-		Host:       s.Config.Source.Host,
-		Port:       s.Config.Source.Port,
-		User:       s.Config.Source.User,
-		Password:   s.Config.Source.Pass,
-		TLSConfig:  tlsConfig,
-		UseDecimal: true,
+	// The credentials are resolved on every reconnection, as they may have
+	// been rotated.
+	credentials, err := s.Config.Source.ResolveCredentials()
+	if err != nil {
+		return err
 	}
 
-	s.binlogSyncer = replication.NewBinlogSyncer(syncerConfig)
-	return nil
-}
+	host, port := s.Config.Source.Host, s.Config.Source.Port
+	if s.Config.Source.Proxy != nil {
+		host, port, err = s.forwardedSourceAddress()
+		if err != nil {
+			return err
+		}
+	}
 
-func (s *BinlogStreamer) ConnectBinlogStreamerToMysql() error {
-	err := s.createBinlogSyncer()
+	clientConfig := BinlogClientConfig{
+		ServerID:  s.Config.MyServerId,
+		Host:      host,
+		Port:      port,
+		User:      credentials.User,
+		Password:  credentials.Password,
+		TLSConfig: tlsConfig,
+		Flavor:    s.Flavor,
+	}
+
+	// Every connection starts with a format description event, so the
+	// filter is recreated along with the client.
+	if s.Config.FilterBinlogBeforeDecoding {
+		clientConfig.RawModeEnabled = true
+		s.rowsFilter = newBinlogRowsFilter(func(schemaName, tableName string) bool {
+			return s.TableSchema.Get(schemaName, tableName) != nil
+		})
+	}
+
+	clientName := s.Config.BinlogClient
+	if clientName == "" {
+		clientName = BinlogClientGoMySQL
+	}
+
+	factory, err := binlogClientFactory(clientName)
 	if err != nil {
 		return err
 	}
 
+	s.binlogClient, err = factory(clientConfig)
+	return err
+}
+
+// The binlog client dials the source itself, so it connects to a local port
+// forwarded to the source through the proxy. The TLS handshake still
+// happens with the source, so the TLS ServerName must be set.
+func (s *BinlogStreamer) forwardedSourceAddress() (string, uint16, error) {
+	address := fmt.Sprintf("%s:%d", s.Config.Source.Host, s.Config.Source.Port)
+	forwarded, err := s.Config.Source.Proxy.forwardedAddress(address)
+	if err != nil {
+		return "", 0, err
+	}
+
+	host, portString, err := net.SplitHostPort(forwarded)
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return host, uint16(port), nil
+}
+
+func (s *BinlogStreamer) ConnectBinlogStreamerToMysql() error {
 	s.logger.Info("reading current binlog position")
-	s.lastStreamedBinlogPosition, err = ShowMasterStatusBinlogPosition(s.Db)
+	pos, err := ShowMasterStatusBinlogPosition(s.Db)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to read current binlog position")
 		return err
 	}
 
+	return s.ConnectBinlogStreamerToMysqlFrom(pos)
+}
+
+// Starts streaming from the given position, which must be at a transaction
+// boundary, such as the position saved when resuming an interrupted run. The
+// source must still have the position in its binlogs.
+func (s *BinlogStreamer) ConnectBinlogStreamerToMysqlFrom(pos mysql.Position) error {
+	files, err := ShowBinaryLogs(s.Db)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to list binlogs")
+		return err
+	}
+
+	err = CheckBinlogPositionAvailable(files, pos)
+	if err != nil {
+		s.logger.WithError(err).Error("binlog position is not available on the source")
+		return err
+	}
+
+	err = s.createBinlogClient()
+	if err != nil {
+		return err
+	}
+
+	s.lastStreamedBinlogPosition = pos
+	s.lastResumableBinlogPosition = pos
+	s.atTransactionBoundary = true
+
 	s.logger.WithFields(logrus.Fields{
 		"file": s.lastStreamedBinlogPosition.Name,
 		"pos":  s.lastStreamedBinlogPosition.Pos,
 	}).Info("found binlog position, starting synchronization")
 
-	s.binlogStreamer, err = s.binlogSyncer.StartSync(s.lastStreamedBinlogPosition)
+	s.binlogEvents, err = s.binlogClient.StartSync(s.lastStreamedBinlogPosition)
 	if err != nil {
 		s.logger.WithError(err).Error("unable to start binlog streamer")
 		return err
@@ -104,18 +239,23 @@ func (s *BinlogStreamer) ConnectBinlogStreamerToMysql() error {
 func (s *BinlogStreamer) Run() {
 	defer func() {
 		s.logger.Info("exiting binlog streamer")
-		s.binlogSyncer.Close()
+		s.binlogClient.Close()
 	}()
 
 	s.logger.Info("starting binlog streamer")
 
 	for !s.stopRequested || (s.stopRequested && s.lastStreamedBinlogPosition.Compare(s.targetBinlogPosition) < 0) {
+		if s.IsInterrupted() && s.atTransactionBoundary {
+			LogWithBinlogPosition(s.logger, s.lastStreamedBinlogPosition).Info("binlog streamer interrupted at transaction boundary")
+			break
+		}
+
 		var ev *replication.BinlogEvent
 		var timedOut bool
 
 		err := WithRetries(5, 0, s.logger, "get binlog event", func() (er error) {
 			ctx, _ := context.WithTimeout(context.Background(), 500*time.Millisecond)
-			ev, er = s.binlogStreamer.GetEvent(ctx)
+			ev, er = s.binlogEvents.GetEvent(ctx)
 
 			if er == context.DeadlineExceeded {
 				timedOut = true
@@ -125,16 +265,41 @@ func (s *BinlogStreamer) Run() {
 			return er
 		})
 
+		if err != nil {
+			err = s.reconnect(err)
+		}
+
 		if err != nil {
 			s.ErrorHandler.Fatal("binlog_streamer", err)
 			return
 		}
 
+		if ev == nil && !timedOut {
+			// Reconnected, the next event is read from the new connection.
+			continue
+		}
+
 		if timedOut {
 			s.lastProcessedEventTime = time.Now()
 			continue
 		}
 
+		// The skipped rows events are left as generic events, which only
+		// advance the position.
+		if s.rowsFilter != nil {
+			var skipped bool
+			ev, skipped, err = s.rowsFilter.Decode(ev)
+			if err != nil {
+				s.logger.WithError(err).Error("failed to decode binlog event")
+				s.ErrorHandler.Fatal("binlog_streamer", err)
+				return
+			}
+
+			if skipped {
+				metrics.Count("BinlogStreamer.SkippedRowsEvent", 1, nil, 1.0)
+			}
+		}
+
 		switch e := ev.Event.(type) {
 		case *replication.RotateEvent:
 			// This event is needed because we need to update the last successful
@@ -153,6 +318,40 @@ func (s *BinlogStreamer) Run() {
 				return
 			}
 
+			s.updateLastStreamedPosAndTime(ev)
+		case *replication.XIDEvent:
+			// The events of the transaction are delivered before the
+			// position moves past it, see Ferry.DrainBinlog.
+			err = s.flushPendingTransactionEvents()
+			s.updateLastStreamedPosAndTime(ev)
+			s.atTransactionBoundary = true
+		case *replication.QueryEvent:
+			// This event can also tell us about table structure change which
+			// means the cached schemas of the tables would be invalidated.
+			// TODO: investigate using this to allow for migrations to occur.
+			//
+			// The transactions on non-transactional tables end with a
+			// COMMIT query instead of a XID event.
+			switch string(e.Query) {
+			case "BEGIN":
+				s.atTransactionBoundary = false
+			case "COMMIT":
+				s.atTransactionBoundary = true
+				err = s.flushPendingTransactionEvents()
+			}
+			s.updateLastStreamedPosAndTime(ev)
+		case *replication.MariadbGTIDEvent:
+			// MariaDB starts the transactions with a GTID event instead of a
+			// BEGIN query, unless the event is flagged as standalone, such
+			// as for DDL statements.
+			if !isStandaloneMariadbGTIDEvent(ev) {
+				s.atTransactionBoundary = false
+			}
+			s.updateLastStreamedPosAndTime(ev)
+		case *replication.MariadbAnnotateRowsEvent:
+			// The statement that produced the following rows events, sent
+			// when binlog_annotate_row_events is enabled.
+			s.logger.Debugf("annotated rows event: %s", e.Query)
 			s.updateLastStreamedPosAndTime(ev)
 		case *replication.FormatDescriptionEvent:
 			// This event has a LogPos = 0, presumably because this is the first
@@ -161,13 +360,91 @@ func (s *BinlogStreamer) Run() {
 			// We don't want to save the binlog position derived from this event
 			// as it will contain the wrong thing.
 			continue
-			// case *replication.QueryEvent:
-			// This event can tell us about table structure change which means
-			// the cached schemas of the tables would be invalidated.
-			// TODO: investigate using this to allow for migrations to occur.
 		default:
 			s.updateLastStreamedPosAndTime(ev)
 		}
+
+		if err != nil {
+			s.logger.WithError(err).Error("failed to handle transaction events")
+			s.ErrorHandler.Fatal("binlog_streamer", err)
+			return
+		}
+
+		if s.atTransactionBoundary {
+			s.lastResumableBinlogPosition = s.lastStreamedBinlogPosition
+		}
+	}
+
+	// The target position of FlushAndStop is normally a transaction
+	// boundary, but the events streamed so far must not be lost otherwise.
+	if len(s.pendingTransactionEvents) > 0 {
+		LogWithBinlogPosition(s.logger, s.lastStreamedBinlogPosition).Warn("stopping in the middle of a transaction, writing its streamed events")
+		err := s.flushPendingTransactionEvents()
+		if err != nil {
+			s.ErrorHandler.Fatal("binlog_streamer", err)
+		}
+	}
+}
+
+// Reconnects to the source after reading the binlog failed with err, and
+// resumes streaming from the last transaction boundary. The events of the
+// partially streamed transaction are streamed again, which is harmless as
+// applying them is idempotent.
+//
+// Returns err if all the reconnection attempts failed.
+func (s *BinlogStreamer) reconnect(err error) error {
+	policy := s.reconnectRetryPolicy()
+
+	if s.Notifier != nil {
+		s.Notifier.Notify(NotificationBinlogError, err.Error())
+	}
+
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if s.IsInterrupted() || !policy.Retryable(err) {
+			return err
+		}
+
+		backoff := policy.withJitter(policy.DelayAfter(attempt))
+
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"attempt":  attempt,
+			"backoff":  backoff,
+			"position": s.lastResumableBinlogPosition,
+		}).Warn("failed to read binlog, reconnecting")
+		time.Sleep(backoff)
+
+		s.binlogClient.Close()
+
+		err = s.createBinlogClient()
+		if err != nil {
+			continue
+		}
+
+		s.binlogEvents, err = s.binlogClient.StartSync(s.lastResumableBinlogPosition)
+		if err != nil {
+			continue
+		}
+
+		s.lastStreamedBinlogPosition = s.lastResumableBinlogPosition
+		s.atTransactionBoundary = true
+		metrics.Count("BinlogStreamer.Reconnect", 1, nil, 1.0)
+		s.logger.Info("reconnected to source")
+		return nil
+	}
+
+	return err
+}
+
+func (s *BinlogStreamer) reconnectRetryPolicy() *RetryPolicy {
+	if s.ReconnectRetryPolicy != nil {
+		return s.ReconnectRetryPolicy
+	}
+
+	return &RetryPolicy{
+		MaxAttempts:  s.ReconnectAttempts,
+		Backoff:      RetryBackoffLinear,
+		initialDelay: time.Second,
+		maxDelay:     30 * time.Second,
 	}
 }
 
@@ -179,10 +456,28 @@ func (s *BinlogStreamer) GetLastStreamedBinlogPosition() mysql.Position {
 	return s.lastStreamedBinlogPosition
 }
 
+// The time elapsed since the last event was streamed, or since the streamer
+// last checked that there were no events to stream.
+func (s *BinlogStreamer) Lag() time.Duration {
+	return time.Since(s.lastProcessedEventTime)
+}
+
 func (s *BinlogStreamer) IsAlmostCaughtUp() bool {
 	return time.Now().Sub(s.lastProcessedEventTime) < caughtUpThreshold
 }
 
+// Stops the streamer at the next transaction boundary without waiting for
+// it to catch up. The events streamed so far are still delivered to the
+// event listeners.
+func (s *BinlogStreamer) Interrupt() {
+	s.logger.Info("requesting binlog streamer to stop at the next transaction boundary")
+	atomic.StoreInt32(&s.interruptRequested, 1)
+}
+
+func (s *BinlogStreamer) IsInterrupted() bool {
+	return atomic.LoadInt32(&s.interruptRequested) == 1
+}
+
 func (s *BinlogStreamer) FlushAndStop() {
 	s.logger.Info("requesting binlog streamer to stop")
 	// Must first read the binlog position before requesting stop
@@ -200,7 +495,7 @@ func (s *BinlogStreamer) FlushAndStop() {
 		s.ErrorHandler.Fatal("binlog_streamer", err)
 		return
 	}
-	s.logger.WithField("target_position", s.targetBinlogPosition).Info("current stop binlog position was recorded")
+	LogWithBinlogPosition(s.logger, s.targetBinlogPosition).Info("current stop binlog position was recorded")
 
 	s.stopRequested = true
 }
@@ -216,6 +511,10 @@ func (s *BinlogStreamer) updateLastStreamedPosAndTime(ev *replication.BinlogEven
 	eventTime := time.Unix(int64(ev.Header.Timestamp), 0)
 	s.lastProcessedEventTime = eventTime
 
+	if s.Timeline != nil {
+		s.Timeline.Record(s.lastStreamedBinlogPosition, eventTime)
+	}
+
 	if time.Since(s.lastLagMetricEmittedTime) >= time.Second {
 		lag := time.Since(eventTime)
 		metrics.Gauge("BinlogStreamer.Lag", lag.Seconds(), nil, 1.0)
@@ -227,12 +526,28 @@ func (s *BinlogStreamer) handleRowsEvent(ev *replication.BinlogEvent) error {
 	eventTime := time.Unix(int64(ev.Header.Timestamp), 0)
 	rowsEvent := ev.Event.(*replication.RowsEvent)
 
+	if IsGhostferryTable(string(rowsEvent.Table.Table)) {
+		return nil
+	}
+
+	for _, serverId := range s.IgnoredServerIds {
+		if ev.Header.ServerID == serverId {
+			metrics.Count("BinlogStreamer.IgnoredServerEvent", 1, nil, 1.0)
+			return nil
+		}
+	}
+
 	table := s.TableSchema.Get(string(rowsEvent.Table.Schema), string(rowsEvent.Table.Table))
 	if table == nil {
 		return nil
 	}
 
-	dmlEvs, err := NewBinlogDMLEvents(table, ev)
+	err := s.remapAlteredColumns(table, rowsEvent)
+	if err != nil {
+		return err
+	}
+
+	dmlEvs, err := NewBinlogDMLEvents(table, ev, s.lastResumableBinlogPosition)
 	if err != nil {
 		return err
 	}
@@ -251,18 +566,48 @@ func (s *BinlogStreamer) handleRowsEvent(ev *replication.BinlogEvent) error {
 			}
 		}
 
-		events = append(events, dmlEv)
-		s.logger.WithFields(logrus.Fields{
-			"database": dmlEv.Database(),
-			"table":    dmlEv.Table(),
-		}).Debugf("received event %T at %v", dmlEv, eventTime)
+		filteredEvs := []DMLEvent{dmlEv}
+		if s.ExpressionFilter != nil {
+			filteredEvs, err = s.ExpressionFilter.FilterEvent(dmlEv)
+			if err != nil {
+				s.logger.WithError(err).Error("failed to evaluate expression filter for event")
+				return err
+			}
+		}
+
+		for _, dmlEv := range filteredEvs {
+			events = append(events, dmlEv)
+			s.logger.WithFields(logrus.Fields{
+				"database": dmlEv.Database(),
+				"table":    dmlEv.Table(),
+			}).Debugf("received event %T at %v", dmlEv, eventTime)
+
+			metrics.Count("RowEvent", 1, []MetricTag{
+				MetricTag{"table", dmlEv.Table()},
+				MetricTag{"source", "binlog"},
+			}, 1.0)
+		}
+	}
 
-		metrics.Count("RowEvent", 1, []MetricTag{
-			MetricTag{"table", dmlEv.Table()},
-			MetricTag{"source", "binlog"},
-		}, 1.0)
+	if s.Config.PreserveSourceTransactions {
+		s.pendingTransactionEvents = append(s.pendingTransactionEvents, events...)
+		return nil
 	}
 
+	return s.notifyEventListeners(events)
+}
+
+func (s *BinlogStreamer) flushPendingTransactionEvents() error {
+	if len(s.pendingTransactionEvents) == 0 {
+		return nil
+	}
+
+	events := s.pendingTransactionEvents
+	s.pendingTransactionEvents = nil
+	return s.notifyEventListeners(events)
+}
+
+func (s *BinlogStreamer) notifyEventListeners(events []DMLEvent) error {
 	for _, listener := range s.eventListeners {
 		err := listener(events)
 		if err != nil {
@@ -273,6 +618,20 @@ func (s *BinlogStreamer) handleRowsEvent(ev *replication.BinlogEvent) error {
 	return nil
 }
 
+// The flags of MariaDB GTID events follow the sequence number and the
+// domain id. The vendored parser does not decode them.
+const (
+	mariadbGTIDFlagsOffset = replication.EventHeaderSize + 8 + 4
+	mariadbGTIDStandalone  = 0x01
+)
+
+func isStandaloneMariadbGTIDEvent(ev *replication.BinlogEvent) bool {
+	if len(ev.RawData) <= mariadbGTIDFlagsOffset {
+		return false
+	}
+	return ev.RawData[mariadbGTIDFlagsOffset]&mariadbGTIDStandalone != 0
+}
+
 func (s *BinlogStreamer) generateNewServerId() (uint32, error) {
 	var id uint32
 
@@ -0,0 +1,116 @@
+package ghostferry
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// A binlog position and the time its event was written to the binlog of the
+// source.
+type BinlogTimelineEntry struct {
+	Position  mysql.Position
+	EventTime time.Time
+}
+
+// BinlogTimeline keeps a rolling sample of the positions streamed from the
+// binlog and of the times of their events, so a position, such as the one
+// the target was written up to or the one a state dump resumes from, can be
+// translated into the wall clock time of the source it corresponds to. The
+// entries are kept in the SerializableState, so a resumed run knows how far
+// behind the source it starts.
+//
+// The times are as precise as the Interval between the entries.
+type BinlogTimeline struct {
+	// The minimum time between the events of two entries.
+	Interval time.Duration
+
+	// The oldest entries are dropped beyond this many entries.
+	MaxEntries int
+
+	mutex   sync.RWMutex
+	entries []BinlogTimelineEntry
+}
+
+// Records the time of the event at the position, if the last entry is older
+// than the Interval. The positions streamed again after a reconnection are
+// not recorded again.
+func (t *BinlogTimeline) Record(pos mysql.Position, eventTime time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.entries) > 0 {
+		last := t.entries[len(t.entries)-1]
+		if pos.Compare(last.Position) <= 0 || eventTime.Sub(last.EventTime) < t.Interval {
+			return
+		}
+	}
+
+	t.entries = append(t.entries, BinlogTimelineEntry{Position: pos, EventTime: eventTime})
+	if t.MaxEntries > 0 && len(t.entries) > t.MaxEntries {
+		t.entries = append([]BinlogTimelineEntry(nil), t.entries[len(t.entries)-t.MaxEntries:]...)
+	}
+}
+
+// Replaces the entries with those of a previous run, see
+// SerializableState.BinlogTimeline.
+func (t *BinlogTimeline) Restore(entries []BinlogTimelineEntry) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.entries = append([]BinlogTimelineEntry(nil), entries...)
+}
+
+func (t *BinlogTimeline) Entries() []BinlogTimelineEntry {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return append([]BinlogTimelineEntry(nil), t.entries...)
+}
+
+// Returns the time of the last entry at or before the position. Returns
+// false if the position is before the first entry.
+func (t *BinlogTimeline) EventTime(pos mysql.Position) (time.Time, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].Position.Compare(pos) > 0
+	})
+	if i == 0 {
+		return time.Time{}, false
+	}
+	return t.entries[i-1].EventTime, true
+}
+
+// Returns the position of the last entry whose event happened at or before
+// the time. Returns false if the time is before the first entry.
+func (t *BinlogTimeline) Position(eventTime time.Time) (mysql.Position, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].EventTime.After(eventTime)
+	})
+	if i == 0 {
+		return mysql.Position{}, false
+	}
+	return t.entries[i-1].Position, true
+}
+
+// Returns the time on the source of the events being written to the target:
+// the time of the last written event, or, until an event is written by a
+// resumed run, the time of the position it resumed from according to the
+// timeline of the previous runs. Returns false if the time is not known.
+func (f *Ferry) ApplyingEventsFrom() (time.Time, bool) {
+	if eventTime := f.BinlogWriter.LastWrittenEventTime(); !eventTime.IsZero() {
+		return eventTime, true
+	}
+
+	if f.BinlogTimeline == nil {
+		return time.Time{}, false
+	}
+	return f.BinlogTimeline.EventTime(f.BinlogWriter.LastWrittenBinlogPosition())
+}
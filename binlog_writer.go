@@ -3,7 +3,11 @@ package ghostferry
 import (
 	"database/sql"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/schema"
 	"github.com/sirupsen/logrus"
 )
@@ -13,64 +17,400 @@ type BinlogWriter struct {
 	DatabaseRewrites map[string]string
 	TableRewrites    map[string]string
 	Throttler        Throttler
+	RateLimiter      *RateLimiter
 
 	BatchSize    int
 	WriteRetries int
 
+	// The maximum number of consecutive inserts into the same table written
+	// by a single statement. Only used with the MySQLDialect.
+	InsertBatchSize int
+
+	// If set, the batches of events with more events or statements are
+	// written in several target transactions, such as a large source
+	// transaction with PreserveTransactions. The position of the events of
+	// a source transaction is the position before it, so a run resumed
+	// after writing part of it writes the whole transaction again. See
+	// Config.BinlogMaxTransactionRows.
+	MaxTransactionRows       int
+	MaxTransactionStatements int
+
+	// If set, replaces WriteRetries.
+	WriteRetryPolicy *RetryPolicy
+
+	// Generates the statements applying the events.
+	//
+	// Optional: defaults to MySQLDialect.
+	Dialect SQLDialect
+
 	ErrorHandler ErrorHandler
 
-	binlogEventBuffer chan DMLEvent
-	logger            *logrus.Entry
+	// If set, every event is recorded after it is written to the target. The
+	// statements of a batch are then executed one at a time, to count the
+	// rows inserted, see AuditRecord.Attempted.
+	AuditSink *AuditSink
+
+	// If set, a batch that cannot be written is split into its events, and
+	// the events that still cannot be written after DeadLetterRetries
+	// attempts are recorded to this sink instead of aborting the ferry.
+	DeadLetterSink         *DeadLetterSink
+	DeadLetterRetries      int
+	DeadLetterRetryBackoff time.Duration
+
+	// If set, the primary keys and foreign keys of the remapped tables are
+	// replaced before the events are written.
+	PrimaryKeyRemapper *PrimaryKeyRemapper
+
+	// The groups of the tables related by foreign keys, keyed by full source
+	// table name, see ForeignKeyGroups. The events are always written in
+	// the order of the binlog, so the events of these tables are never dead
+	// lettered: skipping one would apply the later events of the related
+	// tables out of order, such as the insert of a child row before the
+	// insert of its parent. See Config.StrictForeignKeyOrdering.
+	ForeignKeyGroups map[string]string
+
+	// If set, the events passed together to BufferBinlogEvents, which are
+	// the events of a source transaction when the BinlogStreamer groups them,
+	// are always written in the same target transaction.
+	PreserveTransactions bool
+
+	// If set, the UPDATE and DELETE of the tables without a key only change
+	// one of the matching rows. See Config.FullRowMatching.
+	FullRowMatching bool
+
+	// If set, the buffered events are accounted until they are written, and
+	// BufferBinlogEvents blocks while the budget is exceeded, which slows
+	// down the BinlogStreamer.
+	MemoryBudget *MemoryBudget
+
+	// If set, the events are only written while the binlog is not paused.
+	Pauser *ComponentPauser
+
+	// If set, the rows skipped by the INSERT IGNORE statements are counted.
+	// The statements of a batch are then executed one at a time.
+	IgnoredRows *IgnoredRowsCounter
+
+	// If set, prepended to every statement, see Config.CommentTargetStatements.
+	StatementComment string
+
+	// If set, the rows written to the target tables are counted, see
+	// TargetRowGuard.
+	TargetWrites *TargetWriteCounter
+
+	binlogEventBuffer       chan DMLEvent
+	binlogTransactionBuffer chan []DMLEvent
+	gipk                    *targetGIPKTracker
+	logger                  *logrus.Entry
+
+	lastWrittenBinlogPosition mysql.Position
+	lastWrittenEventTime      time.Time
+	lastWriteLag              time.Duration
+	lastLagMetricEmittedTime  time.Time
+	positionMutex             *sync.RWMutex
+
+	// The events buffered or being written, see PendingEvents.
+	pendingEvents int64
 }
 
 func (b *BinlogWriter) Initialize() error {
 	b.logger = logrus.WithField("tag", "binlog_writer")
 	b.binlogEventBuffer = make(chan DMLEvent, b.BatchSize)
+	b.binlogTransactionBuffer = make(chan []DMLEvent, b.BatchSize)
+	b.positionMutex = &sync.RWMutex{}
+	b.gipk = &targetGIPKTracker{DB: b.DB}
+
+	if b.Dialect == nil {
+		b.Dialect = MySQLDialect{}
+	}
 	return nil
 }
 
+// Sets the position the binlog is streamed from, which is resumable until
+// the first events are written.
+func (b *BinlogWriter) SetStartBinlogPosition(pos mysql.Position) {
+	b.positionMutex.Lock()
+	defer b.positionMutex.Unlock()
+
+	b.lastWrittenBinlogPosition = pos
+}
+
+// The position from which the binlog streaming can be resumed without
+// missing any event that was not written to the target yet.
+func (b *BinlogWriter) LastWrittenBinlogPosition() mysql.Position {
+	b.positionMutex.RLock()
+	defer b.positionMutex.RUnlock()
+
+	return b.lastWrittenBinlogPosition
+}
+
 func (b *BinlogWriter) Run() {
-	batch := make([]DMLEvent, 0, b.BatchSize)
 	for {
-		firstEvent := <-b.binlogEventBuffer
-		if firstEvent == nil {
+		var batch []DMLEvent
+		if b.PreserveTransactions {
+			batch = b.nextTransactionsBatch()
+		} else {
+			batch = b.nextEventsBatch()
+		}
+
+		if batch == nil {
 			// Channel is closed, no more events to write
 			break
 		}
 
-		batch = append(batch, firstEvent)
-		wantMoreEvents := true
-		for wantMoreEvents && len(batch) < b.BatchSize {
-			select {
-			case event := <-b.binlogEventBuffer:
-				if event != nil {
-					batch = append(batch, event)
-				} else {
-					// Channel is closed, finish writing batch.
-					wantMoreEvents = false
-				}
-			default: // Nothing in the buffer so just write it
-				wantMoreEvents = false
+		chunks := b.splitBatch(batch)
+		if len(chunks) > 1 {
+			metrics.Count("BinlogWriter.SplitBatches", 1, nil, 1.0)
+			b.logger.WithFields(logrus.Fields{
+				"events":       len(batch),
+				"transactions": len(chunks),
+			}).Debug("writing batch in several transactions")
+		}
+
+		for _, chunk := range chunks {
+			if !b.writeBatch(chunk) {
+				return
 			}
 		}
+	}
+}
+
+// Writes the batch in a transaction of the target and moves the last
+// written position past it. Returns false if the ferry is aborted.
+func (b *BinlogWriter) writeBatch(batch []DMLEvent) bool {
+	// Computed before the dead lettered events are dropped from the
+	// batch, as all of them were accounted.
+	bufferedSize := b.bufferedSize(batch)
+	batchLength := int64(len(batch))
 
-		err := WithRetries(b.WriteRetries, 0, b.logger, "write events to target", func() error {
-			return b.writeEvents(batch)
+	// The dead lettered events are handled as well, so the position
+	// moves past them.
+	lastPos := batch[len(batch)-1].BinlogPosition()
+
+	var err error
+	var inserted insertCounts
+	metrics.Measure("WriteEvents", []MetricTag{MetricTag{"source", "binlog"}}, 1.0, func() {
+		err = retryPolicyOrDefault(b.WriteRetryPolicy, b.WriteRetries).Do(nil, b.logger, "write events to target", func() error {
+			inserted = newInsertCounts(b.IgnoredRows, b.AuditSink)
+			return b.writeEvents(batch, inserted)
 		})
-		if err != nil {
-			b.ErrorHandler.Fatal("binlog_writer", err)
-			return
+	})
+	if err != nil && b.DeadLetterSink != nil && isEventError(err) {
+		b.logger.WithError(err).Warn("failed to write batch, writing the events one by one")
+		inserted = newInsertCounts(b.IgnoredRows, b.AuditSink)
+		batch, err = b.writeEventsOrDeadLetter(batch, inserted)
+	}
+	if err == nil && b.IgnoredRows != nil {
+		err = b.IgnoredRows.record(AuditSourceBinlog, inserted)
+	}
+	if err != nil {
+		b.ErrorHandler.Fatal("binlog_writer", err)
+		return false
+	}
+
+	for _, ev := range batch {
+		metrics.Count("RowsWritten", 1, []MetricTag{
+			MetricTag{"table", ev.Table()},
+			MetricTag{"source", "binlog"},
+		}, 1.0)
+		metrics.CountTable("Table.EventsApplied", ev.Database()+"."+ev.Table(), 1)
+	}
+
+	if b.AuditSink != nil {
+		for _, ev := range batch {
+			targetDb, targetTable := b.targetTableName(ev.Database(), ev.Table())
+			_, isInsert := ev.(*BinlogInsertEvent)
+			attempted := isInsert && inserted.ignoredSome(targetDb+"."+targetTable)
+			err = b.AuditSink.RecordDMLEvent(ev, targetDb, targetTable, attempted)
+			if err != nil {
+				b.ErrorHandler.Fatal("binlog_writer", fmt.Errorf("recording event in audit log: %v", err))
+				return false
+			}
+		}
+	}
+
+	b.updateLastWritten(lastPos, batch[len(batch)-1].Timestamp())
+	atomic.AddInt64(&b.pendingEvents, -batchLength)
+
+	if b.MemoryBudget != nil {
+		b.MemoryBudget.Release(MemoryBinlog, bufferedSize)
+	}
+
+	return true
+}
+
+// Splits the batch into the events written in separate target transactions,
+// with at most MaxTransactionRows events and MaxTransactionStatements
+// statements each. The inserts written by a single statement, see
+// InsertBatchSize, are never split.
+func (b *BinlogWriter) splitBatch(batch []DMLEvent) [][]DMLEvent {
+	if b.MaxTransactionRows <= 0 && b.MaxTransactionStatements <= 0 {
+		return [][]DMLEvent{batch}
+	}
+
+	var chunks [][]DMLEvent
+	start, statements, coalescedInserts := 0, 0, 0
+	for i, ev := range batch {
+		coalesced := coalescedInserts > 0 && coalescedInserts < b.InsertBatchSize && b.coalescesInserts(batch[i-1], ev)
+
+		rowsFull := b.MaxTransactionRows > 0 && i-start == b.MaxTransactionRows
+		statementsFull := b.MaxTransactionStatements > 0 && !coalesced && statements == b.MaxTransactionStatements
+		if i > start && (rowsFull || statementsFull) {
+			chunks = append(chunks, batch[start:i])
+			start, statements, coalesced = i, 0, false
+		}
+
+		if coalesced {
+			coalescedInserts++
+			continue
+		}
+
+		statements++
+		coalescedInserts = 0
+		if _, isInsert := ev.(*BinlogInsertEvent); isInsert {
+			coalescedInserts = 1
+		}
+	}
+
+	return append(chunks, batch[start:])
+}
+
+// Returns true if the insert following the previous insert is written by
+// the same statement, see writeEvents.
+func (b *BinlogWriter) coalescesInserts(previous, ev DMLEvent) bool {
+	if b.InsertBatchSize <= 1 || b.Dialect.Name() != DialectMySQL {
+		return false
+	}
+
+	previousInsert, isInsert := previous.(*BinlogInsertEvent)
+	if !isInsert {
+		return false
+	}
+
+	insert, isInsert := ev.(*BinlogInsertEvent)
+	if !isInsert {
+		return false
+	}
+
+	previousDb, previousTable := b.targetTableName(previous.Database(), previous.Table())
+	targetDb, targetTable := b.targetTableName(ev.Database(), ev.Table())
+	return sameInsertTable(previousInsert, &schema.Table{Schema: previousDb, Name: previousTable}, insert, &schema.Table{Schema: targetDb, Name: targetTable})
+}
+
+// Returns the buffered events, up to BatchSize, waiting for at least one.
+// Returns nil once the buffer is closed and drained.
+func (b *BinlogWriter) nextEventsBatch() []DMLEvent {
+	firstEvent := <-b.binlogEventBuffer
+	if firstEvent == nil {
+		return nil
+	}
+
+	batch := make([]DMLEvent, 0, b.BatchSize)
+	batch = append(batch, firstEvent)
+	for len(batch) < b.BatchSize {
+		select {
+		case event := <-b.binlogEventBuffer:
+			if event == nil {
+				// Channel is closed, finish writing batch.
+				return batch
+			}
+			batch = append(batch, event)
+		default: // Nothing in the buffer so just write it
+			return batch
+		}
+	}
+
+	return batch
+}
+
+// Returns the events of the buffered transactions, adding whole transactions
+// while the batch is smaller than BatchSize. A single transaction is never
+// split, even if it is larger than BatchSize.
+func (b *BinlogWriter) nextTransactionsBatch() []DMLEvent {
+	events, ok := <-b.binlogTransactionBuffer
+	if !ok {
+		return nil
+	}
+
+	// The events are shared with the other listeners of the streamer.
+	batch := make([]DMLEvent, 0, b.BatchSize)
+	batch = append(batch, events...)
+	for len(batch) < b.BatchSize {
+		select {
+		case events, ok := <-b.binlogTransactionBuffer:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, events...)
+		default:
+			return batch
 		}
+	}
+
+	return batch
+}
 
-		batch = make([]DMLEvent, 0, b.BatchSize)
+func (b *BinlogWriter) updateLastWritten(pos mysql.Position, eventTime time.Time) {
+	b.positionMutex.Lock()
+	defer b.positionMutex.Unlock()
+
+	b.lastWrittenBinlogPosition = pos
+	b.lastWrittenEventTime = eventTime
+	b.lastWriteLag = time.Since(eventTime)
+
+	if time.Since(b.lastLagMetricEmittedTime) >= time.Second {
+		metrics.Gauge("BinlogWriter.Lag", b.lastWriteLag.Seconds(), nil, 1.0)
+		b.lastLagMetricEmittedTime = time.Now()
 	}
 }
 
+// The time of the last written event on the source, or the zero time if no
+// event was written yet.
+func (b *BinlogWriter) LastWrittenEventTime() time.Time {
+	b.positionMutex.RLock()
+	defer b.positionMutex.RUnlock()
+
+	return b.lastWrittenEventTime
+}
+
+// The delay between the writing of the events to the binlog of the source
+// and their writing to the target, as of the last written event. While
+// events are waiting to be written, it is at least the age of the last
+// written event, so the lag keeps growing if the writes are stuck.
+func (b *BinlogWriter) Lag() time.Duration {
+	b.positionMutex.RLock()
+	defer b.positionMutex.RUnlock()
+
+	if b.lastWrittenEventTime.IsZero() {
+		return 0
+	}
+
+	if b.BufferDepth() > 0 {
+		return time.Since(b.lastWrittenEventTime)
+	}
+
+	return b.lastWriteLag
+}
+
 func (b *BinlogWriter) Stop() {
 	close(b.binlogEventBuffer)
+	close(b.binlogTransactionBuffer)
 }
 
 func (b *BinlogWriter) BufferBinlogEvents(events []DMLEvent) error {
+	atomic.AddInt64(&b.pendingEvents, int64(len(events)))
+
+	if b.MemoryBudget != nil {
+		b.MemoryBudget.Wait(MemoryBinlog)
+		b.MemoryBudget.Add(MemoryBinlog, b.bufferedSize(events))
+	}
+
+	if b.PreserveTransactions {
+		if len(events) > 0 {
+			b.binlogTransactionBuffer <- events
+		}
+		return nil
+	}
+
 	for _, event := range events {
 		b.binlogEventBuffer <- event
 	}
@@ -78,37 +418,313 @@ func (b *BinlogWriter) BufferBinlogEvents(events []DMLEvent) error {
 	return nil
 }
 
-func (b *BinlogWriter) writeEvents(events []DMLEvent) error {
+// The memory accounted for the events while they are buffered.
+func (b *BinlogWriter) bufferedSize(events []DMLEvent) int64 {
+	if b.MemoryBudget == nil {
+		return 0
+	}
+	return dmlEventsSize(events)
+}
+
+// The number of events buffered and waiting to be written to the target, or
+// of transactions if PreserveTransactions.
+func (b *BinlogWriter) BufferDepth() int64 {
+	if b.PreserveTransactions {
+		return int64(len(b.binlogTransactionBuffer))
+	}
+	return int64(len(b.binlogEventBuffer))
+}
+
+// The number of events buffered or being written to the target. Once the
+// BinlogStreamer streamed past a position, every event before it was
+// written when this is 0.
+func (b *BinlogWriter) PendingEvents() int64 {
+	return atomic.LoadInt64(&b.pendingEvents)
+}
+
+// Writes the events to the target. The rows inserted are added to inserted,
+// if not nil.
+func (b *BinlogWriter) writeEvents(events []DMLEvent, inserted insertCounts) error {
 	WaitForThrottle(b.Throttler)
+	if b.Pauser != nil {
+		b.Pauser.Wait(PauseBinlog)
+	}
 
-	queryBuffer := []byte("BEGIN;\n")
+	if b.RateLimiter != nil {
+		b.RateLimiter.Wait(int64(len(events)), dmlEventsSize(events))
+	}
+
+	var statements []binlogStatement
+
+	// The rows of the events, by full target table name.
+	writes := make(map[string]int64)
+
+	// The consecutive inserts into the same table, written together.
+	var inserts []*BinlogInsertEvent
+	var insertsTarget *schema.Table
+	flushInserts := func() error {
+		if len(inserts) == 0 {
+			return nil
+		}
+
+		sql, err := insertEventsAsSQLString(inserts, insertsTarget)
+		if err != nil {
+			return wrapError(err, "generating sql query")
+		}
+
+		statements = append(statements, binlogStatement{
+			query:   commentStatement(b.StatementComment, sql),
+			table:   insertsTarget.Schema + "." + insertsTarget.Name,
+			inserts: len(inserts),
+		})
+		inserts = nil
+		return nil
+	}
 
 	for _, ev := range events {
-		eventDatabaseName := ev.Database()
-		if targetDatabaseName, exists := b.DatabaseRewrites[eventDatabaseName]; exists {
-			eventDatabaseName = targetDatabaseName
+		eventDatabaseName, eventTableName := b.targetTableName(ev.Database(), ev.Table())
+
+		if b.PrimaryKeyRemapper != nil {
+			var err error
+			ev, err = b.PrimaryKeyRemapper.RemapDMLEvent(ev)
+			if err != nil {
+				return fmt.Errorf("remapping primary keys: %v", err)
+			}
+		}
+
+		var err error
+		ev, err = dmlEventWithEncodedColumns(ev)
+		if err != nil {
+			return err
+		}
+
+		if writesToMySQL(b.Dialect) && HasGeneratedColumns(ev.TableSchema()) {
+			ev = dmlEventWithoutGeneratedColumns(ev)
+		}
+
+		if b.Dialect.Name() == DialectMySQL {
+
+			omitGIPK, err := b.gipk.omitGIPK(ev.TableSchema(), eventDatabaseName, eventTableName)
+			if err != nil {
+				return fmt.Errorf("checking target table for generated invisible primary key: %v", err)
+			}
+			if omitGIPK {
+				ev = dmlEventWithoutGIPK(ev)
+			}
 		}
 
-		eventTableName := ev.Table()
-		if targetTableName, exists := b.TableRewrites[eventTableName]; exists {
-			eventTableName = targetTableName
+		target := &schema.Table{Schema: eventDatabaseName, Name: eventTableName}
+		writes[eventDatabaseName+"."+eventTableName]++
+
+		if b.InsertBatchSize > 1 && b.Dialect.Name() == DialectMySQL {
+			insert, isInsert := ev.(*BinlogInsertEvent)
+			if !isInsert || len(inserts) == b.InsertBatchSize || (len(inserts) > 0 && !sameInsertTable(inserts[0], insertsTarget, insert, target)) {
+				err = flushInserts()
+				if err != nil {
+					return err
+				}
+			}
+
+			if isInsert {
+				inserts = append(inserts, insert)
+				insertsTarget = target
+				continue
+			}
 		}
 
-		sql, err := ev.AsSQLString(&schema.Table{Schema: eventDatabaseName, Name: eventTableName})
+		sql, err := b.Dialect.DMLEventStatement(ev, target)
 		if err != nil {
-			return fmt.Errorf("generating sql query: %v", err)
+			return wrapError(err, "generating sql query")
+		}
+
+		if b.FullRowMatching {
+			sql = fullRowMatchStatement(ev, sql)
 		}
 
-		queryBuffer = append(queryBuffer, sql...)
+		statement := binlogStatement{query: commentStatement(b.StatementComment, sql)}
+		if _, isInsert := ev.(*BinlogInsertEvent); isInsert {
+			statement.table = target.Schema + "." + target.Name
+			statement.inserts = 1
+		}
+		statements = append(statements, statement)
+	}
+
+	err := flushInserts()
+	if err != nil {
+		return err
+	}
+
+	for table, rows := range writes {
+		b.TargetWrites.Start(table, rows)
+		defer b.TargetWrites.Finish(table, rows)
+	}
+
+	if inserted != nil {
+		return b.execStatementsCountingInserts(statements, inserted)
+	}
+
+	var queryBuffer []byte
+	if writesEventsInTransaction(b.Dialect) {
+		queryBuffer = append(queryBuffer, "BEGIN;\n"...)
+	}
+
+	for _, statement := range statements {
+		queryBuffer = append(queryBuffer, statement.query...)
 		queryBuffer = append(queryBuffer, ";\n"...)
 	}
 
-	queryBuffer = append(queryBuffer, "COMMIT"...)
+	if writesEventsInTransaction(b.Dialect) {
+		queryBuffer = append(queryBuffer, "COMMIT"...)
+	} else {
+		queryBuffer = queryBuffer[:len(queryBuffer)-len(";\n")]
+	}
 
 	query := string(queryBuffer)
-	_, err := b.DB.Exec(query)
+	_, err = b.DB.Exec(query)
 	if err != nil {
-		return fmt.Errorf("exec query (%d bytes): %v", len(query), err)
+		return wrapError(err, "exec query (%d bytes)", len(query))
+	}
+	return nil
+}
+
+// A statement writing binlog events to the target.
+type binlogStatement struct {
+	query string
+
+	// The target table and the number of rows of the inserts.
+	table   string
+	inserts int
+}
+
+// Executes the statements one at a time rather than in a single round
+// trip, in a transaction if the dialect allows, as only the rows affected
+// by the last statement of a multi-statement query are returned. The rows
+// inserted are added to inserted once the statements are committed.
+func (b *BinlogWriter) execStatementsCountingInserts(statements []binlogStatement, inserted insertCounts) (err error) {
+	var execer interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	} = b.DB
+
+	if writesEventsInTransaction(b.Dialect) {
+		tx, err := b.DB.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+			}
+		}()
+		execer = tx
+	}
+
+	written := make(insertCounts)
+	for _, statement := range statements {
+		result, err := execer.Exec(statement.query)
+		if err != nil {
+			return wrapError(err, "exec query (%d bytes)", len(statement.query))
+		}
+
+		if statement.inserts > 0 {
+			err = addInsertedRows(written, statement.table, statement.inserts, result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if tx, ok := execer.(*sql.Tx); ok {
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	for table, count := range written {
+		inserted.add(table, count.attempted, count.inserted)
 	}
 	return nil
 }
+
+// Returns true if the two inserts can be written by the same statement:
+// they are written to the same target table with the same columns.
+func sameInsertTable(a *BinlogInsertEvent, aTarget *schema.Table, b *BinlogInsertEvent, bTarget *schema.Table) bool {
+	if aTarget.Schema != bTarget.Schema || aTarget.Name != bTarget.Name {
+		return false
+	}
+
+	aColumns, bColumns := a.TableSchema().Columns, b.TableSchema().Columns
+	if len(aColumns) != len(bColumns) {
+		return false
+	}
+
+	for i := range aColumns {
+		if aColumns[i].Name != bColumns[i].Name {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Writes the events one at a time, in order, with backoff between the
+// attempts. The events that cannot be written are recorded to the
+// DeadLetterSink, unless the failure is not caused by the event, see
+// isEventError, in which case an error is returned. Returns the events that
+// were written, whose inserted rows are added to inserted, if not nil.
+func (b *BinlogWriter) writeEventsOrDeadLetter(events []DMLEvent, inserted insertCounts) ([]DMLEvent, error) {
+	written := make([]DMLEvent, 0, len(events))
+
+	for _, ev := range events {
+		err := WithBackoffRetries(b.DeadLetterRetries, b.DeadLetterRetryBackoff, 30*time.Second, b.logger, "write event to target", func() error {
+			return b.writeEvents([]DMLEvent{ev}, inserted)
+		})
+
+		if err == nil {
+			written = append(written, ev)
+			continue
+		}
+
+		table := ev.Database() + "." + ev.Table()
+		if !isEventError(err) {
+			return written, wrapError(err, "failed to write event of %s, which is not dead lettered as the failure is not caused by the event", table)
+		}
+
+		if ClassifyError(err) == ErrorClassTargetConflict {
+			metrics.CountTable("Table.Conflicts", table, 1)
+		}
+
+		if group, exists := b.ForeignKeyGroups[table]; exists {
+			metrics.Count("ForeignKeyOrderingEnforced", 1, []MetricTag{{"table", table}}, 1.0)
+			return written, fmt.Errorf("failed to write event of %s, which is not dead lettered to keep the order of the tables related to %s by foreign keys: %v", table, group, err)
+		}
+
+		targetDb, targetTable := b.targetTableName(ev.Database(), ev.Table())
+		recordErr := b.DeadLetterSink.Record(ev, targetDb, targetTable, err)
+		if recordErr != nil {
+			return written, fmt.Errorf("recording event in dead letter file: %v (write error: %v)", recordErr, err)
+		}
+	}
+
+	return written, nil
+}
+
+// Returns false for the errors of the connection or of the privileges of the
+// target, which would fail the writes of all the events alike, so the events
+// are not dead lettered and the ferry is aborted instead.
+func isEventError(err error) bool {
+	class := ClassifyError(err)
+	return class != ErrorClassNetwork && class != ErrorClassPermission
+}
+
+func (b *BinlogWriter) targetTableName(database, table string) (string, string) {
+	if targetDatabaseName, exists := b.DatabaseRewrites[database]; exists {
+		database = targetDatabaseName
+	}
+
+	if targetTableName, exists := b.TableRewrites[table]; exists {
+		table = targetTableName
+	}
+
+	return database, table
+}
@@ -0,0 +1,122 @@
+package ghostferry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// The characters of the latin1 charset of MySQL, which is cp1252 with the
+// bytes undefined by cp1252 mapped to the C1 control characters, from 0x80
+// to 0x9F. The other bytes are the code points of the same value.
+var latin1HighControlCharacters = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func isLatin1Column(column schema.TableColumn) bool {
+	return strings.HasPrefix(column.Collation, "latin1_")
+}
+
+func latin1ToUTF8(value []byte) []byte {
+	converted := make([]byte, 0, len(value))
+	for _, b := range value {
+		switch {
+		case b < 0x80:
+			converted = append(converted, b)
+		case b < 0xA0:
+			converted = appendRune(converted, latin1HighControlCharacters[b-0x80])
+		default:
+			converted = appendRune(converted, rune(b))
+		}
+	}
+	return converted
+}
+
+func appendRune(buffer []byte, r rune) []byte {
+	var encoded [utf8.UTFMax]byte
+	n := utf8.EncodeRune(encoded[:], r)
+	return append(buffer, encoded[:n]...)
+}
+
+// Returns a copy of the row with the values of the latin1 columns converted
+// to UTF-8. The other values, such as the indexes of the ENUM and SET
+// values, are kept as is.
+func convertLatin1Row(table *schema.Table, row RowData) RowData {
+	if row == nil {
+		return nil
+	}
+
+	var converted RowData
+	for i, column := range table.Columns {
+		if i >= len(row) || !isLatin1Column(column) {
+			continue
+		}
+
+		var value interface{}
+		switch v := row[i].(type) {
+		case string:
+			value = string(latin1ToUTF8([]byte(v)))
+		case []byte:
+			value = latin1ToUTF8(v)
+		default:
+			continue
+		}
+
+		if converted == nil {
+			converted = make(RowData, len(row))
+			copy(converted, row)
+		}
+		converted[i] = value
+	}
+
+	if converted == nil {
+		return row
+	}
+	return converted
+}
+
+// Returns the binlog events with the values of their latin1 columns
+// converted to UTF-8, as written with Config.ConvertLatin1ToUtf8mb4. The
+// binlog carries the bytes of the values as stored, while the rows copied by
+// the DataIterator are already converted by the source to the charset of the
+// connection.
+func ConvertLatin1Events(events []DMLEvent) []DMLEvent {
+	converted := make([]DMLEvent, len(events))
+	for i, ev := range events {
+		table := ev.TableSchema()
+		converted[i] = dmlEventWithValues(ev, convertLatin1Row(table, ev.OldValues()), convertLatin1Row(table, ev.NewValues()))
+	}
+	return converted
+}
+
+var (
+	latin1CharsetRegexp   = regexp.MustCompile(`(?i)\b(CHARSET|CHARACTER SET)(\s*=\s*|\s+)latin1\b`)
+	latin1CollationRegexp = regexp.MustCompile(`(?i)\s*\bCOLLATE(\s*=\s*|\s+)latin1_[a-z0-9_]+`)
+	latin1BinRegexp       = regexp.MustCompile(`(?i)\bCOLLATE(\s*=\s*|\s+)latin1_bin\b`)
+)
+
+// Rewrites a CREATE TABLE statement of the source, as shown by SHOW CREATE
+// TABLE, so its latin1 columns are created as utf8mb4 columns. The latin1_bin
+// collation becomes utf8mb4_bin, the other latin1 collations are dropped in
+// favor of the default collation of utf8mb4.
+func ConvertLatin1ToUtf8mb4CreateTable(createTable string) string {
+	createTable = latin1BinRegexp.ReplaceAllString(createTable, "COLLATE${1}utf8mb4_bin")
+	createTable = latin1CollationRegexp.ReplaceAllString(createTable, "")
+	return latin1CharsetRegexp.ReplaceAllString(createTable, "${1}${2}utf8mb4")
+}
+
+func validateLatin1ConversionCharset(source DatabaseConfig) error {
+	charset := strings.TrimSpace(strings.Split(source.Params["charset"], ",")[0])
+	switch strings.ToLower(charset) {
+	case "", "utf8", "utf8mb3", "utf8mb4":
+		return nil
+	default:
+		return fmt.Errorf("ConvertLatin1ToUtf8mb4 requires a utf8 or utf8mb4 charset on the source, got %s", charset)
+	}
+}
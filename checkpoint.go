@@ -0,0 +1,153 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Checkpointer periodically writes the state of the run to a file, so that
+// the run can be resumed from the last checkpoint if the process dies.
+type Checkpointer struct {
+	Ferry     *Ferry
+	StateFile string
+	Interval  time.Duration
+
+	// Where the state is written to. Defaults to a FileStateStore writing
+	// to the StateFile.
+	Store StateStore
+
+	logger *logrus.Entry
+
+	mutex              *sync.RWMutex
+	lastCheckpointTime time.Time
+	lastCheckpointErr  error
+}
+
+func (c *Checkpointer) Initialize() error {
+	c.logger = logrus.WithField("tag", "checkpointer")
+	c.mutex = &sync.RWMutex{}
+	return nil
+}
+
+func (c *Checkpointer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// A failed checkpoint is not fatal: the run can go on and the
+			// failure is reported by the health check.
+			err := c.Checkpoint()
+			if err != nil {
+				c.logger.WithError(err).Error("failed to write checkpoint")
+			}
+		}
+	}
+}
+
+// Writes the current state to the Store.
+func (c *Checkpointer) Checkpoint() error {
+	store := c.Store
+	if store == nil {
+		store = &FileStateStore{Path: c.StateFile}
+	}
+
+	err := store.SaveState(c.Ferry.SerializeState())
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastCheckpointErr = err
+	if err == nil {
+		c.lastCheckpointTime = time.Now()
+		metrics.Count("Checkpoint", 1, nil, 1.0)
+	}
+
+	return err
+}
+
+func (c *Checkpointer) LastCheckpoint() (time.Time, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.lastCheckpointTime, c.lastCheckpointErr
+}
+
+// Writes the state to a file. The state is first written to a temporary file
+// which is then renamed over the file, so the file always contains a
+// complete state, even if the process crashes while writing it.
+type FileStateStore struct {
+	Path string
+}
+
+func (s *FileStateStore) SaveState(state *SerializableState) error {
+	stateBytes, err := state.Dump()
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(stateBytes)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	err = os.Rename(tmpFile.Name(), s.Path)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	// The rename is only durable once the directory is synced.
+	return syncDir(filepath.Dir(s.Path))
+}
+
+// Reads the state from the file. The state is refused if it is corrupt or
+// was written by an incompatible version of Ghostferry, see ParseStateDump.
+func (s *FileStateStore) LoadState() (*SerializableState, error) {
+	stateBytes, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := ParseStateDump(stateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to resume from the state in %s: %v", s.Path, err)
+	}
+
+	return state, nil
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,101 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// How the values of a column are normalized before being fingerprinted, so
+// values that are equal for the collations of the column on the source and
+// on the target get the same fingerprint. See
+// Config.VerifierNormalizeCollations.
+type collationNormalization struct {
+	// Fold the case, as either collation is case-insensitive.
+	lowerCase bool
+
+	// Remove the trailing spaces, as either collation pads the values with
+	// spaces when comparing them.
+	trimTrailingSpaces bool
+}
+
+func isCaseInsensitiveCollation(collation string) bool {
+	return strings.HasSuffix(collation, "_ci")
+}
+
+// The collations of MySQL pad the values with spaces, except for the binary
+// collation and the collations based on UCA 9.0.0, which are NO PAD.
+func isPadSpaceCollation(collation string) bool {
+	return collation != "binary" && !strings.Contains(collation, "_0900_")
+}
+
+// Returns the normalizations of the columns of the source whose collation
+// differs on the target, keyed by column name.
+func collationNormalizations(source, target *schema.Table) map[string]collationNormalization {
+	targetCollations := make(map[string]string, len(target.Columns))
+	for _, column := range target.Columns {
+		targetCollations[column.Name] = column.Collation
+	}
+
+	normalizations := make(map[string]collationNormalization)
+	for _, column := range source.Columns {
+		targetCollation := targetCollations[column.Name]
+		if column.Collation == "" || targetCollation == "" || column.Collation == targetCollation {
+			continue
+		}
+
+		normalization := collationNormalization{
+			lowerCase:          isCaseInsensitiveCollation(column.Collation) || isCaseInsensitiveCollation(targetCollation),
+			trimTrailingSpaces: isPadSpaceCollation(column.Collation) || isPadSpaceCollation(targetCollation),
+		}
+		if normalization.lowerCase || normalization.trimTrailingSpaces {
+			normalizations[column.Name] = normalization
+		}
+	}
+
+	return normalizations
+}
+
+// Returns the expression normalizing the quoted value. The value is
+// converted to utf8mb4 first, as the binary strings are not case folded.
+func (n collationNormalization) expression(quoted string) string {
+	quoted = fmt.Sprintf("CONVERT(%s USING utf8mb4)", quoted)
+	if n.trimTrailingSpaces {
+		quoted = fmt.Sprintf("TRIM(TRAILING ' ' FROM %s)", quoted)
+	}
+	if n.lowerCase {
+		quoted = fmt.Sprintf("LOWER(%s)", quoted)
+	}
+	return quoted
+}
+
+// Returns a warning for every column whose collation differs between the
+// source and the target, as the IterativeVerifier then finds mismatches in
+// values that the target considers equal, unless
+// Config.VerifierNormalizeCollations is set.
+func compareTableCollations(source, target *schema.Table) []string {
+	targetCollations := make(map[string]string, len(target.Columns))
+	for _, column := range target.Columns {
+		targetCollations[column.Name] = column.Collation
+	}
+
+	var messages []string
+	for _, column := range source.Columns {
+		targetCollation, exists := targetCollations[column.Name]
+		if !exists || column.Collation == targetCollation {
+			continue
+		}
+
+		messages = append(messages, fmt.Sprintf("column %s has the %s collation on source but %s on target", column.Name, collationOrNone(column.Collation), collationOrNone(targetCollation)))
+	}
+
+	return messages
+}
+
+func collationOrNone(collation string) string {
+	if collation == "" {
+		return "no"
+	}
+	return collation
+}
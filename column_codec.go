@@ -0,0 +1,324 @@
+package ghostferry
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// ColumnCodec converts the contents of a column whose values cannot be
+// copied as is, such as an application specific packed binary format that
+// changes between the source and the target.
+//
+// Encode is applied to the values of the rows copied by the BatchWriter and
+// of the events written by the BinlogWriter, and its result is what is
+// written to the target. Decode is its inverse: the IterativeVerifier decodes
+// the values read from the target and compares them to the values of the
+// source. The NULL values are written and compared without calling the codec.
+type ColumnCodec interface {
+	Encode(value interface{}) (interface{}, error)
+	Decode(value interface{}) (interface{}, error)
+}
+
+var (
+	columnCodecsMutex sync.RWMutex
+	columnCodecs      = make(map[string]map[string]ColumnCodec)
+)
+
+// Registers the codec of a column of a source table, named as
+// "schema.table", usually from the init function of the package implementing
+// it. The primary key columns are copied and verified by value, so they
+// cannot have a codec. Like RegisterPlugin, this panics if the codec is nil
+// or if the column already has a codec.
+func RegisterColumnCodec(table, column string, codec ColumnCodec) {
+	columnCodecsMutex.Lock()
+	defer columnCodecsMutex.Unlock()
+
+	if codec == nil {
+		panic(fmt.Sprintf("ghostferry: nil codec for column %s of %s", column, table))
+	}
+
+	if columnCodecs[table] == nil {
+		columnCodecs[table] = make(map[string]ColumnCodec)
+	}
+
+	if _, exists := columnCodecs[table][column]; exists {
+		panic(fmt.Sprintf("ghostferry: column %s of %s already has a codec", column, table))
+	}
+
+	columnCodecs[table][column] = codec
+}
+
+// Returns the codec registered for the column of the source table, or nil.
+func ColumnCodecFor(table, column string) ColumnCodec {
+	columnCodecsMutex.RLock()
+	defer columnCodecsMutex.RUnlock()
+
+	return columnCodecs[table][column]
+}
+
+// Returns the codecs of the columns of the table by column index. Returns
+// nil if none of its columns has a codec.
+func tableColumnCodecs(table *schema.Table) map[int]ColumnCodec {
+	columnCodecsMutex.RLock()
+	defer columnCodecsMutex.RUnlock()
+
+	codecs := columnCodecs[table.String()]
+	if len(codecs) == 0 {
+		return nil
+	}
+
+	indexed := make(map[int]ColumnCodec)
+	for i, column := range table.Columns {
+		if codec, exists := codecs[column.Name]; exists {
+			indexed[i] = codec
+		}
+	}
+
+	if len(indexed) == 0 {
+		return nil
+	}
+	return indexed
+}
+
+// Validates that the codecs registered for the tables are not registered on
+// a primary key column or on a column that does not exist.
+func validateColumnCodecs(tables TableSchemaCache) error {
+	columnCodecsMutex.RLock()
+	defer columnCodecsMutex.RUnlock()
+
+	for tableName, codecs := range columnCodecs {
+		table, exists := tables[tableName]
+		if !exists {
+			continue
+		}
+
+		for column := range codecs {
+			index := table.FindColumn(column)
+			if index < 0 {
+				return fmt.Errorf("column %s of %s has a codec but does not exist", column, tableName)
+			}
+
+			for _, pkIndex := range table.PKColumns {
+				if pkIndex == index {
+					return fmt.Errorf("primary key column %s of %s cannot have a codec", column, tableName)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns a copy of the row of the table, with the values of the columns
+// that have a codec encoded, as written to the target.
+func EncodeRow(table *schema.Table, row RowData) (RowData, error) {
+	return encodeRow(table, tableColumnCodecs(table), row)
+}
+
+func encodeRow(table *schema.Table, codecs map[int]ColumnCodec, row RowData) (RowData, error) {
+	if row == nil || len(codecs) == 0 {
+		return row, nil
+	}
+
+	encoded := make(RowData, len(row))
+	copy(encoded, row)
+
+	for i, codec := range codecs {
+		if i >= len(encoded) || isNilValue(encoded[i]) {
+			continue
+		}
+
+		value, err := codec.Encode(encoded[i])
+		if err != nil {
+			return nil, NewClassifiedError(ErrorClassDataConversion, fmt.Errorf("failed to encode column %s of %s: %v", table.Columns[i].Name, table.String(), err))
+		}
+		encoded[i] = value
+	}
+
+	return encoded, nil
+}
+
+func (e *RowBatch) withEncodedColumns() (*RowBatch, error) {
+	codecs := tableColumnCodecs(&e.table)
+	if codecs == nil {
+		return e, nil
+	}
+
+	values := make([]RowData, len(e.values))
+	for i, row := range e.values {
+		var err error
+		values[i], err = encodeRow(&e.table, codecs, row)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewRowBatch(&e.table, values, e.pkIndex), nil
+}
+
+func dmlEventWithEncodedColumns(ev DMLEvent) (DMLEvent, error) {
+	table := ev.TableSchema()
+	codecs := tableColumnCodecs(table)
+	if codecs == nil {
+		return ev, nil
+	}
+
+	oldValues, err := encodeRow(table, codecs, ev.OldValues())
+	if err != nil {
+		return nil, err
+	}
+
+	newValues, err := encodeRow(table, codecs, ev.NewValues())
+	if err != nil {
+		return nil, err
+	}
+
+	return dmlEventWithValues(ev, oldValues, newValues), nil
+}
+
+// Returns true if the value read from the target decodes to the value read
+// from the source. The values are compared as the SQL literals they are
+// written as, as the types scanned from the two sides may differ.
+func columnValuesMatch(codec ColumnCodec, source, target interface{}) (bool, error) {
+	if isNilValue(source) || isNilValue(target) {
+		return isNilValue(source) && isNilValue(target), nil
+	}
+
+	decoded, err := codec.Decode(target)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(appendEscapedValue(nil, source), appendEscapedValue(nil, decoded)), nil
+}
+
+// Returns the columns of the table that are fingerprinted by the verifier,
+// which are all the columns but the columns with a codec, as the encoded
+// values of the target differ from the values of the source.
+func columnsWithoutCodecs(table *schema.Table, codecs map[int]ColumnCodec) []schema.TableColumn {
+	if len(codecs) == 0 {
+		return table.Columns
+	}
+
+	columns := make([]schema.TableColumn, 0, len(table.Columns))
+	for i, column := range table.Columns {
+		if _, exists := codecs[i]; !exists {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// Returns the primary keys of the rows whose columns with a codec differ
+// between the source and the target, once decoded.
+func (v *IterativeVerifier) compareEncodedColumns(table *schema.Table, targetDb, targetTable string, codecs map[int]ColumnCodec, pks []uint64) ([]uint64, error) {
+	indexes := make([]int, 0, len(codecs))
+	for i := range codecs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	sourceRows, targetRows, err := v.selectVerifiedColumns(table, targetDb, targetTable, indexes, pks)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []uint64{}
+	for pk, sourceRow := range sourceRows {
+		targetRow, exists := targetRows[pk]
+		if !exists {
+			continue // The missing rows are reported by the fingerprints.
+		}
+
+		for j, i := range indexes {
+			match, err := columnValuesMatch(codecs[i], sourceRow[j+1], targetRow[j+1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode column %s of %s: %v", table.Columns[i].Name, table.String(), err)
+			}
+
+			if !match {
+				mismatches = append(mismatches, pk)
+				break
+			}
+		}
+	}
+
+	return mismatches, nil
+}
+
+// Selects the primary key and the columns of the table with the given
+// indexes of the rows with the given primary keys, from the source and from
+// the target, keyed by primary key.
+func (v *IterativeVerifier) selectVerifiedColumns(table *schema.Table, targetDb, targetTable string, indexes []int, pks []uint64) (sourceRows, targetRows map[uint64]RowData, err error) {
+	pkColumn := table.GetPKColumn(0).Name
+	columns := []string{quoteField(pkColumn)}
+	for _, i := range indexes {
+		columns = append(columns, quoteField(table.Columns[i].Name))
+	}
+
+	err = retryPolicyOrDefault(v.CursorConfig.ReadRetryPolicy, 5).Do(nil, v.logger, "get verified columns from source db", func() (err error) {
+		sourceRows, err = selectRowsByPk(v.SourceDB, table.Schema, table.Name, pkColumn, columns, pks)
+		return
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = retryPolicyOrDefault(v.CursorConfig.ReadRetryPolicy, 5).Do(nil, v.logger, "get verified columns from target db", func() (err error) {
+		targetRows, err = selectRowsByPk(v.TargetDB, targetDb, targetTable, pkColumn, columns, pks)
+		return
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sourceRows, targetRows, nil
+}
+
+// Selects the columns of the rows with the given primary keys, keyed by
+// primary key. The primary key must be the first column.
+func selectRowsByPk(db *sql.DB, schemaName, table, pkColumn string, columns []string, pks []uint64) (map[uint64]RowData, error) {
+	query, args, err := sq.Select(columns...).
+		From(QuotedTableNameFromString(schemaName, table)).
+		Where(sq.Eq{quoteField(pkColumn): pks}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepared, so the values are scanned with their types, see queryHashes.
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resultSet := make(map[uint64]RowData)
+	for rows.Next() {
+		rowData, err := ScanGenericRow(rows, len(columns))
+		if err != nil {
+			return nil, err
+		}
+
+		pk, err := rowData.GetUint64(0)
+		if err != nil {
+			return nil, err
+		}
+
+		resultSet[pk] = rowData
+	}
+
+	return resultSet, rows.Err()
+}
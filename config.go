@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
@@ -49,6 +51,24 @@ type DatabaseConfig struct {
 	Params    map[string]string
 
 	TLS *TLSConfig
+
+	// Where the credentials are read from, instead of User and Pass, such as
+	// Vault or AWS Secrets Manager, see CredentialsConfig.
+	//
+	// Optional: defaults to User and Pass.
+	Credentials *CredentialsConfig
+
+	// The settings of the session of every connection, see SessionConfig.
+	//
+	// Optional: defaults to the sql_mode and time_zone required by
+	// Ghostferry and the defaults of the server for the other settings.
+	Session *SessionConfig
+
+	// The SSH bastion or SOCKS5 proxy the database is connected through,
+	// see ProxyConfig.
+	//
+	// Optional: defaults to connecting directly.
+	Proxy *ProxyConfig
 }
 
 func (c DatabaseConfig) MySQLConfig() (*mysql.Config, error) {
@@ -63,6 +83,25 @@ func (c DatabaseConfig) MySQLConfig() (*mysql.Config, error) {
 		MultiStatements: true,
 	}
 
+	if c.Credentials != nil && c.Credentials.Provider == CredentialsProviderRDSIAM {
+		// The tokens are sent in clear, over TLS.
+		cfg.AllowCleartextPasswords = true
+	}
+
+	if c.Proxy != nil {
+		cfg.Net = c.Proxy.mysqlNetwork()
+	}
+
+	if sessionParams := c.Session.params(); len(sessionParams) > 0 {
+		cfg.Params = make(map[string]string, len(c.Params)+len(sessionParams))
+		for param, value := range c.Params {
+			cfg.Params[param] = value
+		}
+		for param, value := range sessionParams {
+			cfg.Params[param] = value
+		}
+	}
+
 	if c.TLS != nil {
 		tlsConfig, err := c.TLS.BuildConfig()
 		if err != nil {
@@ -83,24 +122,45 @@ func (c DatabaseConfig) MySQLConfig() (*mysql.Config, error) {
 }
 
 func (c DatabaseConfig) Validate() error {
-	if c.Host == "" {
-		return fmt.Errorf("host is empty")
+	err := c.validateAddress()
+	if err != nil {
+		return err
 	}
 
-	if c.Port == 0 {
-		return fmt.Errorf("port is not specified")
+	if c.Credentials != nil {
+		if c.Pass != "" {
+			return fmt.Errorf("Pass and Credentials cannot both be set")
+		}
+
+		if err := c.Credentials.initialize(c); err != nil {
+			return fmt.Errorf("Credentials: %s", err)
+		}
 	}
 
-	if c.User == "" {
-		return fmt.Errorf("user is empty")
+	if c.Proxy != nil {
+		if err := c.Proxy.Validate(); err != nil {
+			return fmt.Errorf("Proxy: %s", err)
+		}
+	}
+
+	if c.Session != nil {
+		if err := c.Session.Validate(); err != nil {
+			return fmt.Errorf("Session: %s", err)
+		}
+
+		for param := range c.Session.params() {
+			if _, exists := c.Params[param]; exists {
+				return fmt.Errorf("%s cannot be set in both Params and Session", param)
+			}
+		}
 	}
 
-	err := c.assertParamSet("time_zone", "'+00:00'")
+	err = c.assertParamSet("time_zone", quoteParam(c.Session.timeZone()))
 	if err != nil {
 		return err
 	}
 
-	err = c.assertParamSet("sql_mode", "'STRICT_ALL_TABLES,NO_BACKSLASH_ESCAPES'")
+	err = c.assertParamSet("sql_mode", quoteParam(c.Session.sqlMode()))
 	if err != nil {
 		return err
 	}
@@ -108,6 +168,22 @@ func (c DatabaseConfig) Validate() error {
 	return nil
 }
 
+func (c DatabaseConfig) validateAddress() error {
+	if c.Host == "" {
+		return fmt.Errorf("host is empty")
+	}
+
+	if c.Port == 0 {
+		return fmt.Errorf("port is not specified")
+	}
+
+	if c.User == "" {
+		return fmt.Errorf("user is empty")
+	}
+
+	return nil
+}
+
 func (c DatabaseConfig) SqlDB(logger *logrus.Entry) (*sql.DB, error) {
 	dbCfg, err := c.MySQLConfig()
 	if err != nil {
@@ -118,9 +194,50 @@ func (c DatabaseConfig) SqlDB(logger *logrus.Entry) (*sql.DB, error) {
 		logger.WithField("dsn", MaskedDSN(dbCfg)).Info("connecting to database")
 	}
 
+	if c.Credentials != nil {
+		// The DSN is built for every connection, with the current
+		// credentials, as they may expire.
+		dsn := func() (string, error) {
+			credentials, err := c.ResolveCredentials()
+			if err != nil {
+				return "", err
+			}
+
+			cfg := *dbCfg
+			cfg.User = credentials.User
+			cfg.Passwd = credentials.Password
+			return cfg.FormatDSN(), nil
+		}
+
+		return openSessionDB(dsn, c.Session), nil
+	}
+
+	if c.Session != nil && len(c.Session.Statements) > 0 {
+		return openSessionDB(staticDSN(dbCfg.FormatDSN()), c.Session), nil
+	}
+
 	return sql.Open("mysql", dbCfg.FormatDSN())
 }
 
+// Returns the user and the password to connect with, read from the
+// Credentials if they are set.
+func (c DatabaseConfig) ResolveCredentials() (Credentials, error) {
+	if c.Credentials == nil {
+		return Credentials{User: c.User, Password: c.Pass}, nil
+	}
+
+	credentials, err := c.Credentials.get(c)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	if credentials.User == "" {
+		credentials.User = c.User
+	}
+
+	return credentials, nil
+}
+
 func (c DatabaseConfig) assertParamSet(param, value string) error {
 	if c.Params == nil {
 		c.Params = make(map[string]string)
@@ -145,6 +262,22 @@ type Config struct {
 	// Required
 	Target DatabaseConfig
 
+	// The SQL dialect of the target, either mysql, postgresql or vitess.
+	// With a postgresql target, the Params of the Target are added to the
+	// connection string and must include the dbname, the databases are
+	// written to schemas of this database through the vendored
+	// github.com/lib/pq driver. The verifiers, the preflight checks,
+	// StageRowBatches and DetectSchemaDrift only support MySQL targets.
+	//
+	// With a vitess target, the Target is a VTGate and the databases are
+	// written to the keyspaces of the same name, see VitessDialect. Only the
+	// IterativeVerifier and the RowCountVerifier support Vitess targets,
+	// and StageRowBatches, LoadDataInfile, PreserveSourceTransactions,
+	// ReverseReplication and DetectSchemaDrift cannot be used.
+	//
+	// Optional: defaults to mysql.
+	TargetDialect string
+
 	// Map database name on the source database (key of the map) to a
 	// different name on the target database (value of the associated key).
 	// This allows one to move data and change the database name in the
@@ -176,6 +309,22 @@ type Config struct {
 	// Optional: defaults to nil/no filter.
 	CopyFilter CopyFilter
 
+	// Expressions used to filter the binlog events being replayed, keyed by
+	// the full table name (schema.table). Only the events for which the
+	// expression evaluates to true are applied to the target, except for the
+	// updates of rows leaving or entering the filter, which are applied as
+	// deletes and replacements of the rows, see
+	// ExpressionEventFilter.FilterEvent. See EventExpression for the syntax,
+	// for example:
+	//
+	//	{"gftest.orders": "new.status != 'draft'"}
+	//
+	// These expressions are not applied to the rows copied by the
+	// DataIterator. A CopyFilter has to be used to filter those.
+	//
+	// Optional: defaults to no expression filters.
+	EventFilterExpressions map[string]string
+
 	// The server id used by Ghostferry to connect to MySQL as a replication
 	// slave. This id must be unique on the MySQL server. If 0 is specified,
 	// a random id will be generated upon connecting to the MySQL server.
@@ -191,6 +340,31 @@ type Config struct {
 	// Optional: defaults to 100
 	BinlogEventBatchSize int
 
+	// The maximum number of consecutive binlog inserts into the same table
+	// written by a single multi-row INSERT IGNORE statement, which cuts down
+	// the work of the target when catching up with bulk inserts on the
+	// source. The inserts are still written in the order of the binlog.
+	//
+	// Optional: defaults to 1, which writes every insert on its own.
+	BinlogInsertBatchSize int
+
+	// The maximum number of binlog events, each changing a row, written in a
+	// single transaction of the target. The larger batches of events, such
+	// as a source transaction changing millions of rows with
+	// PreserveSourceTransactions, are written in several transactions, so
+	// the target does not lock all their rows at once. The readers of the
+	// target can then see such a transaction partially applied.
+	//
+	// Optional: defaults to 0, which does not limit the events.
+	BinlogMaxTransactionRows int
+
+	// The maximum number of statements written in a single transaction of
+	// the target, counting the inserts coalesced by BinlogInsertBatchSize as
+	// one statement. See BinlogMaxTransactionRows.
+	//
+	// Optional: defaults to 0, which does not limit the statements.
+	BinlogMaxTransactionStatements int
+
 	// The batch size used to iterate the data during data copy. This batch size
 	// is always used: if this is specified to be 100, 100 rows will be copied
 	// per iteration.
@@ -209,8 +383,10 @@ type Config struct {
 	// Optional: defaults to 5
 	DBReadRetries int
 
-	// This specify the number of concurrent goroutines, each iterating over
-	// a single table.
+	// This specify the number of batches that are copied concurrently. The
+	// batches of the different tables are interleaved according to the
+	// DataIterationTableWeights, so a single huge table cannot starve the
+	// others.
 	//
 	// At this point in time, parallelize iteration within a single table. This
 	// may be possible to add to the future.
@@ -218,14 +394,693 @@ type Config struct {
 	// Optional: defaults to 4
 	DataIterationConcurrency int
 
+	// The relative share of the concurrent batches given to each table,
+	// keyed by the full table name (schema.table), when multiple tables are
+	// waiting to copy a batch. The weights can be changed at runtime through
+	// the ControlServer. The tables only wait for a batch if more of them are
+	// iterated than batches are copied at the same time, so the weights
+	// require the DataIterationTableConcurrency to be larger than the
+	// DataIterationConcurrency.
+	//
+	// Optional: defaults to a weight of 1 for all tables.
+	DataIterationTableWeights map[string]int
+
+	// The number of tables that are iterated at the same time. The other
+	// tables wait for one of these to complete, in the DataIterationOrder.
+	// Every table iterated holds a cursor on the source, so iterating
+	// thousands of tables at the same time would open as many.
+	//
+	// Optional: defaults to twice the DataIterationConcurrency, so the tables
+	// compete for the batches according to the DataIterationTableWeights.
+	DataIterationTableConcurrency int
+
+	// The order in which the tables start being iterated. This matters when
+	// DataIterationTableConcurrency is smaller than the number of tables.
+	// Can be one of:
+	//
+	//	alphabetical:  by full table name.
+	//	largest-first: by descending maximum primary key, as an estimate of
+	//	               the number of rows.
+	//	explicit:      the tables in DataIterationTableOrder first, in that
+	//	               order, followed by the others alphabetically.
+	//
+	// Optional: defaults to alphabetical.
+	DataIterationOrder string
+
+	// The full table names (schema.table) iterated first when the
+	// DataIterationOrder is explicit.
+	//
+	// Required if DataIterationOrder is explicit.
+	DataIterationTableOrder []string
+
+	// Overrides DataIterationBatchSize for some tables, keyed by the full
+	// table name (schema.table). Useful for tables with very large or very
+	// small rows.
+	//
+	// Optional: defaults to DataIterationBatchSize for all tables.
+	DataIterationTableBatchSizes map[string]uint64
+
+	// Iterate the partitioned tables partition by partition, selecting the
+	// rows of each with a PARTITION clause. The partitions of a table are
+	// iterated concurrently, each counting as a table for
+	// DataIterationTableConcurrency, and each reads from a single partition,
+	// which keeps the reads local. An interrupted run resumes every
+	// partition from its own position. Has no effect with a CopyFilter, as
+	// the filter builds the queries.
+	//
+	// Optional: defaults to false.
+	DataIterationByPartition bool
+
+	// Iterates some tables in the order of a secondary index rather than of
+	// their primary key, keyed by the full table name, such as the tables
+	// with random primary keys whose rows are read from all over the source
+	// in the primary key order. The columns of the index must be NOT NULL.
+	// An interrupted run resumes after the last row copied in the order of
+	// the index, and the progress of these tables is only estimated from
+	// their primary keys. Has no effect with a CopyFilter, as the filter
+	// builds the queries.
+	//
+	// Optional: defaults to iterating every table in primary key order.
+	DataIterationIndexes map[string]string
+
+	// The tables that are estimated by information_schema to have at most
+	// this many rows are given a batch size of this many rows, for both the
+	// copy and the iterative verifier. Such a table then usually takes a
+	// single SELECT from the source, a single INSERT into the target and a
+	// single fingerprint query on each side to verify, which reduces the
+	// overhead of copying schemas with many tiny tables. The tables are
+	// still read through the cursor of the DataIterator, so a table larger
+	// than estimated takes more batches. There is no INSERT ... SELECT, as
+	// the source and the target are separate servers. Only has an effect
+	// when larger than DataIterationBatchSize, and does not apply to the
+	// tables in DataIterationTableBatchSizes.
+	//
+	// Optional: defaults to 0, which disables the larger batches of the
+	// small tables.
+	SmallTableMaxRows uint64
+
+	// If set, a table must also be estimated to have at most this many bytes
+	// of data to be considered small.
+	//
+	// Optional: defaults to no limit.
+	SmallTableMaxBytes uint64
+
+	// If set, the batch size of each table is adjusted after every batch so
+	// that reading and writing a batch takes about this long, as a Go
+	// duration string. The batches start at DataIterationBatchSize. The
+	// tables in DataIterationTableBatchSizes keep their batch size.
+	//
+	// Optional: defaults to fixed batch sizes.
+	DataIterationTargetBatchDuration string
+
+	// If set, the batch size of each table is adjusted after every batch so
+	// that a batch holds at most this many bytes of row data. Can be used
+	// with or without DataIterationTargetBatchDuration.
+	//
+	// Optional: defaults to fixed batch sizes.
+	DataIterationMaxBatchBytes uint64
+
+	// The bounds of the adjusted batch sizes.
+	//
+	// Optional: defaults to 10 and 100000
+	DataIterationMinBatchSize uint64
+	DataIterationMaxBatchSize uint64
+
+	// The rows holding more bytes than this, such as the rows with
+	// multi-megabyte BLOB or TEXT values, are written to the target with a
+	// statement of their own, and the next batches of their table read a
+	// single row until the rows get smaller again. Must be well below the
+	// max_allowed_packet of the target.
+	//
+	// Optional: defaults to 0, which writes every batch with a single
+	// statement.
+	DataIterationLargeRowBytes uint64
+
 	// This specifies if Ghostferry will pause before cutover or not.
 	//
 	// Optional: defaults to false
 	AutomaticCutover bool
 
+	// The longest the source may stay locked during the cutover, as a Go
+	// duration string. If the binlog is not drained and the target verified
+	// within it, the cutover is aborted: the source is unlocked, the binlog
+	// keeps being tailed and the cutover is retried once AutomaticCutover is
+	// set again, or after CutoverRetryInterval. See Ferry.RunCutoverSteps.
+	//
+	// Only supported by ghostferry-sharding, which locks the source itself.
+	//
+	// Optional: defaults to no limit.
+	MaxCutoverDowntime string
+
+	// How long to wait before retrying a cutover aborted because of
+	// MaxCutoverDowntime, as a Go duration string.
+	//
+	// Optional: defaults to waiting for AutomaticCutover to be set again,
+	// such as from the ControlServer.
+	CutoverRetryInterval string
+
+	// The state of a previous run to resume from, as produced by
+	// SerializableState.Dump and parsed with ParseStateDump. The binlog
+	// streaming resumes from the saved binlog position and the data copy
+	// skips the completed tables and the rows that were already copied.
+	//
+	// Optional: defaults to nil, which starts a new run.
+	StateToResumeFrom *SerializableState
+
+	// If enabled, SIGINT and SIGTERM interrupt the run instead of killing the
+	// process: the data copy and the binlog streaming stop cleanly and
+	// Ferry.Run returns, after which the state can be obtained with
+	// Ferry.SerializeState to resume the run later. Signals received during
+	// the cutover are ignored.
+	//
+	// Optional: defaults to false
+	DumpStateOnSignal bool
+
+	// If enabled, Ghostferry never enters the cutover phase. After the
+	// initial copy, the binlog is tailed indefinitely to keep the target in
+	// sync, for example as a warm standby or an analytics copy. The run only
+	// ends when it is interrupted or fails.
+	//
+	// Optional: defaults to false
+	ContinuousReplication bool
+
+	// If set, the ferry keeps the old source of a completed move up to date
+	// from the new primary instead of copying, with the Source being the new
+	// primary and the Target the old source. This implies
+	// ContinuousReplication. See ReverseReplicationConfig.
+	//
+	// Optional: defaults to nil, no reverse replication.
+	ReverseReplication *ReverseReplicationConfig
+
+	// If set, the rows are copied from a replica of the source, while the
+	// binlog is still streamed from the source. See ReadReplicaConfig.
+	//
+	// Optional: defaults to nil, copying the rows from the source.
+	ReadReplica *ReadReplicaConfig
+
+	// If set, no rows are copied and the binlog of the source is applied to
+	// the target from the given position, for a target seeded by a physical
+	// backup. See DeltaOnlyConfig.
+	//
+	// Optional: defaults to nil, copying the rows.
+	DeltaOnly *DeltaOnlyConfig
+
+	// If set, the rows are copied from a consistent snapshot of the source,
+	// optionally at a chosen GTID set or binlog position, and the binlog is
+	// only applied from the snapshot once all the rows are copied. See
+	// SnapshotConfig.
+	//
+	// Optional: defaults to nil, the rows are copied with locking reads.
+	Snapshot *SnapshotConfig
+
+	// The number of times the BinlogStreamer reconnects to the source and
+	// resumes streaming if reading the binlog fails, before failing the run.
+	//
+	// Optional: defaults to 10 if ContinuousReplication is enabled, 0
+	// otherwise.
+	BinlogReconnectAttempts int
+
+	// The retry policies of the reads from the source, the writes to the
+	// target and the binlog reconnections, replacing DBReadRetries,
+	// DBWriteRetries and BinlogReconnectAttempts respectively. For example,
+	// to back off exponentially when the target is overloaded:
+	//
+	//	{"Write": {"MaxAttempts": 10, "Backoff": "exponential", "InitialDelay": "100ms", "Jitter": 0.2}}
+	//
+	// Optional: defaults to the policies derived from DBReadRetries,
+	// DBWriteRetries and BinlogReconnectAttempts, see RetryPoliciesConfig.
+	RetryPolicies RetryPoliciesConfig
+
+	// If set, the state of the run is periodically written to this file, so
+	// the run can be resumed from it with StateToResumeFrom if the process
+	// dies.
+	//
+	// Optional: defaults to no checkpointing.
+	CheckpointStateFile string
+
+	// How often the state is written to the CheckpointStateFile, as a Go
+	// duration string.
+	//
+	// Optional: defaults to 1m
+	CheckpointInterval string
+
+	// How often a one line summary of the progress of the run is logged,
+	// with the number of copied tables and rows, the copy rate, the
+	// replication lag, the ETA of the copy and the share of time spent
+	// throttled, as a Go duration string.
+	//
+	// Optional: defaults to no progress log.
+	ProgressLogInterval string
+
+	// The run is reported as unhealthy by the health check of the
+	// ControlServer if no binlog event was streamed for longer than this
+	// duration, while there were events to stream.
+	//
+	// Optional: defaults to 1m
+	MaxHealthyBinlogLag string
+
+	// The address of the statsd server the metrics are sent to.
+	//
+	// Optional: defaults to not sending metrics.
+	StatsDAddress string
+
+	// Tags added to every metric, for instance to identify the ferry when
+	// several ferries report to the same statsd server.
+	//
+	// Optional: defaults to no additional tags.
+	MetricTags map[string]string
+
+	// Limits the number of tables the per-table metrics, such as
+	// Table.RowsCopied, are tagged with. See TableMetricsConfig.
+	//
+	// Optional: defaults to tagging every table by name.
+	TableMetrics *TableMetricsConfig
+
+	// Traces the steps of the run to an OpenTelemetry collector. See
+	// TracingConfig.
+	//
+	// Optional: defaults to no tracing.
+	Tracing *TracingConfig
+
+	// If set, every change written to the target is recorded as a line of
+	// JSON in files in this directory. The inserts of the statements that
+	// ignored some of their rows, as they conflicted with rows of the
+	// target, are marked as attempted, see AuditRecord.Attempted.
+	//
+	// Optional: defaults to no audit log.
+	AuditLogDirectory string
+
+	// The audit log is rotated to a new file once it reaches this size, in
+	// bytes.
+	//
+	// Optional: defaults to 100MB
+	AuditLogMaxFileSize int64
+
+	// Write the copied rows to a temporary staging table on the target
+	// before moving them to the target table, so a batch with a value that
+	// does not fit its column fails without writing any row. This is slower,
+	// as every row is written twice.
+	//
+	// Optional: defaults to false.
+	StageRowBatches bool
+
+	// Write the copied rows with LOAD DATA LOCAL INFILE instead of INSERT,
+	// which is much faster for the initial copy. The rows are streamed from
+	// memory, so local_infile must be enabled on the target but no file is
+	// written. The tables with json, bit or spatial columns, and the batches
+	// with values that cannot be encoded as text, are still written with
+	// INSERT, as are all the batches if the target refuses LOAD DATA LOCAL
+	// INFILE. Ignored if StageRowBatches is set.
+	//
+	// Optional: defaults to false.
+	LoadDataInfile bool
+
+	// If set, the tables without a primary key nor a unique key that can
+	// replace it are copied as well, by matching full rows. Such tables are
+	// copied at once under a lock and cannot be verified by the
+	// IterativeVerifier. See IsFullRowMatchTable.
+	//
+	// Optional: defaults to false, such tables are rejected.
+	FullRowMatching bool
+
+	// The storage engines whose tables are not ferried, even if they match
+	// the TableFilter, such as BLACKHOLE, whose tables have no rows, or
+	// FEDERATED, whose rows live on another server. The skipped tables are
+	// listed in the warnings of the preflight checks. Set to an empty list
+	// to ferry the tables of every storage engine.
+	//
+	// Optional: defaults to BLACKHOLE, FEDERATED and MEMORY.
+	IgnoredStorageEngines []string
+
+	// Converts the values of the latin1 columns of the source to utf8mb4, so
+	// the copy also upgrades the charset of the data. The corresponding
+	// columns of the target must be utf8mb4 columns, ghostferry-copydb
+	// creates them as such. The IterativeVerifier and the SamplingVerifier
+	// compare the values once converted, but the ChecksumTableVerifier
+	// cannot be used. The source connection must use the utf8 or utf8mb4
+	// charset.
+	//
+	// Optional: defaults to false.
+	ConvertLatin1ToUtf8mb4 bool
+
+	// Treats the values of the columns whose collation differs between the
+	// source and the target as equal if the collations compare them as
+	// equal: the IterativeVerifier fingerprints them case-insensitively if
+	// either collation is case-insensitive, and without their trailing
+	// spaces if either collation pads spaces. Otherwise such columns are
+	// compared byte for byte, and the values that the target folded or
+	// trimmed are reported as mismatches. The preflight checks warn about
+	// the columns whose collation differs.
+	//
+	// Optional: defaults to false.
+	VerifierNormalizeCollations bool
+
+	// The columns the verifiers do not compare, keyed by the full name of
+	// the source table, such as an updated_at column maintained by the
+	// triggers of the target or a column transformed on purpose. The
+	// IterativeVerifier and the SamplingVerifier leave them out of the
+	// fingerprints of the rows, while the ChecksumTableVerifier, which
+	// checksums whole tables, cannot be used with them. The primary key
+	// columns cannot be ignored.
+	//
+	// Optional: defaults to comparing every column.
+	VerifierIgnoredColumns map[string][]string
+
+	// Compares the FLOAT, DOUBLE and DECIMAL columns by value with a
+	// tolerance in the IterativeVerifier, so the rounding of the values and
+	// their trailing zeros are not reported as mismatches. See
+	// NumericComparisonConfig.
+	//
+	// Optional: defaults to fingerprinting the values as they are.
+	VerifierNumericComparison *NumericComparisonConfig
+
+	// Assigns new primary keys to the rows of some tables on the target, and
+	// rewrites the columns referencing them, both during the copy and the
+	// binlog streaming. This allows merging the rows of a source into a
+	// target whose auto-increment primary keys would collide with them. The
+	// new primary keys are reserved by raising the AUTO_INCREMENT of the
+	// target tables, which requires the ALTER privilege on them. The
+	// verifiers cannot be used with remapped tables.
+	//
+	// Optional: defaults to no remapping.
+	PrimaryKeyRemapping *PrimaryKeyRemappingConfig
+
+	// The maximum rate of the writes of the copied rows to the target, in
+	// rows and in bytes per second. The bytes are estimated from the size of
+	// the values. The limits can be changed at runtime through the
+	// ControlServer.
+	//
+	// Optional: defaults to no limit.
+	CopyRowsPerSecond  int64
+	CopyBytesPerSecond int64
+
+	// The maximum rate of the writes of the binlog events to the target, in
+	// rows and in bytes per second, counting both images of an update.
+	//
+	// Optional: defaults to no limit.
+	BinlogRowsPerSecond  int64
+	BinlogBytesPerSecond int64
+
+	// The time windows during which the rate limits above are replaced,
+	// such as lower limits during the business hours. The first schedule
+	// including the current time applies. See ThrottleSchedule.
+	//
+	// Optional: defaults to no schedules.
+	ThrottleSchedules []*ThrottleSchedule
+
+	// The time zone of the ThrottleSchedules, such as America/Toronto.
+	//
+	// Optional: defaults to UTC
+	ThrottleScheduleTimezone string
+
+	// What to do when a binlog event cannot be written to the target after
+	// DBWriteRetries attempts: either abort the ferry or record the event to
+	// the DeadLetterFile for manual replay and keep going. The ferry is
+	// aborted with either policy on the network and permission errors, see
+	// ClassifyError, which are not caused by the events.
+	//
+	// Optional: defaults to abort.
+	BinlogWriteFailurePolicy string
+
+	// The file the binlog events are appended to with the dead_letter
+	// BinlogWriteFailurePolicy, as lines of JSON.
+	DeadLetterFile string
+
+	// How many times an event is attempted on its own before it is recorded
+	// to the DeadLetterFile.
+	//
+	// Optional: defaults to 5.
+	DeadLetterRetries int
+
+	// The sleep before retrying an event on its own, as a Go duration
+	// string. It doubles after every attempt, up to 30s.
+	//
+	// Optional: defaults to 1s
+	DeadLetterRetryBackoff string
+
+	// The binlog events are written to the target one batch at a time, in
+	// the order of the binlog, so the events of the tables related by
+	// foreign keys are always applied in the order of the source. If set,
+	// this order is enforced for these tables: their events are never dead
+	// lettered, the ferry is aborted instead, and a warning is logged if a
+	// DMLEventWriter plugin, which may reorder the events, replaces the
+	// BinlogWriter. The foreign keys are loaded from the source when the
+	// ferry starts.
+	//
+	// Optional: defaults to false.
+	StrictForeignKeyOrdering bool
+
+	// How the tables related by foreign keys are copied to a target that
+	// enforces the constraints, which would otherwise reject the rows
+	// copied before the rows they reference:
+	//
+	// - ordered: a table is only copied once the tables it references are
+	//   copied. The foreign keys must not form a cycle. The binlog events
+	//   are still written as they are streamed, so the events referencing
+	//   rows that are not copied yet are rejected: this only suits the
+	//   tables whose referenced rows are not written to during the copy.
+	// - deferred: the copied rows and the binlog events are written with
+	//   the foreign_key_checks of the session disabled, and the constraints
+	//   are validated on the target once the binlog streaming stopped: the
+	//   run fails if rows reference missing rows.
+	//
+	// Optional: defaults to copying the tables regardless of the foreign
+	// keys.
+	ForeignKeyCopyMode string
+
+	// Whether the rows skipped by the INSERT IGNORE statements of the copy
+	// and of the binlog, as they conflict with rows of the target, are
+	// counted, see IgnoredRowsCounter:
+	//
+	// - count: the ignored rows are reported in the IgnoredRows metric and
+	//   in the status. The binlog events of a batch are then written one
+	//   statement at a time.
+	// - strict: the run fails as soon as a row is ignored, which only suits
+	//   the copies whose rows are written once, such as those of a
+	//   Snapshot.
+	//
+	// Optional: defaults to not counting the ignored rows.
+	IgnoredRowsMode string
+
+	// Drops the non-unique secondary indexes of the target tables before
+	// their rows are copied, and adds them back once all the rows are
+	// copied and before the cutover, which makes the copy of the tables
+	// with many indexes much faster. The indexes leading with a column of a
+	// foreign key are kept. See DeferrableIndexes.
+	//
+	// The dropped indexes are kept in the state, so a resumed run adds
+	// them back.
+	//
+	// Optional: defaults to false.
+	DeferSecondaryIndexes bool
+
+	// How often the depths of the queues of pending work, such as the rows
+	// waiting to be reverified, are reported as the QueueDepth gauge, as a
+	// Go duration string.
+	//
+	// Optional: defaults to 10s
+	QueueDepthReportInterval string
+
+	// How far apart in time the binlog positions sampled into the
+	// BinlogTimeline are, as a Go duration string, and how many of them are
+	// kept in the state. The timeline translates the binlog positions into
+	// the times of their events, as shown in the status.
+	//
+	// Optional: defaults to 1m and 1440, a day of binlog.
+	BinlogTimelineInterval   string
+	BinlogTimelineMaxEntries int
+
+	// The run is reported as unhealthy by the health check of the
+	// ControlServer if any of these queues is deeper than its threshold.
+	// The queues are reverify, binlog_buffer and dead_letter.
+	//
+	// Optional: defaults to no threshold.
+	MaxHealthyQueueDepths map[string]int64
+
+	// The estimated memory, in bytes, that the rows in flight can use: the
+	// batches being copied, the binlog events waiting to be written and the
+	// rows waiting to be reverified. Past it, the DataIterator stops reading
+	// batches and the BinlogStreamer stops buffering events until the
+	// writers catch up. The memory used is reported as the MemoryUsage
+	// gauge every QueueDepthReportInterval.
+	//
+	// Optional: defaults to no budget.
+	MaxMemoryBytes int64
+
+	// Fingerprint the definitions of the ferried tables on the source and
+	// the target when the run starts, and abort the run with a diff of the
+	// definitions if any of them changes during the run. The definitions
+	// are checked every SchemaDriftCheckInterval and at the cutover.
+	//
+	// Optional: defaults to false.
+	DetectSchemaDrift bool
+
+	// How often the table definitions are checked, as a Go duration
+	// string.
+	//
+	// Optional: defaults to 1m
+	SchemaDriftCheckInterval string
+
+	// If set, the preflight checks require the target tables of a new run
+	// to be empty, and the run is aborted when another writer modifies
+	// rows of the target tables. The performance_schema of the target must
+	// be enabled. See TargetRowGuard.
+	//
+	// Optional: defaults to nil, no checks.
+	TargetRowGuard *TargetRowGuardConfig
+
+	// What to do when an online schema change of gh-ost,
+	// pt-online-schema-change or LHM is running on a ferried table, as
+	// found from the shadow tables and the triggers the tools create on the
+	// source. The migrated table is renamed when the migration completes,
+	// which the ferry cannot follow. It is checked when the run starts and
+	// again before the cutover.
+	//
+	// - fail: the run fails with the migrations found.
+	// - wait: the run waits for the migrations to complete, checking every
+	//   OnlineSchemaChangeCheckInterval.
+	// - ignore: the migrations and the shadow tables are not looked for.
+	//
+	// The shadow tables themselves are never ferried, unless ignore.
+	//
+	// Optional: defaults to fail.
+	OnlineSchemaChangeAction string
+
+	// How often to check whether the online schema changes completed with
+	// the wait OnlineSchemaChangeAction, as a Go duration string.
+	//
+	// Optional: defaults to 10s
+	OnlineSchemaChangeCheckInterval string
+
+	// Skip the binlog rows events of the tables that are not ferried before
+	// decoding their rows, which saves most of the CPU spent on the binlog
+	// when only a few tables of a busy server are ferried. The events are
+	// then streamed undecoded and only the table map events and the rows
+	// events of the ferried tables are decoded.
+	//
+	// MySQL cannot filter the binlog sent to a replication client by table,
+	// so the whole binlog is still received. To also reduce the network
+	// traffic, stream from a replica that only replicates the ferried tables
+	// with replicate_wild_do_table and log_replica_updates.
+	//
+	// Optional: defaults to false.
+	FilterBinlogBeforeDecoding bool
+
+	// The name of the BinlogClient streaming the binlog of the source, as
+	// registered with RegisterBinlogClient, so the replication library can
+	// be replaced without changing the BinlogStreamer.
+	//
+	// Optional: defaults to go-mysql, the vendored siddontang/go-mysql.
+	BinlogClient string
+
+	// Write the binlog events of each transaction of the source in a single
+	// transaction of the target, so the readers of the target never see a
+	// partially applied transaction. The events of a transaction are held
+	// until its commit is streamed, and a batch of events can exceed
+	// BinlogEventBatchSize to fit a large transaction, unless it is split by
+	// BinlogMaxTransactionRows or BinlogMaxTransactionStatements. The events
+	// written one by one after a failure with the dead_letter
+	// BinlogWriteFailurePolicy are not grouped.
+	//
+	// Optional: defaults to false.
+	PreserveSourceTransactions bool
+
+	// Compare the number of rows of every table on the source and the
+	// target once the binlog streaming stopped at the cutover, and abort the
+	// run if they differ. This is a fast sanity check, which can run before
+	// a checksum verification. It cannot be used with a CopyFilter,
+	// EventFilterExpressions or PrimaryKeyRemapping.
+	//
+	// Optional: defaults to false.
+	ReconcileRowCounts bool
+
+	// Only count the rows within the primary key range copied by the
+	// DataIterator when reconciling the row counts, which skips the rows
+	// inserted during the run.
+	//
+	// Optional: defaults to false.
+	ReconcileRowCountsInCopiedRange bool
+
+	// The plugins replacing the default components of the ferry, keyed by
+	// plugin kind: verifier, throttler, state_store, row_batch_writer or
+	// dml_event_writer. The plugins must be registered with RegisterPlugin
+	// by a package linked into the binary.
+	//
+	// Optional: defaults to no plugins.
+	Plugins map[string]*PluginConfig
+
+	// The middlewares the binlog events go through before being written to
+	// the target, in order, after those of Ferry.DMLEventMiddlewares. See
+	// DMLEventMiddleware. The filter and count middlewares are registered
+	// by ghostferry, others must be registered with RegisterPlugin as
+	// dml_event_middleware plugins.
+	//
+	// Optional: defaults to no middlewares.
+	DMLEventMiddlewares []*PluginConfig
+
+	// The URLs to which the lifecycle events of the run are posted, such as
+	// the start and the end of the copy, the readiness for the cutover, the
+	// results of the verifications and the fatal errors, and optionally every table
+	// once it is copied or verified. See WebhookConfig and Notification.
+	//
+	// Optional: defaults to no webhooks.
+	Webhooks []*WebhookConfig
+
+	// The Slack channel to which the copy completion, the readiness for the
+	// cutover, the results of the verifications and the fatal errors are
+	// posted. See SlackConfig.
+	//
+	// Optional: defaults to not posting to Slack.
+	Slack *SlackConfig
+
+	// Where the fatal errors and the panics of the run are reported, with
+	// the state of the ferry such as the binlog positions and the progress
+	// of the tables being copied. See ErrorReportingConfig and ErrorReport.
+	//
+	// Optional: defaults to not reporting the errors.
+	ErrorReporting *ErrorReportingConfig
+
+	// The format of the log output: text or json. The json format emits one
+	// object per line, with the context of each entry as separate fields
+	// such as table, binlog_file, binlog_pos, pk_start and pk_end, so that
+	// the logs can be ingested and queried by a log aggregator.
+	//
+	// Optional: defaults to text.
+	LogFormat string
+
+	// An identifier of the run, added as the ferry_id field of every log
+	// entry, as the ferry_id tag of the StatsD metrics, to the state dumps
+	// and to the audit records, so the load and the issues of concurrent
+	// runs can be told apart. A new id tags every metric with a new value,
+	// so set a stable id if the number of tag values is limited.
+	//
+	// Optional: defaults to a random UUID, new for every run.
+	FerryId string
+
+	// Prepends a comment with the FerryId, such as /* ghostferry
+	// ferry_id=3c1d... */, to the statements writing rows to the target, so
+	// their load can be attributed to the run in the processlist and in the
+	// slow query log of the target.
+	//
+	// Optional: defaults to false.
+	CommentTargetStatements bool
+
 	// Config for the ControlServer
 	ServerBindAddr string
 	WebBasedir     string
+
+	// Authentication, TLS and client allowlist of the ControlServer.
+	//
+	// Optional: defaults to serving every request over plain HTTP.
+	ServerAuth *ControlServerAuthConfig
+
+	// Serve the Go profiler under /debug/pprof/ and a JSON dump of the
+	// goroutine count, the queue depths and the state of every component
+	// under /debug/state on the ControlServer, to diagnose stalled runs.
+	// Consider restricting the access with ServerAuth.
+	//
+	// Optional: defaults to false.
+	ServerDebugEndpoints bool
 }
 
 func (c *Config) ValidateConfig() error {
@@ -233,8 +1088,92 @@ func (c *Config) ValidateConfig() error {
 		return fmt.Errorf("source: %s", err)
 	}
 
-	if err := c.Target.Validate(); err != nil {
-		return fmt.Errorf("target: %s", err)
+	if c.Source.Credentials != nil && c.Source.Credentials.Provider == CredentialsProviderRDSIAM {
+		return fmt.Errorf("source: the %s credentials provider is not supported, as the binlog client cannot authenticate with its tokens", CredentialsProviderRDSIAM)
+	}
+
+	if c.ConvertLatin1ToUtf8mb4 {
+		if err := validateLatin1ConversionCharset(c.Source); err != nil {
+			return err
+		}
+	}
+
+	switch c.TargetDialect {
+	case "":
+		c.TargetDialect = DialectMySQL
+		fallthrough
+	case DialectMySQL, DialectVitess:
+		if err := c.Target.Validate(); err != nil {
+			return fmt.Errorf("target: %s", err)
+		}
+
+		if c.Source.Session.timeZone() != c.Target.Session.timeZone() {
+			return fmt.Errorf("the Session TimeZone of the source and the target must be the same, as the TIMESTAMP values are copied as read")
+		}
+
+		if c.TargetDialect == DialectVitess {
+			if err := c.validateVitessTarget(); err != nil {
+				return err
+			}
+		}
+	case DialectPostgreSQL:
+		if err := c.Target.validateAddress(); err != nil {
+			return fmt.Errorf("target: %s", err)
+		}
+
+		if c.Target.Params["dbname"] == "" {
+			return fmt.Errorf("target: dbname param must be set for a %s target", DialectPostgreSQL)
+		}
+
+		if c.Target.Session != nil {
+			return fmt.Errorf("target: Session is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.Target.Credentials != nil {
+			return fmt.Errorf("target: Credentials is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.Target.Proxy != nil {
+			return fmt.Errorf("target: Proxy is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.StageRowBatches {
+			return fmt.Errorf("StageRowBatches is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.LoadDataInfile {
+			return fmt.Errorf("LoadDataInfile is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.PrimaryKeyRemapping != nil {
+			return fmt.Errorf("PrimaryKeyRemapping is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.ReverseReplication != nil {
+			return fmt.Errorf("ReverseReplication is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.FullRowMatching {
+			return fmt.Errorf("FullRowMatching is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.ConvertLatin1ToUtf8mb4 {
+			return fmt.Errorf("ConvertLatin1ToUtf8mb4 is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.DetectSchemaDrift {
+			return fmt.Errorf("DetectSchemaDrift is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.TargetRowGuard != nil {
+			return fmt.Errorf("TargetRowGuard is not supported with a %s target", DialectPostgreSQL)
+		}
+
+		if c.BinlogInsertBatchSize > 1 {
+			return fmt.Errorf("BinlogInsertBatchSize is not supported with a %s target", DialectPostgreSQL)
+		}
+	default:
+		return fmt.Errorf("invalid TargetDialect %s, must be %s, %s or %s", c.TargetDialect, DialectMySQL, DialectPostgreSQL, DialectVitess)
 	}
 
 	if c.TableFilter == nil {
@@ -245,22 +1184,427 @@ func (c *Config) ValidateConfig() error {
 		c.DBWriteRetries = 5
 	}
 
+	for table, weight := range c.DataIterationTableWeights {
+		if weight < 1 {
+			return fmt.Errorf("weight of table %s must be at least 1", table)
+		}
+	}
+
+	if c.DataIterationTableConcurrency < 0 {
+		return fmt.Errorf("DataIterationTableConcurrency must not be negative")
+	}
+
+	if c.DataIterationOrder == "" {
+		c.DataIterationOrder = TableOrderAlphabetical
+	}
+
+	switch c.DataIterationOrder {
+	case TableOrderAlphabetical, TableOrderLargestFirst:
+	case TableOrderExplicit:
+		if len(c.DataIterationTableOrder) == 0 {
+			return fmt.Errorf("DataIterationTableOrder must be provided when DataIterationOrder is %s", TableOrderExplicit)
+		}
+	default:
+		return fmt.Errorf("invalid DataIterationOrder %s", c.DataIterationOrder)
+	}
+
+	if c.ReverseReplication != nil {
+		if err := c.ReverseReplication.Validate(); err != nil {
+			return fmt.Errorf("ReverseReplication: %s", err)
+		}
+
+		c.ContinuousReplication = true
+	}
+
+	if c.DeltaOnly != nil {
+		if c.ReverseReplication != nil {
+			return fmt.Errorf("DeltaOnly cannot be used with ReverseReplication")
+		}
+
+		if err := c.DeltaOnly.Validate(); err != nil {
+			return fmt.Errorf("DeltaOnly: %s", err)
+		}
+	}
+
+	if c.ReadReplica != nil {
+		if c.ReverseReplication != nil || c.DeltaOnly != nil {
+			return fmt.Errorf("ReadReplica cannot be used with ReverseReplication or DeltaOnly, which copy no rows")
+		}
+
+		if err := c.ReadReplica.Validate(); err != nil {
+			return fmt.Errorf("ReadReplica: %s", err)
+		}
+	}
+
+	if c.Snapshot != nil {
+		if c.ReadReplica != nil {
+			return fmt.Errorf("Snapshot cannot be used with ReadReplica, as the snapshot is taken on the source")
+		}
+
+		if c.DeltaOnly != nil {
+			return fmt.Errorf("Snapshot cannot be used with DeltaOnly, which copies no rows")
+		}
+
+		if c.ReverseReplication != nil {
+			return fmt.Errorf("Snapshot cannot be used with ReverseReplication, which copies no rows")
+		}
+
+		if err := c.Snapshot.Validate(); err != nil {
+			return fmt.Errorf("Snapshot: %s", err)
+		}
+	}
+
+	if c.VerifierNumericComparison != nil {
+		if err := c.VerifierNumericComparison.Validate(); err != nil {
+			return fmt.Errorf("VerifierNumericComparison: %s", err)
+		}
+	}
+
+	if c.ContinuousReplication && c.BinlogReconnectAttempts == 0 {
+		c.BinlogReconnectAttempts = 10
+	}
+
+	if c.CheckpointInterval == "" {
+		c.CheckpointInterval = "1m"
+	}
+
+	if _, err := time.ParseDuration(c.CheckpointInterval); err != nil {
+		return fmt.Errorf("invalid CheckpointInterval: %s", err)
+	}
+
+	if c.ProgressLogInterval != "" {
+		if interval, err := time.ParseDuration(c.ProgressLogInterval); err != nil {
+			return fmt.Errorf("invalid ProgressLogInterval: %s", err)
+		} else if interval <= 0 {
+			return fmt.Errorf("ProgressLogInterval must be positive, got %s", c.ProgressLogInterval)
+		}
+	}
+
+	if c.MaxCutoverDowntime != "" {
+		if downtime, err := time.ParseDuration(c.MaxCutoverDowntime); err != nil {
+			return fmt.Errorf("invalid MaxCutoverDowntime: %s", err)
+		} else if downtime <= 0 {
+			return fmt.Errorf("MaxCutoverDowntime must be positive, got %s", c.MaxCutoverDowntime)
+		}
+	}
+
+	if c.CutoverRetryInterval != "" {
+		if _, err := time.ParseDuration(c.CutoverRetryInterval); err != nil {
+			return fmt.Errorf("invalid CutoverRetryInterval: %s", err)
+		}
+	}
+
+	if c.MaxHealthyBinlogLag == "" {
+		c.MaxHealthyBinlogLag = "1m"
+	}
+
+	if _, err := time.ParseDuration(c.MaxHealthyBinlogLag); err != nil {
+		return fmt.Errorf("invalid MaxHealthyBinlogLag: %s", err)
+	}
+
+	if c.TargetRowGuard != nil {
+		if err := c.TargetRowGuard.Validate(); err != nil {
+			return fmt.Errorf("TargetRowGuard: %s", err)
+		}
+	}
+
+	if c.SchemaDriftCheckInterval == "" {
+		c.SchemaDriftCheckInterval = "1m"
+	}
+
+	if _, err := time.ParseDuration(c.SchemaDriftCheckInterval); err != nil {
+		return fmt.Errorf("invalid SchemaDriftCheckInterval: %s", err)
+	}
+
+	if c.IgnoredStorageEngines == nil {
+		c.IgnoredStorageEngines = append([]string{}, DefaultIgnoredStorageEngines...)
+	}
+
+	for _, engine := range c.IgnoredStorageEngines {
+		if engine == "" {
+			return fmt.Errorf("IgnoredStorageEngines must not contain an empty engine")
+		}
+	}
+
+	switch c.ForeignKeyCopyMode {
+	case "", ForeignKeyCopyOrdered:
+	case ForeignKeyCopyDeferred:
+		if c.TargetDialect == DialectPostgreSQL {
+			return fmt.Errorf("the %s ForeignKeyCopyMode is not supported with a %s target", ForeignKeyCopyDeferred, DialectPostgreSQL)
+		}
+	default:
+		return fmt.Errorf("invalid ForeignKeyCopyMode %s, must be %s or %s", c.ForeignKeyCopyMode, ForeignKeyCopyOrdered, ForeignKeyCopyDeferred)
+	}
+
+	switch c.IgnoredRowsMode {
+	case "", IgnoredRowsCount, IgnoredRowsStrict:
+	default:
+		return fmt.Errorf("invalid IgnoredRowsMode %s, must be %s or %s", c.IgnoredRowsMode, IgnoredRowsCount, IgnoredRowsStrict)
+	}
+
+	// The rows are counted entirely on the source, while the filters and the
+	// remapping copy a subset of them or add them to existing rows on the
+	// target.
+	if c.ReconcileRowCounts && (c.CopyFilter != nil || c.PrimaryKeyRemapping != nil || len(c.EventFilterExpressions) > 0) {
+		return fmt.Errorf("ReconcileRowCounts cannot be used with a CopyFilter, EventFilterExpressions or PrimaryKeyRemapping, as the row counts of the source and the target differ")
+	}
+
+	if c.DeferSecondaryIndexes {
+		if c.DeltaOnly != nil || c.ReverseReplication != nil {
+			return fmt.Errorf("DeferSecondaryIndexes cannot be used with DeltaOnly or ReverseReplication, which copy no rows")
+		}
+
+		if c.TargetDialect == DialectPostgreSQL {
+			return fmt.Errorf("DeferSecondaryIndexes is not supported with a %s target", DialectPostgreSQL)
+		}
+	}
+
+	switch c.OnlineSchemaChangeAction {
+	case "":
+		c.OnlineSchemaChangeAction = OnlineSchemaChangeActionFail
+	case OnlineSchemaChangeActionFail, OnlineSchemaChangeActionWait, OnlineSchemaChangeActionIgnore:
+	default:
+		return fmt.Errorf("invalid OnlineSchemaChangeAction %s, must be %s, %s or %s", c.OnlineSchemaChangeAction, OnlineSchemaChangeActionFail, OnlineSchemaChangeActionWait, OnlineSchemaChangeActionIgnore)
+	}
+
+	if c.OnlineSchemaChangeCheckInterval == "" {
+		c.OnlineSchemaChangeCheckInterval = "10s"
+	}
+
+	if interval, err := time.ParseDuration(c.OnlineSchemaChangeCheckInterval); err != nil {
+		return fmt.Errorf("invalid OnlineSchemaChangeCheckInterval: %s", err)
+	} else if interval <= 0 {
+		return fmt.Errorf("OnlineSchemaChangeCheckInterval must be positive, got %s", c.OnlineSchemaChangeCheckInterval)
+	}
+
+	for i, webhook := range c.Webhooks {
+		if err := webhook.Validate(); err != nil {
+			return fmt.Errorf("Webhooks[%d]: %s", i, err)
+		}
+	}
+
+	if c.Slack != nil {
+		if err := c.Slack.Validate(); err != nil {
+			return fmt.Errorf("Slack: %s", err)
+		}
+	}
+
+	for i, schedule := range c.ThrottleSchedules {
+		if err := schedule.Validate(); err != nil {
+			return fmt.Errorf("ThrottleSchedules[%d]: %s", i, err)
+		}
+	}
+
+	if c.ThrottleScheduleTimezone == "" {
+		c.ThrottleScheduleTimezone = "UTC"
+	}
+
+	if _, err := time.LoadLocation(c.ThrottleScheduleTimezone); err != nil {
+		return fmt.Errorf("invalid ThrottleScheduleTimezone: %s", err)
+	}
+
+	if c.TableMetrics != nil {
+		if err := c.TableMetrics.Validate(); err != nil {
+			return fmt.Errorf("TableMetrics: %s", err)
+		}
+	}
+
+	if c.ErrorReporting != nil {
+		if err := c.ErrorReporting.Validate(); err != nil {
+			return fmt.Errorf("ErrorReporting: %s", err)
+		}
+	}
+
+	for kind, plugin := range c.Plugins {
+		if kind == PluginKindDMLEventMiddleware {
+			return fmt.Errorf("the %s plugins are set in DMLEventMiddlewares", kind)
+		}
+
+		if err := validatePluginConfig(kind, plugin); err != nil {
+			return err
+		}
+	}
+
+	for i, middleware := range c.DMLEventMiddlewares {
+		if err := validatePluginConfig(PluginKindDMLEventMiddleware, middleware); err != nil {
+			return fmt.Errorf("DMLEventMiddlewares[%d]: %s", i, err)
+		}
+	}
+
+	rateLimits := map[string]int64{
+		"CopyRowsPerSecond":    c.CopyRowsPerSecond,
+		"CopyBytesPerSecond":   c.CopyBytesPerSecond,
+		"BinlogRowsPerSecond":  c.BinlogRowsPerSecond,
+		"BinlogBytesPerSecond": c.BinlogBytesPerSecond,
+	}
+	for name, limit := range rateLimits {
+		if limit < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	switch c.BinlogWriteFailurePolicy {
+	case "":
+		c.BinlogWriteFailurePolicy = BinlogWriteFailureAbort
+	case BinlogWriteFailureAbort:
+	case BinlogWriteFailureDeadLetter:
+		if c.DeadLetterFile == "" {
+			return fmt.Errorf("DeadLetterFile must be set with the %s BinlogWriteFailurePolicy", BinlogWriteFailureDeadLetter)
+		}
+	default:
+		return fmt.Errorf("invalid BinlogWriteFailurePolicy %s, must be %s or %s", c.BinlogWriteFailurePolicy, BinlogWriteFailureAbort, BinlogWriteFailureDeadLetter)
+	}
+
+	if c.DeadLetterRetries == 0 {
+		c.DeadLetterRetries = 5
+	}
+
+	if c.DeadLetterRetryBackoff == "" {
+		c.DeadLetterRetryBackoff = "1s"
+	}
+
+	if _, err := time.ParseDuration(c.DeadLetterRetryBackoff); err != nil {
+		return fmt.Errorf("invalid DeadLetterRetryBackoff: %s", err)
+	}
+
+	if c.QueueDepthReportInterval == "" {
+		c.QueueDepthReportInterval = "10s"
+	}
+
+	if _, err := time.ParseDuration(c.QueueDepthReportInterval); err != nil {
+		return fmt.Errorf("invalid QueueDepthReportInterval: %s", err)
+	}
+
+	if c.BinlogTimelineInterval == "" {
+		c.BinlogTimelineInterval = "1m"
+	}
+
+	if _, err := time.ParseDuration(c.BinlogTimelineInterval); err != nil {
+		return fmt.Errorf("invalid BinlogTimelineInterval: %s", err)
+	}
+
+	if c.BinlogTimelineMaxEntries == 0 {
+		c.BinlogTimelineMaxEntries = 1440
+	}
+
+	if c.BinlogTimelineMaxEntries < 0 {
+		return fmt.Errorf("BinlogTimelineMaxEntries must not be negative")
+	}
+
+	for queue, depth := range c.MaxHealthyQueueDepths {
+		if depth < 0 {
+			return fmt.Errorf("MaxHealthyQueueDepths for %s must not be negative", queue)
+		}
+	}
+
+	if c.MaxMemoryBytes < 0 {
+		return fmt.Errorf("MaxMemoryBytes must not be negative")
+	}
+
+	if c.AuditLogMaxFileSize == 0 {
+		c.AuditLogMaxFileSize = 100 * 1024 * 1024
+	}
+
+	if c.AuditLogMaxFileSize < 0 {
+		return fmt.Errorf("AuditLogMaxFileSize must be positive, got %d", c.AuditLogMaxFileSize)
+	}
+
+	if c.PrimaryKeyRemapping != nil {
+		if err := c.PrimaryKeyRemapping.Validate(); err != nil {
+			return fmt.Errorf("PrimaryKeyRemapping: %s", err)
+		}
+	}
+
+	for table, batchSize := range c.DataIterationTableBatchSizes {
+		if batchSize == 0 {
+			return fmt.Errorf("batch size of table %s must be at least 1", table)
+		}
+	}
+
 	if c.DataIterationBatchSize == 0 {
-		c.DataIterationBatchSize = 200
+		c.DataIterationBatchSize = DefaultDataIterationBatchSize
+	}
+
+	switch c.LogFormat {
+	case "":
+		c.LogFormat = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("LogFormat must be %s or %s", LogFormatText, LogFormatJSON)
+	}
+
+	if c.FerryId == "" {
+		c.FerryId = NewFerryId()
+	}
+
+	if c.CommentTargetStatements && strings.Contains(c.FerryId, "*/") {
+		return fmt.Errorf("FerryId cannot contain */ with CommentTargetStatements")
 	}
 
 	if c.BinlogEventBatchSize == 0 {
 		c.BinlogEventBatchSize = 100
 	}
 
+	if c.BinlogInsertBatchSize == 0 {
+		c.BinlogInsertBatchSize = 1
+	}
+
+	if c.BinlogInsertBatchSize < 0 {
+		return fmt.Errorf("BinlogInsertBatchSize must be positive")
+	}
+
+	if c.BinlogClient != "" {
+		if _, err := binlogClientFactory(c.BinlogClient); err != nil {
+			return err
+		}
+	}
+
+	if c.BinlogMaxTransactionRows < 0 {
+		return fmt.Errorf("BinlogMaxTransactionRows must not be negative")
+	}
+
+	if c.BinlogMaxTransactionStatements < 0 {
+		return fmt.Errorf("BinlogMaxTransactionStatements must not be negative")
+	}
+
+	if c.DataIterationTargetBatchDuration != "" {
+		if _, err := time.ParseDuration(c.DataIterationTargetBatchDuration); err != nil {
+			return fmt.Errorf("invalid DataIterationTargetBatchDuration: %s", err)
+		}
+	}
+
+	if c.DataIterationMinBatchSize == 0 {
+		c.DataIterationMinBatchSize = 10
+	}
+
+	if c.DataIterationMaxBatchSize == 0 {
+		c.DataIterationMaxBatchSize = 100000
+	}
+
+	if c.DataIterationMinBatchSize > c.DataIterationMaxBatchSize {
+		return fmt.Errorf("DataIterationMinBatchSize %d must not exceed DataIterationMaxBatchSize %d", c.DataIterationMinBatchSize, c.DataIterationMaxBatchSize)
+	}
+
 	if c.DataIterationConcurrency == 0 {
-		c.DataIterationConcurrency = 4
+		c.DataIterationConcurrency = DefaultDataIterationConcurrency
+	}
+
+	if c.DataIterationTableConcurrency == 0 {
+		c.DataIterationTableConcurrency = 2 * c.DataIterationConcurrency
+	}
+
+	if len(c.DataIterationTableWeights) > 0 && c.DataIterationTableConcurrency <= c.DataIterationConcurrency {
+		return fmt.Errorf("DataIterationTableWeights require DataIterationTableConcurrency %d to be larger than DataIterationConcurrency %d", c.DataIterationTableConcurrency, c.DataIterationConcurrency)
 	}
 
 	if c.DBReadRetries == 0 {
 		c.DBReadRetries = 5
 	}
 
+	if err := c.RetryPolicies.validate(c); err != nil {
+		return err
+	}
+
 	if c.ServerBindAddr == "" {
 		c.ServerBindAddr = "0.0.0.0:8000"
 	}
@@ -269,5 +1613,47 @@ func (c *Config) ValidateConfig() error {
 		c.WebBasedir = "."
 	}
 
+	if c.ServerAuth != nil {
+		if err := c.ServerAuth.Validate(); err != nil {
+			return fmt.Errorf("ServerAuth: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// VTGate cannot write to several shards in a transaction, nor run the
+// statements of the options below.
+func (c *Config) validateVitessTarget() error {
+	if c.StageRowBatches {
+		return fmt.Errorf("StageRowBatches is not supported with a %s target", DialectVitess)
+	}
+
+	if c.LoadDataInfile {
+		return fmt.Errorf("LoadDataInfile is not supported with a %s target", DialectVitess)
+	}
+
+	if c.PreserveSourceTransactions {
+		return fmt.Errorf("PreserveSourceTransactions is not supported with a %s target", DialectVitess)
+	}
+
+	if c.ReverseReplication != nil {
+		return fmt.Errorf("ReverseReplication is not supported with a %s target", DialectVitess)
+	}
+
+	if c.DetectSchemaDrift {
+		return fmt.Errorf("DetectSchemaDrift is not supported with a %s target", DialectVitess)
+	}
+
+	if c.TargetRowGuard != nil {
+		return fmt.Errorf("TargetRowGuard is not supported with a %s target", DialectVitess)
+	}
+
+	// A multi-row statement would be written to several shards in a single
+	// transaction.
+	if c.BinlogInsertBatchSize > 1 {
+		return fmt.Errorf("BinlogInsertBatchSize is not supported with a %s target", DialectVitess)
+	}
+
 	return nil
 }
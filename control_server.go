@@ -1,9 +1,13 @@
 package ghostferry
 
 import (
+	"encoding/json"
+	"fmt"
 	"html/template"
 	"net/http"
+	"net/http/pprof"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,6 +21,14 @@ type ControlServer struct {
 	Addr     string
 	Basedir  string
 
+	// Restricts the access to the server. Optional: defaults to serving
+	// every request over plain HTTP.
+	Auth *ControlServerAuthConfig
+
+	// If set, the Go profiler is served under /debug/pprof/ and the
+	// DebugState of the ferry under /debug/state.
+	EnableDebug bool
+
 	server    *http.Server
 	logger    *logrus.Entry
 	router    *mux.Router
@@ -29,11 +41,27 @@ func (this *ControlServer) Initialize() (err error) {
 
 	this.router = mux.NewRouter()
 	this.router.HandleFunc("/", this.HandleIndex).Methods("GET")
+	this.router.HandleFunc("/api/health", this.HandleHealth).Methods("GET")
+	this.router.HandleFunc("/api/status", this.HandleStatus).Methods("GET")
+	this.router.HandleFunc("/api/status/schema", this.HandleStatusSchema).Methods("GET")
+	this.router.HandleFunc("/api/tunables", this.HandleTunables).Methods("GET")
 	this.router.HandleFunc("/api/actions/pause", this.HandlePause).Methods("POST")
 	this.router.HandleFunc("/api/actions/unpause", this.HandleUnpause).Methods("POST")
 	this.router.HandleFunc("/api/actions/cutover", this.HandleCutover).Queries("type", "{type:automatic|manual}").Methods("POST")
 	this.router.HandleFunc("/api/actions/stop", this.HandleStop).Methods("POST")
 	this.router.HandleFunc("/api/actions/verify", this.HandleVerify).Methods("POST")
+	this.router.HandleFunc("/api/actions/table-weight", this.HandleTableWeight).Queries("table", "{table}", "weight", "{weight:[0-9]+}").Methods("POST")
+	this.router.HandleFunc("/api/actions/rate-limit", this.HandleRateLimit).Queries("phase", "{phase}", "rows", "{rows:[0-9]+}", "bytes", "{bytes:[0-9]+}").Methods("POST")
+	this.router.HandleFunc("/api/actions/tunables", this.HandleApplyTunables).Methods("POST")
+
+	if this.EnableDebug {
+		this.router.HandleFunc("/debug/state", this.HandleDebugState).Methods("GET")
+		this.router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		this.router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		this.router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		this.router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		this.router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	}
 
 	if WebUiBasedir != "" {
 		this.Basedir = WebUiBasedir
@@ -53,14 +81,32 @@ func (this *ControlServer) Initialize() (err error) {
 		Handler: this,
 	}
 
+	if this.Auth != nil {
+		err = this.Auth.Validate()
+		if err != nil {
+			return err
+		}
+
+		this.server.TLSConfig, err = this.Auth.BuildTLSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to build TLS config: %v", err)
+		}
+	}
+
 	return nil
 }
 
 func (this *ControlServer) Run(wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	this.logger.Infof("running on %s", this.Addr)
-	err := this.server.ListenAndServe()
+	var err error
+	if this.server.TLSConfig != nil {
+		this.logger.Infof("running on %s with TLS", this.Addr)
+		err = this.server.ListenAndServeTLS("", "")
+	} else {
+		this.logger.Infof("running on %s", this.Addr)
+		err = this.server.ListenAndServe()
+	}
 	if err != nil {
 		logrus.WithError(err).Error("error on ListenAndServe")
 	}
@@ -73,6 +119,23 @@ func (this *ControlServer) Shutdown() error {
 func (this *ControlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	if this.Auth != nil {
+		if status := this.Auth.authorize(r); status != 0 {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Basic realm="ghostferry"`)
+			}
+			http.Error(w, http.StatusText(status), status)
+
+			this.logger.WithFields(logrus.Fields{
+				"method": r.Method,
+				"path":   r.RequestURI,
+				"remote": r.RemoteAddr,
+				"status": status,
+			}).Warn("rejected http request")
+			return
+		}
+	}
+
 	this.router.ServeHTTP(w, r)
 
 	this.logger.WithFields(logrus.Fields{
@@ -91,14 +154,79 @@ func (this *ControlServer) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (this *ControlServer) HandlePause(w http.ResponseWriter, r *http.Request) {
-	this.F.Throttler.SetPaused(true)
+func (this *ControlServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	health := this.F.Health()
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(health)
+	if err != nil {
+		this.logger.WithError(err).Error("failed to encode health status")
+	}
+}
+
+func (this *ControlServer) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(this.F.StatusSnapshot(this.Verifier))
+	if err != nil {
+		this.logger.WithError(err).Error("failed to encode status snapshot")
+	}
+}
+
+func (this *ControlServer) HandleStatusSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write([]byte(StatusSnapshotJSONSchema))
+}
+
+func (this *ControlServer) HandleDebugState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(this.F.DebugState())
+	if err != nil {
+		this.logger.WithError(err).Error("failed to encode debug state")
+	}
+}
+
+// Pauses both the reads and the writes, unless the side query parameter is
+// set to either read or write. Note that pausing one side also pauses the
+// other if both use the same throttler. With the component query parameter
+// set to copy, binlog or verifier, only that component is paused, see
+// ComponentPauser.
+func (this *ControlServer) HandlePause(w http.ResponseWriter, r *http.Request) {
+	this.setPaused(w, r, true)
 }
 
 func (this *ControlServer) HandleUnpause(w http.ResponseWriter, r *http.Request) {
-	this.F.Throttler.SetPaused(false)
+	this.setPaused(w, r, false)
+}
+
+func (this *ControlServer) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if component := r.URL.Query().Get("component"); component != "" {
+		err := this.F.Pauser.SetPaused(component, paused)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	switch side := r.URL.Query().Get("side"); side {
+	case "":
+		this.F.SetThrottlersPaused(paused)
+	case "read":
+		this.F.ReadThrottler.SetPaused(paused)
+	case "write":
+		this.F.WriteThrottler.SetPaused(paused)
+	default:
+		http.Error(w, fmt.Sprintf("invalid side %s, must be read or write", side), http.StatusBadRequest)
+		return
+	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -118,6 +246,87 @@ func (this *ControlServer) HandleCutover(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+func (this *ControlServer) HandleTableWeight(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	weight, err := strconv.Atoi(vars["weight"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = this.F.DataIterator.Scheduler.SetTableWeight(vars["table"], weight)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Sets the rows and bytes per second limits of the writes of a phase. A limit
+// of 0 removes it.
+func (this *ControlServer) HandleRateLimit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	limiter, err := this.F.RateLimiter(vars["phase"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := strconv.ParseInt(vars["rows"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bytes, err := strconv.ParseInt(vars["bytes"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limiter.SetLimits(rows, bytes)
+	this.logger.WithFields(logrus.Fields{
+		"phase":          vars["phase"],
+		"rowsPerSecond":  rows,
+		"bytesPerSecond": bytes,
+	}).Info("changed rate limits")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (this *ControlServer) HandleTunables(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(this.F.Tunables())
+	if err != nil {
+		this.logger.WithError(err).Error("failed to encode tunables")
+	}
+}
+
+// Changes the tunable settings given by the JSON body, such as
+// {"DataIterationBatchSize": 500}, see TunableConfig. The settings left out
+// are unchanged. Responds with the settings in use.
+func (this *ControlServer) HandleApplyTunables(w http.ResponseWriter, r *http.Request) {
+	tunables := this.F.Tunables()
+
+	err := json.NewDecoder(r.Body).Decode(&tunables)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid tunables: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err = this.F.ApplyTunables(tunables)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	this.HandleTunables(w, r)
+}
+
 func (this *ControlServer) HandleStop(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotImplemented)
 }
@@ -134,5 +343,11 @@ func (this *ControlServer) HandleVerify(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	go func() {
+		this.Verifier.Wait()
+		result, err := this.Verifier.Result()
+		this.F.NotifyVerificationResult(result.VerificationResult, err)
+	}()
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -0,0 +1,152 @@
+package ghostferry
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Restricts the access to the ControlServer, so it can be exposed on shared
+// infrastructure. Each of the restrictions is optional.
+type ControlServerAuthConfig struct {
+	// The credentials of the HTTP basic authentication of the requests.
+	Username string
+	Password string
+
+	// The tokens accepted in an "Authorization: Bearer" header. The requests
+	// can use either basic authentication or one of these tokens.
+	BearerTokens []string
+
+	// The certificate and the key to serve the requests over TLS.
+	CertPath string
+	KeyPath  string
+
+	// If set, the clients must present a certificate signed by one of the
+	// certificate authorities of this file. Requires CertPath and KeyPath.
+	ClientCAPath string
+
+	// If set, only the requests from these CIDRs are served, for example
+	// 10.0.0.0/8.
+	AllowedCIDRs []string
+
+	allowedNets []*net.IPNet
+}
+
+func (c *ControlServerAuthConfig) Validate() error {
+	if (c.Username == "") != (c.Password == "") {
+		return errors.New("Username and Password must be set together")
+	}
+
+	if (c.CertPath == "") != (c.KeyPath == "") {
+		return errors.New("CertPath and KeyPath must be set together")
+	}
+
+	if c.ClientCAPath != "" && c.CertPath == "" {
+		return errors.New("ClientCAPath requires CertPath and KeyPath")
+	}
+
+	c.allowedNets = make([]*net.IPNet, 0, len(c.AllowedCIDRs))
+	for _, cidr := range c.AllowedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid allowed CIDR %s: %v", cidr, err)
+		}
+		c.allowedNets = append(c.allowedNets, ipNet)
+	}
+
+	return nil
+}
+
+// Returns nil if the server must not use TLS.
+func (c *ControlServerAuthConfig) BuildTLSConfig() (*tls.Config, error) {
+	if c.CertPath == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertPath, c.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientCAPath != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAPath)
+		if err != nil {
+			return nil, err
+		}
+
+		clientCAs := x509.NewCertPool()
+		if ok := clientCAs.AppendCertsFromPEM(pem); !ok {
+			return nil, errors.New("unable to append client CA pem")
+		}
+
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// Returns the status to respond with if the request is not allowed, or 0.
+func (c *ControlServerAuthConfig) authorize(r *http.Request) int {
+	if len(c.allowedNets) > 0 && !c.isAllowedAddr(r.RemoteAddr) {
+		return http.StatusForbidden
+	}
+
+	if c.Username == "" && len(c.BearerTokens) == 0 {
+		return 0
+	}
+
+	if c.Username != "" {
+		username, password, ok := r.BasicAuth()
+		if ok && secureEqual(username, c.Username) && secureEqual(password, c.Password) {
+			return 0
+		}
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		for _, bearerToken := range c.BearerTokens {
+			if secureEqual(token, bearerToken) {
+				return 0
+			}
+		}
+	}
+
+	return http.StatusUnauthorized
+}
+
+func (c *ControlServerAuthConfig) isAllowedAddr(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range c.allowedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
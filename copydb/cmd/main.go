@@ -1,28 +1,54 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/Shopify/ghostferry/copydb"
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/sirupsen/logrus"
 )
 
 func usage() {
 	fmt.Printf("ghostferry-copydb built with ghostferry %s\n", ghostferry.VersionString)
-	fmt.Printf("Usage: %s [OPTIONS] path/to/config/file.json\n", os.Args[0])
+	fmt.Printf("Usage: %s [OPTIONS] path/to/config/file.{json,yaml}\n", os.Args[0])
 	flag.PrintDefaults()
 }
 
 var verbose bool
 var dryrun bool
+var dumpStateOnSignal bool
+var resumeStateFile string
+var reverseFrom string
+var printConfig bool
 
 func init() {
 	flag.BoolVar(&verbose, "verbose", false, "Show verbose logging output")
 	flag.BoolVar(&dryrun, "dryrun", false, "Do not actually perform the move, just connect and check settings")
+	flag.BoolVar(&dumpStateOnSignal, "dump-state-on-signal", false, "On SIGINT or SIGTERM, stop the copy cleanly and dump the state to stdout so it can be resumed")
+	flag.StringVar(&resumeStateFile, "resume-state-file", "", "Resume the copy from the state dumped in this file by a previous run")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the config, with the environment variables interpolated and the secrets redacted, and exit")
+	flag.StringVar(&reverseFrom, "reverse-from", "", "Keep the source up to date from the target after the cutover, tailing the binlog of the target from this file:position, as logged at the cutover")
+}
+
+func parseBinlogPosition(s string) (mysql.Position, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return mysql.Position{}, fmt.Errorf("%s is not a file:position", s)
+	}
+
+	pos, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("invalid position in %s: %v", s, err)
+	}
+
+	return mysql.Position{Name: s[:i], Pos: uint32(pos)}, nil
 }
 
 func errorAndExit(msg string) {
@@ -65,15 +91,47 @@ func main() {
 	}
 
 	// Open and parse configurations
-	f, err := os.Open(configFilePath)
+	multiConfig := &copydb.MultiConfig{Config: config}
+	err := copydb.DecodeConfigFile(configFilePath, multiConfig)
 	if err != nil {
-		errorAndExit(fmt.Sprintf("failed to open file: %v", err))
+		errorAndExit(fmt.Sprintf("failed to parse config file: %v", err))
 	}
 
-	parser := json.NewDecoder(f)
-	err = parser.Decode(&config)
-	if err != nil {
-		errorAndExit(fmt.Sprintf("failed to parse config file: %v", err))
+	if printConfig {
+		redacted, err := copydb.RedactedConfig(multiConfig)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to print config: %v", err))
+		}
+
+		fmt.Println(string(redacted))
+		return
+	}
+
+	if len(multiConfig.Pairs) > 0 {
+		runPairs(multiConfig)
+		return
+	}
+
+	if reverseFrom != "" {
+		startPosition, err := parseBinlogPosition(reverseFrom)
+		if err != nil {
+			errorAndExit(err.Error())
+		}
+
+		config, err = config.Reversed(startPosition)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to reverse config: %v", err))
+		}
+	}
+
+	config.DumpStateOnSignal = dumpStateOnSignal
+
+	if resumeStateFile != "" {
+		store := &ghostferry.FileStateStore{Path: resumeStateFile}
+		config.StateToResumeFrom, err = store.LoadState()
+		if err != nil {
+			errorAndExit(err.Error())
+		}
 	}
 
 	err = config.InitializeAndValidateConfig()
@@ -81,6 +139,20 @@ func main() {
 		errorAndExit(fmt.Sprintf("failed to validate config: %v", err))
 	}
 
+	if config.StatsDAddress != "" {
+		_, err = ghostferry.InitializeStatsDMetrics("copydb", config.Config, nil)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to initialize metrics: %v", err))
+		}
+	}
+
+	if config.Tracing != nil {
+		_, err = ghostferry.InitializeTracing("ghostferry-copydb", config.Tracing)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to initialize tracing: %v", err))
+		}
+	}
+
 	ferry := copydb.NewFerry(config)
 
 	err = ferry.Initialize()
@@ -94,6 +166,107 @@ func main() {
 	}
 
 	if dryrun {
+		// The tables are not created during a dryrun so the schemas cannot be
+		// compared.
+		err = ferry.RunPreflight(false)
+		if err != nil {
+			errorAndExit(err.Error())
+		}
+
+		fmt.Println("exiting due to dryrun")
+		return
+	}
+
+	// The tables were already created by the run being resumed, or by the
+	// run being reversed.
+	if config.StateToResumeFrom == nil && config.ReverseReplication == nil {
+		err = ferry.CreateDatabasesAndTables()
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to create databases and tables: %v", err))
+		}
+	}
+
+	err = ferry.RunPreflight(true)
+	if err != nil {
+		errorAndExit(err.Error())
+	}
+
+	go reloadTunablesOnSignal(ferry, configFilePath)
+
+	ferry.Run()
+	ghostferry.StopAndFlushTracing()
+	ghostferry.StopAndFlushMetrics()
+
+	if ferry.Ferry.IsInterrupted() {
+		stateBytes, err := ferry.Ferry.SerializeState().Dump()
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to dump state: %v", err))
+		}
+
+		fmt.Fprintln(os.Stdout, string(stateBytes))
+		os.Exit(1)
+	}
+}
+
+// Reloads the batch size, the concurrency and the rate limits from the config
+// file on SIGHUP, without restarting the copy.
+func reloadTunablesOnSignal(ferry *copydb.CopydbFerry, configFilePath string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	logger := logrus.WithField("tag", "copydb")
+	for range signals {
+		err := ferry.ReloadTunables(configFilePath)
+		if err != nil {
+			logger.WithError(err).Error("failed to reload the tunable config, keeping the current one")
+		} else {
+			logger.Info("reloaded the tunable config")
+		}
+	}
+}
+
+func runPairs(config *copydb.MultiConfig) {
+	if reverseFrom != "" || resumeStateFile != "" || dumpStateOnSignal {
+		errorAndExit("-reverse-from, -resume-state-file and -dump-state-on-signal are not supported with Pairs")
+	}
+
+	err := config.InitializeAndValidateConfig()
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to validate config: %v", err))
+	}
+
+	if config.StatsDAddress != "" {
+		_, err = ghostferry.InitializeStatsDMetrics("copydb", config.Config.Config, nil)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to initialize metrics: %v", err))
+		}
+	}
+
+	if config.Tracing != nil {
+		_, err = ghostferry.InitializeTracing("ghostferry-copydb", config.Tracing)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to initialize tracing: %v", err))
+		}
+	}
+
+	ferry := copydb.NewMultiFerry(config)
+
+	err = ferry.Initialize()
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to initialize ferry: %v", err))
+	}
+
+	err = ferry.Start()
+	if err != nil {
+		errorAndExit(fmt.Sprintf("failed to start ferry: %v", err))
+	}
+
+	if dryrun {
+		err = ferry.RunPreflight(false)
+		if err != nil {
+			errorAndExit(err.Error())
+		}
+
 		fmt.Println("exiting due to dryrun")
 		return
 	}
@@ -103,5 +276,12 @@ func main() {
 		errorAndExit(fmt.Sprintf("failed to create databases and tables: %v", err))
 	}
 
+	err = ferry.RunPreflight(true)
+	if err != nil {
+		errorAndExit(err.Error())
+	}
+
 	ferry.Run()
+	ghostferry.StopAndFlushTracing()
+	ghostferry.StopAndFlushMetrics()
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
 )
 
 // Whitelisting and blacklisting databases/tables to copy.
@@ -38,12 +39,20 @@ const (
 	VerifierTypeChecksumTable  = "ChecksumTable"
 	VerifierTypeIterative      = "Iterative"
 	VerifierTypeNoVerification = "NoVerification"
+	VerifierTypeRowCount       = "RowCount"
+	VerifierTypeSampling       = "Sampling"
+
+	// Use the verifier plugin selected in Plugins.
+	VerifierTypePlugin = "Plugin"
 )
 
 var validVerifierTypes map[string]struct{} = map[string]struct{}{
 	VerifierTypeChecksumTable:  struct{}{},
 	VerifierTypeIterative:      struct{}{},
 	VerifierTypeNoVerification: struct{}{},
+	VerifierTypeRowCount:       struct{}{},
+	VerifierTypeSampling:       struct{}{},
+	VerifierTypePlugin:         struct{}{},
 }
 
 type Config struct {
@@ -59,7 +68,29 @@ type Config struct {
 	// ChecksumTable
 	// Iterative
 	// NoVerification
+	// RowCount
+	// Sampling
+	// Plugin
 	VerifierType string
+
+	// The percentage of the primary key ranges of each table, or the
+	// number of random rows per table, verified by the Sampling verifier.
+	//
+	// Required if VerifierType is Sampling: one of the two.
+	VerifierSamplePercentage   float64
+	VerifierSampleRowsPerTable int
+
+	// The number of tables checksummed at the same time by the
+	// ChecksumTable verifier.
+	//
+	// Optional: defaults to 1.
+	VerifierChecksumTableConcurrency int
+
+	// Skip the preflight checks that are run before copying. This should only
+	// be used if a check is known to be a false positive for the setup.
+	//
+	// Optional: defaults to false
+	SkipPreflight bool
 }
 
 func (c *Config) InitializeAndValidateConfig() error {
@@ -67,6 +98,42 @@ func (c *Config) InitializeAndValidateConfig() error {
 		return fmt.Errorf("'%s' is not a valid VerifierType", c.VerifierType)
 	}
 
+	if c.VerifierType == VerifierTypePlugin && c.Plugins[ghostferry.PluginKindVerifier] == nil {
+		return fmt.Errorf("a %s plugin must be selected with the %s VerifierType", ghostferry.PluginKindVerifier, VerifierTypePlugin)
+	}
+
+	if c.VerifierChecksumTableConcurrency < 0 {
+		return fmt.Errorf("VerifierChecksumTableConcurrency must not be negative")
+	}
+
+	if c.VerifierType == VerifierTypeSampling && c.VerifierSamplePercentage <= 0 && c.VerifierSampleRowsPerTable <= 0 {
+		return fmt.Errorf("VerifierSamplePercentage or VerifierSampleRowsPerTable must be set with the %s VerifierType", VerifierTypeSampling)
+	}
+
+	if c.PrimaryKeyRemapping != nil && c.VerifierType != VerifierTypeNoVerification {
+		return fmt.Errorf("the %s VerifierType must be used with PrimaryKeyRemapping", VerifierTypeNoVerification)
+	}
+
+	if c.ConvertLatin1ToUtf8mb4 && c.VerifierType == VerifierTypeChecksumTable {
+		return fmt.Errorf("the %s VerifierType cannot be used with ConvertLatin1ToUtf8mb4", VerifierTypeChecksumTable)
+	}
+
+	if len(c.VerifierIgnoredColumns) > 0 && c.VerifierType == VerifierTypeChecksumTable {
+		return fmt.Errorf("the %s VerifierType cannot be used with VerifierIgnoredColumns", VerifierTypeChecksumTable)
+	}
+
+	if c.VerifierNumericComparison != nil && (c.VerifierType == VerifierTypeChecksumTable || c.VerifierType == VerifierTypeSampling) {
+		return fmt.Errorf("the %s VerifierType cannot be used with VerifierNumericComparison", c.VerifierType)
+	}
+
+	if c.VerifierSamplePercentage < 0 || c.VerifierSamplePercentage > 100 {
+		return fmt.Errorf("VerifierSamplePercentage must be between 0 and 100, got %v", c.VerifierSamplePercentage)
+	}
+
+	if c.MaxCutoverDowntime != "" {
+		return fmt.Errorf("MaxCutoverDowntime is not supported by ghostferry-copydb, which does not lock the source")
+	}
+
 	if err := c.Databases.Validate(); err != nil {
 		return err
 	}
@@ -87,5 +154,99 @@ func (c *Config) InitializeAndValidateConfig() error {
 		return err
 	}
 
+	// The builtin verifiers compute the checksums with MySQL functions.
+	// VTGate routes the fingerprints of the IterativeVerifier, which are
+	// selected by primary key, but cannot run CHECKSUM TABLE nor sample the
+	// rows of every shard.
+	if c.TargetDialect == ghostferry.DialectVitess && (c.VerifierType == VerifierTypeChecksumTable || c.VerifierType == VerifierTypeSampling) {
+		return fmt.Errorf("the %s VerifierType is not supported with a %s target", c.VerifierType, c.TargetDialect)
+	}
+
+	if c.TargetDialect == ghostferry.DialectPostgreSQL && (c.VerifierType == VerifierTypeChecksumTable || c.VerifierType == VerifierTypeIterative || c.VerifierType == VerifierTypeSampling) {
+		return fmt.Errorf("the %s VerifierType is not supported with a %s target", c.VerifierType, c.TargetDialect)
+	}
+
 	return nil
 }
+
+// Returns the config of a ferry keeping the source of this config up to date
+// from its target after the cutover, tailing the binlog of the target from
+// startPosition. The source and the target are swapped, and so are the
+// rewrites. See ghostferry.ReverseReplicationConfig.
+func (c *Config) Reversed(startPosition mysql.Position) (*Config, error) {
+	if c.TargetDialect != "" && c.TargetDialect != ghostferry.DialectMySQL {
+		return nil, fmt.Errorf("a %s target cannot be replicated back to the source", c.TargetDialect)
+	}
+
+	if c.PrimaryKeyRemapping != nil {
+		return nil, fmt.Errorf("the remapped primary keys cannot be replicated back to the source")
+	}
+
+	if c.ConvertLatin1ToUtf8mb4 {
+		return nil, fmt.Errorf("the utf8mb4 values converted from latin1 cannot be replicated back to the source")
+	}
+
+	databases, err := c.Databases.reversed()
+	if err != nil {
+		return nil, fmt.Errorf("Databases: %s", err)
+	}
+
+	tables, err := c.Tables.reversed()
+	if err != nil {
+		return nil, fmt.Errorf("Tables: %s", err)
+	}
+
+	ferryConfig := *c.Config
+	ferryConfig.Source, ferryConfig.Target = c.Target, c.Source
+	ferryConfig.ReverseReplication = &ghostferry.ReverseReplicationConfig{
+		StartPosition: startPosition,
+	}
+	ferryConfig.StateToResumeFrom = nil
+
+	// The filters are keyed by the names of the source tables, and every
+	// change made to the new primary must reach the old source.
+	ferryConfig.CopyFilter = nil
+	ferryConfig.EventFilterExpressions = nil
+
+	return &Config{
+		Config:       &ferryConfig,
+		Databases:    databases,
+		Tables:       tables,
+		VerifierType: VerifierTypeNoVerification,
+	}, nil
+}
+
+// Returns the filter and the rewrites of the target names, from the target
+// back to the source.
+func (f FilterAndRewriteConfigs) reversed() (FilterAndRewriteConfigs, error) {
+	reversed := FilterAndRewriteConfigs{
+		Rewrites: make(map[string]string, len(f.Rewrites)),
+	}
+
+	for from, to := range f.Rewrites {
+		if _, exists := reversed.Rewrites[to]; exists {
+			return reversed, fmt.Errorf("more than one name is rewritten to %s", to)
+		}
+		reversed.Rewrites[to] = from
+	}
+
+	rewrite := func(names []string) []string {
+		if names == nil {
+			return nil
+		}
+
+		rewritten := make([]string, len(names))
+		for i, name := range names {
+			if to, exists := f.Rewrites[name]; exists {
+				rewritten[i] = to
+			} else {
+				rewritten[i] = name
+			}
+		}
+		return rewritten
+	}
+
+	reversed.Whitelist = rewrite(f.Whitelist)
+	reversed.Blacklist = rewrite(f.Blacklist)
+	return reversed, nil
+}
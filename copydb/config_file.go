@@ -0,0 +1,164 @@
+package copydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Reads the configuration file into the config, over its default values.
+// Files ending in .yaml or .yml are read as YAML, and the other files as
+// JSON.
+//
+// The ${NAME} references to environment variables in the string values of
+// the file are replaced by their values once the file is parsed, so
+// configurations can be templated, for example from the secrets of a
+// Kubernetes pod. ${NAME:-default} uses the default if the variable is unset
+// or empty, and $${NAME} is replaced by ${NAME}. An error is returned if a
+// variable without a default is unset. The ${ not followed by a variable
+// name and a closing brace are kept as is.
+func DecodeConfigFile(path string, config interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+
+	var value interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &value)
+		if err != nil {
+			return fmt.Errorf("failed to parse YAML: %v", err)
+		}
+		value = yamlToJSONValue(value)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&value)
+		if err != nil {
+			return err
+		}
+	}
+
+	var unset []string
+	value = interpolateEnv(value, &unset)
+	if len(unset) > 0 {
+		return fmt.Errorf("environment variables referenced in config are not set: %s", strings.Join(unset, ", "))
+	}
+
+	data, err = json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return json.NewDecoder(bytes.NewReader(data)).Decode(config)
+}
+
+// Converts the mappings decoded by the YAML parser, whose keys can be of any
+// type, to the objects decoded by the JSON parser.
+func yamlToJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			object[fmt.Sprint(key)] = yamlToJSONValue(nested)
+		}
+		return object
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = yamlToJSONValue(nested)
+		}
+	}
+
+	return value
+}
+
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// Replaces the references to environment variables in the string values,
+// appending the unset variables without a default to unset.
+func interpolateEnv(value interface{}, unset *[]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = interpolateEnv(nested, unset)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = interpolateEnv(nested, unset)
+		}
+	case string:
+		return envReference.ReplaceAllStringFunc(v, func(reference string) string {
+			if strings.HasPrefix(reference, "$$") {
+				return reference[1:]
+			}
+
+			match := envReference.FindStringSubmatch(reference)
+			name, defaultValue := match[1], match[2]
+
+			value := os.Getenv(name)
+			if value == "" && defaultValue != "" {
+				return defaultValue[2:]
+			} else if _, exists := os.LookupEnv(name); !exists {
+				*unset = append(*unset, name)
+			}
+			return value
+		})
+	}
+
+	return value
+}
+
+const redacted = "[REDACTED]"
+
+// Returns the config as indented JSON, with the passwords, the secrets, the
+// tokens, the HTTP headers and the Slack webhook URLs redacted, so it can be
+// printed.
+func RedactedConfig(config interface{}) ([]byte, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(redactSecrets(value, false), "", "  ")
+}
+
+func isSecretKey(key string) bool {
+	lower := strings.ToLower(key)
+	return key == "Pass" || key == "Headers" || key == "WebhookURL" || strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "token")
+}
+
+func redactSecrets(value interface{}, secret bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = redactSecrets(nested, secret || isSecretKey(key))
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactSecrets(nested, secret)
+		}
+	case string:
+		if secret && v != "" {
+			return redacted
+		}
+	}
+
+	return value
+}
@@ -6,6 +6,8 @@ import (
 	"sync"
 
 	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
 	"github.com/sirupsen/logrus"
 )
 
@@ -14,6 +16,11 @@ type CopydbFerry struct {
 	controlServer *ghostferry.ControlServer
 	config        *Config
 	verifier      ghostferry.Verifier
+
+	// The position of the binlog of the target once the source and the
+	// target are identical, from which the target can be replicated back
+	// to the source, see Config.Reversed. Only set once Run returns.
+	TargetPositionAtCutover mysql.Position
 }
 
 func NewFerry(config *Config) *CopydbFerry {
@@ -25,6 +32,9 @@ func NewFerry(config *Config) *CopydbFerry {
 		F:       ferry,
 		Addr:    config.ServerBindAddr,
 		Basedir: config.WebBasedir,
+		Auth:    config.ServerAuth,
+
+		EnableDebug: config.ServerDebugEndpoints,
 	}
 
 	return &CopydbFerry{
@@ -53,43 +63,100 @@ func (this *CopydbFerry) Start() error {
 		return err
 	}
 
-	if this.config.VerifierType == VerifierTypeIterative {
+	this.verifier, err = NewVerifier(this.Ferry, this.config)
+	if err != nil {
+		return err
+	}
+
+	this.controlServer.Verifier = this.verifier
+	return nil
+}
+
+// Creates the verifier of the VerifierType of the config, once the ferry is
+// started. Returns nil if the VerifierType is NoVerification.
+func NewVerifier(ferry *ghostferry.Ferry, config *Config) (ghostferry.Verifier, error) {
+	if config.VerifierType == VerifierTypeIterative {
 		iterativeVerifier := &ghostferry.IterativeVerifier{
 			CursorConfig: &ghostferry.CursorConfig{
-				DB:          this.Ferry.SourceDB,
-				BatchSize:   this.config.DataIterationBatchSize,
-				ReadRetries: this.config.DBReadRetries,
+				DB:              ferry.SourceDB,
+				BatchSize:       config.DataIterationBatchSize,
+				ReadRetries:     config.DBReadRetries,
+				ReadRetryPolicy: config.RetryPolicies.Read,
 			},
-			BinlogStreamer:   this.Ferry.BinlogStreamer,
-			TableSchemaCache: this.Ferry.Tables,
-			Tables:           this.Ferry.Tables.AsSlice(),
-			SourceDB:         this.Ferry.SourceDB,
-			TargetDB:         this.Ferry.TargetDB,
-			Concurrency:      this.config.DataIterationConcurrency,
-			DatabaseRewrites: this.Ferry.Config.DatabaseRewrites,
-			TableRewrites:    this.Ferry.Config.TableRewrites,
+			BinlogStreamer:   ferry.BinlogStreamer,
+			TableSchemaCache: ferry.Tables,
+			Tables:           ferry.Tables.AsSlice(),
+			SourceDB:         ferry.SourceDB,
+			TargetDB:         ferry.TargetDB,
+			Concurrency:      config.DataIterationConcurrency,
+			DatabaseRewrites: ferry.Config.DatabaseRewrites,
+			TableRewrites:    ferry.Config.TableRewrites,
+			TableBatchSizes:  ferry.DataIterator.TableBatchSizes,
+			Pauser:           ferry.Pauser,
+			ReportPanic:      ferry.ReportPanic,
+
+			NormalizeCollations: ferry.Config.VerifierNormalizeCollations,
+			IgnoredColumns:      ferry.Config.VerifierIgnoredColumns,
+			NumericComparison:   ferry.Config.VerifierNumericComparison,
+		}
+
+		if ferry.StateToResumeFrom != nil {
+			iterativeVerifier.StateToResumeFrom = ferry.StateToResumeFrom.IterativeVerifierState
 		}
 
-		err = iterativeVerifier.Initialize()
+		err := iterativeVerifier.Initialize()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		this.verifier = iterativeVerifier
-	} else if this.config.VerifierType == VerifierTypeChecksumTable {
-		this.verifier = &ghostferry.ChecksumTableVerifier{
-			Tables:           this.Ferry.Tables.AsSlice(),
-			SourceDB:         this.Ferry.SourceDB,
-			TargetDB:         this.Ferry.TargetDB,
-			DatabaseRewrites: this.Ferry.Config.DatabaseRewrites,
-			TableRewrites:    this.Ferry.Config.TableRewrites,
+		ferry.QueueDepthMonitor.AddQueue(ghostferry.QueueReverify, iterativeVerifier.ReverifyQueueDepth)
+		iterativeVerifier.AddTableVerifiedListener(ferry.NotifyTableVerified)
+		if ferry.MemoryBudget != nil {
+			ferry.MemoryBudget.AddSource(ghostferry.MemoryVerifier, iterativeVerifier.ReverifyMemoryUsage)
+		}
+		ferry.IterativeVerifier = iterativeVerifier
+
+		return iterativeVerifier, nil
+	} else if config.VerifierType == VerifierTypeChecksumTable {
+		return &ghostferry.ChecksumTableVerifier{
+			Tables:           ferry.Tables.AsSlice(),
+			SourceDB:         ferry.SourceDB,
+			TargetDB:         ferry.TargetDB,
+			DatabaseRewrites: ferry.Config.DatabaseRewrites,
+			TableRewrites:    ferry.Config.TableRewrites,
+			Concurrency:      config.VerifierChecksumTableConcurrency,
+		}, nil
+	} else if config.VerifierType == VerifierTypeRowCount {
+		return &ghostferry.RowCountVerifier{
+			Tables:           ferry.Tables.AsSlice(),
+			SourceDB:         ferry.SourceDB,
+			TargetDB:         ferry.TargetDB,
+			DatabaseRewrites: ferry.Config.DatabaseRewrites,
+			TableRewrites:    ferry.Config.TableRewrites,
+			TargetDialect:    ferry.TargetDialect(),
+		}, nil
+	} else if config.VerifierType == VerifierTypeSampling {
+		return &ghostferry.SamplingVerifier{
+			Tables:           ferry.Tables.AsSlice(),
+			SourceDB:         ferry.SourceDB,
+			TargetDB:         ferry.TargetDB,
+			DatabaseRewrites: ferry.Config.DatabaseRewrites,
+			TableRewrites:    ferry.Config.TableRewrites,
+			SamplePercentage: config.VerifierSamplePercentage,
+			RowsPerTable:     config.VerifierSampleRowsPerTable,
+			Concurrency:      config.DataIterationConcurrency,
+			IgnoredColumns:   ferry.Config.VerifierIgnoredColumns,
+		}, nil
+	} else if config.VerifierType == VerifierTypePlugin {
+		plugin, err := ferry.NewPlugin(ghostferry.PluginKindVerifier)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		this.verifier = nil
+
+		return plugin.(ghostferry.Verifier), nil
 	}
 
-	this.controlServer.Verifier = this.verifier
-	return nil
+	return nil, nil
 }
 
 func (this *CopydbFerry) CreateDatabasesAndTables() error {
@@ -115,9 +182,17 @@ func (this *CopydbFerry) CreateDatabasesAndTables() error {
 	return nil
 }
 
+func (this *CopydbFerry) RunPreflight(compareSchemas bool) error {
+	if this.config.SkipPreflight {
+		logrus.Warn("skipping preflight checks")
+		return nil
+	}
+
+	return this.Ferry.RunPreflight(compareSchemas)
+}
+
 func (this *CopydbFerry) runIterativeVerifierAfterRowCopy() error {
-	err := this.verifier.(*ghostferry.IterativeVerifier).VerifyBeforeCutover()
-	return err
+	return ghostferry.Trace("VerifyBeforeCutover", nil, this.verifier.(*ghostferry.IterativeVerifier).VerifyBeforeCutover)
 }
 
 func (this *CopydbFerry) Run() {
@@ -135,6 +210,19 @@ func (this *CopydbFerry) Run() {
 	// If AutomaticCutover == false, it will pause below the following line
 	this.Ferry.WaitUntilRowCopyIsComplete()
 
+	if this.Ferry.IsInterrupted() {
+		// Wait for the events streamed so far to be written before the state
+		// can be dumped by the caller.
+		copyWG.Wait()
+
+		err := this.controlServer.Shutdown()
+		if err != nil {
+			logrus.WithError(err).Error("failed to shutdown control server")
+		}
+		serverWG.Wait()
+		return
+	}
+
 	// This waits until we're pretty close in the binlog before making the
 	// source readonly. This is to avoid excessive downtime caused by the
 	// binlog streamer catching up.
@@ -150,6 +238,8 @@ func (this *CopydbFerry) Run() {
 	// should be identical.
 	copyWG.Wait()
 
+	this.recordTargetPositionAtCutover()
+
 	// This is where you cutover from using the source database to
 	// using the target database.
 
@@ -157,6 +247,34 @@ func (this *CopydbFerry) Run() {
 	serverWG.Wait()
 }
 
+func (this *CopydbFerry) recordTargetPositionAtCutover() {
+	if this.config.TargetDialect != ghostferry.DialectMySQL {
+		return
+	}
+
+	pos, err := ghostferry.ShowMasterStatusBinlogPosition(this.Ferry.TargetDB)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to read the binlog position of the target, it cannot be replicated back to the source")
+		return
+	}
+
+	this.TargetPositionAtCutover = pos
+	logrus.WithField("position", pos).Info("the target can be replicated back to the source from this position")
+}
+
+// Applies the tunable settings of the config file to the running ferry, see
+// ghostferry.TunableConfig. The settings changed through the control server
+// are replaced by those of the file.
+func (this *CopydbFerry) ReloadTunables(configFilePath string) error {
+	config := &Config{Config: &ghostferry.Config{}}
+	err := DecodeConfigFile(configFilePath, &MultiConfig{Config: config})
+	if err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	return this.Ferry.ApplyTunables(config.Tunables())
+}
+
 func (this *CopydbFerry) ShutdownControlServer() error {
 	return this.controlServer.Shutdown()
 }
@@ -166,12 +284,27 @@ func (this *CopydbFerry) createDatabaseIfExistsOnTarget(database string) error {
 		database = targetDbName
 	}
 
+	if postgres, ok := this.Ferry.TargetDialect().(ghostferry.PostgreSQLDialect); ok {
+		_, err := this.Ferry.TargetDB.Exec(postgres.CreateSchemaStatement(database))
+		return err
+	}
+
+	// The keyspaces of Vitess are created with Vitess, along with their
+	// VSchema, and cannot be created through VTGate.
+	if this.config.TargetDialect == ghostferry.DialectVitess {
+		return nil
+	}
+
 	createDatabaseQuery := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", database)
 	_, err := this.Ferry.TargetDB.Exec(createDatabaseQuery)
 	return err
 }
 
 func (this *CopydbFerry) createTableOnTarget(database, table string) error {
+	if postgres, ok := this.Ferry.TargetDialect().(ghostferry.PostgreSQLDialect); ok {
+		return this.createPostgreSQLTableOnTarget(postgres, database, table)
+	}
+
 	var tableNameAgain, createTableQuery string
 
 	r := this.Ferry.SourceDB.QueryRow(fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", database, table))
@@ -204,6 +337,31 @@ func (this *CopydbFerry) createTableOnTarget(database, table string) error {
 		return fmt.Errorf("no effect on replacing the create table <table> with create table <db>.<table> query on query: %s", createTableQuery)
 	}
 
+	if this.config.ConvertLatin1ToUtf8mb4 {
+		createTableQueryReplaced = ghostferry.ConvertLatin1ToUtf8mb4CreateTable(createTableQueryReplaced)
+	}
+
 	_, err = this.Ferry.TargetDB.Exec(createTableQueryReplaced)
 	return err
 }
+
+// The table is created from the schema loaded from the source, with the
+// types mapped to PostgreSQL types.
+func (this *CopydbFerry) createPostgreSQLTableOnTarget(postgres ghostferry.PostgreSQLDialect, database, table string) error {
+	sourceTable := this.Ferry.Tables.Get(database, table)
+	if sourceTable == nil {
+		return fmt.Errorf("table %s.%s was not loaded from the source", database, table)
+	}
+
+	targetTable := &schema.Table{Schema: database, Name: table}
+	if targetDbName, exists := this.Ferry.DatabaseRewrites[database]; exists {
+		targetTable.Schema = targetDbName
+	}
+
+	if targetTableName, exists := this.Ferry.TableRewrites[table]; exists {
+		targetTable.Name = targetTableName
+	}
+
+	_, err := this.Ferry.TargetDB.Exec(postgres.CreateTableStatement(sourceTable, targetTable))
+	return err
+}
@@ -1,6 +1,8 @@
 package copydb
 
 import (
+	"sync"
+
 	"github.com/siddontang/go-mysql/schema"
 )
 
@@ -10,16 +12,33 @@ type StaticTableFilter struct {
 
 	Tables            []string
 	TablesIsBlacklist bool
+
+	// Dbs and Tables are indexed on first use, as they are matched against
+	// every database and table of the source.
+	indexOnce sync.Once
+	dbSet     map[string]bool
+	tableSet  map[string]bool
 }
 
-func contains(s []string, item string) bool {
-	for _, v := range s {
-		if item == v {
-			return true
-		}
+func stringSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
 	}
 
-	return false
+	return set
+}
+
+func (s *StaticTableFilter) index() {
+	s.indexOnce.Do(func() {
+		s.dbSet = stringSet(s.Dbs)
+		s.tableSet = stringSet(s.Tables)
+	})
+}
+
+func (s *StaticTableFilter) tableIsApplicable(name string) bool {
+	s.index()
+	return s.tableSet[name] != s.TablesIsBlacklist
 }
 
 func NewStaticTableFilter(dbs, tables FilterAndRewriteConfigs) *StaticTableFilter {
@@ -45,18 +64,11 @@ func NewStaticTableFilter(dbs, tables FilterAndRewriteConfigs) *StaticTableFilte
 }
 
 func (s *StaticTableFilter) ApplicableDatabases(dbs []string) ([]string, error) {
+	s.index()
+
 	applicableDbs := make([]string, 0, len(dbs))
 	for _, name := range dbs {
-		var applicable bool
-
-		b := contains(s.Dbs, name)
-		if s.DbsIsBlacklist {
-			applicable = !b
-		} else {
-			applicable = b
-		}
-
-		if applicable {
+		if s.dbSet[name] != s.DbsIsBlacklist {
 			applicableDbs = append(applicableDbs, name)
 		}
 	}
@@ -68,17 +80,21 @@ func (s *StaticTableFilter) ApplicableTables(tables []*schema.Table) ([]*schema.
 	applicableTables := make([]*schema.Table, 0, len(tables))
 
 	for _, tableSchema := range tables {
-		var applicable bool
-
-		b := contains(s.Tables, tableSchema.Name)
-		if s.TablesIsBlacklist {
-			applicable = !b
-		} else {
-			applicable = b
+		if s.tableIsApplicable(tableSchema.Name) {
+			applicableTables = append(applicableTables, tableSchema)
 		}
+	}
 
-		if applicable {
-			applicableTables = append(applicableTables, tableSchema)
+	return applicableTables, nil
+}
+
+// The tables are filtered by name only, so the schemas of the tables that are
+// not copied are never loaded.
+func (s *StaticTableFilter) ApplicableTableNames(db string, tables []string) ([]string, error) {
+	applicableTables := make([]string, 0, len(tables))
+	for _, name := range tables {
+		if s.tableIsApplicable(name) {
+			applicableTables = append(applicableTables, name)
 		}
 	}
 
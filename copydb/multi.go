@@ -0,0 +1,324 @@
+package copydb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/sirupsen/logrus"
+)
+
+// PairConfig is a source and a target copied by a MultiFerry. The options
+// that are not set default to those of the MultiConfig.
+type PairConfig struct {
+	// Identifies the pair in the logs and in the combined status.
+	//
+	// Required: unique across the pairs.
+	Name string
+
+	// Optional: defaults to the Source of the MultiConfig.
+	Source *ghostferry.DatabaseConfig
+
+	// Optional: defaults to the Target of the MultiConfig.
+	Target *ghostferry.DatabaseConfig
+
+	// Optional: default to the Databases and the Tables of the MultiConfig.
+	Databases *FilterAndRewriteConfigs
+	Tables    *FilterAndRewriteConfigs
+
+	// The address of the ControlServer of the pair, through which its
+	// cutover is allowed.
+	//
+	// Required: unique across the pairs.
+	ServerBindAddr string
+
+	// The server id of the replication connection of the pair, which must
+	// be unique across the pairs sharing a source.
+	//
+	// Optional: defaults to the MyServerId of the MultiConfig plus the
+	// index of the pair.
+	MyServerId uint32
+}
+
+// MultiConfig configures the pairs of sources and targets copied by a single
+// ghostferry-copydb process, such as several sources each copied to their
+// own target, or a single source whose tables are split across several
+// targets. The options of the embedded Config are shared by all the pairs.
+type MultiConfig struct {
+	*Config
+
+	// Required
+	Pairs []*PairConfig
+
+	// Throttles all the pairs while the replication lag of the configured
+	// server exceeds the maximum. The pairs are always throttled together:
+	// pausing one of them through its ControlServer pauses all of them.
+	//
+	// Optional: defaults to no throttling on lag.
+	Throttle *ghostferry.LagThrottlerConfig
+
+	pairConfigs []*Config
+}
+
+func (c *MultiConfig) InitializeAndValidateConfig() error {
+	if len(c.Pairs) == 0 {
+		return fmt.Errorf("Pairs must not be empty")
+	}
+
+	if c.StateToResumeFrom != nil || c.ReverseReplication != nil {
+		return fmt.Errorf("Pairs cannot be resumed nor reversed")
+	}
+
+	if c.DeltaOnly != nil {
+		return fmt.Errorf("Pairs cannot be delta only, as the sources have different binlog positions")
+	}
+
+	if c.ServerBindAddr == "" {
+		c.ServerBindAddr = "0.0.0.0:8000"
+	}
+
+	names := make(map[string]bool)
+	addrs := map[string]bool{c.ServerBindAddr: true}
+	c.pairConfigs = make([]*Config, len(c.Pairs))
+
+	for i, pair := range c.Pairs {
+		if pair.Name == "" {
+			return fmt.Errorf("pair %d: Name is required", i)
+		}
+
+		if names[pair.Name] {
+			return fmt.Errorf("pair %s: Name must be unique", pair.Name)
+		}
+		names[pair.Name] = true
+
+		if pair.ServerBindAddr == "" {
+			return fmt.Errorf("pair %s: ServerBindAddr is required", pair.Name)
+		}
+
+		if addrs[pair.ServerBindAddr] {
+			return fmt.Errorf("pair %s: ServerBindAddr %s is already used", pair.Name, pair.ServerBindAddr)
+		}
+		addrs[pair.ServerBindAddr] = true
+
+		config := c.pairConfig(i, pair)
+		if err := config.InitializeAndValidateConfig(); err != nil {
+			return fmt.Errorf("pair %s: %s", pair.Name, err)
+		}
+		c.pairConfigs[i] = config
+	}
+
+	return nil
+}
+
+func (c *MultiConfig) pairConfig(index int, pair *PairConfig) *Config {
+	ferryConfig := *c.Config.Config
+	if pair.Source != nil {
+		ferryConfig.Source = *pair.Source
+	}
+
+	if pair.Target != nil {
+		ferryConfig.Target = *pair.Target
+	}
+
+	ferryConfig.ServerBindAddr = pair.ServerBindAddr
+	ferryConfig.MyServerId = pair.MyServerId
+	if ferryConfig.MyServerId == 0 {
+		ferryConfig.MyServerId = c.MyServerId + uint32(index)
+	}
+
+	config := *c.Config
+	config.Config = &ferryConfig
+	if pair.Databases != nil {
+		config.Databases = *pair.Databases
+	}
+
+	if pair.Tables != nil {
+		config.Tables = *pair.Tables
+	}
+
+	return &config
+}
+
+// Lets the ferries of the pairs use the same throttler, which is run once by
+// the MultiFerry rather than by every ferry.
+type sharedThrottler struct {
+	ghostferry.Throttler
+}
+
+func (t *sharedThrottler) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// The status of a pair, as served by the status server of a MultiFerry.
+type PairStatus struct {
+	Name                string
+	ServerBindAddr      string
+	SourceHostPort      string
+	TargetHostPort      string
+	OverallState        string
+	CompletedTableCount int
+	TotalTableCount     int
+	BinlogStreamerLag   string
+	Throttled           bool
+	VerificationDone    bool
+	DataCorrect         bool
+}
+
+// MultiFerry copies every pair of a MultiConfig with its own CopydbFerry,
+// in the same process, and serves the combined status of the pairs as JSON
+// on the ServerBindAddr of the MultiConfig. A fatal error of any pair
+// aborts the process, as with a single pair.
+type MultiFerry struct {
+	Ferries []*CopydbFerry
+
+	config    *MultiConfig
+	throttler ghostferry.Throttler
+	server    *http.Server
+	logger    *logrus.Entry
+}
+
+func NewMultiFerry(config *MultiConfig) *MultiFerry {
+	ferries := make([]*CopydbFerry, len(config.pairConfigs))
+	for i, pairConfig := range config.pairConfigs {
+		ferries[i] = NewFerry(pairConfig)
+	}
+
+	return &MultiFerry{
+		Ferries: ferries,
+		config:  config,
+	}
+}
+
+func (this *MultiFerry) Initialize() error {
+	this.logger = logrus.WithField("tag", "multi")
+
+	this.throttler = &ghostferry.PauserThrottler{}
+	if this.config.Throttle != nil {
+		var err error
+		this.throttler, err = ghostferry.NewLagThrottler(this.config.Throttle)
+		if err != nil {
+			return fmt.Errorf("failed to create throttler: %v", err)
+		}
+	}
+
+	for i, ferry := range this.Ferries {
+		ferry.Ferry.Throttler = &sharedThrottler{this.throttler}
+
+		err := ferry.Initialize()
+		if err != nil {
+			return fmt.Errorf("pair %s: %v", this.config.Pairs[i].Name, err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/pairs", this.handlePairs)
+	this.server = &http.Server{
+		Addr:    this.config.ServerBindAddr,
+		Handler: mux,
+	}
+
+	return nil
+}
+
+func (this *MultiFerry) Start() error {
+	return this.forEachPair(func(ferry *CopydbFerry) error {
+		return ferry.Start()
+	})
+}
+
+func (this *MultiFerry) CreateDatabasesAndTables() error {
+	return this.forEachPair(func(ferry *CopydbFerry) error {
+		return ferry.CreateDatabasesAndTables()
+	})
+}
+
+func (this *MultiFerry) RunPreflight(compareSchemas bool) error {
+	return this.forEachPair(func(ferry *CopydbFerry) error {
+		return ferry.RunPreflight(compareSchemas)
+	})
+}
+
+func (this *MultiFerry) forEachPair(f func(*CopydbFerry) error) error {
+	for i, ferry := range this.Ferries {
+		err := f(ferry)
+		if err != nil {
+			return fmt.Errorf("pair %s: %v", this.config.Pairs[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Runs all the pairs concurrently, as CopydbFerry.Run, until all of them
+// return.
+func (this *MultiFerry) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		err := this.throttler.Run(ctx)
+		if err != nil {
+			this.logger.WithError(err).Error("throttler failed")
+		}
+	}()
+
+	go func() {
+		this.logger.Infof("serving the status of the pairs on %s", this.server.Addr)
+		err := this.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			this.logger.WithError(err).Error("error on ListenAndServe")
+		}
+	}()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(this.Ferries))
+	for _, ferry := range this.Ferries {
+		go func(ferry *CopydbFerry) {
+			defer wg.Done()
+			ferry.Run()
+		}(ferry)
+	}
+	wg.Wait()
+
+	err := this.server.Shutdown(context.Background())
+	if err != nil {
+		this.logger.WithError(err).Error("failed to shutdown status server")
+	}
+}
+
+// Returns the status of every pair, in the order of the config.
+func (this *MultiFerry) Status() []PairStatus {
+	statuses := make([]PairStatus, len(this.Ferries))
+	for i, ferry := range this.Ferries {
+		status := ghostferry.FetchStatus(ferry.Ferry, ferry.verifier)
+
+		statuses[i] = PairStatus{
+			Name:                this.config.Pairs[i].Name,
+			ServerBindAddr:      this.config.Pairs[i].ServerBindAddr,
+			SourceHostPort:      status.SourceHostPort,
+			TargetHostPort:      status.TargetHostPort,
+			OverallState:        status.OverallState,
+			CompletedTableCount: status.CompletedTableCount,
+			TotalTableCount:     status.TotalTableCount,
+			BinlogStreamerLag:   status.BinlogStreamerLag.String(),
+			Throttled:           status.Throttled,
+			VerificationDone:    status.VerificationDone,
+			DataCorrect:         status.VerificationResult.DataCorrect,
+		}
+	}
+
+	return statuses
+}
+
+func (this *MultiFerry) handlePairs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(this.Status())
+	if err != nil {
+		this.logger.WithError(err).Error("failed to encode status")
+	}
+}
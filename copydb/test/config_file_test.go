@@ -0,0 +1,187 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/copydb"
+	"github.com/stretchr/testify/suite"
+)
+
+const yamlConfig = `
+# The databases to copy.
+Source:
+  Host: source.example.com
+  Port: 3306
+  User: ghostferry
+  Pass: "${GHOSTFERRY_TEST_PASS}"
+
+Target: {Host: "${GHOSTFERRY_TEST_TARGET_HOST:-target.example.com}", Port: 3307}
+
+Databases:
+  Whitelist:
+  - gftest
+  - "other" # with a comment
+  Rewrites:
+    gftest: gftest_renamed
+
+Tables:
+  Blacklist: [table1, 'table 2']
+
+Tracing:
+  Endpoint: http://collector:4318
+  Headers:
+    X-Api-Key: $${not_interpolated}
+
+Pairs:
+  - Name: first
+    Databases:
+      Whitelist: [gftest]
+  - Name: second
+
+VerifierType: Iterative
+AutomaticCutover: true
+DataIterationBatchSize: 1000
+`
+
+type ConfigFileTestSuite struct {
+	suite.Suite
+
+	dir    string
+	config *copydb.MultiConfig
+}
+
+func (this *ConfigFileTestSuite) SetupTest() {
+	var err error
+	this.dir, err = ioutil.TempDir("", "ghostferry-config")
+	this.Require().Nil(err)
+
+	this.config = &copydb.MultiConfig{
+		Config: &copydb.Config{
+			Config: &ghostferry.Config{
+				Source:     ghostferry.DatabaseConfig{Port: 3306, User: "ghostferry"},
+				Target:     ghostferry.DatabaseConfig{Port: 3306, User: "ghostferry"},
+				MyServerId: 99399,
+			},
+		},
+	}
+
+	os.Setenv("GHOSTFERRY_TEST_PASS", "it's secret")
+	os.Unsetenv("GHOSTFERRY_TEST_TARGET_HOST")
+}
+
+func (this *ConfigFileTestSuite) TearDownTest() {
+	os.RemoveAll(this.dir)
+	os.Unsetenv("GHOSTFERRY_TEST_PASS")
+}
+
+func (this *ConfigFileTestSuite) writeFile(name, content string) string {
+	path := filepath.Join(this.dir, name)
+	this.Require().Nil(ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func (this *ConfigFileTestSuite) TestDecodesYamlWithEnvironmentVariables() {
+	err := copydb.DecodeConfigFile(this.writeFile("conf.yaml", yamlConfig), this.config)
+	this.Require().Nil(err)
+
+	this.Require().Equal("source.example.com", this.config.Source.Host)
+	this.Require().Equal(uint16(3306), this.config.Source.Port)
+	this.Require().Equal("it's secret", this.config.Source.Pass)
+	this.Require().Equal("target.example.com", this.config.Target.Host)
+	this.Require().Equal(uint16(3307), this.config.Target.Port)
+	this.Require().Equal("ghostferry", this.config.Target.User)
+
+	this.Require().Equal([]string{"gftest", "other"}, this.config.Databases.Whitelist)
+	this.Require().Equal(map[string]string{"gftest": "gftest_renamed"}, this.config.Databases.Rewrites)
+	this.Require().Equal([]string{"table1", "table 2"}, this.config.Tables.Blacklist)
+
+	this.Require().Equal("http://collector:4318", this.config.Tracing.Endpoint)
+	this.Require().Equal("${not_interpolated}", this.config.Tracing.Headers["X-Api-Key"])
+
+	this.Require().Equal(2, len(this.config.Pairs))
+	this.Require().Equal("first", this.config.Pairs[0].Name)
+	this.Require().Equal([]string{"gftest"}, this.config.Pairs[0].Databases.Whitelist)
+	this.Require().Equal("second", this.config.Pairs[1].Name)
+
+	this.Require().Equal(copydb.VerifierTypeIterative, this.config.VerifierType)
+	this.Require().True(this.config.AutomaticCutover)
+	this.Require().Equal(uint64(1000), this.config.DataIterationBatchSize)
+	this.Require().Equal(uint32(99399), this.config.MyServerId)
+}
+
+func (this *ConfigFileTestSuite) TestDecodesJsonWithEnvironmentVariables() {
+	os.Setenv("GHOSTFERRY_TEST_TARGET_HOST", "target.internal")
+	defer os.Unsetenv("GHOSTFERRY_TEST_TARGET_HOST")
+
+	path := this.writeFile("conf.json", `{"Source": {"Pass": "${GHOSTFERRY_TEST_PASS}"}, "Target": {"Host": "${GHOSTFERRY_TEST_TARGET_HOST:-target}"}}`)
+	err := copydb.DecodeConfigFile(path, this.config)
+	this.Require().Nil(err)
+
+	this.Require().Equal("it's secret", this.config.Source.Pass)
+	this.Require().Equal("target.internal", this.config.Target.Host)
+}
+
+func (this *ConfigFileTestSuite) TestRequiresTheEnvironmentVariables() {
+	path := this.writeFile("conf.json", `{"Source": {"Pass": "${GHOSTFERRY_TEST_UNSET}"}}`)
+	err := copydb.DecodeConfigFile(path, this.config)
+	this.Require().EqualError(err, "environment variables referenced in config are not set: GHOSTFERRY_TEST_UNSET")
+}
+
+func (this *ConfigFileTestSuite) TestInsertsTheValuesAsIs() {
+	os.Setenv("GHOSTFERRY_TEST_PASS", `it's "quoted" \ secret`)
+
+	path := this.writeFile("conf.json", `{"Source": {"Pass": "${GHOSTFERRY_TEST_PASS}"}}`)
+	err := copydb.DecodeConfigFile(path, this.config)
+	this.Require().Nil(err)
+	this.Require().Equal(`it's "quoted" \ secret`, this.config.Source.Pass)
+
+	err = copydb.DecodeConfigFile(this.writeFile("conf.yaml", yamlConfig), this.config)
+	this.Require().Nil(err)
+	this.Require().Equal(`it's "quoted" \ secret`, this.config.Source.Pass)
+}
+
+func (this *ConfigFileTestSuite) TestKeepsTheTextThatIsNotAReference() {
+	path := this.writeFile("conf.json", `{"Source": {"Pass": "a${b c}${"}, "Target": {"Pass": "${1}"}}`)
+	err := copydb.DecodeConfigFile(path, this.config)
+	this.Require().Nil(err)
+	this.Require().Equal("a${b c}${", this.config.Source.Pass)
+	this.Require().Equal("${1}", this.config.Target.Pass)
+}
+
+func (this *ConfigFileTestSuite) TestReportsTheLineOfYamlErrors() {
+	path := this.writeFile("conf.yml", "Source:\n  Host: source\n    Port: 3306\n")
+	err := copydb.DecodeConfigFile(path, this.config)
+	this.Require().EqualError(err, "failed to parse YAML: yaml: line 3: mapping values are not allowed in this context")
+}
+
+func (this *ConfigFileTestSuite) TestDecodesYamlAnchors() {
+	path := this.writeFile("conf.yml", "Source: &db\n  Host: db.example.com\nTarget: *db\n")
+	err := copydb.DecodeConfigFile(path, this.config)
+	this.Require().Nil(err)
+	this.Require().Equal("db.example.com", this.config.Source.Host)
+	this.Require().Equal("db.example.com", this.config.Target.Host)
+}
+
+func (this *ConfigFileTestSuite) TestRedactsSecrets() {
+	err := copydb.DecodeConfigFile(this.writeFile("conf.yaml", yamlConfig), this.config)
+	this.Require().Nil(err)
+
+	redacted, err := copydb.RedactedConfig(this.config)
+	this.Require().Nil(err)
+
+	this.Require().NotContains(string(redacted), "it's secret")
+	this.Require().NotContains(string(redacted), "not_interpolated")
+	this.Require().Contains(string(redacted), `"Pass": "[REDACTED]"`)
+	this.Require().Contains(string(redacted), `"Host": "source.example.com"`)
+
+	// The config itself is not changed.
+	this.Require().Equal("it's secret", this.config.Source.Pass)
+}
+
+func TestConfigFileTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigFileTestSuite))
+}
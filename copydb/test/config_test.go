@@ -0,0 +1,182 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/copydb"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReversedConfigTestSuite struct {
+	suite.Suite
+
+	config *copydb.Config
+}
+
+func (this *ReversedConfigTestSuite) SetupTest() {
+	this.config = &copydb.Config{
+		Config: &ghostferry.Config{
+			Source: ghostferry.DatabaseConfig{Host: "source", Port: 3306, User: "ghostferry"},
+			Target: ghostferry.DatabaseConfig{Host: "target", Port: 3306, User: "ghostferry"},
+
+			MyServerId: 99399,
+		},
+		Databases: copydb.FilterAndRewriteConfigs{
+			Whitelist: []string{"gftest", "other"},
+			Rewrites:  map[string]string{"gftest": "gftest_renamed"},
+		},
+		Tables: copydb.FilterAndRewriteConfigs{
+			Blacklist: []string{"table1"},
+			Rewrites:  map[string]string{"table2": "table2_renamed"},
+		},
+
+		VerifierType: copydb.VerifierTypeIterative,
+	}
+}
+
+func (this *ReversedConfigTestSuite) TestSwapsSourceAndTargetAndRewrites() {
+	startPosition := mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+	reversed, err := this.config.Reversed(startPosition)
+	this.Require().Nil(err)
+
+	this.Require().Equal("target", reversed.Source.Host)
+	this.Require().Equal("source", reversed.Target.Host)
+	this.Require().Equal(startPosition, reversed.ReverseReplication.StartPosition)
+	this.Require().Equal(copydb.VerifierTypeNoVerification, reversed.VerifierType)
+
+	this.Require().Equal([]string{"gftest_renamed", "other"}, reversed.Databases.Whitelist)
+	this.Require().Equal(map[string]string{"gftest_renamed": "gftest"}, reversed.Databases.Rewrites)
+	this.Require().Equal([]string{"table1"}, reversed.Tables.Blacklist)
+	this.Require().Equal(map[string]string{"table2_renamed": "table2"}, reversed.Tables.Rewrites)
+
+	// The original config is left untouched.
+	this.Require().Equal("source", this.config.Source.Host)
+	this.Require().Nil(this.config.ReverseReplication)
+
+	this.Require().Nil(reversed.InitializeAndValidateConfig())
+	this.Require().True(reversed.ContinuousReplication)
+}
+
+func (this *ReversedConfigTestSuite) TestRequiresInvertibleRewrites() {
+	this.config.Tables.Rewrites["table3"] = "table2_renamed"
+	_, err := this.config.Reversed(mysql.Position{Name: "mysql-bin.000002", Pos: 4})
+	this.Require().EqualError(err, "Tables: more than one name is rewritten to table2_renamed")
+}
+
+func (this *ReversedConfigTestSuite) TestRejectsPrimaryKeyRemapping() {
+	this.config.PrimaryKeyRemapping = &ghostferry.PrimaryKeyRemappingConfig{}
+	_, err := this.config.Reversed(mysql.Position{Name: "mysql-bin.000002", Pos: 4})
+	this.Require().EqualError(err, "the remapped primary keys cannot be replicated back to the source")
+}
+
+func (this *ReversedConfigTestSuite) TestRejectsLatin1Conversion() {
+	this.config.ConvertLatin1ToUtf8mb4 = true
+	_, err := this.config.Reversed(mysql.Position{Name: "mysql-bin.000002", Pos: 4})
+	this.Require().EqualError(err, "the utf8mb4 values converted from latin1 cannot be replicated back to the source")
+}
+
+func TestReversedConfigTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, new(ReversedConfigTestSuite))
+}
+
+type MultiConfigTestSuite struct {
+	suite.Suite
+
+	config *copydb.MultiConfig
+}
+
+func (this *MultiConfigTestSuite) SetupTest() {
+	this.config = &copydb.MultiConfig{
+		Config: &copydb.Config{
+			Config: &ghostferry.Config{
+				Source: ghostferry.DatabaseConfig{Host: "source", Port: 3306, User: "ghostferry"},
+				Target: ghostferry.DatabaseConfig{Host: "target", Port: 3306, User: "ghostferry"},
+
+				MyServerId: 99399,
+			},
+			Databases: copydb.FilterAndRewriteConfigs{
+				Whitelist: []string{"gftest"},
+			},
+
+			VerifierType: copydb.VerifierTypeIterative,
+		},
+		Pairs: []*copydb.PairConfig{
+			{
+				Name:           "first",
+				ServerBindAddr: "0.0.0.0:8001",
+				Tables:         &copydb.FilterAndRewriteConfigs{Whitelist: []string{"table1"}},
+			},
+			{
+				Name:           "second",
+				ServerBindAddr: "0.0.0.0:8002",
+				Target:         &ghostferry.DatabaseConfig{Host: "other-target", Port: 3306, User: "ghostferry"},
+				Tables:         &copydb.FilterAndRewriteConfigs{Whitelist: []string{"table2"}},
+				MyServerId:     12345,
+			},
+		},
+	}
+}
+
+func (this *MultiConfigTestSuite) TestAppliesTheOptionsOfThePairs() {
+	this.Require().Nil(this.config.InitializeAndValidateConfig())
+
+	ferries := copydb.NewMultiFerry(this.config).Ferries
+	this.Require().Equal(2, len(ferries))
+
+	first := ferries[0].Ferry.Config
+	this.Require().Equal("source", first.Source.Host)
+	this.Require().Equal("target", first.Target.Host)
+	this.Require().Equal("0.0.0.0:8001", first.ServerBindAddr)
+	this.Require().Equal(uint32(99399), first.MyServerId)
+
+	second := ferries[1].Ferry.Config
+	this.Require().Equal("source", second.Source.Host)
+	this.Require().Equal("other-target", second.Target.Host)
+	this.Require().Equal("0.0.0.0:8002", second.ServerBindAddr)
+	this.Require().Equal(uint32(12345), second.MyServerId)
+
+	// The shared config is left untouched.
+	this.Require().Equal("target", this.config.Target.Host)
+	this.Require().Equal("0.0.0.0:8000", this.config.ServerBindAddr)
+}
+
+func (this *MultiConfigTestSuite) TestDefaultsTheServerIdsToDistinctValues() {
+	this.config.Pairs[1].MyServerId = 0
+	this.Require().Nil(this.config.InitializeAndValidateConfig())
+
+	ferries := copydb.NewMultiFerry(this.config).Ferries
+	this.Require().Equal(uint32(99399), ferries[0].Ferry.Config.MyServerId)
+	this.Require().Equal(uint32(99400), ferries[1].Ferry.Config.MyServerId)
+}
+
+func (this *MultiConfigTestSuite) TestRequiresPairs() {
+	this.config.Pairs = nil
+	this.Require().EqualError(this.config.InitializeAndValidateConfig(), "Pairs must not be empty")
+}
+
+func (this *MultiConfigTestSuite) TestRequiresUniqueNames() {
+	this.config.Pairs[1].Name = "first"
+	this.Require().EqualError(this.config.InitializeAndValidateConfig(), "pair first: Name must be unique")
+}
+
+func (this *MultiConfigTestSuite) TestRequiresDistinctServerBindAddrs() {
+	this.config.Pairs[1].ServerBindAddr = "0.0.0.0:8000"
+	this.Require().EqualError(this.config.InitializeAndValidateConfig(), "pair second: ServerBindAddr 0.0.0.0:8000 is already used")
+}
+
+func (this *MultiConfigTestSuite) TestValidatesTheConfigOfThePairs() {
+	this.config.Pairs[0].Tables = &copydb.FilterAndRewriteConfigs{
+		Whitelist: []string{"table1"},
+		Blacklist: []string{"table2"},
+	}
+	this.Require().EqualError(this.config.InitializeAndValidateConfig(), "pair first: Whitelist and Blacklist cannot both be specified")
+}
+
+func TestMultiConfigTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, new(MultiConfigTestSuite))
+}
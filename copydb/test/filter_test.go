@@ -139,6 +139,10 @@ func (this *FilterTestSuite) assertBothFilters(expected []string, filter copydb.
 	}
 
 	this.Require().Equal(expected, applicableTables)
+
+	applicableTables, err = tableFilter.ApplicableTableNames("db", list)
+	this.Require().Nil(err)
+	this.Require().Equal(expected, applicableTables)
 }
 
 func TestFilter(t *testing.T) {
@@ -0,0 +1,391 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The credentials providers registered by ghostferry.
+const (
+	// Reads the password from an environment variable.
+	//
+	// Options: {"Variable": "MYSQL_PASSWORD"}
+	CredentialsProviderEnv = "env"
+
+	// Reads the password from a file, such as a mounted Kubernetes secret,
+	// whose trailing newline is ignored. The file is read again on every
+	// refresh, so the secret can be rotated.
+	//
+	// Options: {"Path": "/etc/secrets/mysql-password"}
+	CredentialsProviderFile = "file"
+
+	// Reads the password, and optionally the user, from a secret of
+	// HashiCorp Vault, such as a KV secret or the credentials of the
+	// database secrets engine. Address and Token default to VAULT_ADDR and
+	// VAULT_TOKEN, Field to password.
+	//
+	// Options: {"Address": "https://vault:8200", "Token": "...",
+	// "TokenPath": "/var/run/secrets/vault-token", "Namespace": "",
+	// "Path": "secret/data/mysql", "Field": "password", "UserField": ""}
+	CredentialsProviderVault = "vault"
+
+	// Reads the password, and optionally the user, from a secret of AWS
+	// Secrets Manager, which is either a JSON object, such as the secrets
+	// managed by RDS, or the password itself. Region defaults to AWS_REGION,
+	// Field to password. The AWS credentials are only read from
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN: instance
+	// profiles, task roles, web identities and shared credentials files are
+	// not supported, and must be exported to the environment first.
+	//
+	// Options: {"SecretId": "...", "Region": "us-east-1",
+	// "Field": "password", "UserField": "username", "Endpoint": ""}
+	CredentialsProviderAWSSecretsManager = "aws-secrets-manager"
+
+	// Generates RDS IAM authentication tokens, which expire after 15
+	// minutes, from the AWS credentials, as with aws-secrets-manager. The
+	// tokens require TLS, and are not supported for the source, as the
+	// binlog client cannot send them.
+	//
+	// Options: {"Region": "us-east-1"}
+	CredentialsProviderRDSIAM = "rds-iam"
+)
+
+// CredentialsConfig selects where the user and the password of a database
+// are read from, instead of being written in the configuration. The
+// credentials are read again once RefreshInterval has elapsed when a
+// connection is opened, so short-lived credentials, such as RDS IAM tokens,
+// can be used. The connections already open are not affected, as MySQL only
+// authenticates a connection when it is opened.
+type CredentialsConfig struct {
+	// One of the registered providers, see RegisterCredentialsProvider.
+	Provider string
+
+	// Passed as is to the provider, which decodes it.
+	Options json.RawMessage
+
+	// How long the credentials are used before being read again.
+	//
+	// Optional: defaults to 5m.
+	RefreshInterval string
+
+	mutex           sync.Mutex
+	provider        CredentialsProvider
+	refreshInterval time.Duration
+	credentials     *Credentials
+	readAt          time.Time
+}
+
+// The user and password to connect to a database with.
+type Credentials struct {
+	// Optional: defaults to the User of the DatabaseConfig.
+	User     string
+	Password string
+}
+
+// CredentialsProvider reads the credentials of a database from an external
+// store.
+type CredentialsProvider interface {
+	Credentials() (Credentials, error)
+}
+
+// Creates a credentials provider for a database from its options.
+type CredentialsProviderFactory func(config DatabaseConfig, options json.RawMessage) (CredentialsProvider, error)
+
+var (
+	credentialsProvidersMutex sync.RWMutex
+	credentialsProviders      = make(map[string]CredentialsProviderFactory)
+)
+
+func init() {
+	RegisterCredentialsProvider(CredentialsProviderEnv, newEnvCredentialsProvider)
+	RegisterCredentialsProvider(CredentialsProviderFile, newFileCredentialsProvider)
+	RegisterCredentialsProvider(CredentialsProviderVault, newVaultCredentialsProvider)
+	RegisterCredentialsProvider(CredentialsProviderAWSSecretsManager, newAWSSecretsManagerCredentialsProvider)
+	RegisterCredentialsProvider(CredentialsProviderRDSIAM, newRDSIAMCredentialsProvider)
+}
+
+// Registers a credentials provider under a name, usually from the init
+// function of the package implementing it. Like RegisterPlugin, this panics
+// if the name is already registered.
+func RegisterCredentialsProvider(name string, factory CredentialsProviderFactory) {
+	credentialsProvidersMutex.Lock()
+	defer credentialsProvidersMutex.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("ghostferry: nil factory for credentials provider %s", name))
+	}
+
+	if _, exists := credentialsProviders[name]; exists {
+		panic(fmt.Sprintf("ghostferry: credentials provider %s is already registered", name))
+	}
+
+	credentialsProviders[name] = factory
+}
+
+// Returns the sorted names of the registered credentials providers.
+func RegisteredCredentialsProviders() []string {
+	credentialsProvidersMutex.RLock()
+	defer credentialsProvidersMutex.RUnlock()
+
+	names := make([]string, 0, len(credentialsProviders))
+	for name := range credentialsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Creates the provider, which validates its options.
+func (c *CredentialsConfig) initialize(config DatabaseConfig) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.provider != nil {
+		return nil
+	}
+
+	if c.RefreshInterval == "" {
+		c.RefreshInterval = "5m"
+	}
+
+	var err error
+	c.refreshInterval, err = time.ParseDuration(c.RefreshInterval)
+	if err != nil {
+		return fmt.Errorf("invalid RefreshInterval: %v", err)
+	}
+
+	credentialsProvidersMutex.RLock()
+	factory, exists := credentialsProviders[c.Provider]
+	credentialsProvidersMutex.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("credentials provider %s is not registered, must be one of %s", c.Provider, strings.Join(RegisteredCredentialsProviders(), ", "))
+	}
+
+	c.provider, err = factory(config, c.Options)
+	if err != nil {
+		return fmt.Errorf("invalid %s credentials provider options: %v", c.Provider, err)
+	}
+
+	return nil
+}
+
+// Returns the credentials, read again from the provider if RefreshInterval
+// has elapsed. If they cannot be read again, the previous credentials are
+// returned, as they may still be valid.
+func (c *CredentialsConfig) get(config DatabaseConfig) (Credentials, error) {
+	err := c.initialize(config)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.credentials != nil && time.Since(c.readAt) < c.refreshInterval {
+		return *c.credentials, nil
+	}
+
+	credentials, err := c.provider.Credentials()
+	if err != nil {
+		if c.credentials == nil {
+			return Credentials{}, fmt.Errorf("failed to read credentials from %s: %v", c.Provider, err)
+		}
+
+		logrus.WithField("tag", "credentials").WithError(err).WithField("provider", c.Provider).Warn("failed to refresh credentials, using the previous ones")
+		metrics.Count("CredentialsRefreshFailed", 1, []MetricTag{{"provider", c.Provider}}, 1.0)
+		return *c.credentials, nil
+	}
+
+	c.credentials = &credentials
+	c.readAt = time.Now()
+	return credentials, nil
+}
+
+func decodeCredentialsOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	return json.Unmarshal(options, v)
+}
+
+type envCredentialsProvider struct {
+	Variable string
+}
+
+func newEnvCredentialsProvider(config DatabaseConfig, options json.RawMessage) (CredentialsProvider, error) {
+	p := &envCredentialsProvider{}
+	err := decodeCredentialsOptions(options, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Variable == "" {
+		return nil, fmt.Errorf("Variable is required")
+	}
+
+	return p, nil
+}
+
+func (p *envCredentialsProvider) Credentials() (Credentials, error) {
+	password, exists := os.LookupEnv(p.Variable)
+	if !exists {
+		return Credentials{}, fmt.Errorf("environment variable %s is not set", p.Variable)
+	}
+
+	return Credentials{Password: password}, nil
+}
+
+type fileCredentialsProvider struct {
+	Path string
+}
+
+func newFileCredentialsProvider(config DatabaseConfig, options json.RawMessage) (CredentialsProvider, error) {
+	p := &fileCredentialsProvider{}
+	err := decodeCredentialsOptions(options, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Path == "" {
+		return nil, fmt.Errorf("Path is required")
+	}
+
+	return p, nil
+}
+
+func (p *fileCredentialsProvider) Credentials() (Credentials, error) {
+	password, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return Credentials{Password: strings.TrimRight(string(password), "\r\n")}, nil
+}
+
+type vaultCredentialsProvider struct {
+	Address   string
+	Token     string
+	TokenPath string
+	Namespace string
+	Path      string
+	Field     string
+	UserField string
+
+	client *http.Client
+}
+
+func newVaultCredentialsProvider(config DatabaseConfig, options json.RawMessage) (CredentialsProvider, error) {
+	p := &vaultCredentialsProvider{
+		Address: os.Getenv("VAULT_ADDR"),
+		Field:   "password",
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+
+	err := decodeCredentialsOptions(options, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Token == "" && p.TokenPath == "" {
+		p.Token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if p.Namespace == "" {
+		p.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+
+	if p.Address == "" {
+		return nil, fmt.Errorf("Address is required, unless VAULT_ADDR is set")
+	}
+
+	if p.Token == "" && p.TokenPath == "" {
+		return nil, fmt.Errorf("Token or TokenPath is required, unless VAULT_TOKEN is set")
+	}
+
+	if p.Path == "" {
+		return nil, fmt.Errorf("Path is required")
+	}
+
+	return p, nil
+}
+
+func (p *vaultCredentialsProvider) Credentials() (Credentials, error) {
+	token := p.Token
+	if p.TokenPath != "" {
+		// The token file is read every time, as it may be renewed by an
+		// agent.
+		data, err := ioutil.ReadFile(p.TokenPath)
+		if err != nil {
+			return Credentials{}, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	request, err := http.NewRequest("GET", strings.TrimSuffix(p.Address, "/")+"/v1/"+strings.TrimPrefix(p.Path, "/"), nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	request.Header.Set("X-Vault-Token", token)
+	if p.Namespace != "" {
+		request.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("vault returned status %d for %s", response.StatusCode, p.Path)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&secret)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode vault secret: %v", err)
+	}
+
+	// The fields of the KV version 2 secrets are nested in a second data.
+	fields := secret.Data
+	if nested, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, isV1Field := secret.Data[p.Field]; !isV1Field {
+			fields = nested
+		}
+	}
+
+	return credentialsFromFields(fields, p.Field, p.UserField)
+}
+
+// Returns the credentials from the fields of a secret.
+func credentialsFromFields(fields map[string]interface{}, field, userField string) (Credentials, error) {
+	password, ok := fields[field].(string)
+	if !ok {
+		return Credentials{}, fmt.Errorf("secret has no %s string field", field)
+	}
+
+	credentials := Credentials{Password: password}
+	if userField != "" {
+		credentials.User, ok = fields[userField].(string)
+		if !ok {
+			return Credentials{}, fmt.Errorf("secret has no %s string field", userField)
+		}
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,284 @@
+package ghostferry
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// The AWS credentials are read from the environment every time, as they may
+// be short-lived too. Only the environment is read: without the AWS SDK,
+// the rest of the standard credentials chain (shared credentials files, EC2
+// instance profiles, ECS task roles and EKS web identities) is not
+// supported, and its credentials must be exported to the environment.
+func awsCredentialsFromEnv() (awsCredentials, error) {
+	credentials := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if credentials.accessKeyID == "" || credentials.secretAccessKey == "" {
+		return credentials, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	return credentials, nil
+}
+
+func defaultAWSRegion(region string) (string, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return "", fmt.Errorf("Region is required, unless AWS_REGION is set")
+	}
+	return region, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Signs a canonical request with AWS Signature Version 4, returning the
+// scope of the credential and the signature.
+func awsSignature(credentials awsCredentials, region, service string, now time.Time, canonicalRequest string) (scope, signature string) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	scope = strings.Join([]string{date, region, service, "aws4_request"}, "/")
+
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return scope, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// Signs the request in its Authorization header.
+func signAWSRequest(request *http.Request, body []byte, credentials awsCredentials, region, service string, now time.Time) {
+	request.Header.Set("X-Amz-Date", now.UTC().Format("20060102T150405Z"))
+	if credentials.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		path,
+		strings.Replace(request.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope, signature := awsSignature(credentials, region, service, now, canonicalRequest)
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", credentials.accessKeyID, scope, signedHeaders, signature))
+}
+
+type awsSecretsManagerCredentialsProvider struct {
+	SecretId  string
+	Region    string
+	Field     string
+	UserField string
+
+	// Optional: defaults to https://secretsmanager.<region>.amazonaws.com.
+	Endpoint string
+
+	client *http.Client
+}
+
+func newAWSSecretsManagerCredentialsProvider(config DatabaseConfig, options json.RawMessage) (CredentialsProvider, error) {
+	p := &awsSecretsManagerCredentialsProvider{
+		Field:  "password",
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	err := decodeCredentialsOptions(options, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.SecretId == "" {
+		return nil, fmt.Errorf("SecretId is required")
+	}
+
+	p.Region, err = defaultAWSRegion(p.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Endpoint == "" {
+		p.Endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", p.Region)
+	}
+
+	return p, nil
+}
+
+func (p *awsSecretsManagerCredentialsProvider) Credentials() (Credentials, error) {
+	awsCredentials, err := awsCredentialsFromEnv()
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": p.SecretId})
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	request, err := http.NewRequest("POST", strings.TrimSuffix(p.Endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(request, body, awsCredentials, p.Region, "secretsmanager", time.Now())
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+		return Credentials{}, fmt.Errorf("secrets manager returned status %d: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var secret struct {
+		SecretString string
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&secret)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode secret: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(secret.SecretString), &fields) != nil {
+		if p.UserField != "" {
+			return Credentials{}, fmt.Errorf("secret is not a JSON object, so it has no %s field", p.UserField)
+		}
+		return Credentials{Password: secret.SecretString}, nil
+	}
+
+	return credentialsFromFields(fields, p.Field, p.UserField)
+}
+
+type rdsIAMCredentialsProvider struct {
+	Region string
+
+	endpoint string
+	user     string
+}
+
+func newRDSIAMCredentialsProvider(config DatabaseConfig, options json.RawMessage) (CredentialsProvider, error) {
+	p := &rdsIAMCredentialsProvider{
+		endpoint: fmt.Sprintf("%s:%d", config.Host, config.Port),
+		user:     config.User,
+	}
+
+	err := decodeCredentialsOptions(options, p)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Region, err = defaultAWSRegion(p.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.TLS == nil {
+		return nil, fmt.Errorf("TLS is required, as RDS only accepts the tokens over TLS")
+	}
+
+	return p, nil
+}
+
+// Generates an authentication token, which is a URL presigned for 15
+// minutes, without its scheme.
+func (p *rdsIAMCredentialsProvider) Credentials() (Credentials, error) {
+	awsCredentials, err := awsCredentialsFromEnv()
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	now := time.Now()
+	scope, _ := awsSignature(awsCredentials, p.Region, "rds-db", now, "")
+
+	query := url.Values{}
+	query.Set("Action", "connect")
+	query.Set("DBUser", p.user)
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", awsCredentials.accessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.UTC().Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", "900")
+	query.Set("X-Amz-SignedHeaders", "host")
+	if awsCredentials.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", awsCredentials.sessionToken)
+	}
+
+	canonicalQuery := strings.Replace(query.Encode(), "+", "%20", -1)
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		"/",
+		canonicalQuery,
+		"host:" + p.endpoint + "\n",
+		"host",
+		sha256Hex(nil),
+	}, "\n")
+
+	_, signature := awsSignature(awsCredentials, p.Region, "rds-db", now, canonicalRequest)
+	token := fmt.Sprintf("%s/?%s&X-Amz-Signature=%s", p.endpoint, canonicalQuery, signature)
+
+	return Credentials{Password: token}, nil
+}
@@ -3,6 +3,7 @@ package ghostferry
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/siddontang/go-mysql/schema"
@@ -37,6 +38,21 @@ type CursorConfig struct {
 	BuildSelect     func([]string, *schema.Table, uint64, uint64) (squirrel.SelectBuilder, error)
 	BatchSize       uint64
 	ReadRetries     int
+
+	// If set, replaces ReadRetries.
+	ReadRetryPolicy *RetryPolicy
+
+	// If set, BatchSize is only the initial batch size of the table, which
+	// is then adjusted after every batch.
+	BatchSizer *AdaptiveBatchSizer
+
+	// If set, replaces BatchSize from the next batch, so the batch size can
+	// be changed while the tables are iterated. See Ferry.ApplyTunables.
+	SharedBatchSize *SharedBatchSize
+
+	// If set, the rows are read from the transactions of the snapshot
+	// instead of DB, without locking them.
+	Snapshot *SourceSnapshot
 }
 
 // returns a new Cursor with an embedded copy of itself
@@ -59,6 +75,10 @@ func (c *CursorConfig) NewCursorWithoutRowLock(table *schema.Table, maxPk uint64
 	}
 }
 
+func (c *CursorConfig) readRetryPolicy() *RetryPolicy {
+	return retryPolicyOrDefault(c.ReadRetryPolicy, c.ReadRetries)
+}
+
 type Cursor struct {
 	CursorConfig
 
@@ -66,90 +86,189 @@ type Cursor struct {
 	MaxPrimaryKey uint64
 	RowLock       bool
 
+	// The rows with a primary key up to and including this value are
+	// skipped. Used to resume a previously interrupted iteration.
+	StartPrimaryKey uint64
+
+	// If set, only the rows of this partition of the table are iterated.
+	// Ignored if BuildSelect is set.
+	Partition string
+
+	// If set, a slot is acquired from the scheduler for every batch, so that
+	// the batches of the tables iterated concurrently are interleaved
+	// fairly.
+	Scheduler *BatchScheduler
+
+	// If set, the rows are iterated in the order of this secondary index
+	// and then of the primary key, up to MaxPrimaryKey. StartPrimaryKey is
+	// then the primary key of the last row iterated in that order. Ignored
+	// if BuildSelect is set. See Config.DataIterationIndexes.
+	Index *schema.Index
+
 	pkColumn                 *schema.TableColumn
 	lastSuccessfulPrimaryKey uint64
 	logger                   *logrus.Entry
+
+	// The values of the Index columns of the last row iterated, or nil to
+	// start from the first row in the order of the Index.
+	lastSuccessfulIndexKey []interface{}
 }
 
 func (c *Cursor) Each(f func(*RowBatch) error) error {
-	c.lastSuccessfulPrimaryKey = 0
+	c.lastSuccessfulPrimaryKey = c.StartPrimaryKey
 	c.logger = logrus.WithFields(logrus.Fields{
 		"table": c.Table.String(),
 		"tag":   "cursor",
 	})
+	if c.Partition != "" {
+		c.logger = c.logger.WithField("partition", c.Partition)
+	}
 	c.pkColumn = c.Table.GetPKColumn(0)
 
+	// The loaded columns are selected rather than *, which leaves out the
+	// invisible columns and would include the columns added on the source
+	// since the schema was loaded, see remapAlteredColumns.
 	if len(c.ColumnsToSelect) == 0 {
-		c.ColumnsToSelect = []string{"*"}
+		c.ColumnsToSelect = quotedColumnNames(c.Table)
 	}
 
-	for c.lastSuccessfulPrimaryKey < c.MaxPrimaryKey {
-		var tx SqlPreparerAndRollbacker
-		var batch *RowBatch
-		var pkpos uint64
-
-		err := WithRetries(c.ReadRetries, 0, c.logger, "fetch rows", func() (err error) {
-			if c.Throttler != nil {
-				WaitForThrottle(c.Throttler)
-			}
+	if c.iteratesIndex() && c.StartPrimaryKey > 0 {
+		err := c.loadStartIndexKey()
+		if err != nil {
+			return err
+		}
+	}
 
-			// Only need to use a transaction if RowLock == true. Otherwise
-			// we'd be wasting two extra round trips per batch, doing
-			// essentially a no-op.
-			if c.RowLock {
-				tx, err = c.DB.Begin()
-				if err != nil {
-					return err
-				}
-			} else {
-				tx = &SqlDBWithFakeRollback{c.DB}
-			}
+	// The primary keys do not grow in the order of the Index, so the
+	// iteration only ends once no row is left.
+	for c.lastSuccessfulPrimaryKey < c.MaxPrimaryKey || (c.iteratesIndex() && c.MaxPrimaryKey > 0) {
+		if c.Scheduler != nil {
+			c.Scheduler.Acquire(c.Table.String())
+		}
 
-			batch, pkpos, err = c.Fetch(tx)
-			if err == nil {
-				return nil
-			}
+		done, err := c.eachBatch(f)
 
-			tx.Rollback()
-			return err
-		})
+		if c.Scheduler != nil {
+			c.Scheduler.Release(c.Table.String())
+		}
 
 		if err != nil {
 			return err
 		}
 
-		if batch.Size() == 0 {
-			tx.Rollback()
-			c.logger.Debug("did not reach max primary key, but the table is complete as there are no more rows")
+		if done {
 			break
 		}
+	}
 
-		if pkpos <= c.lastSuccessfulPrimaryKey {
-			tx.Rollback()
-			err = fmt.Errorf("new pkpos %d <= lastSuccessfulPk %d", pkpos, c.lastSuccessfulPrimaryKey)
-			c.logger.WithError(err).Errorf("last successful pk position did not advance")
-			return err
+	return nil
+}
+
+// Fetches and processes a single batch. Returns true if there are no more
+// rows to iterate.
+func (c *Cursor) eachBatch(f func(*RowBatch) error) (done bool, err error) {
+	span := StartSpan("Cursor.Batch", []MetricTag{{"table", c.Table.String()}})
+	defer func() {
+		span.End(err)
+	}()
+
+	var tx SqlPreparerAndRollbacker
+	var batch *RowBatch
+	var pkpos uint64
+	var indexKey []interface{}
+	var start time.Time
+
+	if c.SharedBatchSize != nil {
+		c.BatchSize = c.SharedBatchSize.Get()
+	}
+
+	if c.BatchSizer != nil {
+		c.BatchSize = c.BatchSizer.BatchSize(c.Table.String(), c.BatchSize)
+	}
+
+	err = c.readRetryPolicy().Do(nil, c.logger, "fetch rows", func() (err error) {
+		if c.Throttler != nil {
+			WaitForThrottle(c.Throttler)
 		}
 
-		err = f(batch)
-		if err != nil {
-			tx.Rollback()
-			c.logger.WithError(err).Error("failed to call each callback")
-			return err
+		start = time.Now()
+
+		// Only need to use a transaction if RowLock == true. Otherwise
+		// we'd be wasting two extra round trips per batch, doing
+		// essentially a no-op.
+		if c.Snapshot != nil {
+			tx = c.Snapshot.acquire()
+		} else if c.RowLock {
+			tx, err = c.DB.Begin()
+			if err != nil {
+				return err
+			}
+		} else {
+			tx = &SqlDBWithFakeRollback{c.DB}
+		}
+
+		batch, pkpos, indexKey, err = c.fetch(tx)
+		if err == nil {
+			return nil
 		}
 
 		tx.Rollback()
+		return err
+	})
 
-		c.lastSuccessfulPrimaryKey = pkpos
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	if batch.Size() == 0 {
+		tx.Rollback()
+		c.logger.Debug("did not reach max primary key, but the table is complete as there are no more rows")
+		return true, nil
+	}
+
+	if pkpos <= c.lastSuccessfulPrimaryKey && !c.iteratesIndex() {
+		tx.Rollback()
+		err = fmt.Errorf("new pkpos %d <= lastSuccessfulPk %d", pkpos, c.lastSuccessfulPrimaryKey)
+		c.logger.WithError(err).Errorf("last successful pk position did not advance")
+		return false, err
+	}
+
+	err = f(batch)
+	if err != nil {
+		tx.Rollback()
+		c.logger.WithError(err).Error("failed to call each callback")
+		return false, err
+	}
+
+	tx.Rollback()
+
+	// The duration covers both the read and the write of the batch, during
+	// which the rows stay locked on the source.
+	if c.BatchSizer != nil {
+		c.BatchSizer.Observe(c.Table.String(), c.BatchSize, batch.Size(), uint64(rowBatchSize(batch)), time.Since(start))
+		if c.BatchSizer.ObserveLargestRow(c.Table.String(), uint64(largestRowSize(batch))) {
+			c.logger.Debug("batch has a large row, reading the next rows one at a time")
+		}
+	}
+
+	c.lastSuccessfulPrimaryKey = pkpos
+	c.lastSuccessfulIndexKey = indexKey
+	return false, nil
 }
 
 func (c *Cursor) Fetch(db SqlPreparer) (batch *RowBatch, pkpos uint64, err error) {
+	batch, pkpos, _, err = c.fetch(db)
+	return
+}
+
+// Same as Fetch, also returning the values of the Index columns of the last
+// row if the rows are iterated in the order of the Index.
+func (c *Cursor) fetch(db SqlPreparer) (batch *RowBatch, pkpos uint64, indexKey []interface{}, err error) {
 	var selectBuilder squirrel.SelectBuilder
 
-	if c.BuildSelect != nil {
+	if c.iteratesIndex() {
+		selectBuilder = c.indexSelect()
+	} else if c.BuildSelect != nil {
 		selectBuilder, err = c.BuildSelect(c.ColumnsToSelect, c.Table, c.lastSuccessfulPrimaryKey, c.BatchSize)
 		if err != nil {
 			c.logger.WithError(err).Error("failed to apply filter for select")
@@ -157,9 +276,13 @@ func (c *Cursor) Fetch(db SqlPreparer) (batch *RowBatch, pkpos uint64, err error
 		}
 	} else {
 		selectBuilder = DefaultBuildSelect(c.ColumnsToSelect, c.Table, c.lastSuccessfulPrimaryKey, c.BatchSize)
+		if c.Partition != "" {
+			selectBuilder = selectBuilder.From(fmt.Sprintf("%s PARTITION (%s)", QuotedTableName(c.Table), quoteField(c.Partition)))
+		}
 	}
 
-	if c.RowLock {
+	// A locking read would read the latest rows instead of the snapshot.
+	if c.RowLock && c.Snapshot == nil {
 		selectBuilder = selectBuilder.Suffix("FOR UPDATE")
 	}
 
@@ -237,11 +360,19 @@ func (c *Cursor) Fetch(db SqlPreparer) (batch *RowBatch, pkpos uint64, err error
 			logger.WithError(err).Error("failed to get uint64 pk value")
 			return
 		}
+
+		if c.iteratesIndex() {
+			indexKey, err = c.indexKey(columns, batchData[len(batchData)-1])
+			if err != nil {
+				logger.WithError(err).Error("failed to get index key")
+				return
+			}
+		}
 	}
 
 	batch = NewRowBatch(c.Table, batchData, pkIndex)
 
-	logger.Debugf("found %d rows", batch.Size())
+	LogWithPkRange(logger, c.lastSuccessfulPrimaryKey, pkpos).WithField("rows", batch.Size()).Debug("fetched batch")
 
 	return
 }
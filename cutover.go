@@ -0,0 +1,133 @@
+package ghostferry
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CutoverAbortedError is returned by RunCutoverSteps when a step of the
+// cutover did not complete within Config.MaxCutoverDowntime.
+type CutoverAbortedError struct {
+	Step        string
+	MaxDowntime time.Duration
+}
+
+func (e CutoverAbortedError) Error() string {
+	return fmt.Sprintf("cutover aborted as %s did not complete within the MaxCutoverDowntime of %s", e.Step, e.MaxDowntime)
+}
+
+// A step of the cutover, run while the source is locked.
+type CutoverStep struct {
+	Name string
+	Run  func() error
+}
+
+// Waits until the events written to the binlog of the source so far are
+// written to the target, without stopping the binlog streaming, unlike
+// FlushBinlogAndStopStreaming. The source must not be written to anymore,
+// so the binlog streaming can still stop at the same position afterwards,
+// or keep going if the cutover is aborted.
+func (f *Ferry) DrainBinlog() error {
+	if f.WaitUntilReplicaIsCaughtUpToMaster != nil {
+		f.WaitUntilReplicaIsCaughtUpToMaster.ReplicaDB = f.SourceDB
+		err := f.WaitUntilReplicaIsCaughtUpToMaster.Wait()
+		if err != nil {
+			return err
+		}
+	}
+
+	target, err := ShowMasterStatusBinlogPosition(f.SourceDB)
+	if err != nil {
+		return fmt.Errorf("failed to read the binlog position of the source: %v", err)
+	}
+
+	LogWithBinlogPosition(f.logger, target).Info("draining the binlog up to the current position of the source")
+	for f.BinlogStreamer.GetLastStreamedBinlogPosition().Compare(target) < 0 || f.BinlogWriter.PendingEvents() > 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// Runs the steps of the cutover in order, such as DrainBinlog and the
+// verification of the target, stopping at the first error. The steps must
+// complete within Config.MaxCutoverDowntime of lockedAt, if it is set.
+// Otherwise unlock is called right away to end the downtime, the running
+// step is waited for, as it cannot be cancelled, and a CutoverAbortedError
+// is returned. The binlog streaming must not have been stopped by the steps,
+// so the cutover can be retried with WaitForCutoverRetry.
+func (f *Ferry) RunCutoverSteps(lockedAt time.Time, unlock func() error, steps []CutoverStep) error {
+	var deadline <-chan time.Time
+	var maxDowntime time.Duration
+	if f.Config.MaxCutoverDowntime != "" {
+		maxDowntime, _ = time.ParseDuration(f.Config.MaxCutoverDowntime)
+		timer := time.NewTimer(maxDowntime - time.Since(lockedAt))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	logger := logrus.WithField("tag", "cutover")
+	for _, step := range steps {
+		done := make(chan error, 1)
+		go func(step CutoverStep) {
+			done <- step.Run()
+		}(step)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-deadline:
+			aborted := CutoverAbortedError{Step: step.Name, MaxDowntime: maxDowntime}
+			logger.WithField("step", step.Name).WithError(aborted).Error("cutover is taking too long, unlocking the source")
+			metrics.Count("CutoverAborted", 1, []MetricTag{{"step", step.Name}}, 1.0)
+
+			err := unlock()
+			if err != nil {
+				return fmt.Errorf("%v, but unlocking the source failed: %v", aborted, err)
+			}
+
+			<-done
+			f.Notify(NotificationCutoverAborted, aborted.Error())
+			return aborted
+		}
+	}
+
+	return nil
+}
+
+// Waits for the cutover to be retried after it was aborted, after
+// Config.CutoverRetryInterval, or once AutomaticCutover is set again, such as
+// from the ControlServer. Returns false if the run was interrupted instead.
+func (f *Ferry) WaitForCutoverRetry() bool {
+	f.setState(StateWaitingForCutover)
+
+	if f.Config.CutoverRetryInterval != "" {
+		interval, _ := time.ParseDuration(f.Config.CutoverRetryInterval)
+		f.logger.WithField("interval", interval).Info("retrying the cutover after the interval")
+
+		select {
+		case <-time.After(interval):
+		case <-f.interruptedCh:
+		}
+	} else {
+		f.AutomaticCutover = false
+		f.logger.Info("waiting for AutomaticCutover to be set again to retry the cutover")
+
+		for !f.AutomaticCutover && !f.IsInterrupted() {
+			time.Sleep(1 * time.Second)
+		}
+	}
+
+	if f.IsInterrupted() {
+		f.logger.Info("ferry interrupted, not retrying the cutover")
+		return false
+	}
+
+	f.logger.Info("retrying the cutover")
+	f.setState(StateCutover)
+	return true
+}
@@ -3,13 +3,27 @@ package ghostferry
 import (
 	"container/ring"
 	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/schema"
 	"github.com/sirupsen/logrus"
 )
 
+var errDataIteratorStopped = errors.New("data iterator stop requested")
+
+const (
+	TableOrderAlphabetical = "alphabetical"
+	TableOrderLargestFirst = "largest-first"
+	TableOrderExplicit     = "explicit"
+)
+
 type PKPositionLog struct {
 	Position uint64
 	At       time.Time
@@ -24,6 +38,16 @@ type DataIteratorState struct {
 	completedTables           map[string]bool
 	copySpeedLog              *ring.Ring
 
+	// The source binlog positions at which the tables matched by full rows
+	// were copied, see IsFullRowMatchTable. Guarded by tablesMutex.
+	fullRowMatchTablesCopiedAt map[string]mysql.Position
+
+	// The progress of the tables iterated by partition, keyed by table and
+	// then by partition. Guarded by successfulPkMutex and tablesMutex
+	// respectively.
+	partitionPrimaryKeys map[string]map[string]uint64
+	completedPartitions  map[string]map[string]bool
+
 	targetPkMutex     *sync.RWMutex
 	successfulPkMutex *sync.RWMutex
 	tablesMutex       *sync.RWMutex
@@ -49,6 +73,40 @@ func newDataIteratorState(tableIteratorCount int) *DataIteratorState {
 		targetPkMutex:             &sync.RWMutex{},
 		successfulPkMutex:         &sync.RWMutex{},
 		tablesMutex:               &sync.RWMutex{},
+
+		fullRowMatchTablesCopiedAt: make(map[string]mysql.Position),
+		partitionPrimaryKeys:       make(map[string]map[string]uint64),
+		completedPartitions:        make(map[string]map[string]bool),
+	}
+}
+
+// Restores the progress of an interrupted run. Must be called before the
+// DataIterator is run.
+func (this *DataIteratorState) restore(lastSuccessfulPrimaryKeys map[string]uint64, completedTables map[string]bool) {
+	for table, pk := range lastSuccessfulPrimaryKeys {
+		this.lastSuccessfulPrimaryKeys[table] = pk
+	}
+
+	for table, completed := range completedTables {
+		this.completedTables[table] = completed
+	}
+}
+
+// Restores the progress of the partitions of an interrupted run. Must be
+// called before the DataIterator is run.
+func (this *DataIteratorState) restorePartitions(lastSuccessfulPrimaryKeys map[string]map[string]uint64, completedPartitions map[string]map[string]bool) {
+	for table, partitions := range lastSuccessfulPrimaryKeys {
+		for partition, pk := range partitions {
+			this.setPartitionPK(table, partition, pk)
+		}
+	}
+
+	for table, partitions := range completedPartitions {
+		for partition, completed := range partitions {
+			if completed {
+				this.MarkPartitionAsCompleted(table, partition)
+			}
+		}
 	}
 }
 
@@ -65,7 +123,46 @@ func (this *DataIteratorState) UpdateLastSuccessfulPK(table string, pk uint64) {
 
 	deltaPK := pk - this.lastSuccessfulPrimaryKeys[table]
 	this.lastSuccessfulPrimaryKeys[table] = pk
+	this.logCopySpeed(deltaPK)
+}
+
+// Same as UpdateLastSuccessfulPK, for a partition of a table iterated by
+// partition.
+func (this *DataIteratorState) UpdateLastSuccessfulPartitionPK(table, partition string, pk uint64) {
+	this.successfulPkMutex.Lock()
+	defer this.successfulPkMutex.Unlock()
 
+	deltaPK := pk - this.partitionPrimaryKeys[table][partition]
+	this.setPartitionPK(table, partition, pk)
+	this.logCopySpeed(deltaPK)
+}
+
+// Same as UpdateLastSuccessfulPK and UpdateLastSuccessfulPartitionPK, for a
+// table iterated in the order of a secondary index, see
+// Config.DataIterationIndexes. The primary keys do not grow in that order,
+// so the copy speed is logged with the number of rows copied instead.
+func (this *DataIteratorState) UpdateLastSuccessfulIndexPK(table, partition string, pk uint64, rows int) {
+	this.successfulPkMutex.Lock()
+	defer this.successfulPkMutex.Unlock()
+
+	if partition != "" {
+		this.setPartitionPK(table, partition, pk)
+	} else {
+		this.lastSuccessfulPrimaryKeys[table] = pk
+	}
+	this.logCopySpeed(uint64(rows))
+}
+
+// Must be called with the successfulPkMutex held.
+func (this *DataIteratorState) setPartitionPK(table, partition string, pk uint64) {
+	if this.partitionPrimaryKeys[table] == nil {
+		this.partitionPrimaryKeys[table] = make(map[string]uint64)
+	}
+	this.partitionPrimaryKeys[table][partition] = pk
+}
+
+// Must be called with the successfulPkMutex held.
+func (this *DataIteratorState) logCopySpeed(deltaPK uint64) {
 	currentTotalPK := this.copySpeedLog.Value.(PKPositionLog).Position
 	this.copySpeedLog = this.copySpeedLog.Next()
 	this.copySpeedLog.Value = PKPositionLog{
@@ -81,6 +178,51 @@ func (this *DataIteratorState) MarkTableAsCompleted(table string) {
 	this.completedTables[table] = true
 }
 
+func (this *DataIteratorState) MarkPartitionAsCompleted(table, partition string) {
+	this.tablesMutex.Lock()
+	defer this.tablesMutex.Unlock()
+
+	if this.completedPartitions[table] == nil {
+		this.completedPartitions[table] = make(map[string]bool)
+	}
+	this.completedPartitions[table][partition] = true
+}
+
+func (this *DataIteratorState) TargetPK(table string) uint64 {
+	this.targetPkMutex.RLock()
+	defer this.targetPkMutex.RUnlock()
+
+	return this.targetPrimaryKeys[table]
+}
+
+func (this *DataIteratorState) LastSuccessfulPK(table string) uint64 {
+	this.successfulPkMutex.RLock()
+	defer this.successfulPkMutex.RUnlock()
+
+	return this.lastSuccessfulPrimaryKeys[table]
+}
+
+func (this *DataIteratorState) LastSuccessfulPartitionPK(table, partition string) uint64 {
+	this.successfulPkMutex.RLock()
+	defer this.successfulPkMutex.RUnlock()
+
+	return this.partitionPrimaryKeys[table][partition]
+}
+
+func (this *DataIteratorState) IsPartitionCompleted(table, partition string) bool {
+	this.tablesMutex.RLock()
+	defer this.tablesMutex.RUnlock()
+
+	return this.completedPartitions[table][partition]
+}
+
+func (this *DataIteratorState) IsTableCompleted(table string) bool {
+	this.tablesMutex.RLock()
+	defer this.tablesMutex.RUnlock()
+
+	return this.completedTables[table]
+}
+
 func (this *DataIteratorState) TargetPrimaryKeys() map[string]uint64 {
 	this.targetPkMutex.RLock()
 	defer this.targetPkMutex.RUnlock()
@@ -117,6 +259,95 @@ func (this *DataIteratorState) CompletedTables() map[string]bool {
 	return m
 }
 
+// Same as LastSuccessfulPrimaryKeys, without the completed tables. The
+// position within a completed table is not needed to resume the copy, which
+// keeps the state of runs with many tables small.
+func (this *DataIteratorState) ResumablePrimaryKeys() map[string]uint64 {
+	this.tablesMutex.RLock()
+	defer this.tablesMutex.RUnlock()
+	this.successfulPkMutex.RLock()
+	defer this.successfulPkMutex.RUnlock()
+
+	m := make(map[string]uint64)
+	for k, v := range this.lastSuccessfulPrimaryKeys {
+		if !this.completedTables[k] {
+			m[k] = v
+		}
+	}
+
+	return m
+}
+
+// Same as ResumablePrimaryKeys, for the partitions of the tables iterated by
+// partition.
+func (this *DataIteratorState) ResumablePartitionPrimaryKeys() map[string]map[string]uint64 {
+	this.tablesMutex.RLock()
+	defer this.tablesMutex.RUnlock()
+	this.successfulPkMutex.RLock()
+	defer this.successfulPkMutex.RUnlock()
+
+	m := make(map[string]map[string]uint64)
+	for table, partitions := range this.partitionPrimaryKeys {
+		if this.completedTables[table] {
+			continue
+		}
+
+		m[table] = make(map[string]uint64)
+		for partition, pk := range partitions {
+			if !this.completedPartitions[table][partition] {
+				m[table][partition] = pk
+			}
+		}
+	}
+
+	return m
+}
+
+// The completed partitions of the tables that are not completed yet.
+func (this *DataIteratorState) ResumableCompletedPartitions() map[string]map[string]bool {
+	this.tablesMutex.RLock()
+	defer this.tablesMutex.RUnlock()
+
+	m := make(map[string]map[string]bool)
+	for table, partitions := range this.completedPartitions {
+		if this.completedTables[table] {
+			continue
+		}
+
+		m[table] = make(map[string]bool)
+		for partition, completed := range partitions {
+			m[table][partition] = completed
+		}
+	}
+
+	return m
+}
+
+// Returns the sums of the primary keys copied so far and of the target
+// primary keys of all the tables, which are a rough measure of the progress
+// of the copy. The tables completed by a previous run count as copied, as
+// their position is not kept in the state, see ResumablePrimaryKeys.
+func (this *DataIteratorState) CopyProgress() (uint64, uint64) {
+	// The maps are copied to give the locks back ASAP. It's not supposed
+	// to be that accurate anyway.
+	targetPKs := this.TargetPrimaryKeys()
+	lastSuccessfulPKs := this.LastSuccessfulPrimaryKeys()
+	completedTables := this.CompletedTables()
+
+	var copied, total uint64
+	for table, targetPK := range targetPKs {
+		total += targetPK
+
+		if completedTables[table] || lastSuccessfulPKs[table] > targetPK {
+			copied += targetPK
+		} else {
+			copied += lastSuccessfulPKs[table]
+		}
+	}
+
+	return copied, total
+}
+
 func (this *DataIteratorState) EstimatedPKProcessedPerSecond() float64 {
 	this.successfulPkMutex.RLock()
 	defer this.successfulPkMutex.RUnlock()
@@ -148,22 +379,90 @@ type DataIterator struct {
 
 	CurrentState *DataIteratorState
 
-	batchListeners []func(*RowBatch) error
-	doneListeners  []func() error
-	logger         *logrus.Entry
+	// Hands out the Concurrency batch slots fairly between the tables. The
+	// table weights can be changed while iterating.
+	//
+	// Optional: defaults to a scheduler with the same weight for all tables.
+	Scheduler *BatchScheduler
+
+	// The number of tables iterated at the same time, in TableOrder. See
+	// Config.DataIterationTableConcurrency.
+	//
+	// Optional: defaults to twice the Concurrency.
+	TableConcurrency int
+	TableOrder       string
+	TableOrderList   []string
+
+	// Per table overrides of CursorConfig.BatchSize.
+	TableBatchSizes map[string]uint64
+
+	// Iterates the partitioned tables partition by partition, see
+	// Config.DataIterationByPartition.
+	ByPartition bool
+
+	// The secondary indexes the tables are iterated in the order of, by
+	// full table name, see Config.DataIterationIndexes.
+	Indexes map[string]string
+
+	// The tables referenced by the foreign keys of each table, by full
+	// table name, see ForeignKeyDependencies. A table is only iterated once
+	// the tables it references are completed. See Config.ForeignKeyCopyMode.
+	TableDependencies map[string][]string
+
+	// If set, the batches are accounted while they are written, and the
+	// next batch of a table is only read once the budget allows it.
+	MemoryBudget *MemoryBudget
+
+	// If set, the next batch is only read while the copy is not paused.
+	Pauser *ComponentPauser
+
+	// If set, deferred in the goroutines iterating the tables, such as
+	// Ferry.ReportPanic, so the panics of the iteration and of the batch
+	// listeners are reported.
+	ReportPanic func()
+
+	batchListeners                  []func(*RowBatch) error
+	tableDoneListeners              []func(*schema.Table) error
+	fullRowMatchTableStartListeners []func(*schema.Table) error
+	doneListeners                   []func() error
+	logger                          *logrus.Entry
+
+	stopRequested int32
 }
 
 func (d *DataIterator) Initialize() error {
 	d.logger = logrus.WithField("tag", "data_iterator")
 	d.CurrentState = newDataIteratorState(d.Concurrency)
 
+	if d.Scheduler == nil {
+		d.Scheduler = NewBatchScheduler(d.Concurrency)
+	}
+
+	if d.ReportPanic == nil {
+		d.ReportPanic = func() {}
+	}
+
+	if d.CursorConfig != nil && d.CursorConfig.SharedBatchSize == nil {
+		d.CursorConfig.SharedBatchSize = NewSharedBatchSize(d.CursorConfig.BatchSize)
+	}
+
 	return nil
 }
 
 func (d *DataIterator) Run() {
 	d.logger.WithField("tablesCount", len(d.Tables)).Info("starting data iterator run")
 
-	tablesWithData, emptyTables, err := MaxPrimaryKeys(d.DB, d.Tables, d.logger)
+	keyedTables := make([]*schema.Table, 0, len(d.Tables))
+	fullRowMatchTables := make([]*schema.Table, 0)
+	for _, table := range d.Tables {
+		if IsFullRowMatchTable(table) {
+			fullRowMatchTables = append(fullRowMatchTables, table)
+		} else {
+			keyedTables = append(keyedTables, table)
+		}
+	}
+
+	tablesWithData, emptyTables, err := MaxPrimaryKeys(d.DB, keyedTables, d.logger)
 	if err != nil {
 		d.ErrorHandler.Fatal("data_iterator", err)
 		return
@@ -177,59 +476,86 @@ func (d *DataIterator) Run() {
 		d.CurrentState.UpdateTargetPK(table.String(), maxPk)
 	}
 
-	tablesQueue := make(chan *schema.Table)
+	pendingTables := make([]*schema.Table, 0, len(tablesWithData))
+	for table, _ := range tablesWithData {
+		if !d.CurrentState.IsTableCompleted(table.String()) {
+			pendingTables = append(pendingTables, table)
+		}
+	}
+
+	sortTablesForIteration(pendingTables, tablesWithData, d.TableOrder, d.TableOrderList)
+
+	iterations, err := d.tableIterations(pendingTables)
+	if err != nil {
+		d.ErrorHandler.Fatal("data_iterator", err)
+		return
+	}
+
+	if len(d.TableDependencies) > 0 {
+		iterations, err = d.orderIterationsByDependencies(iterations)
+		if err != nil {
+			d.ErrorHandler.Fatal("data_iterator", err)
+			return
+		}
+	}
+
+	// The number of partitions left to iterate of the tables iterated by
+	// partition, which are completed once all of their partitions are.
+	remainingPartitions := make(map[string]int)
+	remainingPartitionsMutex := &sync.Mutex{}
+	for _, iteration := range iterations {
+		if iteration.partition != "" {
+			remainingPartitions[iteration.table.String()]++
+		}
+	}
+
+	// Up to TableConcurrency tables are iterated at the same time, while the
+	// scheduler limits the number of batches being copied to the configured
+	// concurrency and interleaves the batches of the different tables.
+	tableConcurrency := d.TableConcurrency
+	if tableConcurrency <= 0 {
+		tableConcurrency = 2 * d.Concurrency
+	}
+	if tableConcurrency > len(iterations) {
+		tableConcurrency = len(iterations)
+	}
+
+	iterationsQueue := make(chan tableIteration)
 	wg := &sync.WaitGroup{}
-	wg.Add(d.Concurrency)
+	wg.Add(tableConcurrency)
 
-	for i := 0; i < d.Concurrency; i++ {
+	for i := 0; i < tableConcurrency; i++ {
 		go func() {
 			defer wg.Done()
+			defer d.ReportPanic()
 
 			for {
-				table, ok := <-tablesQueue
+				iteration, ok := <-iterationsQueue
 				if !ok {
 					break
 				}
 
-				logger := d.logger.WithField("table", table.String())
-
-				cursor := d.CursorConfig.NewCursor(table, d.CurrentState.TargetPrimaryKeys()[table.String()])
-				err := cursor.Each(func(batch *RowBatch) error {
-					metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
-						MetricTag{"table", table.Name},
-						MetricTag{"source", "table"},
-					}, 1.0)
-
-					for _, listener := range d.batchListeners {
-						err := listener(batch)
-						if err != nil {
-							logger.WithError(err).Error("failed to process row batch with listeners")
-							return err
-						}
-					}
+				// The remaining tables must still be received so the
+				// queueing below does not block.
+				if d.StopRequested() {
+					continue
+				}
 
-					// The way we save the LastSuccessfulPK is probably incorrect if we
-					// want to ensure that when we crash, we have a "correct" view of
-					// the LastSuccessfulPK.
-					// However, it's uncertain if it is even theoretically possible to
-					// save the "correct" value.
-					// TODO: investigate this if we want to ensure that on error, we have
-					//       the "correct" last successful PK and other values.
-					// TODO: it is also perhaps possible to save the Cursor objects
-					// directly as opposed to saving a state, but that is left to
-					// the future.
-					lastRow := batch.Values()[len(batch.Values())-1]
-					pkpos, err := lastRow.GetUint64(batch.PkIndex())
-					if err != nil {
-						logger.WithError(err).Error("failed to convert pk to uint64")
-						return err
-					}
+				table := iteration.table
+				logger := d.logger.WithField("table", table.String())
+				if iteration.partition != "" {
+					logger = logger.WithField("partition", iteration.partition)
+				}
 
-					logger.Debugf("updated last successful PK to %d", pkpos)
-					d.CurrentState.UpdateLastSuccessfulPK(table.String(), pkpos)
+				var err error
+				if !iteration.partitionsCompleted {
+					err = d.iterateTable(iteration, logger)
+				}
 
-					return nil
-				})
+				if err == errDataIteratorStopped {
+					logger.Info("table iteration stopped")
+					continue
+				}
 
 				if err != nil {
 					logger.WithError(err).Error("failed to iterate table")
@@ -237,29 +563,369 @@ func (d *DataIterator) Run() {
 					return
 				}
 
+				if iteration.partition != "" {
+					logger.Debug("partition iteration completed")
+					d.CurrentState.MarkPartitionAsCompleted(table.String(), iteration.partition)
+
+					remainingPartitionsMutex.Lock()
+					remainingPartitions[table.String()]--
+					remaining := remainingPartitions[table.String()]
+					remainingPartitionsMutex.Unlock()
+
+					if remaining > 0 {
+						continue
+					}
+				}
+
 				logger.Debug("table iteration completed")
 				d.CurrentState.MarkTableAsCompleted(table.String())
+
+				for _, listener := range d.tableDoneListeners {
+					err = listener(table)
+					if err != nil {
+						logger.WithError(err).Error("failed to process completed table with listeners")
+						d.ErrorHandler.Fatal("data_iterator", err)
+						return
+					}
+				}
 			}
 		}()
 	}
 
-	for table, _ := range tablesWithData {
-		tablesQueue <- table
+	pendingTableNames := make(map[string]bool, len(pendingTables))
+	for _, table := range pendingTables {
+		pendingTableNames[table.String()] = true
+	}
+
+	for _, iteration := range iterations {
+		d.waitForDependencies(iteration.table, pendingTableNames)
+		iterationsQueue <- iteration
 	}
 
 	d.logger.Info("done queueing tables to be iterated, closing table channel")
-	close(tablesQueue)
+	close(iterationsQueue)
 
 	wg.Wait()
+
+	// The tables without a key cannot be iterated in batches, they are each
+	// copied at once once the other tables are copied.
+	for _, table := range fullRowMatchTables {
+		if d.StopRequested() || d.CurrentState.IsTableCompleted(table.String()) {
+			continue
+		}
+
+		err := d.copyFullRowMatchTable(table)
+		if err != nil {
+			d.logger.WithError(err).WithField("table", table.String()).Error("failed to copy table without a key")
+			d.ErrorHandler.Fatal("data_iterator", err)
+			return
+		}
+	}
+
+	if d.StopRequested() {
+		d.logger.Info("data iterator stopped before completion")
+		return
+	}
+
 	for _, listener := range d.doneListeners {
 		listener()
 	}
 }
 
+// A table, or a partition of a table, to iterate.
+type tableIteration struct {
+	table     *schema.Table
+	partition string
+
+	// Set if all the partitions of the table were copied by a previous run,
+	// which was interrupted before the table was marked as completed.
+	partitionsCompleted bool
+}
+
+// Returns the tables to iterate, split into their partitions if ByPartition.
+// The partitions completed by a previous run are left out.
+func (d *DataIterator) tableIterations(tables []*schema.Table) ([]tableIteration, error) {
+	iterations := make([]tableIteration, 0, len(tables))
+	if d.ByPartition && d.CursorConfig.BuildSelect != nil {
+		d.logger.Warn("iterating the tables as a whole, as the partitions cannot be selected with a CopyFilter")
+	}
+	if len(d.Indexes) > 0 && d.CursorConfig.BuildSelect != nil {
+		d.logger.Warn("iterating the tables in the order of their primary key, as the order of an index cannot be used with a CopyFilter")
+	}
+
+	for _, table := range tables {
+		if !d.ByPartition || d.CursorConfig.BuildSelect != nil {
+			iterations = append(iterations, tableIteration{table: table})
+			continue
+		}
+
+		partitions, err := TablePartitions(d.DB, table)
+		if err != nil {
+			d.logger.WithError(err).WithField("table", table.String()).Error("failed to list the partitions of the table")
+			return nil, err
+		}
+
+		if len(partitions) == 0 {
+			iterations = append(iterations, tableIteration{table: table})
+			continue
+		}
+
+		pending := 0
+		for _, partition := range partitions {
+			if !d.CurrentState.IsPartitionCompleted(table.String(), partition) {
+				iterations = append(iterations, tableIteration{table: table, partition: partition})
+				pending++
+			}
+		}
+
+		if pending == 0 {
+			iterations = append(iterations, tableIteration{table: table, partitionsCompleted: true})
+		}
+	}
+
+	return iterations, nil
+}
+
+// Copies the rows of the table or of the partition, from where it was left
+// by a previous run.
+func (d *DataIterator) iterateTable(iteration tableIteration, logger *logrus.Entry) error {
+	table := iteration.table
+
+	cursor := d.CursorConfig.NewCursor(table, d.CurrentState.TargetPK(table.String()))
+	cursor.StartPrimaryKey = d.CurrentState.LastSuccessfulPK(table.String())
+	cursor.Partition = iteration.partition
+	cursor.Scheduler = d.Scheduler
+
+	if indexName, exists := d.Indexes[table.String()]; exists && d.CursorConfig.BuildSelect == nil {
+		cursor.Index = tableIndex(table, indexName)
+	}
+
+	// The rows up to the position of the table are already copied if the
+	// table was iterated as a whole by a previous run. In the order of an
+	// index, the position of the partition is always further.
+	if iteration.partition != "" {
+		pk := d.CurrentState.LastSuccessfulPartitionPK(table.String(), iteration.partition)
+		if pk > cursor.StartPrimaryKey || (cursor.Index != nil && pk > 0) {
+			cursor.StartPrimaryKey = pk
+		}
+	}
+
+	// The explicit batch sizes are never adjusted.
+	if batchSize, exists := d.TableBatchSizes[table.String()]; exists {
+		cursor.BatchSize = batchSize
+		cursor.BatchSizer = nil
+		cursor.SharedBatchSize = nil
+	}
+
+	// The first batch of a table with huge rows would otherwise be read with
+	// the configured batch size.
+	if cursor.BatchSizer != nil && cursor.BatchSizer.MaxBatchBytes > 0 {
+		rowBytes, err := AverageRowBytes(d.DB, table)
+		if err != nil {
+			logger.WithError(err).Warn("failed to read the average row size of the table, starting at the configured batch size")
+		} else {
+			cursor.BatchSizer.EstimateFromAverageRow(table.String(), cursor.BatchSize, rowBytes)
+		}
+	}
+
+	return cursor.Each(func(batch *RowBatch) error {
+		if d.StopRequested() {
+			return errDataIteratorStopped
+		}
+
+		// The rows are locked until the batch is written, so the
+		// copy is only paused before the next batch is read.
+		if d.Pauser != nil {
+			defer d.Pauser.Wait(PauseCopy)
+		}
+
+		if d.MemoryBudget != nil {
+			size := rowBatchSize(batch)
+			d.MemoryBudget.Add(MemoryCopy, size)
+			defer func() {
+				d.MemoryBudget.Release(MemoryCopy, size)
+				d.MemoryBudget.Wait(MemoryCopy)
+			}()
+		}
+
+		metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
+			MetricTag{"table", table.Name},
+			MetricTag{"source", "table"},
+		}, 1.0)
+
+		for _, listener := range d.batchListeners {
+			err := listener(batch)
+			if err != nil {
+				logger.WithError(err).Error("failed to process row batch with listeners")
+				return err
+			}
+		}
+
+		// The way we save the LastSuccessfulPK is probably incorrect if we
+		// want to ensure that when we crash, we have a "correct" view of
+		// the LastSuccessfulPK.
+		// However, it's uncertain if it is even theoretically possible to
+		// save the "correct" value.
+		// TODO: investigate this if we want to ensure that on error, we have
+		//       the "correct" last successful PK and other values.
+		// TODO: it is also perhaps possible to save the Cursor objects
+		// directly as opposed to saving a state, but that is left to
+		// the future.
+		lastRow := batch.Values()[len(batch.Values())-1]
+		pkpos, err := lastRow.GetUint64(batch.PkIndex())
+		if err != nil {
+			logger.WithError(err).Error("failed to convert pk to uint64")
+			return err
+		}
+
+		logger.WithField("pk", pkpos).Debug("updated last successful PK")
+		if cursor.Index != nil {
+			d.CurrentState.UpdateLastSuccessfulIndexPK(table.String(), iteration.partition, pkpos, batch.Size())
+		} else if iteration.partition != "" {
+			d.CurrentState.UpdateLastSuccessfulPartitionPK(table.String(), iteration.partition, pkpos)
+		} else {
+			d.CurrentState.UpdateLastSuccessfulPK(table.String(), pkpos)
+		}
+
+		return nil
+	})
+}
+
+// Sorts the tables in the order they should start being iterated. The
+// tables are first sorted alphabetically so the order is deterministic.
+// Moves the iterations of the tables after the iterations of the tables
+// they depend on, keeping the order of the iterations otherwise. Only the
+// dependencies being iterated are considered, the others are completed or
+// not ferried.
+func (d *DataIterator) orderIterationsByDependencies(iterations []tableIteration) ([]tableIteration, error) {
+	remaining := make(map[string]int)
+	for _, iteration := range iterations {
+		remaining[iteration.table.String()]++
+	}
+
+	ordered := make([]tableIteration, 0, len(iterations))
+	for len(iterations) > 0 {
+		next := -1
+		for i, iteration := range iterations {
+			ready := true
+			for _, dependency := range d.TableDependencies[iteration.table.String()] {
+				if remaining[dependency] > 0 {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			tables := make([]string, 0, len(remaining))
+			for table, count := range remaining {
+				if count > 0 {
+					tables = append(tables, table)
+				}
+			}
+			sort.Strings(tables)
+			return nil, fmt.Errorf("the foreign keys of %s form a cycle, the tables cannot be copied in the order of their foreign keys", strings.Join(tables, ", "))
+		}
+
+		// All the iterations of a table are moved together, so the
+		// partitions of a table are still iterated in order.
+		table := iterations[next].table.String()
+		rest := make([]tableIteration, 0, len(iterations))
+		for _, iteration := range iterations {
+			if iteration.table.String() == table {
+				ordered = append(ordered, iteration)
+			} else {
+				rest = append(rest, iteration)
+			}
+		}
+		iterations = rest
+		remaining[table] = 0
+	}
+
+	return ordered, nil
+}
+
+// Waits until the tables the table depends on, among the pending tables,
+// are completed, or until the iterator is stopped.
+func (d *DataIterator) waitForDependencies(table *schema.Table, pendingTables map[string]bool) {
+	for _, dependency := range d.TableDependencies[table.String()] {
+		if !pendingTables[dependency] {
+			continue
+		}
+
+		logged := false
+		for !d.CurrentState.IsTableCompleted(dependency) && !d.StopRequested() {
+			if !logged {
+				d.logger.WithFields(logrus.Fields{
+					"table":      table.String(),
+					"dependency": dependency,
+				}).Info("waiting for the table referenced by the foreign keys to be copied")
+				logged = true
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+func sortTablesForIteration(tables []*schema.Table, maxPks map[*schema.Table]uint64, order string, orderList []string) {
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].String() < tables[j].String()
+	})
+
+	switch order {
+	case TableOrderLargestFirst:
+		sort.SliceStable(tables, func(i, j int) bool {
+			return maxPks[tables[i]] > maxPks[tables[j]]
+		})
+	case TableOrderExplicit:
+		positions := make(map[string]int)
+		for i, table := range orderList {
+			positions[table] = i
+		}
+
+		sort.SliceStable(tables, func(i, j int) bool {
+			iPos, iListed := positions[tables[i].String()]
+			jPos, jListed := positions[tables[j].String()]
+			if iListed && jListed {
+				return iPos < jPos
+			}
+			return iListed && !jListed
+		})
+	}
+}
+
+// Stops the iteration after the batches currently being processed. Tables
+// that were not fully copied are not marked as completed and the done
+// listeners are not called.
+func (d *DataIterator) RequestStop() {
+	atomic.StoreInt32(&d.stopRequested, 1)
+}
+
+func (d *DataIterator) StopRequested() bool {
+	return atomic.LoadInt32(&d.stopRequested) == 1
+}
+
 func (d *DataIterator) AddBatchListener(listener func(*RowBatch) error) {
 	d.batchListeners = append(d.batchListeners, listener)
 }
 
+// Adds a listener called once all the rows of a table were iterated and
+// processed by the batch listeners.
+func (d *DataIterator) AddTableDoneListener(listener func(*schema.Table) error) {
+	d.tableDoneListeners = append(d.tableDoneListeners, listener)
+}
+
+// Adds a listener called before a table without a key is copied, see
+// copyFullRowMatchTable.
+func (d *DataIterator) AddFullRowMatchTableStartListener(listener func(*schema.Table) error) {
+	d.fullRowMatchTableStartListeners = append(d.fullRowMatchTableStartListeners, listener)
+}
+
 func (d *DataIterator) AddDoneListener(listener func() error) {
 	d.doneListeners = append(d.doneListeners, listener)
 }
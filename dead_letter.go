@@ -0,0 +1,178 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Abort the ferry when a binlog event cannot be written to the target.
+	BinlogWriteFailureAbort = "abort"
+
+	// Record the binlog events that cannot be written to the target to the
+	// DeadLetterFile and keep going.
+	BinlogWriteFailureDeadLetter = "dead_letter"
+)
+
+// A binlog event that could not be written to the target, as recorded in the
+// dead letter file. Values are keyed by the source column names. Binary
+// values that are not valid UTF-8 are encoded as base64 strings.
+type DeadLetterRecord struct {
+	Time           time.Time              `json:"time"`
+	Type           string                 `json:"type"`
+	Database       string                 `json:"database"`
+	Table          string                 `json:"table"`
+	TargetDatabase string                 `json:"target_database"`
+	TargetTable    string                 `json:"target_table"`
+	Before         map[string]interface{} `json:"before,omitempty"`
+	After          map[string]interface{} `json:"after,omitempty"`
+	BinlogPosition mysql.Position         `json:"binlog_position"`
+
+	// The statement that failed, which can be replayed manually on the
+	// target once the cause of the failure is fixed.
+	Statement string `json:"statement"`
+	Error     string `json:"error"`
+}
+
+// DeadLetterSink appends the binlog events that could not be written to the
+// target to a file, as lines of JSON. The target is missing these changes
+// until they are replayed, so the verifiers are expected to report the
+// affected rows.
+type DeadLetterSink struct {
+	File string
+
+	// Generates the recorded statements.
+	//
+	// Optional: defaults to MySQLDialect.
+	Dialect SQLDialect
+
+	// See BinlogWriter.FullRowMatching.
+	FullRowMatching bool
+
+	logger *logrus.Entry
+
+	mutex sync.Mutex
+	file  *os.File
+	count int64
+}
+
+func (s *DeadLetterSink) Initialize() error {
+	s.logger = logrus.WithField("tag", "dead_letter_sink")
+
+	if s.Dialect == nil {
+		s.Dialect = MySQLDialect{}
+	}
+
+	var err error
+	s.file, err = os.OpenFile(s.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	return err
+}
+
+func (s *DeadLetterSink) Record(ev DMLEvent, targetDb, targetTable string, cause error) error {
+	table := ev.TableSchema()
+
+	record := &DeadLetterRecord{
+		Time:           time.Now(),
+		Database:       table.Schema,
+		Table:          table.Name,
+		TargetDatabase: targetDb,
+		TargetTable:    targetTable,
+		Before:         auditValues(table, ev.OldValues()),
+		After:          auditValues(table, ev.NewValues()),
+		BinlogPosition: ev.BinlogPosition(),
+		Error:          cause.Error(),
+	}
+
+	switch ev.(type) {
+	case *BinlogInsertEvent:
+		record.Type = "insert"
+	case *BinlogUpdateEvent:
+		record.Type = "update"
+	case *BinlogDeleteEvent:
+		record.Type = "delete"
+	default:
+		return fmt.Errorf("unknown event type %T", ev)
+	}
+
+	replayed, err := dmlEventWithEncodedColumns(ev)
+	if err != nil {
+		return err
+	}
+
+	if writesToMySQL(s.Dialect) && HasGeneratedColumns(table) {
+		replayed = dmlEventWithoutGeneratedColumns(replayed)
+	}
+
+	statement, err := s.Dialect.DMLEventStatement(replayed, &schema.Table{Schema: targetDb, Name: targetTable})
+	if err != nil {
+		return err
+	}
+	if s.FullRowMatching {
+		statement = fullRowMatchStatement(replayed, statement)
+	}
+	record.Statement = statement
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("dead letter file %s is closed", s.File)
+	}
+
+	_, err = s.file.Write(line)
+	if err != nil {
+		return err
+	}
+
+	err = s.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	s.count++
+	metrics.Count("DeadLetterEvents", 1, []MetricTag{
+		MetricTag{"table", table.Name},
+		MetricTag{"source", "binlog"},
+	}, 1.0)
+
+	s.logger.WithError(cause).WithFields(logrus.Fields{
+		"table":    table.String(),
+		"position": record.BinlogPosition,
+	}).Error("recorded binlog event to dead letter file")
+
+	return nil
+}
+
+// The number of events recorded since the sink was initialized.
+func (s *DeadLetterSink) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.count
+}
+
+func (s *DeadLetterSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,117 @@
+package ghostferry
+
+import (
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// A snapshot of the internals of the ferry, served by the ControlServer to
+// diagnose a stalled run.
+type DebugState struct {
+	Time         time.Time
+	OverallState string
+
+	Goroutines     int
+	HeapAllocBytes uint64
+	NumGC          uint32
+
+	// The depths of the queues of pending work, such as the binlog events
+	// waiting to be written, keyed by queue name.
+	QueueDepths map[string]int64
+
+	BinlogStreamer BinlogStreamerDebugState
+	BinlogWriter   BinlogWriterDebugState
+	DataIterator   DataIteratorDebugState
+
+	ReadThrottled  bool
+	WriteThrottled bool
+
+	LastCheckpoint      time.Time `json:",omitempty"`
+	LastCheckpointError string    `json:",omitempty"`
+}
+
+type BinlogStreamerDebugState struct {
+	LastStreamedPosition mysql.Position
+	TargetPosition       mysql.Position
+	Lag                  time.Duration
+	StopRequested        bool
+	Interrupted          bool
+}
+
+type BinlogWriterDebugState struct {
+	LastWrittenPosition mysql.Position
+	Lag                 time.Duration
+	BufferDepth         int64
+}
+
+type DataIteratorDebugState struct {
+	TotalTables     int
+	CompletedTables int
+
+	// The tables whose copy started but did not complete yet.
+	CopyingTables []string
+	StopRequested bool
+}
+
+func (f *Ferry) DebugState() *DebugState {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	state := &DebugState{
+		Time:           time.Now(),
+		OverallState:   f.OverallState,
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: memStats.HeapAlloc,
+		NumGC:          memStats.NumGC,
+
+		BinlogStreamer: BinlogStreamerDebugState{
+			LastStreamedPosition: f.BinlogStreamer.GetLastStreamedBinlogPosition(),
+			TargetPosition:       f.BinlogStreamer.targetBinlogPosition,
+			Lag:                  f.BinlogStreamer.Lag(),
+			StopRequested:        f.BinlogStreamer.stopRequested,
+			Interrupted:          f.BinlogStreamer.IsInterrupted(),
+		},
+		BinlogWriter: BinlogWriterDebugState{
+			LastWrittenPosition: f.BinlogWriter.LastWrittenBinlogPosition(),
+			Lag:                 f.BinlogWriter.Lag(),
+			BufferDepth:         f.BinlogWriter.BufferDepth(),
+		},
+
+		ReadThrottled:  f.ReadThrottler.Throttled(),
+		WriteThrottled: f.WriteThrottler.Throttled(),
+	}
+
+	if f.QueueDepthMonitor != nil {
+		state.QueueDepths = f.QueueDepthMonitor.Depths()
+	}
+
+	if f.DataIterator != nil {
+		completedTables := f.DataIterator.CurrentState.CompletedTables()
+		state.DataIterator = DataIteratorDebugState{
+			TotalTables:     len(f.Tables),
+			CompletedTables: len(completedTables),
+			CopyingTables:   []string{},
+			StopRequested:   f.DataIterator.StopRequested(),
+		}
+
+		for table := range f.DataIterator.CurrentState.LastSuccessfulPrimaryKeys() {
+			if !completedTables[table] {
+				state.DataIterator.CopyingTables = append(state.DataIterator.CopyingTables, table)
+			}
+		}
+		sort.Strings(state.DataIterator.CopyingTables)
+	}
+
+	if f.checkpointer != nil {
+		var err error
+		state.LastCheckpoint, err = f.checkpointer.LastCheckpoint()
+		if err != nil {
+			state.LastCheckpointError = err.Error()
+		}
+	}
+
+	return state
+}
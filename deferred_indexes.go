@@ -0,0 +1,227 @@
+package ghostferry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The secondary indexes of the target tables can be dropped before the rows
+// are copied and added back once they are, see Config.DeferSecondaryIndexes:
+// building an index once from all the rows is much faster than maintaining
+// it on every insert of the copy.
+//
+// Only the non-unique indexes are deferred, as the unique indexes reject the
+// rows conflicting with them, and the indexes starting with a column of a
+// foreign key of the table are kept for the constraint. The binlog events
+// keep being written while the indexes are added back, which MySQL does
+// without blocking the writes for the BTREE indexes.
+
+var (
+	deferrableIndexRegexp  = regexp.MustCompile("^\\s*(?:(?:FULLTEXT|SPATIAL) )?KEY `((?:[^`]|``)+)` \\((.*)\\)")
+	foreignKeyRegexp       = regexp.MustCompile("^\\s*CONSTRAINT `(?:[^`]|``)+` FOREIGN KEY \\(([^)]*)\\)")
+	firstIndexColumnRegexp = regexp.MustCompile("^`((?:[^`]|``)+)`")
+)
+
+// A secondary index of a target table dropped until the rows are copied.
+type DeferredIndex struct {
+	// The quoted name of the target table.
+	Table string
+
+	Name string
+
+	// The definition of the index as shown by SHOW CREATE TABLE, such as
+	// KEY `idx_email` (`email`), with which it is added back.
+	Definition string
+}
+
+// Returns the indexes of a table that can be deferred, from its SHOW CREATE
+// TABLE.
+func DeferrableIndexes(table, createTable string) []DeferredIndex {
+	lines := strings.Split(createTable, "\n")
+
+	foreignKeyColumns := make(map[string]bool)
+	for _, line := range lines {
+		match := foreignKeyRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		for _, column := range strings.Split(match[1], ",") {
+			foreignKeyColumns[strings.Trim(strings.TrimSpace(column), "`")] = true
+		}
+	}
+
+	var indexes []DeferredIndex
+	for _, line := range lines {
+		match := deferrableIndexRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		if column := firstIndexColumnRegexp.FindStringSubmatch(match[2]); column != nil && foreignKeyColumns[column[1]] {
+			continue
+		}
+
+		indexes = append(indexes, DeferredIndex{
+			Table:      table,
+			Name:       strings.Replace(match[1], "``", "`", -1),
+			Definition: strings.TrimSuffix(strings.TrimSpace(line), ","),
+		})
+	}
+
+	return indexes
+}
+
+// Drops the deferrable indexes of the target tables not copied yet. The
+// dropped indexes are kept in the state, so a resumed run adds them back.
+func (f *Ferry) deferTargetIndexes() error {
+	logger := logrus.WithField("tag", "deferred_indexes")
+	completedTables := f.DataIterator.CurrentState.CompletedTables()
+
+	tables := f.Tables.AsSlice()
+	sort.Slice(tables, func(i, j int) bool { return tables[i].String() < tables[j].String() })
+
+	for _, table := range tables {
+		if completedTables[table.String()] {
+			continue
+		}
+
+		targetDb, targetTable := f.BinlogWriter.targetTableName(table.Schema, table.Name)
+		quotedTable := QuotedTableNameFromString(targetDb, targetTable)
+
+		var name, createTable string
+		err := f.TargetDB.QueryRow(fmt.Sprintf("SHOW CREATE TABLE %s", quotedTable)).Scan(&name, &createTable)
+		if err != nil {
+			return fmt.Errorf("failed to show create table %s on target: %v", quotedTable, err)
+		}
+
+		indexes := DeferrableIndexes(quotedTable, createTable)
+		if len(indexes) == 0 {
+			continue
+		}
+
+		drops := make([]string, len(indexes))
+		for i, index := range indexes {
+			drops[i] = "DROP INDEX " + quoteField(index.Name)
+			logger.WithFields(logrus.Fields{
+				"table":      quotedTable,
+				"definition": index.Definition,
+			}).Info("deferring index of target table")
+		}
+
+		// Recorded before the drop, so the indexes are added back if the
+		// run is interrupted right after it.
+		f.deferredIndexesMutex.Lock()
+		f.deferredIndexes = append(f.deferredIndexes, indexes...)
+		f.deferredIndexesMutex.Unlock()
+
+		_, err = f.TargetDB.Exec(fmt.Sprintf("ALTER TABLE %s %s", quotedTable, strings.Join(drops, ", ")))
+		if err != nil {
+			return fmt.Errorf("failed to drop the indexes of %s: %v", quotedTable, err)
+		}
+	}
+
+	return nil
+}
+
+// Adds back the deferred indexes once the rows are copied, as a done
+// listener of the DataIterator.
+func (f *Ferry) rebuildTargetIndexes() error {
+	err := f.addBackDeferredIndexes()
+	if err != nil {
+		f.ErrorHandler.Fatal("deferred_indexes", err)
+	}
+	return err
+}
+
+// Adds back the deferred indexes, a table at a time.
+func (f *Ferry) addBackDeferredIndexes() error {
+	logger := logrus.WithField("tag", "deferred_indexes")
+
+	for {
+		f.deferredIndexesMutex.Lock()
+		if len(f.deferredIndexes) == 0 {
+			f.deferredIndexesMutex.Unlock()
+			break
+		}
+
+		table := f.deferredIndexes[0].Table
+		var indexes []DeferredIndex
+		for _, index := range f.deferredIndexes {
+			if index.Table == table {
+				indexes = append(indexes, index)
+			}
+		}
+		f.deferredIndexesMutex.Unlock()
+
+		// The indexes may have been added back by an interrupted run
+		// whose state was dumped before.
+		var name, createTable string
+		err := f.TargetDB.QueryRow(fmt.Sprintf("SHOW CREATE TABLE %s", table)).Scan(&name, &createTable)
+		if err != nil {
+			return fmt.Errorf("failed to show create table %s on target: %v", table, err)
+		}
+
+		existing := make(map[string]bool)
+		for _, index := range DeferrableIndexes(table, createTable) {
+			existing[index.Name] = true
+		}
+
+		var adds []string
+		for _, index := range indexes {
+			if !existing[index.Name] {
+				adds = append(adds, "ADD "+index.Definition)
+			}
+		}
+
+		if len(adds) > 0 {
+			logger.WithFields(logrus.Fields{
+				"table":   table,
+				"indexes": len(adds),
+			}).Info("adding back deferred indexes of target table")
+
+			alter := func() error {
+				var err error
+				metrics.Measure("RebuildDeferredIndexes", []MetricTag{{"table", table}}, 1.0, func() {
+					_, err = f.TargetDB.Exec(fmt.Sprintf("ALTER TABLE %s %s", table, strings.Join(adds, ", ")))
+				})
+				return err
+			}
+
+			// The schema drift detector would otherwise report the added
+			// indexes as a change of the table.
+			if f.schemaDriftDetector != nil {
+				err = f.schemaDriftDetector.AlterTargets(alter)
+			} else {
+				err = alter()
+			}
+			if err != nil {
+				return fmt.Errorf("failed to add back the deferred indexes of %s: %v", table, err)
+			}
+		}
+
+		f.deferredIndexesMutex.Lock()
+		remaining := f.deferredIndexes[:0]
+		for _, index := range f.deferredIndexes {
+			if index.Table != table {
+				remaining = append(remaining, index)
+			}
+		}
+		f.deferredIndexes = remaining
+		f.deferredIndexesMutex.Unlock()
+	}
+
+	return nil
+}
+
+// Returns the indexes dropped and not added back yet.
+func (f *Ferry) DeferredIndexes() []DeferredIndex {
+	f.deferredIndexesMutex.Lock()
+	defer f.deferredIndexesMutex.Unlock()
+
+	return append([]DeferredIndex(nil), f.deferredIndexes...)
+}
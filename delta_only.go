@@ -0,0 +1,90 @@
+package ghostferry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// DeltaOnlyConfig configures a ferry whose target was seeded out of band,
+// such as from a physical backup of the source: no rows are copied, the
+// binlog of the source is tailed from the position of the seed and applied
+// to the target until the cutover. The rows changed after the seed are only
+// correct on the target once the events from that position are applied, so
+// the position must not be later than the seed.
+type DeltaOnlyConfig struct {
+	// The position of the binlog of the source the target was seeded at.
+	//
+	// Required, unless BackupMetadataFile is set
+	StartPosition mysql.Position
+
+	// The path of the metadata of the backup the target was seeded from,
+	// either the xtrabackup_binlog_info file of xtrabackup or the output of
+	// mysqldump --master-data. The StartPosition is read from it.
+	//
+	// Optional: defaults to the StartPosition
+	BackupMetadataFile string
+}
+
+func (c *DeltaOnlyConfig) Validate() error {
+	if c.BackupMetadataFile != "" {
+		data, err := ioutil.ReadFile(c.BackupMetadataFile)
+		if err != nil {
+			return fmt.Errorf("cannot read BackupMetadataFile: %s", err)
+		}
+
+		pos, err := ParseBackupBinlogPosition(string(data))
+		if err != nil {
+			return fmt.Errorf("invalid BackupMetadataFile %s: %s", c.BackupMetadataFile, err)
+		}
+
+		if c.StartPosition.Name != "" && c.StartPosition != pos {
+			return fmt.Errorf("StartPosition %s differs from %s in BackupMetadataFile", c.StartPosition, pos)
+		}
+		c.StartPosition = pos
+	}
+
+	if c.StartPosition.Name == "" {
+		return fmt.Errorf("StartPosition must be set")
+	}
+
+	return nil
+}
+
+var mysqldumpChangeMasterRegexp = regexp.MustCompile(`CHANGE MASTER TO MASTER_LOG_FILE='([^']+)',\s*MASTER_LOG_POS=(\d+)`)
+
+// Returns the position of the binlog of the source a backup was taken at,
+// from the xtrabackup_binlog_info file written by xtrabackup, such as
+//
+//	mysql-bin.000003	1234	3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5
+//
+// or from the CHANGE MASTER TO statement written by mysqldump --master-data,
+// commented out or not.
+func ParseBackupBinlogPosition(metadata string) (mysql.Position, error) {
+	if match := mysqldumpChangeMasterRegexp.FindStringSubmatch(metadata); match != nil {
+		pos, err := strconv.ParseUint(match[2], 10, 32)
+		if err != nil {
+			return mysql.Position{}, fmt.Errorf("invalid MASTER_LOG_POS %s", match[2])
+		}
+		return mysql.Position{Name: match[1], Pos: uint32(pos)}, nil
+	}
+
+	// The GTID set of xtrabackup may follow over several lines, only the
+	// first line has the coordinates.
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(metadata), "\n", 2)[0])
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return mysql.Position{}, fmt.Errorf("no binlog coordinates found")
+	}
+
+	pos, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("invalid binlog position %s", fields[1])
+	}
+
+	return mysql.Position{Name: fields[0], Pos: uint32(pos)}, nil
+}
@@ -0,0 +1,60 @@
+package ghostferry
+
+import (
+	"fmt"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// The SQL dialects of the targets, as used in Config.TargetDialect.
+const (
+	DialectMySQL      = "mysql"
+	DialectPostgreSQL = "postgresql"
+	DialectVitess     = "vitess"
+)
+
+// SQLDialect generates the statements writing the copied rows and the binlog
+// events to the target. The statements must be idempotent, as the rows and
+// events may be written more than once if the run is resumed: the rows
+// whose primary key already exists are skipped, and the events only apply
+// to the rows matching the image before the event.
+type SQLDialect interface {
+	Name() string
+
+	// The query inserting the rows of the batch into the target table,
+	// with its arguments.
+	RowBatchQuery(batch *RowBatch, target *schema.Table) (string, []interface{}, error)
+
+	// The statement applying the event to the target table, with the values
+	// inlined so it can be sent in a multi-statement transaction.
+	DMLEventStatement(ev DMLEvent, target *schema.Table) (string, error)
+}
+
+// Writes to a MySQL target, with the statements generated by RowBatch and
+// DMLEvent.
+type MySQLDialect struct{}
+
+func (MySQLDialect) Name() string {
+	return DialectMySQL
+}
+
+func (MySQLDialect) RowBatchQuery(batch *RowBatch, target *schema.Table) (string, []interface{}, error) {
+	return batch.AsSQLQuery(target)
+}
+
+func (MySQLDialect) DMLEventStatement(ev DMLEvent, target *schema.Table) (string, error) {
+	return ev.AsSQLString(target)
+}
+
+func NewSQLDialect(name string) (SQLDialect, error) {
+	switch name {
+	case "", DialectMySQL:
+		return MySQLDialect{}, nil
+	case DialectPostgreSQL:
+		return PostgreSQLDialect{}, nil
+	case DialectVitess:
+		return VitessDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect %s, must be %s, %s or %s", name, DialectMySQL, DialectPostgreSQL, DialectVitess)
+	}
+}
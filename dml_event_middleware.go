@@ -0,0 +1,197 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Handles a batch of DMLEvents streamed from the source.
+type DMLEventHandler func(events []DMLEvent) error
+
+// DMLEventMiddleware intercepts the DMLEvents between the BinlogStreamer and
+// the DMLEventWriter, to filter, transform or count them without replacing
+// the writer. The middlewares of Ferry.DMLEventMiddlewares are chained in
+// order, followed by those of Config.DMLEventMiddlewares, and the last one
+// passes the events to the writer.
+//
+// The event listeners of the BinlogStreamer, such as the IterativeVerifier,
+// see the events as streamed: the verifiers report the rows whose events
+// were dropped or changed as mismatches.
+type DMLEventMiddleware interface {
+	// Handles a batch of events, passing the events to write to next. A
+	// middleware may drop, replace or add events, but must keep them in
+	// the order of the binlog. Returning an error fails the run.
+	HandleDMLEvents(events []DMLEvent, next DMLEventHandler) error
+}
+
+// Adapts a function to a DMLEventMiddleware.
+type DMLEventMiddlewareFunc func(events []DMLEvent, next DMLEventHandler) error
+
+func (f DMLEventMiddlewareFunc) HandleDMLEvents(events []DMLEvent, next DMLEventHandler) error {
+	return f(events, next)
+}
+
+// Returns a handler passing the events through the middlewares, in order,
+// and then to the handler.
+func ChainDMLEventMiddlewares(handler DMLEventHandler, middlewares ...DMLEventMiddleware) DMLEventHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		middleware, next := middlewares[i], handler
+		handler = func(events []DMLEvent) error {
+			return middleware.HandleDMLEvents(events, next)
+		}
+	}
+	return handler
+}
+
+// Returns a middleware passing on only the events for which keep returns
+// true.
+func FilterDMLEvents(keep func(ev DMLEvent) bool) DMLEventMiddleware {
+	return DMLEventMiddlewareFunc(func(events []DMLEvent, next DMLEventHandler) error {
+		kept := make([]DMLEvent, 0, len(events))
+		for _, ev := range events {
+			if keep(ev) {
+				kept = append(kept, ev)
+			}
+		}
+		return next(kept)
+	})
+}
+
+// Returns a middleware replacing the old and new values of the events by
+// those returned by transform, such as to mask a column. The values must
+// still match the columns of the table of the event.
+func TransformDMLEventRows(transform func(ev DMLEvent, row RowData) (RowData, error)) DMLEventMiddleware {
+	return DMLEventMiddlewareFunc(func(events []DMLEvent, next DMLEventHandler) error {
+		transformed := make([]DMLEvent, len(events))
+		for i, ev := range events {
+			oldValues, newValues := ev.OldValues(), ev.NewValues()
+
+			var err error
+			if oldValues != nil {
+				oldValues, err = transform(ev, oldValues)
+				if err != nil {
+					return err
+				}
+			}
+
+			if newValues != nil {
+				newValues, err = transform(ev, newValues)
+				if err != nil {
+					return err
+				}
+			}
+
+			transformed[i] = dmlEventWithValues(ev, oldValues, newValues)
+		}
+		return next(transformed)
+	})
+}
+
+// Returns a middleware counting the events passing through it in the
+// DMLEvents metric, tagged with their table and type, and with the name of
+// the middleware to tell apart several counts along the chain.
+func CountDMLEvents(name string) DMLEventMiddleware {
+	return DMLEventMiddlewareFunc(func(events []DMLEvent, next DMLEventHandler) error {
+		for _, ev := range events {
+			metrics.Count("DMLEvents", 1, []MetricTag{
+				{"name", name},
+				{"table", ev.Database() + "." + ev.Table()},
+				{"type", DMLEventType(ev)},
+			}, 1.0)
+		}
+		return next(events)
+	})
+}
+
+// Creates the middleware of a dml_event_middleware plugin, as configured in
+// Config.DMLEventMiddlewares.
+func (f *Ferry) NewDMLEventMiddleware(config *PluginConfig) (DMLEventMiddleware, error) {
+	plugin, err := f.newPlugin(PluginKindDMLEventMiddleware, config)
+	if err != nil {
+		return nil, err
+	}
+	return plugin.(DMLEventMiddleware), nil
+}
+
+// Returns the type of the event: insert, update or delete, or an empty
+// string for the events of other types.
+func DMLEventType(ev DMLEvent) string {
+	switch ev.(type) {
+	case *BinlogInsertEvent:
+		return "insert"
+	case *BinlogUpdateEvent:
+		return "update"
+	case *BinlogDeleteEvent:
+		return "delete"
+	default:
+		return ""
+	}
+}
+
+// The names of the middlewares registered by ghostferry, which can be used
+// in Config.DMLEventMiddlewares.
+const (
+	DMLEventMiddlewareFilter = "filter"
+	DMLEventMiddlewareCount  = "count"
+)
+
+// The options of the filter middleware: the events of the Tables, or of the
+// Types, are dropped.
+type DMLEventFilterOptions struct {
+	// The tables whose events are dropped, as "database.table".
+	Tables []string
+
+	// The types of the events dropped: insert, update or delete.
+	Types []string
+}
+
+// The options of the count middleware.
+type DMLEventCountOptions struct {
+	// Tags the counts, see CountDMLEvents.
+	//
+	// Optional: defaults to count.
+	Name string
+}
+
+func init() {
+	RegisterPlugin(PluginKindDMLEventMiddleware, DMLEventMiddlewareFilter, func(f *Ferry, options json.RawMessage) (interface{}, error) {
+		var filterOptions DMLEventFilterOptions
+		if len(options) > 0 {
+			err := json.Unmarshal(options, &filterOptions)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		droppedTables := make(map[string]bool)
+		for _, table := range filterOptions.Tables {
+			droppedTables[table] = true
+		}
+
+		droppedTypes := make(map[string]bool)
+		for _, eventType := range filterOptions.Types {
+			eventType = strings.ToLower(eventType)
+			if eventType != "insert" && eventType != "update" && eventType != "delete" {
+				return nil, fmt.Errorf("invalid event type %s, must be insert, update or delete", eventType)
+			}
+			droppedTypes[eventType] = true
+		}
+
+		return FilterDMLEvents(func(ev DMLEvent) bool {
+			return !droppedTables[ev.Database()+"."+ev.Table()] && !droppedTypes[DMLEventType(ev)]
+		}), nil
+	})
+
+	RegisterPlugin(PluginKindDMLEventMiddleware, DMLEventMiddlewareCount, func(f *Ferry, options json.RawMessage) (interface{}, error) {
+		countOptions := DMLEventCountOptions{Name: DMLEventMiddlewareCount}
+		if len(options) > 0 {
+			err := json.Unmarshal(options, &countOptions)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return CountDMLEvents(countOptions.Name), nil
+	})
+}
@@ -1,13 +1,17 @@
 package ghostferry
 
 import (
+	"database/sql"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
+	sqlmysql "github.com/go-sql-driver/mysql"
 	"github.com/shopspring/decimal"
 
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/replication"
 	"github.com/siddontang/go-mysql/schema"
 )
@@ -42,13 +46,25 @@ type DMLEvent interface {
 	OldValues() RowData
 	NewValues() RowData
 	PK() (uint64, error)
+
+	// The position to resume streaming from so that this event is replayed,
+	// i.e. the start of the transaction it belongs to. Replaying the events
+	// of a transaction that was already applied is harmless as the
+	// generated statements are idempotent.
+	BinlogPosition() mysql.Position
+
+	// The time the event was written to the binlog of the source, with a
+	// precision of a second.
+	Timestamp() time.Time
 }
 
 // The base of DMLEvent to provide the necessary methods.
 // This desires a copy of the struct in case we want to deal with schema
 // changes in the future.
 type DMLEventBase struct {
-	table schema.Table
+	table     schema.Table
+	pos       mysql.Position
+	timestamp time.Time
 }
 
 func (e *DMLEventBase) Database() string {
@@ -63,6 +79,14 @@ func (e *DMLEventBase) TableSchema() *schema.Table {
 	return &e.table
 }
 
+func (e *DMLEventBase) BinlogPosition() mysql.Position {
+	return e.pos
+}
+
+func (e *DMLEventBase) Timestamp() time.Time {
+	return e.timestamp
+}
+
 type BinlogInsertEvent struct {
 	newValues RowData
 	*DMLEventBase
@@ -90,15 +114,31 @@ func (e *BinlogInsertEvent) NewValues() RowData {
 }
 
 func (e *BinlogInsertEvent) AsSQLString(target *schema.Table) (string, error) {
-	columns, err := loadColumnsForTable(&e.table, e.newValues)
+	return insertEventsAsSQLString([]*BinlogInsertEvent{e}, target)
+}
+
+// Returns a single statement inserting the rows of the events, which must
+// have the same columns.
+func insertEventsAsSQLString(events []*BinlogInsertEvent, target *schema.Table) (string, error) {
+	rows := make([]RowData, len(events))
+	for i, ev := range events {
+		rows[i] = ev.newValues
+	}
+
+	columns, err := loadColumnsForTable(&events[0].table, rows...)
 	if err != nil {
 		return "", err
 	}
 
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = "(" + buildStringListForValues(row) + ")"
+	}
+
 	query := "INSERT IGNORE INTO " +
 		QuotedTableNameFromString(target.Schema, target.Name) +
 		" (" + strings.Join(columns, ",") + ")" +
-		" VALUES (" + buildStringListForValues(e.newValues) + ")"
+		" VALUES " + strings.Join(values, ",")
 
 	return query, nil
 }
@@ -153,7 +193,6 @@ func (e *BinlogUpdateEvent) AsSQLString(target *schema.Table) (string, error) {
 	query := "UPDATE " + QuotedTableNameFromString(target.Schema, target.Name) +
 		" SET " + buildStringMapForSet(columns, e.newValues) +
 		" WHERE " + buildStringMapForWhere(columns, e.oldValues)
-
 	return query, nil
 }
 
@@ -195,7 +234,6 @@ func (e *BinlogDeleteEvent) AsSQLString(target *schema.Table) (string, error) {
 
 	query := "DELETE FROM " + QuotedTableNameFromString(target.Schema, target.Name) +
 		" WHERE " + buildStringMapForWhere(columns, e.oldValues)
-
 	return query, nil
 }
 
@@ -203,7 +241,9 @@ func (e *BinlogDeleteEvent) PK() (uint64, error) {
 	return pkFromEventData(&e.table, e.oldValues)
 }
 
-func NewBinlogDMLEvents(table *schema.Table, ev *replication.BinlogEvent) ([]DMLEvent, error) {
+// Creates the DMLEvents for a rows event. The position must be the start of
+// the transaction the event belongs to, see DMLEvent.BinlogPosition.
+func NewBinlogDMLEvents(table *schema.Table, ev *replication.BinlogEvent, pos mysql.Position) ([]DMLEvent, error) {
 	rowsEvent := ev.Event.(*replication.RowsEvent)
 
 	for _, row := range rowsEvent.Rows {
@@ -217,7 +257,9 @@ func NewBinlogDMLEvents(table *schema.Table, ev *replication.BinlogEvent) ([]DML
 			)
 		}
 		for i, col := range table.Columns {
-			if col.IsUnsigned {
+			// The binlog yields the BIT and SET values as int64, which are
+			// negative once their 64th bit is set.
+			if col.IsUnsigned || col.Type == schema.TYPE_BIT || col.Type == schema.TYPE_SET {
 				switch v := row[i].(type) {
 				case int64:
 					row[i] = uint64(v)
@@ -234,16 +276,43 @@ func NewBinlogDMLEvents(table *schema.Table, ev *replication.BinlogEvent) ([]DML
 		}
 	}
 
+	var dmlEvents []DMLEvent
+	var err error
+
 	switch ev.Header.EventType {
 	case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
-		return NewBinlogInsertEvents(table, rowsEvent)
+		dmlEvents, err = NewBinlogInsertEvents(table, rowsEvent)
 	case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
-		return NewBinlogDeleteEvents(table, rowsEvent)
+		dmlEvents, err = NewBinlogDeleteEvents(table, rowsEvent)
 	case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
-		return NewBinlogUpdateEvents(table, rowsEvent)
+		dmlEvents, err = NewBinlogUpdateEvents(table, rowsEvent)
 	default:
 		return nil, fmt.Errorf("unrecognized rows event: %s", ev.Header.EventType.String())
 	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Unix(int64(ev.Header.Timestamp), 0)
+	for _, dmlEvent := range dmlEvents {
+		base := dmlEvent.(interface {
+			setBinlogPosition(mysql.Position)
+			setTimestamp(time.Time)
+		})
+		base.setBinlogPosition(pos)
+		base.setTimestamp(timestamp)
+	}
+
+	return dmlEvents, nil
+}
+
+func (e *DMLEventBase) setBinlogPosition(pos mysql.Position) {
+	e.pos = pos
+}
+
+func (e *DMLEventBase) setTimestamp(timestamp time.Time) {
+	e.timestamp = timestamp
 }
 
 func loadColumnsForTable(table *schema.Table, valuesToVerify ...RowData) ([]string, error) {
@@ -266,13 +335,13 @@ func quotedColumnNames(table *schema.Table) []string {
 
 func verifyValuesHasTheSameLengthAsColumns(table *schema.Table, values RowData) error {
 	if len(table.Columns) != len(values) {
-		return fmt.Errorf(
+		return NewClassifiedError(ErrorClassSchemaMismatch, fmt.Errorf(
 			"table %s.%s has %d columns but event has %d columns instead",
 			table.Schema,
 			table.Name,
 			len(table.Columns),
 			len(values),
-		)
+		))
 	}
 	return nil
 }
@@ -334,6 +403,14 @@ func isNilValue(value interface{}) bool {
 		return true
 	} else if vb, ok := value.([]byte); ok && vb == nil {
 		return true
+	} else if vb, ok := value.(sql.RawBytes); ok && vb == nil {
+		return true
+	} else if vt, ok := value.(*time.Time); ok && vt == nil {
+		return true
+	} else if vt, ok := value.(sqlmysql.NullTime); ok && !vt.Valid {
+		return true
+	} else if vt, ok := value.(sql.NullTime); ok && !vt.Valid {
+		return true
 	}
 	return false
 }
@@ -351,11 +428,27 @@ func appendEscapedValue(buffer []byte, value interface{}) []byte {
 		return strconv.AppendInt(buffer, intv, 10)
 	}
 
+	// The binlog yields BIT, ENUM and SET values as integers (the bit value,
+	// the enum index and the set bitmask), which MySQL accepts as is, while
+	// the driver yields them as bytes (the bit string, the enum label and the
+	// comma separated set members). YEAR is an int and the other temporal
+	// types are strings, with as many fractional digits as the column has.
+	// time.Time only comes from the driver when parseTime is enabled.
 	switch v := value.(type) {
 	case string:
 		return appendEscapedString(buffer, v)
 	case []byte:
 		return appendEscapedBuffer(buffer, v)
+	case sql.RawBytes:
+		return appendEscapedBuffer(buffer, v)
+	case time.Time:
+		return appendEscapedTime(buffer, v)
+	case *time.Time:
+		return appendEscapedTime(buffer, *v)
+	case sqlmysql.NullTime:
+		return appendEscapedTime(buffer, v.Time)
+	case sql.NullTime:
+		return appendEscapedTime(buffer, v.Time)
 	case bool:
 		if v {
 			return append(buffer, '1')
@@ -369,10 +462,21 @@ func appendEscapedValue(buffer []byte, value interface{}) []byte {
 	case decimal.Decimal:
 		return appendEscapedString(buffer, v.String())
 	default:
-		panic(fmt.Sprintf("unsupported type %t", value))
+		panic(fmt.Sprintf("unsupported type %T", value))
 	}
 }
 
+// Formats the time as a DATETIME/TIMESTAMP literal, keeping the fractional
+// seconds only if there are any.
+func appendEscapedTime(buffer []byte, t time.Time) []byte {
+	layout := "2006-01-02 15:04:05"
+	if t.Nanosecond() != 0 {
+		layout = "2006-01-02 15:04:05.999999"
+	}
+
+	return appendEscapedString(buffer, t.Format(layout))
+}
+
 func Uint64Value(value interface{}) (uint64, bool) {
 	switch v := value.(type) {
 	case uint64:
@@ -389,6 +493,19 @@ func Uint64Value(value interface{}) (uint64, bool) {
 	return 0, false
 }
 
+// Returns the bitmask of a SET value decoded from the binlog.
+func setBitmask(value interface{}) (uint64, bool) {
+	if v, ok := Uint64Value(value); ok {
+		return v, true
+	}
+
+	if v, ok := Int64Value(value); ok {
+		return uint64(v), true
+	}
+
+	return 0, false
+}
+
 func Int64Value(value interface{}) (int64, bool) {
 	switch v := value.(type) {
 	case int64:
@@ -446,6 +563,10 @@ func pkFromEventData(table *schema.Table, rowData RowData) (uint64, error) {
 		return 0, err
 	}
 
+	if IsFullRowMatchTable(table) {
+		return 0, fmt.Errorf("table %s has no primary key", table.String())
+	}
+
 	pkIndex := table.PKColumns[0]
 	return rowData.GetUint64(pkIndex)
 }
@@ -1,14 +1,16 @@
 package ghostferry
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
 
+// ErrorHandler handles the errors that stop the run. The class of the
+// errors can be found with ClassifyError.
 type ErrorHandler interface {
 	Fatal(from string, err error)
 }
@@ -19,24 +21,40 @@ type PanicErrorHandler struct {
 }
 
 func (this *PanicErrorHandler) Fatal(from string, err error) {
-	logger := logrus.WithField("tag", "error_handler")
+	class := countFatalError(from, err)
+	logger := logrus.WithFields(logrus.Fields{
+		"tag":      "error_handler",
+		"errfrom":  from,
+		"errclass": class,
+	})
 
 	if atomic.AddInt32(&this.errorCount, 1) > 1 {
-		logger.WithError(err).WithField("errfrom", from).Error("multiple fatal errors detected")
+		logger.WithError(err).Error("multiple fatal errors detected")
 		return
 	}
 
-	logger.WithError(err).WithField("errfrom", from).Error("fatal error detected, state dump coming in stdout")
+	logger.WithError(err).Error("fatal error detected, state dump coming in stdout")
+	this.Ferry.recordFatalError(from, err, class)
 
-	state := make(map[string]interface{})
-	state["LastSuccessfulBinlogPos"] = this.Ferry.BinlogStreamer.GetLastStreamedBinlogPosition()
-	state["LastSuccessfulPrimaryKeys"] = this.Ferry.DataIterator.CurrentState.LastSuccessfulPrimaryKeys()
-	state["CompletedTables"] = this.Ferry.DataIterator.CurrentState.CompletedTables()
+	// The notifications must be delivered before the process panics.
+	if this.Ferry.notifier != nil {
+		event := NotificationFatalError
+		if strings.HasPrefix(from, "binlog") {
+			event = NotificationBinlogError
+		}
 
-	stateBytes, err := json.MarshalIndent(state, "", "  ")
+		this.Ferry.notifier.Notify(event, fmt.Sprintf("%s: %v", from, err))
+		this.Ferry.notifier.Wait()
+	}
+
+	this.Ferry.reportError(from, err, class)
+
+	state := this.Ferry.SerializeState()
+
+	stateBytes, err := state.Dump()
 	if err != nil {
 		logger.WithError(err).Error("failed to dump state, trying dump via logger")
-		logger.WithFields(logrus.Fields(state)).Error("are the states kinda visible?")
+		logger.WithField("state", state).Error("are the states kinda visible?")
 	} else {
 		fmt.Fprintln(os.Stdout, string(stateBytes))
 	}
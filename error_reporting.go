@@ -0,0 +1,373 @@
+package ghostferry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ErrorReporterSentry  = "sentry"
+	ErrorReporterWebhook = "webhook"
+)
+
+type ErrorReportingConfig struct {
+	// Where the errors are reported: sentry or webhook.
+	//
+	// Required
+	Type string
+
+	// The DSN of the Sentry project for sentry, such as
+	// https://<key>@sentry.example.com/<project>, or the URL to which the
+	// ErrorReport is posted as JSON for webhook.
+	//
+	// Required
+	URL string
+
+	// If set, the requests of the webhook are signed with this secret, see
+	// WebhookSignatureHeader.
+	//
+	// Optional: defaults to unsigned requests.
+	Secret string
+
+	// The environment of the reports, such as production.
+	//
+	// Optional: defaults to no environment.
+	Environment string
+
+	// Added to every report, such as the tenant being moved.
+	//
+	// Optional: defaults to no tags.
+	Tags map[string]string
+
+	// The timeout of the request reporting an error. The process waits for
+	// it before exiting.
+	//
+	// Optional: defaults to 10s.
+	Timeout string
+
+	sentryEndpoint string
+	sentryAuth     string
+	timeout        time.Duration
+}
+
+func (c *ErrorReportingConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %s", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL must be an http or https URL, got %s", c.URL)
+	}
+
+	switch c.Type {
+	case ErrorReporterSentry:
+		err = c.parseSentryDSN(u)
+		if err != nil {
+			return err
+		}
+	case ErrorReporterWebhook:
+	default:
+		return fmt.Errorf("invalid Type %s, must be %s or %s", c.Type, ErrorReporterSentry, ErrorReporterWebhook)
+	}
+
+	if c.Timeout == "" {
+		c.Timeout = "10s"
+	}
+
+	c.timeout, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid Timeout: %s", err)
+	}
+
+	return nil
+}
+
+// Finds the store endpoint of the project and the keys of a Sentry DSN.
+func (c *ErrorReportingConfig) parseSentryDSN(dsn *url.URL) error {
+	if dsn.User == nil || dsn.User.Username() == "" {
+		return fmt.Errorf("the sentry DSN has no public key")
+	}
+
+	path := strings.Trim(dsn.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return fmt.Errorf("the sentry DSN has no project")
+	}
+
+	prefix := ""
+	if slash >= 0 {
+		prefix = "/" + path[:slash]
+	}
+
+	c.sentryEndpoint = fmt.Sprintf("%s://%s%s/api/%s/store/", dsn.Scheme, dsn.Host, prefix, project)
+	c.sentryAuth = fmt.Sprintf("Sentry sentry_version=7, sentry_client=ghostferry/%s, sentry_key=%s", VersionString, dsn.User.Username())
+	if secret, exists := dsn.User.Password(); exists {
+		c.sentryAuth += ", sentry_secret=" + secret
+	}
+
+	return nil
+}
+
+// The progress of a table being copied when the error was reported.
+type ErrorReportTable struct {
+	Name             string
+	LastSuccessfulPK uint64
+	TargetPK         uint64
+}
+
+// The JSON body posted by the webhook ErrorReporter, and the context of the
+// events sent to Sentry.
+type ErrorReport struct {
+	Time              time.Time
+	GhostferryVersion string
+	Environment       string            `json:",omitempty"`
+	Tags              map[string]string `json:",omitempty"`
+
+	From    string
+	Class   string
+	Message string
+
+	// Only set for the panics, along with the stack of the goroutine that
+	// panicked.
+	Panic bool
+	Stack string `json:",omitempty"`
+
+	OverallState          string
+	LastStreamedBinlogPos string
+	LastWrittenBinlogPos  string
+	TablesInProgress      []ErrorReportTable
+	CompletedTableCount   int
+}
+
+// ErrorReporter reports the fatal errors and the panics of a run to Sentry
+// or to a webhook, with the state of the ferry, so the failed runs can be
+// investigated without the logs of the process.
+type ErrorReporter struct {
+	Config *ErrorReportingConfig
+
+	logger *logrus.Entry
+	client *http.Client
+}
+
+func (r *ErrorReporter) Initialize() {
+	r.logger = logrus.WithField("tag", "error_reporter")
+	r.client = &http.Client{}
+}
+
+// Reports the error, waiting for the request to complete. The failures to
+// report the error are logged and returned.
+func (r *ErrorReporter) Report(report *ErrorReport) error {
+	report.Environment = r.Config.Environment
+	report.Tags = r.Config.Tags
+
+	var err error
+	if r.Config.Type == ErrorReporterSentry {
+		err = r.reportToSentry(report)
+	} else {
+		err = r.reportToWebhook(report)
+	}
+
+	if err != nil {
+		r.logger.WithError(err).Error("failed to report error")
+		metrics.Count("ErrorReporter.Failed", 1, []MetricTag{{"type", r.Config.Type}}, 1.0)
+	}
+
+	return err
+}
+
+func (r *ErrorReporter) reportToWebhook(report *ErrorReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	if r.Config.Secret != "" {
+		headers[WebhookSignatureHeader] = "sha256=" + SignWebhookBody(r.Config.Secret, body)
+	}
+
+	return r.post(r.Config.URL, headers, body)
+}
+
+func (r *ErrorReporter) reportToSentry(report *ErrorReport) error {
+	body, err := json.Marshal(sentryEvent(report))
+	if err != nil {
+		return err
+	}
+
+	return r.post(r.Config.sentryEndpoint, map[string]string{"X-Sentry-Auth": r.Config.sentryAuth}, body)
+}
+
+func (r *ErrorReporter) post(url string, headers map[string]string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Config.timeout)
+	defer cancel()
+
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return webhookResponseError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+
+	return nil
+}
+
+// Returns the event of the Sentry store API for the report.
+func sentryEvent(report *ErrorReport) map[string]interface{} {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	exceptionType := report.Class
+	if report.Panic {
+		exceptionType = "panic"
+	}
+
+	tags := map[string]string{
+		"errfrom":  report.From,
+		"errclass": report.Class,
+		"state":    report.OverallState,
+	}
+	for name, value := range report.Tags {
+		tags[name] = value
+	}
+
+	extra := map[string]interface{}{
+		"last_streamed_binlog_pos": report.LastStreamedBinlogPos,
+		"last_written_binlog_pos":  report.LastWrittenBinlogPos,
+		"tables_in_progress":       report.TablesInProgress,
+		"completed_table_count":    report.CompletedTableCount,
+	}
+	if report.Stack != "" {
+		extra["stack"] = report.Stack
+	}
+
+	event := map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": report.Time.UTC().Format("2006-01-02T15:04:05"),
+		"level":     "fatal",
+		"logger":    "ghostferry",
+		"platform":  "go",
+		"release":   report.GhostferryVersion,
+		"message":   report.Message,
+		"tags":      tags,
+		"extra":     extra,
+		"exception": map[string]interface{}{
+			"values": []map[string]string{
+				{"type": exceptionType, "value": report.Message, "module": report.From},
+			},
+		},
+	}
+	if report.Environment != "" {
+		event["environment"] = report.Environment
+	}
+
+	return event
+}
+
+// Returns the report of the error with the state of the ferry. The
+// components of the ferry may not be initialized yet.
+func (f *Ferry) newErrorReport(from string, err error, class ErrorClass) *ErrorReport {
+	report := &ErrorReport{
+		Time:              time.Now(),
+		GhostferryVersion: VersionString,
+		From:              from,
+		Class:             string(class),
+		Message:           err.Error(),
+		OverallState:      f.OverallState,
+		TablesInProgress:  []ErrorReportTable{},
+	}
+
+	if f.BinlogStreamer != nil {
+		report.LastStreamedBinlogPos = f.BinlogStreamer.GetLastStreamedBinlogPosition().String()
+	}
+
+	if f.BinlogWriter != nil {
+		report.LastWrittenBinlogPos = f.BinlogWriter.LastWrittenBinlogPosition().String()
+	}
+
+	if f.DataIterator != nil && f.DataIterator.CurrentState != nil {
+		state := f.DataIterator.CurrentState
+		completed := state.CompletedTables()
+		lastSuccessfulPKs := state.LastSuccessfulPrimaryKeys()
+		report.CompletedTableCount = len(completed)
+
+		for table, targetPK := range state.TargetPrimaryKeys() {
+			if completed[table] {
+				continue
+			}
+
+			report.TablesInProgress = append(report.TablesInProgress, ErrorReportTable{
+				Name:             table,
+				LastSuccessfulPK: lastSuccessfulPKs[table],
+				TargetPK:         targetPK,
+			})
+		}
+
+		sort.Slice(report.TablesInProgress, func(i, j int) bool {
+			return report.TablesInProgress[i].Name < report.TablesInProgress[j].Name
+		})
+	}
+
+	return report
+}
+
+// Reports the fatal error with the ErrorReporter of the ferry, if any. Only
+// the first error or panic of the run is reported.
+func (f *Ferry) reportError(from string, err error, class ErrorClass) {
+	if f.errorReporter == nil || !atomic.CompareAndSwapInt32(&f.errorReported, 0, 1) {
+		return
+	}
+
+	f.errorReporter.Report(f.newErrorReport(from, err, class))
+}
+
+// Reports a panic with the ErrorReporter of the ferry before panicking
+// again, when deferred in a goroutine of the ferry. The panics of the
+// PanicErrorHandler are not reported again.
+func (f *Ferry) ReportPanic() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	if f.errorReporter != nil && atomic.CompareAndSwapInt32(&f.errorReported, 0, 1) {
+		report := f.newErrorReport("panic", fmt.Errorf("%v", recovered), ErrorClassUnknown)
+		report.Panic = true
+		report.Stack = string(debug.Stack())
+		f.errorReporter.Report(report)
+	}
+
+	panic(recovered)
+}
@@ -0,0 +1,162 @@
+package ghostferry
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+
+	sqlmysql "github.com/go-sql-driver/mysql"
+)
+
+// The classes of the errors, so the applications embedding Ghostferry can
+// react differently to them, see ClassifyError.
+type ErrorClass string
+
+const (
+	// The connection to a database failed or was lost.
+	ErrorClassNetwork ErrorClass = "network"
+
+	// A table, a column or a database does not match the schema loaded by
+	// Ghostferry, or changed during the run.
+	ErrorClassSchemaMismatch ErrorClass = "schema_mismatch"
+
+	// A value cannot be converted to the type of its column on the target.
+	ErrorClassDataConversion ErrorClass = "data_conversion"
+
+	// The user of a database is missing a privilege.
+	ErrorClassPermission ErrorClass = "permission"
+
+	// The target rejected a write that conflicts with its rows or with
+	// other writes, such as a duplicate key or a lock wait timeout.
+	ErrorClassTargetConflict ErrorClass = "target_conflict"
+
+	// Any other error.
+	ErrorClassUnknown ErrorClass = "unknown"
+)
+
+// ClassifiedError is an error whose class is known where it is returned.
+// The errors of the databases are classified by their codes, see
+// ClassifyError, so they are only wrapped by Ghostferry to keep their class
+// when context is added to their message.
+type ClassifiedError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func NewClassifiedError(class ErrorClass, err error) error {
+	return &ClassifiedError{Class: class, Err: err}
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+// Returns the wrapped error, like the errors of github.com/pkg/errors.
+func (e *ClassifiedError) Cause() error {
+	return e.Err
+}
+
+// The MySQL error codes of every class.
+var mysqlErrorClasses = map[uint16]ErrorClass{
+	1040: ErrorClassNetwork, // ER_CON_COUNT_ERROR
+	1053: ErrorClassNetwork, // ER_SERVER_SHUTDOWN
+	1152: ErrorClassNetwork, // ER_ABORTING_CONNECTION
+	1158: ErrorClassNetwork, // ER_NET_READ_ERROR
+	1159: ErrorClassNetwork, // ER_NET_READ_INTERRUPTED
+	1160: ErrorClassNetwork, // ER_NET_ERROR_ON_WRITE
+	1161: ErrorClassNetwork, // ER_NET_WRITE_INTERRUPTED
+
+	1049: ErrorClassSchemaMismatch, // ER_BAD_DB_ERROR
+	1054: ErrorClassSchemaMismatch, // ER_BAD_FIELD_ERROR
+	1136: ErrorClassSchemaMismatch, // ER_WRONG_VALUE_COUNT_ON_ROW
+	1146: ErrorClassSchemaMismatch, // ER_NO_SUCH_TABLE
+	1364: ErrorClassSchemaMismatch, // ER_NO_DEFAULT_FOR_FIELD
+	3105: ErrorClassSchemaMismatch, // ER_NON_DEFAULT_VALUE_FOR_GENERATED_COLUMN
+
+	1048: ErrorClassDataConversion, // ER_BAD_NULL_ERROR
+	1264: ErrorClassDataConversion, // ER_WARN_DATA_OUT_OF_RANGE
+	1265: ErrorClassDataConversion, // WARN_DATA_TRUNCATED
+	1292: ErrorClassDataConversion, // ER_TRUNCATED_WRONG_VALUE
+	1366: ErrorClassDataConversion, // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+	1406: ErrorClassDataConversion, // ER_DATA_TOO_LONG
+	1411: ErrorClassDataConversion, // ER_WRONG_VALUE_FOR_TYPE
+	3140: ErrorClassDataConversion, // ER_INVALID_JSON_TEXT
+
+	1044: ErrorClassPermission, // ER_DBACCESS_DENIED_ERROR
+	1045: ErrorClassPermission, // ER_ACCESS_DENIED_ERROR
+	1142: ErrorClassPermission, // ER_TABLEACCESS_DENIED_ERROR
+	1143: ErrorClassPermission, // ER_COLUMNACCESS_DENIED_ERROR
+	1227: ErrorClassPermission, // ER_SPECIFIC_ACCESS_DENIED_ERROR
+	1290: ErrorClassPermission, // ER_OPTION_PREVENTS_STATEMENT, such as read_only
+	1698: ErrorClassPermission, // ER_ACCESS_DENIED_NO_PASSWORD_ERROR
+
+	1062: ErrorClassTargetConflict, // ER_DUP_ENTRY
+	1205: ErrorClassTargetConflict, // ER_LOCK_WAIT_TIMEOUT
+	1213: ErrorClassTargetConflict, // ER_LOCK_DEADLOCK
+	1451: ErrorClassTargetConflict, // ER_ROW_IS_REFERENCED_2
+	1452: ErrorClassTargetConflict, // ER_NO_REFERENCED_ROW_2
+	1586: ErrorClassTargetConflict, // ER_DUP_ENTRY_WITH_KEY_NAME
+}
+
+type causer interface {
+	Cause() error
+}
+
+// Returns the class of the error: the class of the first ClassifiedError
+// it wraps, or the class of the MySQL error or of the connection error it
+// wraps, if any. The errors wrapped with the Cause method, such as the
+// errors of github.com/pkg/errors and github.com/juju/errors, are
+// unwrapped.
+func ClassifyError(err error) ErrorClass {
+	for err != nil {
+		switch e := err.(type) {
+		case *ClassifiedError:
+			return e.Class
+		case *sqlmysql.MySQLError:
+			if class, exists := mysqlErrorClasses[e.Number]; exists {
+				return class
+			}
+			return ErrorClassUnknown
+		case net.Error:
+			return ErrorClassNetwork
+		}
+
+		if err == driver.ErrBadConn || err == sqlmysql.ErrInvalidConn || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrorClassNetwork
+		}
+
+		wrapper, ok := err.(causer)
+		if !ok {
+			break
+		}
+
+		cause := wrapper.Cause()
+		if cause == err {
+			break
+		}
+		err = cause
+	}
+
+	return ErrorClassUnknown
+}
+
+// Adds context to the message of the error, as fmt.Errorf(format + ": %v"),
+// without losing its class.
+func wrapError(err error, format string, args ...interface{}) error {
+	wrapped := fmt.Errorf(format+": %v", append(args, err)...)
+
+	class := ClassifyError(err)
+	if class == ErrorClassUnknown {
+		return wrapped
+	}
+	return NewClassifiedError(class, wrapped)
+}
+
+// Counts the fatal error by class, so the classes of the failures of the
+// runs can be monitored.
+func countFatalError(from string, err error) ErrorClass {
+	class := ClassifyError(err)
+	metrics.Count("FatalError", 1, []MetricTag{{"from", from}, {"class", string(class)}}, 1.0)
+	return class
+}
@@ -0,0 +1,664 @@
+package ghostferry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// An expression evaluated against the old and new values of a DMLEvent. The
+// syntax is a small subset of CEL:
+//
+//	new.status != 'draft' && (old.amount > 100 || new.amount > 100)
+//
+// Columns are referenced as old.<column> and new.<column>. The values of the
+// side of the event that does not exist (old for inserts, new for deletes)
+// are null. Supported literals are strings in single or double quotes,
+// numbers, true, false and null. Supported operators are ==, !=, <, <=, >,
+// >=, &&, || and !. ENUM and SET values compare as their strings, and the
+// temporal values as strings in the format of MySQL, as in
+// new.created_at >= '2018-01-31'.
+type EventExpression struct {
+	source string
+	root   expressionNode
+}
+
+func CompileEventExpression(source string) (*EventExpression, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &expressionParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.peek().text, p.peek().offset)
+	}
+
+	return &EventExpression{source: source, root: root}, nil
+}
+
+func (e *EventExpression) String() string {
+	return e.source
+}
+
+// Checks that all the columns referenced by the expression exist in the
+// table.
+func (e *EventExpression) Validate(table *schema.Table) error {
+	return e.root.validate(table)
+}
+
+func (e *EventExpression) Matches(ev DMLEvent) (bool, error) {
+	value, err := e.root.eval(ev)
+	if err != nil {
+		return false, err
+	}
+
+	matches, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q evaluated to %v instead of a boolean", e.source, value)
+	}
+
+	return matches, nil
+}
+
+// Filters binlog events using an expression per table. Events for tables
+// without an expression are always applicable.
+type ExpressionEventFilter struct {
+	// Keyed by the full table name, i.e. schema.table.
+	Expressions map[string]*EventExpression
+}
+
+func NewExpressionEventFilter(expressions map[string]string) (*ExpressionEventFilter, error) {
+	filter := &ExpressionEventFilter{
+		Expressions: make(map[string]*EventExpression),
+	}
+
+	for table, source := range expressions {
+		expression, err := CompileEventExpression(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression for table %s: %v", table, err)
+		}
+
+		filter.Expressions[table] = expression
+	}
+
+	return filter, nil
+}
+
+func (f *ExpressionEventFilter) Validate(tables TableSchemaCache) error {
+	for tableName, expression := range f.Expressions {
+		table, exists := tables[tableName]
+		if !exists {
+			return fmt.Errorf("expression given for table %s which is not being ferried", tableName)
+		}
+
+		if err := expression.Validate(table); err != nil {
+			return fmt.Errorf("invalid expression for table %s: %v", tableName, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the events to apply to the target for the event, which are none if
+// the event is filtered out.
+//
+// A row is within the filter if the expression matches when the row is both
+// the old and new values. An update of a row leaving the filter is applied as
+// a delete of the row, as the row would otherwise be left stale on the
+// target. An update of a row entering the filter is applied as a delete of
+// the old row followed by an insert of the new row: the row is usually on the
+// target already, as the DataIterator copies the rows regardless of the
+// expressions, but not if it left the filter before. Other events are applied
+// if the expression matches them.
+func (f *ExpressionEventFilter) FilterEvent(ev DMLEvent) ([]DMLEvent, error) {
+	expression, exists := f.Expressions[ev.TableSchema().String()]
+	if !exists {
+		return []DMLEvent{ev}, nil
+	}
+
+	if update, ok := ev.(*BinlogUpdateEvent); ok {
+		oldWithin, err := expression.Matches(rowImageEvent{ev, update.oldValues})
+		if err != nil {
+			return nil, err
+		}
+
+		newWithin, err := expression.Matches(rowImageEvent{ev, update.newValues})
+		if err != nil {
+			return nil, err
+		}
+
+		if oldWithin && !newWithin {
+			return []DMLEvent{
+				&BinlogDeleteEvent{oldValues: update.oldValues, DMLEventBase: update.DMLEventBase},
+			}, nil
+		}
+
+		if !oldWithin && newWithin {
+			return []DMLEvent{
+				&BinlogDeleteEvent{oldValues: update.oldValues, DMLEventBase: update.DMLEventBase},
+				&BinlogInsertEvent{newValues: update.newValues, DMLEventBase: update.DMLEventBase},
+			}, nil
+		}
+	}
+
+	matches, err := expression.Matches(ev)
+	if err != nil || !matches {
+		return nil, err
+	}
+
+	return []DMLEvent{ev}, nil
+}
+
+// An event whose old and new values are both the given row, used to check
+// whether a row is within a filter.
+type rowImageEvent struct {
+	DMLEvent
+	row RowData
+}
+
+func (e rowImageEvent) OldValues() RowData {
+	return e.row
+}
+
+func (e rowImageEvent) NewValues() RowData {
+	return e.row
+}
+
+type expressionNode interface {
+	eval(DMLEvent) (interface{}, error)
+	validate(*schema.Table) error
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(DMLEvent) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n literalNode) validate(*schema.Table) error {
+	return nil
+}
+
+type columnNode struct {
+	useNew bool
+	column string
+}
+
+func (n columnNode) eval(ev DMLEvent) (interface{}, error) {
+	columnIndex := ev.TableSchema().FindColumn(n.column)
+	if columnIndex < 0 {
+		return nil, fmt.Errorf("table %s has no column %s", ev.TableSchema().String(), n.column)
+	}
+
+	values := ev.OldValues()
+	if n.useNew {
+		values = ev.NewValues()
+	}
+
+	if values == nil {
+		return nil, nil
+	}
+
+	if columnIndex >= len(values) {
+		return nil, fmt.Errorf("event for table %s has no value for column %s", ev.TableSchema().String(), n.column)
+	}
+
+	return normalizeExpressionValue(&ev.TableSchema().Columns[columnIndex], values[columnIndex]), nil
+}
+
+func (n columnNode) validate(table *schema.Table) error {
+	if table.FindColumn(n.column) < 0 {
+		return fmt.Errorf("table %s has no column %s", table.String(), n.column)
+	}
+	return nil
+}
+
+type notNode struct {
+	operand expressionNode
+}
+
+func (n notNode) eval(ev DMLEvent) (interface{}, error) {
+	value, err := n.operand.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! expects a boolean, got %v", value)
+	}
+
+	return !b, nil
+}
+
+func (n notNode) validate(table *schema.Table) error {
+	return n.operand.validate(table)
+}
+
+type binaryNode struct {
+	operator    string
+	left, right expressionNode
+}
+
+func (n binaryNode) validate(table *schema.Table) error {
+	if err := n.left.validate(table); err != nil {
+		return err
+	}
+	return n.right.validate(table)
+}
+
+func (n binaryNode) eval(ev DMLEvent) (interface{}, error) {
+	left, err := n.left.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || short circuit so that the right hand side can be used to
+	// guard against nulls on the left hand side and vice versa.
+	if n.operator == "&&" || n.operator == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans, got %v", n.operator, left)
+		}
+
+		if (n.operator == "&&" && !l) || (n.operator == "||" && l) {
+			return l, nil
+		}
+
+		right, err := n.right.eval(ev)
+		if err != nil {
+			return nil, err
+		}
+
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects booleans, got %v", n.operator, right)
+		}
+
+		return r, nil
+	}
+
+	right, err := n.right.eval(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	if left == nil || right == nil {
+		switch n.operator {
+		case "==":
+			return left == right, nil
+		case "!=":
+			return left != right, nil
+		default:
+			// Ordering comparisons with null are never true, like in SQL.
+			return false, nil
+		}
+	}
+
+	cmp, err := compareExpressionValues(left, right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+
+	return nil, fmt.Errorf("unknown operator %s", n.operator)
+}
+
+// Converts the values found in DMLEvents into one of nil, bool, string or
+// decimal.Decimal so they can be compared with the literals. The binlog gives
+// the index of ENUM values and the bitmask of SET values, which are converted
+// to their strings, and the temporal values are converted to strings in the
+// format MySQL uses for them, such as '2018-01-31 10:00:00'.
+func normalizeExpressionValue(column *schema.TableColumn, value interface{}) interface{} {
+	if isNilValue(value) {
+		return nil
+	}
+
+	switch column.Type {
+	case schema.TYPE_ENUM:
+		if index, ok := Int64Value(value); ok {
+			// 0 is the index of the empty string inserted for invalid
+			// values in non strict mode.
+			if index <= 0 || int(index) > len(column.EnumValues) {
+				return ""
+			}
+			return column.EnumValues[index-1]
+		}
+	case schema.TYPE_SET:
+		if bitmask, ok := setBitmask(value); ok {
+			var members []string
+			for i, member := range column.SetValues {
+				if bitmask&(1<<uint(i)) != 0 {
+					members = append(members, member)
+				}
+			}
+			return strings.Join(members, ",")
+		}
+	}
+
+	if t, ok := value.(time.Time); ok {
+		return formatExpressionTime(column, t)
+	}
+
+	if uintv, ok := Uint64Value(value); ok {
+		// Cannot fail as the string is always a valid integer.
+		d, _ := decimal.NewFromString(strconv.FormatUint(uintv, 10))
+		return d
+	}
+
+	if intv, ok := Int64Value(value); ok {
+		return decimal.New(intv, 0)
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case float64:
+		return decimal.NewFromFloat(v)
+	case float32:
+		return decimal.NewFromFloat(float64(v))
+	case decimal.Decimal:
+		return v
+	}
+
+	return value
+}
+
+func formatExpressionTime(column *schema.TableColumn, t time.Time) string {
+	if column.Type == schema.TYPE_DATE {
+		return t.Format("2006-01-02")
+	}
+
+	layout := "2006-01-02 15:04:05"
+
+	// The fractional seconds are formatted with the precision of the column,
+	// as in datetime(6).
+	if start := strings.Index(column.RawType, "("); start >= 0 {
+		precision, err := strconv.Atoi(strings.TrimSuffix(column.RawType[start+1:], ")"))
+		if err == nil && precision > 0 {
+			layout += "." + strings.Repeat("0", precision)
+		}
+	}
+
+	return t.Format(layout)
+}
+
+func compareExpressionValues(left, right interface{}) (int, error) {
+	switch l := left.(type) {
+	case decimal.Decimal:
+		if r, ok := right.(decimal.Decimal); ok {
+			return l.Cmp(r), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			if l == r {
+				return 0, nil
+			}
+			if !l {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %v (%T) with %v (%T)", left, left, right, right)
+}
+
+type expressionTokenKind int
+
+const (
+	tokenIdentifier expressionTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type expressionToken struct {
+	kind   expressionTokenKind
+	text   string
+	offset int
+}
+
+var expressionOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "."}
+
+func tokenizeExpression(source string) ([]expressionToken, error) {
+	var tokens []expressionToken
+
+	i := 0
+	for i < len(source) {
+		c := rune(source[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			var value []byte
+			for ; i < len(source) && rune(source[i]) != c; i++ {
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				value = append(value, source[i])
+			}
+
+			if i >= len(source) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+
+			i++
+			tokens = append(tokens, expressionToken{tokenString, string(value), start})
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(source) && unicode.IsDigit(rune(source[i+1]))):
+			start := i
+			i++
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, expressionToken{tokenNumber, source[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(source) && (unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i])) || source[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, expressionToken{tokenIdentifier, source[start:i], start})
+		default:
+			matched := false
+			for _, operator := range expressionOperators {
+				if strings.HasPrefix(source[i:], operator) {
+					tokens = append(tokens, expressionToken{tokenOperator, operator, i})
+					i += len(operator)
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+
+	return tokens, nil
+}
+
+type expressionParser struct {
+	tokens []expressionToken
+	pos    int
+}
+
+func (p *expressionParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *expressionParser) peek() expressionToken {
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) acceptOperator(operators ...string) (string, bool) {
+	if p.done() || p.peek().kind != tokenOperator {
+		return "", false
+	}
+
+	for _, operator := range operators {
+		if p.peek().text == operator {
+			p.pos++
+			return operator, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *expressionParser) parseOr() (expressionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.acceptOperator("||"); !ok {
+			return left, nil
+		}
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{"||", left, right}
+	}
+}
+
+func (p *expressionParser) parseAnd() (expressionNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.acceptOperator("&&"); !ok {
+			return left, nil
+		}
+
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{"&&", left, right}
+	}
+}
+
+func (p *expressionParser) parseComparison() (expressionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, ok := p.acceptOperator("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return binaryNode{operator, left, right}, nil
+}
+
+func (p *expressionParser) parseUnary() (expressionNode, error) {
+	if _, ok := p.acceptOperator("!"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (expressionNode, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	if _, ok := p.acceptOperator("("); ok {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := p.acceptOperator(")"); !ok {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+
+		return node, nil
+	}
+
+	token := p.peek()
+	p.pos++
+
+	switch token.kind {
+	case tokenString:
+		return literalNode{token.text}, nil
+	case tokenNumber:
+		value, err := decimal.NewFromString(token.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", token.text, token.offset)
+		}
+		return literalNode{value}, nil
+	case tokenIdentifier:
+		switch token.text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null":
+			return literalNode{nil}, nil
+		case "old", "new":
+			if _, ok := p.acceptOperator("."); !ok || p.done() || p.peek().kind != tokenIdentifier {
+				return nil, fmt.Errorf("expected a column name after %s. at offset %d", token.text, token.offset)
+			}
+
+			column := p.peek().text
+			p.pos++
+			return columnNode{useNew: token.text == "new", column: column}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected %q at offset %d", token.text, token.offset)
+}
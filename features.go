@@ -0,0 +1,280 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	FlavorMySQL   = "mysql"
+	FlavorMariaDB = "mariadb"
+)
+
+var serverVersionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+type ServerVersion struct {
+	Raw    string
+	Flavor string
+	Major  int
+	Minor  int
+	Patch  int
+}
+
+// Parses the value of @@version, such as 8.0.32-log or 10.6.12-MariaDB-log.
+func ParseServerVersion(version string) (ServerVersion, error) {
+	v := ServerVersion{Raw: version, Flavor: FlavorMySQL}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		v.Flavor = FlavorMariaDB
+
+		// Some proxies prefix the MariaDB versions with 5.5.5- for the
+		// clients that only expect MySQL versions.
+		version = strings.TrimPrefix(version, "5.5.5-")
+	}
+
+	matches := serverVersionRegexp.FindStringSubmatch(version)
+	if matches == nil {
+		return v, fmt.Errorf("cannot parse server version %s", version)
+	}
+
+	v.Major, _ = strconv.Atoi(matches[1])
+	v.Minor, _ = strconv.Atoi(matches[2])
+	v.Patch, _ = strconv.Atoi(matches[3])
+	return v, nil
+}
+
+func (v ServerVersion) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+func (v ServerVersion) String() string {
+	return fmt.Sprintf("%s %d.%d.%d", v.Flavor, v.Major, v.Minor, v.Patch)
+}
+
+// The version and the replication settings of a server, as detected when the
+// ferry is initialized. The settings that do not exist on the server are
+// empty.
+type ServerFeatures struct {
+	Version ServerVersion
+
+	GTIDMode               string
+	EnforceGTIDConsistency string
+	BinlogFormat           string
+	BinlogRowImage         string
+	BinlogRowValueOptions  string
+
+	// MariaDB only.
+	BinlogCompress string
+}
+
+func DetectServerFeatures(db *sql.DB) (*ServerFeatures, error) {
+	var version string
+	err := db.QueryRow("SELECT @@version").Scan(&version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server version: %v", err)
+	}
+
+	features := &ServerFeatures{}
+	features.Version, err = ParseServerVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := map[string]*string{
+		"gtid_mode":                &features.GTIDMode,
+		"enforce_gtid_consistency": &features.EnforceGTIDConsistency,
+		"binlog_format":            &features.BinlogFormat,
+		"binlog_row_image":         &features.BinlogRowImage,
+		"binlog_row_value_options": &features.BinlogRowValueOptions,
+		"log_bin_compress":         &features.BinlogCompress,
+	}
+
+	for variable, value := range variables {
+		var name string
+		err = db.QueryRow(fmt.Sprintf("SHOW VARIABLES LIKE '%s'", variable)).Scan(&name, value)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", variable, err)
+		}
+		*value = strings.ToUpper(*value)
+	}
+
+	return features, nil
+}
+
+// Whether the server has MySQL GTIDs, which ghostferry can use to compare the
+// progress of replicas. The GTIDs of MariaDB have a different format.
+func (f *ServerFeatures) GTIDEnabled() bool {
+	return f.Version.Flavor == FlavorMySQL && f.GTIDMode == "ON"
+}
+
+// Whether CREATE TEMPORARY TABLE is rejected inside transactions, which is
+// the case with enforce_gtid_consistency before MySQL 8.0.13.
+func (f *ServerFeatures) RejectsTemporaryTablesInTransactions() bool {
+	return f.Version.Flavor == FlavorMySQL && f.EnforceGTIDConsistency == "ON" && !f.Version.AtLeast(8, 0, 13)
+}
+
+func (f *ServerFeatures) SupportsJSON() bool {
+	if f.Version.Flavor == FlavorMariaDB {
+		return f.Version.AtLeast(10, 2, 7)
+	}
+	return f.Version.AtLeast(5, 7, 8)
+}
+
+func (f *ServerFeatures) SupportsGeneratedColumns() bool {
+	if f.Version.Flavor == FlavorMariaDB {
+		return f.Version.AtLeast(5, 2, 0)
+	}
+	return f.Version.AtLeast(5, 7, 6)
+}
+
+func (f *ServerFeatures) SupportsInvisiblePrimaryKeys() bool {
+	return f.Version.Flavor == FlavorMySQL && f.Version.AtLeast(8, 0, 30)
+}
+
+// FeatureReport is the compatibility matrix of the source and the target,
+// with the ghostferry features that were disabled because the detected
+// servers cannot support them.
+type FeatureReport struct {
+	Source *ServerFeatures
+
+	// Nil if the target is not MySQL.
+	Target *ServerFeatures
+
+	mutex    sync.Mutex
+	disabled []string
+}
+
+// Records that a feature was disabled and why.
+func (r *FeatureReport) Disable(feature, reason string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.disabled = append(r.disabled, fmt.Sprintf("%s: %s", feature, reason))
+}
+
+func (r *FeatureReport) Disabled() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.disabled...)
+}
+
+// Formats the report as a table with a row per feature and a column per
+// server, followed by the disabled features.
+func (r *FeatureReport) Matrix() string {
+	rows := [][]string{{"feature", "source", "target"}}
+
+	describe := func(name string, value func(*ServerFeatures) string) {
+		row := []string{name}
+		for _, features := range []*ServerFeatures{r.Source, r.Target} {
+			if features == nil {
+				row = append(row, "n/a")
+			} else {
+				row = append(row, value(features))
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	setting := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+		return value
+	}
+
+	yesNo := func(supported bool) string {
+		if supported {
+			return "yes"
+		}
+		return "no"
+	}
+
+	describe("version", func(f *ServerFeatures) string { return f.Version.String() })
+	describe("gtid_mode", func(f *ServerFeatures) string { return setting(f.GTIDMode) })
+	describe("enforce_gtid_consistency", func(f *ServerFeatures) string { return setting(f.EnforceGTIDConsistency) })
+	describe("binlog_format", func(f *ServerFeatures) string { return setting(f.BinlogFormat) })
+	describe("binlog_row_image", func(f *ServerFeatures) string { return setting(f.BinlogRowImage) })
+	describe("binlog_row_value_options", func(f *ServerFeatures) string { return setting(f.BinlogRowValueOptions) })
+	describe("log_bin_compress", func(f *ServerFeatures) string { return setting(f.BinlogCompress) })
+	describe("json", func(f *ServerFeatures) string { return yesNo(f.SupportsJSON()) })
+	describe("generated columns", func(f *ServerFeatures) string { return yesNo(f.SupportsGeneratedColumns()) })
+	describe("invisible primary keys", func(f *ServerFeatures) string { return yesNo(f.SupportsInvisiblePrimaryKeys()) })
+
+	widths := make([]int, 3)
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(rows)+1)
+	for _, row := range rows {
+		line := fmt.Sprintf("%-*s  %-*s  %s", widths[0], row[0], widths[1], row[1], row[2])
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+
+	for _, disabled := range r.Disabled() {
+		lines = append(lines, "disabled "+disabled)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Detects the features of the source and the target, and disables the
+// features of the ferry that the servers cannot support. Returns an error if
+// the source writes binlog events that ghostferry cannot apply.
+func (f *Ferry) detectFeatures() error {
+	report := &FeatureReport{}
+
+	var err error
+	report.Source, err = DetectServerFeatures(f.SourceDB)
+	if err != nil {
+		return fmt.Errorf("source: %v", err)
+	}
+
+	if f.targetDialect.Name() == DialectMySQL {
+		report.Target, err = DetectServerFeatures(f.TargetDB)
+		if err != nil {
+			return fmt.Errorf("target: %v", err)
+		}
+	}
+
+	// Partial JSON updates only contain the modified paths of the
+	// documents, which cannot be written as row images.
+	if strings.Contains(report.Source.BinlogRowValueOptions, "PARTIAL_JSON") {
+		return fmt.Errorf("binlog_row_value_options must not include PARTIAL_JSON on the source")
+	}
+
+	// The compressed rows events of MariaDB cannot be decoded.
+	if report.Source.BinlogCompress == "ON" {
+		return fmt.Errorf("log_bin_compress must be OFF on the source")
+	}
+
+	if f.Config.StageRowBatches && report.Target != nil && report.Target.RejectsTemporaryTablesInTransactions() {
+		f.Config.StageRowBatches = false
+		report.Disable("StageRowBatches", "the target enforces GTID consistency, which rejects temporary tables in transactions before MySQL 8.0.13")
+	}
+
+	f.FeatureReport = report
+	f.logger.Infof("detected server features:\n%s", report.Matrix())
+	for _, disabled := range report.Disabled() {
+		f.logger.Warnf("disabled %s", disabled)
+	}
+
+	return nil
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -22,8 +25,10 @@ const (
 	StateStarting          = "starting"
 	StateCopying           = "copying"
 	StateWaitingForCutover = "wait-for-cutover"
+	StateReplicating       = "replicating"
 	StateCutover           = "cutover"
 	StateDone              = "done"
+	StateInterrupted       = "interrupted"
 )
 
 func quoteField(field string) string {
@@ -46,15 +51,44 @@ type Ferry struct {
 	SourceDB *sql.DB
 	TargetDB *sql.DB
 
+	// The replica of the source the rows are copied from, see
+	// Config.ReadReplica. Only set if the ReadReplica is configured.
+	ReadReplicaDB *sql.DB
+
 	BinlogStreamer *BinlogStreamer
 	BinlogWriter   *BinlogWriter
 
 	DataIterator *DataIterator
 	BatchWriter  *BatchWriter
 
+	// Write the copied rows and the binlog events to the target. Default
+	// to the BatchWriter and the BinlogWriter, or to the writer plugins
+	// selected in Config.Plugins.
+	RowBatchWriter RowBatchWriter
+	DMLEventWriter DMLEventWriter
+
+	// The middlewares the binlog events go through before the
+	// DMLEventWriter, see DMLEventMiddleware. Those of
+	// Config.DMLEventMiddlewares are appended by Initialize, and the chain
+	// is built by Start.
+	DMLEventMiddlewares []DMLEventMiddleware
+
 	ErrorHandler ErrorHandler
 	Throttler    Throttler
 
+	// The reads from the source and the writes to the target can be
+	// throttled independently, for instance based on the replication lag of
+	// the replicas of the source and of the target respectively. Both
+	// default to the Throttler.
+	ReadThrottler  Throttler
+	WriteThrottler Throttler
+
+	// Limit the rate of the writes to the target during the copy and the
+	// binlog streaming respectively. The limits can be changed while the
+	// ferry is running.
+	CopyRateLimiter   *RateLimiter
+	BinlogRateLimiter *RateLimiter
+
 	Tables TableSchemaCache
 
 	StartTime    time.Time
@@ -63,9 +97,75 @@ type Ferry struct {
 
 	WaitUntilReplicaIsCaughtUpToMaster *WaitUntilReplicaIsCaughtUpToMaster
 
+	// The versions and features of the source and the target, detected when
+	// the ferry is initialized.
+	FeatureReport *FeatureReport
+
+	// Monitors the binlog buffer of the BinlogWriter. The queues of the
+	// other components, such as the IterativeVerifier, can be added to it.
+	QueueDepthMonitor *QueueDepthMonitor
+
+	// Set if Config.MaxMemoryBytes is set.
+	MemoryBudget *MemoryBudget
+
+	// Pauses the copy, the binlog writer and the verifier independently of
+	// each other, as set through the ControlServer.
+	Pauser *ComponentPauser
+
+	// If set, the progress of the verifier is included in the state returned
+	// by SerializeState, so a resumed run can continue the verification.
+	IterativeVerifier *IterativeVerifier
+
+	// The times of the events of the streamed binlog positions, kept in the
+	// state.
+	BinlogTimeline *BinlogTimeline
+
 	logger *logrus.Entry
+	hooks  ferryHooks
 
 	rowCopyCompleteCh chan struct{}
+
+	interruptOnce sync.Once
+	interruptedCh chan struct{}
+
+	targetDialect SQLDialect
+
+	checkpointer        *Checkpointer
+	schemaDriftDetector *SchemaDriftDetector
+	targetRowGuard      *TargetRowGuard
+	auditSink           *AuditSink
+	deadLetterSink      *DeadLetterSink
+	pkRemapper          *PrimaryKeyRemapper
+	progressReporter    *ProgressReporter
+	notifier            *Notifier
+	errorReporter       *ErrorReporter
+	throttleScheduler   *ThrottleScheduler
+	errorReported       int32
+
+	ignoredRows  *IgnoredRowsCounter
+	targetWrites *TargetWriteCounter
+
+	deferredIndexesMutex sync.Mutex
+	deferredIndexes      []DeferredIndex
+
+	snapshot         *SourceSnapshot
+	snapshotGuard    *SnapshotGuard
+	snapshotCopiedCh chan struct{}
+
+	// The connections to the target of the BatchWriter and the
+	// BinlogWriter, without the foreign key checks with the deferred
+	// Config.ForeignKeyCopyMode, or the TargetDB otherwise.
+	writerTargetDB *sql.DB
+
+	// The foreign keys of the ferried tables, loaded by Start if needed by
+	// Config.StrictForeignKeyOrdering or Config.ForeignKeyCopyMode.
+	foreignKeys []ForeignKey
+
+	// The storage engines of the tables skipped because of
+	// Config.IgnoredStorageEngines, keyed by the full table name.
+	skippedEngineTables map[string]string
+
+	fatalError fatalErrorRecord
 }
 
 func (f *Ferry) newDataIterator() (*DataIterator, error) {
@@ -73,13 +173,24 @@ func (f *Ferry) newDataIterator() (*DataIterator, error) {
 		DB:          f.SourceDB,
 		Concurrency: f.Config.DataIterationConcurrency,
 
+		TableConcurrency: f.Config.DataIterationTableConcurrency,
+		TableOrder:       f.Config.DataIterationOrder,
+		TableOrderList:   f.Config.DataIterationTableOrder,
+		TableBatchSizes:  f.Config.DataIterationTableBatchSizes,
+		ByPartition:      f.Config.DataIterationByPartition,
+		Indexes:          f.Config.DataIterationIndexes,
+
 		ErrorHandler: f.ErrorHandler,
+		MemoryBudget: f.MemoryBudget,
+		Pauser:       f.Pauser,
+		ReportPanic:  f.ReportPanic,
 		CursorConfig: &CursorConfig{
 			DB:        f.SourceDB,
-			Throttler: f.Throttler,
+			Throttler: f.ReadThrottler,
 
-			BatchSize:   f.Config.DataIterationBatchSize,
-			ReadRetries: f.Config.DBReadRetries,
+			BatchSize:       f.Config.DataIterationBatchSize,
+			ReadRetries:     f.Config.DBReadRetries,
+			ReadRetryPolicy: f.Config.RetryPolicies.Read,
 		},
 	}
 
@@ -87,20 +198,74 @@ func (f *Ferry) newDataIterator() (*DataIterator, error) {
 		dataIterator.CursorConfig.BuildSelect = f.CopyFilter.BuildSelect
 	}
 
+	if f.Config.DataIterationTargetBatchDuration != "" || f.Config.DataIterationMaxBatchBytes > 0 || f.Config.DataIterationLargeRowBytes > 0 {
+		sizer := &AdaptiveBatchSizer{
+			MaxBatchBytes: f.Config.DataIterationMaxBatchBytes,
+			LargeRowBytes: f.Config.DataIterationLargeRowBytes,
+			MinBatchSize:  f.Config.DataIterationMinBatchSize,
+			MaxBatchSize:  f.Config.DataIterationMaxBatchSize,
+		}
+
+		if f.Config.DataIterationTargetBatchDuration != "" {
+			targetDuration, err := time.ParseDuration(f.Config.DataIterationTargetBatchDuration)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DataIterationTargetBatchDuration: %v", err)
+			}
+			sizer.TargetDuration = targetDuration
+		}
+
+		dataIterator.CursorConfig.BatchSizer = sizer
+	}
+
 	err := dataIterator.Initialize()
-	return dataIterator, err
+	if err != nil {
+		return nil, err
+	}
+
+	for table, weight := range f.Config.DataIterationTableWeights {
+		err = dataIterator.Scheduler.SetTableWeight(table, weight)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dataIterator, nil
 }
 
 // Initialize all the components of Ghostferry and connect to the Database
 func (f *Ferry) Initialize() (err error) {
 	f.StartTime = time.Now().Truncate(time.Second)
-	f.OverallState = StateStarting
+	f.setState(StateStarting)
+
+	err = ConfigureLogging(f.Config)
+	if err != nil {
+		return err
+	}
 
 	f.logger = logrus.WithField("tag", "ferry")
 	f.rowCopyCompleteCh = make(chan struct{})
+	f.interruptedCh = make(chan struct{})
 
 	f.logger.Infof("hello world from %s", VersionString)
 
+	webhooks := f.Config.Webhooks
+	if f.Config.Slack != nil {
+		webhooks = append(append([]*WebhookConfig{}, webhooks...), f.Config.Slack.Webhook())
+	}
+
+	if len(webhooks) > 0 {
+		f.notifier = &Notifier{
+			Webhooks: webhooks,
+			State:    func() string { return f.OverallState },
+		}
+		f.notifier.Initialize()
+	}
+
+	if f.Config.ErrorReporting != nil {
+		f.errorReporter = &ErrorReporter{Config: f.Config.ErrorReporting}
+		f.errorReporter.Initialize()
+	}
+
 	// Connect to the database
 	f.SourceDB, err = f.Source.SqlDB(f.logger.WithField("dbname", "source"))
 	if err != nil {
@@ -120,18 +285,60 @@ func (f *Ferry) Initialize() (err error) {
 		return err
 	}
 
-	f.TargetDB, err = f.Target.SqlDB(f.logger.WithField("dbname", "target"))
+	if f.Config.ReadReplica != nil {
+		f.ReadReplicaDB, err = f.Config.ReadReplica.Replica.SqlDB(f.logger.WithField("dbname", "read_replica"))
+		if err != nil {
+			f.logger.WithError(err).Error("failed to connect to read replica")
+			return err
+		}
+
+		err = checkConnection(f.logger, "read_replica", f.ReadReplicaDB)
+		if err != nil {
+			f.logger.WithError(err).Error("read replica connection checking failed")
+			return err
+		}
+	}
+
+	f.targetDialect, err = NewSQLDialect(f.Config.TargetDialect)
+	if err != nil {
+		return err
+	}
+
+	if f.targetDialect.Name() == DialectPostgreSQL {
+		f.TargetDB, err = f.Target.PostgreSQLDB(f.logger.WithField("dbname", "target"))
+	} else {
+		f.TargetDB, err = f.Target.SqlDB(f.logger.WithField("dbname", "target"))
+	}
 	if err != nil {
 		f.logger.WithError(err).Error("failed to connect to target database")
 		return err
 	}
 
-	err = checkConnection(f.logger, "target", f.TargetDB)
+	if f.targetDialect.Name() != DialectMySQL {
+		err = f.TargetDB.Ping()
+	} else {
+		err = checkConnection(f.logger, "target", f.TargetDB)
+	}
 	if err != nil {
 		f.logger.WithError(err).Error("target connection checking failed")
 		return err
 	}
 
+	f.writerTargetDB = f.TargetDB
+	if f.Config.ForeignKeyCopyMode == ForeignKeyCopyDeferred {
+		f.writerTargetDB, err = f.openTargetWithoutForeignKeyChecks()
+		if err != nil {
+			f.logger.WithError(err).Error("failed to connect to target database without foreign key checks")
+			return err
+		}
+	}
+
+	err = f.detectFeatures()
+	if err != nil {
+		f.logger.WithError(err).Error("incompatible server features")
+		return err
+	}
+
 	if f.ErrorHandler == nil {
 		f.ErrorHandler = &PanicErrorHandler{
 			Ferry: f,
@@ -139,7 +346,34 @@ func (f *Ferry) Initialize() (err error) {
 	}
 
 	if f.Throttler == nil {
-		f.Throttler = &PauserThrottler{}
+		plugin, err := f.NewPlugin(PluginKindThrottler)
+		if err != nil {
+			return err
+		}
+
+		if plugin != nil {
+			f.Throttler = plugin.(Throttler)
+		} else {
+			f.Throttler = &PauserThrottler{}
+		}
+	}
+
+	if f.ReadThrottler == nil {
+		f.ReadThrottler = f.Throttler
+	}
+
+	if f.WriteThrottler == nil {
+		f.WriteThrottler = f.Throttler
+	}
+
+	timelineInterval, err := time.ParseDuration(f.Config.BinlogTimelineInterval)
+	if err != nil {
+		return fmt.Errorf("invalid BinlogTimelineInterval: %v", err)
+	}
+
+	f.BinlogTimeline = &BinlogTimeline{
+		Interval:   timelineInterval,
+		MaxEntries: f.Config.BinlogTimelineMaxEntries,
 	}
 
 	f.BinlogStreamer = &BinlogStreamer{
@@ -147,22 +381,150 @@ func (f *Ferry) Initialize() (err error) {
 		Config:       f.Config,
 		ErrorHandler: f.ErrorHandler,
 		Filter:       f.CopyFilter,
+		Flavor:       f.FeatureReport.Source.Version.Flavor,
+
+		ReconnectAttempts:    f.Config.BinlogReconnectAttempts,
+		ReconnectRetryPolicy: f.Config.RetryPolicies.BinlogReconnect,
+		Notifier:             f.notifier,
+		Timeline:             f.BinlogTimeline,
 	}
 	err = f.BinlogStreamer.Initialize()
 	if err != nil {
 		return err
 	}
 
+	if f.Config.ReverseReplication != nil {
+		f.BinlogStreamer.IgnoredServerIds, err = f.reverseReplicationIgnoredServerIds()
+		if err != nil {
+			f.logger.WithError(err).Error("unsafe reverse replication")
+			return err
+		}
+	}
+
+	if len(f.Config.EventFilterExpressions) > 0 {
+		f.BinlogStreamer.ExpressionFilter, err = NewExpressionEventFilter(f.Config.EventFilterExpressions)
+		if err != nil {
+			f.logger.WithError(err).Error("failed to compile event filter expressions")
+			return err
+		}
+	}
+
+	if f.Config.AuditLogDirectory != "" {
+		f.auditSink = &AuditSink{
+			Directory:   f.Config.AuditLogDirectory,
+			MaxFileSize: f.Config.AuditLogMaxFileSize,
+			FerryId:     f.Config.FerryId,
+		}
+
+		err = f.auditSink.Initialize()
+		if err != nil {
+			f.logger.WithError(err).Error("failed to initialize audit log")
+			return err
+		}
+	}
+
+	if f.Config.PrimaryKeyRemapping != nil {
+		f.pkRemapper = &PrimaryKeyRemapper{
+			DB:               f.TargetDB,
+			Config:           f.Config.PrimaryKeyRemapping,
+			DatabaseRewrites: f.Config.DatabaseRewrites,
+			TableRewrites:    f.Config.TableRewrites,
+		}
+
+		err = f.pkRemapper.Initialize()
+		if err != nil {
+			f.logger.WithError(err).Error("failed to initialize primary key remapping")
+			return err
+		}
+	}
+
+	var deadLetterRetryBackoff time.Duration
+	if f.Config.BinlogWriteFailurePolicy == BinlogWriteFailureDeadLetter {
+		deadLetterRetryBackoff, err = time.ParseDuration(f.Config.DeadLetterRetryBackoff)
+		if err != nil {
+			return fmt.Errorf("invalid DeadLetterRetryBackoff: %v", err)
+		}
+
+		f.deadLetterSink = &DeadLetterSink{
+			File:    f.Config.DeadLetterFile,
+			Dialect: f.targetDialect,
+
+			FullRowMatching: f.Config.FullRowMatching,
+		}
+		err = f.deadLetterSink.Initialize()
+		if err != nil {
+			f.logger.WithError(err).Error("failed to open dead letter file")
+			return err
+		}
+	}
+
+	if f.CopyRateLimiter == nil {
+		f.CopyRateLimiter = NewRateLimiter(f.Config.CopyRowsPerSecond, f.Config.CopyBytesPerSecond)
+	}
+
+	if f.BinlogRateLimiter == nil {
+		f.BinlogRateLimiter = NewRateLimiter(f.Config.BinlogRowsPerSecond, f.Config.BinlogBytesPerSecond)
+	}
+
+	if len(f.Config.ThrottleSchedules) > 0 {
+		location, err := time.LoadLocation(f.Config.ThrottleScheduleTimezone)
+		if err != nil {
+			return err
+		}
+
+		f.throttleScheduler = &ThrottleScheduler{
+			Schedules: f.Config.ThrottleSchedules,
+			Default: ThrottleSchedule{
+				CopyRowsPerSecond:    f.Config.CopyRowsPerSecond,
+				CopyBytesPerSecond:   f.Config.CopyBytesPerSecond,
+				BinlogRowsPerSecond:  f.Config.BinlogRowsPerSecond,
+				BinlogBytesPerSecond: f.Config.BinlogBytesPerSecond,
+			},
+			Location:          location,
+			CopyRateLimiter:   f.CopyRateLimiter,
+			BinlogRateLimiter: f.BinlogRateLimiter,
+			Interval:          10 * time.Second,
+		}
+	}
+
+	if f.Config.IgnoredRowsMode != "" {
+		f.ignoredRows = &IgnoredRowsCounter{Strict: f.Config.IgnoredRowsMode == IgnoredRowsStrict}
+	}
+
+	if f.Config.TargetRowGuard != nil {
+		f.targetWrites = NewTargetWriteCounter()
+	}
+
 	f.BinlogWriter = &BinlogWriter{
-		DB:               f.TargetDB,
+		DB:               f.writerTargetDB,
 		DatabaseRewrites: f.Config.DatabaseRewrites,
 		TableRewrites:    f.Config.TableRewrites,
-		Throttler:        f.Throttler,
+		Throttler:        f.WriteThrottler,
+		RateLimiter:      f.BinlogRateLimiter,
 
-		BatchSize:    f.Config.BinlogEventBatchSize,
-		WriteRetries: f.Config.DBWriteRetries,
+		BatchSize:        f.Config.BinlogEventBatchSize,
+		InsertBatchSize:  f.Config.BinlogInsertBatchSize,
+		WriteRetries:     f.Config.DBWriteRetries,
+		WriteRetryPolicy: f.Config.RetryPolicies.Write,
+		Dialect:          f.targetDialect,
 
 		ErrorHandler: f.ErrorHandler,
+		AuditSink:    f.auditSink,
+
+		DeadLetterSink:         f.deadLetterSink,
+		DeadLetterRetries:      f.Config.DeadLetterRetries,
+		DeadLetterRetryBackoff: deadLetterRetryBackoff,
+
+		PrimaryKeyRemapper: f.pkRemapper,
+
+		MaxTransactionRows:       f.Config.BinlogMaxTransactionRows,
+		MaxTransactionStatements: f.Config.BinlogMaxTransactionStatements,
+
+		PreserveTransactions: f.Config.PreserveSourceTransactions,
+		FullRowMatching:      f.Config.FullRowMatching,
+		IgnoredRows:          f.ignoredRows,
+		StatementComment:     f.statementComment(),
+		TargetWrites:         f.targetWrites,
 	}
 
 	err = f.BinlogWriter.Initialize()
@@ -170,25 +532,190 @@ func (f *Ferry) Initialize() (err error) {
 		return err
 	}
 
+	queueDepthReportInterval, err := time.ParseDuration(f.Config.QueueDepthReportInterval)
+	if err != nil {
+		return fmt.Errorf("invalid QueueDepthReportInterval: %v", err)
+	}
+
+	f.QueueDepthMonitor = &QueueDepthMonitor{
+		Interval:   queueDepthReportInterval,
+		Thresholds: f.Config.MaxHealthyQueueDepths,
+	}
+	f.QueueDepthMonitor.Initialize()
+	f.QueueDepthMonitor.AddQueue(QueueBinlogBuffer, f.BinlogWriter.BufferDepth)
+	if f.deadLetterSink != nil {
+		f.QueueDepthMonitor.AddQueue(QueueDeadLetter, f.deadLetterSink.Count)
+	}
+
+	if f.Config.MaxMemoryBytes > 0 {
+		f.MemoryBudget = &MemoryBudget{
+			Limit:    f.Config.MaxMemoryBytes,
+			Interval: queueDepthReportInterval,
+		}
+		f.MemoryBudget.Initialize()
+		f.BinlogWriter.MemoryBudget = f.MemoryBudget
+	}
+
+	f.Pauser = NewComponentPauser()
+	f.BinlogWriter.Pauser = f.Pauser
+
 	f.DataIterator, err = f.newDataIterator()
 	if err != nil {
 		return err
 	}
 
+	// Only the rows of the run are copied from the read replica, the rows
+	// copied during the cutover must be read from the source.
+	if f.ReadReplicaDB != nil {
+		f.DataIterator.DB = f.ReadReplicaDB
+	}
+
+	if f.StateToResumeFrom != nil {
+		if f.StateToResumeFrom.GhostferryVersion != VersionString {
+			f.logger.WithFields(logrus.Fields{
+				"stateVersion":   f.StateToResumeFrom.GhostferryVersion,
+				"currentVersion": VersionString,
+			}).Warn("resuming from a state dumped by a different version of ghostferry")
+		}
+
+		if f.StateToResumeFrom.FerryId != "" {
+			f.logger.WithField("previousFerryId", f.StateToResumeFrom.FerryId).Info("resuming from a state dumped by a previous run")
+		}
+
+		f.DataIterator.CurrentState.restore(f.StateToResumeFrom.LastSuccessfulPrimaryKeys, f.StateToResumeFrom.CompletedTables)
+		f.DataIterator.CurrentState.restorePartitions(f.StateToResumeFrom.LastSuccessfulPartitionPrimaryKeys, f.StateToResumeFrom.CompletedPartitions)
+		for table, pos := range f.StateToResumeFrom.FullRowMatchTablesCopiedAt {
+			f.DataIterator.CurrentState.MarkFullRowMatchTableCopied(table, pos)
+		}
+
+		f.BinlogTimeline.Restore(f.StateToResumeFrom.BinlogTimeline)
+		f.deferredIndexes = append([]DeferredIndex(nil), f.StateToResumeFrom.DeferredIndexes...)
+
+		for _, component := range f.StateToResumeFrom.PausedComponents {
+			err = f.Pauser.SetPaused(component, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	f.BatchWriter = &BatchWriter{
-		DB: f.TargetDB,
+		DB: f.writerTargetDB,
 
 		DatabaseRewrites: f.Config.DatabaseRewrites,
 		TableRewrites:    f.Config.TableRewrites,
-
-		WriteRetries: f.Config.DBWriteRetries,
+		Throttler:        f.WriteThrottler,
+		RateLimiter:      f.CopyRateLimiter,
+
+		WriteRetries:     f.Config.DBWriteRetries,
+		WriteRetryPolicy: f.Config.RetryPolicies.Write,
+		Dialect:          f.targetDialect,
+		StageRowBatches:  f.Config.StageRowBatches,
+		LoadDataInfile:   f.Config.LoadDataInfile,
+		AuditSink:        f.auditSink,
+
+		PrimaryKeyRemapper: f.pkRemapper,
+		LargeRowBytes:      f.Config.DataIterationLargeRowBytes,
+		IgnoredRows:        f.ignoredRows,
+		StatementComment:   f.statementComment(),
+		TargetWrites:       f.targetWrites,
 	}
 	f.BatchWriter.Initialize()
 
+	if f.RowBatchWriter == nil {
+		plugin, err := f.NewPlugin(PluginKindRowBatchWriter)
+		if err != nil {
+			return err
+		}
+
+		if plugin != nil {
+			f.RowBatchWriter = plugin.(RowBatchWriter)
+		} else {
+			f.RowBatchWriter = f.BatchWriter
+		}
+	}
+
+	if f.DMLEventWriter == nil {
+		plugin, err := f.NewPlugin(PluginKindDMLEventWriter)
+		if err != nil {
+			return err
+		}
+
+		if plugin != nil {
+			f.DMLEventWriter = plugin.(DMLEventWriter)
+		} else {
+			f.DMLEventWriter = f.BinlogWriter
+		}
+	}
+
+	for _, config := range f.Config.DMLEventMiddlewares {
+		middleware, err := f.NewDMLEventMiddleware(config)
+		if err != nil {
+			return err
+		}
+		f.DMLEventMiddlewares = append(f.DMLEventMiddlewares, middleware)
+	}
+
+	stateStorePlugin, err := f.NewPlugin(PluginKindStateStore)
+	if err != nil {
+		return err
+	}
+
+	if f.Config.CheckpointStateFile != "" || stateStorePlugin != nil {
+		interval, err := time.ParseDuration(f.Config.CheckpointInterval)
+		if err != nil {
+			return fmt.Errorf("invalid CheckpointInterval: %v", err)
+		}
+
+		f.checkpointer = &Checkpointer{
+			Ferry:     f,
+			StateFile: f.Config.CheckpointStateFile,
+			Interval:  interval,
+		}
+
+		if stateStorePlugin != nil {
+			f.checkpointer.Store = stateStorePlugin.(StateStore)
+		}
+
+		err = f.checkpointer.Initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.Config.ProgressLogInterval != "" {
+		interval, err := time.ParseDuration(f.Config.ProgressLogInterval)
+		if err != nil {
+			return fmt.Errorf("invalid ProgressLogInterval: %v", err)
+		}
+
+		f.progressReporter = &ProgressReporter{
+			Ferry:    f,
+			Interval: interval,
+		}
+		f.progressReporter.Initialize()
+	}
+
 	f.logger.Info("ferry initialized")
 	return nil
 }
 
+// Buffers the binlog events to be written to the target, once they went
+// through the DMLEventMiddlewares, the events already included in the copy
+// of the tables matched by full rows are skipped and the latin1 values are
+// converted, if configured.
+func (f *Ferry) bufferBinlogEvents(events []DMLEvent) error {
+	if f.Config.FullRowMatching {
+		events = f.eventsNotCopied(events)
+	}
+
+	if f.Config.ConvertLatin1ToUtf8mb4 {
+		events = ConvertLatin1Events(events)
+	}
+
+	return f.DMLEventWriter.BufferBinlogEvents(events)
+}
+
 // Determine the binlog coordinates, table mapping for the pending
 // Ghostferry run.
 func (f *Ferry) Start() error {
@@ -199,44 +726,226 @@ func (f *Ferry) Start() error {
 	// Registering the builtin event listeners in Start allows the consumer
 	// of the library to register event listeners that gets called before
 	// and after the data gets written to the target database.
-	f.BinlogStreamer.AddEventListener(f.BinlogWriter.BufferBinlogEvents)
-	f.DataIterator.AddBatchListener(f.BatchWriter.WriteRowBatch)
+	f.BinlogStreamer.AddEventListener(ChainDMLEventMiddlewares(f.bufferBinlogEvents, f.DMLEventMiddlewares...))
+	f.DataIterator.AddBatchListener(f.RowBatchWriter.WriteRowBatch)
+	if f.Config.FullRowMatching {
+		f.DataIterator.AddFullRowMatchTableStartListener(f.emptyFullRowMatchTargetTable)
+	}
+	if f.progressReporter != nil {
+		f.DataIterator.AddBatchListener(f.progressReporter.CountRowBatch)
+	}
+	if f.Config.Snapshot != nil && f.StateToResumeFrom == nil {
+		f.DataIterator.AddDoneListener(f.connectBinlogAfterSnapshotCopy)
+	}
+	// The indexes dropped by a previous run are added back even if the
+	// option was since turned off.
+	if f.Config.DeferSecondaryIndexes || len(f.deferredIndexes) > 0 {
+		f.DataIterator.AddDoneListener(f.rebuildTargetIndexes)
+	}
 	f.DataIterator.AddDoneListener(f.onFinishedIterations)
+	f.registerHooks()
 
 	// The starting binlog coordinates must be determined first. If it is
 	// determined after the DataIterator starts, the DataIterator might
 	// miss some records that are inserted between the time the
 	// DataIterator determines the range of IDs to copy and the time that
 	// the starting binlog coordinates are determined.
-	err := f.BinlogStreamer.ConnectBinlogStreamerToMysql()
+	var err error
+	if f.StateToResumeFrom != nil {
+		f.logger.WithField("position", f.StateToResumeFrom.LastSuccessfulBinlogPos).Info("resuming from previous state")
+		if f.Config.Snapshot != nil {
+			f.logger.Warn("the rows left to copy are not read from a snapshot, as the snapshot of the interrupted run is gone")
+		}
+		err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(f.StateToResumeFrom.LastSuccessfulBinlogPos)
+	} else if f.Config.ReverseReplication != nil {
+		f.logger.WithField("position", f.Config.ReverseReplication.StartPosition).Info("starting reverse replication from cutover position")
+		err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(f.Config.ReverseReplication.StartPosition)
+	} else if f.Config.DeltaOnly != nil {
+		f.logger.WithField("position", f.Config.DeltaOnly.StartPosition).Info("applying the binlog from the position the target was seeded at, without copying the rows")
+		err = f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(f.Config.DeltaOnly.StartPosition)
+	} else if f.Config.Snapshot != nil {
+		err = f.takeSnapshot()
+	} else {
+		err = f.BinlogStreamer.ConnectBinlogStreamerToMysql()
+	}
 	if err != nil {
 		return err
 	}
 
+	f.BinlogWriter.SetStartBinlogPosition(f.BinlogStreamer.GetLastStreamedBinlogPosition())
+
+	if f.ReadReplicaDB != nil {
+		err = f.waitForReadReplica(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+
 	// Loads the schema of the tables that are applicable.
 	// We need to do this at the beginning of the run as this is required
 	// in order to determine the PrimaryKey of each table as well as finding
 	// which value in the binlog event correspond to which field in the
 	// table.
 	metrics.Measure("LoadTables", nil, 1.0, func() {
-		f.Tables, err = LoadTables(f.SourceDB, f.TableFilter)
+		if f.Config.FullRowMatching {
+			f.Tables, err = LoadTablesWithFullRowMatching(f.SourceDB, f.TableFilter)
+		} else {
+			f.Tables, err = LoadTables(f.SourceDB, f.TableFilter)
+		}
 	})
 	if err != nil {
 		return err
 	}
 
+	f.skippedEngineTables, err = f.Tables.RemoveStorageEngines(f.SourceDB, f.Config.IgnoredStorageEngines)
+	if err != nil {
+		return fmt.Errorf("failed to load the storage engines of the tables: %v", err)
+	}
+
+	for table, engine := range f.skippedEngineTables {
+		f.logger.WithFields(logrus.Fields{
+			"table":  table,
+			"engine": engine,
+		}).Warn("not ferrying the table, as its storage engine is ignored")
+	}
+
+	err = f.checkOnlineSchemaChanges()
+	if err != nil {
+		return err
+	}
+
+	if f.Config.StrictForeignKeyOrdering || f.Config.ForeignKeyCopyMode != "" {
+		f.foreignKeys, err = LoadForeignKeys(f.SourceDB, f.Tables.AsSlice())
+		if err != nil {
+			return fmt.Errorf("failed to load the foreign keys: %v", err)
+		}
+	}
+
+	if f.Config.StrictForeignKeyOrdering {
+		f.enforceForeignKeyOrdering()
+	}
+
+	if f.CopyFilter != nil {
+		for _, table := range f.Tables {
+			if IsFullRowMatchTable(table) {
+				return fmt.Errorf("table %s has no key and cannot be copied with a CopyFilter", table.String())
+			}
+		}
+	}
+
+	if f.BinlogStreamer.ExpressionFilter != nil {
+		err = f.BinlogStreamer.ExpressionFilter.Validate(f.Tables)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = validateColumnCodecs(f.Tables)
+	if err != nil {
+		return err
+	}
+
+	err = validateVerifierIgnoredColumns(f.Tables, f.Config.VerifierIgnoredColumns)
+	if err != nil {
+		return err
+	}
+
+	err = validateIterationIndexes(f.SourceDB, f.Tables, f.Config.DataIterationIndexes)
+	if err != nil {
+		return err
+	}
+
 	// TODO(pushrax): handle changes to schema during copying and clean this up.
 	f.BinlogStreamer.TableSchema = f.Tables
 	f.DataIterator.Tables = f.Tables.AsSlice()
 
+	if f.Config.ForeignKeyCopyMode == ForeignKeyCopyOrdered {
+		f.DataIterator.TableDependencies = ForeignKeyDependencies(f.foreignKeys)
+	}
+
+	// The rows of the old source, or of a target seeded out of band, are
+	// only kept up to date, never copied.
+	if f.Config.ReverseReplication != nil || f.Config.DeltaOnly != nil {
+		for _, table := range f.DataIterator.Tables {
+			f.DataIterator.CurrentState.MarkTableAsCompleted(table.String())
+		}
+	}
+
+	if f.Config.SmallTableMaxRows > f.Config.DataIterationBatchSize {
+		err = f.useSmallTableBatchSizes()
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.Config.DetectSchemaDrift {
+		interval, err := time.ParseDuration(f.Config.SchemaDriftCheckInterval)
+		if err != nil {
+			return fmt.Errorf("invalid SchemaDriftCheckInterval: %v", err)
+		}
+
+		f.schemaDriftDetector = &SchemaDriftDetector{
+			SourceDB:         f.SourceDB,
+			TargetDB:         f.TargetDB,
+			Tables:           f.Tables.AsSlice(),
+			DatabaseRewrites: f.Config.DatabaseRewrites,
+			TableRewrites:    f.Config.TableRewrites,
+			Interval:         interval,
+		}
+		f.schemaDriftDetector.Initialize()
+	}
+
+	if f.Config.TargetRowGuard != nil {
+		interval, err := time.ParseDuration(f.Config.TargetRowGuard.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid TargetRowGuard Interval: %v", err)
+		}
+
+		f.targetRowGuard = &TargetRowGuard{
+			TargetDB:         f.TargetDB,
+			Tables:           f.Tables.AsSlice(),
+			DatabaseRewrites: f.Config.DatabaseRewrites,
+			TableRewrites:    f.Config.TableRewrites,
+			Writes:           f.targetWrites,
+			Interval:         interval,
+		}
+	}
+
+	return nil
+}
+
+// Sets the batch size of the small tables to Config.SmallTableMaxRows, so
+// they are usually copied and verified in a single batch.
+func (f *Ferry) useSmallTableBatchSizes() error {
+	smallTables, err := SmallTables(f.SourceDB, f.DataIterator.Tables, f.Config.SmallTableMaxRows, f.Config.SmallTableMaxBytes)
+	if err != nil {
+		f.logger.WithError(err).Error("failed to find small tables")
+		return err
+	}
+
+	batchSizes := make(map[string]uint64)
+	for table, batchSize := range f.DataIterator.TableBatchSizes {
+		batchSizes[table] = batchSize
+	}
+
+	for _, table := range smallTables {
+		if _, exists := batchSizes[table.String()]; !exists {
+			batchSizes[table.String()] = f.Config.SmallTableMaxRows
+		}
+	}
+
+	f.DataIterator.TableBatchSizes = batchSizes
+	f.logger.WithField("count", len(smallTables)).Info("copying small tables in a single batch")
 	return nil
 }
 
 // Spawns the background tasks that actually perform the run.
 // Wait for the background tasks to finish.
 func (f *Ferry) Run() {
+	defer f.ReportPanic()
+
 	f.logger.Info("starting ferry run")
-	f.OverallState = StateCopying
+	f.setState(StateCopying)
 
 	ctx, shutdown := context.WithCancel(context.Background())
 
@@ -246,19 +955,130 @@ func (f *Ferry) Run() {
 		}
 	}
 
+	// The target tables may be created between Start and Run, so their
+	// indexes are only deferred now, and the definitions of the tables
+	// captured once they are.
+	if f.Config.DeferSecondaryIndexes {
+		err := f.deferTargetIndexes()
+		if err != nil {
+			shutdown()
+			f.ErrorHandler.Fatal("deferred_indexes", err)
+			return
+		}
+	}
+
+	if f.schemaDriftDetector != nil {
+		err := f.schemaDriftDetector.Capture()
+		if err != nil {
+			shutdown()
+			f.ErrorHandler.Fatal("schema_drift", err)
+			return
+		}
+	}
+
 	supportingServicesWg := &sync.WaitGroup{}
-	supportingServicesWg.Add(1)
 
+	for _, throttler := range f.throttlers() {
+		supportingServicesWg.Add(1)
+		go func(throttler Throttler) {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("throttler", throttler.Run(ctx))
+		}(throttler)
+	}
+
+	if f.throttleScheduler != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("throttle_schedule", f.throttleScheduler.Run(ctx))
+		}()
+	}
+
+	if f.checkpointer != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("checkpointer", f.checkpointer.Run(ctx))
+		}()
+	}
+
+	if f.schemaDriftDetector != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("schema_drift", f.schemaDriftDetector.Run(ctx))
+		}()
+	}
+
+	if f.targetRowGuard != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("target_row_guard", f.targetRowGuard.Run(ctx))
+		}()
+	}
+
+	if f.snapshotGuard != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("snapshot_guard", f.snapshotGuard.Run(ctx))
+		}()
+	}
+
+	supportingServicesWg.Add(1)
 	go func() {
 		defer supportingServicesWg.Done()
-		handleError("throttler", f.Throttler.Run(ctx))
+		defer f.ReportPanic()
+		handleError("queue_depth_monitor", f.QueueDepthMonitor.Run(ctx))
 	}()
 
+	if f.MemoryBudget != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("memory_budget", f.MemoryBudget.Run(ctx))
+		}()
+	}
+
+	if f.progressReporter != nil {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			handleError("progress", f.progressReporter.Run(ctx))
+		}()
+	}
+
+	if f.DumpStateOnSignal {
+		supportingServicesWg.Add(1)
+		go func() {
+			defer supportingServicesWg.Done()
+			defer f.ReportPanic()
+			f.interruptOnSignal(ctx)
+		}()
+	}
+
 	coreServicesWg := &sync.WaitGroup{}
 	coreServicesWg.Add(3)
 
+	dataIteratorDoneCh := make(chan struct{})
+
 	go func() {
 		defer coreServicesWg.Done()
+		defer f.ReportPanic()
+
+		if f.snapshot != nil && !f.waitForSnapshotCopy(dataIteratorDoneCh) {
+			f.BinlogWriter.Stop()
+			return
+		}
 
 		f.BinlogStreamer.Run()
 		f.BinlogWriter.Stop()
@@ -266,21 +1086,100 @@ func (f *Ferry) Run() {
 
 	go func() {
 		defer coreServicesWg.Done()
+		defer f.ReportPanic()
 		f.BinlogWriter.Run()
 	}()
 
 	go func() {
 		defer coreServicesWg.Done()
+		defer f.ReportPanic()
 		f.DataIterator.Run()
+		close(dataIteratorDoneCh)
 	}()
 
 	coreServicesWg.Wait()
 
-	f.OverallState = StateDone
+	if f.Config.ForeignKeyCopyMode == ForeignKeyCopyDeferred && !f.IsInterrupted() {
+		err := f.validateForeignKeys()
+		if err != nil {
+			f.ErrorHandler.Fatal("foreign_keys", err)
+		}
+	}
+
+	if f.Config.ReconcileRowCounts && !f.IsInterrupted() {
+		err := f.reconcileRowCounts()
+		if err != nil {
+			f.ErrorHandler.Fatal("row_count", err)
+		}
+	}
+
+	if f.IsInterrupted() {
+		f.logger.Info("ferry run interrupted")
+		f.setState(StateInterrupted)
+
+		if f.checkpointer != nil {
+			err := f.checkpointer.Checkpoint()
+			if err != nil {
+				f.logger.WithError(err).Error("failed to write final checkpoint")
+			}
+		}
+	} else {
+		f.setState(StateDone)
+	}
 	f.DoneTime = time.Now()
 
+	if f.auditSink != nil {
+		err := f.auditSink.Close()
+		if err != nil {
+			f.logger.WithError(err).Error("failed to close audit log")
+		}
+	}
+
+	if f.deadLetterSink != nil {
+		err := f.deadLetterSink.Close()
+		if err != nil {
+			f.logger.WithError(err).Error("failed to close dead letter file")
+		}
+	}
+
 	shutdown()
 	supportingServicesWg.Wait()
+	f.WaitForNotifications()
+}
+
+// Compares the row counts of the tables once the source and the target are
+// expected to be identical, see Config.ReconcileRowCounts.
+func (f *Ferry) reconcileRowCounts() error {
+	verifier := &RowCountVerifier{
+		Tables:           f.Tables.AsSlice(),
+		DatabaseRewrites: f.Config.DatabaseRewrites,
+		TableRewrites:    f.Config.TableRewrites,
+		SourceDB:         f.SourceDB,
+		TargetDB:         f.TargetDB,
+		TargetDialect:    f.targetDialect,
+	}
+
+	if f.Config.ReconcileRowCountsInCopiedRange {
+		verifier.MaxPrimaryKeys = make(map[string]uint64)
+		for _, table := range verifier.Tables {
+			// The target is unknown for the tables completed by a
+			// previous run, which are then counted entirely.
+			if maxPk := f.DataIterator.CurrentState.TargetPK(table.String()); maxPk > 0 {
+				verifier.MaxPrimaryKeys[table.String()] = maxPk
+			}
+		}
+	}
+
+	result, err := verifier.Verify()
+	if err != nil {
+		return err
+	}
+
+	if !result.DataCorrect {
+		return result
+	}
+
+	return nil
 }
 
 func (f *Ferry) RunStandaloneDataCopy(tables []*schema.Table) error {
@@ -294,7 +1193,7 @@ func (f *Ferry) RunStandaloneDataCopy(tables []*schema.Table) error {
 	}
 
 	dataIterator.Tables = tables
-	dataIterator.AddBatchListener(f.BatchWriter.WriteRowBatch)
+	dataIterator.AddBatchListener(f.RowBatchWriter.WriteRowBatch)
 	f.logger.WithField("tables", tables).Info("starting standalone table copy")
 
 	dataIterator.Run()
@@ -303,11 +1202,20 @@ func (f *Ferry) RunStandaloneDataCopy(tables []*schema.Table) error {
 }
 
 // Call this method and perform the cutover after this method returns.
+//
+// This method also returns if the run is interrupted, in which case the
+// cutover must not be performed. Check IsInterrupted before proceeding.
 func (f *Ferry) WaitUntilRowCopyIsComplete() {
-	<-f.rowCopyCompleteCh
+	select {
+	case <-f.rowCopyCompleteCh:
+	case <-f.interruptedCh:
+	}
 }
 
 func (f *Ferry) WaitUntilBinlogStreamerCatchesUp() {
+	span := StartSpan("WaitUntilBinlogStreamerCatchesUp", nil)
+	defer span.End(nil)
+
 	for !f.BinlogStreamer.IsAlmostCaughtUp() {
 		time.Sleep(500 * time.Millisecond)
 	}
@@ -320,6 +1228,9 @@ func (f *Ferry) WaitUntilBinlogStreamerCatchesUp() {
 // This method will actually not shutdown the BinlogStreamer immediately.
 // You will know that the BinlogStreamer finished when .Run() returns.
 func (f *Ferry) FlushBinlogAndStopStreaming() {
+	span := StartSpan("FlushBinlogAndStopStreaming", nil)
+	defer span.End(nil)
+
 	if f.WaitUntilReplicaIsCaughtUpToMaster != nil {
 		f.WaitUntilReplicaIsCaughtUpToMaster.ReplicaDB = f.SourceDB
 		err := f.WaitUntilReplicaIsCaughtUpToMaster.Wait()
@@ -329,21 +1240,307 @@ func (f *Ferry) FlushBinlogAndStopStreaming() {
 		}
 	}
 
+	if f.schemaDriftDetector != nil {
+		err := f.schemaDriftDetector.Check()
+		if err != nil {
+			f.ErrorHandler.Fatal("schema_drift", err)
+			return
+		}
+	}
+
 	f.BinlogStreamer.FlushAndStop()
 }
 
+// Makes the BinlogWriter apply the events of the tables related by foreign
+// keys in order, see Config.StrictForeignKeyOrdering.
+func (f *Ferry) enforceForeignKeyOrdering() {
+	f.BinlogWriter.ForeignKeyGroups = ForeignKeyGroups(f.foreignKeys)
+	f.logger.WithFields(logrus.Fields{
+		"foreignKeys": len(f.foreignKeys),
+		"tables":      len(f.BinlogWriter.ForeignKeyGroups),
+	}).Info("enforcing the order of the binlog events of the tables related by foreign keys")
+
+	if f.DMLEventWriter != DMLEventWriter(f.BinlogWriter) {
+		f.logger.Warn("the binlog events are written by a DMLEventWriter plugin, which must apply the events of the tables related by foreign keys in order")
+	}
+}
+
+// Opens the connections to the target with the foreign_key_checks of the
+// session disabled, for the deferred Config.ForeignKeyCopyMode.
+func (f *Ferry) openTargetWithoutForeignKeyChecks() (*sql.DB, error) {
+	target := f.Target
+	session := SessionConfig{}
+	if target.Session != nil {
+		session = *target.Session
+	}
+
+	foreignKeyChecks := false
+	session.ForeignKeyChecks = &foreignKeyChecks
+	target.Session = &session
+
+	return target.SqlDB(f.logger.WithField("dbname", "target_without_foreign_key_checks"))
+}
+
+// Finds the rows of the target referencing rows missing from the target,
+// once the rows were written without the foreign key checks with the
+// deferred Config.ForeignKeyCopyMode.
+func (f *Ferry) validateForeignKeys() error {
+	var problems []string
+	for _, foreignKey := range f.foreignKeys {
+		count, err := CountOrphanedRows(f.TargetDB, foreignKey, f.Config.DatabaseRewrites, f.Config.TableRewrites)
+		if err != nil {
+			return fmt.Errorf("failed to validate foreign key %s of %s: %v", foreignKey.Name, foreignKey.Table, err)
+		}
+
+		if count > 0 {
+			problems = append(problems, fmt.Sprintf("%d rows of %s reference rows missing from %s through foreign key %s", count, foreignKey.Table, foreignKey.ReferencedTable, foreignKey.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("foreign keys violated on the target: %s", strings.Join(problems, "; "))
+	}
+
+	f.logger.WithField("foreignKeys", len(f.foreignKeys)).Info("foreign keys validated on the target")
+	return nil
+}
+
+// Runs the preflight checks for the tables loaded during Start. The returned
+// error lists every problem that was found.
+//
+// The target schemas can only be compared if the target tables already
+// exist.
+func (f *Ferry) RunPreflight(compareSchemas bool) error {
+	if f.targetDialect.Name() != DialectMySQL {
+		f.logger.Warnf("skipping preflight checks, which only support %s targets", DialectMySQL)
+		return nil
+	}
+
+	preflight := &Preflight{
+		SourceDB:             f.SourceDB,
+		TargetDB:             f.TargetDB,
+		Tables:               f.Tables,
+		DatabaseRewrites:     f.Config.DatabaseRewrites,
+		TableRewrites:        f.Config.TableRewrites,
+		NormalizeCollations:  f.Config.VerifierNormalizeCollations,
+		SkipSchemaComparison: !compareSchemas,
+		SkippedEngineTables:  f.skippedEngineTables,
+	}
+
+	// The target of a resumed, reversed or delta only run already has the
+	// rows of the source.
+	if f.Config.TargetRowGuard != nil && f.Config.StateToResumeFrom == nil && f.Config.ReverseReplication == nil && f.Config.DeltaOnly == nil {
+		preflight.RequireEmptyTarget = true
+	}
+
+	return preflight.Run().Err()
+}
+
+// The SQL dialect of the target, see Config.TargetDialect.
+func (f *Ferry) TargetDialect() SQLDialect {
+	return f.targetDialect
+}
+
+// Returns the rate limiter of the writes of the given phase, either
+// RateLimitPhaseCopy or RateLimitPhaseBinlog.
+func (f *Ferry) RateLimiter(phase string) (*RateLimiter, error) {
+	switch phase {
+	case RateLimitPhaseCopy:
+		return f.CopyRateLimiter, nil
+	case RateLimitPhaseBinlog:
+		return f.BinlogRateLimiter, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit phase %s, must be %s or %s", phase, RateLimitPhaseCopy, RateLimitPhaseBinlog)
+	}
+}
+
+// Pauses or unpauses both the reads from the source and the writes to the
+// target.
+func (f *Ferry) SetThrottlersPaused(paused bool) {
+	for _, throttler := range f.throttlers() {
+		throttler.SetPaused(paused)
+	}
+}
+
+// Disables or enables the throttling of both the reads from the source and
+// the writes to the target.
+func (f *Ferry) SetThrottlersDisabled(disabled bool) {
+	for _, throttler := range f.throttlers() {
+		throttler.SetDisabled(disabled)
+	}
+}
+
+// Waits until neither the reads nor the writes are throttled.
+func (f *Ferry) WaitForThrottlers() {
+	for _, throttler := range f.throttlers() {
+		WaitForThrottle(throttler)
+	}
+}
+
+// The distinct throttlers in use, as the same throttler can be used for
+// both reads and writes.
+func (f *Ferry) throttlers() []Throttler {
+	throttlers := []Throttler{}
+	for _, throttler := range []Throttler{f.Throttler, f.ReadThrottler, f.WriteThrottler} {
+		if throttler == nil {
+			continue
+		}
+
+		duplicate := false
+		for _, existing := range throttlers {
+			if existing == throttler {
+				duplicate = true
+				break
+			}
+		}
+
+		if !duplicate {
+			throttlers = append(throttlers, throttler)
+		}
+	}
+	return throttlers
+}
+
+// Stops the data copy and the binlog streaming cleanly so the run can be
+// resumed later from the state returned by SerializeState. Ferry.Run returns
+// once all the events streamed so far are written to the target.
+//
+// The run cannot be interrupted once the cutover has started.
+func (f *Ferry) Interrupt() error {
+	if f.OverallState == StateCutover || f.OverallState == StateDone {
+		return fmt.Errorf("cannot interrupt the ferry during state %s", f.OverallState)
+	}
+
+	f.interruptOnce.Do(func() {
+		f.logger.Warn("interrupting ferry run")
+		close(f.interruptedCh)
+		f.DataIterator.RequestStop()
+		f.BinlogStreamer.Interrupt()
+	})
+
+	return nil
+}
+
+func (f *Ferry) IsInterrupted() bool {
+	select {
+	case <-f.interruptedCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *Ferry) interruptOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			err := f.Interrupt()
+			if err != nil {
+				f.logger.WithError(err).WithField("signal", sig).Warn("ignoring signal")
+			} else {
+				f.logger.WithField("signal", sig).Info("interrupted by signal, stopping ferry")
+			}
+		}
+	}
+}
+
+// Returns the state of the run so far, which can be dumped with
+// SerializableState.Dump and later be used to resume the run.
+func (f *Ferry) SerializeState() *SerializableState {
+	// Once interrupted, the streamer stopped at a transaction boundary and
+	// all the streamed events were written, so the streaming can resume from
+	// the last streamed position. Otherwise the events that were streamed but
+	// are not written yet must be streamed again.
+	binlogPos := f.BinlogWriter.LastWrittenBinlogPosition()
+	if f.OverallState == StateInterrupted {
+		binlogPos = f.BinlogStreamer.GetLastStreamedBinlogPosition()
+	}
+
+	state := &SerializableState{
+		GhostferryVersion:         VersionString,
+		LastSuccessfulBinlogPos:   binlogPos,
+		LastSuccessfulPrimaryKeys: f.DataIterator.CurrentState.ResumablePrimaryKeys(),
+		CompletedTables:           f.DataIterator.CurrentState.CompletedTables(),
+	}
+
+	if copiedAt := f.DataIterator.CurrentState.FullRowMatchTablesCopiedAt(); len(copiedAt) > 0 {
+		state.FullRowMatchTablesCopiedAt = copiedAt
+	}
+
+	if partitionPks := f.DataIterator.CurrentState.ResumablePartitionPrimaryKeys(); len(partitionPks) > 0 {
+		state.LastSuccessfulPartitionPrimaryKeys = partitionPks
+	}
+
+	if completedPartitions := f.DataIterator.CurrentState.ResumableCompletedPartitions(); len(completedPartitions) > 0 {
+		state.CompletedPartitions = completedPartitions
+	}
+
+	if f.IterativeVerifier != nil {
+		state.IterativeVerifierState = f.IterativeVerifier.SerializeState()
+	}
+
+	if f.Pauser != nil {
+		if paused := f.Pauser.PausedComponents(); len(paused) > 0 {
+			state.PausedComponents = paused
+		}
+	}
+
+	if f.BinlogTimeline != nil {
+		if entries := f.BinlogTimeline.Entries(); len(entries) > 0 {
+			state.BinlogTimeline = entries
+		}
+	}
+
+	if f.Config != nil {
+		state.FerryId = f.Config.FerryId
+	}
+
+	if deferredIndexes := f.DeferredIndexes(); len(deferredIndexes) > 0 {
+		state.DeferredIndexes = deferredIndexes
+	}
+
+	return state
+}
+
 func (f *Ferry) onFinishedIterations() error {
 	f.logger.Info("finished iterations")
-	f.OverallState = StateWaitingForCutover
+	f.Notify(NotificationCopyFinished, "")
+
+	if f.ContinuousReplication {
+		f.logger.Info("continuous replication enabled, tailing the binlog without cutover")
+		f.setState(StateReplicating)
+		return nil
+	}
+
+	f.setState(StateWaitingForCutover)
 
-	for !f.AutomaticCutover {
+	for !f.AutomaticCutover && !f.IsInterrupted() {
 		time.Sleep(1 * time.Second)
 		f.logger.Debug("waiting for AutomaticCutover to become true before signaling for row copy complete")
 	}
 
+	if !f.IsInterrupted() {
+		err := f.waitForOnlineSchemaChangesBeforeCutover()
+		if err != nil {
+			f.ErrorHandler.Fatal("online_schema_change", err)
+			return err
+		}
+	}
+
+	if f.IsInterrupted() {
+		f.logger.Info("ferry interrupted, not entering cutover phase")
+		return nil
+	}
+
 	f.logger.Info("entering cutover phase")
 
-	f.OverallState = StateCutover
+	f.setState(StateCutover)
 	// TODO: make it so that this is non-blocking
 	f.rowCopyCompleteCh <- struct{}{}
 	return nil
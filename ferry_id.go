@@ -0,0 +1,40 @@
+package ghostferry
+
+import (
+	uuid "github.com/satori/go.uuid"
+)
+
+// Every run has a ferry id, Config.FerryId, which is a random UUID unless
+// configured, so the load and the issues caused by concurrent ferries can be
+// attributed to their runs. It is added to the log entries, to the tags of
+// the metrics, to the state dumps and to the audit records, and, with
+// Config.CommentTargetStatements, to the statements writing rows to the
+// target.
+
+// Returns a new random ferry id.
+func NewFerryId() string {
+	return uuid.NewV4().String()
+}
+
+// Returns the comment prepended to the statements writing to the target,
+// such as /* ghostferry ferry_id=3c1d... */.
+func statementComment(ferryId string) string {
+	return "/* ghostferry " + LogFieldFerryId + "=" + ferryId + " */ "
+}
+
+// Returns the comment of the statements writing to the target, if
+// Config.CommentTargetStatements is set.
+func (f *Ferry) statementComment() string {
+	if !f.Config.CommentTargetStatements {
+		return ""
+	}
+	return statementComment(f.Config.FerryId)
+}
+
+// Prepends the comment, if any, to the query.
+func commentStatement(comment, query string) string {
+	if comment == "" {
+		return query
+	}
+	return comment + query
+}
@@ -30,3 +30,14 @@ type TableFilter interface {
 	ApplicableTables([]*schema.Table) ([]*schema.Table, error)
 	ApplicableDatabases([]string) ([]string, error)
 }
+
+// TableNameFilter can optionally be implemented by a TableFilter to reject
+// tables based on their names alone. The schemas of the rejected tables are
+// then never loaded, which speeds up the start of the ferry on databases with
+// many tables. The remaining tables are still passed to ApplicableTables.
+type TableNameFilter interface {
+	// ApplicableTableNames is passed the database name and the names of the
+	// tables in it, and returns the names of the tables that may be
+	// applicable.
+	ApplicableTableNames(string, []string) ([]string, error)
+}
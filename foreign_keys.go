@@ -0,0 +1,196 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+const (
+	ForeignKeyCopyOrdered  = "ordered"
+	ForeignKeyCopyDeferred = "deferred"
+)
+
+// A foreign key of a ferried table, by full table names.
+type ForeignKey struct {
+	Name            string
+	Table           string
+	ReferencedTable string
+
+	// The columns of the key, in order, and the columns they reference.
+	Columns           []string
+	ReferencedColumns []string
+}
+
+// Loads the foreign keys of the tables from the source. The referenced
+// tables may not be ferried.
+func LoadForeignKeys(db *sql.DB, tables []*schema.Table) ([]ForeignKey, error) {
+	ferried := make(map[string]bool, len(tables))
+	schemas := make(map[string]bool)
+	for _, table := range tables {
+		ferried[table.String()] = true
+		schemas[table.Schema] = true
+	}
+
+	var foreignKeys []ForeignKey
+	for dbname := range schemas {
+		rows, err := db.Query(
+			"SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME "+
+				"FROM information_schema.KEY_COLUMN_USAGE "+
+				"WHERE TABLE_SCHEMA = ? AND REFERENCED_TABLE_NAME IS NOT NULL "+
+				"ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION",
+			dbname,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var name, table, column, referencedSchema, referencedTable, referencedColumn string
+			err = rows.Scan(&name, &table, &column, &referencedSchema, &referencedTable, &referencedColumn)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			if !ferried[dbname+"."+table] {
+				continue
+			}
+
+			last := len(foreignKeys) - 1
+			if last < 0 || foreignKeys[last].Name != name || foreignKeys[last].Table != dbname+"."+table {
+				foreignKeys = append(foreignKeys, ForeignKey{
+					Name:            name,
+					Table:           dbname + "." + table,
+					ReferencedTable: referencedSchema + "." + referencedTable,
+				})
+				last++
+			}
+
+			foreignKeys[last].Columns = append(foreignKeys[last].Columns, column)
+			foreignKeys[last].ReferencedColumns = append(foreignKeys[last].ReferencedColumns, referencedColumn)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return foreignKeys, nil
+}
+
+// Groups the tables related to each other by the foreign keys, directly or
+// through other tables. Returns the group of each table with a foreign key
+// or referenced by one, named after the first table of the group in
+// alphabetical order.
+func ForeignKeyGroups(foreignKeys []ForeignKey) map[string]string {
+	parents := make(map[string]string)
+
+	var find func(table string) string
+	find = func(table string) string {
+		parent, exists := parents[table]
+		if !exists {
+			parents[table] = table
+			return table
+		}
+
+		if parent != table {
+			parents[table] = find(parent)
+		}
+		return parents[table]
+	}
+
+	for _, foreignKey := range foreignKeys {
+		a := find(foreignKey.Table)
+		b := find(foreignKey.ReferencedTable)
+		if a == b {
+			continue
+		}
+
+		// The first table in alphabetical order names the group.
+		if b < a {
+			a, b = b, a
+		}
+		parents[b] = a
+	}
+
+	tables := make([]string, 0, len(parents))
+	for table := range parents {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	groups := make(map[string]string, len(tables))
+	for _, table := range tables {
+		groups[table] = find(table)
+	}
+
+	return groups
+}
+
+// Returns the tables referenced by the foreign keys of each table, other
+// than the table itself, by full table names.
+func ForeignKeyDependencies(foreignKeys []ForeignKey) map[string][]string {
+	dependencies := make(map[string][]string)
+	for _, foreignKey := range foreignKeys {
+		if foreignKey.ReferencedTable == foreignKey.Table {
+			continue
+		}
+
+		exists := false
+		for _, dependency := range dependencies[foreignKey.Table] {
+			if dependency == foreignKey.ReferencedTable {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			dependencies[foreignKey.Table] = append(dependencies[foreignKey.Table], foreignKey.ReferencedTable)
+		}
+	}
+
+	return dependencies
+}
+
+// Counts the rows of the target table of the foreign key referencing rows
+// missing from the referenced target table. The rows with a NULL column in
+// the key are not checked, as MySQL does.
+func CountOrphanedRows(db *sql.DB, foreignKey ForeignKey, databaseRewrites, tableRewrites map[string]string) (uint64, error) {
+	target := func(table string) string {
+		parts := strings.SplitN(table, ".", 2)
+		database, name := parts[0], parts[1]
+		if rewritten, exists := databaseRewrites[database]; exists {
+			database = rewritten
+		}
+		if rewritten, exists := tableRewrites[name]; exists {
+			name = rewritten
+		}
+		return QuotedTableNameFromString(database, name)
+	}
+
+	joins := make([]string, len(foreignKey.Columns))
+	conditions := make([]string, len(foreignKey.Columns))
+	for i, column := range foreignKey.Columns {
+		joins[i] = fmt.Sprintf("c.%s = p.%s", quoteField(column), quoteField(foreignKey.ReferencedColumns[i]))
+		conditions[i] = fmt.Sprintf("c.%s IS NOT NULL", quoteField(column))
+	}
+
+	query := fmt.Sprintf(
+		"SELECT COUNT(*) FROM %s AS c LEFT JOIN %s AS p ON %s WHERE %s AND p.%s IS NULL",
+		target(foreignKey.Table),
+		target(foreignKey.ReferencedTable),
+		strings.Join(joins, " AND "),
+		strings.Join(conditions, " AND "),
+		quoteField(foreignKey.ReferencedColumns[0]),
+	)
+
+	var count uint64
+	err := db.QueryRow(query).Scan(&count)
+	return count, err
+}
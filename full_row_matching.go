@@ -0,0 +1,338 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// The tables without a primary key are ferried with a unique key instead, if
+// one of their unique keys has a single NOT NULL integer column: such a key
+// identifies the rows exactly like a primary key, so LoadTables uses it as the
+// primary key of the table. The target must have the same unique key, as the
+// copied rows are inserted with INSERT IGNORE.
+//
+// Returns the name of the unique key used, or an empty string if the table
+// has no such key.
+func useUniqueKeyAsPrimaryKey(db *sql.DB, table *schema.Table) (string, error) {
+	if len(table.PKColumns) != 0 {
+		return "", nil
+	}
+
+	rows, err := db.Query(
+		"SELECT s.INDEX_NAME, s.COLUMN_NAME, c.IS_NULLABLE "+
+			"FROM information_schema.STATISTICS s "+
+			"JOIN information_schema.COLUMNS c "+
+			"ON c.TABLE_SCHEMA = s.TABLE_SCHEMA AND c.TABLE_NAME = s.TABLE_NAME AND c.COLUMN_NAME = s.COLUMN_NAME "+
+			"WHERE s.TABLE_SCHEMA = ? AND s.TABLE_NAME = ? AND s.NON_UNIQUE = 0",
+		table.Schema,
+		table.Name,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	type uniqueKey struct {
+		columns  []string
+		nullable bool
+	}
+
+	keys := make(map[string]*uniqueKey)
+	for rows.Next() {
+		var indexName, columnName, isNullable string
+		err = rows.Scan(&indexName, &columnName, &isNullable)
+		if err != nil {
+			return "", err
+		}
+
+		key, exists := keys[indexName]
+		if !exists {
+			key = &uniqueKey{}
+			keys[indexName] = key
+		}
+		key.columns = append(key.columns, columnName)
+		key.nullable = key.nullable || isNullable == "YES"
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := keys[name]
+		if len(key.columns) != 1 || key.nullable {
+			continue
+		}
+
+		index := table.FindColumn(key.columns[0])
+		if index < 0 || table.Columns[index].Type != schema.TYPE_NUMBER {
+			continue
+		}
+
+		table.PKColumns = []int{index}
+		return name, nil
+	}
+
+	return "", nil
+}
+
+// The tables without a primary key nor a unique key that can replace it are
+// ferried by matching full rows if Config.FullRowMatching is enabled:
+//
+// - The table is copied at once, with a single locking read of all its rows,
+// once the other tables are copied. The binlog events of the table written
+// before this read are already included in the copied rows and are skipped.
+//
+// - The rows are updated and deleted on the target by matching the values of
+// all their columns, one row at a time, so identical rows stay duplicated,
+// see fullRowMatchStatement. The rows with FLOAT or DOUBLE values may not be
+// matched exactly.
+//
+// - The IterativeVerifier and the SamplingVerifier skip these tables, which
+// can only be verified with the ChecksumTableVerifier.
+func IsFullRowMatchTable(table *schema.Table) bool {
+	return len(table.PKColumns) == 0
+}
+
+// Copies a table without a key at once. The rows are locked on the source
+// until they are written to the target, and the binlog position of the source
+// is recorded while they are locked, so only the binlog events of the table
+// after this position are applied, see Ferry.eventsNotCopied.
+//
+// An interrupted copy is started over when resuming, so the start listeners
+// are called first to empty the table on the target, see
+// Ferry.emptyFullRowMatchTargetTable.
+func (d *DataIterator) copyFullRowMatchTable(table *schema.Table) error {
+	logger := d.logger.WithField("table", table.String())
+	logger.Info("copying table without a key at once")
+
+	for _, listener := range d.fullRowMatchTableStartListeners {
+		err := listener(table)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.CursorConfig.Throttler != nil {
+		WaitForThrottle(d.CursorConfig.Throttler)
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Prepared, so the values are scanned with their types, see Cursor.Fetch.
+	stmt, err := tx.Prepare(fmt.Sprintf("SELECT * FROM %s FOR UPDATE", QuotedTableName(table)))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	batchSize := int(d.CursorConfig.BatchSize)
+	var batch []RowData
+	copied := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		rowBatch := NewRowBatch(table, batch, -1)
+		for _, listener := range d.batchListeners {
+			err := listener(rowBatch)
+			if err != nil {
+				return err
+			}
+		}
+
+		copied += len(batch)
+		batch = nil
+		return nil
+	}
+
+	for rows.Next() {
+		row, err := ScanGenericRow(rows, len(columns))
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, row)
+		if len(batch) >= batchSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	err = flush()
+	if err != nil {
+		return err
+	}
+
+	// All the rows are locked once they are all read, so the changes to the
+	// table committed before this position are included in the copy, and
+	// the changes after it can only be committed once the copy is done.
+	pos, err := showMasterStatusPosition(tx)
+	if err != nil {
+		return fmt.Errorf("failed to read binlog position of the copy: %v", err)
+	}
+
+	d.CurrentState.MarkFullRowMatchTableCopied(table.String(), pos)
+	d.CurrentState.MarkTableAsCompleted(table.String())
+	logger.WithField("rows", copied).WithField("position", pos).Info("copied table without a key")
+
+	for _, listener := range d.tableDoneListeners {
+		err = listener(table)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func showMasterStatusPosition(tx *sql.Tx) (mysql.Position, error) {
+	var file string
+	var position uint32
+	var binlogDoDb, binlogIgnoreDb, executedGtidSet string
+	err := tx.QueryRow("SHOW MASTER STATUS").Scan(&file, &position, &binlogDoDb, &binlogIgnoreDb, &executedGtidSet)
+	return NewMysqlPosition(file, position, err)
+}
+
+func (this *DataIteratorState) MarkFullRowMatchTableCopied(table string, pos mysql.Position) {
+	this.tablesMutex.Lock()
+	defer this.tablesMutex.Unlock()
+
+	this.fullRowMatchTablesCopiedAt[table] = pos
+}
+
+// Returns the binlog positions at which the tables matched by full rows were
+// copied, keyed by table.
+func (this *DataIteratorState) FullRowMatchTablesCopiedAt() map[string]mysql.Position {
+	this.tablesMutex.RLock()
+	defer this.tablesMutex.RUnlock()
+
+	m := make(map[string]mysql.Position, len(this.fullRowMatchTablesCopiedAt))
+	for table, pos := range this.fullRowMatchTablesCopiedAt {
+		m[table] = pos
+	}
+	return m
+}
+
+// Returns true if the event was written before the table was copied, or if
+// the table is not copied yet, in which case the copy includes it. Always
+// returns false for the tables with a key.
+func (this *DataIteratorState) eventIncludedInFullRowCopy(ev DMLEvent) bool {
+	table := ev.TableSchema()
+	if !IsFullRowMatchTable(table) {
+		return false
+	}
+
+	this.tablesMutex.RLock()
+	defer this.tablesMutex.RUnlock()
+
+	copiedAt, copied := this.fullRowMatchTablesCopiedAt[table.String()]
+	return !copied || ev.BinlogPosition().Compare(copiedAt) < 0
+}
+
+// Deletes the rows of a table without a key on the target before the table is
+// copied. These rows can only have been written by an interrupted copy, as
+// the binlog events of the table are not applied before it is copied, and
+// would be duplicated by the copy as they cannot be matched to the rows of
+// the source.
+func (f *Ferry) emptyFullRowMatchTargetTable(table *schema.Table) error {
+	db := table.Schema
+	if targetDbName, exists := f.Config.DatabaseRewrites[db]; exists {
+		db = targetDbName
+	}
+
+	name := table.Name
+	if targetTableName, exists := f.Config.TableRewrites[name]; exists {
+		name = targetTableName
+	}
+
+	quotedTable := QuotedTableNameFromString(db, name)
+	if f.targetWrites != nil {
+		var rows int64
+		err := f.writerTargetDB.QueryRow("SELECT COUNT(*) FROM " + quotedTable).Scan(&rows)
+		if err != nil {
+			return fmt.Errorf("failed to count the rows of the target table of %s: %v", table.String(), err)
+		}
+
+		f.targetWrites.Start(db+"."+name, rows)
+		defer f.targetWrites.Finish(db+"."+name, rows)
+	}
+
+	result, err := f.writerTargetDB.Exec("DELETE FROM " + quotedTable)
+	if err != nil {
+		return fmt.Errorf("failed to empty target table of %s: %v", table.String(), err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err == nil && deleted > 0 {
+		f.logger.WithFields(logrus.Fields{
+			"table":   table.String(),
+			"deleted": deleted,
+		}).Warn("deleted the rows of an interrupted copy of a table without a key")
+	}
+
+	return nil
+}
+
+// Returns the events to apply to the target, without the events of the
+// tables matched by full rows that are already included in their copy.
+func (f *Ferry) eventsNotCopied(events []DMLEvent) []DMLEvent {
+	filtered := make([]DMLEvent, 0, len(events))
+	for _, ev := range events {
+		if !f.DataIterator.CurrentState.eventIncludedInFullRowCopy(ev) {
+			filtered = append(filtered, ev)
+		}
+	}
+	return filtered
+}
+
+// Limits the UPDATE and DELETE statements of the tables without a key to a
+// single row, as the identical rows of the source are changed one at a time.
+func fullRowMatchStatement(ev DMLEvent, statement string) string {
+	if !IsFullRowMatchTable(ev.TableSchema()) {
+		return statement
+	}
+
+	switch ev.(type) {
+	case *BinlogUpdateEvent, *BinlogDeleteEvent:
+		return statement + " LIMIT 1"
+	default:
+		return statement
+	}
+}
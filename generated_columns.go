@@ -0,0 +1,100 @@
+package ghostferry
+
+import (
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// The values of the generated columns are computed by a MySQL target from the
+// other columns, and writing them fails, so these columns are left out of the
+// rows and the events written to such targets. They are still read from the
+// source and verified, which compares the values computed by the source and
+// the target. The PostgreSQL targets are created with plain columns, which
+// are written as is.
+func IsGeneratedColumn(column *schema.TableColumn) bool {
+	return column.IsVirtual || column.IsStored
+}
+
+func HasGeneratedColumns(table *schema.Table) bool {
+	for i := range table.Columns {
+		if IsGeneratedColumn(&table.Columns[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a copy of the table without its generated columns.
+func tableWithoutGeneratedColumns(table *schema.Table) *schema.Table {
+	written := &schema.Table{
+		Schema:  table.Schema,
+		Name:    table.Name,
+		Indexes: table.Indexes,
+	}
+
+	for _, column := range table.Columns {
+		if !IsGeneratedColumn(&column) {
+			written.Columns = append(written.Columns, column)
+		}
+	}
+
+	for _, pkIndex := range table.PKColumns {
+		if index := written.FindColumn(table.Columns[pkIndex].Name); index >= 0 {
+			written.PKColumns = append(written.PKColumns, index)
+		}
+	}
+
+	return written
+}
+
+func rowWithoutGeneratedColumns(table *schema.Table, row RowData) RowData {
+	if row == nil {
+		return nil
+	}
+
+	written := make(RowData, 0, len(row))
+	for i, value := range row {
+		if i >= len(table.Columns) || !IsGeneratedColumn(&table.Columns[i]) {
+			written = append(written, value)
+		}
+	}
+	return written
+}
+
+func (e *RowBatch) withoutGeneratedColumns() *RowBatch {
+	values := make([]RowData, len(e.values))
+	for i, row := range e.values {
+		values[i] = rowWithoutGeneratedColumns(&e.table, row)
+	}
+
+	pkIndex := -1
+	if e.pkIndex >= 0 && !IsGeneratedColumn(&e.table.Columns[e.pkIndex]) {
+		pkIndex = 0
+		for i := 0; i < e.pkIndex; i++ {
+			if !IsGeneratedColumn(&e.table.Columns[i]) {
+				pkIndex++
+			}
+		}
+	}
+
+	return NewRowBatch(tableWithoutGeneratedColumns(&e.table), values, pkIndex)
+}
+
+func dmlEventWithoutGeneratedColumns(ev DMLEvent) DMLEvent {
+	table := ev.TableSchema()
+	base := &DMLEventBase{
+		table:     *tableWithoutGeneratedColumns(table),
+		pos:       ev.BinlogPosition(),
+		timestamp: ev.Timestamp(),
+	}
+
+	switch e := ev.(type) {
+	case *BinlogInsertEvent:
+		return &BinlogInsertEvent{newValues: rowWithoutGeneratedColumns(table, e.newValues), DMLEventBase: base}
+	case *BinlogUpdateEvent:
+		return &BinlogUpdateEvent{oldValues: rowWithoutGeneratedColumns(table, e.oldValues), newValues: rowWithoutGeneratedColumns(table, e.newValues), DMLEventBase: base}
+	case *BinlogDeleteEvent:
+		return &BinlogDeleteEvent{oldValues: rowWithoutGeneratedColumns(table, e.oldValues), DMLEventBase: base}
+	default:
+		return ev
+	}
+}
@@ -0,0 +1,69 @@
+package ghostferry
+
+import (
+	"fmt"
+	"time"
+)
+
+type HealthStatus struct {
+	Healthy  bool
+	Problems []string
+
+	OverallState   string
+	BinlogLag      time.Duration
+	ReplicationLag time.Duration
+	LastCheckpoint time.Time
+	QueueDepths    map[string]int64
+}
+
+// Reports whether the run is making progress. Meant to be polled by an
+// external health checker, especially when running with
+// ContinuousReplication.
+func (f *Ferry) Health() *HealthStatus {
+	status := &HealthStatus{
+		OverallState: f.OverallState,
+	}
+
+	switch f.OverallState {
+	case StateDone, StateInterrupted:
+		status.Problems = append(status.Problems, fmt.Sprintf("ferry is no longer running (%s)", f.OverallState))
+	}
+
+	if f.OverallState != StateStarting {
+		status.BinlogLag = f.BinlogStreamer.Lag()
+		status.ReplicationLag = f.ReplicationLag()
+
+		maxLag, _ := time.ParseDuration(f.Config.MaxHealthyBinlogLag)
+		if maxLag > 0 && status.BinlogLag > maxLag {
+			status.Problems = append(status.Problems, fmt.Sprintf("binlog streamer lag %s exceeds %s", status.BinlogLag, maxLag))
+		}
+	}
+
+	if f.QueueDepthMonitor != nil {
+		status.QueueDepths = f.QueueDepthMonitor.Depths()
+		status.Problems = append(status.Problems, f.QueueDepthMonitor.Problems()...)
+	}
+
+	if f.checkpointer != nil {
+		var err error
+		status.LastCheckpoint, err = f.checkpointer.LastCheckpoint()
+		if err != nil {
+			status.Problems = append(status.Problems, fmt.Sprintf("last checkpoint failed: %v", err))
+		}
+	}
+
+	status.Healthy = len(status.Problems) == 0
+	return status
+}
+
+// The delay of the target behind the source, in wall-clock time: the larger
+// of the lag of the binlog streamer, which is behind if the binlog is not
+// streamed fast enough, and of the binlog writer, which is behind if the
+// streamed events are not written fast enough.
+func (f *Ferry) ReplicationLag() time.Duration {
+	lag := f.BinlogStreamer.Lag()
+	if writerLag := f.BinlogWriter.Lag(); writerLag > lag {
+		lag = writerLag
+	}
+	return lag
+}
@@ -0,0 +1,100 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// The values of Config.IgnoredRowsMode.
+const (
+	IgnoredRowsCount  = "count"
+	IgnoredRowsStrict = "strict"
+)
+
+// IgnoredRowsCounter counts the rows that the INSERT IGNORE statements of
+// the BatchWriter and of the BinlogWriter skipped as they conflicted with
+// rows of the target, which are otherwise silently dropped: the rows
+// attempted by every statement are compared with the rows it affected. The
+// ignored rows are reported in the IgnoredRows metric, tagged with the
+// target table and with the source of the rows, copy or binlog.
+//
+// Some rows are expected to be ignored during a copy of a source written to:
+// the rows inserted during the copy below the maximum primary key of their
+// table are written by the binlog first and ignored by the copy, and the
+// inserts replayed after a resume are ignored. Strict only suits the copies
+// whose rows are written once, such as those of a Snapshot that is not
+// rotated. The rows of a batch retried after some of them were written are
+// counted as ignored too.
+type IgnoredRowsCounter struct {
+	// Fails the write of the rows when some of them were ignored.
+	Strict bool
+
+	copyRows   int64
+	binlogRows int64
+}
+
+// The rows attempted and inserted by the INSERT IGNORE statements of a
+// write, keyed by target table. Only added to once the statements are
+// committed.
+type insertCounts map[string]*insertCount
+
+type insertCount struct {
+	attempted int64
+	inserted  int64
+}
+
+func (c insertCounts) add(table string, attempted, inserted int64) {
+	count, exists := c[table]
+	if !exists {
+		count = &insertCount{}
+		c[table] = count
+	}
+	count.attempted += attempted
+	count.inserted += inserted
+}
+
+// Records the rows ignored by the writes from the source, AuditSourceCopy or
+// AuditSourceBinlog. Returns an error if rows were ignored and Strict is set.
+func (c *IgnoredRowsCounter) record(source string, counts insertCounts) error {
+	total := &c.copyRows
+	if source == AuditSourceBinlog {
+		total = &c.binlogRows
+	}
+
+	for table, count := range counts {
+		ignored := count.attempted - count.inserted
+		if ignored <= 0 {
+			continue
+		}
+
+		atomic.AddInt64(total, ignored)
+		metrics.Count("IgnoredRows", ignored, []MetricTag{{"table", table}, {"source", source}}, 1.0)
+
+		if c.Strict {
+			return NewClassifiedError(ErrorClassTargetConflict, fmt.Errorf("%d of the %d rows written to %s by the %s were ignored as they conflict with rows of the target", ignored, count.attempted, table, source))
+		}
+	}
+
+	return nil
+}
+
+// Returns the number of rows ignored by the copy and by the binlog.
+func (c *IgnoredRowsCounter) Counts() (copyRows, binlogRows int64) {
+	return atomic.LoadInt64(&c.copyRows), atomic.LoadInt64(&c.binlogRows)
+}
+
+// Returns the insert counts of a write if the ignored rows are counted or the
+// writes are audited, or nil.
+func newInsertCounts(ignoredRows *IgnoredRowsCounter, auditSink *AuditSink) insertCounts {
+	if ignoredRows == nil && auditSink == nil {
+		return nil
+	}
+	return make(insertCounts)
+}
+
+// Returns true if the statements writing rows to the table ignored some of
+// them.
+func (c insertCounts) ignoredSome(table string) bool {
+	count, exists := c[table]
+	return exists && count.inserted < count.attempted
+}
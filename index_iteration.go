@@ -0,0 +1,219 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// The tables of Config.DataIterationIndexes are iterated in the order of a
+// secondary index rather than of their primary key, for the tables whose
+// primary keys are spread randomly, such as hashed or random identifiers,
+// where the primary key order reads the source all over the place.
+//
+// The rows are paginated by the values of the index columns followed by the
+// primary key, which orders them uniquely, so the index columns must be NOT
+// NULL: the rows with NULL values would never compare greater than the last
+// row of a batch. The rows inserted with a primary key above the maximum
+// primary key of the table when the copy started are left to the binlog, as
+// with the primary key order.
+//
+// The position saved for a table is the primary key of the last row copied,
+// and the copy resumes after the index values of that row. If that row was
+// deleted in between, the table is copied again from its first row, which
+// writes the copied rows again but misses none.
+
+// Validates that the indexes exist, are not the primary key and only have
+// NOT NULL columns.
+func validateIterationIndexes(db *sql.DB, tables TableSchemaCache, indexes map[string]string) error {
+	for tableName, indexName := range indexes {
+		table, exists := tables[tableName]
+		if !exists {
+			continue
+		}
+
+		index := tableIndex(table, indexName)
+		if index == nil {
+			return fmt.Errorf("index %s of %s does not exist", indexName, tableName)
+		}
+
+		if strings.EqualFold(index.Name, "PRIMARY") {
+			return fmt.Errorf("index %s of %s is the primary key", indexName, tableName)
+		}
+
+		nullable, err := nullableColumns(db, table, index.Columns)
+		if err != nil {
+			return fmt.Errorf("failed to read the columns of %s: %v", tableName, err)
+		}
+
+		if len(nullable) > 0 {
+			return fmt.Errorf("index %s of %s has the nullable columns %s, which cannot be iterated", indexName, tableName, strings.Join(nullable, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Returns the index of the table with the name, or nil.
+func tableIndex(table *schema.Table, name string) *schema.Index {
+	for _, index := range table.Indexes {
+		if index.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// Returns the columns among the given columns of the table that are
+// nullable.
+func nullableColumns(db *sql.DB, table *schema.Table, columns []string) ([]string, error) {
+	query, args, err := squirrel.Select("COLUMN_NAME").
+		From("information_schema.COLUMNS").
+		Where(squirrel.Eq{
+			"TABLE_SCHEMA": table.Schema,
+			"TABLE_NAME":   table.Name,
+			"COLUMN_NAME":  columns,
+			"IS_NULLABLE":  "YES",
+		}).
+		OrderBy("ORDINAL_POSITION").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nullable []string
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return nil, err
+		}
+		nullable = append(nullable, column)
+	}
+
+	return nullable, rows.Err()
+}
+
+func (c *Cursor) iteratesIndex() bool {
+	return c.Index != nil && c.BuildSelect == nil
+}
+
+// The columns the rows are ordered by: the Index columns and the primary key.
+func (c *Cursor) indexOrderColumns() []string {
+	columns := make([]string, 0, len(c.Index.Columns)+1)
+	for _, column := range c.Index.Columns {
+		columns = append(columns, quoteField(column))
+	}
+	return append(columns, quoteField(c.pkColumn.Name))
+}
+
+// Selects the next batch of rows in the order of the Index, after the last
+// row iterated.
+func (c *Cursor) indexSelect() squirrel.SelectBuilder {
+	table := QuotedTableName(c.Table)
+	if c.Partition != "" {
+		table = fmt.Sprintf("%s PARTITION (%s)", table, quoteField(c.Partition))
+	}
+
+	orderColumns := c.indexOrderColumns()
+	selectBuilder := squirrel.Select(c.ColumnsToSelect...).
+		From(fmt.Sprintf("%s FORCE INDEX (%s)", table, quoteField(c.Index.Name))).
+		Where(squirrel.LtOrEq{quoteField(c.pkColumn.Name): c.MaxPrimaryKey}).
+		OrderBy(orderColumns...).
+		Limit(c.BatchSize)
+
+	if c.lastSuccessfulIndexKey != nil {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(orderColumns)), ",")
+		args := append(append([]interface{}{}, c.lastSuccessfulIndexKey...), c.lastSuccessfulPrimaryKey)
+		selectBuilder = selectBuilder.Where(fmt.Sprintf("(%s) > (%s)", strings.Join(orderColumns, ","), placeholders), args...)
+	}
+
+	return selectBuilder
+}
+
+// Returns the values of the Index columns of the row, whose columns are
+// named by columns.
+func (c *Cursor) indexKey(columns []string, row RowData) ([]interface{}, error) {
+	key := make([]interface{}, 0, len(c.Index.Columns))
+	for _, indexColumn := range c.Index.Columns {
+		position := -1
+		for i, column := range columns {
+			if column == indexColumn {
+				position = i
+				break
+			}
+		}
+
+		if position < 0 {
+			return nil, fmt.Errorf("index column %s is not selected", indexColumn)
+		}
+
+		key = append(key, row[position])
+	}
+
+	return key, nil
+}
+
+// Reads the values of the Index columns of the row with the StartPrimaryKey,
+// so the iteration resumes after it. The iteration starts from the first row
+// if the row was deleted.
+func (c *Cursor) loadStartIndexKey() error {
+	columns := make([]string, 0, len(c.Index.Columns))
+	for _, column := range c.Index.Columns {
+		columns = append(columns, quoteField(column))
+	}
+
+	query, args, err := squirrel.Select(columns...).
+		From(QuotedTableName(c.Table)).
+		Where(squirrel.Eq{quoteField(c.pkColumn.Name): c.StartPrimaryKey}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var key RowData
+	err = c.readRetryPolicy().Do(nil, c.logger, "read start index key", func() error {
+		// Prepared, so the values are scanned with their types, see Fetch.
+		stmt, err := c.DB.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		rows, err := stmt.Query(args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		key = nil
+		if rows.Next() {
+			key, err = ScanGenericRow(rows, len(columns))
+			if err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		c.logger.WithField("pk", c.StartPrimaryKey).Warn("the last copied row was deleted, copying the table again from its first row")
+		c.lastSuccessfulPrimaryKey = 0
+		return nil
+	}
+
+	c.lastSuccessfulIndexKey = key
+	return nil
+}
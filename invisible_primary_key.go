@@ -0,0 +1,162 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	sqlmysql "github.com/go-sql-driver/mysql"
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// Starting with MySQL 8.0.30, a primary key is generated for the tables
+// created without one if sql_generate_invisible_primary_key is enabled. This
+// generated invisible primary key (GIPK) is always the first column of the
+// table, and is only returned by the queries naming it explicitly.
+const GeneratedInvisiblePrimaryKeyColumn = "my_row_id"
+
+// MySQL error returned when a query refers to a column that does not exist.
+const errBadFieldError = 1054
+
+func HasGeneratedInvisiblePrimaryKey(table *schema.Table) bool {
+	if len(table.PKColumns) != 1 {
+		return false
+	}
+
+	pkColumn := table.GetPKColumn(0)
+	return pkColumn.Name == GeneratedInvisiblePrimaryKeyColumn && pkColumn.IsAuto && pkColumn.IsUnsigned
+}
+
+// The GIPK is hidden from SHOW COLUMNS and from information_schema if
+// show_gipk_in_create_table_and_information_schema is disabled, in which case
+// the table appears to have no primary key at all. The column can still be
+// selected and is present in the binlog, so it is added back to the schema.
+func addHiddenGeneratedInvisiblePrimaryKey(db *sql.DB, table *schema.Table) (bool, error) {
+	if len(table.PKColumns) != 0 {
+		return false, nil
+	}
+
+	for _, column := range table.Columns {
+		if column.Name == GeneratedInvisiblePrimaryKeyColumn {
+			return false, nil
+		}
+	}
+
+	hasColumn, err := tableHasColumn(db, table.Schema, table.Name, GeneratedInvisiblePrimaryKeyColumn)
+	if err != nil || !hasColumn {
+		return false, err
+	}
+
+	pkColumn := schema.TableColumn{
+		Name:       GeneratedInvisiblePrimaryKeyColumn,
+		Type:       schema.TYPE_NUMBER,
+		RawType:    "bigint unsigned",
+		IsAuto:     true,
+		IsUnsigned: true,
+	}
+
+	table.Columns = append([]schema.TableColumn{pkColumn}, table.Columns...)
+	table.PKColumns = []int{0}
+	table.Indexes = append(table.Indexes, &schema.Index{
+		Name:        "PRIMARY",
+		Columns:     []string{GeneratedInvisiblePrimaryKeyColumn},
+		Cardinality: []uint64{0},
+	})
+
+	return true, nil
+}
+
+func tableHasColumn(db *sql.DB, database, table, column string) (bool, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s LIMIT 0", quoteField(column), QuotedTableNameFromString(database, table))
+	rows, err := db.Query(query)
+	if err != nil {
+		if mysqlErr, ok := err.(*sqlmysql.MySQLError); ok && mysqlErr.Number == errBadFieldError {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, rows.Close()
+}
+
+// Keeps track of the target tables that lack the GIPK of their source table,
+// for instance because they were created with an explicit schema or on a
+// server without sql_generate_invisible_primary_key. The GIPK is left out of
+// the rows written to such tables. The target tables are only checked when
+// they are first written to, as they may be created after the ferry starts.
+type targetGIPKTracker struct {
+	DB *sql.DB
+
+	mutex   sync.Mutex
+	missing map[string]bool
+}
+
+func (t *targetGIPKTracker) omitGIPK(source *schema.Table, targetDb, targetTable string) (bool, error) {
+	if !HasGeneratedInvisiblePrimaryKey(source) {
+		return false, nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	target := QuotedTableNameFromString(targetDb, targetTable)
+	if missing, checked := t.missing[target]; checked {
+		return missing, nil
+	}
+
+	hasColumn, err := tableHasColumn(t.DB, targetDb, targetTable, GeneratedInvisiblePrimaryKeyColumn)
+	if err != nil {
+		return false, err
+	}
+
+	if t.missing == nil {
+		t.missing = make(map[string]bool)
+	}
+	t.missing[target] = !hasColumn
+	return !hasColumn, nil
+}
+
+// Returns a copy of the table without its first column, which is where
+// MySQL always places the GIPK. The copy has no primary key.
+func tableWithoutGIPK(table *schema.Table) *schema.Table {
+	return &schema.Table{
+		Schema:  table.Schema,
+		Name:    table.Name,
+		Columns: table.Columns[1:],
+	}
+}
+
+func rowWithoutGIPK(row RowData) RowData {
+	if row == nil {
+		return nil
+	}
+	return row[1:]
+}
+
+func (e *RowBatch) withoutGIPK() *RowBatch {
+	values := make([]RowData, len(e.values))
+	for i, row := range e.values {
+		values[i] = rowWithoutGIPK(row)
+	}
+
+	return NewRowBatch(tableWithoutGIPK(&e.table), values, -1)
+}
+
+func dmlEventWithoutGIPK(ev DMLEvent) DMLEvent {
+	base := &DMLEventBase{
+		table:     *tableWithoutGIPK(ev.TableSchema()),
+		pos:       ev.BinlogPosition(),
+		timestamp: ev.Timestamp(),
+	}
+
+	switch e := ev.(type) {
+	case *BinlogInsertEvent:
+		return &BinlogInsertEvent{newValues: rowWithoutGIPK(e.newValues), DMLEventBase: base}
+	case *BinlogUpdateEvent:
+		return &BinlogUpdateEvent{oldValues: rowWithoutGIPK(e.oldValues), newValues: rowWithoutGIPK(e.newValues), DMLEventBase: base}
+	case *BinlogDeleteEvent:
+		return &BinlogDeleteEvent{oldValues: rowWithoutGIPK(e.oldValues), DMLEventBase: base}
+	default:
+		return ev
+	}
+}
@@ -85,6 +85,14 @@ func (r *ReverifyStore) Add(entry ReverifyEntry) {
 	}
 }
 
+// The number of rows waiting to be reverified.
+func (r *ReverifyStore) Depth() int64 {
+	r.mapStoreMutex.Lock()
+	defer r.mapStoreMutex.Unlock()
+
+	return int64(r.RowCount)
+}
+
 func (r *ReverifyStore) FlushAndBatchByTable(batchsize int) []ReverifyBatch {
 	r.mapStoreMutex.Lock()
 	defer r.mapStoreMutex.Unlock()
@@ -129,7 +137,7 @@ func (r verificationResultAndError) ErroredOrFailed() bool {
 
 type IterativeVerifier struct {
 	CursorConfig     *CursorConfig
-	BinlogStreamer   *BinlogStreamer
+	BinlogStreamer   DMLEventSource
 	TableSchemaCache TableSchemaCache
 	SourceDB         *sql.DB
 	TargetDB         *sql.DB
@@ -141,8 +149,46 @@ type IterativeVerifier struct {
 	Concurrency         int
 	MaxExpectedDowntime time.Duration
 
-	reverifyStore *ReverifyStore
-	logger        *logrus.Entry
+	// Per table overrides of CursorConfig.BatchSize, keyed by the full table
+	// name. Usually the same as DataIterator.TableBatchSizes.
+	TableBatchSizes map[string]uint64
+
+	// The progress of a previous run to continue the verification from, as
+	// returned by SerializeState. The binlog events are then listened to
+	// from Initialize, as the rows verified by the previous run may change
+	// before VerifyBeforeCutover is called.
+	StateToResumeFrom *IterativeVerifierState
+
+	// If set, the verification before the cutover only continues while the
+	// verifier is not paused.
+	Pauser *ComponentPauser
+
+	// Fingerprints the values of the columns whose collation differs on the
+	// target as the collations compare them. See
+	// Config.VerifierNormalizeCollations.
+	NormalizeCollations bool
+
+	// The columns not compared, keyed by the full table name. See
+	// Config.VerifierIgnoredColumns.
+	IgnoredColumns map[string][]string
+
+	// Compares the FLOAT, DOUBLE and DECIMAL columns by value, with a
+	// tolerance. See Config.VerifierNumericComparison.
+	NumericComparison *NumericComparisonConfig
+
+	// If set, deferred in the goroutines of the verifier, such as
+	// Ferry.ReportPanic, so the panics of the verification are reported.
+	ReportPanic func()
+
+	tableVerifiedListeners []func(TableStats)
+
+	normalizationsMutex sync.Mutex
+	normalizations      map[string]map[string]collationNormalization
+
+	reverifyStore     *ReverifyStore
+	progress          *iterativeVerifierProgress
+	listeningToBinlog bool
+	logger            *logrus.Entry
 
 	beforeCutoverVerifyDone    bool
 	verifyDuringCutoverStarted AtomicBoolean
@@ -191,14 +237,57 @@ func (v *IterativeVerifier) Initialize() error {
 		return err
 	}
 
+	if v.ReportPanic == nil {
+		v.ReportPanic = func() {}
+	}
+
 	v.reverifyStore = NewReverifyStore()
+	v.progress = newIterativeVerifierProgress(v.StateToResumeFrom)
+
+	if v.StateToResumeFrom != nil {
+		v.logger.Info("resuming verification from previous state")
+		v.restoreReverifyStore(v.StateToResumeFrom)
+		v.listenToBinlog()
+	}
+
 	return nil
 }
 
+func (v *IterativeVerifier) listenToBinlog() {
+	if v.listeningToBinlog {
+		return
+	}
+
+	v.logger.Debug("attaching binlog event listener")
+	v.BinlogStreamer.AddEventListener(v.binlogEventListener)
+	v.listeningToBinlog = true
+}
+
+// The number of rows changed by the binlog since they were last verified.
+func (v *IterativeVerifier) ReverifyQueueDepth() int64 {
+	return v.reverifyStore.Depth()
+}
+
+// The estimated memory held by every row of the ReverifyStore, with the
+// overhead of its map.
+const reverifyEntryMemory = 48
+
+// The estimated memory used by the rows changed by the binlog since they
+// were last verified.
+func (v *IterativeVerifier) ReverifyMemoryUsage() int64 {
+	return v.reverifyStore.Depth() * reverifyEntryMemory
+}
+
+// Calls the listener whenever all the rows of a table were fingerprinted.
+// Must be called before the verification starts.
+func (v *IterativeVerifier) AddTableVerifiedListener(listener func(TableStats)) {
+	v.tableVerifiedListeners = append(v.tableVerifiedListeners, listener)
+}
+
 func (v *IterativeVerifier) VerifyOnce() (VerificationResult, error) {
 	v.logger.Info("starting one-off verification of all tables")
 
-	err := v.iterateAllTables(func(pk uint64, tableSchema *schema.Table) error {
+	err := v.iterateAllTables(nil, func(pk uint64, tableSchema *schema.Table) error {
 		return VerificationResult{
 			DataCorrect: false,
 			Message:     fmt.Sprintf("verification failed on table: %s for pk: %d", tableSchema.String(), pk),
@@ -211,18 +300,17 @@ func (v *IterativeVerifier) VerifyOnce() (VerificationResult, error) {
 	case VerificationResult:
 		return e, nil
 	default:
-		return VerificationResult{true, ""}, e
+		return VerificationResult{DataCorrect: true}, e
 	}
 }
 
 func (v *IterativeVerifier) VerifyBeforeCutover() error {
 	v.logger.Info("starting pre-cutover verification")
 
-	v.logger.Debug("attaching binlog event listener")
-	v.BinlogStreamer.AddEventListener(v.binlogEventListener)
+	v.listenToBinlog()
 
 	v.logger.Debug("verifying all tables")
-	err := v.iterateAllTables(func(pk uint64, tableSchema *schema.Table) error {
+	err := v.iterateAllTables(v.progress, func(pk uint64, tableSchema *schema.Table) error {
 		v.reverifyStore.Add(ReverifyEntry{Pk: pk, Table: tableSchema})
 		return nil
 	})
@@ -313,6 +401,7 @@ func (v *IterativeVerifier) StartInBackground() error {
 			v.backgroundDoneTime = time.Now()
 			v.backgroundVerificationWg.Done()
 		}()
+		defer v.ReportPanic()
 
 		v.verificationResultAndStatus.VerificationResult, v.verificationErr = v.VerifyDuringCutover()
 		v.verificationResultAndStatus.DoneTime = time.Now()
@@ -329,9 +418,12 @@ func (v *IterativeVerifier) Result() (VerificationResultAndStatus, error) {
 	return v.verificationResultAndStatus, v.verificationErr
 }
 
-func (v *IterativeVerifier) iterateAllTables(mismatchedPkFunc func(uint64, *schema.Table) error) error {
+// If progress is given, the tables are iterated from where they were left and
+// the progress is updated after every batch.
+func (v *IterativeVerifier) iterateAllTables(progress *iterativeVerifierProgress, mismatchedPkFunc func(uint64, *schema.Table) error) error {
 	pool := &WorkerPool{
 		Concurrency: v.Concurrency,
+		ReportPanic: v.ReportPanic,
 		Process: func(tableIndex int) (interface{}, error) {
 			table := v.Tables[tableIndex]
 
@@ -339,7 +431,7 @@ func (v *IterativeVerifier) iterateAllTables(mismatchedPkFunc func(uint64, *sche
 				return nil, nil
 			}
 
-			err := v.iterateTableFingerprints(table, mismatchedPkFunc)
+			err := v.iterateTableFingerprints(table, progress, mismatchedPkFunc)
 			if err != nil {
 				v.logger.WithError(err).WithField("table", table.String()).Error("error occured during table verification")
 			}
@@ -352,14 +444,32 @@ func (v *IterativeVerifier) iterateAllTables(mismatchedPkFunc func(uint64, *sche
 	return err
 }
 
-func (v *IterativeVerifier) iterateTableFingerprints(table *schema.Table, mismatchedPkFunc func(uint64, *schema.Table) error) error {
+func (v *IterativeVerifier) iterateTableFingerprints(table *schema.Table, progress *iterativeVerifierProgress, mismatchedPkFunc func(uint64, *schema.Table) error) error {
+	if progress != nil && progress.isCompleted(table.String()) {
+		v.logger.WithField("table", table.String()).Info("table was verified by a previous run")
+		return nil
+	}
+
 	// The cursor will stop iterating when it cannot find anymore rows,
 	// so it will not iterate until MaxUint64.
 	cursor := v.CursorConfig.NewCursorWithoutRowLock(table, math.MaxUint64)
+	if batchSize, exists := v.TableBatchSizes[table.String()]; exists {
+		cursor.BatchSize = batchSize
+	}
+
+	if progress != nil {
+		if pk, exists := progress.verifiedPk(table.String()); exists {
+			cursor.StartPrimaryKey = pk
+		}
+	}
+
+	stats := TableStats{Table: table.String(), StartTime: time.Now()}
 
 	// It only needs the PKs, not the entire row.
 	cursor.ColumnsToSelect = []string{fmt.Sprintf("`%s`", table.GetPKColumn(0).Name)}
-	return cursor.Each(func(batch *RowBatch) error {
+	err := cursor.Each(func(batch *RowBatch) error {
+		v.waitUntilResumed()
+
 		metrics.Count("RowEvent", int64(batch.Size()), []MetricTag{
 			MetricTag{"table", table.Name},
 			MetricTag{"source", "iterative_verifier_before_cutover"},
@@ -382,6 +492,9 @@ func (v *IterativeVerifier) iterateTableFingerprints(table *schema.Table, mismat
 			return err
 		}
 
+		stats.Rows += int64(len(pks))
+		stats.MismatchedRows += int64(len(mismatchedPks))
+
 		if len(mismatchedPks) > 0 {
 			v.logger.WithFields(logrus.Fields{
 				"table":          batch.TableSchema().String(),
@@ -396,8 +509,26 @@ func (v *IterativeVerifier) iterateTableFingerprints(table *schema.Table, mismat
 			}
 		}
 
+		if progress != nil && len(pks) > 0 {
+			progress.updateVerifiedPk(table.String(), pks[len(pks)-1])
+		}
+
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress.markCompleted(table.String())
+	}
+
+	stats.EndTime = time.Now()
+	for _, listener := range v.tableVerifiedListeners {
+		listener(stats)
+	}
+
+	return nil
 }
 
 func (v *IterativeVerifier) verifyStore(sourceTag string, additionalTags []MetricTag) (VerificationResult, error) {
@@ -405,14 +536,17 @@ func (v *IterativeVerifier) verifyStore(sourceTag string, additionalTags []Metri
 	v.logger.WithField("batches", len(allBatches)).Debug("reverifying")
 
 	if len(allBatches) == 0 {
-		return VerificationResult{true, ""}, nil
+		return VerificationResult{DataCorrect: true}, nil
 	}
 
 	erroredOrFailed := errors.New("verification of store errored or failed")
 
 	pool := &WorkerPool{
 		Concurrency: v.Concurrency,
+		ReportPanic: v.ReportPanic,
 		Process: func(reverifyBatchIndex int) (interface{}, error) {
+			v.waitUntilResumed()
+
 			reverifyBatch := allBatches[reverifyBatchIndex]
 			table := v.TableSchemaCache.Get(reverifyBatch.Table.SchemaName, reverifyBatch.Table.TableName)
 
@@ -439,7 +573,9 @@ func (v *IterativeVerifier) verifyStore(sourceTag string, additionalTags []Metri
 					v.reverifyStore.Add(ReverifyEntry{Pk: pk, Table: table})
 				}
 
-				resultAndErr.Result = VerificationResult{true, ""}
+				resultAndErr.Result = VerificationResult{DataCorrect: true}
+			} else if len(mismatchedPks) > 0 {
+				metrics.CountTable("Table.VerifyMismatches", table.String(), int64(len(mismatchedPks)))
 			}
 
 			if resultAndErr.ErroredOrFailed() {
@@ -479,6 +615,16 @@ func (v *IterativeVerifier) verifyStore(sourceTag string, additionalTags []Metri
 	return result, err
 }
 
+// Blocks while the verifier is paused, unless the verification during the
+// cutover started.
+func (v *IterativeVerifier) waitUntilResumed() {
+	if v.Pauser == nil || v.verifyDuringCutoverStarted.Get() {
+		return
+	}
+
+	v.Pauser.Wait(PauseVerifier)
+}
+
 func (v *IterativeVerifier) reverifyPks(table *schema.Table, pks []uint64) (VerificationResult, []uint64, error) {
 	mismatchedPks, err := v.compareFingerprints(pks, table)
 	if err != nil {
@@ -486,7 +632,7 @@ func (v *IterativeVerifier) reverifyPks(table *schema.Table, pks []uint64) (Veri
 	}
 
 	if len(mismatchedPks) == 0 {
-		return VerificationResult{true, ""}, mismatchedPks, nil
+		return VerificationResult{DataCorrect: true}, mismatchedPks, nil
 	}
 
 	pkStrings := make([]string, len(mismatchedPks))
@@ -495,8 +641,9 @@ func (v *IterativeVerifier) reverifyPks(table *schema.Table, pks []uint64) (Veri
 	}
 
 	return VerificationResult{
-		DataCorrect: false,
-		Message:     fmt.Sprintf("verification failed on table: %s for pks: %s", table.String(), strings.Join(pkStrings, ",")),
+		DataCorrect:    false,
+		Message:        fmt.Sprintf("verification failed on table: %s for pks: %s", table.String(), strings.Join(pkStrings, ",")),
+		MismatchedRows: int64(len(mismatchedPks)),
 	}, mismatchedPks, nil
 }
 
@@ -522,6 +669,11 @@ func (v *IterativeVerifier) binlogEventListener(evs []DMLEvent) error {
 }
 
 func (v *IterativeVerifier) tableIsIgnored(table *schema.Table) bool {
+	// The rows of the tables without a key cannot be fingerprinted by key.
+	if IsFullRowMatchTable(table) {
+		return true
+	}
+
 	for _, ignored := range v.IgnoredTables {
 		if table.Name == ignored {
 			return true
@@ -532,6 +684,16 @@ func (v *IterativeVerifier) tableIsIgnored(table *schema.Table) bool {
 }
 
 func (v *IterativeVerifier) compareFingerprints(pks []uint64, table *schema.Table) ([]uint64, error) {
+	span := StartSpan("IterativeVerifier.CompareFingerprints", []MetricTag{
+		{"table", table.String()},
+		{"rows", strconv.Itoa(len(pks))},
+	})
+	mismatches, err := v.fingerprintMismatches(pks, table)
+	span.End(err)
+	return mismatches, err
+}
+
+func (v *IterativeVerifier) fingerprintMismatches(pks []uint64, table *schema.Table) ([]uint64, error) {
 	targetDb := table.Schema
 	if targetDbName, exists := v.DatabaseRewrites[targetDb]; exists {
 		targetDb = targetDbName
@@ -542,6 +704,19 @@ func (v *IterativeVerifier) compareFingerprints(pks []uint64, table *schema.Tabl
 		targetTable = targetTableName
 	}
 
+	// The columns with a codec are compared once decoded, see
+	// compareEncodedColumns, as their fingerprints differ, and the numeric
+	// columns compared with a tolerance by value, see compareNumericColumns.
+	codecs := verifiedColumnCodecs(table, v.IgnoredColumns)
+	numericColumns := v.NumericComparison.comparedColumns(table, codecs, v.IgnoredColumns)
+	columns := withoutIgnoredColumns(table, columnsWithoutCodecs(table, codecs), v.IgnoredColumns)
+	columns = withoutColumnIndexes(table, columns, numericColumns)
+
+	normalizations, err := v.collationNormalizations(table, targetDb, targetTable)
+	if err != nil {
+		return nil, err
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
 
@@ -549,8 +724,9 @@ func (v *IterativeVerifier) compareFingerprints(pks []uint64, table *schema.Tabl
 	var sourceErr error
 	go func() {
 		defer wg.Done()
-		sourceErr = WithRetries(5, 0, v.logger, "get fingerprints from source db", func() (err error) {
-			sourceHashes, err = v.GetHashes(v.SourceDB, table.Schema, table.Name, table.GetPKColumn(0).Name, table.Columns, pks)
+		defer v.ReportPanic()
+		sourceErr = retryPolicyOrDefault(v.CursorConfig.ReadRetryPolicy, 5).Do(nil, v.logger, "get fingerprints from source db", func() (err error) {
+			sourceHashes, err = v.getHashes(v.SourceDB, table.Schema, table.Name, table.GetPKColumn(0).Name, columns, normalizations, pks)
 			return
 		})
 	}()
@@ -559,8 +735,9 @@ func (v *IterativeVerifier) compareFingerprints(pks []uint64, table *schema.Tabl
 	var targetErr error
 	go func() {
 		defer wg.Done()
-		targetErr = WithRetries(5, 0, v.logger, "get fingerprints from target db", func() (err error) {
-			targetHashes, err = v.GetHashes(v.TargetDB, targetDb, targetTable, table.GetPKColumn(0).Name, table.Columns, pks)
+		defer v.ReportPanic()
+		targetErr = retryPolicyOrDefault(v.CursorConfig.ReadRetryPolicy, 5).Do(nil, v.logger, "get fingerprints from target db", func() (err error) {
+			targetHashes, err = v.getHashes(v.TargetDB, targetDb, targetTable, table.GetPKColumn(0).Name, columns, normalizations, pks)
 			return
 		})
 	}()
@@ -573,7 +750,66 @@ func (v *IterativeVerifier) compareFingerprints(pks []uint64, table *schema.Tabl
 		return nil, targetErr
 	}
 
-	return compareHashes(sourceHashes, targetHashes), nil
+	mismatches := compareHashes(sourceHashes, targetHashes)
+	if codecs != nil {
+		encodedMismatches, err := v.compareEncodedColumns(table, targetDb, targetTable, codecs, pks)
+		if err != nil {
+			return nil, err
+		}
+		mismatches = unionPks(mismatches, encodedMismatches)
+	}
+
+	if len(numericColumns) > 0 {
+		numericMismatches, err := v.compareNumericColumns(table, targetDb, targetTable, numericColumns, pks)
+		if err != nil {
+			return nil, err
+		}
+		mismatches = unionPks(mismatches, numericMismatches)
+	}
+
+	return mismatches, nil
+}
+
+// Returns the collation normalizations of the columns of the table, loading
+// the schema of the target table once.
+func (v *IterativeVerifier) collationNormalizations(table *schema.Table, targetDb, targetTable string) (map[string]collationNormalization, error) {
+	if !v.NormalizeCollations {
+		return nil, nil
+	}
+
+	v.normalizationsMutex.Lock()
+	defer v.normalizationsMutex.Unlock()
+
+	if normalizations, exists := v.normalizations[table.String()]; exists {
+		return normalizations, nil
+	}
+
+	target, err := schema.NewTableFromSqlDB(v.TargetDB, targetDb, targetTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load target table %s: %v", QuotedTableNameFromString(targetDb, targetTable), err)
+	}
+
+	if v.normalizations == nil {
+		v.normalizations = make(map[string]map[string]collationNormalization)
+	}
+
+	normalizations := collationNormalizations(table, target)
+	v.normalizations[table.String()] = normalizations
+	return normalizations, nil
+}
+
+func unionPks(a, b []uint64) []uint64 {
+	set := make(map[uint64]struct{}, len(a)+len(b))
+	union := make([]uint64, 0, len(a)+len(b))
+	for _, pks := range [][]uint64{a, b} {
+		for _, pk := range pks {
+			if _, exists := set[pk]; !exists {
+				set[pk] = struct{}{}
+				union = append(union, pk)
+			}
+		}
+	}
+	return union
 }
 
 func compareHashes(source, target map[uint64][]byte) []uint64 {
@@ -601,11 +837,21 @@ func compareHashes(source, target map[uint64][]byte) []uint64 {
 }
 
 func (v *IterativeVerifier) GetHashes(db *sql.DB, schema, table, pkColumn string, columns []schema.TableColumn, pks []uint64) (map[uint64][]byte, error) {
-	sql, args, err := GetMd5HashesSql(schema, table, pkColumn, columns, pks)
+	return v.getHashes(db, schema, table, pkColumn, columns, nil, pks)
+}
+
+func (v *IterativeVerifier) getHashes(db *sql.DB, schema, table, pkColumn string, columns []schema.TableColumn, normalizations map[string]collationNormalization, pks []uint64) (map[uint64][]byte, error) {
+	sql, args, err := getMd5HashesSql(schema, table, pkColumn, columns, normalizations, pks)
 	if err != nil {
 		return nil, err
 	}
 
+	return queryHashes(db, sql, args)
+}
+
+// Runs a query selecting the primary key and the fingerprint of rows, as
+// built with rowMd5Selector, and returns the fingerprints by primary key.
+func queryHashes(db *sql.DB, sql string, args []interface{}) (map[uint64][]byte, error) {
 	// This query must be a prepared query. If it is not, querying will use
 	// MySQL's plain text interface, which will scan all values into []uint8
 	// if we give it []interface{}.
@@ -641,20 +887,27 @@ func (v *IterativeVerifier) GetHashes(db *sql.DB, schema, table, pkColumn string
 }
 
 func GetMd5HashesSql(schema, table, pkColumn string, columns []schema.TableColumn, pks []uint64) (string, []interface{}, error) {
+	return getMd5HashesSql(schema, table, pkColumn, columns, nil, pks)
+}
+
+func getMd5HashesSql(schema, table, pkColumn string, columns []schema.TableColumn, normalizations map[string]collationNormalization, pks []uint64) (string, []interface{}, error) {
 	quotedPK := quoteField(pkColumn)
-	return rowMd5Selector(columns, pkColumn).
+	return rowMd5Selector(columns, normalizations, pkColumn).
 		From(QuotedTableNameFromString(schema, table)).
 		Where(sq.Eq{quotedPK: pks}).
 		OrderBy(quotedPK).
 		ToSql()
 }
 
-func rowMd5Selector(columns []schema.TableColumn, pkColumn string) sq.SelectBuilder {
+func rowMd5Selector(columns []schema.TableColumn, normalizations map[string]collationNormalization, pkColumn string) sq.SelectBuilder {
 	quotedPK := quoteField(pkColumn)
 
 	hashStrs := make([]string, len(columns))
 	for idx, column := range columns {
 		quotedCol := normalizeAndQuoteColumn(column)
+		if normalization, exists := normalizations[column.Name]; exists {
+			quotedCol = normalization.expression(quotedCol)
+		}
 		hashStrs[idx] = fmt.Sprintf("MD5(COALESCE(%s, 'NULL'))", quotedCol)
 	}
 
@@ -670,5 +923,12 @@ func normalizeAndQuoteColumn(column schema.TableColumn) (quoted string) {
 	if column.Type == schema.TYPE_FLOAT {
 		quoted = fmt.Sprintf("(if (%s = '-0', 0, %s))", quoted, quoted)
 	}
+	// The latin1 columns are fingerprinted as utf8mb4 on both sides, so they
+	// match the target columns they are converted to with
+	// ConvertLatin1ToUtf8mb4. The conversion is lossless, so it does not
+	// hide any difference between two latin1 columns.
+	if isLatin1Column(column) {
+		quoted = fmt.Sprintf("CONVERT(%s USING utf8mb4)", quoted)
+	}
 	return
 }
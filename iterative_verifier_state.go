@@ -0,0 +1,162 @@
+package ghostferry
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// The progress of an IterativeVerifier, serialized with the state of the
+// ferry so that a resumed run continues the verification where it stopped.
+type IterativeVerifierState struct {
+	// The last primary key verified by the pre-cutover iteration of each
+	// table, keyed by the full table name.
+	VerifiedPrimaryKeys map[string]uint64
+
+	// The tables whose pre-cutover iteration completed.
+	CompletedTables map[string]bool
+
+	// The primary keys waiting to be reverified, either because they did not
+	// match or because they changed since they were verified.
+	ReverifyPrimaryKeys map[string][]uint64
+}
+
+type iterativeVerifierProgress struct {
+	mutex           sync.Mutex
+	verifiedPks     map[string]uint64
+	completedTables map[string]bool
+}
+
+func newIterativeVerifierProgress(state *IterativeVerifierState) *iterativeVerifierProgress {
+	p := &iterativeVerifierProgress{
+		verifiedPks:     make(map[string]uint64),
+		completedTables: make(map[string]bool),
+	}
+
+	if state != nil {
+		for table, pk := range state.VerifiedPrimaryKeys {
+			p.verifiedPks[table] = pk
+		}
+
+		for table, completed := range state.CompletedTables {
+			p.completedTables[table] = completed
+		}
+	}
+
+	return p
+}
+
+func (p *iterativeVerifierProgress) verifiedPk(table string) (uint64, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pk, exists := p.verifiedPks[table]
+	return pk, exists
+}
+
+func (p *iterativeVerifierProgress) updateVerifiedPk(table string, pk uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.verifiedPks[table] = pk
+}
+
+func (p *iterativeVerifierProgress) isCompleted(table string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.completedTables[table]
+}
+
+func (p *iterativeVerifierProgress) markCompleted(table string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.completedTables[table] = true
+}
+
+func (p *iterativeVerifierProgress) serialize(state *IterativeVerifierState) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for table, pk := range p.verifiedPks {
+		state.VerifiedPrimaryKeys[table] = pk
+	}
+
+	for table, completed := range p.completedTables {
+		state.CompletedTables[table] = completed
+	}
+}
+
+// Returns the progress of the verification so far. The primary keys that are
+// being reverified are included, as they may not be verified yet. Returns nil
+// if the verifier is not initialized.
+func (v *IterativeVerifier) SerializeState() *IterativeVerifierState {
+	if v.progress == nil {
+		return nil
+	}
+
+	state := &IterativeVerifierState{
+		VerifiedPrimaryKeys: make(map[string]uint64),
+		CompletedTables:     make(map[string]bool),
+		ReverifyPrimaryKeys: make(map[string][]uint64),
+	}
+
+	v.progress.serialize(state)
+
+	for tableId, pks := range v.reverifyStore.snapshot() {
+		table := &schema.Table{Schema: tableId.SchemaName, Name: tableId.TableName}
+		state.ReverifyPrimaryKeys[table.String()] = pks
+	}
+
+	return state
+}
+
+// Adds the primary keys waiting to be reverified in the state to the store.
+func (v *IterativeVerifier) restoreReverifyStore(state *IterativeVerifierState) {
+	for _, table := range v.Tables {
+		for _, pk := range state.ReverifyPrimaryKeys[table.String()] {
+			v.reverifyStore.Add(ReverifyEntry{Pk: pk, Table: table})
+		}
+	}
+}
+
+// The primary keys in the store, and in the batches flushed from it as they
+// may still be being reverified.
+func (r *ReverifyStore) snapshot() map[TableIdentifier][]uint64 {
+	r.mapStoreMutex.Lock()
+	defer r.mapStoreMutex.Unlock()
+
+	pkSets := make(map[TableIdentifier]map[uint64]struct{})
+	addPk := func(tableId TableIdentifier, pk uint64) {
+		if _, exists := pkSets[tableId]; !exists {
+			pkSets[tableId] = make(map[uint64]struct{})
+		}
+		pkSets[tableId][pk] = struct{}{}
+	}
+
+	for tableId, pkSet := range r.MapStore {
+		for pk := range pkSet {
+			addPk(tableId, pk)
+		}
+	}
+
+	for _, batch := range r.BatchStore {
+		for _, pk := range batch.Pks {
+			addPk(batch.Table, pk)
+		}
+	}
+
+	snapshot := make(map[TableIdentifier][]uint64)
+	for tableId, pkSet := range pkSets {
+		pks := make([]uint64, 0, len(pkSet))
+		for pk := range pkSet {
+			pks = append(pks, pk)
+		}
+		sort.Slice(pks, func(i, j int) bool { return pks[i] < pks[j] })
+		snapshot[tableId] = pks
+	}
+
+	return snapshot
+}
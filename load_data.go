@@ -0,0 +1,184 @@
+package ghostferry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	sqlmysql "github.com/go-sql-driver/mysql"
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// MySQL errors returned when LOAD DATA LOCAL INFILE is disabled on the
+// server or refused by it.
+const (
+	errNotAllowedCommand        = 1148
+	errClientLocalFilesDisabled = 3948
+)
+
+// The spatial column types, whose values are read in an internal format that
+// LOAD DATA cannot load back. The json columns cannot be loaded with the
+// binary character set, and the bit values would be loaded as strings of
+// digits, so they are excluded too, by their type.
+var loadDataUnsafeRawTypes = []string{
+	"geometry",
+	"point",
+	"linestring",
+	"polygon",
+	"multipoint",
+	"multilinestring",
+	"multipolygon",
+	"geometrycollection",
+	"geomcollection",
+}
+
+// Distinguishes the readers registered for the batches loaded concurrently.
+var loadDataReaderId uint64
+
+func (w *BatchWriter) canLoadRowBatch(batch *RowBatch) bool {
+	return w.LoadDataInfile && atomic.LoadInt32(&w.loadDataDisabled) == 0 && canLoadTable(batch.TableSchema())
+}
+
+// Whether the batches of the table can be written with LOAD DATA.
+func canLoadTable(table *schema.Table) bool {
+	for _, column := range table.Columns {
+		if column.Type == schema.TYPE_JSON || column.Type == schema.TYPE_BIT {
+			return false
+		}
+
+		for _, rawType := range loadDataUnsafeRawTypes {
+			if strings.HasPrefix(column.RawType, rawType) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Writes the batch with a LOAD DATA LOCAL INFILE streaming the rows from
+// memory. Like the INSERT IGNORE of the batches, the rows conflicting with
+// existing rows are skipped. Returns false if the batch has values that
+// cannot be encoded or if the target refuses LOAD DATA LOCAL INFILE, in
+// which case it must be written with an INSERT.
+func (w *BatchWriter) loadRowBatch(batch *RowBatch, db, table string, inserted insertCounts) (bool, error) {
+	columns, err := loadColumnsForTable(batch.TableSchema(), batch.Values()...)
+	if err != nil {
+		return false, err
+	}
+
+	data, ok := encodeLoadDataRows(batch.Values())
+	if !ok {
+		return false, nil
+	}
+
+	name := fmt.Sprintf("ghostferry_batch_%d", atomic.AddUint64(&loadDataReaderId, 1))
+	sqlmysql.RegisterReaderHandler(name, func() io.Reader {
+		return bytes.NewReader(data)
+	})
+	defer sqlmysql.DeregisterReaderHandler(name)
+
+	query := commentStatement(w.StatementComment, fmt.Sprintf(
+		"LOAD DATA LOCAL INFILE 'Reader::%s' IGNORE INTO TABLE %s CHARACTER SET binary "+
+			"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%s)",
+		name,
+		QuotedTableNameFromString(db, table),
+		strings.Join(columns, ","),
+	))
+
+	result, err := w.DB.Exec(query)
+	if isLoadDataDisabledError(err) {
+		w.logger.WithError(err).Warn("LOAD DATA LOCAL INFILE is disabled on the target, writing the batches with INSERT")
+		atomic.StoreInt32(&w.loadDataDisabled, 1)
+		return false, nil
+	}
+	if err != nil {
+		return true, wrapError(err, "during exec query (%s)", query)
+	}
+
+	return true, addInsertedRows(inserted, db+"."+table, batch.Size(), result)
+}
+
+func isLoadDataDisabledError(err error) bool {
+	mysqlErr, ok := err.(*sqlmysql.MySQLError)
+	return ok && (mysqlErr.Number == errNotAllowedCommand || mysqlErr.Number == errClientLocalFilesDisabled)
+}
+
+// Encodes the rows in the tab separated format of LOAD DATA, with NULL
+// encoded as \N. Returns false if a value has a type that cannot be encoded.
+func encodeLoadDataRows(rows []RowData) ([]byte, bool) {
+	buf := &bytes.Buffer{}
+
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+
+			if !encodeLoadDataValue(buf, value) {
+				return nil, false
+			}
+		}
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), true
+}
+
+func encodeLoadDataValue(buf *bytes.Buffer, value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString(`\N`)
+	case []byte:
+		writeLoadDataEscaped(buf, v)
+	case string:
+		writeLoadDataEscaped(buf, []byte(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case int32:
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(v, 10))
+	case uint32:
+		buf.WriteString(strconv.FormatUint(uint64(v), 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case float32:
+		buf.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case bool:
+		if v {
+			buf.WriteByte('1')
+		} else {
+			buf.WriteByte('0')
+		}
+	case time.Time:
+		buf.WriteString(v.Format("2006-01-02 15:04:05.999999"))
+	default:
+		return false
+	}
+
+	return true
+}
+
+func writeLoadDataEscaped(buf *bytes.Buffer, value []byte) {
+	for _, b := range value {
+		switch b {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case 0:
+			buf.WriteString(`\0`)
+		default:
+			buf.WriteByte(b)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// The names of the fields attached to the log entries, so the entries of
+// all the components can be queried by the same fields once ingested.
+const (
+	LogFieldFerryId    = "ferry_id"
+	LogFieldTable      = "table"
+	LogFieldBinlogFile = "binlog_file"
+	LogFieldBinlogPos  = "binlog_pos"
+	LogFieldPkStart    = "pk_start"
+	LogFieldPkEnd      = "pk_end"
+)
+
+// Sets up the logrus output according to Config.LogFormat. The text format
+// leaves the logrus configuration untouched, so that programs embedding the
+// ferry can configure it themselves.
+func ConfigureLogging(config *Config) error {
+	switch config.LogFormat {
+	case "", LogFormatText:
+	case LogFormatJSON:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %s, must be %s or %s", config.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	if config.FerryId != "" {
+		ferryIdLogHookOnce.Do(func() {
+			logrus.AddHook(ferryIdLogHook)
+		})
+	}
+	ferryIdLogHook.setFerryId(config.FerryId)
+
+	return nil
+}
+
+// The hook is shared by the ferries of the process, as they share the logrus
+// output, so it is only added once.
+var (
+	ferryIdLogHook     = &ferryIdHook{}
+	ferryIdLogHookOnce sync.Once
+)
+
+// Adds the ferry id to every log entry.
+type ferryIdHook struct {
+	mutex   sync.RWMutex
+	ferryId string
+}
+
+func (h *ferryIdHook) setFerryId(ferryId string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.ferryId = ferryId
+}
+
+func (h *ferryIdHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *ferryIdHook) Fire(entry *logrus.Entry) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if h.ferryId == "" {
+		return nil
+	}
+
+	// The fields are shared with the entry the log was made from, which may
+	// be reused for other logs, so they are copied rather than modified.
+	if _, exists := entry.Data[LogFieldFerryId]; !exists {
+		data := make(logrus.Fields, len(entry.Data)+1)
+		for key, value := range entry.Data {
+			data[key] = value
+		}
+		data[LogFieldFerryId] = h.ferryId
+		entry.Data = data
+	}
+	return nil
+}
+
+func LogWithTable(logger *logrus.Entry, table string) *logrus.Entry {
+	return logger.WithField(LogFieldTable, table)
+}
+
+func LogWithBinlogPosition(logger *logrus.Entry, pos mysql.Position) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{
+		LogFieldBinlogFile: pos.Name,
+		LogFieldBinlogPos:  pos.Pos,
+	})
+}
+
+// Attaches the range of primary keys of a batch, from start excluded to end
+// included.
+func LogWithPkRange(logger *logrus.Entry, start, end uint64) *logrus.Entry {
+	return logger.WithFields(logrus.Fields{
+		LogFieldPkStart: start,
+		LogFieldPkEnd:   end,
+	})
+}
@@ -0,0 +1,154 @@
+package ghostferry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The components whose memory is accounted by the MemoryBudget, as used in
+// the component tag of the MemoryUsage gauge.
+const (
+	MemoryCopy     = "copy"
+	MemoryBinlog   = "binlog"
+	MemoryVerifier = "verifier"
+)
+
+// MemoryBudget accounts for the memory held by the rows in flight in the
+// ferry: the batches being copied, the binlog events waiting to be written,
+// and the rows waiting to be reverified. Once the memory used exceeds the
+// Limit, the components adding rows are paused until it goes back under the
+// Limit: the DataIterator stops reading new batches and the BinlogStreamer
+// stops buffering events, so the process does not run out of memory when
+// the target is slower than the source.
+//
+// The components are only paused while rows are in flight, as added with
+// Add, since the memory of the sources, such as the reverify store, is only
+// released later in the run. The rows in flight are always released by the
+// writers, which are never paused, so the paused components always resume.
+type MemoryBudget struct {
+	// The memory budget in bytes. A Limit of 0 only accounts the memory.
+	Limit int64
+
+	// How often the memory used is reported as a metric.
+	Interval time.Duration
+
+	logger *logrus.Entry
+
+	mutex   sync.Mutex
+	used    map[string]int64
+	sources map[string]func() int64
+}
+
+func (b *MemoryBudget) Initialize() {
+	b.logger = logrus.WithField("tag", "memory_budget")
+	b.used = make(map[string]int64)
+	b.sources = make(map[string]func() int64)
+}
+
+// Adds a component whose memory is measured by the function instead of
+// being added and released, replacing the source with the same name if any.
+// The function must be safe for concurrent use.
+func (b *MemoryBudget) AddSource(component string, used func() int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.sources[component] = used
+}
+
+// Accounts for the memory newly held by the component.
+func (b *MemoryBudget) Add(component string, bytes int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.used[component] += bytes
+}
+
+// Releases the memory added by the component.
+func (b *MemoryBudget) Release(component string, bytes int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.used[component] -= bytes
+}
+
+// Returns the memory used by every component.
+func (b *MemoryBudget) Usage() map[string]int64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	usage := make(map[string]int64, len(b.used)+len(b.sources))
+	for component, bytes := range b.used {
+		usage[component] = bytes
+	}
+	for component, used := range b.sources {
+		usage[component] += used()
+	}
+	return usage
+}
+
+// Returns the memory used by all the components.
+func (b *MemoryBudget) Used() int64 {
+	var total int64
+	for _, bytes := range b.Usage() {
+		total += bytes
+	}
+	return total
+}
+
+// Returns true if the budget is exceeded while rows are in flight.
+func (b *MemoryBudget) exceeded() bool {
+	if b.Limit <= 0 {
+		return false
+	}
+
+	b.mutex.Lock()
+	var inFlight int64
+	for _, bytes := range b.used {
+		inFlight += bytes
+	}
+	b.mutex.Unlock()
+
+	if inFlight <= 0 {
+		return false
+	}
+	return b.Used() > b.Limit
+}
+
+// Blocks the component while the budget is exceeded and rows are in flight.
+func (b *MemoryBudget) Wait(component string) {
+	if !b.exceeded() {
+		return
+	}
+
+	start := time.Now()
+	b.logger.WithFields(logrus.Fields{
+		"component": component,
+		"used":      b.Used(),
+		"limit":     b.Limit,
+	}).Warn("memory budget exceeded, pausing until memory is released")
+
+	for b.exceeded() {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	metrics.Timer("MemoryBudget.Paused", time.Since(start), []MetricTag{{"component", component}}, 1.0)
+}
+
+func (b *MemoryBudget) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			for component, bytes := range b.Usage() {
+				metrics.Gauge("MemoryUsage", float64(bytes), []MetricTag{{"component", component}}, 1.0)
+			}
+		}
+	}
+}
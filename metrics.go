@@ -31,6 +31,10 @@ type Metrics struct {
 	DefaultTags []MetricTag
 	Sink        chan interface{}
 
+	// Limits the tables the per-table metrics are tagged with, see
+	// CountTable. Every table is tagged by name if nil.
+	TableTags *TableTagLimiter
+
 	wg sync.WaitGroup
 }
 
@@ -90,9 +94,13 @@ func (m *Metrics) Timer(key string, duration time.Duration, tags []MetricTag, sa
 	})
 }
 
+// Times the function, which is also traced as a span of the run if tracing
+// is enabled, see InitializeTracing.
 func (m *Metrics) Measure(key string, tags []MetricTag, sampleRate float64, f func()) {
+	span := StartSpan(key, tags)
 	start := time.Now()
 	f()
+	span.End(nil)
 	m.Timer(key, time.Since(start), m.mergeWithDefaultTags(tags), sampleRate)
 }
 
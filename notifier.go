@@ -0,0 +1,350 @@
+package ghostferry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The lifecycle events of a run notified to the webhooks.
+const (
+	NotificationCopyStarted        = "copy_started"
+	NotificationCopyFinished       = "copy_finished"
+	NotificationCutoverReady       = "cutover_ready"
+	NotificationCutoverAborted     = "cutover_aborted"
+	NotificationDone               = "done"
+	NotificationInterrupted        = "interrupted"
+	NotificationVerificationFailed = "verification_failed"
+	NotificationVerificationPassed = "verification_passed"
+	NotificationBinlogError        = "binlog_error"
+	NotificationFatalError         = "fatal_error"
+
+	// Notified when the snapshot of a point in time copy crosses the
+	// thresholds of SnapshotGuardConfig.
+	NotificationSnapshotThresholdExceeded = "snapshot_threshold_exceeded"
+
+	// Notified for every table, with its TableStats, so the tables can be
+	// used before the end of the run.
+	NotificationTableCopied   = "table_copied"
+	NotificationTableVerified = "table_verified"
+)
+
+var notificationEvents = map[string]bool{
+	NotificationCopyStarted:               true,
+	NotificationCopyFinished:              true,
+	NotificationCutoverReady:              true,
+	NotificationCutoverAborted:            true,
+	NotificationDone:                      true,
+	NotificationInterrupted:               true,
+	NotificationVerificationFailed:        true,
+	NotificationVerificationPassed:        true,
+	NotificationBinlogError:               true,
+	NotificationFatalError:                true,
+	NotificationSnapshotThresholdExceeded: true,
+	NotificationTableCopied:               true,
+	NotificationTableVerified:             true,
+}
+
+// The header carrying the hex encoded HMAC-SHA256 of the body, keyed by the
+// Secret of the webhook, as "sha256=<hmac>".
+const WebhookSignatureHeader = "X-Ghostferry-Signature"
+
+// The JSON body posted to the webhooks.
+type Notification struct {
+	Event string
+	Time  time.Time
+
+	// Increases with every notification of the run, as the notifications
+	// may be delivered out of order.
+	Sequence int64
+
+	OverallState string
+	Message      string `json:",omitempty"`
+
+	// The rows found mismatched by a failed verification, if the verifier
+	// counts them.
+	MismatchedRows int64 `json:",omitempty"`
+
+	// Only set for the table_copied and table_verified events.
+	Table *TableStats `json:",omitempty"`
+}
+
+type WebhookConfig struct {
+	// Required
+	URL string
+
+	// The events posted to the URL, see the Notification* constants.
+	//
+	// Optional: defaults to all the events, except the events posted for
+	// every table, table_copied and table_verified.
+	Events []string
+
+	// If set, every request is signed with this secret, see
+	// WebhookSignatureHeader.
+	//
+	// Optional: defaults to unsigned requests.
+	Secret string
+
+	// The timeout of every request.
+	//
+	// Optional: defaults to 10s.
+	Timeout string
+
+	// The errors and the 5xx and 429 responses are retried according to this
+	// policy. The other responses are not retried.
+	//
+	// Optional: defaults to 5 attempts, with an exponential backoff from 1s.
+	RetryPolicy *RetryPolicy
+
+	events  map[string]bool
+	timeout time.Duration
+
+	// Encodes the body posted for a notification. Defaults to the
+	// Notification as JSON.
+	encode func(Notification) ([]byte, error)
+}
+
+func (c *WebhookConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %s", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL must be an http or https URL, got %s", c.URL)
+	}
+
+	c.events = make(map[string]bool, len(c.Events))
+	for _, event := range c.Events {
+		if !notificationEvents[event] {
+			return fmt.Errorf("invalid event %s", event)
+		}
+		c.events[event] = true
+	}
+
+	if c.Timeout == "" {
+		c.Timeout = "10s"
+	}
+
+	c.timeout, err = time.ParseDuration(c.Timeout)
+	if err != nil {
+		return fmt.Errorf("invalid Timeout: %s", err)
+	}
+
+	if c.RetryPolicy == nil {
+		c.RetryPolicy = &RetryPolicy{
+			MaxAttempts:  5,
+			Backoff:      RetryBackoffExponential,
+			InitialDelay: "1s",
+			Jitter:       0.2,
+		}
+	}
+
+	if c.RetryPolicy.IsRetryable == nil {
+		c.RetryPolicy.IsRetryable = isRetryableWebhookError
+	}
+
+	if err := c.RetryPolicy.Validate(); err != nil {
+		return fmt.Errorf("RetryPolicy: %s", err)
+	}
+
+	return nil
+}
+
+func (c *WebhookConfig) notifies(event string) bool {
+	if len(c.events) == 0 {
+		return event != NotificationTableCopied && event != NotificationTableVerified
+	}
+	return c.events[event]
+}
+
+func (c *WebhookConfig) encodeNotification(notification Notification) ([]byte, error) {
+	if c.encode != nil {
+		return c.encode(notification)
+	}
+	return json.Marshal(notification)
+}
+
+type webhookResponseError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e webhookResponseError) Error() string {
+	return fmt.Sprintf("webhook returned %s", e.Status)
+}
+
+func isRetryableWebhookError(err error) bool {
+	if responseErr, ok := err.(webhookResponseError); ok {
+		return responseErr.StatusCode >= 500 || responseErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return err != context.Canceled
+}
+
+// Notifier posts the lifecycle events of a run to the configured webhooks,
+// so the systems orchestrating the runs can react to them. The events are
+// delivered in the background, use Wait to wait for them to be delivered.
+type Notifier struct {
+	Webhooks []*WebhookConfig
+
+	// Returns the OverallState included in the notifications.
+	State func() string
+
+	logger   *logrus.Entry
+	client   *http.Client
+	sequence int64
+	wg       sync.WaitGroup
+}
+
+func (n *Notifier) Initialize() {
+	n.logger = logrus.WithField("tag", "notifier")
+	n.client = &http.Client{}
+}
+
+// Notifies the webhooks of the event in the background. The failures to
+// deliver a notification are logged, they never fail the run.
+func (n *Notifier) Notify(event, message string) {
+	n.send(Notification{Event: event, Message: message})
+}
+
+// Notifies the webhooks of the event of a table in the background, like
+// Notify.
+func (n *Notifier) NotifyTable(event string, stats TableStats) {
+	n.send(Notification{Event: event, Table: &stats})
+}
+
+func (n *Notifier) send(notification Notification) {
+	event := notification.Event
+	notification.Time = time.Now()
+	notification.Sequence = atomic.AddInt64(&n.sequence, 1)
+
+	if n.State != nil {
+		notification.OverallState = n.State()
+	}
+
+	for _, webhook := range n.Webhooks {
+		if !webhook.notifies(event) {
+			continue
+		}
+
+		body, err := webhook.encodeNotification(notification)
+		if err != nil {
+			n.logger.WithError(err).WithField("url", webhook.URL).Error("failed to encode notification")
+			continue
+		}
+
+		n.wg.Add(1)
+		go func(webhook *WebhookConfig, body []byte) {
+			defer n.wg.Done()
+
+			logger := n.logger.WithFields(logrus.Fields{"url": webhook.URL, "event": event})
+			err := webhook.RetryPolicy.Do(nil, logger, "post notification", func() error {
+				return n.post(webhook, event, body)
+			})
+			if err != nil {
+				logger.WithError(err).Error("failed to deliver notification")
+				metrics.Count("Notifier.Failed", 1, []MetricTag{{"event", event}}, 1.0)
+			}
+		}(webhook, body)
+	}
+}
+
+// Waits until the notifications sent so far are delivered or given up.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) post(webhook *WebhookConfig, event string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhook.timeout)
+	defer cancel()
+
+	request, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Ghostferry-Event", event)
+	if webhook.Secret != "" {
+		request.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookBody(webhook.Secret, body))
+	}
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return webhookResponseError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+
+	return nil
+}
+
+// Returns the hex encoded HMAC-SHA256 of the body, as sent in the
+// WebhookSignatureHeader, so the receivers can verify the notifications.
+func SignWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// The notifications sent when the OverallState of the ferry changes.
+var stateNotifications = map[string]string{
+	StateCopying:           NotificationCopyStarted,
+	StateWaitingForCutover: NotificationCutoverReady,
+	StateDone:              NotificationDone,
+	StateInterrupted:       NotificationInterrupted,
+}
+
+// Notifies the webhooks of the ferry, if any, of the event.
+func (f *Ferry) Notify(event, message string) {
+	if f.notifier != nil {
+		f.notifier.Notify(event, message)
+	}
+}
+
+// Waits until the notifications of the ferry sent so far are delivered. Run
+// waits for them before returning.
+func (f *Ferry) WaitForNotifications() {
+	if f.notifier != nil {
+		f.notifier.Wait()
+	}
+}
+
+// Notifies the webhooks of the ferry of the result of a verification, with
+// the number of mismatched rows of a failed verification.
+func (f *Ferry) NotifyVerificationResult(result VerificationResult, err error) {
+	if f.notifier == nil {
+		return
+	}
+
+	if err != nil {
+		f.notifier.Notify(NotificationVerificationFailed, err.Error())
+	} else if !result.DataCorrect {
+		f.notifier.send(Notification{
+			Event:          NotificationVerificationFailed,
+			Message:        result.Message,
+			MismatchedRows: result.MismatchedRows,
+		})
+	} else {
+		f.notifier.Notify(NotificationVerificationPassed, "")
+	}
+}
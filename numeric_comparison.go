@@ -0,0 +1,191 @@
+package ghostferry
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// NumericComparisonConfig configures how the IterativeVerifier compares the
+// FLOAT, DOUBLE and DECIMAL columns, whose values can differ in their
+// representation without differing in a way that matters, such as a FLOAT
+// column widened to a DOUBLE on the target or a DECIMAL column whose scale
+// grew and pads the values with trailing zeros.
+//
+// The compared columns are left out of the fingerprints of the rows and are
+// read from the source and the target to be compared by value, like the
+// columns with a ColumnCodec, which costs a query on each side for every
+// batch of rows verified.
+type NumericComparisonConfig struct {
+	// The FLOAT and DOUBLE values whose difference is at most FloatEpsilon
+	// are equal.
+	//
+	// Optional: defaults to 0, fingerprinting the values as they are.
+	FloatEpsilon float64
+
+	// The DECIMAL values whose difference is at most DecimalEpsilon, as a
+	// decimal number such as "0.01", are equal.
+	//
+	// Optional: defaults to comparing the DECIMAL values exactly.
+	DecimalEpsilon string
+
+	// Compares the DECIMAL values by value, so the trailing zeros of the
+	// values, such as 1.5 and 1.500, do not make them differ. This is
+	// implied by DecimalEpsilon.
+	//
+	// Optional: defaults to false.
+	NormalizeDecimals bool
+}
+
+func (c *NumericComparisonConfig) Validate() error {
+	if c.FloatEpsilon < 0 {
+		return fmt.Errorf("FloatEpsilon cannot be negative")
+	}
+
+	if c.DecimalEpsilon != "" {
+		epsilon, ok := new(big.Rat).SetString(c.DecimalEpsilon)
+		if !ok {
+			return fmt.Errorf("invalid DecimalEpsilon %q", c.DecimalEpsilon)
+		}
+
+		if epsilon.Sign() < 0 {
+			return fmt.Errorf("DecimalEpsilon cannot be negative")
+		}
+	}
+
+	return nil
+}
+
+// Returns true if the column is compared by value rather than fingerprinted.
+func (c *NumericComparisonConfig) comparesColumn(column schema.TableColumn) bool {
+	if column.Type != schema.TYPE_FLOAT {
+		return false
+	}
+
+	if isDecimalColumn(column) {
+		return c.NormalizeDecimals || c.DecimalEpsilon != ""
+	}
+	return c.FloatEpsilon > 0
+}
+
+func (c *NumericComparisonConfig) epsilon(column schema.TableColumn) *big.Rat {
+	if !isDecimalColumn(column) {
+		return new(big.Rat).SetFloat64(c.FloatEpsilon)
+	}
+
+	epsilon := new(big.Rat)
+	if c.DecimalEpsilon != "" {
+		epsilon.SetString(c.DecimalEpsilon)
+	}
+	return epsilon
+}
+
+// Returns true if the values of the column read from the source and the
+// target are equal within the epsilon of the column. The values can be read
+// as floats, integers or the decimal strings of the DECIMAL columns, as the
+// type of the column may differ on the target.
+func (c *NumericComparisonConfig) ValuesMatch(column schema.TableColumn, source, target interface{}) (bool, error) {
+	if isNilValue(source) || isNilValue(target) {
+		return isNilValue(source) && isNilValue(target), nil
+	}
+
+	sourceValue, err := numericValue(source)
+	if err != nil {
+		return false, err
+	}
+
+	targetValue, err := numericValue(target)
+	if err != nil {
+		return false, err
+	}
+
+	difference := new(big.Rat).Sub(sourceValue, targetValue)
+	return difference.Abs(difference).Cmp(c.epsilon(column)) <= 0, nil
+}
+
+// Returns the indexes of the columns of the table compared by value, but
+// for the ignored columns and the columns with a codec, which are compared
+// on their own.
+func (c *NumericComparisonConfig) comparedColumns(table *schema.Table, codecs map[int]ColumnCodec, ignoredColumns map[string][]string) []int {
+	if c == nil {
+		return nil
+	}
+
+	var indexes []int
+	for i, column := range table.Columns {
+		if _, exists := codecs[i]; exists {
+			continue
+		}
+
+		if c.comparesColumn(column) && !isIgnoredColumn(table, column.Name, ignoredColumns) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// The DECIMAL columns have the TYPE_FLOAT type, like the FLOAT and DOUBLE
+// columns.
+func isDecimalColumn(column schema.TableColumn) bool {
+	return strings.HasPrefix(column.RawType, "decimal")
+}
+
+func numericValue(value interface{}) (*big.Rat, error) {
+	switch v := value.(type) {
+	case float64:
+		if rat := new(big.Rat).SetFloat64(v); rat != nil {
+			return rat, nil
+		}
+	case float32:
+		if rat := new(big.Rat).SetFloat64(float64(v)); rat != nil {
+			return rat, nil
+		}
+	case int64:
+		return new(big.Rat).SetInt64(v), nil
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v)), nil
+	case []byte:
+		if rat, ok := new(big.Rat).SetString(string(v)); ok {
+			return rat, nil
+		}
+	case string:
+		if rat, ok := new(big.Rat).SetString(v); ok {
+			return rat, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected numeric value %v of type %T", value, value)
+}
+
+// Returns the primary keys of the rows whose numeric columns compared by
+// value differ between the source and the target.
+func (v *IterativeVerifier) compareNumericColumns(table *schema.Table, targetDb, targetTable string, indexes []int, pks []uint64) ([]uint64, error) {
+	sourceRows, targetRows, err := v.selectVerifiedColumns(table, targetDb, targetTable, indexes, pks)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []uint64{}
+	for pk, sourceRow := range sourceRows {
+		targetRow, exists := targetRows[pk]
+		if !exists {
+			continue // The missing rows are reported by the fingerprints.
+		}
+
+		for j, i := range indexes {
+			match, err := v.NumericComparison.ValuesMatch(table.Columns[i], sourceRow[j+1], targetRow[j+1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to compare column %s of %s: %v", table.Columns[i].Name, table.String(), err)
+			}
+
+			if !match {
+				mismatches = append(mismatches, pk)
+				break
+			}
+		}
+	}
+
+	return mismatches, nil
+}
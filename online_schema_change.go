@@ -0,0 +1,270 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	OnlineSchemaChangeActionFail   = "fail"
+	OnlineSchemaChangeActionWait   = "wait"
+	OnlineSchemaChangeActionIgnore = "ignore"
+)
+
+const (
+	OnlineSchemaChangeToolGhost = "gh-ost"
+	OnlineSchemaChangeToolPtOsc = "pt-online-schema-change"
+	OnlineSchemaChangeToolLHM   = "lhm"
+)
+
+// A pattern of the names of the tables or triggers created by an online
+// schema change tool, whose first group is the name of the migrated table.
+type onlineSchemaChangePattern struct {
+	tool   string
+	regexp *regexp.Regexp
+
+	// Set if the table or trigger only exists while the migration runs. The
+	// others, such as the old tables kept after the swap, are leftovers.
+	running bool
+}
+
+var (
+	onlineSchemaChangeTablePatterns = []onlineSchemaChangePattern{
+		{OnlineSchemaChangeToolGhost, regexp.MustCompile(`^_(.+)_(gho|ghc)$`), true},
+		{OnlineSchemaChangeToolGhost, regexp.MustCompile(`^_(.+?)(_\d{14})?_del$`), false},
+		{OnlineSchemaChangeToolPtOsc, regexp.MustCompile(`^_(.+)_new$`), true},
+		{OnlineSchemaChangeToolPtOsc, regexp.MustCompile(`^_(.+)_old$`), false},
+		{OnlineSchemaChangeToolLHM, regexp.MustCompile(`^lhmn_(.+)$`), true},
+		{OnlineSchemaChangeToolLHM, regexp.MustCompile(`^lhma_\d{4}_\d{2}_\d{2}_\d{2}_\d{2}_\d{2}_\d{3}_(.+)$`), false},
+	}
+
+	// The triggers copy the writes to the shadow table while the rows are
+	// copied. gh-ost tails the binlog instead.
+	onlineSchemaChangeTriggerPatterns = []onlineSchemaChangePattern{
+		{OnlineSchemaChangeToolPtOsc, regexp.MustCompile(`^pt_osc_.+_(ins|upd|del)$`), true},
+		{OnlineSchemaChangeToolLHM, regexp.MustCompile(`^lhmt_(ins|upd|del)_.+$`), true},
+	}
+)
+
+// An online schema change running on a ferried table, found from the shadow
+// table or the trigger created by the tool on the source. The table is
+// renamed when the migration completes, so it must not be ferried while the
+// migration runs.
+type OnlineSchemaChange struct {
+	Tool string
+
+	// The migrated table, as schema.table.
+	Table string
+
+	// The shadow table or the trigger that was found.
+	Object string
+}
+
+func (c OnlineSchemaChange) String() string {
+	return fmt.Sprintf("%s on %s (%s)", c.Tool, c.Table, c.Object)
+}
+
+// Returns the migrated table and the tool if the table is a shadow table of
+// an online schema change tool, such as _orders_gho for gh-ost.
+func onlineSchemaChangeShadowTable(name string) (onlineSchemaChangePattern, string, bool) {
+	for _, pattern := range onlineSchemaChangeTablePatterns {
+		if match := pattern.regexp.FindStringSubmatch(name); match != nil {
+			return pattern, match[1], true
+		}
+	}
+	return onlineSchemaChangePattern{}, "", false
+}
+
+// Finds the online schema changes running on the tables, and the shadow
+// tables of the online schema change tools among the tables, which must not
+// be ferried. A table is only considered a shadow table if the table it was
+// created for exists in the same schema.
+func DetectOnlineSchemaChanges(db *sql.DB, tables []*schema.Table) ([]OnlineSchemaChange, []*schema.Table, error) {
+	ferried := make(map[string]*schema.Table, len(tables))
+	schemas := make(map[string]bool)
+	for _, table := range tables {
+		ferried[table.String()] = table
+		schemas[table.Schema] = true
+	}
+
+	changes := []OnlineSchemaChange{}
+	var shadowTables []*schema.Table
+
+	for dbname := range schemas {
+		tableNames, err := showTablesFrom(db, dbname)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		exists := make(map[string]bool, len(tableNames))
+		for _, name := range tableNames {
+			exists[name] = true
+		}
+
+		for _, name := range tableNames {
+			pattern, original, ok := onlineSchemaChangeShadowTable(name)
+			if !ok || !exists[original] {
+				continue
+			}
+
+			if shadow, isFerried := ferried[dbname+"."+name]; isFerried {
+				shadowTables = append(shadowTables, shadow)
+			}
+
+			if _, isFerried := ferried[dbname+"."+original]; isFerried && pattern.running {
+				changes = append(changes, OnlineSchemaChange{
+					Tool:   pattern.tool,
+					Table:  dbname + "." + original,
+					Object: name,
+				})
+			}
+		}
+
+		triggerChanges, err := onlineSchemaChangeTriggers(db, dbname, ferried)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, triggerChanges...)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].String() < changes[j].String()
+	})
+
+	return changes, shadowTables, nil
+}
+
+func onlineSchemaChangeTriggers(db *sql.DB, dbname string, ferried map[string]*schema.Table) ([]OnlineSchemaChange, error) {
+	rows, err := db.Query("SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ?", dbname)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []OnlineSchemaChange
+	for rows.Next() {
+		var trigger, table string
+		err = rows.Scan(&trigger, &table)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, isFerried := ferried[dbname+"."+table]; !isFerried {
+			continue
+		}
+
+		for _, pattern := range onlineSchemaChangeTriggerPatterns {
+			if pattern.regexp.MatchString(trigger) {
+				changes = append(changes, OnlineSchemaChange{
+					Tool:   pattern.tool,
+					Table:  dbname + "." + table,
+					Object: "trigger " + trigger,
+				})
+				break
+			}
+		}
+	}
+
+	return changes, rows.Err()
+}
+
+// OnlineSchemaChangeError is returned when online schema changes are
+// running on ferried tables with the fail OnlineSchemaChangeAction.
+type OnlineSchemaChangeError struct {
+	Changes []OnlineSchemaChange
+}
+
+func (e OnlineSchemaChangeError) Error() string {
+	changes := make([]string, len(e.Changes))
+	for i, change := range e.Changes {
+		changes[i] = change.String()
+	}
+
+	return fmt.Sprintf("online schema changes are running on ferried tables, which would be renamed during the run: %s", strings.Join(changes, ", "))
+}
+
+// Leaves the shadow tables of the online schema change tools out of the
+// ferried tables, and handles the migrations running on the ferried tables
+// with Config.OnlineSchemaChangeAction.
+func (f *Ferry) checkOnlineSchemaChanges() error {
+	if f.Config.OnlineSchemaChangeAction == OnlineSchemaChangeActionIgnore {
+		return nil
+	}
+
+	changes, shadowTables, err := DetectOnlineSchemaChanges(f.SourceDB, f.Tables.AsSlice())
+	if err != nil {
+		return fmt.Errorf("failed to detect online schema changes: %v", err)
+	}
+
+	for _, table := range shadowTables {
+		f.logger.WithField("table", table.String()).Warn("not ferrying the shadow table of an online schema change tool")
+		delete(f.Tables, table.String())
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return f.handleOnlineSchemaChanges(changes)
+}
+
+// Waits for the online schema changes running on the ferried tables to
+// complete before the cutover, as the tables would otherwise be renamed
+// while the source is locked or after the tenant is moved.
+func (f *Ferry) waitForOnlineSchemaChangesBeforeCutover() error {
+	if f.Config.OnlineSchemaChangeAction == OnlineSchemaChangeActionIgnore {
+		return nil
+	}
+
+	changes, _, err := DetectOnlineSchemaChanges(f.SourceDB, f.Tables.AsSlice())
+	if err != nil {
+		return fmt.Errorf("failed to detect online schema changes: %v", err)
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return f.handleOnlineSchemaChanges(changes)
+}
+
+func (f *Ferry) handleOnlineSchemaChanges(changes []OnlineSchemaChange) error {
+	if f.Config.OnlineSchemaChangeAction != OnlineSchemaChangeActionWait {
+		return OnlineSchemaChangeError{Changes: changes}
+	}
+
+	interval, _ := time.ParseDuration(f.Config.OnlineSchemaChangeCheckInterval)
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	logger := logrus.WithField("tag", "online_schema_change")
+
+	for len(changes) > 0 {
+		metrics.Gauge("OnlineSchemaChangesRunning", float64(len(changes)), nil, 1.0)
+		logger.WithField("changes", changes).Warnf("waiting for %d online schema change(s) on ferried tables to complete", len(changes))
+
+		select {
+		case <-time.After(interval):
+		case <-f.interruptedCh:
+			return nil
+		}
+
+		var err error
+		changes, _, err = DetectOnlineSchemaChanges(f.SourceDB, f.Tables.AsSlice())
+		if err != nil {
+			return fmt.Errorf("failed to detect online schema changes: %v", err)
+		}
+	}
+
+	metrics.Gauge("OnlineSchemaChangesRunning", 0, nil, 1.0)
+	logger.Info("no online schema change is running on the ferried tables anymore")
+	return nil
+}
@@ -0,0 +1,245 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// FerryOption configures a Ferry created with NewFerry.
+type FerryOption func(*Ferry) error
+
+// Creates a ferry to embed in another program. The ferry must then be
+// initialized, started and run as usual:
+//
+//	ferry, err := ghostferry.NewFerry(config,
+//		ghostferry.WithErrorHandler(handler),
+//		ghostferry.OnTableCopied(func(table *schema.Table) { ... }),
+//	)
+//	err = ferry.Initialize()
+//	err = ferry.Start()
+//	go ferry.RunContext(ctx)
+//	ferry.WaitUntilRowCopyIsComplete()
+func NewFerry(config *Config, options ...FerryOption) (*Ferry, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config must not be nil")
+	}
+
+	f := &Ferry{Config: config}
+	for _, option := range options {
+		err := option(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// The hooks registered with the On* options. The hooks are called
+// synchronously from the components of the ferry, so they must not block.
+type ferryHooks struct {
+	tableCopied  []func(*schema.Table)
+	batchWritten []func(*RowBatch)
+	binlogEvent  []func([]DMLEvent)
+	stateChange  []func(from, to string)
+
+	tableCompleted []func(event string, stats TableStats)
+}
+
+func WithErrorHandler(errorHandler ErrorHandler) FerryOption {
+	return func(f *Ferry) error {
+		f.ErrorHandler = errorHandler
+		return nil
+	}
+}
+
+func WithThrottler(throttler Throttler) FerryOption {
+	return func(f *Ferry) error {
+		f.Throttler = throttler
+		return nil
+	}
+}
+
+func WithReadThrottler(throttler Throttler) FerryOption {
+	return func(f *Ferry) error {
+		f.ReadThrottler = throttler
+		return nil
+	}
+}
+
+func WithWriteThrottler(throttler Throttler) FerryOption {
+	return func(f *Ferry) error {
+		f.WriteThrottler = throttler
+		return nil
+	}
+}
+
+func WithRowBatchWriter(writer RowBatchWriter) FerryOption {
+	return func(f *Ferry) error {
+		f.RowBatchWriter = writer
+		return nil
+	}
+}
+
+func WithDMLEventWriter(writer DMLEventWriter) FerryOption {
+	return func(f *Ferry) error {
+		f.DMLEventWriter = writer
+		return nil
+	}
+}
+
+// Resumes the run from a previous state, see Config.StateToResumeFrom.
+func WithStateToResumeFrom(state *SerializableState) FerryOption {
+	return func(f *Ferry) error {
+		f.Config.StateToResumeFrom = state
+		return nil
+	}
+}
+
+// Calls the hook once all the rows of a table were copied to the target.
+func OnTableCopied(hook func(table *schema.Table)) FerryOption {
+	return func(f *Ferry) error {
+		f.hooks.tableCopied = append(f.hooks.tableCopied, hook)
+		return nil
+	}
+}
+
+// Calls the hook once a table is copied, with the NotificationTableCopied
+// event, and once it is verified by the IterativeVerifier, with the
+// NotificationTableVerified event, so the table can be used before the end
+// of the run.
+func OnTableCompleted(hook func(event string, stats TableStats)) FerryOption {
+	return func(f *Ferry) error {
+		f.hooks.tableCompleted = append(f.hooks.tableCompleted, hook)
+		return nil
+	}
+}
+
+// Calls the hook after every batch of rows written to the target.
+func OnBatchWritten(hook func(batch *RowBatch)) FerryOption {
+	return func(f *Ferry) error {
+		f.hooks.batchWritten = append(f.hooks.batchWritten, hook)
+		return nil
+	}
+}
+
+// Calls the hook with the events streamed from the binlog for the ferried
+// tables, once they are buffered to be written to the target.
+func OnBinlogEvent(hook func(events []DMLEvent)) FerryOption {
+	return func(f *Ferry) error {
+		f.hooks.binlogEvent = append(f.hooks.binlogEvent, hook)
+		return nil
+	}
+}
+
+// Calls the hook whenever the OverallState of the ferry changes.
+func OnStateChange(hook func(from, to string)) FerryOption {
+	return func(f *Ferry) error {
+		f.hooks.stateChange = append(f.hooks.stateChange, hook)
+		return nil
+	}
+}
+
+// Registers the hooks as listeners of the components. Must be called after
+// the builtin listeners are registered, so the hooks are called once the
+// rows and events are written.
+func (f *Ferry) registerHooks() {
+	if len(f.hooks.tableCopied) > 0 {
+		f.DataIterator.AddTableDoneListener(func(table *schema.Table) error {
+			for _, hook := range f.hooks.tableCopied {
+				hook(table)
+			}
+			return nil
+		})
+	}
+
+	if len(f.hooks.tableCompleted) > 0 || f.notifier != nil {
+		copyStats := newTableStatsTracker()
+		f.DataIterator.AddBatchListener(func(batch *RowBatch) error {
+			copyStats.count(batch.TableSchema().String(), int64(batch.Size()))
+			return nil
+		})
+		f.DataIterator.AddTableDoneListener(func(table *schema.Table) error {
+			f.notifyTableCompleted(NotificationTableCopied, copyStats.complete(table.String()))
+			return nil
+		})
+	}
+
+	if len(f.hooks.batchWritten) > 0 {
+		f.DataIterator.AddBatchListener(func(batch *RowBatch) error {
+			for _, hook := range f.hooks.batchWritten {
+				hook(batch)
+			}
+			return nil
+		})
+	}
+
+	if len(f.hooks.binlogEvent) > 0 {
+		f.BinlogStreamer.AddEventListener(func(events []DMLEvent) error {
+			if len(events) == 0 {
+				return nil
+			}
+
+			for _, hook := range f.hooks.binlogEvent {
+				hook(events)
+			}
+			return nil
+		})
+	}
+}
+
+// Notifies the webhooks and calls the OnTableCompleted hooks once the table
+// is verified. Meant to be registered as a listener of the IterativeVerifier.
+func (f *Ferry) NotifyTableVerified(stats TableStats) {
+	f.notifyTableCompleted(NotificationTableVerified, stats)
+}
+
+func (f *Ferry) notifyTableCompleted(event string, stats TableStats) {
+	if f.notifier != nil {
+		f.notifier.NotifyTable(event, stats)
+	}
+
+	for _, hook := range f.hooks.tableCompleted {
+		hook(event, stats)
+	}
+}
+
+func (f *Ferry) setState(state string) {
+	from := f.OverallState
+	f.OverallState = state
+
+	if from == state {
+		return
+	}
+
+	if event, exists := stateNotifications[state]; exists {
+		f.Notify(event, "")
+	}
+
+	for _, hook := range f.hooks.stateChange {
+		hook(from, state)
+	}
+}
+
+// Runs the ferry like Run, and interrupts the run when the context is
+// cancelled, so that it can be resumed from SerializeState later. A run in
+// the cutover cannot be interrupted and runs to completion.
+func (f *Ferry) RunContext(ctx context.Context) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err := f.Interrupt()
+			if err != nil {
+				f.logger.WithError(err).Warn("ignoring cancellation of the context")
+			}
+		}
+	}()
+
+	f.Run()
+}
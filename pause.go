@@ -0,0 +1,113 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The components of the ferry that can be paused on their own with the
+// ComponentPauser.
+const (
+	// The DataIterator copying the rows of the tables.
+	PauseCopy = "copy"
+
+	// The BinlogWriter applying the binlog events to the target. The binlog
+	// is still streamed while the writer is paused, until its buffer is full.
+	// The cutover waits for the binlog writer to be resumed.
+	PauseBinlog = "binlog"
+
+	// The IterativeVerifier, before the cutover. The verification during the
+	// cutover is never paused, so as to not extend the downtime.
+	PauseVerifier = "verifier"
+)
+
+var pausableComponents = map[string]bool{
+	PauseCopy:     true,
+	PauseBinlog:   true,
+	PauseVerifier: true,
+}
+
+// ComponentPauser pauses the components of the ferry independently of each
+// other, as opposed to the throttlers which pause all the reads or all the
+// writes. For example, the copy can be paused during the peak hours while
+// the binlog is still applied, so the target does not lag behind. The paused
+// components are kept in the SerializableState, so a resumed run stays
+// paused.
+type ComponentPauser struct {
+	logger *logrus.Entry
+
+	mutex  sync.RWMutex
+	paused map[string]bool
+}
+
+func NewComponentPauser() *ComponentPauser {
+	return &ComponentPauser{
+		logger: logrus.WithField("tag", "pauser"),
+		paused: make(map[string]bool),
+	}
+}
+
+// Pauses or resumes the component, which must be one of PauseCopy,
+// PauseBinlog and PauseVerifier. A paused component stops before its next
+// batch of rows or of events.
+func (p *ComponentPauser) SetPaused(component string, paused bool) error {
+	if !pausableComponents[component] {
+		return fmt.Errorf("invalid component %s, must be %s, %s or %s", component, PauseCopy, PauseBinlog, PauseVerifier)
+	}
+
+	p.mutex.Lock()
+	p.paused[component] = paused
+	p.mutex.Unlock()
+
+	var value float64
+	if paused {
+		value = 1
+	}
+	metrics.Gauge("Paused", value, []MetricTag{{"component", component}}, 1.0)
+
+	p.logger.WithFields(logrus.Fields{
+		"component": component,
+		"paused":    paused,
+	}).Info("set component paused")
+
+	return nil
+}
+
+func (p *ComponentPauser) Paused(component string) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.paused[component]
+}
+
+// Returns the paused components, sorted.
+func (p *ComponentPauser) PausedComponents() []string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	components := []string{}
+	for component, paused := range p.paused {
+		if paused {
+			components = append(components, component)
+		}
+	}
+	sort.Strings(components)
+	return components
+}
+
+// Blocks while the component is paused.
+func (p *ComponentPauser) Wait(component string) {
+	if !p.Paused(component) {
+		return
+	}
+
+	metrics.Measure("WaitForPause", []MetricTag{{"component", component}}, 1.0, func() {
+		for p.Paused(component) {
+			time.Sleep(500 * time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,481 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// The table of the target recording the primary key assigned to each row of
+// the remapped tables.
+const PrimaryKeyMappingTable = GhostferryTablePrefix + "pk_map"
+
+// Replaces the primary keys of some tables with new ones on the target, for
+// instance to merge tenants into a target whose auto-increment primary keys
+// would collide with the copied ones.
+type PrimaryKeyRemappingConfig struct {
+	// The tables whose primary keys are remapped, by full source table name.
+	// The tables must have a single column unsigned integer primary key.
+	Tables []string
+
+	// The columns referencing the primary key of a remapped table, which are
+	// remapped as well: keyed by the full source name of the table of the
+	// column, then by column name, with the full source name of the
+	// referenced table as value.
+	ForeignKeys map[string]map[string]string
+
+	// The database of the target in which the mapping table is created.
+	MappingDatabase string
+
+	// The number of primary keys reserved at once on each remapped target
+	// table, by raising the AUTO_INCREMENT of the table past them, so the
+	// rows inserted on the target by the applications while the ferry runs
+	// are not assigned the same primary keys.
+	//
+	// Optional: defaults to 1000.
+	ReservedPrimaryKeys uint64
+}
+
+func (c *PrimaryKeyRemappingConfig) Validate() error {
+	if len(c.Tables) == 0 {
+		return errors.New("Tables must not be empty")
+	}
+
+	if c.MappingDatabase == "" {
+		return errors.New("MappingDatabase must be set")
+	}
+
+	if c.ReservedPrimaryKeys == 0 {
+		c.ReservedPrimaryKeys = 1000
+	}
+
+	remapped := make(map[string]bool)
+	for _, table := range c.Tables {
+		remapped[table] = true
+	}
+
+	for table, columns := range c.ForeignKeys {
+		for column, referenced := range columns {
+			if !remapped[referenced] {
+				return fmt.Errorf("column %s of %s references %s, which is not remapped", column, table, referenced)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Assigns the new primary keys of the remapped tables and rewrites the rows
+// and the binlog events written to the target with them. The new primary
+// keys are taken from ranges following the largest primary key of the target
+// table, which are reserved by raising the AUTO_INCREMENT of the target table
+// past them before they are assigned. The mapping is recorded on the target
+// before the rows are written, so a resumed run reuses it.
+type PrimaryKeyRemapper struct {
+	DB               *sql.DB
+	Config           *PrimaryKeyRemappingConfig
+	DatabaseRewrites map[string]string
+	TableRewrites    map[string]string
+
+	remapped map[string]bool
+	logger   *logrus.Entry
+
+	mutex    sync.Mutex
+	mappings map[string]map[uint64]uint64
+	reserved map[string]*reservedPrimaryKeys
+}
+
+// The primary keys from next to end, excluded, reserved on a target table.
+type reservedPrimaryKeys struct {
+	next uint64
+	end  uint64
+}
+
+func (r *PrimaryKeyRemapper) Initialize() error {
+	r.logger = logrus.WithField("tag", "pk_remapper")
+	r.mappings = make(map[string]map[uint64]uint64)
+	r.reserved = make(map[string]*reservedPrimaryKeys)
+
+	if r.Config.ReservedPrimaryKeys == 0 {
+		r.Config.ReservedPrimaryKeys = 1000
+	}
+
+	r.remapped = make(map[string]bool)
+	for _, table := range r.Config.Tables {
+		r.remapped[table] = true
+	}
+
+	statements := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteField(r.Config.MappingDatabase)),
+		fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (table_name VARCHAR(255) NOT NULL, old_pk BIGINT UNSIGNED NOT NULL, new_pk BIGINT UNSIGNED NOT NULL, PRIMARY KEY (table_name, old_pk))",
+			r.mappingTable(),
+		),
+	}
+	for _, statement := range statements {
+		_, err := r.DB.Exec(statement)
+		if err != nil {
+			return fmt.Errorf("creating mapping table: %v", err)
+		}
+	}
+
+	return r.loadMappings()
+}
+
+func (r *PrimaryKeyRemapper) mappingTable() string {
+	return QuotedTableNameFromString(r.Config.MappingDatabase, PrimaryKeyMappingTable)
+}
+
+func (r *PrimaryKeyRemapper) loadMappings() error {
+	rows, err := r.DB.Query(fmt.Sprintf("SELECT table_name, old_pk, new_pk FROM %s", r.mappingTable()))
+	if err != nil {
+		return fmt.Errorf("loading primary key mappings: %v", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var table string
+		var oldPk, newPk uint64
+		err = rows.Scan(&table, &oldPk, &newPk)
+		if err != nil {
+			return err
+		}
+
+		if _, exists := r.mappings[table]; !exists {
+			r.mappings[table] = make(map[uint64]uint64)
+		}
+		r.mappings[table][oldPk] = newPk
+		count++
+	}
+
+	r.logger.WithField("mappings", count).Info("loaded primary key mappings")
+	return rows.Err()
+}
+
+// Returns the batch with the remapped primary keys and foreign keys.
+func (r *PrimaryKeyRemapper) RemapRowBatch(batch *RowBatch) (*RowBatch, error) {
+	table := batch.TableSchema()
+	columns, err := r.remappedColumns(table)
+	if err != nil || len(columns) == 0 {
+		return batch, err
+	}
+
+	values, err := r.remapRows(columns, batch.Values())
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRowBatch(table, values, batch.PkIndex()), nil
+}
+
+// Returns the event with the remapped primary keys and foreign keys.
+func (r *PrimaryKeyRemapper) RemapDMLEvent(ev DMLEvent) (DMLEvent, error) {
+	columns, err := r.remappedColumns(ev.TableSchema())
+	if err != nil || len(columns) == 0 {
+		return ev, err
+	}
+
+	var oldValues, newValues RowData
+	if ev.OldValues() != nil {
+		rows, err := r.remapRows(columns, []RowData{ev.OldValues()})
+		if err != nil {
+			return nil, err
+		}
+		oldValues = rows[0]
+	}
+
+	if ev.NewValues() != nil {
+		rows, err := r.remapRows(columns, []RowData{ev.NewValues()})
+		if err != nil {
+			return nil, err
+		}
+		newValues = rows[0]
+	}
+
+	return dmlEventWithValues(ev, oldValues, newValues), nil
+}
+
+// The indexes of the remapped columns of the table, with the full name of
+// the table whose primary keys they hold.
+func (r *PrimaryKeyRemapper) remappedColumns(table *schema.Table) (map[int]string, error) {
+	columns := make(map[int]string)
+	tableName := table.String()
+
+	if r.remapped[tableName] {
+		if len(table.PKColumns) != 1 {
+			return nil, fmt.Errorf("cannot remap the primary key of %s, which does not have a single column primary key", tableName)
+		}
+		columns[table.PKColumns[0]] = tableName
+	}
+
+	for column, referenced := range r.Config.ForeignKeys[tableName] {
+		index := table.FindColumn(column)
+		if index < 0 {
+			return nil, fmt.Errorf("column %s of %s does not exist", column, tableName)
+		}
+		columns[index] = referenced
+	}
+
+	return columns, nil
+}
+
+func (r *PrimaryKeyRemapper) remapRows(columns map[int]string, rows []RowData) ([]RowData, error) {
+	pksByTable := make(map[string][]uint64)
+	for _, row := range rows {
+		for index, table := range columns {
+			if row[index] == nil {
+				continue
+			}
+
+			pk, err := primaryKeyValue(row[index])
+			if err != nil {
+				return nil, err
+			}
+			pksByTable[table] = append(pksByTable[table], pk)
+		}
+	}
+
+	mappings := make(map[string]map[uint64]uint64)
+	for table, pks := range pksByTable {
+		mapping, err := r.mapPrimaryKeys(table, pks)
+		if err != nil {
+			return nil, err
+		}
+		mappings[table] = mapping
+	}
+
+	remappedRows := make([]RowData, len(rows))
+	for i, row := range rows {
+		remapped := make(RowData, len(row))
+		copy(remapped, row)
+
+		for index, table := range columns {
+			if row[index] == nil {
+				continue
+			}
+
+			pk, _ := primaryKeyValue(row[index])
+			remapped[index] = mappings[table][pk]
+		}
+
+		remappedRows[i] = remapped
+	}
+
+	return remappedRows, nil
+}
+
+// Returns the new primary key of each of the old primary keys of the table,
+// assigning and recording new primary keys for those without one yet.
+func (r *PrimaryKeyRemapper) mapPrimaryKeys(table string, oldPks []uint64) (map[uint64]uint64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.mappings[table]; !exists {
+		r.mappings[table] = make(map[uint64]uint64)
+	}
+	mapping := r.mappings[table]
+
+	result := make(map[uint64]uint64, len(oldPks))
+	assigned := make(map[uint64]uint64)
+	for _, oldPk := range oldPks {
+		if newPk, exists := mapping[oldPk]; exists {
+			result[oldPk] = newPk
+			continue
+		}
+
+		if newPk, exists := assigned[oldPk]; exists {
+			result[oldPk] = newPk
+			continue
+		}
+
+		newPk, err := r.nextPrimaryKey(table)
+		if err != nil {
+			return nil, err
+		}
+		assigned[oldPk] = newPk
+		result[oldPk] = newPk
+	}
+
+	if len(assigned) == 0 {
+		return result, nil
+	}
+
+	err := r.recordMappings(table, assigned)
+	if err != nil {
+		// The primary keys are not reused, as they may have been recorded.
+		return nil, err
+	}
+
+	for oldPk, newPk := range assigned {
+		mapping[oldPk] = newPk
+	}
+
+	return result, nil
+}
+
+func (r *PrimaryKeyRemapper) recordMappings(table string, assigned map[uint64]uint64) error {
+	values := make([]string, 0, len(assigned))
+	args := make([]interface{}, 0, 3*len(assigned))
+	for oldPk, newPk := range assigned {
+		values = append(values, "(?,?,?)")
+		args = append(args, table, oldPk, newPk)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (table_name, old_pk, new_pk) VALUES %s", r.mappingTable(), strings.Join(values, ","))
+	_, err := r.DB.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("recording primary key mappings of %s: %v", table, err)
+	}
+
+	return nil
+}
+
+// Must be called with the mutex held.
+func (r *PrimaryKeyRemapper) nextPrimaryKey(table string) (uint64, error) {
+	reserved := r.reserved[table]
+	if reserved == nil || reserved.next == reserved.end {
+		var err error
+		reserved, err = r.reservePrimaryKeys(table, reserved)
+		if err != nil {
+			return 0, err
+		}
+		r.reserved[table] = reserved
+	}
+
+	pk := reserved.next
+	reserved.next++
+	return pk, nil
+}
+
+// Reserves the next primary keys of the table, following the largest primary
+// key of the target table, the largest recorded one and the previous
+// reservation. The AUTO_INCREMENT of the target table is raised past them
+// first, and the rows inserted in the range before it was raised are then
+// looked for, in which case the primary keys following them are reserved
+// instead.
+func (r *PrimaryKeyRemapper) reservePrimaryKeys(table string, previous *reservedPrimaryKeys) (*reservedPrimaryKeys, error) {
+	db, name, pkColumn, err := r.targetTable(table)
+	if err != nil {
+		return nil, err
+	}
+
+	quotedTable := QuotedTableNameFromString(db, name)
+	quotedColumn := quoteField(pkColumn)
+
+	var largest uint64
+	err = r.DB.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s", quotedColumn, quotedTable)).Scan(&largest)
+	if err != nil {
+		return nil, fmt.Errorf("finding largest primary key of target table %s.%s: %v", db, name, err)
+	}
+
+	for _, newPk := range r.mappings[table] {
+		if newPk > largest {
+			largest = newPk
+		}
+	}
+
+	if previous != nil && previous.end-1 > largest {
+		largest = previous.end - 1
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		reserved := &reservedPrimaryKeys{next: largest + 1, end: largest + 1 + r.Config.ReservedPrimaryKeys}
+
+		_, err = r.DB.Exec(fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", quotedTable, reserved.end))
+		if err != nil {
+			return nil, fmt.Errorf("reserving primary keys of target table %s.%s: %v", db, name, err)
+		}
+
+		// The locking read waits for the inserts not committed yet.
+		var inserted uint64
+		err = r.DB.QueryRow(
+			fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s WHERE %s >= ? AND %s < ? LOCK IN SHARE MODE", quotedColumn, quotedTable, quotedColumn, quotedColumn),
+			reserved.next, reserved.end,
+		).Scan(&inserted)
+		if err != nil {
+			return nil, fmt.Errorf("checking reserved primary keys of target table %s.%s: %v", db, name, err)
+		}
+
+		if inserted == 0 {
+			r.logger.WithFields(logrus.Fields{
+				"table": table,
+				"from":  reserved.next,
+				"to":    reserved.end - 1,
+			}).Debug("reserved primary keys")
+			return reserved, nil
+		}
+
+		largest = inserted
+	}
+
+	return nil, fmt.Errorf("cannot reserve primary keys of target table %s.%s, whose rows are inserted in the reserved ranges", db, name)
+}
+
+// Returns the target database, table and primary key column of the table.
+func (r *PrimaryKeyRemapper) targetTable(table string) (string, string, string, error) {
+	parts := strings.SplitN(table, ".", 2)
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("invalid remapped table name %s", table)
+	}
+
+	db, name := parts[0], parts[1]
+	if targetDbName, exists := r.DatabaseRewrites[db]; exists {
+		db = targetDbName
+	}
+	if targetTableName, exists := r.TableRewrites[name]; exists {
+		name = targetTableName
+	}
+
+	var pkColumn string
+	err := r.DB.QueryRow(
+		"SELECT column_name FROM information_schema.key_column_usage WHERE table_schema = ? AND table_name = ? AND constraint_name = 'PRIMARY' LIMIT 1",
+		db, name,
+	).Scan(&pkColumn)
+	if err != nil {
+		return "", "", "", fmt.Errorf("finding primary key of target table %s.%s: %v", db, name, err)
+	}
+
+	return db, name, pkColumn, nil
+}
+
+func primaryKeyValue(value interface{}) (uint64, error) {
+	if v, ok := Uint64Value(value); ok {
+		return v, nil
+	}
+
+	if v, ok := Int64Value(value); ok && v >= 0 {
+		return uint64(v), nil
+	}
+
+	if v, ok := value.([]byte); ok {
+		return strconv.ParseUint(string(v), 10, 64)
+	}
+
+	return 0, fmt.Errorf("cannot remap primary key value %v of type %T", value, value)
+}
+
+func dmlEventWithValues(ev DMLEvent, oldValues, newValues RowData) DMLEvent {
+	base := &DMLEventBase{
+		table:     *ev.TableSchema(),
+		pos:       ev.BinlogPosition(),
+		timestamp: ev.Timestamp(),
+	}
+
+	switch ev.(type) {
+	case *BinlogInsertEvent:
+		return &BinlogInsertEvent{newValues: newValues, DMLEventBase: base}
+	case *BinlogUpdateEvent:
+		return &BinlogUpdateEvent{oldValues: oldValues, newValues: newValues, DMLEventBase: base}
+	case *BinlogDeleteEvent:
+		return &BinlogDeleteEvent{oldValues: oldValues, DMLEventBase: base}
+	default:
+		return ev
+	}
+}
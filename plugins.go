@@ -0,0 +1,220 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The interfaces below describe the components of the ferry that can be
+// replaced or wrapped without forking ghostferry. Together with Verifier and
+// Throttler, the writers and the StateStore are the kinds of plugins that
+// can be registered with RegisterPlugin and selected with Config.Plugins,
+// see pluginKindTypes for why the sources are not.
+
+// A source of batches of rows to copy, such as the DataIterator.
+type RowBatchSource interface {
+	AddBatchListener(func(*RowBatch) error)
+	AddDoneListener(func() error)
+}
+
+// A source of the changes made to the source database, such as the
+// BinlogStreamer.
+type DMLEventSource interface {
+	AddEventListener(func([]DMLEvent) error)
+}
+
+// Writes the batches of rows copied by the DataIterator to the target, such
+// as the BatchWriter.
+type RowBatchWriter interface {
+	WriteRowBatch(*RowBatch) error
+}
+
+// Writes the changes streamed by the BinlogStreamer to the target, such as
+// the BinlogWriter. The ferry relies on the BinlogWriter to track the last
+// written binlog position, so a replacement usually wraps it.
+type DMLEventWriter interface {
+	BufferBinlogEvents([]DMLEvent) error
+}
+
+// Persists the state of the run, so the run can be resumed from it. The
+// Checkpointer writes to a FileStateStore by default.
+type StateStore interface {
+	SaveState(*SerializableState) error
+}
+
+var (
+	_ RowBatchSource = &DataIterator{}
+	_ DMLEventSource = &BinlogStreamer{}
+	_ RowBatchWriter = &BatchWriter{}
+	_ DMLEventWriter = &BinlogWriter{}
+	_ StateStore     = &FileStateStore{}
+	_ Verifier       = &IterativeVerifier{}
+	_ Verifier       = &ChecksumTableVerifier{}
+)
+
+// The kinds of plugins, as used in Config.Plugins.
+const (
+	PluginKindVerifier       = "verifier"
+	PluginKindThrottler      = "throttler"
+	PluginKindStateStore     = "state_store"
+	PluginKindRowBatchWriter = "row_batch_writer"
+	PluginKindDMLEventWriter = "dml_event_writer"
+
+	// Chained rather than replacing a component, see
+	// Config.DMLEventMiddlewares.
+	PluginKindDMLEventMiddleware = "dml_event_middleware"
+)
+
+// The interface that the plugins of each kind must implement.
+//
+// RowBatchSource and DMLEventSource have no kind: the ferry drives the
+// DataIterator and the BinlogStreamer through far more than these
+// interfaces, to resume them from the state dump, to connect the binlog at a
+// position and to track the last streamed position for the cutover, so they
+// cannot be replaced. The interfaces are meant for the listeners and the
+// components built around them, such as Config.DMLEventMiddlewares.
+var pluginKindTypes = map[string]string{
+	PluginKindVerifier:       "ghostferry.Verifier",
+	PluginKindThrottler:      "ghostferry.Throttler",
+	PluginKindStateStore:     "ghostferry.StateStore",
+	PluginKindRowBatchWriter: "ghostferry.RowBatchWriter",
+	PluginKindDMLEventWriter: "ghostferry.DMLEventWriter",
+
+	PluginKindDMLEventMiddleware: "ghostferry.DMLEventMiddleware",
+}
+
+// Selects a registered plugin and its options.
+type PluginConfig struct {
+	Name string
+
+	// Passed as is to the factory of the plugin, which decodes it.
+	Options json.RawMessage
+}
+
+// Creates a plugin for a ferry. The ferry is initialized up to the creation
+// of the plugin, so the factory of a writer can wrap the default writer of
+// the ferry, and the factory of a verifier can use its tables and
+// connections. The returned value must implement the interface of the kind
+// of the plugin.
+type PluginFactory func(f *Ferry, options json.RawMessage) (interface{}, error)
+
+var (
+	pluginsMutex sync.RWMutex
+	plugins      = make(map[string]map[string]PluginFactory)
+)
+
+// Registers a plugin under a name, usually from the init function of the
+// package implementing it. Like database/sql.Register, this panics if the
+// kind is unknown or if the name is already registered for the kind.
+func RegisterPlugin(kind, name string, factory PluginFactory) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+
+	if _, exists := pluginKindTypes[kind]; !exists {
+		panic(fmt.Sprintf("ghostferry: unknown plugin kind %s", kind))
+	}
+
+	if factory == nil {
+		panic(fmt.Sprintf("ghostferry: nil factory for %s plugin %s", kind, name))
+	}
+
+	if plugins[kind] == nil {
+		plugins[kind] = make(map[string]PluginFactory)
+	}
+
+	if _, exists := plugins[kind][name]; exists {
+		panic(fmt.Sprintf("ghostferry: %s plugin %s is already registered", kind, name))
+	}
+
+	plugins[kind][name] = factory
+}
+
+// Returns the sorted names of the plugins registered for a kind.
+func RegisteredPlugins(kind string) []string {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+
+	names := make([]string, 0, len(plugins[kind]))
+	for name := range plugins[kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func validatePluginConfig(kind string, config *PluginConfig) error {
+	if _, exists := pluginKindTypes[kind]; !exists {
+		return fmt.Errorf("unknown plugin kind %s", kind)
+	}
+
+	if config == nil || config.Name == "" {
+		return fmt.Errorf("the name of the %s plugin must be set", kind)
+	}
+
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+
+	if _, exists := plugins[kind][config.Name]; !exists {
+		return fmt.Errorf("%s plugin %s is not registered", kind, config.Name)
+	}
+
+	return nil
+}
+
+// Creates the plugin of the given kind selected in Config.Plugins. Returns
+// nil if no plugin of this kind is selected.
+func (f *Ferry) NewPlugin(kind string) (interface{}, error) {
+	config, exists := f.Config.Plugins[kind]
+	if !exists {
+		return nil, nil
+	}
+
+	return f.newPlugin(kind, config)
+}
+
+func (f *Ferry) newPlugin(kind string, config *PluginConfig) (interface{}, error) {
+	err := validatePluginConfig(kind, config)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginsMutex.RLock()
+	factory := plugins[kind][config.Name]
+	pluginsMutex.RUnlock()
+
+	plugin, err := factory(f, config.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s plugin %s: %v", kind, config.Name, err)
+	}
+
+	var ok bool
+	switch kind {
+	case PluginKindVerifier:
+		_, ok = plugin.(Verifier)
+	case PluginKindThrottler:
+		_, ok = plugin.(Throttler)
+	case PluginKindStateStore:
+		_, ok = plugin.(StateStore)
+	case PluginKindRowBatchWriter:
+		_, ok = plugin.(RowBatchWriter)
+	case PluginKindDMLEventWriter:
+		_, ok = plugin.(DMLEventWriter)
+	case PluginKindDMLEventMiddleware:
+		_, ok = plugin.(DMLEventMiddleware)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%s plugin %s returned a %T, which does not implement %s", kind, config.Name, plugin, pluginKindTypes[kind])
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"tag":    "plugins",
+		"plugin": config.Name,
+	}).Infof("using %s plugin", kind)
+	return plugin, nil
+}
@@ -0,0 +1,465 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlmysql "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// PostgreSQLDialect writes to a PostgreSQL target. The MySQL databases map
+// to PostgreSQL schemas of the database the target connects to.
+//
+// The values are converted to the types created by CreateTableStatement:
+// the ENUM and SET values, which the binlog yields as integers, are
+// converted to their labels, and the zero dates, which PostgreSQL cannot
+// represent, are written as NULL. INSERT IGNORE is translated to INSERT ...
+// ON CONFLICT DO NOTHING, which only ignores the duplicate keys and not the
+// values that do not fit their column.
+type PostgreSQLDialect struct{}
+
+func (PostgreSQLDialect) Name() string {
+	return DialectPostgreSQL
+}
+
+func (d PostgreSQLDialect) RowBatchQuery(batch *RowBatch, target *schema.Table) (string, []interface{}, error) {
+	table := batch.TableSchema()
+	if len(batch.Values()) == 0 {
+		return "", nil, fmt.Errorf("no rows to insert into %s", table.String())
+	}
+
+	columns, err := d.loadColumnsForTable(table, batch.Values()...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	args := make([]interface{}, 0, len(columns)*batch.Size())
+	rows := make([]string, batch.Size())
+
+	for i, row := range batch.Values() {
+		placeholders := make([]string, len(row))
+		for j, value := range row {
+			args = append(args, postgreSQLValue(&table.Columns[j], value))
+			placeholders[j] = "$" + strconv.Itoa(len(args))
+		}
+		rows[i] = "(" + strings.Join(placeholders, ",") + ")"
+	}
+
+	query := "INSERT INTO " + d.QuoteTableName(target.Schema, target.Name) +
+		" (" + strings.Join(columns, ",") + ") VALUES " + strings.Join(rows, ",") +
+		" ON CONFLICT DO NOTHING"
+
+	return query, args, nil
+}
+
+func (d PostgreSQLDialect) DMLEventStatement(ev DMLEvent, target *schema.Table) (string, error) {
+	table := ev.TableSchema()
+	oldValues := ev.OldValues()
+	newValues := ev.NewValues()
+
+	var values []RowData
+	for _, row := range []RowData{oldValues, newValues} {
+		if row != nil {
+			values = append(values, row)
+		}
+	}
+
+	columns, err := d.loadColumnsForTable(table, values...)
+	if err != nil {
+		return "", err
+	}
+
+	quotedTable := d.QuoteTableName(target.Schema, target.Name)
+
+	switch {
+	case oldValues == nil:
+		return "INSERT INTO " + quotedTable +
+			" (" + strings.Join(columns, ",") + ")" +
+			" VALUES (" + d.valueList(table, newValues) + ")" +
+			" ON CONFLICT DO NOTHING", nil
+	case newValues == nil:
+		return "DELETE FROM " + quotedTable +
+			" WHERE " + d.whereClause(table, columns, oldValues), nil
+	default:
+		return "UPDATE " + quotedTable +
+			" SET " + d.setClause(table, columns, newValues) +
+			" WHERE " + d.whereClause(table, columns, oldValues), nil
+	}
+}
+
+// Quotes an identifier, doubling the double quotes in it.
+func (PostgreSQLDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (d PostgreSQLDialect) QuoteTableName(schemaName, table string) string {
+	return d.QuoteIdentifier(schemaName) + "." + d.QuoteIdentifier(table)
+}
+
+func (d PostgreSQLDialect) CreateSchemaStatement(schemaName string) string {
+	return "CREATE SCHEMA IF NOT EXISTS " + d.QuoteIdentifier(schemaName)
+}
+
+// The statement creating the target table of a source table, with the
+// PostgreSQL type of every column and the same primary key. The secondary
+// indexes are not created, as they are better created after the copy.
+func (d PostgreSQLDialect) CreateTableStatement(source *schema.Table, target *schema.Table) string {
+	definitions := make([]string, 0, len(source.Columns)+1)
+	for _, column := range source.Columns {
+		definitions = append(definitions, d.QuoteIdentifier(column.Name)+" "+PostgreSQLType(&column))
+	}
+
+	if len(source.PKColumns) > 0 {
+		pkColumns := make([]string, len(source.PKColumns))
+		for i := range source.PKColumns {
+			pkColumns[i] = d.QuoteIdentifier(source.GetPKColumn(i).Name)
+		}
+		definitions = append(definitions, "PRIMARY KEY ("+strings.Join(pkColumns, ",")+")")
+	}
+
+	return "CREATE TABLE IF NOT EXISTS " + d.QuoteTableName(target.Schema, target.Name) +
+		" (" + strings.Join(definitions, ", ") + ")"
+}
+
+func (d PostgreSQLDialect) loadColumnsForTable(table *schema.Table, valuesToVerify ...RowData) ([]string, error) {
+	for _, values := range valuesToVerify {
+		if err := verifyValuesHasTheSameLengthAsColumns(table, values); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		columns[i] = d.QuoteIdentifier(column.Name)
+	}
+	return columns, nil
+}
+
+func (d PostgreSQLDialect) valueList(table *schema.Table, values RowData) string {
+	var buffer []byte
+	for i, value := range values {
+		if i > 0 {
+			buffer = append(buffer, ',')
+		}
+		buffer = appendPostgreSQLLiteral(buffer, postgreSQLValue(&table.Columns[i], value))
+	}
+	return string(buffer)
+}
+
+func (d PostgreSQLDialect) setClause(table *schema.Table, columns []string, values RowData) string {
+	var buffer []byte
+	for i, value := range values {
+		if i > 0 {
+			buffer = append(buffer, ',')
+		}
+		buffer = append(buffer, columns[i]...)
+		buffer = append(buffer, '=')
+		buffer = appendPostgreSQLLiteral(buffer, postgreSQLValue(&table.Columns[i], value))
+	}
+	return string(buffer)
+}
+
+func (d PostgreSQLDialect) whereClause(table *schema.Table, columns []string, values RowData) string {
+	var buffer []byte
+	for i, value := range values {
+		if i > 0 {
+			buffer = append(buffer, " AND "...)
+		}
+		buffer = append(buffer, columns[i]...)
+
+		value = postgreSQLValue(&table.Columns[i], value)
+		if value == nil {
+			buffer = append(buffer, " IS NULL"...)
+		} else {
+			buffer = append(buffer, '=')
+			buffer = appendPostgreSQLLiteral(buffer, value)
+		}
+	}
+	return string(buffer)
+}
+
+// The PostgreSQL type of the target column of a MySQL column. The unsigned
+// integers are widened to the next signed type, the ENUM and SET columns
+// are text, and the binary strings are bytea.
+func PostgreSQLType(column *schema.TableColumn) string {
+	rawType := strings.ToLower(column.RawType)
+
+	switch column.Type {
+	case schema.TYPE_NUMBER:
+		switch {
+		case strings.HasPrefix(rawType, "year"), strings.HasPrefix(rawType, "tinyint"):
+			return "smallint"
+		case strings.HasPrefix(rawType, "smallint"):
+			if column.IsUnsigned {
+				return "integer"
+			}
+			return "smallint"
+		case strings.HasPrefix(rawType, "mediumint"):
+			return "integer"
+		case strings.HasPrefix(rawType, "bigint"):
+			if column.IsUnsigned {
+				return "numeric(20,0)"
+			}
+			return "bigint"
+		default:
+			if column.IsUnsigned {
+				return "bigint"
+			}
+			return "integer"
+		}
+	case schema.TYPE_FLOAT:
+		switch {
+		case strings.HasPrefix(rawType, "decimal"):
+			return "numeric" + typeArguments(rawType)
+		case strings.HasPrefix(rawType, "float"):
+			return "real"
+		default:
+			return "double precision"
+		}
+	case schema.TYPE_ENUM, schema.TYPE_SET:
+		return "text"
+	case schema.TYPE_DATETIME, schema.TYPE_TIMESTAMP:
+		return "timestamp" + typeArguments(rawType)
+	case schema.TYPE_DATE:
+		return "date"
+	case schema.TYPE_TIME:
+		return "interval"
+	case schema.TYPE_BIT:
+		return "bigint"
+	case schema.TYPE_JSON:
+		return "jsonb"
+	}
+
+	switch {
+	case isBinaryColumn(column):
+		return "bytea"
+	case strings.HasPrefix(rawType, "char"), strings.HasPrefix(rawType, "varchar"):
+		return rawType
+	default:
+		return "text"
+	}
+}
+
+// Returns the arguments of a type such as "(10,2)" in "decimal(10,2)
+// unsigned", or an empty string.
+func typeArguments(rawType string) string {
+	start := strings.Index(rawType, "(")
+	end := strings.Index(rawType, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+	return rawType[start : end+1]
+}
+
+func isBinaryColumn(column *schema.TableColumn) bool {
+	rawType := strings.ToLower(column.RawType)
+	for _, prefix := range []string{"binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection"} {
+		if strings.HasPrefix(rawType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts a value read from MySQL, either by the DataIterator or from the
+// binlog, to a value of the PostgreSQL type of its column: nil, int64,
+// float64, string, or []byte for the bytea columns.
+func postgreSQLValue(column *schema.TableColumn, value interface{}) interface{} {
+	if isNilValue(value) {
+		return nil
+	}
+
+	switch column.Type {
+	case schema.TYPE_ENUM:
+		if index, ok := Int64Value(value); ok {
+			if index < 1 || int(index) > len(column.EnumValues) {
+				return ""
+			}
+			return column.EnumValues[index-1]
+		}
+	case schema.TYPE_SET:
+		if bitmask, ok := setBitmask(value); ok {
+			var labels []string
+			for i, label := range column.SetValues {
+				if bitmask&(1<<uint(i)) != 0 {
+					labels = append(labels, label)
+				}
+			}
+			return strings.Join(labels, ",")
+		}
+	case schema.TYPE_BIT:
+		if bits, ok := value.([]byte); ok {
+			var v uint64
+			for _, b := range bits {
+				v = v<<8 | uint64(b)
+			}
+			value = v
+		}
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		if isBinaryColumn(column) {
+			return v
+		}
+		value = string(v)
+	case sql.RawBytes:
+		if isBinaryColumn(column) {
+			return []byte(v)
+		}
+		value = string(v)
+	case time.Time:
+		value = postgreSQLTime(v)
+	case *time.Time:
+		value = postgreSQLTime(*v)
+	case sqlmysql.NullTime:
+		value = postgreSQLTime(v.Time)
+	case sql.NullTime:
+		value = postgreSQLTime(v.Time)
+	case decimal.Decimal:
+		return v.String()
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case float32:
+		return float64(v)
+	}
+
+	if s, ok := value.(string); ok {
+		switch column.Type {
+		case schema.TYPE_DATE, schema.TYPE_DATETIME, schema.TYPE_TIMESTAMP:
+			if strings.HasPrefix(s, "0000-00-00") {
+				return nil
+			}
+		}
+		return s
+	}
+
+	if u, ok := Uint64Value(value); ok {
+		if u > math.MaxInt64 {
+			return strconv.FormatUint(u, 10)
+		}
+		return int64(u)
+	}
+
+	if i, ok := Int64Value(value); ok {
+		return i
+	}
+
+	return value
+}
+
+func postgreSQLTime(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05.999999")
+}
+
+// Appends a value converted by postgreSQLValue as a literal. The strings are
+// quoted and left for PostgreSQL to cast to the type of the column, which
+// requires standard_conforming_strings, the default since PostgreSQL 9.1.
+func appendPostgreSQLLiteral(buffer []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(buffer, "NULL"...)
+	case int64:
+		return strconv.AppendInt(buffer, v, 10)
+	case float64:
+		return strconv.AppendFloat(buffer, v, 'g', -1, 64)
+	case []byte:
+		buffer = append(buffer, `'\x`...)
+		buffer = append(buffer, hex.EncodeToString(v)...)
+		return append(buffer, "'::bytea"...)
+	case string:
+		return appendEscapedString(buffer, v)
+	default:
+		panic(fmt.Sprintf("unsupported type %T", value))
+	}
+}
+
+// The connection string of a PostgreSQL target, in the key/value format. The
+// Params are added to the connection string, and must include the dbname.
+func (c DatabaseConfig) PostgreSQLConnectionString() string {
+	params := map[string]string{
+		"host":     c.Host,
+		"port":     strconv.Itoa(int(c.Port)),
+		"user":     c.User,
+		"password": c.Pass,
+	}
+
+	for key, value := range c.Params {
+		params[key] = value
+	}
+
+	// The certificate is verified against the host, so the ServerName
+	// replaces it, and PostgreSQLDB dials the Host instead.
+	if c.TLS != nil {
+		params["sslmode"] = "verify-full"
+		params["sslrootcert"] = c.TLS.CertPath
+		if c.TLS.ServerName != "" {
+			params["host"] = c.TLS.ServerName
+		}
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Replace(params[key], `\`, `\\`, -1)
+		value = strings.Replace(value, `'`, `\'`, -1)
+		pairs = append(pairs, key+"='"+value+"'")
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// Connects to a PostgreSQL target with the github.com/lib/pq driver.
+func (c DatabaseConfig) PostgreSQLDB(logger *logrus.Entry) (*sql.DB, error) {
+	connector, err := pq.NewConnector(c.PostgreSQLConnectionString())
+	if err != nil {
+		return nil, err
+	}
+
+	if c.TLS != nil && c.TLS.ServerName != "" {
+		connector.Dialer(postgresqlHostDialer{address: net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port)))})
+	}
+
+	if logger != nil {
+		logger.WithFields(logrus.Fields{
+			"host": c.Host,
+			"port": c.Port,
+			"user": c.User,
+		}).Info("connecting to postgresql database")
+	}
+
+	return sql.OpenDB(connector), nil
+}
+
+// Dials the Host of the target whatever the host of the connection string,
+// which is the TLS ServerName the certificate is verified against.
+type postgresqlHostDialer struct {
+	address string
+}
+
+func (d postgresqlHostDialer) Dial(network, _ string) (net.Conn, error) {
+	return net.Dial(network, d.address)
+}
+
+func (d postgresqlHostDialer) DialTimeout(network, _ string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(network, d.address, timeout)
+}
@@ -0,0 +1,544 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// Privileges required on the source and target databases. The replication
+// privileges can only be granted globally, the others may also be granted
+// on the databases being ferried.
+var (
+	requiredSourceGlobalPrivileges = []string{"REPLICATION SLAVE", "REPLICATION CLIENT"}
+	requiredSourceDbPrivileges     = []string{"SELECT"}
+	requiredTargetDbPrivileges     = []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+)
+
+// Session variables that must be identical on the source and the target,
+// otherwise the same statement may be interpreted differently on both ends.
+var paritySessionVariables = []string{
+	"sql_mode",
+	"time_zone",
+	"character_set_server",
+	"collation_server",
+}
+
+type PreflightProblem struct {
+	Check   string
+	Message string
+}
+
+func (p PreflightProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Check, p.Message)
+}
+
+type PreflightReport struct {
+	Problems []PreflightProblem
+
+	// The differences that do not prevent the run but should be reviewed,
+	// such as columns whose collation differs. They do not make Err fail.
+	Warnings []PreflightProblem
+}
+
+func (r *PreflightReport) add(check, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, PreflightProblem{
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *PreflightReport) warn(check, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, PreflightProblem{
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Returns an error describing all the problems found, or nil if there are
+// none.
+func (r *PreflightReport) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(r.Problems))
+	for i, problem := range r.Problems {
+		messages[i] = problem.String()
+	}
+
+	return fmt.Errorf("%d preflight check(s) failed: %s", len(r.Problems), strings.Join(messages, "; "))
+}
+
+// Preflight checks that the source and target databases are compatible with
+// a Ghostferry run before any data is copied. All the checks are run even if
+// some of them fail, so all the problems can be fixed at once.
+type Preflight struct {
+	SourceDB *sql.DB
+	TargetDB *sql.DB
+
+	Tables           TableSchemaCache
+	DatabaseRewrites map[string]string
+	TableRewrites    map[string]string
+
+	// Set if the IterativeVerifier normalizes the collations, see
+	// Config.VerifierNormalizeCollations.
+	NormalizeCollations bool
+
+	// The target tables may not exist yet if they are created by the caller
+	// after the ferry is started, in which case the schemas cannot be
+	// compared.
+	SkipSchemaComparison bool
+
+	// The tables not ferried because of their storage engine, with their
+	// storage engines, see Config.IgnoredStorageEngines.
+	SkippedEngineTables map[string]string
+
+	// Requires the target tables to be empty, for a new run whose target
+	// must only contain the rows of the ferry, see Config.TargetRowGuard.
+	// Only checked when the schemas are compared, as the target tables may
+	// not exist otherwise.
+	RequireEmptyTarget bool
+
+	logger *logrus.Entry
+}
+
+func (p *Preflight) Run() *PreflightReport {
+	p.logger = logrus.WithField("tag", "preflight")
+	report := &PreflightReport{}
+
+	p.checkBinlogSettings(report)
+	p.checkPrivileges(report)
+	p.checkSessionVariableParity(report)
+	p.checkStorageEngines(report)
+
+	if !p.SkipSchemaComparison {
+		p.checkSchemas(report)
+
+		if p.RequireEmptyTarget {
+			p.checkTargetTablesEmpty(report)
+		}
+	}
+
+	for _, problem := range report.Problems {
+		p.logger.WithField("check", problem.Check).Error(problem.Message)
+	}
+
+	for _, warning := range report.Warnings {
+		p.logger.WithField("check", warning.Check).Warn(warning.Message)
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"problems": len(report.Problems),
+		"warnings": len(report.Warnings),
+	}).Info("preflight checks completed")
+	return report
+}
+
+func (p *Preflight) checkBinlogSettings(report *PreflightReport) {
+	err := checkConnectionForBinlogFormat(p.SourceDB)
+	if err != nil {
+		report.add("binlog", "%v", err)
+	}
+}
+
+func (p *Preflight) checkPrivileges(report *PreflightReport) {
+	sourceDbs := make(map[string]bool)
+	targetDbs := make(map[string]bool)
+	for _, table := range p.Tables {
+		sourceDbs[table.Schema] = true
+		targetDbs[p.targetDatabaseName(table.Schema)] = true
+	}
+
+	sourceGrants, err := showGrants(p.SourceDB)
+	if err != nil {
+		report.add("privileges", "failed to show grants on source: %v", err)
+	} else {
+		for _, privilege := range requiredSourceGlobalPrivileges {
+			if !sourceGrants.Has(privilege, "") {
+				sourceGrants.reportMissing(report, "missing global %s privilege on source", privilege)
+			}
+		}
+
+		sourceGrants.requireOnDatabases(report, "source", requiredSourceDbPrivileges, sourceDbs)
+	}
+
+	targetGrants, err := showGrants(p.TargetDB)
+	if err != nil {
+		report.add("privileges", "failed to show grants on target: %v", err)
+	} else {
+		targetGrants.requireOnDatabases(report, "target", requiredTargetDbPrivileges, targetDbs)
+	}
+}
+
+func (p *Preflight) checkSessionVariableParity(report *PreflightReport) {
+	for _, variable := range paritySessionVariables {
+		query := fmt.Sprintf("SELECT @@SESSION.%s", variable)
+
+		var sourceValue, targetValue string
+		err := p.SourceDB.QueryRow(query).Scan(&sourceValue)
+		if err != nil {
+			report.add("parity", "failed to read %s on source: %v", variable, err)
+			continue
+		}
+
+		err = p.TargetDB.QueryRow(query).Scan(&targetValue)
+		if err != nil {
+			report.add("parity", "failed to read %s on target: %v", variable, err)
+			continue
+		}
+
+		if sourceValue != targetValue {
+			report.add("parity", "%s differs between source (%s) and target (%s)", variable, sourceValue, targetValue)
+		}
+	}
+}
+
+func (p *Preflight) checkSchemas(report *PreflightReport) {
+	for _, sourceTable := range p.Tables {
+		targetDb := p.targetDatabaseName(sourceTable.Schema)
+		targetTableName := sourceTable.Name
+		if rewrittenName, exists := p.TableRewrites[targetTableName]; exists {
+			targetTableName = rewrittenName
+		}
+
+		targetTable, err := schema.NewTableFromSqlDB(p.TargetDB, targetDb, targetTableName)
+		if err != nil {
+			report.add("schema", "failed to load target table %s: %v", QuotedTableNameFromString(targetDb, targetTableName), err)
+			continue
+		}
+
+		for _, message := range compareTableColumns(sourceTable, targetTable) {
+			report.add("schema", "%s -> %s: %s", sourceTable.String(), targetTable.String(), message)
+		}
+
+		for _, message := range compareTableCollations(sourceTable, targetTable) {
+			if p.NormalizeCollations {
+				report.warn("collation", "%s -> %s: %s, the verifier compares the values as the collations do", sourceTable.String(), targetTable.String(), message)
+			} else {
+				report.warn("collation", "%s -> %s: %s, the verifier may report the values the target considers equal as mismatches unless VerifierNormalizeCollations is set", sourceTable.String(), targetTable.String(), message)
+			}
+		}
+	}
+}
+
+// Warns about the tables skipped because of their storage engine, and about
+// the ferried tables that do not use InnoDB, such as MyISAM, which is not
+// transactional.
+func (p *Preflight) checkStorageEngines(report *PreflightReport) {
+	skipped := make([]string, 0, len(p.SkippedEngineTables))
+	for table := range p.SkippedEngineTables {
+		skipped = append(skipped, table)
+	}
+	sort.Strings(skipped)
+
+	for _, table := range skipped {
+		report.warn("storage_engine", "%s uses the %s storage engine and is not ferried", table, p.SkippedEngineTables[table])
+	}
+
+	engines := make(map[string]map[string]string)
+	for _, table := range p.Tables {
+		if _, loaded := engines[table.Schema]; !loaded {
+			tableEngines, err := TableStorageEngines(p.SourceDB, table.Schema)
+			if err != nil {
+				report.add("storage_engine", "failed to load the storage engines of database %s: %v", table.Schema, err)
+			}
+			engines[table.Schema] = tableEngines
+		}
+
+		engine := engines[table.Schema][table.Name]
+		if engine != "" && engine != "INNODB" {
+			report.warn("storage_engine", "%s uses the %s storage engine rather than InnoDB, whose rows are not read from a consistent snapshot", table.String(), engine)
+		}
+	}
+}
+
+// Reports the target tables that already have rows, which were not written
+// by the ferry and would be reported as mismatches by the verifier.
+func (p *Preflight) checkTargetTablesEmpty(report *PreflightReport) {
+	for _, sourceTable := range p.Tables {
+		targetTableName := sourceTable.Name
+		if rewrittenName, exists := p.TableRewrites[targetTableName]; exists {
+			targetTableName = rewrittenName
+		}
+		targetTable := QuotedTableNameFromString(p.targetDatabaseName(sourceTable.Schema), targetTableName)
+
+		var one int
+		err := p.TargetDB.QueryRow(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", targetTable)).Scan(&one)
+		if err == sql.ErrNoRows {
+			continue
+		}
+
+		if err != nil {
+			report.add("target_rows", "failed to check that target table %s is empty: %v", targetTable, err)
+		} else {
+			report.add("target_rows", "target table %s is not empty, its rows were not written by the ferry", targetTable)
+		}
+	}
+}
+
+func (p *Preflight) targetDatabaseName(database string) string {
+	if rewrittenName, exists := p.DatabaseRewrites[database]; exists {
+		return rewrittenName
+	}
+	return database
+}
+
+// Compares the columns of the source and target tables in order, as the
+// column values in the binlog events are positional.
+func compareTableColumns(source, target *schema.Table) []string {
+	var messages []string
+
+	if len(source.Columns) != len(target.Columns) {
+		messages = append(messages, fmt.Sprintf("source has %d columns but target has %d columns", len(source.Columns), len(target.Columns)))
+	}
+
+	for i, sourceColumn := range source.Columns {
+		if i >= len(target.Columns) {
+			break
+		}
+
+		targetColumn := target.Columns[i]
+		if sourceColumn.Name != targetColumn.Name {
+			messages = append(messages, fmt.Sprintf("column %d is named %s on source but %s on target", i, sourceColumn.Name, targetColumn.Name))
+			continue
+		}
+
+		if normalizeColumnType(sourceColumn.RawType) != normalizeColumnType(targetColumn.RawType) {
+			messages = append(messages, fmt.Sprintf("column %s is %s on source but %s on target", sourceColumn.Name, sourceColumn.RawType, targetColumn.RawType))
+		}
+	}
+
+	return messages
+}
+
+var integerDisplayWidthRegexp = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+
+// Normalizes the differences in how MySQL and MariaDB show the same column
+// types: MySQL 8.0 dropped the display width of the integer types, and the
+// JSON type of MariaDB is an alias of LONGTEXT.
+func normalizeColumnType(rawType string) string {
+	rawType = integerDisplayWidthRegexp.ReplaceAllString(strings.ToLower(rawType), "$1")
+	if rawType == "json" {
+		return "longtext"
+	}
+	return rawType
+}
+
+// The privileges granted to a user, keyed by the database they are granted
+// on, which is a LIKE pattern such as db\_%. Global privileges are keyed by
+// the empty string.
+type GrantedPrivileges struct {
+	privileges map[string]map[string]bool
+
+	// The roles granted to the user, from statements such as
+	// GRANT `reader`@`%` TO `ghostferry`@`%`.
+	Roles []string
+
+	// Set if the privileges of the active roles could not be listed, in which
+	// case the missing privileges may still be granted by the roles.
+	UnresolvedRoles bool
+}
+
+// The names under which the privileges are granted on recent versions of
+// MariaDB, which split and renamed the replication privileges.
+var privilegeAliases = map[string][]string{
+	"REPLICATION SLAVE":  {"REPLICATION REPLICA"},
+	"REPLICATION CLIENT": {"BINLOG MONITOR"},
+}
+
+// Parses the statements listed by SHOW GRANTS.
+func ParseGrants(statements []string) *GrantedPrivileges {
+	grants := &GrantedPrivileges{privileges: make(map[string]map[string]bool)}
+	for _, statement := range statements {
+		grants.parseGrant(statement)
+	}
+	return grants
+}
+
+// Returns whether the privilege is granted globally or, unless the database is
+// empty, on a pattern matching the database.
+func (g *GrantedPrivileges) Has(privilege, database string) bool {
+	names := append([]string{privilege}, privilegeAliases[privilege]...)
+	for scope, privileges := range g.privileges {
+		if scope != "" && (database == "" || !databasePatternMatches(scope, database)) {
+			continue
+		}
+
+		if privileges["ALL PRIVILEGES"] {
+			return true
+		}
+
+		for _, name := range names {
+			if privileges[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reports a missing privilege, as a warning only if it may be granted by
+// roles whose privileges could not be listed.
+func (g *GrantedPrivileges) reportMissing(report *PreflightReport, format string, args ...interface{}) {
+	if g.UnresolvedRoles {
+		args = append(args, strings.Join(g.Roles, ", "))
+		report.warn("privileges", format+", unless granted by the roles %s", args...)
+		return
+	}
+
+	report.add("privileges", format, args...)
+}
+
+func (g *GrantedPrivileges) requireOnDatabases(report *PreflightReport, side string, privileges []string, databases map[string]bool) {
+	for database := range databases {
+		for _, privilege := range privileges {
+			if !g.Has(privilege, database) {
+				g.reportMissing(report, "missing %s privilege on database %s on %s", privilege, database, side)
+			}
+		}
+	}
+}
+
+func showGrants(db *sql.DB) (*GrantedPrivileges, error) {
+	statements, err := queryGrants(db, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return nil, err
+	}
+
+	grants := ParseGrants(statements)
+	if len(grants.Roles) == 0 {
+		return grants, nil
+	}
+
+	// Only the privileges of the active roles apply to the connections. MySQL
+	// lists them with USING, given the roles as returned by CURRENT_ROLE(),
+	// such as `reader`@`%`,`writer`@`%`, and MariaDB, which has a single
+	// active role, with SHOW GRANTS FOR CURRENT_ROLE.
+	var activeRoles sql.NullString
+	err = db.QueryRow("SELECT CURRENT_ROLE()").Scan(&activeRoles)
+	if err == nil && (!activeRoles.Valid || activeRoles.String == "NONE") {
+		return grants, nil
+	}
+
+	if err == nil {
+		statements, err = queryGrants(db, "SHOW GRANTS FOR CURRENT_USER() USING "+activeRoles.String)
+		if err != nil {
+			statements, err = queryGrants(db, "SHOW GRANTS FOR CURRENT_ROLE")
+		}
+	}
+
+	if err != nil {
+		grants.UnresolvedRoles = true
+		return grants, nil
+	}
+
+	for _, statement := range statements {
+		grants.parseGrant(statement)
+	}
+
+	return grants, nil
+}
+
+func queryGrants(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []string
+	for rows.Next() {
+		var statement string
+		err = rows.Scan(&statement)
+		if err != nil {
+			return nil, err
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return statements, rows.Err()
+}
+
+// Parses statements such as:
+//
+//	GRANT SELECT, REPLICATION SLAVE ON *.* TO 'ghostferry'@'%'
+//	GRANT ALL PRIVILEGES ON `gftest`.* TO 'ghostferry'@'%'
+//	GRANT `reader`@`%` TO `ghostferry`@`%`
+//
+// Table and column level grants are ignored as they are not sufficient for
+// ferrying whole tables.
+func (g *GrantedPrivileges) parseGrant(grant string) {
+	upper := strings.ToUpper(grant)
+	if !strings.HasPrefix(upper, "GRANT ") {
+		return
+	}
+
+	onIndex := strings.Index(upper, " ON ")
+	toIndex := strings.Index(upper, " TO ")
+	if toIndex >= 0 && (onIndex < 0 || toIndex < onIndex) {
+		for _, role := range strings.Split(grant[len("GRANT "):toIndex], ",") {
+			g.Roles = append(g.Roles, strings.TrimSpace(role))
+		}
+		return
+	}
+
+	if onIndex < 0 {
+		return
+	}
+
+	target := strings.Fields(grant[onIndex+len(" ON "):])
+	if len(target) == 0 {
+		return
+	}
+
+	var scope string
+	switch {
+	case target[0] == "*.*":
+		scope = ""
+	case strings.HasSuffix(target[0], ".*"):
+		scope = strings.Trim(strings.TrimSuffix(target[0], ".*"), "`")
+	default:
+		return
+	}
+
+	if g.privileges[scope] == nil {
+		g.privileges[scope] = make(map[string]bool)
+	}
+
+	for _, privilege := range strings.Split(upper[len("GRANT "):onIndex], ",") {
+		g.privileges[scope][strings.TrimSpace(privilege)] = true
+	}
+}
+
+// Matches the database against the pattern of a grant, in which % and _ are
+// the wildcards of LIKE and can be escaped with a backslash.
+func databasePatternMatches(pattern, database string) bool {
+	if pattern == database {
+		return true
+	}
+
+	expression := "^"
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			expression += regexp.QuoteMeta(pattern[i : i+1])
+		case pattern[i] == '%':
+			expression += ".*"
+		case pattern[i] == '_':
+			expression += "."
+		default:
+			expression += regexp.QuoteMeta(pattern[i : i+1])
+		}
+	}
+
+	matches, err := regexp.MatchString(expression+"$", database)
+	return err == nil && matches
+}
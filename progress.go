@@ -0,0 +1,143 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// A snapshot of the progress of the run, logged periodically by the
+// ProgressReporter.
+type ProgressSummary struct {
+	CompletedTables int
+	TotalTables     int
+	RowsCopied      int64
+	RowsPerSecond   float64
+	ReplicationLag  time.Duration
+	ETA             time.Duration
+
+	// The percentage of the interval during which the ferry was throttled.
+	ThrottledPercent float64
+}
+
+func (s ProgressSummary) String() string {
+	return fmt.Sprintf(
+		"tables %d/%d, rows copied %d (%.1f rows/s), replication lag %s, ETA %s, throttled %.0f%%",
+		s.CompletedTables,
+		s.TotalTables,
+		s.RowsCopied,
+		s.RowsPerSecond,
+		s.ReplicationLag.Round(100*time.Millisecond),
+		s.ETA,
+		s.ThrottledPercent,
+	)
+}
+
+// ProgressReporter logs a one line summary of the progress of the run every
+// Interval, as a heartbeat for the operators tailing the logs.
+type ProgressReporter struct {
+	Ferry    *Ferry
+	Interval time.Duration
+
+	logger *logrus.Entry
+
+	rowsCopied         int64
+	lastRowsCopied     int64
+	lastReportTime     time.Time
+	throttledSamples   int
+	unthrottledSamples int
+}
+
+func (r *ProgressReporter) Initialize() {
+	r.logger = logrus.WithField("tag", "progress")
+}
+
+// Counts the rows of a batch written to the target. Meant to be added as a
+// batch listener of the DataIterator after the RowBatchWriter.
+func (r *ProgressReporter) CountRowBatch(batch *RowBatch) error {
+	atomic.AddInt64(&r.rowsCopied, int64(batch.Size()))
+	return nil
+}
+
+func (r *ProgressReporter) Run(ctx context.Context) error {
+	reportTicker := time.NewTicker(r.Interval)
+	defer reportTicker.Stop()
+
+	// The throttling is sampled every second to estimate the share of time
+	// spent throttled.
+	sampleTicker := time.NewTicker(time.Second)
+	defer sampleTicker.Stop()
+
+	r.lastReportTime = time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sampleTicker.C:
+			if r.throttled() {
+				r.throttledSamples++
+			} else {
+				r.unthrottledSamples++
+			}
+		case <-reportTicker.C:
+			summary := r.summarize()
+			r.logger.WithFields(logrus.Fields{
+				"completed_tables":  summary.CompletedTables,
+				"total_tables":      summary.TotalTables,
+				"rows_copied":       summary.RowsCopied,
+				"rows_per_second":   summary.RowsPerSecond,
+				"replication_lag":   summary.ReplicationLag.Seconds(),
+				"eta":               summary.ETA.Seconds(),
+				"throttled_percent": summary.ThrottledPercent,
+			}).Info(summary.String())
+		}
+	}
+}
+
+// Returns the progress since the last summary, and starts a new interval.
+func (r *ProgressReporter) summarize() ProgressSummary {
+	now := time.Now()
+	rowsCopied := atomic.LoadInt64(&r.rowsCopied)
+	state := r.Ferry.DataIterator.CurrentState
+
+	summary := ProgressSummary{
+		CompletedTables: len(state.CompletedTables()),
+		TotalTables:     len(r.Ferry.Tables),
+		RowsCopied:      rowsCopied,
+		ReplicationLag:  r.Ferry.ReplicationLag(),
+	}
+
+	if elapsed := now.Sub(r.lastReportTime).Seconds(); elapsed > 0 {
+		summary.RowsPerSecond = float64(rowsCopied-r.lastRowsCopied) / elapsed
+	}
+
+	if summary.CompletedTables < summary.TotalTables {
+		if eta, pksPerSecond := estimateCopyETA(state); pksPerSecond > 0 {
+			summary.ETA = eta
+		}
+	}
+
+	if samples := r.throttledSamples + r.unthrottledSamples; samples > 0 {
+		summary.ThrottledPercent = 100 * float64(r.throttledSamples) / float64(samples)
+	}
+
+	r.lastRowsCopied = rowsCopied
+	r.lastReportTime = now
+	r.throttledSamples = 0
+	r.unthrottledSamples = 0
+
+	return summary
+}
+
+func (r *ProgressReporter) throttled() bool {
+	for _, throttler := range r.Ferry.throttlers() {
+		if throttler.Throttled() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,403 @@
+package ghostferry
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	ProxyTypeSSH    = "ssh"
+	ProxyTypeSOCKS5 = "socks5"
+)
+
+// ProxyConfig connects to a database through an SSH bastion or a SOCKS5
+// proxy, for the databases only reachable from a jump host. Both the
+// connections of database/sql and the binlog streaming go through the
+// proxy. The binlog client cannot be given a dialer, so it connects to a
+// local port forwarded through the proxy instead.
+type ProxyConfig struct {
+	// Either ssh or socks5.
+	Type string
+
+	// The host:port of the bastion or of the proxy.
+	Address string
+
+	// The user of the bastion, or of the proxy if it requires
+	// authentication.
+	//
+	// Required for ssh.
+	User string
+
+	// The password of the bastion or of the proxy. The SSH keys are
+	// preferred for the bastion.
+	//
+	// Optional: defaults to no password.
+	Pass string
+
+	// The private key to authenticate to the bastion with.
+	//
+	// Optional: defaults to the keys of the SSH agent of SSH_AUTH_SOCK.
+	PrivateKeyPath string
+
+	// The known_hosts file the host key of the bastion is checked against.
+	//
+	// Required for ssh, unless InsecureIgnoreHostKey.
+	KnownHostsPath string
+
+	// Skips the check of the host key of the bastion, which allows a man in
+	// the middle to read the traffic that is not encrypted with TLS.
+	//
+	// Optional: defaults to false.
+	InsecureIgnoreHostKey bool
+
+	mutex          sync.Mutex
+	sshClient      *ssh.Client
+	dialRegistered bool
+	forwarders     map[string]string
+}
+
+func (p *ProxyConfig) Validate() error {
+	if p.Address == "" {
+		return fmt.Errorf("Address is required")
+	}
+
+	switch p.Type {
+	case ProxyTypeSSH:
+		if p.User == "" {
+			return fmt.Errorf("User is required for %s", ProxyTypeSSH)
+		}
+
+		if p.KnownHostsPath == "" && !p.InsecureIgnoreHostKey {
+			return fmt.Errorf("KnownHostsPath is required for %s, unless InsecureIgnoreHostKey", ProxyTypeSSH)
+		}
+
+		if p.PrivateKeyPath == "" && p.Pass == "" && os.Getenv("SSH_AUTH_SOCK") == "" {
+			return fmt.Errorf("PrivateKeyPath or Pass is required for %s, unless SSH_AUTH_SOCK is set", ProxyTypeSSH)
+		}
+	case ProxyTypeSOCKS5:
+		if len(p.User) > 255 || len(p.Pass) > 255 {
+			return fmt.Errorf("User and Pass must be at most 255 bytes for %s", ProxyTypeSOCKS5)
+		}
+	default:
+		return fmt.Errorf("invalid Type %s, must be %s or %s", p.Type, ProxyTypeSSH, ProxyTypeSOCKS5)
+	}
+
+	return nil
+}
+
+// Opens a connection to the address through the proxy.
+func (p *ProxyConfig) Dial(address string) (net.Conn, error) {
+	if p.Type == ProxyTypeSOCKS5 {
+		return p.dialSOCKS5(address)
+	}
+
+	client, err := p.connectSSH()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.Dial("tcp", address)
+	if err == nil {
+		return conn, nil
+	}
+
+	// The connection to the bastion may have been lost, in which case it is
+	// opened again once.
+	p.mutex.Lock()
+	if p.sshClient == client {
+		p.sshClient.Close()
+		p.sshClient = nil
+	}
+	p.mutex.Unlock()
+
+	client, err = p.connectSSH()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Dial("tcp", address)
+}
+
+// The network of the connections of database/sql through the proxy,
+// registered with the MySQL driver.
+func (p *ProxyConfig) mysqlNetwork() string {
+	network := fmt.Sprintf("ghostferry-proxy-%p", p)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.dialRegistered {
+		mysql.RegisterDial(network, p.Dial)
+		p.dialRegistered = true
+	}
+
+	return network
+}
+
+// Returns the local host:port forwarded to the address through the proxy,
+// listening on it the first time. The forwarding lasts as long as the
+// process.
+func (p *ProxyConfig) forwardedAddress(address string) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if forwarded, exists := p.forwarders[address]; exists {
+		return forwarded, nil
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to listen to forward %s through the proxy: %v", address, err)
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"tag":     "proxy",
+		"address": address,
+		"local":   listener.Addr().String(),
+	})
+	logger.Info("forwarding local port through the proxy")
+
+	go func() {
+		for {
+			local, err := listener.Accept()
+			if err != nil {
+				logger.WithError(err).Error("failed to accept forwarded connection")
+				return
+			}
+
+			go func() {
+				remote, err := p.Dial(address)
+				if err != nil {
+					logger.WithError(err).Error("failed to connect through the proxy")
+					local.Close()
+					return
+				}
+
+				pipeConns(local, remote)
+			}()
+		}
+	}()
+
+	if p.forwarders == nil {
+		p.forwarders = make(map[string]string)
+	}
+	p.forwarders[address] = listener.Addr().String()
+
+	return p.forwarders[address], nil
+}
+
+// Copies the data between the connections until either is closed.
+func pipeConns(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	copyConn := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+
+	go copyConn(a, b)
+	go copyConn(b, a)
+
+	<-done
+	a.Close()
+	b.Close()
+}
+
+func (p *ProxyConfig) connectSSH() (*ssh.Client, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.sshClient != nil {
+		return p.sshClient, nil
+	}
+
+	config := &ssh.ClientConfig{
+		User:    p.User,
+		Timeout: 10 * time.Second,
+	}
+
+	if p.InsecureIgnoreHostKey {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		callback, err := knownhosts.New(p.KnownHostsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read KnownHostsPath: %v", err)
+		}
+		config.HostKeyCallback = callback
+	}
+
+	if p.PrivateKeyPath != "" {
+		pem, err := ioutil.ReadFile(p.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PrivateKeyPath: %v", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PrivateKeyPath: %v", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	} else if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the SSH agent: %v", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	if p.Pass != "" {
+		config.Auth = append(config.Auth, ssh.Password(p.Pass))
+	}
+
+	client, err := ssh.Dial("tcp", p.Address, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the SSH bastion %s: %v", p.Address, err)
+	}
+
+	p.sshClient = client
+	return client, nil
+}
+
+// Connects to the address through the SOCKS5 proxy, as described in RFC
+// 1928, with the username and password authentication of RFC 1929 if User
+// is set. The host name is resolved by the proxy.
+func (p *ProxyConfig) dialSOCKS5(address string) (net.Conn, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s", portString)
+	}
+
+	if len(host) > 255 {
+		return nil, fmt.Errorf("host %s is too long for %s", host, ProxyTypeSOCKS5)
+	}
+
+	conn, err := net.DialTimeout("tcp", p.Address, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the SOCKS5 proxy %s: %v", p.Address, err)
+	}
+
+	err = p.socks5Handshake(conn, host, uint16(port))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS5 proxy %s failed to connect to %s: %v", p.Address, address, err)
+	}
+
+	return conn, nil
+}
+
+const (
+	socks5Version          = 5
+	socks5NoAuthentication = 0
+	socks5UserPassword     = 2
+	socks5NoAcceptable     = 0xff
+	socks5Connect          = 1
+	socks5AddressIPv4      = 1
+	socks5AddressDomain    = 3
+	socks5AddressIPv6      = 4
+)
+
+func (p *ProxyConfig) socks5Handshake(conn net.Conn, host string, port uint16) error {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	methods := []byte{socks5NoAuthentication}
+	if p.User != "" {
+		methods = []byte{socks5UserPassword}
+	}
+
+	_, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	if reply[0] != socks5Version || reply[1] == socks5NoAcceptable || reply[1] != methods[0] {
+		return fmt.Errorf("no acceptable authentication method")
+	}
+
+	if reply[1] == socks5UserPassword {
+		request := []byte{1, byte(len(p.User))}
+		request = append(request, p.User...)
+		request = append(request, byte(len(p.Pass)))
+		request = append(request, p.Pass...)
+		if _, err = conn.Write(request); err != nil {
+			return err
+		}
+
+		if _, err = io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+
+		if reply[1] != 0 {
+			return fmt.Errorf("authentication failed")
+		}
+	}
+
+	request := []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		request = append(request, socks5AddressIPv4)
+		request = append(request, ip.To4()...)
+	} else if ip != nil {
+		request = append(request, socks5AddressIPv6)
+		request = append(request, ip.To16()...)
+	} else {
+		request = append(request, socks5AddressDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = append(request, 0, 0)
+	binary.BigEndian.PutUint16(request[len(request)-2:], port)
+
+	if _, err = conn.Write(request); err != nil {
+		return err
+	}
+
+	// The reply ends with the address bound by the proxy, which is skipped.
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+
+	if header[1] != 0 {
+		return fmt.Errorf("connection refused with reply code %d", header[1])
+	}
+
+	var addressLength int
+	switch header[3] {
+	case socks5AddressIPv4:
+		addressLength = net.IPv4len
+	case socks5AddressIPv6:
+		addressLength = net.IPv6len
+	case socks5AddressDomain:
+		length := make([]byte, 1)
+		if _, err = io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		addressLength = int(length[0])
+	default:
+		return fmt.Errorf("invalid address type %d in reply", header[3])
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, addressLength+2))
+	return err
+}
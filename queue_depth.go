@@ -0,0 +1,114 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The names of the queues monitored by the ferry, as used in
+// Config.MaxHealthyQueueDepths and in the queue tag of the QueueDepth gauge.
+const (
+	QueueReverify     = "reverify"
+	QueueBinlogBuffer = "binlog_buffer"
+	QueueDeadLetter   = "dead_letter"
+)
+
+// QueueDepthMonitor periodically reports the depth of the queues of work
+// waiting to be done, such as the rows waiting to be reverified. If any of
+// these keeps growing, the ferry will never converge, so the queues deeper
+// than their threshold are reported by the health check.
+type QueueDepthMonitor struct {
+	Interval time.Duration
+
+	// The maximum healthy depth of each queue, keyed by queue name. The
+	// queues without a threshold are only reported as metrics.
+	Thresholds map[string]int64
+
+	logger *logrus.Entry
+
+	mutex  sync.RWMutex
+	queues map[string]func() int64
+}
+
+func (m *QueueDepthMonitor) Initialize() {
+	m.logger = logrus.WithField("tag", "queue_depth_monitor")
+	m.queues = make(map[string]func() int64)
+}
+
+// Adds a queue to monitor, replacing the queue with the same name if any.
+// The depth function is called from the monitor's goroutine and from the
+// health check, so it must be safe for concurrent use.
+func (m *QueueDepthMonitor) AddQueue(name string, depth func() int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.queues[name] = depth
+}
+
+func (m *QueueDepthMonitor) Depths() map[string]int64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	depths := make(map[string]int64, len(m.queues))
+	for name, depth := range m.queues {
+		depths[name] = depth()
+	}
+
+	return depths
+}
+
+// Returns a description of every queue deeper than its threshold, sorted by
+// queue name.
+func (m *QueueDepthMonitor) Problems() []string {
+	depths := m.Depths()
+
+	names := make([]string, 0, len(depths))
+	for name := range depths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		threshold, exists := m.Thresholds[name]
+		if exists && depths[name] > threshold {
+			problems = append(problems, fmt.Sprintf("%s queue depth %d exceeds %d", name, depths[name], threshold))
+		}
+	}
+
+	return problems
+}
+
+func (m *QueueDepthMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			m.report()
+		}
+	}
+}
+
+func (m *QueueDepthMonitor) report() {
+	for name, depth := range m.Depths() {
+		metrics.Gauge("QueueDepth", float64(depth), []MetricTag{{"queue", name}}, 1.0)
+
+		threshold, exists := m.Thresholds[name]
+		if exists && depth > threshold {
+			m.logger.WithFields(logrus.Fields{
+				"queue":     name,
+				"depth":     depth,
+				"threshold": threshold,
+			}).Warn("queue depth exceeds threshold, the ferry may not converge")
+		}
+	}
+}
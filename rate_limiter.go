@@ -0,0 +1,135 @@
+package ghostferry
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitPhaseCopy   = "copy"
+	RateLimitPhaseBinlog = "binlog"
+)
+
+// RateLimiter limits the rate of the writes to the target in rows and bytes
+// per second, with a token bucket for each that holds up to a second worth of
+// writes. A write may take more tokens than the bucket holds, in which case
+// the following writes wait until the bucket is paid back. A limit of 0
+// disables the corresponding bucket. The limits can be changed at any time.
+type RateLimiter struct {
+	mutex sync.Mutex
+
+	rowsPerSecond  int64
+	bytesPerSecond int64
+
+	rowTokens  float64
+	byteTokens float64
+	lastRefill time.Time
+}
+
+func NewRateLimiter(rowsPerSecond, bytesPerSecond int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimits(rowsPerSecond, bytesPerSecond)
+	return l
+}
+
+func (l *RateLimiter) SetLimits(rowsPerSecond, bytesPerSecond int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.rowsPerSecond = rowsPerSecond
+	l.bytesPerSecond = bytesPerSecond
+	l.rowTokens = math.Min(l.rowTokens, float64(rowsPerSecond))
+	l.byteTokens = math.Min(l.byteTokens, float64(bytesPerSecond))
+	l.lastRefill = time.Now()
+}
+
+func (l *RateLimiter) Limits() (rowsPerSecond, bytesPerSecond int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.rowsPerSecond, l.bytesPerSecond
+}
+
+// Blocks until the given number of rows and bytes can be written.
+func (l *RateLimiter) Wait(rows, bytes int64) {
+	time.Sleep(l.reserve(rows, bytes, time.Now()))
+}
+
+// Takes the tokens for the write and returns how long to wait before doing
+// it.
+func (l *RateLimiter) reserve(rows, bytes int64, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	elapsed := now.Sub(l.lastRefill).Seconds()
+	l.lastRefill = now
+
+	rowWait := takeTokens(&l.rowTokens, l.rowsPerSecond, rows, elapsed)
+	byteWait := takeTokens(&l.byteTokens, l.bytesPerSecond, bytes, elapsed)
+
+	if rowWait > byteWait {
+		return rowWait
+	}
+	return byteWait
+}
+
+func takeTokens(tokens *float64, perSecond, n int64, elapsed float64) time.Duration {
+	if perSecond <= 0 {
+		return 0
+	}
+
+	*tokens = math.Min(*tokens+elapsed*float64(perSecond), float64(perSecond))
+
+	var wait time.Duration
+	if *tokens < 0 {
+		wait = time.Duration(-*tokens / float64(perSecond) * float64(time.Second))
+	}
+
+	*tokens -= float64(n)
+	return wait
+}
+
+// An estimate of the size of the values when written to the target.
+func rowDataSize(row RowData) int64 {
+	var size int64
+	for _, value := range row {
+		switch v := value.(type) {
+		case nil:
+			size += 4
+		case []byte:
+			size += int64(len(v))
+		case string:
+			size += int64(len(v))
+		default:
+			size += 8
+		}
+	}
+	return size
+}
+
+func rowBatchSize(batch *RowBatch) int64 {
+	var size int64
+	for _, row := range batch.Values() {
+		size += rowDataSize(row)
+	}
+	return size
+}
+
+func largestRowSize(batch *RowBatch) int64 {
+	var largest int64
+	for _, row := range batch.Values() {
+		if size := rowDataSize(row); size > largest {
+			largest = size
+		}
+	}
+	return largest
+}
+
+func dmlEventsSize(events []DMLEvent) int64 {
+	var size int64
+	for _, ev := range events {
+		size += rowDataSize(ev.OldValues()) + rowDataSize(ev.NewValues())
+	}
+	return size
+}
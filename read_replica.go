@@ -0,0 +1,98 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadReplicaConfig configures a ferry that copies the rows from a replica
+// of the Source, to offload the Source, while the binlog is still streamed
+// from the Source.
+//
+// A row read from the replica is the row of the Source at the position the
+// replica replicated, and only the events streamed after the start of the
+// binlog streaming are applied to it. The copy is therefore only started
+// once the replica has replicated the position the binlog streaming started
+// from, so no event is missing from the copied rows. As for a copy from the
+// Source, the events streamed before a row is read are applied to it again.
+type ReadReplicaConfig struct {
+	// The connection to the replica the rows are copied from.
+	//
+	// Required
+	Replica DatabaseConfig
+
+	// The query returning the position of the binlog of the Source the
+	// replica replicated, as a file and a position. See
+	// ReplicatedMasterPositionViaCustomQuery.
+	//
+	// Required, unless UseGTID is set
+	ReplicatedMasterPositionQuery string
+
+	// Compares the GTIDs executed on the replica against those of the Source
+	// instead of the ReplicatedMasterPositionQuery.
+	//
+	// Optional: defaults to false.
+	UseGTID bool
+
+	// How long to wait for the replica to replicate the position the
+	// binlog streaming started from before the copy, as a Go duration
+	// string.
+	//
+	// Optional: defaults to 10m
+	CatchUpTimeout string
+}
+
+func (c *ReadReplicaConfig) Validate() error {
+	if err := c.Replica.Validate(); err != nil {
+		return fmt.Errorf("Replica: %s", err)
+	}
+
+	if c.ReplicatedMasterPositionQuery == "" && !c.UseGTID {
+		return fmt.Errorf("ReplicatedMasterPositionQuery or UseGTID must be set")
+	}
+
+	if c.ReplicatedMasterPositionQuery != "" && c.UseGTID {
+		return fmt.Errorf("ReplicatedMasterPositionQuery cannot be set with UseGTID")
+	}
+
+	if c.CatchUpTimeout == "" {
+		c.CatchUpTimeout = "10m"
+	}
+
+	if _, err := time.ParseDuration(c.CatchUpTimeout); err != nil {
+		return fmt.Errorf("invalid CatchUpTimeout: %s", err)
+	}
+
+	return nil
+}
+
+// Waits until the read replica replicated the current position of the
+// Source, which is past the position the binlog streaming started from, so
+// none of the rows copied from the replica miss the events streamed before.
+func (f *Ferry) waitForReadReplica(ctx context.Context) error {
+	timeout, err := time.ParseDuration(f.Config.ReadReplica.CatchUpTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid CatchUpTimeout: %v", err)
+	}
+
+	wait := &WaitUntilReplicaIsCaughtUpToMaster{
+		MasterDB:  f.SourceDB,
+		ReplicaDB: f.ReadReplicaDB,
+		Timeout:   timeout,
+	}
+
+	if f.Config.ReadReplica.UseGTID {
+		wait.ReplicatedMasterGTIDSetFetcher = ReplicatedMasterGTIDSetViaGTIDExecuted{}
+	} else {
+		wait.ReplicatedMasterPositionFetcher = ReplicatedMasterPositionViaCustomQuery{Query: f.Config.ReadReplica.ReplicatedMasterPositionQuery}
+	}
+
+	f.logger.Info("waiting for the read replica to replicate the start of the binlog streaming")
+	err = wait.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("read replica did not replicate the start of the binlog streaming: %v", err)
+	}
+
+	return nil
+}
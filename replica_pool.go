@@ -0,0 +1,110 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// A pool of replicas whose members can change over time, such as the fleet of
+// replicas behind a proxy. The pool is resolved again every time the
+// WaitUntilReplicaIsCaughtUpToMaster checks the replicas.
+type ReplicaPool interface {
+	Replicas() ([]Replica, error)
+}
+
+// Resolves the replicas from the runtime configuration of a ProxySQL
+// instance, by reading the servers of a hostgroup through the admin
+// interface. A connection is opened to each server directly, as going
+// through the proxy would check a different server on every query.
+//
+// The SHUNNED and OFFLINE_SOFT servers are included with the ONLINE ones, as
+// ProxySQL shuns the replicas that lag behind, which are exactly the ones to
+// wait for, and drains the OFFLINE_SOFT ones while they still serve queries.
+// Only the OFFLINE_HARD servers are left out.
+type ProxySQLReplicaPool struct {
+	AdminDB   *sql.DB
+	HostGroup int
+
+	// The connection config of the replicas, of which the Host and Port are
+	// replaced by those of each server.
+	ReplicaConfig                   DatabaseConfig
+	ReplicatedMasterPositionFetcher ReplicatedMasterPositionFetcher
+	ReplicatedMasterGTIDSetFetcher  ReplicatedMasterGTIDSetFetcher
+
+	logger *logrus.Entry
+
+	mutex sync.Mutex
+	dbs   map[string]*sql.DB
+}
+
+func (p *ProxySQLReplicaPool) Replicas() ([]Replica, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.logger == nil {
+		p.logger = logrus.WithField("tag", "proxysql_replica_pool")
+	}
+
+	if p.dbs == nil {
+		p.dbs = make(map[string]*sql.DB)
+	}
+
+	rows, err := p.AdminDB.Query("SELECT hostname, port FROM runtime_mysql_servers WHERE hostgroup_id = ? AND status IN ('ONLINE', 'SHUNNED', 'OFFLINE_SOFT') ORDER BY hostname, port", p.HostGroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the servers of hostgroup %d: %v", p.HostGroup, err)
+	}
+	defer rows.Close()
+
+	servers := []DatabaseConfig{}
+	for rows.Next() {
+		config := p.ReplicaConfig
+		err = rows.Scan(&config.Host, &config.Port)
+		if err != nil {
+			return nil, err
+		}
+
+		servers = append(servers, config)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	replicas := make([]Replica, 0, len(servers))
+	online := make(map[string]bool, len(servers))
+
+	for _, config := range servers {
+		name := fmt.Sprintf("%s:%d", config.Host, config.Port)
+		online[name] = true
+
+		db, exists := p.dbs[name]
+		if !exists {
+			db, err = config.SqlDB(p.logger)
+			if err != nil {
+				return nil, err
+			}
+			p.dbs[name] = db
+		}
+
+		replicas = append(replicas, Replica{
+			Name:                            name,
+			DB:                              db,
+			ReplicatedMasterPositionFetcher: p.ReplicatedMasterPositionFetcher,
+			ReplicatedMasterGTIDSetFetcher:  p.ReplicatedMasterGTIDSetFetcher,
+		})
+	}
+
+	// The servers that left the hostgroup may never come back.
+	for name, db := range p.dbs {
+		if !online[name] {
+			p.logger.WithField("replica", name).Info("replica left the hostgroup")
+			db.Close()
+			delete(p.dbs, name)
+		}
+	}
+
+	return replicas, nil
+}
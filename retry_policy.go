@@ -0,0 +1,269 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RetryBackoffConstant    = "constant"
+	RetryBackoffLinear      = "linear"
+	RetryBackoffExponential = "exponential"
+)
+
+// RetryPolicy describes how an operation is retried after it failed: how many
+// times, how long to wait between the attempts and which errors are worth
+// retrying at all.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first one.
+	//
+	// Optional: defaults to the retries configured for the class of the
+	// operation, see RetryPoliciesConfig.
+	MaxAttempts int
+
+	// How the delay between the attempts grows: constant keeps InitialDelay,
+	// linear adds InitialDelay after every attempt and exponential doubles
+	// it after every attempt. The delay never exceeds MaxDelay.
+	//
+	// Optional: defaults to constant.
+	Backoff string
+
+	// The delay after the first failed attempt.
+	//
+	// Optional: defaults to 0s.
+	InitialDelay string
+
+	// Optional: defaults to 30s.
+	MaxDelay string
+
+	// The fraction of the delay by which every delay is randomly shortened
+	// or lengthened, so the processes failing together do not retry in
+	// lockstep. Must be between 0 and 1.
+	//
+	// Optional: defaults to 0, no jitter.
+	Jitter float64
+
+	// The MySQL error numbers of the errors that are returned immediately,
+	// as retrying cannot make them succeed, for example 1146 for a missing
+	// table.
+	//
+	// Optional: defaults to retrying all the errors.
+	NonRetryableErrorCodes []uint16
+
+	// If set, only the errors for which this returns true are retried. This
+	// replaces NonRetryableErrorCodes.
+	IsRetryable func(error) bool `json:"-"`
+
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+// Parses the delays of the policy, must be called before the policy is used.
+func (p *RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("MaxAttempts must not be negative")
+	}
+
+	switch p.Backoff {
+	case "":
+		p.Backoff = RetryBackoffConstant
+	case RetryBackoffConstant, RetryBackoffLinear, RetryBackoffExponential:
+	default:
+		return fmt.Errorf("invalid Backoff %s, must be %s, %s or %s", p.Backoff, RetryBackoffConstant, RetryBackoffLinear, RetryBackoffExponential)
+	}
+
+	if p.InitialDelay == "" {
+		p.InitialDelay = "0s"
+	}
+
+	var err error
+	p.initialDelay, err = time.ParseDuration(p.InitialDelay)
+	if err != nil {
+		return fmt.Errorf("invalid InitialDelay: %s", err)
+	}
+
+	if p.MaxDelay == "" {
+		p.MaxDelay = "30s"
+	}
+
+	p.maxDelay, err = time.ParseDuration(p.MaxDelay)
+	if err != nil {
+		return fmt.Errorf("invalid MaxDelay: %s", err)
+	}
+
+	if p.initialDelay < 0 || p.maxDelay < 0 {
+		return fmt.Errorf("InitialDelay and MaxDelay must not be negative")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("Jitter must be between 0 and 1, got %v", p.Jitter)
+	}
+
+	return nil
+}
+
+// Returns the delay before the attempt following the given failed attempt,
+// without the jitter.
+func (p *RetryPolicy) DelayAfter(attempt int) time.Duration {
+	var delay time.Duration
+	switch p.Backoff {
+	case RetryBackoffLinear:
+		delay = time.Duration(attempt) * p.initialDelay
+	case RetryBackoffExponential:
+		delay = p.initialDelay
+		for i := 1; i < attempt && delay < p.maxDelay; i++ {
+			delay *= 2
+		}
+	default:
+		delay = p.initialDelay
+	}
+
+	if p.maxDelay > 0 && delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	return delay
+}
+
+func (p *RetryPolicy) Retryable(err error) bool {
+	if err == context.Canceled {
+		return false
+	}
+
+	if p.IsRetryable != nil {
+		return p.IsRetryable(err)
+	}
+
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		for _, code := range p.NonRetryableErrorCodes {
+			if mysqlErr.Number == code {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Calls f until it succeeds, returns an error that is not retryable, or
+// MaxAttempts is reached. A MaxAttempts of 0 retries forever. The wait
+// between the attempts is cut short if the context is done.
+func (p *RetryPolicy) Do(ctx context.Context, logger *logrus.Entry, verb string, f func() error) (err error) {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil {
+			return nil
+		}
+
+		if !p.Retryable(err) {
+			return err
+		}
+
+		if p.MaxAttempts != 0 && attempt >= p.MaxAttempts {
+			logger.WithError(err).Errorf("failed to %s after %d attempts, retry limit exceeded", verb, attempt)
+			return err
+		}
+
+		delay := p.withJitter(p.DelayAfter(attempt))
+		logger.WithError(err).Errorf("failed to %s, %d of %d max retries, retrying in %s", verb, attempt, p.MaxAttempts, delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (p *RetryPolicy) withJitter(delay time.Duration) time.Duration {
+	if p.Jitter == 0 || delay == 0 {
+		return delay
+	}
+
+	factor := 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+// Returns the policy, or a policy retrying maxAttempts times without any
+// delay if it is not set, as the components configured before the retry
+// policies were introduced expect.
+func retryPolicyOrDefault(policy *RetryPolicy, maxAttempts int) *RetryPolicy {
+	if policy != nil {
+		return policy
+	}
+
+	return &RetryPolicy{MaxAttempts: maxAttempts, Backoff: RetryBackoffConstant}
+}
+
+// The retry policies of the operations of the ferry, by class of operation.
+type RetryPoliciesConfig struct {
+	// The reads of the rows from the source, and of the fingerprints of the
+	// rows verified by the IterativeVerifier.
+	//
+	// Optional: defaults to DBReadRetries attempts without delay.
+	Read *RetryPolicy
+
+	// The writes of the row batches and the binlog events to the target.
+	//
+	// Optional: defaults to DBWriteRetries attempts without delay.
+	Write *RetryPolicy
+
+	// The reconnections to the source after the binlog streaming failed.
+	// Unlike the other classes, a MaxAttempts of 0 does not reconnect.
+	//
+	// Optional: defaults to BinlogReconnectAttempts attempts, with a delay
+	// growing by 1s after every attempt, up to 30s.
+	BinlogReconnect *RetryPolicy
+}
+
+func (c *RetryPoliciesConfig) validate(config *Config) error {
+	if c.Read == nil {
+		c.Read = &RetryPolicy{}
+	}
+	if c.Read.MaxAttempts == 0 {
+		c.Read.MaxAttempts = config.DBReadRetries
+	}
+
+	if c.Write == nil {
+		c.Write = &RetryPolicy{}
+	}
+	if c.Write.MaxAttempts == 0 {
+		c.Write.MaxAttempts = config.DBWriteRetries
+	}
+
+	if c.BinlogReconnect == nil {
+		c.BinlogReconnect = &RetryPolicy{
+			Backoff:      RetryBackoffLinear,
+			InitialDelay: "1s",
+			MaxDelay:     "30s",
+		}
+	}
+	if c.BinlogReconnect.MaxAttempts == 0 {
+		c.BinlogReconnect.MaxAttempts = config.BinlogReconnectAttempts
+	}
+
+	policies := map[string]*RetryPolicy{
+		"Read":            c.Read,
+		"Write":           c.Write,
+		"BinlogReconnect": c.BinlogReconnect,
+	}
+	for class, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("RetryPolicies.%s: %s", class, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// ReverseReplicationConfig configures a ferry keeping the old source of a
+// completed move up to date from the new primary, so the move can be rolled
+// back. The Source of this ferry is the new primary and its Target is the old
+// source: no rows are copied, the binlog of the new primary is tailed from
+// the cutover and applied to the old source until the ferry is interrupted.
+//
+// The changes written by the forward ferry are all before the cutover
+// position, so they are never applied back to the old source. The forward
+// ferry must be stopped before the reverse ferry starts, as the changes
+// applied by the reverse ferry would otherwise be copied forward again.
+type ReverseReplicationConfig struct {
+	// The position of the binlog of the new primary at the cutover, as
+	// logged by copydb once its binlog streaming stopped.
+	//
+	// Required
+	StartPosition mysql.Position
+}
+
+func (c *ReverseReplicationConfig) Validate() error {
+	if c.StartPosition.Name == "" {
+		return fmt.Errorf("StartPosition must be set")
+	}
+
+	return nil
+}
+
+// Returns the server ids of the binlog events the reverse replication must
+// not apply. The events of the old source may reach the binlog of the new
+// primary if the old source is also replicated natively, and applying them
+// back would loop them between the two.
+func (f *Ferry) reverseReplicationIgnoredServerIds() ([]uint32, error) {
+	sourceServerId, err := selectServerId(f.SourceDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server_id of source: %v", err)
+	}
+
+	targetServerId, err := selectServerId(f.TargetDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server_id of target: %v", err)
+	}
+
+	if sourceServerId == targetServerId {
+		return nil, fmt.Errorf("the source and the target of the reverse replication have the same server_id %d", sourceServerId)
+	}
+
+	if f.Config.MyServerId == sourceServerId || f.Config.MyServerId == targetServerId {
+		return nil, fmt.Errorf("MyServerId %d must differ from the server_id of the source and the target", f.Config.MyServerId)
+	}
+
+	return []uint32{targetServerId}, nil
+}
+
+func selectServerId(db *sql.DB) (uint32, error) {
+	var serverId uint32
+	err := db.QueryRow("SELECT @@server_id").Scan(&serverId)
+	return serverId, err
+}
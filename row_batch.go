@@ -40,7 +40,55 @@ func (e *RowBatch) TableSchema() *schema.Table {
 	return &e.table
 }
 
+// Splits the batch so that every row holding more than largeRowBytes bytes is
+// in a batch of its own, keeping the order of the rows. Returns the batch
+// itself if it has no such row.
+func (e *RowBatch) splitLargeRows(largeRowBytes uint64) []*RowBatch {
+	var batches []*RowBatch
+	start := 0
+
+	for i, row := range e.values {
+		if uint64(rowDataSize(row)) <= largeRowBytes {
+			continue
+		}
+
+		if i > start {
+			batches = append(batches, e.withValues(e.values[start:i]))
+		}
+		batches = append(batches, e.withValues(e.values[i:i+1]))
+		start = i + 1
+	}
+
+	if start == 0 {
+		return []*RowBatch{e}
+	}
+
+	if start < len(e.values) {
+		batches = append(batches, e.withValues(e.values[start:]))
+	}
+
+	return batches
+}
+
+func (e *RowBatch) withValues(values []RowData) *RowBatch {
+	return &RowBatch{
+		values:  values,
+		pkIndex: e.pkIndex,
+		table:   e.table,
+	}
+}
+
 func (e *RowBatch) AsSQLQuery(target *schema.Table) (string, []interface{}, error) {
+	return e.asInsertQuery("INSERT IGNORE INTO ", target)
+}
+
+// Unlike INSERT IGNORE, a plain INSERT fails on the values that do not fit
+// their column, instead of truncating them with a warning.
+func (e *RowBatch) asStrictSQLQuery(target *schema.Table) (string, []interface{}, error) {
+	return e.asInsertQuery("INSERT INTO ", target)
+}
+
+func (e *RowBatch) asInsertQuery(insert string, target *schema.Table) (string, []interface{}, error) {
 	columns, err := loadColumnsForTable(&e.table, e.values...)
 	if err != nil {
 		return "", nil, err
@@ -49,7 +97,7 @@ func (e *RowBatch) AsSQLQuery(target *schema.Table) (string, []interface{}, erro
 	valuesStr := "(" + strings.Repeat("?,", len(columns)-1) + "?)"
 	valuesStr = strings.Repeat(valuesStr+",", len(e.values)-1) + valuesStr
 
-	query := "INSERT IGNORE INTO " +
+	query := insert +
 		QuotedTableNameFromString(target.Schema, target.Name) +
 		" (" + strings.Join(columns, ",") + ") VALUES " + valuesStr
 
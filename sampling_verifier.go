@@ -0,0 +1,451 @@
+package ghostferry
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// The z-score of the 95% confidence level used for the reported bounds.
+const samplingConfidenceZ = 1.96
+
+// A range of primary keys, from Start to End included.
+type PrimaryKeyRange struct {
+	Start uint64
+	End   uint64
+}
+
+// The outcome of the sampling of a table.
+type SampleTableStats struct {
+	Table          string
+	SampledRows    int
+	MismatchedRows int
+
+	// Some of the mismatched primary keys, to investigate the mismatches.
+	MismatchedPks []uint64
+}
+
+// The fraction of the sampled rows that mismatched, which estimates the
+// fraction of the rows of the table that mismatch.
+func (s SampleTableStats) MismatchRate() float64 {
+	if s.SampledRows == 0 {
+		return 0
+	}
+	return float64(s.MismatchedRows) / float64(s.SampledRows)
+}
+
+// The upper bound of the 95% Wilson score interval of the mismatch rate of
+// the table. With no mismatches in n sampled rows, about 3.84/n.
+func (s SampleTableStats) MismatchRateUpperBound() float64 {
+	if s.SampledRows == 0 {
+		return 1
+	}
+
+	n := float64(s.SampledRows)
+	p := s.MismatchRate()
+	z2 := samplingConfidenceZ * samplingConfidenceZ
+
+	center := p + z2/(2*n)
+	margin := samplingConfidenceZ * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return math.Min(1, (center+margin)/(1+z2/n))
+}
+
+func (s SampleTableStats) String() string {
+	return fmt.Sprintf("%s: %d of %d sampled rows mismatched (rate %.4f%%, at most %.4f%% at 95%% confidence)",
+		s.Table, s.MismatchedRows, s.SampledRows, 100*s.MismatchRate(), 100*s.MismatchRateUpperBound())
+}
+
+// SamplingVerifier compares the fingerprints of a random sample of the rows
+// of each table on the source and the target. It is much faster than the
+// IterativeVerifier on large tables, but can only estimate how many rows
+// mismatch, so it is meant as a quick confidence check before a full
+// verification.
+//
+// The rows are sampled either as a percentage of the primary key ranges of
+// RangeSize primary keys, which also finds the rows missing on the source
+// or the target within these ranges, or as a number of random rows per
+// table.
+type SamplingVerifier struct {
+	SourceDB         *sql.DB
+	TargetDB         *sql.DB
+	Tables           []*schema.Table
+	DatabaseRewrites map[string]string
+	TableRewrites    map[string]string
+
+	// The columns not compared, keyed by the full table name. See
+	// Config.VerifierIgnoredColumns.
+	IgnoredColumns map[string][]string
+
+	// The percentage of the primary key ranges of each table to verify,
+	// between 0 and 100. Takes precedence over RowsPerTable.
+	SamplePercentage float64
+
+	// The number of random rows verified per table.
+	RowsPerTable int
+
+	// The number of primary keys per range.
+	//
+	// Optional: defaults to 1000.
+	RangeSize uint64
+
+	// Optional: defaults to 1.
+	Concurrency int
+
+	// The seed of the sampling, to reproduce a sample.
+	//
+	// Optional: defaults to a random seed.
+	Seed int64
+
+	started *AtomicBoolean
+
+	verificationResultAndStatus VerificationResultAndStatus
+	verificationErr             error
+	stats                       []SampleTableStats
+
+	logger *logrus.Entry
+	wg     *sync.WaitGroup
+}
+
+func (v *SamplingVerifier) Verify() (VerificationResult, error) {
+	if v.logger == nil {
+		v.logger = logrus.WithField("tag", "sampling_verifier")
+	}
+
+	if v.SamplePercentage <= 0 && v.RowsPerTable <= 0 {
+		return VerificationResult{}, errors.New("either SamplePercentage or RowsPerTable must be positive")
+	}
+
+	if v.SamplePercentage > 100 {
+		return VerificationResult{}, fmt.Errorf("SamplePercentage must be at most 100, got %v", v.SamplePercentage)
+	}
+
+	if v.RangeSize == 0 {
+		v.RangeSize = 1000
+	}
+
+	concurrency := v.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	seed := v.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	v.logger.WithField("seed", seed).Info("sampling tables")
+
+	stats := make([]SampleTableStats, len(v.Tables))
+	pool := &WorkerPool{
+		Concurrency: concurrency,
+		Process: func(tableIndex int) (interface{}, error) {
+			table := v.Tables[tableIndex]
+			if IsFullRowMatchTable(table) {
+				return nil, nil
+			}
+
+			rnd := rand.New(rand.NewSource(seed + int64(tableIndex)))
+
+			var err error
+			stats[tableIndex], err = v.sampleTable(table, rnd)
+			if err != nil {
+				v.logger.WithError(err).WithField("table", table.String()).Error("failed to sample table")
+			}
+			return nil, err
+		},
+	}
+
+	_, err := pool.Run(len(v.Tables))
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	v.stats = stats
+
+	var mismatches []string
+	sampledRows, mismatchedRows := 0, 0
+	for _, tableStats := range stats {
+		sampledRows += tableStats.SampledRows
+		mismatchedRows += tableStats.MismatchedRows
+		v.logger.WithField("table", tableStats.Table).Info(tableStats.String())
+
+		metrics.Gauge("SamplingVerifier.SampledRows", float64(tableStats.SampledRows), []MetricTag{{"table", tableStats.Table}}, 1.0)
+		metrics.Gauge("SamplingVerifier.MismatchedRows", float64(tableStats.MismatchedRows), []MetricTag{{"table", tableStats.Table}}, 1.0)
+
+		if tableStats.MismatchedRows > 0 {
+			mismatches = append(mismatches, fmt.Sprintf("%s, such as pks %v", tableStats.String(), tableStats.MismatchedPks))
+		}
+	}
+
+	v.logger.WithFields(logrus.Fields{
+		"tables":      len(stats),
+		"sampledRows": sampledRows,
+	}).Info("sampling verification complete")
+
+	if len(mismatches) > 0 {
+		return VerificationResult{
+			DataCorrect:    false,
+			Message:        "sampled rows mismatched:\n" + strings.Join(mismatches, "\n"),
+			MismatchedRows: int64(mismatchedRows),
+		}, nil
+	}
+
+	return VerificationResult{DataCorrect: true}, nil
+}
+
+// The statistics of the tables from the last verification.
+func (v *SamplingVerifier) Stats() []SampleTableStats {
+	return v.stats
+}
+
+func (v *SamplingVerifier) sampleTable(table *schema.Table, rnd *rand.Rand) (SampleTableStats, error) {
+	stats := SampleTableStats{Table: table.String()}
+
+	targetDb := table.Schema
+	if targetDbName, exists := v.DatabaseRewrites[targetDb]; exists {
+		targetDb = targetDbName
+	}
+
+	targetTable := table.Name
+	if targetTableName, exists := v.TableRewrites[targetTable]; exists {
+		targetTable = targetTableName
+	}
+
+	pkColumn := table.GetPKColumn(0).Name
+	quotedPK := quoteField(pkColumn)
+
+	// Scanned as strings, as unsigned primary keys may not fit an int64.
+	var minPkValue, maxPkValue sql.NullString
+	query := fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", quotedPK, quotedPK, QuotedTableName(table))
+	err := v.SourceDB.QueryRow(query).Scan(&minPkValue, &maxPkValue)
+	if err != nil {
+		return stats, err
+	}
+
+	if !minPkValue.Valid {
+		return stats, nil
+	}
+
+	minPk, err := strconv.ParseUint(minPkValue.String, 10, 64)
+	if err != nil {
+		return stats, err
+	}
+
+	maxPk, err := strconv.ParseUint(maxPkValue.String, 10, 64)
+	if err != nil {
+		return stats, err
+	}
+
+	columns := withoutIgnoredColumns(table, table.Columns, v.IgnoredColumns)
+
+	compare := func(build func(sq.SelectBuilder) sq.SelectBuilder) error {
+		var sourceHashes, targetHashes map[uint64][]byte
+
+		sourceQuery, args, err := build(rowMd5Selector(columns, nil, pkColumn).From(QuotedTableName(table))).ToSql()
+		if err != nil {
+			return err
+		}
+
+		sourceHashes, err = queryHashes(v.SourceDB, sourceQuery, args)
+		if err != nil {
+			return err
+		}
+
+		targetQuery, args, err := build(rowMd5Selector(columns, nil, pkColumn).From(QuotedTableNameFromString(targetDb, targetTable))).ToSql()
+		if err != nil {
+			return err
+		}
+
+		targetHashes, err = queryHashes(v.TargetDB, targetQuery, args)
+		if err != nil {
+			return err
+		}
+
+		sampled := make(map[uint64]bool, len(sourceHashes))
+		for pk := range sourceHashes {
+			sampled[pk] = true
+		}
+		for pk := range targetHashes {
+			sampled[pk] = true
+		}
+
+		mismatchedPks := compareHashes(sourceHashes, targetHashes)
+		stats.SampledRows += len(sampled)
+		stats.MismatchedRows += len(mismatchedPks)
+
+		for _, pk := range mismatchedPks {
+			if len(stats.MismatchedPks) < 10 {
+				stats.MismatchedPks = append(stats.MismatchedPks, pk)
+			}
+		}
+
+		return nil
+	}
+
+	if v.SamplePercentage > 0 {
+		ranges := SamplePrimaryKeyRanges(minPk, maxPk, v.RangeSize, v.SamplePercentage, rnd)
+		for _, pkRange := range ranges {
+			err = compare(func(query sq.SelectBuilder) sq.SelectBuilder {
+				return query.Where(sq.GtOrEq{quotedPK: pkRange.Start}).Where(sq.LtOrEq{quotedPK: pkRange.End})
+			})
+			if err != nil {
+				return stats, err
+			}
+		}
+
+		return stats, nil
+	}
+
+	pks, err := v.sampleRowPks(table, minPk, maxPk, rnd)
+	if err != nil {
+		return stats, err
+	}
+
+	if len(pks) == 0 {
+		return stats, nil
+	}
+
+	err = compare(func(query sq.SelectBuilder) sq.SelectBuilder {
+		return query.Where(sq.Eq{quotedPK: pks})
+	})
+	return stats, err
+}
+
+// Picks up to RowsPerTable distinct rows of the source, as the first row at
+// or after random primary keys. The rows after large gaps of primary keys
+// are more likely to be picked.
+func (v *SamplingVerifier) sampleRowPks(table *schema.Table, minPk, maxPk uint64, rnd *rand.Rand) ([]uint64, error) {
+	quotedPK := quoteField(table.GetPKColumn(0).Name)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s >= ? ORDER BY %s LIMIT 1", quotedPK, QuotedTableName(table), quotedPK, quotedPK)
+
+	stmt, err := v.SourceDB.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	picked := make(map[uint64]bool, v.RowsPerTable)
+	for attempt := 0; attempt < 2*v.RowsPerTable && len(picked) < v.RowsPerTable; attempt++ {
+		offset := rnd.Uint64()
+		if maxPk-minPk < math.MaxUint64 {
+			offset %= maxPk - minPk + 1
+		}
+		start := minPk + offset
+
+		var pk uint64
+		err = stmt.QueryRow(start).Scan(&pk)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		picked[pk] = true
+	}
+
+	pks := make([]uint64, 0, len(picked))
+	for pk := range picked {
+		pks = append(pks, pk)
+	}
+	sort.Slice(pks, func(i, j int) bool { return pks[i] < pks[j] })
+
+	return pks, nil
+}
+
+// Splits the primary keys from minPk to maxPk into ranges of rangeSize
+// primary keys and picks the given percentage of them at random, at least
+// one. The ranges are returned in order.
+func SamplePrimaryKeyRanges(minPk, maxPk, rangeSize uint64, percentage float64, rnd *rand.Rand) []PrimaryKeyRange {
+	if maxPk < minPk || rangeSize == 0 {
+		return nil
+	}
+
+	rangeCount := (maxPk-minPk)/rangeSize + 1
+	sampleCount := uint64(math.Ceil(float64(rangeCount) * percentage / 100))
+	if sampleCount > rangeCount {
+		sampleCount = rangeCount
+	}
+	if sampleCount == 0 {
+		sampleCount = 1
+	}
+
+	// Floyd's algorithm picks distinct indexes without materializing all
+	// of them, as huge tables have millions of ranges.
+	picked := make(map[uint64]bool, sampleCount)
+	for j := rangeCount - sampleCount; j < rangeCount; j++ {
+		index := uint64(rnd.Int63n(int64(j + 1)))
+		if picked[index] {
+			index = j
+		}
+		picked[index] = true
+	}
+
+	indexes := make([]uint64, 0, len(picked))
+	for index := range picked {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	ranges := make([]PrimaryKeyRange, len(indexes))
+	for i, index := range indexes {
+		ranges[i] = PrimaryKeyRange{
+			Start: minPk + index*rangeSize,
+			End:   minPk + (index+1)*rangeSize - 1,
+		}
+	}
+
+	return ranges
+}
+
+func (v *SamplingVerifier) StartInBackground() error {
+	if v.SourceDB == nil || v.TargetDB == nil {
+		return errors.New("must specify source and target db")
+	}
+
+	if v.started != nil && v.started.Get() && !v.verificationResultAndStatus.IsDone() {
+		return errors.New("verification is on going")
+	}
+
+	v.started = new(AtomicBoolean)
+	v.started.Set(true)
+
+	v.verificationResultAndStatus = VerificationResultAndStatus{
+		StartTime: time.Now(),
+		DoneTime:  time.Time{},
+	}
+	v.verificationErr = nil
+	v.logger = logrus.WithField("tag", "sampling_verifier")
+	v.wg = &sync.WaitGroup{}
+
+	v.logger.Info("sampling verification started")
+
+	v.wg.Add(1)
+	go func() {
+		defer v.wg.Done()
+
+		v.verificationResultAndStatus.VerificationResult, v.verificationErr = v.Verify()
+		v.verificationResultAndStatus.DoneTime = time.Now()
+		v.started.Set(false)
+	}()
+
+	return nil
+}
+
+func (v *SamplingVerifier) Wait() {
+	v.wg.Wait()
+}
+
+func (v *SamplingVerifier) Result() (VerificationResultAndStatus, error) {
+	return v.verificationResultAndStatus, v.verificationErr
+}
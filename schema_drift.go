@@ -0,0 +1,239 @@
+package ghostferry
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/sirupsen/logrus"
+)
+
+var autoIncrementRegexp = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+// The definition of a table as returned by SHOW CREATE TABLE, without the
+// AUTO_INCREMENT counter, which changes with every insert.
+type tableDefinition struct {
+	CreateTable string
+	Fingerprint string
+}
+
+func newTableDefinition(createTable string) tableDefinition {
+	createTable = autoIncrementRegexp.ReplaceAllString(createTable, "")
+	sum := sha256.Sum256([]byte(createTable))
+
+	return tableDefinition{
+		CreateTable: createTable,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+}
+
+// SchemaDriftDetector fingerprints the definitions of the ferried tables on
+// the source and the target when the run starts, and checks them again
+// periodically and at the cutover. The rows and binlog events are written
+// with the schemas loaded at the start, so a table altered during the run
+// could be silently corrupted.
+type SchemaDriftDetector struct {
+	SourceDB         *sql.DB
+	TargetDB         *sql.DB
+	Tables           []*schema.Table
+	DatabaseRewrites map[string]string
+	TableRewrites    map[string]string
+
+	Interval time.Duration
+
+	logger *logrus.Entry
+
+	mutex        sync.Mutex
+	alterMutex   sync.Mutex
+	fingerprints map[string]tableDefinition
+}
+
+func (d *SchemaDriftDetector) Initialize() {
+	d.logger = logrus.WithField("tag", "schema_drift_detector")
+}
+
+// Records the current definitions of the tables, against which the later
+// checks are made.
+func (d *SchemaDriftDetector) Capture() error {
+	definitions, err := d.readDefinitions()
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.fingerprints = definitions
+	d.logger.WithField("tables", len(d.Tables)).Info("captured table fingerprints")
+	return nil
+}
+
+// Runs alter, which changes the definitions of target tables, such as to add
+// back their deferred indexes, and records the changed definitions of the
+// target tables. The checks wait for it, so they do not report the change.
+func (d *SchemaDriftDetector) AlterTargets(alter func() error) error {
+	d.alterMutex.Lock()
+	defer d.alterMutex.Unlock()
+
+	err := alter()
+	if err != nil {
+		return err
+	}
+
+	definitions, err := d.readDefinitions()
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for name, definition := range definitions {
+		if strings.HasPrefix(name, "target ") {
+			d.fingerprints[name] = definition
+		}
+	}
+	return nil
+}
+
+// Returns an error with the diff of every table whose definition changed
+// since Capture.
+func (d *SchemaDriftDetector) Check() error {
+	d.alterMutex.Lock()
+	defer d.alterMutex.Unlock()
+
+	definitions, err := d.readDefinitions()
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.fingerprints == nil {
+		return fmt.Errorf("table fingerprints were not captured")
+	}
+
+	names := make([]string, 0, len(d.fingerprints))
+	for name := range d.fingerprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var drifts []string
+	for _, name := range names {
+		before := d.fingerprints[name]
+		after := definitions[name]
+		if before.Fingerprint == after.Fingerprint {
+			continue
+		}
+
+		drifts = append(drifts, fmt.Sprintf("%s changed:\n%s", name, diffLines(before.CreateTable, after.CreateTable)))
+	}
+
+	if len(drifts) > 0 {
+		metrics.Count("SchemaDrift", int64(len(drifts)), nil, 1.0)
+		return NewClassifiedError(ErrorClassSchemaMismatch, fmt.Errorf("schema changed during the run:\n%s", strings.Join(drifts, "\n")))
+	}
+
+	return nil
+}
+
+func (d *SchemaDriftDetector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := d.Check()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Reads the definitions of the tables on both sides, keyed by the side and
+// the quoted table name.
+func (d *SchemaDriftDetector) readDefinitions() (map[string]tableDefinition, error) {
+	definitions := make(map[string]tableDefinition, 2*len(d.Tables))
+
+	for _, table := range d.Tables {
+		targetDb := table.Schema
+		if rewrittenName, exists := d.DatabaseRewrites[targetDb]; exists {
+			targetDb = rewrittenName
+		}
+
+		targetTable := table.Name
+		if rewrittenName, exists := d.TableRewrites[targetTable]; exists {
+			targetTable = rewrittenName
+		}
+
+		sides := []struct {
+			name     string
+			db       *sql.DB
+			database string
+			table    string
+		}{
+			{"source", d.SourceDB, table.Schema, table.Name},
+			{"target", d.TargetDB, targetDb, targetTable},
+		}
+
+		for _, side := range sides {
+			quotedTable := QuotedTableNameFromString(side.database, side.table)
+
+			var name, createTable string
+			err := side.db.QueryRow(fmt.Sprintf("SHOW CREATE TABLE %s", quotedTable)).Scan(&name, &createTable)
+			if err != nil {
+				return nil, fmt.Errorf("failed to show create table %s on %s: %v", quotedTable, side.name, err)
+			}
+
+			definitions[side.name+" "+quotedTable] = newTableDefinition(createTable)
+		}
+	}
+
+	return definitions, nil
+}
+
+// A line diff of two table definitions, in which the removed lines are
+// prefixed with - and the added lines with +.
+func diffLines(before, after string) string {
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+
+	beforeSet := make(map[string]bool, len(beforeLines))
+	for _, line := range beforeLines {
+		beforeSet[line] = true
+	}
+
+	afterSet := make(map[string]bool, len(afterLines))
+	for _, line := range afterLines {
+		afterSet[line] = true
+	}
+
+	var diff []string
+	for _, line := range beforeLines {
+		if !afterSet[line] {
+			diff = append(diff, "- "+strings.TrimSpace(line))
+		}
+	}
+
+	for _, line := range afterLines {
+		if !beforeSet[line] {
+			diff = append(diff, "+ "+strings.TrimSpace(line))
+		}
+	}
+
+	return strings.Join(diff, "\n")
+}
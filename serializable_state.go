@@ -0,0 +1,238 @@
+package ghostferry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// The version of the serialized state format written by this binary.
+//
+// This must be bumped whenever SerializableState changes in a way that an
+// older binary cannot understand. A migration from the previous version must
+// then be registered in stateMigrations so dumps taken by older binaries can
+// still be resumed after an upgrade. Older binaries reject the dumps of newer
+// versions, so the fields they would silently drop must come with a bump.
+//
+// Version 3 added the FullRowMatchTablesCopiedAt, the partition cursors, the
+// PausedComponents and the DeferredIndexes.
+const CurrentStateVersion = 3
+
+// The state dumped before version 2 was an unversioned JSON object without
+// a checksum. Dumps without a StateVersion are assumed to be of this version.
+const legacyStateVersion = 1
+
+// The state of a ferry run that is required to resume it at a later time.
+type SerializableState struct {
+	GhostferryVersion         string
+	LastSuccessfulBinlogPos   mysql.Position
+	LastSuccessfulPrimaryKeys map[string]uint64
+	CompletedTables           map[string]bool
+
+	// The progress of the IterativeVerifier of the ferry, if any. Older
+	// binaries ignore it and restart the verification.
+	IterativeVerifierState *IterativeVerifierState `json:",omitempty"`
+
+	// The binlog positions at which the tables without a key were copied,
+	// see IsFullRowMatchTable. Since version 3, as a resumed run would
+	// otherwise skip the binlog events of these tables.
+	FullRowMatchTablesCopiedAt map[string]mysql.Position `json:",omitempty"`
+
+	// The progress of the partitions of the tables iterated by partition
+	// and not completed yet, keyed by table and then by partition, see
+	// Config.DataIterationByPartition. Since version 3, as a resumed run
+	// would otherwise copy these tables again from their
+	// LastSuccessfulPrimaryKeys.
+	LastSuccessfulPartitionPrimaryKeys map[string]map[string]uint64 `json:",omitempty"`
+	CompletedPartitions                map[string]map[string]bool   `json:",omitempty"`
+
+	// The components paused with the ComponentPauser, which stay paused when
+	// the run is resumed. Since version 3, as a resumed run would otherwise
+	// unpause them.
+	PausedComponents []string `json:",omitempty"`
+
+	// The times of the events of the binlog positions streamed by the
+	// previous runs, see BinlogTimeline. Older binaries ignore it.
+	BinlogTimeline []BinlogTimelineEntry `json:",omitempty"`
+
+	// The secondary indexes dropped from the target tables and not added
+	// back yet, see Config.DeferSecondaryIndexes. Since version 3, as an
+	// older binary would leave the tables without them.
+	DeferredIndexes []DeferredIndex `json:",omitempty"`
+
+	// The Config.FerryId of the run that dumped the state, so the runs
+	// resuming each other can be traced back. Older binaries ignore it.
+	FerryId string `json:",omitempty"`
+}
+
+// The wire format of a state dump. The state itself is kept as raw JSON so
+// it can be checksummed and migrated before being decoded.
+type StateDump struct {
+	StateVersion int
+	Checksum     uint32
+	State        json.RawMessage
+}
+
+// Each migration upgrades the raw JSON state from the version it is keyed by
+// to the next version.
+var stateMigrations = map[int]func(json.RawMessage) (json.RawMessage, error){
+	legacyStateVersion: migrateStateFromLegacy,
+	2:                  migrateStateFromV2,
+}
+
+// The state as of version 2. The migrations decode and produce the fields of
+// the versions they migrate from and to, rather than SerializableState, so
+// they keep working as it changes.
+type stateV2 struct {
+	GhostferryVersion         string
+	LastSuccessfulBinlogPos   mysql.Position
+	LastSuccessfulPrimaryKeys map[string]uint64
+	CompletedTables           map[string]bool
+
+	// Added without a version bump, as the binaries not knowing it only
+	// restart the verification.
+	IterativeVerifierState *IterativeVerifierState `json:",omitempty"`
+}
+
+func (s *SerializableState) Dump() ([]byte, error) {
+	stateBytes, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	dump := StateDump{
+		StateVersion: CurrentStateVersion,
+		Checksum:     crc32.ChecksumIEEE(stateBytes),
+		State:        stateBytes,
+	}
+
+	return json.MarshalIndent(dump, "", "  ")
+}
+
+// Parses a state dump produced by this or an older version of Ghostferry.
+//
+// An error is returned if the checksum does not match the state or if the
+// dump was produced by a newer version of Ghostferry, as resuming from such
+// a state is not safe.
+func ParseStateDump(data []byte) (*SerializableState, error) {
+	dump, err := parseStateDumpEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rawState := dump.State
+	for version := dump.StateVersion; version < CurrentStateVersion; version++ {
+		migrate, exists := stateMigrations[version]
+		if !exists {
+			return nil, fmt.Errorf("no migration for state dump version %d", version)
+		}
+
+		rawState, err = migrate(rawState)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate state dump from version %d: %v", version, err)
+		}
+	}
+
+	state := &SerializableState{}
+	err = json.Unmarshal(rawState, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state: %v", err)
+	}
+
+	// The binlog streaming cannot resume without a position, which every
+	// state dumped by Ghostferry has.
+	if state.LastSuccessfulBinlogPos.Name == "" {
+		return nil, fmt.Errorf("state has no binlog position to resume from")
+	}
+
+	if state.LastSuccessfulPrimaryKeys == nil {
+		state.LastSuccessfulPrimaryKeys = make(map[string]uint64)
+	}
+
+	if state.CompletedTables == nil {
+		state.CompletedTables = make(map[string]bool)
+	}
+
+	return state, nil
+}
+
+func parseStateDumpEnvelope(data []byte) (*StateDump, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state dump, it may be truncated: %v", err)
+	}
+
+	if _, versioned := fields["StateVersion"]; !versioned {
+		return &StateDump{
+			StateVersion: legacyStateVersion,
+			State:        json.RawMessage(data),
+		}, nil
+	}
+
+	dump := &StateDump{}
+	err = json.Unmarshal(data, dump)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state dump: %v", err)
+	}
+
+	// Newer versions may checksum the state differently, so the version has
+	// to be checked first.
+	if dump.StateVersion > CurrentStateVersion {
+		return nil, fmt.Errorf("state dump version %d is newer than the supported version %d", dump.StateVersion, CurrentStateVersion)
+	}
+
+	// The state may have been reformatted (for example indented) since the
+	// checksum was computed over its compact form.
+	compacted := &bytes.Buffer{}
+	err = json.Compact(compacted, dump.State)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state: %v", err)
+	}
+
+	checksum := crc32.ChecksumIEEE(compacted.Bytes())
+	if checksum != dump.Checksum {
+		return nil, fmt.Errorf("state dump checksum mismatch: expected %d, got %d", dump.Checksum, checksum)
+	}
+
+	dump.State = compacted.Bytes()
+	return dump, nil
+}
+
+// The legacy dump only contained the binlog position, the last successful
+// primary keys and the completed tables, all of which map directly onto
+// version 2. The version of Ghostferry that produced it is unknown.
+func migrateStateFromLegacy(rawState json.RawMessage) (json.RawMessage, error) {
+	var legacy struct {
+		LastSuccessfulBinlogPos   mysql.Position
+		LastSuccessfulPrimaryKeys map[string]uint64
+		CompletedTables           map[string]bool
+	}
+
+	err := json.Unmarshal(rawState, &legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(stateV2{
+		GhostferryVersion:         "",
+		LastSuccessfulBinlogPos:   legacy.LastSuccessfulBinlogPos,
+		LastSuccessfulPrimaryKeys: legacy.LastSuccessfulPrimaryKeys,
+		CompletedTables:           legacy.CompletedTables,
+	})
+}
+
+// Version 3 only added fields, which a run dumping a version 2 state did not
+// have anything to put in: the fields of version 2 carry over as is.
+func migrateStateFromV2(rawState json.RawMessage) (json.RawMessage, error) {
+	var state stateV2
+	err := json.Unmarshal(rawState, &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(state)
+}
@@ -0,0 +1,181 @@
+package ghostferry
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultSessionSqlMode  = "STRICT_ALL_TABLES,NO_BACKSLASH_ESCAPES"
+	defaultSessionTimeZone = "+00:00"
+)
+
+// SessionConfig configures the session of every connection to a database,
+// so the writes to the target behave the same regardless of the defaults of
+// the server. The settings are applied whenever a connection is established.
+type SessionConfig struct {
+	// The sql_mode of the sessions. The values are written as SQL literals
+	// escaped without backslashes, so it must include NO_BACKSLASH_ESCAPES.
+	//
+	// Optional: defaults to STRICT_ALL_TABLES,NO_BACKSLASH_ESCAPES.
+	SqlMode string
+
+	// The time_zone of the sessions. The TIMESTAMP values are copied as read,
+	// so the source and the target must use the same time zone.
+	//
+	// Optional: defaults to +00:00.
+	TimeZone string
+
+	// Optional: defaults to the foreign_key_checks of the server.
+	ForeignKeyChecks *bool
+
+	// Optional: defaults to the unique_checks of the server.
+	UniqueChecks *bool
+
+	// The innodb_lock_wait_timeout of the sessions, in seconds.
+	//
+	// Optional: defaults to the innodb_lock_wait_timeout of the server.
+	InnodbLockWaitTimeout int
+
+	// The statements executed, in order, after the settings above whenever
+	// a connection is established, such as "SET SESSION
+	// transaction_isolation = 'READ-COMMITTED'".
+	//
+	// Optional: defaults to none.
+	Statements []string
+}
+
+func (c *SessionConfig) Validate() error {
+	noBackslashEscapes := false
+	for _, mode := range strings.Split(c.sqlMode(), ",") {
+		if strings.ToUpper(strings.TrimSpace(mode)) == "NO_BACKSLASH_ESCAPES" {
+			noBackslashEscapes = true
+		}
+	}
+
+	if !noBackslashEscapes {
+		return fmt.Errorf("SqlMode must include NO_BACKSLASH_ESCAPES")
+	}
+
+	if c.InnodbLockWaitTimeout < 0 {
+		return fmt.Errorf("InnodbLockWaitTimeout must be positive")
+	}
+
+	for _, statement := range c.Statements {
+		if strings.TrimSpace(statement) == "" {
+			return fmt.Errorf("Statements cannot include an empty statement")
+		}
+	}
+
+	return nil
+}
+
+func (c *SessionConfig) sqlMode() string {
+	if c == nil || c.SqlMode == "" {
+		return defaultSessionSqlMode
+	}
+	return c.SqlMode
+}
+
+func (c *SessionConfig) timeZone() string {
+	if c == nil || c.TimeZone == "" {
+		return defaultSessionTimeZone
+	}
+	return c.TimeZone
+}
+
+// Returns the session variables set through the params of the connection,
+// other than sql_mode and time_zone, which are asserted by
+// DatabaseConfig.Validate.
+func (c *SessionConfig) params() map[string]string {
+	params := make(map[string]string)
+	if c == nil {
+		return params
+	}
+
+	if c.ForeignKeyChecks != nil {
+		params["foreign_key_checks"] = boolParam(*c.ForeignKeyChecks)
+	}
+
+	if c.UniqueChecks != nil {
+		params["unique_checks"] = boolParam(*c.UniqueChecks)
+	}
+
+	if c.InnodbLockWaitTimeout > 0 {
+		params["innodb_lock_wait_timeout"] = strconv.Itoa(c.InnodbLockWaitTimeout)
+	}
+
+	return params
+}
+
+func boolParam(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+func quoteParam(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// sessionConnector opens the connections of a database and executes the
+// Statements of its SessionConfig on each of them.
+type sessionConnector struct {
+	dsn        func() (string, error)
+	statements []string
+}
+
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := c.dsn()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.Driver().Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.Execer)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("connection does not support executing statements")
+	}
+
+	for _, statement := range c.statements {
+		_, err = execer.Exec(statement, nil)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to execute session statement %q: %v", statement, err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *sessionConnector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
+
+func staticDSN(dsn string) func() (string, error) {
+	return func() (string, error) {
+		return dsn, nil
+	}
+}
+
+// The session is optional, as the connector also builds the DSN of the
+// databases with Credentials.
+func openSessionDB(dsn func() (string, error), session *SessionConfig) *sql.DB {
+	connector := &sessionConnector{dsn: dsn}
+	if session != nil {
+		connector.statements = session.Statements
+	}
+	return sql.OpenDB(connector)
+}
@@ -39,13 +39,24 @@ func main() {
 	config := parseConfig()
 
 	fmt.Printf("ghostferry-sharding built with ghostferry %s\n", ghostferry.VersionString)
-	fmt.Printf("will move tenant %s=%d\n", config.ShardingKey, config.ShardingValue)
+	if len(config.ShardingValues) > 0 {
+		fmt.Printf("will move tenants %s IN %v\n", config.ShardingKey, config.ShardingValues)
+	} else {
+		fmt.Printf("will move tenant %s=%d\n", config.ShardingKey, config.ShardingValue)
+	}
 
 	err := sharding.InitializeMetrics("sharding", config)
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to initialize metrics: %v", err))
 	}
 
+	if config.Tracing != nil {
+		_, err = ghostferry.InitializeTracing("ghostferry-sharding", config.Tracing)
+		if err != nil {
+			errorAndExit(fmt.Sprintf("failed to initialize tracing: %v", err))
+		}
+	}
+
 	ferry, err := sharding.NewFerry(config)
 	if err != nil {
 		errorAndExit(fmt.Sprintf("failed to create ferry: %v", err))
@@ -63,6 +74,7 @@ func main() {
 
 	ferry.Run()
 
+	ghostferry.StopAndFlushTracing()
 	sharding.StopAndFlushMetrics()
 }
 
@@ -114,8 +126,8 @@ func parseConfig() *sharding.Config {
 		errorAndExit("missing ShardingKey config")
 	}
 
-	if config.ShardingValue == -1 {
-		errorAndExit("missing ShardingValue config")
+	if config.ShardingValue == -1 && len(config.ShardingValues) == 0 {
+		errorAndExit("missing ShardingValue or ShardingValues config")
 	}
 
 	if config.SourceDB == "" {
@@ -126,6 +138,10 @@ func parseConfig() *sharding.Config {
 		errorAndExit("missing TargetDB config")
 	}
 
+	if config.MaxCutoverDowntime != "" && config.CutoverRetryInterval == "" {
+		errorAndExit("CutoverRetryInterval must be set with MaxCutoverDowntime, as the cutover cannot be retried from a control server")
+	}
+
 	if config.StatsDAddress == "" {
 		config.StatsDAddress = "127.0.0.1:8125"
 	}
@@ -4,6 +4,19 @@ import (
 	"github.com/Shopify/ghostferry"
 )
 
+type ReplicaConfig struct {
+	Connection                    ghostferry.DatabaseConfig
+	ReplicatedMasterPositionQuery string
+}
+
+// The replicas behind a ProxySQL instance, resolved from the servers of a
+// hostgroup that are not OFFLINE_HARD. The replicas are connected to with the Source config, of which
+// the host and port are replaced by those of each server.
+type ProxySQLReplicasConfig struct {
+	Admin     ghostferry.DatabaseConfig
+	HostGroup int
+}
+
 type Config struct {
 	*ghostferry.Config
 
@@ -12,11 +25,46 @@ type Config struct {
 	SourceDB      string
 	TargetDB      string
 
+	// If set, the rows of all these sharding values are moved together,
+	// instead of the rows of the ShardingValue.
+	ShardingValues []int64
+
+	// Apply the binlog events of the JoinedTables whose rows are referenced
+	// by a join table row of the moved sharding values, looked up on the
+	// source for each event. The joined tables are still copied again at the
+	// cutover, but there is then less to copy.
+	ResolveJoinedTableEvents bool
+
 	SourceReplicationMaster       ghostferry.DatabaseConfig
 	ReplicatedMasterPositionQuery string
 	RunFerryFromReplica           bool
 
-	StatsDAddress string
+	// Wait for the replicas by comparing their gtid_executed to the one of
+	// the SourceReplicationMaster instead of using the
+	// ReplicatedMasterPositionQuery, for topologies relying on GTIDs.
+	WaitForReplicasUsingGTID bool
+
+	// Other replicas of the SourceReplicationMaster that must catch up
+	// before the cutover, when RunFerryFromReplica is set.
+	AdditionalReplicas []ReplicaConfig
+
+	// Replicas of the SourceReplicationMaster behind a ProxySQL instance
+	// that must catch up before the cutover, when RunFerryFromReplica is
+	// set. Their replicated master position is read with the
+	// ReplicatedMasterPositionQuery, unless WaitForReplicasUsingGTID is set.
+	ProxySQLReplicas *ProxySQLReplicasConfig
+
+	// How many of the replicas, including the source, must have caught up
+	// before the cutover. The cutover fails if the ProxySQLReplicas resolve
+	// to too few replicas to reach it. Defaults to all of them.
+	ReplicaQuorum int
+
+	// Runs the whole cutover, including draining the binlog and the final
+	// verification, without calling the CutoverLock and CutoverUnlock
+	// callbacks, to measure how long the actual cutover would lock the
+	// source. The tenant is left on the source.
+	CutoverRehearsal bool
+
 	CutoverLock   HTTPCallback
 	CutoverUnlock HTTPCallback
 	ErrorCallback HTTPCallback
@@ -30,4 +78,9 @@ type Config struct {
 	MaxExpectedVerifierDowntime  string
 
 	Throttle *ghostferry.LagThrottlerConfig
+
+	// Throttle the reads from the source and the writes to the target
+	// independently. Each defaults to Throttle if not set.
+	ReadThrottle  *ghostferry.LagThrottlerConfig
+	WriteThrottle *ghostferry.LagThrottlerConfig
 }
@@ -20,6 +20,7 @@ func (this *ShardingErrorHandler) Fatal(from string, err error) {
 	errorData := make(map[string]string)
 	errorData["ErrFrom"] = from
 	errorData["ErrMessage"] = err.Error()
+	errorData["ErrClass"] = string(ghostferry.ClassifyError(err))
 
 	errorDataBytes, jsonErr := json.MarshalIndent(errorData, "", "  ")
 	if jsonErr != nil {
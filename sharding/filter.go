@@ -1,6 +1,7 @@
 package sharding
 
 import (
+	"database/sql"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -18,11 +19,22 @@ type JoinTable struct {
 }
 
 type ShardedCopyFilter struct {
-	ShardingKey      string
-	ShardingValue    interface{}
+	ShardingKey   string
+	ShardingValue interface{}
+
+	// If set, the rows of all these sharding values are copied instead of
+	// the rows of the ShardingValue.
+	ShardingValues []interface{}
+
 	JoinedTables     map[string][]JoinTable
 	PrimaryKeyTables map[string]struct{}
 
+	// If set, the binlog events of the joined tables are applied if the row
+	// is referenced by a row of one of its join tables for the sharding
+	// values, which is looked up on this database. Otherwise they are
+	// ignored, and the joined tables must be copied again at the cutover.
+	SourceDB *sql.DB
+
 	missingShardingKeyIndexLogged sync.Map
 }
 
@@ -39,9 +51,10 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *schema.Table, l
 		//
 		// It is necessary to use two WHERE conditions on quotedPK so the second batch will be empty.
 		// No LIMIT clause is necessary since at most one row is present.
+		condition, args := f.shardingValueCondition(quotedPK)
 		return sq.Select(columns...).
-			From(quotedTable + " USE INDEX (PRIMARY)").
-			Where(sq.Eq{quotedPK: f.ShardingValue}).
+			From(quotedTable+" USE INDEX (PRIMARY)").
+			Where(condition, args...).
 			Where(sq.Gt{quotedPK: lastPk}), nil
 	}
 
@@ -62,13 +75,14 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *schema.Table, l
 		//
 		// i.e. load the primary keys first, then load the rest of the columns.
 
+		condition, args := f.shardingValueCondition(quotedShardingKey)
 		selectPrimaryKeys := "SELECT " + quotedPK + " FROM " + quotedTable + " " + f.shardingKeyIndexHint(table) +
-			" WHERE " + quotedShardingKey + " = ? AND " + quotedPK + " > ?" +
+			" WHERE " + condition + " AND " + quotedPK + " > ?" +
 			" ORDER BY " + quotedPK + " LIMIT " + strconv.Itoa(int(batchSize))
 
 		return sq.Select(columns...).
 			From(quotedTable).
-			Join("("+selectPrimaryKeys+") AS `batch` USING("+quotedPK+")", f.ShardingValue, lastPk), nil
+			Join("("+selectPrimaryKeys+") AS `batch` USING("+quotedPK+")", append(args, lastPk)...), nil
 	}
 
 	// This is a "joined table". It is the only supported type of table that
@@ -101,10 +115,11 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *schema.Table, l
 	var args []interface{}
 
 	for _, joinTable := range joinTables {
-		pattern := "SELECT `%s` AS sharding_join_alias FROM `%s`.`%s` WHERE `%s` = ? AND `%s` > ?"
-		sql := fmt.Sprintf(pattern, joinTable.JoinColumn, table.Schema, joinTable.TableName, f.ShardingKey, joinTable.JoinColumn)
+		shardingCondition, shardingArgs := f.shardingValueCondition("`" + f.ShardingKey + "`")
+		pattern := "SELECT `%s` AS sharding_join_alias FROM `%s`.`%s` WHERE %s AND `%s` > ?"
+		sql := fmt.Sprintf(pattern, joinTable.JoinColumn, table.Schema, joinTable.TableName, shardingCondition, joinTable.JoinColumn)
 		clauses = append(clauses, sql)
-		args = append(args, f.ShardingValue, lastPk)
+		args = append(append(args, shardingArgs...), lastPk)
 	}
 
 	subquery := strings.Join(clauses, " UNION DISTINCT ")
@@ -118,6 +133,34 @@ func (f *ShardedCopyFilter) BuildSelect(columns []string, table *schema.Table, l
 		OrderBy(quotedPK), nil // LIMIT comes from the subquery.
 }
 
+func (f *ShardedCopyFilter) shardingValues() []interface{} {
+	if len(f.ShardingValues) > 0 {
+		return f.ShardingValues
+	}
+	return []interface{}{f.ShardingValue}
+}
+
+// The condition selecting the rows of the sharding values by the quoted
+// column.
+func (f *ShardedCopyFilter) shardingValueCondition(quotedColumn string) (string, []interface{}) {
+	values := f.shardingValues()
+	if len(values) == 1 {
+		return quotedColumn + " = ?", values
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+	return quotedColumn + " IN (" + placeholders + ")", values
+}
+
+func (f *ShardedCopyFilter) isShardingValue(value int64) bool {
+	for _, shardingValue := range f.shardingValues() {
+		if shardingValue == interface{}(value) {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *ShardedCopyFilter) shardingKeyIndexHint(table *schema.Table) string {
 	if indexName := f.shardingKeyIndexName(table); indexName != "" {
 		return "USE INDEX (`" + indexName + "`)"
@@ -171,8 +214,8 @@ func (f *ShardedCopyFilter) ApplicableEvent(event ghostferry.DMLEvent) (bool, er
 				return false, fmt.Errorf("parsing new sharding key: %s", err)
 			}
 
-			oldEqual := oldExists && oldShardingValue == f.ShardingValue
-			newEqual := newExists && newShardingValue == f.ShardingValue
+			oldEqual := oldExists && f.isShardingValue(oldShardingValue)
+			newEqual := newExists && f.isShardingValue(newShardingValue)
 
 			if oldEqual != newEqual && oldExists && newExists {
 				// The value of the sharding key for a row was changed - this is unsafe.
@@ -183,6 +226,42 @@ func (f *ShardedCopyFilter) ApplicableEvent(event ghostferry.DMLEvent) (bool, er
 			return oldEqual || newEqual, nil
 		}
 	}
+
+	if joinTables, exists := f.JoinedTables[event.Table()]; exists && f.SourceDB != nil {
+		return f.isReferencedByJoinTables(event, joinTables)
+	}
+
+	return false, nil
+}
+
+// Whether the row of the event of a joined table is referenced by a row of
+// one of its join tables for the sharding values. The rows of the joined
+// tables are immutable, so the row is looked up as it is now.
+func (f *ShardedCopyFilter) isReferencedByJoinTables(event ghostferry.DMLEvent, joinTables []JoinTable) (bool, error) {
+	pk, err := event.PK()
+	if err != nil {
+		return false, err
+	}
+
+	for _, joinTable := range joinTables {
+		condition, args := f.shardingValueCondition("`" + f.ShardingKey + "`")
+		query := fmt.Sprintf(
+			"SELECT 1 FROM `%s`.`%s` WHERE %s AND `%s` = ? LIMIT 1",
+			event.Database(), joinTable.TableName, condition, joinTable.JoinColumn,
+		)
+
+		var referenced int
+		err := f.SourceDB.QueryRow(query, append(args, pk)...).Scan(&referenced)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("looking up join table %s: %v", joinTable.TableName, err)
+		}
+
+		return true, nil
+	}
+
 	return false, nil
 }
 
@@ -198,9 +277,21 @@ func (s *ShardedTableFilter) ApplicableDatabases(dbs []string) ([]string, error)
 	return []string{s.SourceShard}, nil
 }
 
+// Only the ignored tables can be rejected by name, as the other tables are
+// selected based on their columns.
+func (s *ShardedTableFilter) ApplicableTableNames(db string, tables []string) ([]string, error) {
+	applicable := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if !s.isIgnored(table) {
+			applicable = append(applicable, table)
+		}
+	}
+	return applicable, nil
+}
+
 func (s *ShardedTableFilter) ApplicableTables(tables []*schema.Table) (applicable []*schema.Table, err error) {
 	for _, table := range tables {
-		if s.isIgnored(table) {
+		if s.isIgnored(table.Name) {
 			continue
 		}
 
@@ -226,9 +317,9 @@ func (s *ShardedTableFilter) ApplicableTables(tables []*schema.Table) (applicabl
 	return
 }
 
-func (s *ShardedTableFilter) isIgnored(table *schema.Table) bool {
+func (s *ShardedTableFilter) isIgnored(table string) bool {
 	for _, re := range s.IgnoredTables {
-		if re.Match([]byte(table.Name)) {
+		if re.MatchString(table) {
 			return true
 		}
 	}
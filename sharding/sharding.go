@@ -12,11 +12,34 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// How long each step of a cutover rehearsal took, which is how long the
+// source would be locked during the actual cutover, not counting the lock and
+// unlock callbacks.
+type CutoverRehearsalReport struct {
+	DrainBinlog           time.Duration
+	DeltaCopyJoinedTables time.Duration
+	Verify                time.Duration
+	CopyPrimaryKeyTables  time.Duration
+	Total                 time.Duration
+
+	// The verification is expected to find discrepancies if the source was
+	// written to during the rehearsal.
+	DataCorrect         bool
+	VerificationMessage string
+}
+
 type ShardingFerry struct {
-	Ferry    *ghostferry.Ferry
+	Ferry *ghostferry.Ferry
+
+	// Set once a cutover rehearsal completes, see Config.CutoverRehearsal.
+	RehearsalReport *CutoverRehearsalReport
+
 	verifier *ghostferry.IterativeVerifier
 	config   *Config
 	logger   *logrus.Entry
+
+	// Config.WaitForReplicasUsingGTID, unless the master has no GTIDs.
+	waitForReplicasUsingGTID bool
 }
 
 func NewFerry(config *Config) (*ShardingFerry, error) {
@@ -24,10 +47,16 @@ func NewFerry(config *Config) (*ShardingFerry, error) {
 
 	config.DatabaseRewrites = map[string]string{config.SourceDB: config.TargetDB}
 
+	shardingValues := make([]interface{}, len(config.ShardingValues))
+	for i, value := range config.ShardingValues {
+		shardingValues[i] = value
+	}
+
 	config.CopyFilter = &ShardedCopyFilter{
-		ShardingKey:   config.ShardingKey,
-		ShardingValue: config.ShardingValue,
-		JoinedTables:  config.JoinedTables,
+		ShardingKey:    config.ShardingKey,
+		ShardingValue:  config.ShardingValue,
+		ShardingValues: shardingValues,
+		JoinedTables:   config.JoinedTables,
 	}
 
 	ignored, err := compileRegexps(config.IgnoredTables)
@@ -46,18 +75,31 @@ func NewFerry(config *Config) (*ShardingFerry, error) {
 		return nil, fmt.Errorf("failed to validate config: %v", err)
 	}
 
-	var throttler ghostferry.Throttler
+	// The cutover verifies and copies the tables with MySQL queries.
+	if config.TargetDialect != ghostferry.DialectMySQL {
+		return nil, fmt.Errorf("the sharding ferry only supports %s targets", ghostferry.DialectMySQL)
+	}
 
-	if config.Throttle != nil {
-		throttler, err = ghostferry.NewLagThrottler(config.Throttle)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create throttler: %v", err)
-		}
+	throttler, err := newLagThrottler(config.Throttle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create throttler: %v", err)
+	}
+
+	readThrottler, err := newLagThrottler(config.ReadThrottle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create read throttler: %v", err)
+	}
+
+	writeThrottler, err := newLagThrottler(config.WriteThrottle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create write throttler: %v", err)
 	}
 
 	ferry := &ghostferry.Ferry{
-		Config:    config.Config,
-		Throttler: throttler,
+		Config:         config.Config,
+		Throttler:      throttler,
+		ReadThrottler:  readThrottler,
+		WriteThrottler: writeThrottler,
 	}
 
 	logger := logrus.WithField("tag", "sharding")
@@ -78,7 +120,55 @@ func NewFerry(config *Config) (*ShardingFerry, error) {
 }
 
 func (r *ShardingFerry) Initialize() error {
-	return r.Ferry.Initialize()
+	err := r.Ferry.Initialize()
+	if err != nil {
+		return err
+	}
+
+	if r.config.ResolveJoinedTableEvents {
+		r.config.CopyFilter.(*ShardedCopyFilter).SourceDB = r.Ferry.SourceDB
+	}
+
+	return r.detectReplicaWaitFeatures()
+}
+
+// The replicas are only waited for at the cutover, so the GTIDs of the
+// master are checked beforehand. Without GTIDs, the replicas are compared
+// by position if the position queries are configured.
+func (r *ShardingFerry) detectReplicaWaitFeatures() error {
+	r.waitForReplicasUsingGTID = r.config.WaitForReplicasUsingGTID
+	if !r.config.RunFerryFromReplica || !r.config.WaitForReplicasUsingGTID {
+		return nil
+	}
+
+	masterDB, err := r.config.SourceReplicationMaster.SqlDB(r.logger)
+	if err != nil {
+		return err
+	}
+	defer masterDB.Close()
+
+	features, err := ghostferry.DetectServerFeatures(masterDB)
+	if err != nil {
+		return fmt.Errorf("SourceReplicationMaster: %v", err)
+	}
+
+	if features.GTIDEnabled() {
+		return nil
+	}
+
+	canUsePositions := r.config.ReplicatedMasterPositionQuery != ""
+	for _, replica := range r.config.AdditionalReplicas {
+		canUsePositions = canUsePositions && replica.ReplicatedMasterPositionQuery != ""
+	}
+
+	if !canUsePositions {
+		return fmt.Errorf("WaitForReplicasUsingGTID requires gtid_mode ON on the SourceReplicationMaster, or the ReplicatedMasterPositionQuery of every replica to fall back to")
+	}
+
+	r.waitForReplicasUsingGTID = false
+	r.Ferry.FeatureReport.Disable("WaitForReplicasUsingGTID", "gtid_mode is not ON on the SourceReplicationMaster, the replicas are compared by position")
+	r.logger.Warn("gtid_mode is not ON on the SourceReplicationMaster, waiting for the replicas by position")
+	return nil
 }
 
 func (r *ShardingFerry) newIterativeVerifier() (*ghostferry.IterativeVerifier, error) {
@@ -98,10 +188,11 @@ func (r *ShardingFerry) newIterativeVerifier() (*ghostferry.IterativeVerifier, e
 
 	return &ghostferry.IterativeVerifier{
 		CursorConfig: &ghostferry.CursorConfig{
-			DB:          r.Ferry.SourceDB,
-			BatchSize:   r.config.DataIterationBatchSize,
-			ReadRetries: r.config.DBReadRetries,
-			BuildSelect: r.config.CopyFilter.BuildSelect,
+			DB:              r.Ferry.SourceDB,
+			BatchSize:       r.config.DataIterationBatchSize,
+			ReadRetries:     r.config.DBReadRetries,
+			ReadRetryPolicy: r.config.RetryPolicies.Read,
+			BuildSelect:     r.config.CopyFilter.BuildSelect,
 		},
 
 		BinlogStreamer: r.Ferry.BinlogStreamer,
@@ -118,6 +209,12 @@ func (r *ShardingFerry) newIterativeVerifier() (*ghostferry.IterativeVerifier, e
 		IgnoredTables:       r.config.IgnoredVerificationTables,
 		Concurrency:         verifierConcurrency,
 		MaxExpectedDowntime: maxExpectedDowntime,
+		TableBatchSizes:     r.Ferry.DataIterator.TableBatchSizes,
+		Pauser:              r.Ferry.Pauser,
+		ReportPanic:         r.Ferry.ReportPanic,
+		NormalizeCollations: r.config.VerifierNormalizeCollations,
+		IgnoredColumns:      r.config.VerifierIgnoredColumns,
+		NumericComparison:   r.config.VerifierNumericComparison,
 	}, nil
 }
 
@@ -137,7 +234,17 @@ func (r *ShardingFerry) Start() error {
 		return err
 	}
 
-	return r.verifier.Initialize()
+	err = r.verifier.Initialize()
+	if err != nil {
+		return err
+	}
+
+	r.Ferry.QueueDepthMonitor.AddQueue(ghostferry.QueueReverify, r.verifier.ReverifyQueueDepth)
+	r.verifier.AddTableVerifiedListener(r.Ferry.NotifyTableVerified)
+	if r.Ferry.MemoryBudget != nil {
+		r.Ferry.MemoryBudget.AddSource(ghostferry.MemoryVerifier, r.verifier.ReverifyMemoryUsage)
+	}
+	return nil
 }
 
 func (r *ShardingFerry) Run() {
@@ -158,10 +265,6 @@ func (r *ShardingFerry) Run() {
 		}
 	})
 
-	ghostferry.WaitForThrottle(r.Ferry.Throttler)
-
-	r.Ferry.WaitUntilBinlogStreamerCatchesUp()
-
 	var err error
 
 	if r.config.RunFerryFromReplica {
@@ -173,57 +276,104 @@ func (r *ShardingFerry) Run() {
 	}
 
 	client := &http.Client{}
+	rehearsal := r.config.CutoverRehearsal
+	if rehearsal {
+		r.logger.Warn("rehearsing the cutover, the source will not be locked and the tenant will not be switched")
+	}
 
-	cutoverStart := time.Now()
-	// The callback must ensure that all in-flight transactions are complete and
-	// there will be no more writes to the database after it returns.
-	metrics.Measure("CutoverLock", nil, 1.0, func() {
-		err = r.config.CutoverLock.Post(client)
-	})
-	if err != nil {
-		r.logger.WithField("error", err).Errorf("locking failed, aborting run")
-		r.Ferry.ErrorHandler.Fatal("sharding", err)
+	unlock := func() error {
+		if rehearsal {
+			return nil
+		}
+
+		var err error
+		metrics.Measure("CutoverUnlock", nil, 1.0, func() {
+			err = r.config.CutoverUnlock.Post(client)
+		})
+		return err
 	}
 
-	r.Ferry.Throttler.SetDisabled(true)
+	var cutoverStart time.Time
+	var verificationResult ghostferry.VerificationResult
+	report := &CutoverRehearsalReport{}
+
+	for {
+		r.Ferry.WaitForThrottlers()
+
+		r.Ferry.WaitUntilBinlogStreamerCatchesUp()
+
+		cutoverStart = time.Now()
+		// The callback must ensure that all in-flight transactions are complete and
+		// there will be no more writes to the database after it returns.
+		if !rehearsal {
+			metrics.Measure("CutoverLock", nil, 1.0, func() {
+				err = r.config.CutoverLock.Post(client)
+			})
+			if err != nil {
+				r.logger.WithField("error", err).Errorf("locking failed, aborting run")
+				r.Ferry.ErrorHandler.Fatal("sharding", err)
+			}
+		}
 
-	r.Ferry.FlushBinlogAndStopStreaming()
-	copyWG.Wait()
+		r.Ferry.SetThrottlersDisabled(true)
+
+		err = r.Ferry.RunCutoverSteps(cutoverStart, unlock, r.cutoverSteps(copyWG, report, &verificationResult))
+		if _, aborted := err.(ghostferry.CutoverAbortedError); !aborted {
+			break
+		}
+
+		// The source was unlocked and the binlog is still tailed.
+		r.Ferry.SetThrottlersDisabled(false)
+		if !r.Ferry.WaitForCutoverRetry() {
+			copyWG.Wait()
+			return
+		}
+	}
 
-	metrics.Measure("deltaCopyJoinedTables", nil, 1.0, func() {
-		err = r.deltaCopyJoinedTables()
-	})
 	if err != nil {
-		r.logger.WithField("error", err).Errorf("failed to delta-copy joined tables after locking")
+		r.logger.WithField("error", err).Errorf("aborting the cutover failed, aborting run")
 		r.Ferry.ErrorHandler.Fatal("sharding", err)
 	}
 
-	var verificationResult ghostferry.VerificationResult
-	metrics.Measure("VerifyCutover", nil, 1.0, func() {
-		verificationResult, err = r.verifier.VerifyDuringCutover()
-	})
-	if err != nil {
-		r.logger.WithField("error", err).Errorf("verification encountered an error, aborting run")
-		r.Ferry.ErrorHandler.Fatal("iterative_verifier", err)
-	} else if !verificationResult.DataCorrect {
-		err = fmt.Errorf("verifier detected data discrepancy: %s", verificationResult.Message)
-		r.logger.WithField("error", err).Errorf("verification failed, aborting run")
-		r.Ferry.ErrorHandler.Fatal("iterative_verifier", err)
+	if r.config.MaxCutoverDowntime != "" {
+		// The binlog was drained without stopping the streaming, which is
+		// stopped now that the cutover can no longer be aborted.
+		r.Ferry.FlushBinlogAndStopStreaming()
+		copyWG.Wait()
 	}
 
+	report.DataCorrect = verificationResult.DataCorrect
+	report.VerificationMessage = verificationResult.Message
+
+	stepStart := time.Now()
 	metrics.Measure("CopyPrimaryKeyTables", nil, 1.0, func() {
 		err = r.copyPrimaryKeyTables()
 	})
+	report.CopyPrimaryKeyTables = time.Since(stepStart)
 	if err != nil {
 		r.logger.WithField("error", err).Errorf("copying primary key table failed")
 		r.Ferry.ErrorHandler.Fatal("sharding", err)
 	}
 
-	r.Ferry.Throttler.SetDisabled(false)
+	r.Ferry.SetThrottlersDisabled(false)
 
-	metrics.Measure("CutoverUnlock", nil, 1.0, func() {
-		err = r.config.CutoverUnlock.Post(client)
-	})
+	if rehearsal {
+		report.Total = time.Since(cutoverStart)
+		r.RehearsalReport = report
+
+		metrics.Timer("CutoverRehearsalTime", report.Total, nil, 1.0)
+		r.logger.WithFields(logrus.Fields{
+			"drain_binlog":             report.DrainBinlog,
+			"delta_copy_joined_tables": report.DeltaCopyJoinedTables,
+			"verify":                   report.Verify,
+			"copy_primary_key_tables":  report.CopyPrimaryKeyTables,
+			"total":                    report.Total,
+			"data_correct":             report.DataCorrect,
+		}).Info("cutover rehearsal complete, the source was left unlocked")
+		return
+	}
+
+	err = unlock()
 	if err != nil {
 		r.logger.WithField("error", err).Errorf("unlocking failed, aborting run")
 		r.Ferry.ErrorHandler.Fatal("sharding", err)
@@ -232,6 +382,75 @@ func (r *ShardingFerry) Run() {
 	metrics.Timer("CutoverTime", time.Since(cutoverStart), nil, 1.0)
 }
 
+// The steps of the cutover that must complete within MaxCutoverDowntime,
+// whose durations are recorded in the report. If MaxCutoverDowntime is set,
+// the binlog streaming is not stopped, so the cutover can be aborted.
+func (r *ShardingFerry) cutoverSteps(copyWG *sync.WaitGroup, report *CutoverRehearsalReport, verificationResult *ghostferry.VerificationResult) []ghostferry.CutoverStep {
+	drainBinlog := func() error {
+		r.Ferry.FlushBinlogAndStopStreaming()
+		copyWG.Wait()
+		return nil
+	}
+
+	if r.config.MaxCutoverDowntime != "" {
+		drainBinlog = func() error {
+			err := r.Ferry.DrainBinlog()
+			if err != nil {
+				r.logger.WithField("error", err).Errorf("failed to drain the binlog, aborting run")
+				r.Ferry.ErrorHandler.Fatal("sharding", err)
+			}
+			return nil
+		}
+	}
+
+	deltaCopyJoinedTables := func() error {
+		var err error
+		metrics.Measure("deltaCopyJoinedTables", nil, 1.0, func() {
+			err = r.deltaCopyJoinedTables()
+		})
+		if err != nil {
+			r.logger.WithField("error", err).Errorf("failed to delta-copy joined tables after locking")
+			r.Ferry.ErrorHandler.Fatal("sharding", err)
+		}
+		return nil
+	}
+
+	verify := func() error {
+		var err error
+		metrics.Measure("VerifyCutover", nil, 1.0, func() {
+			*verificationResult, err = r.verifier.VerifyDuringCutover()
+		})
+		if err != nil {
+			r.logger.WithField("error", err).Errorf("verification encountered an error, aborting run")
+			r.Ferry.ErrorHandler.Fatal("iterative_verifier", err)
+		} else if !verificationResult.DataCorrect && r.config.CutoverRehearsal {
+			// The source kept being written to, so the rows changed since the
+			// binlog was drained are expected to differ.
+			r.logger.WithField("message", verificationResult.Message).Warn("verification found discrepancies during the cutover rehearsal")
+		} else if !verificationResult.DataCorrect {
+			err = fmt.Errorf("verifier detected data discrepancy: %s", verificationResult.Message)
+			r.logger.WithField("error", err).Errorf("verification failed, aborting run")
+			r.Ferry.ErrorHandler.Fatal("iterative_verifier", err)
+		}
+		return nil
+	}
+
+	return []ghostferry.CutoverStep{
+		{Name: "draining the binlog", Run: timeCutoverStep(&report.DrainBinlog, drainBinlog)},
+		{Name: "the delta copy of the joined tables", Run: timeCutoverStep(&report.DeltaCopyJoinedTables, deltaCopyJoinedTables)},
+		{Name: "the verification", Run: timeCutoverStep(&report.Verify, verify)},
+	}
+}
+
+func timeCutoverStep(duration *time.Duration, step func() error) func() error {
+	return func() error {
+		start := time.Now()
+		err := step()
+		*duration = time.Since(start)
+		return err
+	}
+}
+
 func (r *ShardingFerry) deltaCopyJoinedTables() error {
 	tables := []*schema.Table{}
 
@@ -321,7 +540,7 @@ func compileRegexps(exps []string) ([]*regexp.Regexp, error) {
 
 func (r *ShardingFerry) sanityCheckReplicationConfig() error {
 	if r.config.RunFerryFromReplica {
-		if r.config.ReplicatedMasterPositionQuery == "" {
+		if r.config.ReplicatedMasterPositionQuery == "" && !r.config.WaitForReplicasUsingGTID {
 			return fmt.Errorf("must provide a query to get latest replicated master position in ReplicatedMasterPositionQuery")
 		}
 
@@ -333,6 +552,29 @@ func (r *ShardingFerry) sanityCheckReplicationConfig() error {
 		if masterConfigIsAReplica {
 			return fmt.Errorf("expected SourceReplicationMaster config to be the master's config but master is readonly")
 		}
+
+		for i, replica := range r.config.AdditionalReplicas {
+			if err := replica.Connection.Validate(); err != nil {
+				return fmt.Errorf("invalid connection for AdditionalReplicas[%d]: %v", i, err)
+			}
+
+			if replica.ReplicatedMasterPositionQuery == "" && !r.config.WaitForReplicasUsingGTID {
+				return fmt.Errorf("must provide a ReplicatedMasterPositionQuery for AdditionalReplicas[%d]", i)
+			}
+		}
+
+		if r.config.ProxySQLReplicas != nil && r.config.ProxySQLReplicas.Admin.Host == "" {
+			return fmt.Errorf("must provide the Admin connection of ProxySQLReplicas")
+		}
+
+		if r.config.ReplicaQuorum < 0 {
+			return fmt.Errorf("ReplicaQuorum must not be negative, got %d", r.config.ReplicaQuorum)
+		}
+
+		// The size of the ProxySQL hostgroup is only known at the cutover.
+		if r.config.ProxySQLReplicas == nil && r.config.ReplicaQuorum > len(r.config.AdditionalReplicas)+1 {
+			return fmt.Errorf("ReplicaQuorum must be between 0 and %d, got %d", len(r.config.AdditionalReplicas)+1, r.config.ReplicaQuorum)
+		}
 	} else {
 		sourceConfigIsAReplica, err := r.dbConfigIsForReplica(r.config.Source)
 		if err != nil {
@@ -352,12 +594,56 @@ func (r *ShardingFerry) initializeWaitUntilReplicaIsCaughtUpToMasterConnection()
 		return err
 	}
 
-	positionFetcher := ghostferry.ReplicatedMasterPositionViaCustomQuery{Query: r.config.ReplicatedMasterPositionQuery}
+	var positionFetcher ghostferry.ReplicatedMasterPositionFetcher
+	var gtidSetFetcher ghostferry.ReplicatedMasterGTIDSetFetcher
+	if r.waitForReplicasUsingGTID {
+		gtidSetFetcher = ghostferry.ReplicatedMasterGTIDSetViaGTIDExecuted{}
+	} else {
+		positionFetcher = ghostferry.ReplicatedMasterPositionViaCustomQuery{Query: r.config.ReplicatedMasterPositionQuery}
+	}
+
+	replicas := make([]ghostferry.Replica, len(r.config.AdditionalReplicas))
+	for i, replicaConfig := range r.config.AdditionalReplicas {
+		replicaDB, err := replicaConfig.Connection.SqlDB(r.logger)
+		if err != nil {
+			return err
+		}
+
+		replicas[i] = ghostferry.Replica{
+			Name:                           fmt.Sprintf("%s:%d", replicaConfig.Connection.Host, replicaConfig.Connection.Port),
+			DB:                             replicaDB,
+			ReplicatedMasterGTIDSetFetcher: gtidSetFetcher,
+		}
+		if !r.waitForReplicasUsingGTID {
+			replicas[i].ReplicatedMasterPositionFetcher = ghostferry.ReplicatedMasterPositionViaCustomQuery{
+				Query: replicaConfig.ReplicatedMasterPositionQuery,
+			}
+		}
+	}
 
 	r.Ferry.WaitUntilReplicaIsCaughtUpToMaster = &ghostferry.WaitUntilReplicaIsCaughtUpToMaster{
 		MasterDB:                        masterDB,
 		ReplicatedMasterPositionFetcher: positionFetcher,
+		ReplicatedMasterGTIDSetFetcher:  gtidSetFetcher,
+		Replicas:                        replicas,
+		Quorum:                          r.config.ReplicaQuorum,
 	}
+
+	if r.config.ProxySQLReplicas != nil {
+		adminDB, err := r.config.ProxySQLReplicas.Admin.SqlDB(r.logger)
+		if err != nil {
+			return err
+		}
+
+		r.Ferry.WaitUntilReplicaIsCaughtUpToMaster.ReplicaPool = &ghostferry.ProxySQLReplicaPool{
+			AdminDB:                         adminDB,
+			HostGroup:                       r.config.ProxySQLReplicas.HostGroup,
+			ReplicaConfig:                   r.config.Source,
+			ReplicatedMasterPositionFetcher: positionFetcher,
+			ReplicatedMasterGTIDSetFetcher:  gtidSetFetcher,
+		}
+	}
+
 	return nil
 }
 
@@ -375,3 +661,13 @@ func (r *ShardingFerry) dbConfigIsForReplica(dbConfig ghostferry.DatabaseConfig)
 
 	return isReadOnly, err
 }
+
+// Returns a nil Throttler, rather than a nil *LagThrottler, if there is no
+// config so the ferry falls back to its default throttler.
+func newLagThrottler(config *ghostferry.LagThrottlerConfig) (ghostferry.Throttler, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	return ghostferry.NewLagThrottler(config)
+}
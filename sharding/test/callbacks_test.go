@@ -122,6 +122,27 @@ func (t *CallbacksTestSuite) TestPostsCallbacks() {
 	t.Require().True(errorReceived)
 }
 
+func (t *CallbacksTestSuite) TestCutoverRehearsalDoesNotLock() {
+	callbackReceived := false
+	t.CutoverLock = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbackReceived = true
+	})
+	t.CutoverUnlock = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callbackReceived = true
+	})
+	t.Config.CutoverRehearsal = true
+
+	t.Ferry.Run()
+
+	t.Require().False(callbackReceived)
+	t.Require().Nil(t.errHandler.LastError)
+	t.Require().NotNil(t.Ferry.RehearsalReport)
+	t.Require().True(t.Ferry.RehearsalReport.DataCorrect)
+	t.Require().True(t.Ferry.RehearsalReport.Total >= t.Ferry.RehearsalReport.Verify)
+
+	t.AssertTenantCopied()
+}
+
 func (t *CallbacksTestSuite) requestMap(r *http.Request) map[string]string {
 	defer r.Body.Close()
 	decoder := json.NewDecoder(r.Body)
@@ -142,6 +142,64 @@ func (t *CopyFilterTestSuite) TestInvalidShardingValueTypesErrors() {
 	t.Require().Equal("parsing new sharding key: invalid type %!t(string=1)", err.Error())
 }
 
+func (t *CopyFilterTestSuite) TestSelectsRegularTablesForShardingValues() {
+	t.filter.ShardingValues = []interface{}{int64(1), int64(3)}
+
+	selectBuilder, err := t.filter.BuildSelect([]string{"*"}, t.normalTable, t.pkCursor, 1024)
+	t.Require().Nil(err)
+
+	sql, args, err := selectBuilder.ToSql()
+	t.Require().Nil(err)
+	t.Require().Equal("SELECT * FROM `shard_1`.`normaltable` JOIN (SELECT `id` FROM `shard_1`.`normaltable` USE INDEX (`good_sharding_index`) WHERE `tenant_id` IN (?,?) AND `id` > ? ORDER BY `id` LIMIT 1024) AS `batch` USING(`id`)", sql)
+	t.Require().Equal([]interface{}{int64(1), int64(3), t.pkCursor}, args)
+}
+
+func (t *CopyFilterTestSuite) TestSelectsJoinedTablesForShardingValues() {
+	t.filter.ShardingValues = []interface{}{int64(1), int64(3)}
+
+	selectBuilder, err := t.filter.BuildSelect([]string{"*"}, t.joinedTable, t.pkCursor, 1024)
+	t.Require().Nil(err)
+
+	sql, args, err := selectBuilder.ToSql()
+	t.Require().Nil(err)
+	t.Require().Equal("SELECT * FROM `shard_1`.`joinedtable` WHERE `joined_pk` IN (SELECT * FROM (SELECT `joined_pk1` AS sharding_join_alias FROM `shard_1`.`join1` WHERE `tenant_id` IN (?,?) AND `joined_pk1` > ? UNION DISTINCT SELECT `joined_pk2` AS sharding_join_alias FROM `shard_1`.`join2` WHERE `tenant_id` IN (?,?) AND `joined_pk2` > ? ORDER BY sharding_join_alias LIMIT 1024) AS sharding_join_table) ORDER BY `joined_pk`", sql)
+	t.Require().Equal([]interface{}{int64(1), int64(3), t.pkCursor, int64(1), int64(3), t.pkCursor}, args)
+}
+
+func (t *CopyFilterTestSuite) TestSelectsPrimaryKeyTablesForShardingValues() {
+	t.filter.ShardingValues = []interface{}{int64(1), int64(3)}
+
+	selectBuilder, err := t.filter.BuildSelect([]string{"*"}, t.pkTable, t.pkCursor, 1024)
+	t.Require().Nil(err)
+
+	sql, args, err := selectBuilder.ToSql()
+	t.Require().Nil(err)
+	t.Require().Equal("SELECT * FROM `shard_1`.`pktable` USE INDEX (PRIMARY) WHERE `tenant_id` IN (?,?) AND `tenant_id` > ?", sql)
+	t.Require().Equal([]interface{}{int64(1), int64(3), t.pkCursor}, args)
+}
+
+func (t *CopyFilterTestSuite) TestApplicableEventForShardingValues() {
+	t.filter.ShardingValues = []interface{}{int64(1), int64(3)}
+
+	for tenantId, expected := range map[int64]bool{1: true, 2: false, 3: true} {
+		dmlEvents, err := ghostferry.NewBinlogInsertEvents(t.normalTable, t.newRowsEvent([]interface{}{1001, tenantId, "data"}))
+		t.Require().Nil(err)
+
+		applicable, err := t.filter.ApplicableEvent(dmlEvents[0])
+		t.Require().Nil(err)
+		t.Require().Equal(expected, applicable, fmt.Sprintf("tenant %d", tenantId))
+	}
+}
+
+func (t *CopyFilterTestSuite) TestJoinedTableEventsAreIgnoredWithoutSourceDB() {
+	dmlEvents, err := ghostferry.NewBinlogInsertEvents(t.joinedTable, t.newRowsEvent([]interface{}{1001}))
+	t.Require().Nil(err)
+
+	applicable, err := t.filter.ApplicableEvent(dmlEvents[0])
+	t.Require().Nil(err)
+	t.Require().False(applicable)
+}
+
 func (t *CopyFilterTestSuite) newRowsEvent(rowData []interface{}) *replication.RowsEvent {
 	normalTableMapEvent := &replication.TableMapEvent{
 		Schema: []byte(t.normalTable.Schema),
@@ -52,6 +52,18 @@ func TestShardedTableFilterRejectsIgnoredTables(t *testing.T) {
 	assert.Equal(t, tables[5:], applicable)
 }
 
+func TestShardedTableFilterRejectsIgnoredTableNames(t *testing.T) {
+	filter := &sharding.ShardedTableFilter{
+		SourceShard:   "shard_42",
+		ShardingKey:   "tenant_id",
+		IgnoredTables: []*regexp.Regexp{regexp.MustCompile("^_(.*)_gho$")},
+	}
+
+	applicable, err := filter.ApplicableTableNames("shard_42", []string{"_table_name_gho", "table_name", "ghost"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"table_name", "ghost"}, applicable)
+}
+
 func TestShardedTableFilterSelectsTablesWithShardingKey(t *testing.T) {
 	filter := &sharding.ShardedTableFilter{SourceShard: "shard_42", ShardingKey: "tenant_id"}
 
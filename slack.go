@@ -0,0 +1,128 @@
+package ghostferry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The events posted to Slack by default.
+var defaultSlackEvents = []string{
+	NotificationCopyFinished,
+	NotificationCutoverReady,
+	NotificationVerificationPassed,
+	NotificationVerificationFailed,
+	NotificationBinlogError,
+	NotificationFatalError,
+	NotificationSnapshotThresholdExceeded,
+}
+
+var slackEventTitles = map[string]string{
+	NotificationCopyStarted:               ":arrow_forward: Copy started",
+	NotificationCopyFinished:              ":white_check_mark: Copy finished",
+	NotificationCutoverReady:              ":checkered_flag: Ready for cutover",
+	NotificationCutoverAborted:            ":warning: Cutover aborted",
+	NotificationDone:                      ":tada: Done",
+	NotificationInterrupted:               ":pause_button: Interrupted",
+	NotificationVerificationPassed:        ":white_check_mark: Verification passed",
+	NotificationVerificationFailed:        ":x: Verification failed",
+	NotificationBinlogError:               ":rotating_light: Binlog error",
+	NotificationFatalError:                ":rotating_light: Fatal error",
+	NotificationSnapshotThresholdExceeded: ":hourglass: Snapshot thresholds exceeded",
+	NotificationTableCopied:               ":white_check_mark: Table copied",
+	NotificationTableVerified:             ":white_check_mark: Table verified",
+}
+
+// SlackConfig posts the key events of a run to a Slack channel through an
+// incoming webhook, as messages readable by the people on call rather than
+// as the JSON Notification posted to the Webhooks.
+type SlackConfig struct {
+	// The URL of the incoming webhook of the channel, such as
+	// https://hooks.slack.com/services/T000/B000/XXXX.
+	//
+	// Required
+	WebhookURL string
+
+	// Prefixes the messages, to tell the runs posting to the same channel
+	// apart, such as the name of the tenant being moved.
+	//
+	// Optional: defaults to no prefix.
+	Name string
+
+	// The events posted, see the Notification* constants.
+	//
+	// Optional: defaults to copy_finished, cutover_ready,
+	// verification_passed, verification_failed, binlog_error, fatal_error
+	// and snapshot_threshold_exceeded.
+	Events []string
+
+	// The timeout of every request.
+	//
+	// Optional: defaults to 10s.
+	Timeout string
+
+	// The errors and the 5xx and 429 responses are retried according to
+	// this policy.
+	//
+	// Optional: defaults to 5 attempts, with an exponential backoff from 1s.
+	RetryPolicy *RetryPolicy
+
+	webhook *WebhookConfig
+}
+
+func (c *SlackConfig) Validate() error {
+	if c.WebhookURL == "" {
+		return fmt.Errorf("WebhookURL is required")
+	}
+
+	events := c.Events
+	if len(events) == 0 {
+		events = defaultSlackEvents
+	}
+
+	c.webhook = &WebhookConfig{
+		URL:         c.WebhookURL,
+		Events:      events,
+		Timeout:     c.Timeout,
+		RetryPolicy: c.RetryPolicy,
+		encode:      c.message,
+	}
+
+	return c.webhook.Validate()
+}
+
+// The webhook of a Notifier posting the messages to Slack, once validated.
+func (c *SlackConfig) Webhook() *WebhookConfig {
+	return c.webhook
+}
+
+// The Slack message of the notification.
+func (c *SlackConfig) message(notification Notification) ([]byte, error) {
+	title, exists := slackEventTitles[notification.Event]
+	if !exists {
+		title = notification.Event
+	}
+
+	if c.Name != "" {
+		title = fmt.Sprintf("*%s* %s", c.Name, title)
+	}
+
+	lines := []string{title}
+	if notification.MismatchedRows > 0 {
+		lines = append(lines, fmt.Sprintf("Mismatched rows: %d", notification.MismatchedRows))
+	}
+
+	if notification.Table != nil {
+		lines = append(lines, fmt.Sprintf("Table: %s, %d rows", notification.Table.Table, notification.Table.Rows))
+	}
+
+	if notification.OverallState != "" {
+		lines = append(lines, "State: "+notification.OverallState)
+	}
+
+	if notification.Message != "" {
+		lines = append(lines, "```"+notification.Message+"```")
+	}
+
+	return json.Marshal(map[string]string{"text": strings.Join(lines, "\n")})
+}
@@ -0,0 +1,86 @@
+package ghostferry
+
+import (
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// Returns the tables that are estimated to have at most maxRows rows and, if
+// maxBytes is not 0, at most maxBytes bytes of data. The estimates come from
+// information_schema and may be off, so the tables must still be copied in
+// batches of at most maxRows rows, which are then a single batch in most
+// cases.
+func SmallTables(db *sql.DB, tables []*schema.Table, maxRows, maxBytes uint64) ([]*schema.Table, error) {
+	tablesBySchema := make(map[string][]*schema.Table)
+	for _, table := range tables {
+		tablesBySchema[table.Schema] = append(tablesBySchema[table.Schema], table)
+	}
+
+	smallTables := make([]*schema.Table, 0)
+	for database, tables := range tablesBySchema {
+		sizes, err := estimatedTableSizes(db, database)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, table := range tables {
+			size, exists := sizes[table.Name]
+			if !exists {
+				continue
+			}
+
+			if size.rows <= maxRows && (maxBytes == 0 || size.bytes <= maxBytes) {
+				smallTables = append(smallTables, table)
+			}
+		}
+	}
+
+	return smallTables, nil
+}
+
+type estimatedTableSize struct {
+	rows  uint64
+	bytes uint64
+}
+
+func estimatedTableSizes(db *sql.DB, database string) (map[string]estimatedTableSize, error) {
+	query, args, err := sq.
+		Select("TABLE_NAME", "TABLE_ROWS", "DATA_LENGTH").
+		From("information_schema.TABLES").
+		Where(sq.Eq{"TABLE_SCHEMA": database}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]estimatedTableSize)
+	for rows.Next() {
+		var name string
+		var tableRows, dataLength sql.NullInt64
+
+		err = rows.Scan(&name, &tableRows, &dataLength)
+		if err != nil {
+			return nil, err
+		}
+
+		// Views have no size and are never small tables.
+		if !tableRows.Valid || !dataLength.Valid {
+			continue
+		}
+
+		sizes[name] = estimatedTableSize{
+			rows:  uint64(tableRows.Int64),
+			bytes: uint64(dataLength.Int64),
+		}
+	}
+
+	return sizes, rows.Err()
+}
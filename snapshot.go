@@ -0,0 +1,491 @@
+package ghostferry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// SnapshotConfig configures a point in time copy: all the rows are read from
+// a single consistent snapshot of the source, and only the binlog events
+// after the coordinates of the snapshot are applied once the rows are copied.
+// The target is then exactly the source at the coordinates of the snapshot,
+// plus the changes made after them.
+//
+// The snapshot is taken under FLUSH TABLES WITH READ LOCK, which requires
+// the RELOAD privilege and briefly blocks the writes to the source. The
+// snapshot transactions stay open until the rows are copied, so the undo
+// logs of the source grow with the writes made during the copy, which the
+// Guard can watch. The binlog of the source must be kept until the rows are
+// copied.
+//
+// To copy the source as of a point in the past, such as a GTID, set GTIDSet
+// or Position and stop the writes to the source at that point, usually by
+// stopping the replication of a replica with START REPLICA UNTIL. The
+// snapshot is taken once the source reaches the point, and the copy fails if
+// the source went past it.
+type SnapshotConfig struct {
+	// The executed GTID set of the source at which the snapshot must be
+	// taken.
+	//
+	// Optional: defaults to the GTID set of the source when the copy starts.
+	GTIDSet string
+
+	// The binlog position of the source at which the snapshot must be taken.
+	// Cannot be set together with GTIDSet.
+	//
+	// Optional: defaults to the position of the source when the copy starts.
+	Position mysql.Position
+
+	// How long to wait for the source to reach GTIDSet or Position.
+	//
+	// Optional: defaults to 1h.
+	WaitTimeout string
+
+	// Watches the history list length of the source and the age of the
+	// snapshot while the rows are copied, see SnapshotGuardConfig.
+	//
+	// Optional: defaults to no checks.
+	Guard *SnapshotGuardConfig
+
+	gtidSet     mysql.GTIDSet
+	waitTimeout time.Duration
+}
+
+func (c *SnapshotConfig) Validate() error {
+	if c.GTIDSet != "" && c.Position.Name != "" {
+		return fmt.Errorf("only one of GTIDSet and Position can be set")
+	}
+
+	if c.GTIDSet != "" {
+		var err error
+		c.gtidSet, err = mysql.ParseMysqlGTIDSet(c.GTIDSet)
+		if err != nil {
+			return fmt.Errorf("invalid GTIDSet: %s", err)
+		}
+	}
+
+	if c.WaitTimeout == "" {
+		c.WaitTimeout = "1h"
+	}
+
+	var err error
+	c.waitTimeout, err = time.ParseDuration(c.WaitTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid WaitTimeout: %s", err)
+	}
+
+	if c.Guard != nil {
+		if c.Guard.Action == SnapshotGuardRotate && (c.GTIDSet != "" || c.Position.Name != "") {
+			return fmt.Errorf("Guard: the snapshot taken at a requested GTIDSet or Position cannot be rotated")
+		}
+
+		if err := c.Guard.Validate(); err != nil {
+			return fmt.Errorf("Guard: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// The coordinates of the source, as shown by SHOW MASTER STATUS.
+type snapshotCoordinates struct {
+	Position mysql.Position
+	GTIDSet  string
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func showMasterStatusCoordinates(ctx context.Context, db queryRower) (snapshotCoordinates, error) {
+	var coordinates snapshotCoordinates
+	var file string
+	var position uint32
+	var binlogDoDb, binlogIgnoreDb, executedGtidSet string
+	err := db.QueryRowContext(ctx, "SHOW MASTER STATUS").Scan(&file, &position, &binlogDoDb, &binlogIgnoreDb, &executedGtidSet)
+	if err != nil {
+		return coordinates, err
+	}
+
+	coordinates.Position = mysql.Position{Name: file, Pos: position}
+	// The executed GTID set is split over several lines once it grows.
+	coordinates.GTIDSet = strings.Replace(executedGtidSet, "\n", "", -1)
+	return coordinates, nil
+}
+
+// Returns whether the source reached the coordinates requested by the
+// config, and whether it is exactly at them.
+func (c *SnapshotConfig) compare(coordinates snapshotCoordinates) (reached, exact bool, err error) {
+	switch {
+	case c.gtidSet != nil:
+		executed, err := mysql.ParseMysqlGTIDSet(coordinates.GTIDSet)
+		if err != nil {
+			return false, false, fmt.Errorf("invalid executed GTID set of the source %q: %v", coordinates.GTIDSet, err)
+		}
+		return executed.Contain(c.gtidSet), executed.Equal(c.gtidSet), nil
+	case c.Position.Name != "":
+		cmp := coordinates.Position.Compare(c.Position)
+		return cmp >= 0, cmp == 0, nil
+	default:
+		return true, true, nil
+	}
+}
+
+func (c *SnapshotConfig) requested() string {
+	if c.gtidSet != nil {
+		return fmt.Sprintf("GTID set %s", c.GTIDSet)
+	}
+	return fmt.Sprintf("position %s", c.Position)
+}
+
+// SourceSnapshot is a set of transactions of the source that all read the
+// same consistent snapshot, used by the cursors of a point in time copy.
+//
+// The transactions can be replaced by those of a newer snapshot with Rotate,
+// see SnapshotGuardConfig. Position and GTIDSet remain the coordinates of
+// the first snapshot, from which the binlog is streamed.
+type SourceSnapshot struct {
+	Position mysql.Position
+	GTIDSet  string
+
+	mutex        sync.Mutex
+	transactions *snapshotTransactions
+	retired      []*snapshotTransactions
+	takenAt      time.Time
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+// The transactions started together under the lock of a snapshot.
+type snapshotTransactions struct {
+	conns chan *sql.Conn
+	all   []*sql.Conn
+
+	// Closed once the transactions are replaced by those of a newer
+	// snapshot, so the cursors waiting for one of them take one of the
+	// newer snapshot instead.
+	retired   chan struct{}
+	closeOnce sync.Once
+}
+
+// Takes a snapshot of the source with the given number of transactions. The
+// transactions are all started while the writes to the source are blocked,
+// so they read the same snapshot, at the coordinates read under the lock.
+func TakeSourceSnapshot(db *sql.DB, transactions int, config *SnapshotConfig, logger *logrus.Entry) (*SourceSnapshot, error) {
+	err := config.waitForSource(context.Background(), db, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	started, coordinates, err := startSnapshotTransactions(db, transactions, config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &SourceSnapshot{
+		Position:     coordinates.Position,
+		GTIDSet:      coordinates.GTIDSet,
+		transactions: started,
+		takenAt:      time.Now(),
+		closed:       make(chan struct{}),
+	}
+
+	logger.WithFields(logrus.Fields{
+		"position":     snapshot.Position,
+		"gtid_set":     snapshot.GTIDSet,
+		"transactions": transactions,
+	}).Info("took consistent snapshot of the source")
+
+	return snapshot, nil
+}
+
+// Starts the transactions of a snapshot under FLUSH TABLES WITH READ LOCK,
+// and returns them with the coordinates of the source they read.
+func startSnapshotTransactions(db *sql.DB, count int, config *SnapshotConfig, logger *logrus.Entry) (transactions *snapshotTransactions, coordinates snapshotCoordinates, err error) {
+	ctx := context.Background()
+
+	lockConn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, coordinates, err
+	}
+	defer lockConn.Close()
+
+	_, err = lockConn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK")
+	if err != nil {
+		return nil, coordinates, fmt.Errorf("failed to lock the source for the snapshot: %v", err)
+	}
+	defer func() {
+		_, err := lockConn.ExecContext(ctx, "UNLOCK TABLES")
+		if err != nil {
+			logger.WithError(err).Error("failed to unlock the source after the snapshot")
+		}
+	}()
+
+	transactions = &snapshotTransactions{
+		conns:   make(chan *sql.Conn, count),
+		retired: make(chan struct{}),
+	}
+	defer func() {
+		if err != nil {
+			transactions.close()
+			transactions = nil
+		}
+	}()
+
+	for i := 0; i < count; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return transactions, coordinates, err
+		}
+		transactions.all = append(transactions.all, conn)
+
+		_, err = conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY")
+		if err != nil {
+			return transactions, coordinates, fmt.Errorf("failed to start snapshot transaction: %v", err)
+		}
+		transactions.conns <- conn
+	}
+
+	coordinates, err = showMasterStatusCoordinates(ctx, lockConn)
+	if err != nil {
+		return transactions, coordinates, fmt.Errorf("failed to read the coordinates of the snapshot: %v", err)
+	}
+
+	_, exact, err := config.compare(coordinates)
+	if err != nil {
+		return transactions, coordinates, err
+	}
+
+	if !exact {
+		return transactions, coordinates, fmt.Errorf("the source is past the requested %s, at position %s and GTID set %s, stop the writes to the source at the requested point", config.requested(), coordinates.Position, coordinates.GTIDSet)
+	}
+
+	return transactions, coordinates, nil
+}
+
+// Waits until the source executed the coordinates requested by the config.
+func (c *SnapshotConfig) waitForSource(ctx context.Context, db *sql.DB, logger *logrus.Entry) error {
+	deadline := time.Now().Add(c.waitTimeout)
+
+	for {
+		coordinates, err := showMasterStatusCoordinates(ctx, db)
+		if err != nil {
+			return fmt.Errorf("failed to read the coordinates of the source: %v", err)
+		}
+
+		reached, _, err := c.compare(coordinates)
+		if err != nil {
+			return err
+		}
+
+		if reached {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the source did not reach the requested %s within %s, it is at position %s", c.requested(), c.WaitTimeout, coordinates.Position)
+		}
+
+		logger.WithField("position", coordinates.Position).Infof("waiting for the source to reach the requested %s", c.requested())
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// Returns a transaction of the snapshot, waiting until one is available. The
+// transaction must be released with Rollback once the batch is read, which
+// returns it to the snapshot without ending it.
+func (s *SourceSnapshot) acquire() SqlPreparerAndRollbacker {
+	for {
+		s.mutex.Lock()
+		transactions := s.transactions
+		s.mutex.Unlock()
+
+		select {
+		case conn := <-transactions.conns:
+			return &snapshotTransaction{conn: conn, transactions: transactions}
+		case <-transactions.retired:
+		}
+	}
+}
+
+// Returns how long ago the transactions in use were started.
+func (s *SourceSnapshot) TransactionAge() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return time.Since(s.takenAt)
+}
+
+// Replaces the transactions of the snapshot with those of a new snapshot of
+// the source, so the source can purge the undo logs kept for the previous
+// one. The batches read afterwards see the rows as of the new snapshot,
+// which are newer than Position: the binlog events between the snapshots
+// are applied again over them once the rows are copied, which leaves them
+// unchanged as the events only apply to the rows matching their old values.
+// The target is only consistent with the source once the binlog is applied
+// past the last snapshot.
+//
+// The previous transactions are ended once the batches reading them are
+// done.
+func (s *SourceSnapshot) Rotate(db *sql.DB, logger *logrus.Entry) error {
+	s.mutex.Lock()
+	count := cap(s.transactions.conns)
+	s.mutex.Unlock()
+
+	// The snapshot is taken wherever the source is, whatever the requested
+	// coordinates of the first one.
+	started, coordinates, err := startSnapshotTransactions(db, count, &SnapshotConfig{}, logger)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	select {
+	case <-s.closed:
+		s.mutex.Unlock()
+		started.close()
+		return nil
+	default:
+	}
+
+	previous := s.transactions
+	s.transactions = started
+	s.retired = append(s.retired, previous)
+	s.takenAt = time.Now()
+	s.mutex.Unlock()
+
+	close(previous.retired)
+	go s.endRetired(previous)
+
+	metrics.Count("Snapshot.Rotations", 1, nil, 1.0)
+	logger.WithFields(logrus.Fields{
+		"position": coordinates.Position,
+		"gtid_set": coordinates.GTIDSet,
+	}).Info("rotated the snapshot of the source")
+
+	return nil
+}
+
+// Ends the retired transactions once all of them are released, or once the
+// snapshot is closed.
+func (s *SourceSnapshot) endRetired(transactions *snapshotTransactions) {
+	for range transactions.all {
+		select {
+		case <-transactions.conns:
+		case <-s.closed:
+			return
+		}
+	}
+	transactions.close()
+}
+
+// Ends the transactions of the snapshot. The snapshot cannot be read from
+// afterwards.
+func (s *SourceSnapshot) Close() {
+	s.closeOnce.Do(func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		close(s.closed)
+		s.transactions.close()
+		for _, transactions := range s.retired {
+			transactions.close()
+		}
+	})
+}
+
+func (t *snapshotTransactions) close() {
+	t.closeOnce.Do(func() {
+		for _, conn := range t.all {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+			conn.Close()
+		}
+	})
+}
+
+type snapshotTransaction struct {
+	conn         *sql.Conn
+	transactions *snapshotTransactions
+}
+
+func (t *snapshotTransaction) Prepare(query string) (*sql.Stmt, error) {
+	return t.conn.PrepareContext(context.Background(), query)
+}
+
+func (t *snapshotTransaction) Rollback() error {
+	if t.conn != nil {
+		t.transactions.conns <- t.conn
+		t.conn = nil
+	}
+	return nil
+}
+
+// Takes the snapshot the rows are copied from, and positions the binlog
+// streaming at its coordinates. The binlog is only streamed once all the
+// rows are copied, see connectBinlogAfterSnapshotCopy, as the rows of the
+// snapshot are older than the events that would otherwise be applied first.
+func (f *Ferry) takeSnapshot() error {
+	var err error
+	f.snapshot, err = TakeSourceSnapshot(f.SourceDB, f.Config.DataIterationConcurrency, f.Config.Snapshot, f.logger)
+	if err != nil {
+		return err
+	}
+
+	f.BinlogStreamer.lastStreamedBinlogPosition = f.snapshot.Position
+	f.BinlogStreamer.lastResumableBinlogPosition = f.snapshot.Position
+	f.DataIterator.CursorConfig.Snapshot = f.snapshot
+	f.snapshotCopiedCh = make(chan struct{})
+
+	if f.Config.Snapshot.Guard != nil {
+		f.snapshotGuard = &SnapshotGuard{
+			SourceDB: f.SourceDB,
+			Snapshot: f.snapshot,
+			Config:   f.Config.Snapshot.Guard,
+			Notify:   f.Notify,
+		}
+	}
+	return nil
+}
+
+// Called once all the rows of the snapshot are copied. The snapshot is
+// released and the binlog is streamed from its coordinates.
+func (f *Ferry) connectBinlogAfterSnapshotCopy() error {
+	f.snapshot.Close()
+
+	f.logger.WithField("position", f.snapshot.Position).Info("copied the rows of the snapshot, streaming the binlog from the snapshot")
+	err := f.BinlogStreamer.ConnectBinlogStreamerToMysqlFrom(f.snapshot.Position)
+	if err != nil {
+		// The errors of the done listeners are not handled by the
+		// DataIterator.
+		f.ErrorHandler.Fatal("binlog_streamer", err)
+		return err
+	}
+
+	close(f.snapshotCopiedCh)
+	return nil
+}
+
+// Waits until the binlog is connected after the copy of the rows of the
+// snapshot. Returns false if the copy stopped before, in which case the
+// binlog is never streamed.
+func (f *Ferry) waitForSnapshotCopy(dataIteratorDone <-chan struct{}) bool {
+	select {
+	case <-f.snapshotCopiedCh:
+		return true
+	case <-dataIteratorDone:
+		select {
+		case <-f.snapshotCopiedCh:
+			return true
+		default:
+			f.snapshot.Close()
+			return false
+		}
+	}
+}
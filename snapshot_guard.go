@@ -0,0 +1,236 @@
+package ghostferry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The actions of a SnapshotGuardConfig once a threshold is crossed.
+const (
+	SnapshotGuardAlert  = "alert"
+	SnapshotGuardRotate = "rotate"
+)
+
+// SnapshotGuardConfig configures the checks of the purge lag caused by the
+// snapshot of a point in time copy. The snapshot transactions stay open for
+// the whole copy, which prevents the source from purging the undo logs of
+// the rows changed since, so the history list length of the source grows
+// with its writes and slows down its reads. See SnapshotGuard.
+type SnapshotGuardConfig struct {
+	// The history list length of the source, as reported by the
+	// trx_rseg_history_len metric of information_schema.INNODB_METRICS,
+	// above which the Action is taken.
+	//
+	// Optional: defaults to no limit.
+	MaxHistoryLength int64
+
+	// The age of the snapshot transactions above which the Action is taken,
+	// as a Go duration string.
+	//
+	// Optional: defaults to no limit.
+	MaxTransactionAge string
+
+	// The action taken when a threshold is crossed:
+	//
+	//   - alert: logs a warning and notifies the snapshot_threshold_exceeded
+	//     event, once until the thresholds are no longer crossed.
+	//   - rotate: replaces the snapshot transactions with those of a new
+	//     snapshot, which blocks the writes to the source as briefly as the
+	//     first snapshot did. See SourceSnapshot.Rotate.
+	//
+	// Optional: defaults to alert.
+	Action string
+
+	// How often the thresholds are checked, as a Go duration string.
+	//
+	// Optional: defaults to 30s.
+	CheckInterval string
+
+	// The minimum time between two rotations, as the history list length
+	// only decreases once the source purged the undo logs kept for the
+	// previous snapshot.
+	//
+	// Optional: defaults to 10m.
+	MinRotationInterval string
+
+	maxTransactionAge   time.Duration
+	checkInterval       time.Duration
+	minRotationInterval time.Duration
+}
+
+func (c *SnapshotGuardConfig) Validate() error {
+	if c.MaxHistoryLength < 0 {
+		return fmt.Errorf("MaxHistoryLength must not be negative")
+	}
+
+	if c.MaxHistoryLength == 0 && c.MaxTransactionAge == "" {
+		return fmt.Errorf("MaxHistoryLength or MaxTransactionAge must be set")
+	}
+
+	if c.Action == "" {
+		c.Action = SnapshotGuardAlert
+	}
+
+	if c.Action != SnapshotGuardAlert && c.Action != SnapshotGuardRotate {
+		return fmt.Errorf("invalid Action %s, must be %s or %s", c.Action, SnapshotGuardAlert, SnapshotGuardRotate)
+	}
+
+	if c.CheckInterval == "" {
+		c.CheckInterval = "30s"
+	}
+
+	if c.MinRotationInterval == "" {
+		c.MinRotationInterval = "10m"
+	}
+
+	var err error
+	if c.MaxTransactionAge != "" {
+		c.maxTransactionAge, err = time.ParseDuration(c.MaxTransactionAge)
+		if err != nil {
+			return fmt.Errorf("invalid MaxTransactionAge: %s", err)
+		}
+	}
+
+	c.checkInterval, err = time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		return fmt.Errorf("invalid CheckInterval: %s", err)
+	}
+
+	if c.checkInterval <= 0 {
+		return fmt.Errorf("CheckInterval must be positive")
+	}
+
+	c.minRotationInterval, err = time.ParseDuration(c.MinRotationInterval)
+	if err != nil {
+		return fmt.Errorf("invalid MinRotationInterval: %s", err)
+	}
+
+	return nil
+}
+
+// Returns the thresholds crossed by the history list length and the age of
+// the snapshot, or an empty string if none is.
+func (c *SnapshotGuardConfig) Exceeded(historyLength int64, transactionAge time.Duration) string {
+	var exceeded []string
+	if c.MaxHistoryLength > 0 && historyLength > c.MaxHistoryLength {
+		exceeded = append(exceeded, fmt.Sprintf("history list length %d is above %d", historyLength, c.MaxHistoryLength))
+	}
+
+	if c.maxTransactionAge > 0 && transactionAge > c.maxTransactionAge {
+		exceeded = append(exceeded, fmt.Sprintf("snapshot age %s is above %s", transactionAge.Round(time.Second), c.maxTransactionAge))
+	}
+
+	return strings.Join(exceeded, ", ")
+}
+
+// SnapshotGuard checks the history list length of the source and the age of
+// the snapshot every CheckInterval of its Config while the rows of a point in
+// time copy are read, and alerts or rotates the snapshot once they cross the
+// thresholds. It stops once the snapshot is closed.
+//
+// The history list length and the age are reported as the
+// Snapshot.HistoryLength and Snapshot.TransactionAge gauges.
+type SnapshotGuard struct {
+	SourceDB *sql.DB
+	Snapshot *SourceSnapshot
+	Config   *SnapshotGuardConfig
+
+	// Notifies the alerts, such as Ferry.Notify.
+	Notify func(event, message string)
+
+	logger       *logrus.Entry
+	alerted      bool
+	lastRotation time.Time
+}
+
+func (g *SnapshotGuard) Run(ctx context.Context) error {
+	g.logger = logrus.WithField("tag", "snapshot_guard")
+
+	ticker := time.NewTicker(g.Config.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-g.Snapshot.closed:
+			return nil
+		case <-ticker.C:
+			err := g.Check()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Checks the thresholds once, and takes the Action if one is crossed.
+func (g *SnapshotGuard) Check() error {
+	if g.logger == nil {
+		g.logger = logrus.WithField("tag", "snapshot_guard")
+	}
+
+	var historyLength int64
+	if g.Config.MaxHistoryLength > 0 {
+		var err error
+		historyLength, err = HistoryListLength(g.SourceDB)
+		if err != nil {
+			return err
+		}
+		metrics.Gauge("Snapshot.HistoryLength", float64(historyLength), nil, 1.0)
+	}
+
+	transactionAge := g.Snapshot.TransactionAge()
+	metrics.Gauge("Snapshot.TransactionAge", transactionAge.Seconds(), nil, 1.0)
+
+	exceeded := g.Config.Exceeded(historyLength, transactionAge)
+	if exceeded == "" {
+		g.alerted = false
+		return nil
+	}
+
+	if g.Config.Action == SnapshotGuardRotate {
+		if !g.lastRotation.IsZero() && time.Since(g.lastRotation) < g.Config.minRotationInterval {
+			return nil
+		}
+
+		g.logger.WithField("exceeded", exceeded).Warn("rotating the snapshot of the source")
+		g.lastRotation = time.Now()
+		err := g.Snapshot.Rotate(g.SourceDB, g.logger)
+		if err != nil {
+			// The copy goes on from the current snapshot.
+			g.logger.WithError(err).Error("failed to rotate the snapshot of the source")
+		}
+		return nil
+	}
+
+	if !g.alerted {
+		g.alerted = true
+		metrics.Count("Snapshot.ThresholdExceeded", 1, nil, 1.0)
+		g.logger.WithField("exceeded", exceeded).Warn("the snapshot of the source crossed its thresholds")
+		if g.Notify != nil {
+			g.Notify(NotificationSnapshotThresholdExceeded, exceeded)
+		}
+	}
+
+	return nil
+}
+
+// Returns the history list length of the source: the number of undo logs
+// of committed transactions not purged yet.
+func HistoryListLength(db *sql.DB) (int64, error) {
+	var length int64
+	err := db.QueryRow("SELECT `COUNT` FROM information_schema.INNODB_METRICS WHERE `NAME` = 'trx_rseg_history_len' AND `STATUS` = 'enabled'").Scan(&length)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("the trx_rseg_history_len metric of information_schema.INNODB_METRICS is not enabled on the source")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the history list length of the source: %v", err)
+	}
+	return length, nil
+}
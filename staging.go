@@ -0,0 +1,97 @@
+package ghostferry
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// MySQL limits table names to 64 characters.
+const maxTableNameLength = 64
+
+// The staging tables are temporary tables, so they are only visible to the
+// connection writing the batch and are never replicated. They are named with
+// the GhostferryTablePrefix in case they show up in a SHOW TABLES anyway.
+func stagingTableName(table string) string {
+	name := GhostferryTablePrefix + "stage_" + table
+	if len(name) <= maxTableNameLength {
+		return name
+	}
+
+	return fmt.Sprintf("%sstage_%08x", GhostferryTablePrefix, crc32.ChecksumIEEE([]byte(table)))
+}
+
+// Writes the batch to a temporary staging table first, with a plain INSERT
+// which fails on malformed values rather than truncating them, and then
+// moves the rows into the target table with a single INSERT ... SELECT. Both
+// are done in a transaction, so a batch that cannot be staged never touches
+// the target table.
+func (w *BatchWriter) writeStagedRowBatch(batch *RowBatch, db, table string, inserted insertCounts) (err error) {
+	target := QuotedTableNameFromString(db, table)
+	stage := &schema.Table{Schema: db, Name: stagingTableName(table)}
+	quotedStage := QuotedTableName(stage)
+
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// The connection may still have the staging table of an earlier batch
+	// if that batch failed, as creating and dropping temporary tables is not
+	// transactional.
+	statements := []string{
+		fmt.Sprintf("CREATE TEMPORARY TABLE IF NOT EXISTS %s LIKE %s", quotedStage, target),
+		fmt.Sprintf("DELETE FROM %s", quotedStage),
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			return wrapError(err, "during preparing staging table (%s)", statement)
+		}
+	}
+
+	query, args, err := batch.asStrictSQLQuery(stage)
+	if err != nil {
+		return wrapError(err, "during generating sql query")
+	}
+
+	query = commentStatement(w.StatementComment, query)
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		return wrapError(err, "during staging batch (%s)", query)
+	}
+
+	columns := strings.Join(quotedColumnNames(batch.TableSchema()), ",")
+	query = commentStatement(w.StatementComment, fmt.Sprintf("INSERT IGNORE INTO %s (%s) SELECT %s FROM %s", target, columns, columns, quotedStage))
+	result, err := tx.Exec(query)
+	if err != nil {
+		return wrapError(err, "during moving staged batch (%s)", query)
+	}
+
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DROP TEMPORARY TABLE %s", quotedStage))
+	if err != nil {
+		return wrapError(err, "during dropping staging table")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if inserted != nil {
+		inserted.add(db+"."+table, int64(batch.Size()), moved)
+	}
+	return nil
+}
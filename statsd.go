@@ -0,0 +1,101 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Shopify/go-dogstatsd"
+	"github.com/sirupsen/logrus"
+)
+
+// Sends the metrics of Ghostferry to the statsd (or dogstatsd) server at
+// Config.StatsDAddress. Every metric is tagged with the source and target
+// hosts, the Config.FerryId and Config.MetricTags in addition to the given
+// tags, so that the metrics of concurrent ferries can be told apart.
+func InitializeStatsDMetrics(prefix string, config *Config, tags []MetricTag) (*Metrics, error) {
+	client, err := dogstatsd.New(config.StatsDAddress, &dogstatsd.Context{})
+	if err != nil {
+		return nil, err
+	}
+
+	metricsChan := make(chan interface{}, 1024)
+	m := SetGlobalMetrics(prefix, metricsChan)
+
+	m.DefaultTags = append(m.DefaultTags, tags...)
+	m.DefaultTags = append(m.DefaultTags,
+		MetricTag{Name: "SourceHost", Value: config.Source.Host},
+		MetricTag{Name: "TargetHost", Value: config.Target.Host},
+	)
+
+	if config.FerryId != "" {
+		m.DefaultTags = append(m.DefaultTags, MetricTag{Name: LogFieldFerryId, Value: config.FerryId})
+	}
+
+	names := make([]string, 0, len(config.MetricTags))
+	for name := range config.MetricTags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m.DefaultTags = append(m.DefaultTags, MetricTag{Name: name, Value: config.MetricTags[name]})
+	}
+
+	if config.TableMetrics != nil {
+		m.TableTags = NewTableTagLimiter(config.TableMetrics)
+	}
+
+	m.AddConsumer()
+	go consumeStatsDMetrics(m, client, metricsChan)
+
+	return m, nil
+}
+
+// Flushes the metrics still buffered. The metrics emitted afterwards are
+// discarded.
+func StopAndFlushMetrics() {
+	m := metrics
+	if m.Sink == nil {
+		return
+	}
+
+	metrics = &Metrics{Prefix: m.Prefix}
+	m.StopAndFlush()
+}
+
+func consumeStatsDMetrics(m *Metrics, client *dogstatsd.Client, metricsChan chan interface{}) {
+	defer m.DoneConsumer()
+	defer client.Close()
+
+	for {
+		var err error
+
+		metric := <-metricsChan
+		switch metric := metric.(type) {
+		case CountMetric:
+			err = client.Count(metric.Key, metric.Value, tagsToStrings(metric.Tags), metric.SampleRate)
+		case GaugeMetric:
+			err = client.Gauge(metric.Key, metric.Value, tagsToStrings(metric.Tags), metric.SampleRate)
+		case TimerMetric:
+			err = client.Timer(metric.Key, metric.Value, tagsToStrings(metric.Tags), metric.SampleRate)
+		case nil:
+			return
+		}
+
+		if err != nil {
+			logrus.WithField("tag", "metrics").WithError(err).WithField("metric", metric).Warn("could not emit statsd metric")
+		}
+	}
+}
+
+func tagsToStrings(tags []MetricTag) []string {
+	strs := make([]string, len(tags))
+	for i, tag := range tags {
+		if tag.Value != "" {
+			strs[i] = fmt.Sprintf("%s:%s", tag.Name, tag.Value)
+		} else {
+			strs[i] = tag.Name
+		}
+	}
+	return strs
+}
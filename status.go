@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
 )
 
 type TableStatus struct {
@@ -29,14 +30,29 @@ type Status struct {
 	TimeTaken         time.Duration
 	ETA               time.Duration
 	BinlogStreamerLag time.Duration
+	BinlogWriterLag   time.Duration
+	ReplicationLag    time.Duration
 	PKsPerSecond      uint64
 
+	// The time on the source of the events being written to the target,
+	// zero if not known. See Ferry.ApplyingEventsFrom.
+	ApplyingEventsFrom time.Time
+
+	// The rows skipped by the INSERT IGNORE statements of the copy and of
+	// the binlog, if counted. See Config.IgnoredRowsMode.
+	CopyIgnoredRows   int64
+	BinlogIgnoredRows int64
+
 	AutomaticCutover            bool
 	BinlogStreamerStopRequested bool
 	LastSuccessfulBinlogPos     mysql.Position
 	TargetBinlogPos             mysql.Position
 
-	Throttled bool
+	Throttled      bool
+	ReadThrottled  bool
+	WriteThrottled bool
+
+	PausedComponents []string
 
 	CompletedTableCount int
 	TotalTableCount     int
@@ -69,13 +85,21 @@ func FetchStatus(f *Ferry, v Verifier) *Status {
 		status.TimeTaken = f.DoneTime.Sub(status.StartTime)
 	}
 	status.BinlogStreamerLag = time.Now().Sub(f.BinlogStreamer.lastProcessedEventTime)
+	status.BinlogWriterLag = f.BinlogWriter.Lag()
+	status.ReplicationLag = f.ReplicationLag()
+	status.ApplyingEventsFrom, _ = f.ApplyingEventsFrom()
 
 	status.AutomaticCutover = f.Config.AutomaticCutover
 	status.BinlogStreamerStopRequested = f.BinlogStreamer.stopRequested
 	status.LastSuccessfulBinlogPos = f.BinlogStreamer.lastStreamedBinlogPosition
 	status.TargetBinlogPos = f.BinlogStreamer.targetBinlogPosition
 
-	status.Throttled = f.Throttler.Throttled()
+	status.ReadThrottled = f.ReadThrottler.Throttled()
+	status.WriteThrottled = f.WriteThrottler.Throttled()
+	status.Throttled = status.ReadThrottled || status.WriteThrottled
+	if f.Pauser != nil {
+		status.PausedComponents = f.Pauser.PausedComponents()
+	}
 
 	// Getting all table statuses
 	status.TableStatuses = make([]*TableStatus, 0, len(f.Tables))
@@ -138,7 +162,7 @@ func FetchStatus(f *Ferry, v Verifier) *Status {
 	for _, tableName := range completedTableNames {
 		status.TableStatuses = append(status.TableStatuses, &TableStatus{
 			TableName:        tableName,
-			PrimaryKeyName:   f.Tables[tableName].GetPKColumn(0).Name,
+			PrimaryKeyName:   primaryKeyName(f.Tables[tableName]),
 			Status:           "complete",
 			TargetPK:         targetPKs[tableName],
 			LastSuccessfulPK: lastSuccessfulPKs[tableName],
@@ -148,7 +172,7 @@ func FetchStatus(f *Ferry, v Verifier) *Status {
 	for _, tableName := range copyingTableNames {
 		status.TableStatuses = append(status.TableStatuses, &TableStatus{
 			TableName:        tableName,
-			PrimaryKeyName:   f.Tables[tableName].GetPKColumn(0).Name,
+			PrimaryKeyName:   primaryKeyName(f.Tables[tableName]),
 			Status:           "copying",
 			TargetPK:         targetPKs[tableName],
 			LastSuccessfulPK: lastSuccessfulPKs[tableName],
@@ -158,28 +182,19 @@ func FetchStatus(f *Ferry, v Verifier) *Status {
 	for _, tableName := range waitingTableNames {
 		status.TableStatuses = append(status.TableStatuses, &TableStatus{
 			TableName:        tableName,
-			PrimaryKeyName:   f.Tables[tableName].GetPKColumn(0).Name,
+			PrimaryKeyName:   primaryKeyName(f.Tables[tableName]),
 			Status:           "waiting",
 			TargetPK:         targetPKs[tableName],
 			LastSuccessfulPK: 0,
 		})
 	}
 
-	// ETA estimation
-	// We do it here rather than in DataIteratorState to give the lock back
-	// ASAP. It's not supposed to be that accurate anyway.
-	var totalPKsToCopy uint64 = 0
-	var completedPKs uint64 = 0
-	estimatedPKsPerSecond := f.DataIterator.CurrentState.EstimatedPKProcessedPerSecond()
-	for _, targetPK := range targetPKs {
-		totalPKsToCopy += targetPK
-	}
-
-	for _, completedPK := range lastSuccessfulPKs {
-		completedPKs += completedPK
+	if f.ignoredRows != nil {
+		status.CopyIgnoredRows, status.BinlogIgnoredRows = f.ignoredRows.Counts()
 	}
 
-	status.ETA = time.Duration(math.Ceil(float64(totalPKsToCopy-completedPKs)/estimatedPKsPerSecond)) * time.Second
+	eta, estimatedPKsPerSecond := estimateCopyETA(f.DataIterator.CurrentState)
+	status.ETA = eta
 	status.PKsPerSecond = uint64(estimatedPKsPerSecond)
 
 	// Verifier display
@@ -201,3 +216,21 @@ func FetchStatus(f *Ferry, v Verifier) *Status {
 
 	return status
 }
+
+// The estimated time left to copy the rows, from the rate at which the
+// primary keys were copied so far.
+func estimateCopyETA(state *DataIteratorState) (time.Duration, float64) {
+	estimatedPKsPerSecond := state.EstimatedPKProcessedPerSecond()
+	completedPKs, totalPKsToCopy := state.CopyProgress()
+
+	eta := time.Duration(math.Ceil(float64(totalPKsToCopy-completedPKs)/estimatedPKsPerSecond)) * time.Second
+	return eta, estimatedPKsPerSecond
+}
+
+// The tables without a key are shown without a primary key name.
+func primaryKeyName(table *schema.Table) string {
+	if IsFullRowMatchTable(table) {
+		return ""
+	}
+	return table.GetPKColumn(0).Name
+}
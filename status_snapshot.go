@@ -0,0 +1,344 @@
+package ghostferry
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go-mysql/mysql"
+)
+
+// The version of the StatusSnapshot document. It is only incremented when a
+// field is removed or its meaning changes, new fields may be added to the
+// same version.
+const StatusSnapshotVersion = 1
+
+// A machine-readable status of the ferry, served as JSON on /api/status by
+// the ControlServer to be polled by the deploy tooling, unlike the status
+// shown by the web UI. The document is described by
+// StatusSnapshotJSONSchema. The durations are in seconds.
+type StatusSnapshot struct {
+	Version           int       `json:"version"`
+	GhostferryVersion string    `json:"ghostferry_version"`
+	Time              time.Time `json:"time"`
+
+	// The OverallState of the ferry, such as copying or cutover.
+	Phase            string    `json:"phase"`
+	StartTime        time.Time `json:"start_time"`
+	ElapsedSeconds   float64   `json:"elapsed_seconds"`
+	AutomaticCutover bool      `json:"automatic_cutover"`
+
+	// The estimated time left to copy the rows, null if the rows are not
+	// being copied or the copy speed is not known yet.
+	ETASeconds *float64 `json:"eta_seconds"`
+
+	Tables       StatusSnapshotTables       `json:"tables"`
+	Binlog       StatusSnapshotBinlog       `json:"binlog"`
+	Throttle     StatusSnapshotThrottle     `json:"throttle"`
+	Errors       StatusSnapshotErrors       `json:"errors"`
+	Verification StatusSnapshotVerification `json:"verification"`
+}
+
+type StatusSnapshotTables struct {
+	Total     int                   `json:"total"`
+	Completed int                   `json:"completed"`
+	Items     []StatusSnapshotTable `json:"items"`
+}
+
+type StatusSnapshotTable struct {
+	Name string `json:"name"`
+
+	// Either waiting, copying or complete.
+	Status           string `json:"status"`
+	PrimaryKey       string `json:"primary_key"`
+	LastSuccessfulPK uint64 `json:"last_successful_pk"`
+	TargetPK         uint64 `json:"target_pk"`
+
+	// The fraction of the primary keys copied, from 0 to 1.
+	Progress float64 `json:"progress"`
+}
+
+type StatusSnapshotBinlogPosition struct {
+	File     string `json:"file"`
+	Position uint32 `json:"position"`
+}
+
+type StatusSnapshotBinlog struct {
+	StreamedPosition StatusSnapshotBinlogPosition `json:"streamed_position"`
+
+	// The position the binlog streaming stops at during the cutover, null
+	// until it is known.
+	TargetPosition *StatusSnapshotBinlogPosition `json:"target_position"`
+
+	StreamerLagSeconds    float64 `json:"streamer_lag_seconds"`
+	WriterLagSeconds      float64 `json:"writer_lag_seconds"`
+	ReplicationLagSeconds float64 `json:"replication_lag_seconds"`
+
+	// The time on the source of the events being written to the target,
+	// null until it is known.
+	ApplyingEventsFrom *time.Time `json:"applying_events_from"`
+}
+
+type StatusSnapshotThrottle struct {
+	Throttled        bool     `json:"throttled"`
+	ReadThrottled    bool     `json:"read_throttled"`
+	WriteThrottled   bool     `json:"write_throttled"`
+	PausedComponents []string `json:"paused_components"`
+}
+
+type StatusSnapshotErrors struct {
+	// The problems of Ferry.Health.
+	Healthy  bool     `json:"healthy"`
+	Problems []string `json:"problems"`
+
+	// The error that stopped the run, which is only seen if the process
+	// keeps serving requests after it, such as while the notifications of
+	// the error are sent.
+	Fatal *StatusSnapshotFatalError `json:"fatal"`
+}
+
+type StatusSnapshotFatalError struct {
+	Time    time.Time `json:"time"`
+	From    string    `json:"from"`
+	Class   string    `json:"class"`
+	Message string    `json:"message"`
+}
+
+type StatusSnapshotVerification struct {
+	Supported bool `json:"supported"`
+	Started   bool `json:"started"`
+	Done      bool `json:"done"`
+
+	// Only meaningful once the verification is done.
+	Correct bool   `json:"correct"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// The JSON Schema of the StatusSnapshot document, served on
+// /api/status/schema.
+const StatusSnapshotJSONSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/Shopify/ghostferry/status-snapshot/v1",
+  "title": "Ghostferry status snapshot",
+  "type": "object",
+  "required": ["version", "ghostferry_version", "time", "phase", "start_time", "elapsed_seconds", "automatic_cutover", "eta_seconds", "tables", "binlog", "throttle", "errors", "verification"],
+  "definitions": {
+    "binlog_position": {
+      "type": "object",
+      "required": ["file", "position"],
+      "properties": {
+        "file": {"type": "string"},
+        "position": {"type": "integer", "minimum": 0}
+      }
+    }
+  },
+  "properties": {
+    "version": {"const": 1},
+    "ghostferry_version": {"type": "string"},
+    "time": {"type": "string", "format": "date-time"},
+    "phase": {"type": "string", "enum": ["starting", "copying", "wait-for-cutover", "replicating", "cutover", "done", "interrupted"]},
+    "start_time": {"type": "string", "format": "date-time"},
+    "elapsed_seconds": {"type": "number", "minimum": 0},
+    "automatic_cutover": {"type": "boolean"},
+    "eta_seconds": {"type": ["number", "null"], "minimum": 0},
+    "tables": {
+      "type": "object",
+      "required": ["total", "completed", "items"],
+      "properties": {
+        "total": {"type": "integer", "minimum": 0},
+        "completed": {"type": "integer", "minimum": 0},
+        "items": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "required": ["name", "status", "primary_key", "last_successful_pk", "target_pk", "progress"],
+            "properties": {
+              "name": {"type": "string"},
+              "status": {"type": "string", "enum": ["waiting", "copying", "complete"]},
+              "primary_key": {"type": "string"},
+              "last_successful_pk": {"type": "integer", "minimum": 0},
+              "target_pk": {"type": "integer", "minimum": 0},
+              "progress": {"type": "number", "minimum": 0, "maximum": 1}
+            }
+          }
+        }
+      }
+    },
+    "binlog": {
+      "type": "object",
+      "required": ["streamed_position", "target_position", "streamer_lag_seconds", "writer_lag_seconds", "replication_lag_seconds", "applying_events_from"],
+      "properties": {
+        "streamed_position": {"$ref": "#/definitions/binlog_position"},
+        "target_position": {"oneOf": [{"$ref": "#/definitions/binlog_position"}, {"type": "null"}]},
+        "streamer_lag_seconds": {"type": "number", "minimum": 0},
+        "writer_lag_seconds": {"type": "number", "minimum": 0},
+        "replication_lag_seconds": {"type": "number", "minimum": 0},
+        "applying_events_from": {"type": ["string", "null"], "format": "date-time"}
+      }
+    },
+    "throttle": {
+      "type": "object",
+      "required": ["throttled", "read_throttled", "write_throttled", "paused_components"],
+      "properties": {
+        "throttled": {"type": "boolean"},
+        "read_throttled": {"type": "boolean"},
+        "write_throttled": {"type": "boolean"},
+        "paused_components": {"type": "array", "items": {"type": "string"}}
+      }
+    },
+    "errors": {
+      "type": "object",
+      "required": ["healthy", "problems", "fatal"],
+      "properties": {
+        "healthy": {"type": "boolean"},
+        "problems": {"type": "array", "items": {"type": "string"}},
+        "fatal": {
+          "oneOf": [
+            {"type": "null"},
+            {
+              "type": "object",
+              "required": ["time", "from", "class", "message"],
+              "properties": {
+                "time": {"type": "string", "format": "date-time"},
+                "from": {"type": "string"},
+                "class": {"type": "string"},
+                "message": {"type": "string"}
+              }
+            }
+          ]
+        }
+      }
+    },
+    "verification": {
+      "type": "object",
+      "required": ["supported", "started", "done", "correct", "message", "error"],
+      "properties": {
+        "supported": {"type": "boolean"},
+        "started": {"type": "boolean"},
+        "done": {"type": "boolean"},
+        "correct": {"type": "boolean"},
+        "message": {"type": "string"},
+        "error": {"type": "string"}
+      }
+    }
+  }
+}
+`
+
+// The fatal error recorded by the PanicErrorHandler, for the StatusSnapshot.
+type fatalErrorRecord struct {
+	mutex sync.Mutex
+	err   *StatusSnapshotFatalError
+}
+
+func (f *Ferry) recordFatalError(from string, err error, class ErrorClass) {
+	f.fatalError.mutex.Lock()
+	defer f.fatalError.mutex.Unlock()
+
+	f.fatalError.err = &StatusSnapshotFatalError{
+		Time:    time.Now(),
+		From:    from,
+		Class:   string(class),
+		Message: err.Error(),
+	}
+}
+
+// Returns the StatusSnapshot of the ferry, with the progress of the
+// verifier if it is set.
+func (f *Ferry) StatusSnapshot(v Verifier) *StatusSnapshot {
+	status := FetchStatus(f, v)
+	health := f.Health()
+
+	snapshot := &StatusSnapshot{
+		Version:           StatusSnapshotVersion,
+		GhostferryVersion: status.GhostferryVersion,
+		Time:              status.CurrentTime,
+		Phase:             status.OverallState,
+		StartTime:         status.StartTime,
+		ElapsedSeconds:    status.TimeTaken.Seconds(),
+		AutomaticCutover:  status.AutomaticCutover,
+	}
+
+	if status.OverallState == StateCopying && status.PKsPerSecond > 0 && status.ETA >= 0 {
+		eta := status.ETA.Seconds()
+		snapshot.ETASeconds = &eta
+	}
+
+	snapshot.Tables = StatusSnapshotTables{
+		Total:     status.TotalTableCount,
+		Completed: status.CompletedTableCount,
+		Items:     make([]StatusSnapshotTable, 0, len(status.TableStatuses)),
+	}
+	for _, table := range status.TableStatuses {
+		item := StatusSnapshotTable{
+			Name:             table.TableName,
+			Status:           table.Status,
+			PrimaryKey:       table.PrimaryKeyName,
+			LastSuccessfulPK: table.LastSuccessfulPK,
+			TargetPK:         table.TargetPK,
+		}
+
+		if table.Status == "complete" {
+			item.Progress = 1
+		} else if table.TargetPK > 0 {
+			item.Progress = math.Min(float64(table.LastSuccessfulPK)/float64(table.TargetPK), 1)
+		}
+
+		snapshot.Tables.Items = append(snapshot.Tables.Items, item)
+	}
+
+	snapshot.Binlog = StatusSnapshotBinlog{
+		StreamedPosition:      statusSnapshotBinlogPosition(status.LastSuccessfulBinlogPos),
+		StreamerLagSeconds:    health.BinlogLag.Seconds(),
+		WriterLagSeconds:      status.BinlogWriterLag.Seconds(),
+		ReplicationLagSeconds: health.ReplicationLag.Seconds(),
+	}
+	if status.TargetBinlogPos.Name != "" {
+		target := statusSnapshotBinlogPosition(status.TargetBinlogPos)
+		snapshot.Binlog.TargetPosition = &target
+	}
+	if !status.ApplyingEventsFrom.IsZero() {
+		applyingEventsFrom := status.ApplyingEventsFrom
+		snapshot.Binlog.ApplyingEventsFrom = &applyingEventsFrom
+	}
+
+	snapshot.Throttle = StatusSnapshotThrottle{
+		Throttled:        status.Throttled,
+		ReadThrottled:    status.ReadThrottled,
+		WriteThrottled:   status.WriteThrottled,
+		PausedComponents: status.PausedComponents,
+	}
+	if snapshot.Throttle.PausedComponents == nil {
+		snapshot.Throttle.PausedComponents = []string{}
+	}
+
+	snapshot.Errors = StatusSnapshotErrors{
+		Healthy:  health.Healthy,
+		Problems: health.Problems,
+	}
+	if snapshot.Errors.Problems == nil {
+		snapshot.Errors.Problems = []string{}
+	}
+
+	f.fatalError.mutex.Lock()
+	snapshot.Errors.Fatal = f.fatalError.err
+	f.fatalError.mutex.Unlock()
+
+	snapshot.Verification = StatusSnapshotVerification{
+		Supported: status.VerifierSupport,
+		Started:   status.VerificationStarted,
+		Done:      status.VerificationDone,
+		Correct:   status.VerificationResult.DataCorrect,
+		Message:   status.VerificationResult.Message,
+	}
+	if status.VerificationErr != nil {
+		snapshot.Verification.Error = status.VerificationErr.Error()
+	}
+
+	return snapshot
+}
+
+func statusSnapshotBinlogPosition(pos mysql.Position) StatusSnapshotBinlogPosition {
+	return StatusSnapshotBinlogPosition{File: pos.Name, Position: pos.Pos}
+}
@@ -0,0 +1,103 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The table tag of the per-table metrics of the tables not tagged by name.
+const OtherTablesTag = "other"
+
+// TableMetricsConfig limits the number of tables the per-table metrics are
+// tagged with, such as Table.RowsCopied, so the schemas with thousands of
+// tables do not create thousands of series. The tables with little traffic
+// are counted together under the "other" table until they reach MinRows,
+// and once MaxTables tables are tagged by name, the others stay in "other".
+type TableMetricsConfig struct {
+	// The tables always tagged by name, as database.table.
+	//
+	// Optional: defaults to no tables.
+	Tables []string
+
+	// The maximum number of tables tagged by name, in addition to Tables.
+	//
+	// Optional: defaults to 100
+	MaxTables int
+
+	// The number of rows and events counted for a table, such as the rows
+	// copied and the events applied, before it is tagged by name.
+	//
+	// Optional: defaults to 0, tagging the tables from their first row.
+	MinRows int64
+}
+
+func (c *TableMetricsConfig) Validate() error {
+	if c.MaxTables < 0 {
+		return fmt.Errorf("MaxTables cannot be negative")
+	}
+
+	if c.MaxTables == 0 {
+		c.MaxTables = 100
+	}
+
+	if c.MinRows < 0 {
+		return fmt.Errorf("MinRows cannot be negative")
+	}
+
+	return nil
+}
+
+// TableTagLimiter chooses the table tag of the per-table metrics, see
+// TableMetricsConfig. A table keeps its tag once tagged by name, so its
+// series is not split between its name and "other" during the run.
+type TableTagLimiter struct {
+	Config *TableMetricsConfig
+
+	mutex   sync.Mutex
+	traffic map[string]int64
+	tagged  map[string]bool
+}
+
+func NewTableTagLimiter(config *TableMetricsConfig) *TableTagLimiter {
+	l := &TableTagLimiter{
+		Config:  config,
+		traffic: make(map[string]int64),
+		tagged:  make(map[string]bool),
+	}
+
+	for _, table := range config.Tables {
+		l.tagged[table] = true
+	}
+
+	return l
+}
+
+// Adds the rows or events of the table to its traffic and returns the table
+// tag of its metrics.
+func (l *TableTagLimiter) Tag(table string, rows int64) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.tagged[table] {
+		return table
+	}
+
+	l.traffic[table] += rows
+	if l.traffic[table] < l.Config.MinRows || len(l.tagged) >= len(l.Config.Tables)+l.Config.MaxTables {
+		return OtherTablesTag
+	}
+
+	l.tagged[table] = true
+	delete(l.traffic, table)
+	return table
+}
+
+// Counts a per-table metric, tagged with the table as database.table or
+// with "other" when TableTags limits the number of tables.
+func (m *Metrics) CountTable(key, table string, value int64) {
+	if m.TableTags != nil {
+		table = m.TableTags.Tag(table, value)
+	}
+
+	m.Count(key, value, []MetricTag{{"table", table}}, 1.0)
+}
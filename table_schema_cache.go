@@ -3,6 +3,7 @@ package ghostferry
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/siddontang/go-mysql/schema"
@@ -16,6 +17,21 @@ var ignoredDatabases = map[string]bool{
 	"sys":                true,
 }
 
+// The storage engines whose tables are not ferried by default, see
+// Config.IgnoredStorageEngines. The rows of the MEMORY tables are lost when
+// the server restarts, so they are usually caches not worth ferrying.
+var DefaultIgnoredStorageEngines = []string{"BLACKHOLE", "FEDERATED", "MEMORY"}
+
+// All the tables created by Ghostferry itself, such as the state, audit,
+// heartbeat and quarantine tables, are named with this prefix. These tables
+// are never ferried, even if they match the TableFilter, as replaying the
+// writes Ghostferry makes to them would create a feedback loop.
+const GhostferryTablePrefix = "_ghostferry_"
+
+func IsGhostferryTable(table string) bool {
+	return strings.HasPrefix(table, GhostferryTablePrefix)
+}
+
 type TableSchemaCache map[string]*schema.Table
 
 func QuotedTableName(table *schema.Table) string {
@@ -51,7 +67,130 @@ func MaxPrimaryKeys(db *sql.DB, tables []*schema.Table, logger *logrus.Entry) (m
 	return tablesWithData, emptyTables, nil
 }
 
+// Returns the average size of the rows of the table estimated by the server,
+// including their BLOB and TEXT values, or 0 if the server has no estimate.
+func AverageRowBytes(db *sql.DB, table *schema.Table) (uint64, error) {
+	var rowBytes sql.NullInt64
+	err := db.QueryRow(
+		"SELECT AVG_ROW_LENGTH FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		table.Schema,
+		table.Name,
+	).Scan(&rowBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	if !rowBytes.Valid || rowBytes.Int64 < 0 {
+		return 0, nil
+	}
+
+	return uint64(rowBytes.Int64), nil
+}
+
+// Returns the storage engines of the tables of the database, keyed by table
+// name and in upper case. The views have no storage engine and are left out.
+func TableStorageEngines(db *sql.DB, dbname string) (map[string]string, error) {
+	rows, err := db.Query(
+		"SELECT TABLE_NAME, ENGINE FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND ENGINE IS NOT NULL",
+		dbname,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	engines := make(map[string]string)
+	for rows.Next() {
+		var table, engine string
+		err = rows.Scan(&table, &engine)
+		if err != nil {
+			return nil, err
+		}
+		engines[table] = strings.ToUpper(engine)
+	}
+
+	return engines, rows.Err()
+}
+
+// Removes the tables using one of the storage engines from the cache, such
+// as the BLACKHOLE tables, which have no rows to copy, or the FEDERATED
+// tables, whose rows live on another server. Returns the storage engines of
+// the removed tables, keyed by the full table name.
+func (c TableSchemaCache) RemoveStorageEngines(db *sql.DB, engines []string) (map[string]string, error) {
+	removed := make(map[string]string)
+	if len(engines) == 0 {
+		return removed, nil
+	}
+
+	ignored := make(map[string]bool, len(engines))
+	for _, engine := range engines {
+		ignored[strings.ToUpper(engine)] = true
+	}
+
+	tableEngines := make(map[string]map[string]string)
+	for name, table := range c {
+		if _, loaded := tableEngines[table.Schema]; !loaded {
+			engines, err := TableStorageEngines(db, table.Schema)
+			if err != nil {
+				return nil, err
+			}
+			tableEngines[table.Schema] = engines
+		}
+
+		engine := tableEngines[table.Schema][table.Name]
+		if ignored[engine] {
+			removed[name] = engine
+			delete(c, name)
+		}
+	}
+
+	return removed, nil
+}
+
+// Returns the names of the partitions of the table, in their order, or none
+// if the table is not partitioned. The subpartitions are not listed, as
+// selecting a partition selects all of its subpartitions.
+func TablePartitions(db *sql.DB, table *schema.Table) ([]string, error) {
+	rows, err := db.Query(
+		"SELECT DISTINCT PARTITION_NAME, PARTITION_ORDINAL_POSITION FROM information_schema.PARTITIONS "+
+			"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL "+
+			"ORDER BY PARTITION_ORDINAL_POSITION",
+		table.Schema,
+		table.Name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []string
+	for rows.Next() {
+		var partition string
+		var position uint64
+		err = rows.Scan(&partition, &position)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+
+	return partitions, rows.Err()
+}
+
+// Loads the schemas of the tables matching the filter. The tables without a
+// primary key use a unique key instead if they have one that can replace it,
+// see useUniqueKeyAsPrimaryKey, and are rejected otherwise.
 func LoadTables(db *sql.DB, tableFilter TableFilter) (TableSchemaCache, error) {
+	return loadTables(db, tableFilter, false)
+}
+
+// Like LoadTables, but loads the tables without a key as well, which can only
+// be ferried by matching full rows, see IsFullRowMatchTable.
+func LoadTablesWithFullRowMatching(db *sql.DB, tableFilter TableFilter) (TableSchemaCache, error) {
+	return loadTables(db, tableFilter, true)
+}
+
+func loadTables(db *sql.DB, tableFilter TableFilter, fullRowMatching bool) (TableSchemaCache, error) {
 	logger := logrus.WithField("tag", "table_schema_cache")
 
 	tableSchemaCache := make(TableSchemaCache)
@@ -78,22 +217,56 @@ func LoadTables(db *sql.DB, tableFilter TableFilter) (TableSchemaCache, error) {
 			return tableSchemaCache, err
 		}
 
-		var tableSchemas []*schema.Table
+		if nameFilter, ok := tableFilter.(TableNameFilter); ok {
+			tableNames, err = nameFilter.ApplicableTableNames(dbname, tableNames)
+			if err != nil {
+				dbLog.WithError(err).Error("could not apply table name filter")
+				return tableSchemaCache, err
+			}
+		}
 
+		loadedTableNames := make([]string, 0, len(tableNames))
 		for _, table := range tableNames {
-			tableLog := dbLog.WithField("table", table)
-			tableLog.Debug("fetching table schema")
-			tableSchema, err := schema.NewTableFromSqlDB(db, dbname, table)
+			if IsGhostferryTable(table) {
+				dbLog.WithField("table", table).Debug("ignoring ghostferry table")
+				continue
+			}
+			loadedTableNames = append(loadedTableNames, table)
+		}
+
+		dbLog.WithField("tables", len(loadedTableNames)).Debug("fetching table schemas")
+		tableSchemas, err := loadTableSchemas(db, dbname, loadedTableNames)
+		if err != nil {
+			dbLog.WithError(err).Error("cannot fetch table schemas from source db")
+			return tableSchemaCache, err
+		}
+
+		for _, tableSchema := range tableSchemas {
+			tableLog := dbLog.WithField("table", tableSchema.Name)
+
+			addedGIPK, err := addHiddenGeneratedInvisiblePrimaryKey(db, tableSchema)
 			if err != nil {
-				tableLog.WithError(err).Error("cannot fetch table schema from source db")
+				tableLog.WithError(err).Error("cannot check for a hidden generated invisible primary key")
 				return tableSchemaCache, err
 			}
-			tableSchemas = append(tableSchemas, tableSchema)
+			if addedGIPK {
+				tableLog.Info("using hidden generated invisible primary key")
+			}
+
+			uniqueKey, err := useUniqueKeyAsPrimaryKey(db, tableSchema)
+			if err != nil {
+				tableLog.WithError(err).Error("cannot look for a unique key replacing the primary key")
+				return tableSchemaCache, err
+			}
+			if uniqueKey != "" {
+				tableLog.WithField("key", uniqueKey).Info("table has no primary key, using unique key instead")
+			}
 		}
 
 		tableSchemas, err = tableFilter.ApplicableTables(tableSchemas)
 		if err != nil {
-			return tableSchemaCache, nil
+			dbLog.WithError(err).Error("could not apply table filter")
+			return tableSchemaCache, err
 		}
 
 		for _, tableSchema := range tableSchemas {
@@ -101,6 +274,12 @@ func LoadTables(db *sql.DB, tableFilter TableFilter) (TableSchemaCache, error) {
 			tableLog := dbLog.WithField("table", tableName)
 			tableLog.Debug("caching table schema")
 
+			if len(tableSchema.PKColumns) == 0 && fullRowMatching {
+				tableLog.Warn("table has no primary key nor usable unique key, matching full rows")
+				tableSchemaCache[tableSchema.String()] = tableSchema
+				continue
+			}
+
 			// Sanity check
 			if len(tableSchema.PKColumns) != 1 {
 				err = fmt.Errorf("table %s has %d primary key columns and this is not supported", tableName, len(tableSchema.PKColumns))
@@ -118,7 +297,8 @@ func LoadTables(db *sql.DB, tableFilter TableFilter) (TableSchemaCache, error) {
 		}
 	}
 
-	logger.WithField("tables", tableSchemaCache.AllTableNames()).Info("table schemas cached")
+	logger.WithField("tables", len(tableSchemaCache)).Info("table schemas cached")
+	logger.WithField("tables", tableSchemaCache.AllTableNames()).Debug("cached tables")
 
 	return tableSchemaCache, nil
 }
@@ -144,6 +324,112 @@ func (c TableSchemaCache) Get(database, table string) *schema.Table {
 	return c[fullTableName]
 }
 
+// Loads the schemas of the tables of the database, in the same way as
+// schema.NewTableFromSqlDB, but with two queries per database instead of two
+// per table, which made up most of the start of a run on databases with many
+// tables. All the schemas are still loaded before the run starts, as both the
+// DataIterator and the BinlogStreamer need them.
+//
+// The PRIMARY index comes first, followed by the unique and then the other
+// indexes, by name.
+func loadTableSchemas(db *sql.DB, dbname string, tableNames []string) ([]*schema.Table, error) {
+	tables := make(map[string]*schema.Table, len(tableNames))
+	for _, name := range tableNames {
+		tables[name] = &schema.Table{
+			Schema:  dbname,
+			Name:    name,
+			Columns: make([]schema.TableColumn, 0, 16),
+			Indexes: make([]*schema.Index, 0, 8),
+		}
+	}
+
+	columnRows, err := db.Query(
+		"SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, COLLATION_NAME, EXTRA FROM information_schema.COLUMNS "+
+			"WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION",
+		dbname,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer columnRows.Close()
+
+	for columnRows.Next() {
+		var tableName, name, columnType, extra string
+		var collation sql.NullString
+		err = columnRows.Scan(&tableName, &name, &columnType, &collation, &extra)
+		if err != nil {
+			return nil, err
+		}
+
+		if table, exists := tables[tableName]; exists {
+			table.AddColumn(name, columnType, collation.String, extra)
+		}
+	}
+
+	if err = columnRows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexRows, err := db.Query(
+		"SELECT TABLE_NAME, INDEX_NAME, COLUMN_NAME, CARDINALITY FROM information_schema.STATISTICS "+
+			"WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, INDEX_NAME != 'PRIMARY', NON_UNIQUE, INDEX_NAME, SEQ_IN_INDEX",
+		dbname,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer indexRows.Close()
+
+	for indexRows.Next() {
+		var tableName, indexName string
+		var columnName sql.NullString
+		var cardinality sql.NullInt64
+		err = indexRows.Scan(&tableName, &indexName, &columnName, &cardinality)
+		if err != nil {
+			return nil, err
+		}
+
+		table, exists := tables[tableName]
+		if !exists {
+			continue
+		}
+
+		// The rows of an index are consecutive, in the order of its columns.
+		var index *schema.Index
+		if len(table.Indexes) > 0 && table.Indexes[len(table.Indexes)-1].Name == indexName {
+			index = table.Indexes[len(table.Indexes)-1]
+		} else {
+			index = table.AddIndex(indexName)
+		}
+
+		index.AddColumn(columnName.String, uint64(cardinality.Int64))
+	}
+
+	if err = indexRows.Err(); err != nil {
+		return nil, err
+	}
+
+	tableSchemas := make([]*schema.Table, 0, len(tableNames))
+	for _, name := range tableNames {
+		table := tables[name]
+		if len(table.Columns) == 0 {
+			// The table was dropped after its name was listed.
+			return nil, fmt.Errorf("table %s has no columns", table.String())
+		}
+
+		if len(table.Indexes) > 0 && table.Indexes[0].Name == "PRIMARY" {
+			table.PKColumns = make([]int, len(table.Indexes[0].Columns))
+			for i, column := range table.Indexes[0].Columns {
+				table.PKColumns[i] = table.FindColumn(column)
+			}
+		}
+
+		tableSchemas = append(tableSchemas, table)
+	}
+
+	return tableSchemas, nil
+}
+
 func showDatabases(c *sql.DB) ([]string, error) {
 	rows, err := c.Query("show databases")
 	if err != nil {
@@ -0,0 +1,65 @@
+package ghostferry
+
+import (
+	"sync"
+	"time"
+)
+
+// The statistics of a table once it is copied or verified, passed to the
+// OnTableCompleted hooks and posted to the webhooks with the table_copied
+// and table_verified events.
+type TableStats struct {
+	// The full name of the table on the source.
+	Table string
+
+	// The rows copied or verified. The rows copied or verified by the
+	// previous runs of a resumed run are not included.
+	Rows int64
+
+	// The rows that did not match when verified, which are reverified
+	// before and during the cutover. Always 0 once copied.
+	MismatchedRows int64
+
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Accounts for the rows of the tables processed concurrently by a
+// component, until each table is completed.
+type tableStatsTracker struct {
+	mutex  sync.Mutex
+	tables map[string]*TableStats
+}
+
+func newTableStatsTracker() *tableStatsTracker {
+	return &tableStatsTracker{tables: make(map[string]*TableStats)}
+}
+
+func (t *tableStatsTracker) count(table string, rows int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats, exists := t.tables[table]
+	if !exists {
+		stats = &TableStats{Table: table, StartTime: time.Now()}
+		t.tables[table] = stats
+	}
+
+	stats.Rows += rows
+}
+
+// Returns the statistics of the completed table, and stops tracking it.
+func (t *tableStatsTracker) complete(table string) TableStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	stats, exists := t.tables[table]
+	if !exists {
+		stats = &TableStats{Table: table, StartTime: now}
+	}
+	delete(t.tables, table)
+
+	stats.EndTime = now
+	return *stats
+}
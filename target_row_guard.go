@@ -0,0 +1,289 @@
+package ghostferry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// TargetRowGuardConfig configures the checks that nothing but the ferry
+// writes to the target tables. The rows written by another writer are
+// otherwise only found by the verifier, as mismatches whose cause is not
+// obvious. See TargetRowGuard.
+type TargetRowGuardConfig struct {
+	// How often the target is checked for the writes of other writers, as a
+	// Go duration string.
+	//
+	// Optional: defaults to 10s
+	Interval string
+}
+
+func (c *TargetRowGuardConfig) Validate() error {
+	if c.Interval == "" {
+		c.Interval = "10s"
+	}
+
+	if _, err := time.ParseDuration(c.Interval); err != nil {
+		return fmt.Errorf("invalid Interval: %s", err)
+	}
+
+	return nil
+}
+
+// TargetWriteCounter counts the rows that the ferry writes to each target
+// table, keyed by full target table name. The rows are counted as started
+// before the statements writing them are executed, and as finished once the
+// statements returned, whether they succeeded or not, so the rows being
+// written when the TargetRowGuard checks the target are accounted for.
+//
+// A nil counter counts nothing.
+type TargetWriteCounter struct {
+	mutex    sync.Mutex
+	started  map[string]int64
+	finished map[string]int64
+}
+
+func NewTargetWriteCounter() *TargetWriteCounter {
+	return &TargetWriteCounter{
+		started:  make(map[string]int64),
+		finished: make(map[string]int64),
+	}
+}
+
+func (c *TargetWriteCounter) Start(table string, rows int64) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.started[table] += rows
+}
+
+func (c *TargetWriteCounter) Finish(table string, rows int64) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.finished[table] += rows
+}
+
+// Returns the rows that the ferry started writing to each table.
+func (c *TargetWriteCounter) Started() map[string]int64 {
+	return c.snapshot(func() map[string]int64 { return c.started })
+}
+
+// Returns the rows that the ferry finished writing to each table.
+func (c *TargetWriteCounter) Finished() map[string]int64 {
+	return c.snapshot(func() map[string]int64 { return c.finished })
+}
+
+func (c *TargetWriteCounter) snapshot(counts func() map[string]int64) map[string]int64 {
+	snapshot := make(map[string]int64)
+	if c == nil {
+		return snapshot
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for table, rows := range counts() {
+		snapshot[table] = rows
+	}
+	return snapshot
+}
+
+// TargetRowGuard aborts the run when another writer modifies rows of the
+// target tables. It checks every Interval the rows inserted, updated and
+// deleted in each target table since the previous check, as counted by
+// performance_schema.table_io_waits_summary_by_table, against the rows the
+// ferry wrote to the table in the meantime, as counted by Writes. Every row
+// written by a statement of the ferry is counted at most once by the
+// target, so a table with more row writes than the ferry made was written
+// by another writer, whatever its session, transaction or statement.
+//
+// The writes of another writer are only found while they exceed the rows
+// being written by the ferry at the time, so a writer with a small traffic
+// may be missed during the copy, but is found once the ferry only applies
+// the binlog.
+//
+// The performance_schema of the target must be enabled. The target tables
+// are checked to be empty before a new run by the preflight checks, see
+// Preflight.RequireEmptyTarget.
+type TargetRowGuard struct {
+	TargetDB         *sql.DB
+	Tables           []*schema.Table
+	DatabaseRewrites map[string]string
+	TableRewrites    map[string]string
+	Writes           *TargetWriteCounter
+
+	Interval time.Duration
+
+	// The row writes counted by the target and the rows that the ferry
+	// finished writing at the previous check, keyed by full target table
+	// name.
+	lastCounts   map[string]int64
+	lastFinished map[string]int64
+}
+
+// Returns an error listing the target tables with more row writes since the
+// previous check than the ferry made. The first check only records the
+// counts of the target.
+func (g *TargetRowGuard) Check() error {
+	if g.lastCounts == nil {
+		var enabled bool
+		err := g.TargetDB.QueryRow("SELECT @@performance_schema").Scan(&enabled)
+		if err != nil {
+			return fmt.Errorf("failed to check the performance_schema of the target: %v", err)
+		}
+
+		if !enabled {
+			return fmt.Errorf("the performance_schema of the target must be enabled to check for the writes of other writers")
+		}
+	}
+
+	// The rows finished before the counts are read are always included in
+	// the counts, and the rows started after are never.
+	finished := g.Writes.Finished()
+	counts, err := g.targetWriteCounts()
+	if err != nil {
+		return err
+	}
+	started := g.Writes.Started()
+
+	var writers []string
+	if g.lastCounts != nil {
+		for _, table := range sortedKeys(counts) {
+			lastCount, exists := g.lastCounts[table]
+			if !exists {
+				continue
+			}
+
+			// The counts of the target are reset when the table is
+			// altered or flushed from the table cache, which only makes
+			// the writes of the interval negative.
+			written := counts[table] - lastCount
+			expected := started[table] - g.lastFinished[table]
+			if written > expected {
+				writers = append(writers, fmt.Sprintf("%d rows written to %s while the ferry wrote at most %d rows", written, table, expected))
+			}
+		}
+	}
+
+	g.lastCounts = counts
+	g.lastFinished = finished
+
+	if len(writers) > 0 {
+		metrics.Count("TargetRowGuard.UnexpectedWrites", int64(len(writers)), nil, 1.0)
+		return NewClassifiedError(ErrorClassTargetConflict, fmt.Errorf("unexpected writes on the target by another writer: %s", strings.Join(writers, "; ")))
+	}
+
+	return nil
+}
+
+func (g *TargetRowGuard) Run(ctx context.Context) error {
+	err := g.Check()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := g.Check()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Returns the rows inserted, updated and deleted in each target table, as
+// counted by the performance_schema of the target.
+func (g *TargetRowGuard) targetWriteCounts() (map[string]int64, error) {
+	tables := g.targetTables()
+	counts := make(map[string]int64)
+
+	databases := make(map[string]bool)
+	args := make([]interface{}, 0)
+	for table := range tables {
+		database := strings.SplitN(table, ".", 2)[0]
+		if !databases[database] {
+			databases[database] = true
+			args = append(args, database)
+		}
+	}
+
+	if len(args) == 0 {
+		return counts, nil
+	}
+
+	query := fmt.Sprintf(
+		"SELECT OBJECT_SCHEMA, OBJECT_NAME, COUNT_INSERT + COUNT_UPDATE + COUNT_DELETE "+
+			"FROM performance_schema.table_io_waits_summary_by_table "+
+			"WHERE OBJECT_TYPE = 'TABLE' AND OBJECT_SCHEMA IN (%s)",
+		strings.Repeat("?,", len(args)-1)+"?",
+	)
+
+	rows, err := g.TargetDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the table writes of the target: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var database, name string
+		var count int64
+		err = rows.Scan(&database, &name, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		table := database + "." + name
+		if tables[table] {
+			counts[table] = count
+		}
+	}
+
+	return counts, rows.Err()
+}
+
+// Returns the full names of the target tables.
+func (g *TargetRowGuard) targetTables() map[string]bool {
+	tables := make(map[string]bool)
+	for _, table := range g.Tables {
+		database := table.Schema
+		if rewrittenName, exists := g.DatabaseRewrites[database]; exists {
+			database = rewrittenName
+		}
+
+		name := table.Name
+		if rewrittenName, exists := g.TableRewrites[name]; exists {
+			name = rewrittenName
+		}
+
+		tables[database+"."+name] = true
+	}
+	return tables
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
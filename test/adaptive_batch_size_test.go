@@ -0,0 +1,104 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type AdaptiveBatchSizerTestSuite struct {
+	suite.Suite
+
+	sizer *ghostferry.AdaptiveBatchSizer
+}
+
+func (this *AdaptiveBatchSizerTestSuite) SetupTest() {
+	this.sizer = &ghostferry.AdaptiveBatchSizer{
+		TargetDuration: 100 * time.Millisecond,
+		MaxBatchBytes:  1000000,
+		MinBatchSize:   10,
+		MaxBatchSize:   10000,
+	}
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestStartsAtInitialSize() {
+	this.Require().Equal(uint64(200), this.sizer.BatchSize("gftest.table1", 200))
+	this.Require().Equal(uint64(10), this.sizer.BatchSize("gftest.table1", 1))
+	this.Require().Equal(uint64(10000), this.sizer.BatchSize("gftest.table1", 50000))
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestGrowsAtMostTwiceAsLarge() {
+	size := this.sizer.Observe("gftest.table1", 200, 200, 2000, time.Millisecond)
+	this.Require().Equal(uint64(400), size)
+	this.Require().Equal(uint64(400), this.sizer.BatchSize("gftest.table1", 200))
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestShrinksToTargetDuration() {
+	size := this.sizer.Observe("gftest.table1", 200, 200, 2000, time.Second)
+	this.Require().Equal(uint64(20), size)
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestShrinksToMaxBatchBytes() {
+	size := this.sizer.Observe("gftest.table1", 200, 200, 200*50000, time.Millisecond)
+	this.Require().Equal(uint64(20), size)
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestClampsToBounds() {
+	size := this.sizer.Observe("gftest.table1", 200, 200, 2000, time.Hour)
+	this.Require().Equal(uint64(10), size)
+
+	size = this.sizer.Observe("gftest.table2", 8000, 8000, 8000, time.Millisecond)
+	this.Require().Equal(uint64(10000), size)
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestTablesAreSizedIndependently() {
+	this.sizer.Observe("gftest.table1", 200, 200, 2000, time.Second)
+
+	this.Require().Equal(uint64(20), this.sizer.BatchSize("gftest.table1", 200))
+	this.Require().Equal(uint64(200), this.sizer.BatchSize("gftest.table2", 200))
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestEmptyBatchKeepsSize() {
+	size := this.sizer.Observe("gftest.table1", 200, 0, 0, time.Millisecond)
+	this.Require().Equal(uint64(200), size)
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestEstimatesInitialSizeFromAverageRow() {
+	this.sizer.EstimateFromAverageRow("gftest.table1", 200, 50000)
+	this.Require().Equal(uint64(20), this.sizer.BatchSize("gftest.table1", 200))
+
+	this.sizer.EstimateFromAverageRow("gftest.table2", 200, 100)
+	this.Require().Equal(uint64(200), this.sizer.BatchSize("gftest.table2", 200))
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestLargeRowReadsSingleRows() {
+	this.sizer.LargeRowBytes = 4000
+
+	this.Require().False(this.sizer.ObserveLargestRow("gftest.table1", 4000))
+	this.Require().Equal(uint64(200), this.sizer.BatchSize("gftest.table1", 200))
+
+	this.Require().True(this.sizer.ObserveLargestRow("gftest.table1", 4001))
+	this.Require().Equal(uint64(1), this.sizer.BatchSize("gftest.table1", 200))
+}
+
+func (this *AdaptiveBatchSizerTestSuite) TestGrowsBackToInitialSizeWithoutTarget() {
+	this.sizer = &ghostferry.AdaptiveBatchSizer{LargeRowBytes: 4000, MinBatchSize: 10}
+
+	this.Require().Equal(uint64(200), this.sizer.BatchSize("gftest.table1", 200))
+	this.sizer.ObserveLargestRow("gftest.table1", 5000000)
+
+	sizes := []uint64{}
+	size := this.sizer.BatchSize("gftest.table1", 200)
+	for i := 0; i < 6; i++ {
+		size = this.sizer.Observe("gftest.table1", size, int(size), size*100, time.Millisecond)
+		sizes = append(sizes, size)
+	}
+
+	this.Require().Equal([]uint64{10, 20, 40, 80, 160, 200}, sizes)
+}
+
+func TestAdaptiveBatchSizerTestSuite(t *testing.T) {
+	suite.Run(t, new(AdaptiveBatchSizerTestSuite))
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogMarksTheRowsOfStatementsIgnoringRowsAsAttempted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghostferry-audit")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.AuditLogDirectory = dir
+
+	conflicting := make(map[uint64]bool)
+	testcase := &testhelpers.IntegrationTestCase{
+		T: t,
+		SetupAction: func(f *testhelpers.TestFerry) {
+			setupSingleTableDatabase(f)
+
+			rows, err := f.SourceDB.Query("SELECT id, data FROM gftest.table1 ORDER BY id LIMIT 10")
+			testhelpers.PanicIfError(err)
+			defer rows.Close()
+
+			for rows.Next() {
+				var id uint64
+				var data string
+				testhelpers.PanicIfError(rows.Scan(&id, &data))
+
+				_, err = f.TargetDB.Exec("INSERT INTO gftest.table1 (id, data) VALUES (?, ?)", id, data)
+				testhelpers.PanicIfError(err)
+				conflicting[id] = true
+			}
+			testhelpers.PanicIfError(rows.Err())
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+
+	files, err := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	require.Nil(t, err)
+
+	attempted := 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		require.Nil(t, err)
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record ghostferry.AuditRecord
+			require.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+
+			if record.Source == ghostferry.AuditSourceCopy && conflicting[record.PK] {
+				require.True(t, record.Attempted, "row %d", record.PK)
+				attempted++
+			}
+		}
+		f.Close()
+	}
+
+	require.Equal(t, len(conflicting), attempted)
+}
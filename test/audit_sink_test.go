@@ -0,0 +1,155 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type AuditSinkTestSuite struct {
+	suite.Suite
+
+	dir   string
+	sink  *ghostferry.AuditSink
+	table *schema.Table
+}
+
+func (this *AuditSinkTestSuite) SetupTest() {
+	var err error
+	this.dir, err = ioutil.TempDir("", "ghostferry-audit")
+	this.Require().Nil(err)
+
+	this.sink = &ghostferry.AuditSink{
+		Directory:   this.dir,
+		MaxFileSize: 1024 * 1024,
+		FerryId:     "ferry-1",
+	}
+	this.Require().Nil(this.sink.Initialize())
+
+	this.table = &schema.Table{
+		Schema:    "gftest",
+		Name:      "table1",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "data"}},
+		PKColumns: []int{0},
+	}
+}
+
+func (this *AuditSinkTestSuite) TearDownTest() {
+	os.RemoveAll(this.dir)
+}
+
+func (this *AuditSinkTestSuite) readRecords() []ghostferry.AuditRecord {
+	files, err := filepath.Glob(filepath.Join(this.dir, "audit-*.jsonl"))
+	this.Require().Nil(err)
+	sort.Strings(files)
+
+	records := []ghostferry.AuditRecord{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		this.Require().Nil(err)
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record ghostferry.AuditRecord
+			this.Require().Nil(json.Unmarshal(scanner.Bytes(), &record))
+			records = append(records, record)
+		}
+		f.Close()
+	}
+
+	return records
+}
+
+func (this *AuditSinkTestSuite) TestRecordsBinlogEvents() {
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.UPDATE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{{int64(1), []byte("old")}, {int64(1), []byte("new")}},
+		},
+	}
+
+	pos := mysql.Position{Name: "mysql-bin.000001", Pos: 1234}
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.table, ev, pos)
+	this.Require().Nil(err)
+
+	this.Require().Nil(this.sink.RecordDMLEvent(dmlEvents[0], "gftest2", "table1", false))
+	this.Require().Nil(this.sink.Close())
+
+	records := this.readRecords()
+	this.Require().Equal(1, len(records))
+
+	record := records[0]
+	this.Require().Equal(ghostferry.AuditSourceBinlog, record.Source)
+	this.Require().Equal("update", record.Type)
+	this.Require().Equal("gftest", record.Database)
+	this.Require().Equal("gftest2", record.TargetDatabase)
+	this.Require().Equal(uint64(1), record.PK)
+	this.Require().Equal("old", record.Before["data"])
+	this.Require().Equal("new", record.After["data"])
+	this.Require().Equal(&pos, record.BinlogPosition)
+	this.Require().Equal("ferry-1", record.FerryId)
+}
+
+func (this *AuditSinkTestSuite) TestRecordsCopiedRows() {
+	batch := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{
+		{int64(1), []byte("a")},
+		{int64(2), []byte{0xff}},
+	}, 0)
+
+	this.Require().Nil(this.sink.RecordRowBatch(batch, "gftest", "table1", false))
+	this.Require().Nil(this.sink.Close())
+
+	records := this.readRecords()
+	this.Require().Equal(2, len(records))
+	this.Require().Equal(ghostferry.AuditSourceCopy, records[0].Source)
+	this.Require().Equal("insert", records[0].Type)
+	this.Require().Equal(uint64(2), records[1].PK)
+	this.Require().Equal("a", records[0].After["data"])
+	this.Require().Equal("/w==", records[1].After["data"])
+	this.Require().Nil(records[0].Before)
+	this.Require().Nil(records[0].BinlogPosition)
+	this.Require().False(records[0].Attempted)
+}
+
+func (this *AuditSinkTestSuite) TestMarksAttemptedRows() {
+	batch := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{{int64(1), []byte("a")}}, 0)
+
+	this.Require().Nil(this.sink.RecordRowBatch(batch, "gftest", "table1", true))
+	this.Require().Nil(this.sink.Close())
+
+	records := this.readRecords()
+	this.Require().Equal(1, len(records))
+	this.Require().True(records[0].Attempted)
+}
+
+func (this *AuditSinkTestSuite) TestRotatesFiles() {
+	this.sink.MaxFileSize = 1
+
+	batch := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{
+		{int64(1), []byte("a")},
+		{int64(2), []byte("b")},
+		{int64(3), []byte("c")},
+	}, 0)
+
+	this.Require().Nil(this.sink.RecordRowBatch(batch, "gftest", "table1", false))
+	this.Require().Nil(this.sink.Close())
+
+	files, err := filepath.Glob(filepath.Join(this.dir, "audit-*.jsonl"))
+	this.Require().Nil(err)
+	this.Require().Equal(3, len(files))
+	this.Require().Equal(3, len(this.readRecords()))
+}
+
+func TestAuditSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditSinkTestSuite))
+}
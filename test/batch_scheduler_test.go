@@ -0,0 +1,168 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type BatchSchedulerTestSuite struct {
+	suite.Suite
+}
+
+func (this *BatchSchedulerTestSuite) TestLimitsBatchesInFlight() {
+	scheduler := ghostferry.NewBatchScheduler(2)
+
+	mutex := &sync.Mutex{}
+	inFlight, maxInFlight := 0, 0
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.Acquire("gftest.table1")
+
+			mutex.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mutex.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mutex.Lock()
+			inFlight--
+			mutex.Unlock()
+
+			scheduler.Release("gftest.table1")
+		}()
+	}
+
+	wg.Wait()
+	this.Require().Equal(2, maxInFlight)
+}
+
+func (this *BatchSchedulerTestSuite) TestWaitingTablesAreScheduledByWeight() {
+	scheduler := ghostferry.NewBatchScheduler(1)
+	this.Require().Nil(scheduler.SetTableWeight("gftest.a", 2))
+
+	// Hold the only slot until all the batches are waiting.
+	scheduler.Acquire("gftest.holder")
+
+	mutex := &sync.Mutex{}
+	order := []string{}
+
+	wg := &sync.WaitGroup{}
+	for _, table := range []string{"gftest.a", "gftest.a", "gftest.a", "gftest.b", "gftest.b", "gftest.b"} {
+		wg.Add(1)
+		go func(table string) {
+			defer wg.Done()
+			scheduler.Acquire(table)
+
+			mutex.Lock()
+			order = append(order, table)
+			mutex.Unlock()
+
+			scheduler.Release(table)
+		}(table)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	scheduler.Release("gftest.holder")
+	wg.Wait()
+
+	this.Require().Equal([]string{"gftest.a", "gftest.b", "gftest.a", "gftest.a", "gftest.b", "gftest.b"}, order)
+}
+
+func (this *BatchSchedulerTestSuite) TestWeightedTableCopiesMoreBatchesWithTheDefaultTableConcurrency() {
+	concurrency := ghostferry.DefaultDataIterationConcurrency
+	scheduler := ghostferry.NewBatchScheduler(concurrency)
+	this.Require().Nil(scheduler.SetTableWeight("gftest.table0", 3))
+
+	mutex := &sync.Mutex{}
+	batches := make(map[string]int)
+	total := 0
+
+	// One cursor per table iterated, as the DataIterator does, with as many
+	// tables as the default DataIterationTableConcurrency.
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 2*concurrency; i++ {
+		wg.Add(1)
+		go func(table string) {
+			defer wg.Done()
+			for {
+				scheduler.Acquire(table)
+
+				mutex.Lock()
+				done := total >= 400
+				if !done {
+					batches[table]++
+					total++
+				}
+				mutex.Unlock()
+
+				time.Sleep(time.Millisecond)
+				scheduler.Release(table)
+
+				if done {
+					return
+				}
+			}
+		}(fmt.Sprintf("gftest.table%d", i))
+	}
+
+	wg.Wait()
+
+	for i := 1; i < 2*concurrency; i++ {
+		table := fmt.Sprintf("gftest.table%d", i)
+		this.Require().True(2*batches["gftest.table0"] > 3*batches[table], "%v", batches)
+	}
+}
+
+func (this *BatchSchedulerTestSuite) TestTableWeights() {
+	scheduler := ghostferry.NewBatchScheduler(1)
+	this.Require().Equal(ghostferry.DefaultTableWeight, scheduler.TableWeight("gftest.table1"))
+
+	this.Require().Nil(scheduler.SetTableWeight("gftest.table1", 5))
+	this.Require().Equal(5, scheduler.TableWeight("gftest.table1"))
+
+	err := scheduler.SetTableWeight("gftest.table1", 0)
+	this.Require().EqualError(err, "weight of table gftest.table1 must be at least 1, got 0")
+	this.Require().Equal(5, scheduler.TableWeight("gftest.table1"))
+}
+
+func (this *BatchSchedulerTestSuite) TestRaisingConcurrencyGrantsWaitingBatches() {
+	scheduler := ghostferry.NewBatchScheduler(1)
+	scheduler.Acquire("gftest.table1")
+
+	acquired := make(chan struct{})
+	go func() {
+		scheduler.Acquire("gftest.table2")
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		this.Fail("the batch should wait for the only slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	scheduler.SetConcurrency(2)
+	this.Require().Equal(2, scheduler.Concurrency())
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		this.Fail("the batch should get the new slot")
+	}
+}
+
+func TestBatchSchedulerTestSuite(t *testing.T) {
+	suite.Run(t, new(BatchSchedulerTestSuite))
+}
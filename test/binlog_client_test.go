@@ -0,0 +1,73 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/stretchr/testify/suite"
+)
+
+// Counts the events streamed by the go-mysql client it wraps.
+type countingBinlogClient struct {
+	ghostferry.BinlogClient
+	events *int64
+}
+
+func (c countingBinlogClient) StartSync(pos mysql.Position) (ghostferry.BinlogEventStream, error) {
+	stream, err := c.BinlogClient.StartSync(pos)
+	if err != nil {
+		return nil, err
+	}
+	return countingBinlogEventStream{stream, c.events}, nil
+}
+
+type countingBinlogEventStream struct {
+	ghostferry.BinlogEventStream
+	events *int64
+}
+
+func (s countingBinlogEventStream) GetEvent(ctx context.Context) (*replication.BinlogEvent, error) {
+	ev, err := s.BinlogEventStream.GetEvent(ctx)
+	if err == nil {
+		atomic.AddInt64(s.events, 1)
+	}
+	return ev, err
+}
+
+var countedBinlogEvents int64
+
+func init() {
+	ghostferry.RegisterBinlogClient("counting", func(config ghostferry.BinlogClientConfig) (ghostferry.BinlogClient, error) {
+		client, err := ghostferry.NewGoMySQLBinlogClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return countingBinlogClient{client, &countedBinlogEvents}, nil
+	})
+}
+
+type BinlogClientTestSuite struct {
+	suite.Suite
+}
+
+func (this *BinlogClientTestSuite) TestRegistersClients() {
+	this.Require().Equal([]string{"counting", ghostferry.BinlogClientGoMySQL}, ghostferry.RegisteredBinlogClients())
+}
+
+func (this *BinlogClientTestSuite) TestRegisteringPanicsOnNilOrDuplicateFactory() {
+	this.Require().Panics(func() {
+		ghostferry.RegisterBinlogClient("nil", nil)
+	})
+
+	this.Require().Panics(func() {
+		ghostferry.RegisterBinlogClient(ghostferry.BinlogClientGoMySQL, ghostferry.NewGoMySQLBinlogClient)
+	})
+}
+
+func TestBinlogClientTestSuite(t *testing.T) {
+	suite.Run(t, new(BinlogClientTestSuite))
+}
@@ -2,6 +2,9 @@ package test
 
 import (
 	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/Shopify/ghostferry"
@@ -70,6 +73,119 @@ func (this *FerryTestSuite) TestConnectErrorsOutIfErrorInServerIdGeneration() {
 	this.Require().Zero(this.binlogStreamer.Config.MyServerId)
 }
 
+func (this *FerryTestSuite) TestFilterBeforeDecodingOnlyStreamsTrackedTables() {
+	this.SeedSourceDB(0)
+	testhelpers.SeedInitialData(this.Ferry.SourceDB, testhelpers.TestSchemaName, "untracked_table", 0)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+	delete(tables, fmt.Sprintf("%s.untracked_table", testhelpers.TestSchemaName))
+
+	this.binlogStreamer.Config.FilterBinlogBeforeDecoding = true
+	this.binlogStreamer.TableSchema = tables
+
+	var eventTables []string
+	this.binlogStreamer.AddEventListener(func(events []ghostferry.DMLEvent) error {
+		for _, event := range events {
+			eventTables = append(eventTables, event.Table())
+		}
+		return nil
+	})
+
+	this.Require().Nil(this.binlogStreamer.ConnectBinlogStreamerToMysql())
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		this.binlogStreamer.Run()
+	}()
+
+	for _, table := range []string{"untracked_table", testhelpers.TestTable1Name, "untracked_table"} {
+		_, err = this.Ferry.SourceDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (data) VALUES ('data')", testhelpers.TestSchemaName, table))
+		this.Require().Nil(err)
+	}
+
+	this.binlogStreamer.FlushAndStop()
+	wg.Wait()
+
+	this.Require().Equal([]string{testhelpers.TestTable1Name}, eventTables)
+}
+
+func (this *FerryTestSuite) TestMapsTheColumnsOfTablesAlteredOnTheSource() {
+	this.SeedSourceDB(0)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+	this.binlogStreamer.TableSchema = tables
+
+	var values []ghostferry.RowData
+	this.binlogStreamer.AddEventListener(func(events []ghostferry.DMLEvent) error {
+		for _, event := range events {
+			values = append(values, event.NewValues())
+		}
+		return nil
+	})
+
+	this.Require().Nil(this.binlogStreamer.ConnectBinlogStreamerToMysql())
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		this.binlogStreamer.Run()
+	}()
+
+	_, err = this.Ferry.SourceDB.Exec(fmt.Sprintf("ALTER TABLE `%s`.`%s` ADD COLUMN extra INT FIRST", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+	_, err = this.Ferry.SourceDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data, extra) VALUES (1, 'data', 42)", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	this.binlogStreamer.FlushAndStop()
+	wg.Wait()
+
+	// The added column is left out, as the target does not have it.
+	this.Require().Equal(1, len(values))
+	this.Require().Equal(2, len(values[0]))
+	this.Require().Equal(int64(1), values[0][0])
+}
+
+func (this *FerryTestSuite) TestStreamsThroughTheConfiguredBinlogClient() {
+	this.SeedSourceDB(0)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+	this.binlogStreamer.TableSchema = tables
+	this.binlogStreamer.Config.BinlogClient = "counting"
+
+	var eventTables []string
+	this.binlogStreamer.AddEventListener(func(events []ghostferry.DMLEvent) error {
+		for _, event := range events {
+			eventTables = append(eventTables, event.Table())
+		}
+		return nil
+	})
+
+	eventsBefore := atomic.LoadInt64(&countedBinlogEvents)
+	this.Require().Nil(this.binlogStreamer.ConnectBinlogStreamerToMysql())
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		this.binlogStreamer.Run()
+	}()
+
+	_, err = this.Ferry.SourceDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (data) VALUES ('data')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	this.binlogStreamer.FlushAndStop()
+	wg.Wait()
+
+	this.Require().Equal([]string{testhelpers.TestTable1Name}, eventTables)
+	this.Require().True(atomic.LoadInt64(&countedBinlogEvents) > eventsBefore)
+}
+
 func TestFerryTestSuite(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, &FerryTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type BinlogTimelineTestSuite struct {
+	suite.Suite
+
+	start time.Time
+}
+
+func (this *BinlogTimelineTestSuite) SetupTest() {
+	this.start = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func (this *BinlogTimelineTestSuite) TestRecordsPositionsAnIntervalApart() {
+	timeline := &ghostferry.BinlogTimeline{Interval: time.Minute}
+	timeline.Record(this.position(1, 100), this.start)
+	timeline.Record(this.position(1, 200), this.start.Add(30*time.Second))
+	timeline.Record(this.position(1, 300), this.start.Add(time.Minute))
+	timeline.Record(this.position(2, 4), this.start.Add(3*time.Minute))
+
+	// Streamed again after a reconnection.
+	timeline.Record(this.position(1, 300), this.start.Add(5*time.Minute))
+
+	this.Require().Equal([]ghostferry.BinlogTimelineEntry{
+		{Position: this.position(1, 100), EventTime: this.start},
+		{Position: this.position(1, 300), EventTime: this.start.Add(time.Minute)},
+		{Position: this.position(2, 4), EventTime: this.start.Add(3 * time.Minute)},
+	}, timeline.Entries())
+}
+
+func (this *BinlogTimelineTestSuite) TestKeepsTheLatestEntries() {
+	timeline := &ghostferry.BinlogTimeline{Interval: time.Minute, MaxEntries: 2}
+	for i := 0; i < 5; i++ {
+		timeline.Record(this.position(1, uint32(100*(i+1))), this.start.Add(time.Duration(i)*time.Minute))
+	}
+
+	entries := timeline.Entries()
+	this.Require().Equal(2, len(entries))
+	this.Require().Equal(this.position(1, 400), entries[0].Position)
+	this.Require().Equal(this.position(1, 500), entries[1].Position)
+}
+
+func (this *BinlogTimelineTestSuite) TestTranslatesPositionsAndTimes() {
+	timeline := &ghostferry.BinlogTimeline{Interval: time.Minute}
+	timeline.Restore([]ghostferry.BinlogTimelineEntry{
+		{Position: this.position(1, 100), EventTime: this.start},
+		{Position: this.position(2, 4), EventTime: this.start.Add(10 * time.Minute)},
+	})
+
+	_, found := timeline.EventTime(this.position(1, 50))
+	this.Require().False(found)
+
+	eventTime, found := timeline.EventTime(this.position(1, 5000))
+	this.Require().True(found)
+	this.Require().Equal(this.start, eventTime)
+
+	eventTime, found = timeline.EventTime(this.position(3, 4))
+	this.Require().True(found)
+	this.Require().Equal(this.start.Add(10*time.Minute), eventTime)
+
+	_, found = timeline.Position(this.start.Add(-time.Second))
+	this.Require().False(found)
+
+	pos, found := timeline.Position(this.start.Add(5 * time.Minute))
+	this.Require().True(found)
+	this.Require().Equal(this.position(1, 100), pos)
+}
+
+func (this *BinlogTimelineTestSuite) TestIsKeptInTheState() {
+	state := &ghostferry.SerializableState{
+		LastSuccessfulBinlogPos: this.position(2, 4),
+		BinlogTimeline: []ghostferry.BinlogTimelineEntry{
+			{Position: this.position(1, 100), EventTime: this.start},
+		},
+	}
+
+	dump, err := state.Dump()
+	this.Require().Nil(err)
+
+	parsed, err := ghostferry.ParseStateDump(dump)
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(parsed.BinlogTimeline))
+	this.Require().Equal(this.position(1, 100), parsed.BinlogTimeline[0].Position)
+	this.Require().True(this.start.Equal(parsed.BinlogTimeline[0].EventTime))
+}
+
+func (this *BinlogTimelineTestSuite) position(file int, pos uint32) mysql.Position {
+	return mysql.Position{Name: fmt.Sprintf("mysql-bin.%06d", file), Pos: pos}
+}
+
+func TestBinlogTimelineTestSuite(t *testing.T) {
+	suite.Run(t, new(BinlogTimelineTestSuite))
+}
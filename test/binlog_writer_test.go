@@ -0,0 +1,146 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type BinlogWriterTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	table *schema.Table
+}
+
+func (this *BinlogWriterTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedTargetDB(0)
+
+	this.table = &schema.Table{Schema: testhelpers.TestSchemaName, Name: testhelpers.TestTable1Name}
+	this.table.AddColumn("id", "bigint(20)", "", "auto_increment")
+	this.table.AddColumn("data", "text", "", "")
+	this.table.PKColumns = []int{0}
+}
+
+func (this *BinlogWriterTestSuite) TestCoalescesConsecutiveInserts() {
+	inserts, err := ghostferry.NewBinlogInsertEvents(this.table, &replication.RowsEvent{
+		Rows: [][]interface{}{
+			{int64(1), "a"},
+			{int64(2), "b"},
+			{int64(3), "c"},
+		},
+	})
+	this.Require().Nil(err)
+
+	updates, err := ghostferry.NewBinlogUpdateEvents(this.table, &replication.RowsEvent{
+		Rows: [][]interface{}{
+			{int64(1), "a"},
+			{int64(1), "d"},
+		},
+	})
+	this.Require().Nil(err)
+
+	last, err := ghostferry.NewBinlogInsertEvents(this.table, &replication.RowsEvent{
+		Rows: [][]interface{}{{int64(4), "e"}},
+	})
+	this.Require().Nil(err)
+
+	events := append(append(inserts, updates...), last...)
+
+	writer := &ghostferry.BinlogWriter{
+		DB:              this.Ferry.TargetDB,
+		BatchSize:       len(events),
+		InsertBatchSize: 2,
+		WriteRetries:    1,
+		Dialect:         ghostferry.MySQLDialect{},
+		ErrorHandler:    &ghostferry.PanicErrorHandler{Ferry: this.Ferry},
+	}
+	this.Require().Nil(writer.Initialize())
+
+	insertsBefore := this.insertStatementCount()
+
+	this.Require().Nil(writer.BufferBinlogEvents(events))
+	writer.Stop()
+	writer.Run()
+
+	// The three inserts are written by two statements, and the last insert
+	// is not coalesced with them as the update is written in between.
+	this.Require().Equal(3, this.insertStatementCount()-insertsBefore)
+
+	rows, err := this.Ferry.TargetDB.Query("SELECT id, data FROM gftest.test_table_1 ORDER BY id")
+	this.Require().Nil(err)
+	defer rows.Close()
+
+	data := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		this.Require().Nil(rows.Scan(&id, &value))
+		data[id] = value
+	}
+	this.Require().Equal(map[int64]string{1: "d", 2: "b", 3: "c", 4: "e"}, data)
+}
+
+func (this *BinlogWriterTestSuite) TestSplitsLargeTransactions() {
+	events, err := ghostferry.NewBinlogInsertEvents(this.table, &replication.RowsEvent{
+		Rows: [][]interface{}{
+			{int64(1), "a"},
+			{int64(2), "b"},
+			{int64(3), "c"},
+			{int64(4), "d"},
+			{int64(5), "e"},
+		},
+	})
+	this.Require().Nil(err)
+
+	writer := &ghostferry.BinlogWriter{
+		DB:                   this.Ferry.TargetDB,
+		BatchSize:            1,
+		InsertBatchSize:      2,
+		MaxTransactionRows:   3,
+		PreserveTransactions: true,
+		WriteRetries:         1,
+		Dialect:              ghostferry.MySQLDialect{},
+		ErrorHandler:         &ghostferry.PanicErrorHandler{Ferry: this.Ferry},
+	}
+	this.Require().Nil(writer.Initialize())
+
+	commitsBefore := this.statementCount("Com_commit")
+	insertsBefore := this.statementCount("Com_insert")
+
+	this.Require().Nil(writer.BufferBinlogEvents(events))
+	writer.Stop()
+	writer.Run()
+
+	// The transaction of five inserts is written in two transactions of
+	// three and two inserts, and the third insert is not coalesced with the
+	// fourth as they are written in different transactions.
+	this.Require().Equal(2, this.statementCount("Com_commit")-commitsBefore)
+	this.Require().Equal(3, this.statementCount("Com_insert")-insertsBefore)
+
+	var count int
+	row := this.Ferry.TargetDB.QueryRow("SELECT COUNT(*) FROM gftest.test_table_1")
+	this.Require().Nil(row.Scan(&count))
+	this.Require().Equal(5, count)
+}
+
+func (this *BinlogWriterTestSuite) insertStatementCount() int {
+	return this.statementCount("Com_insert")
+}
+
+func (this *BinlogWriterTestSuite) statementCount(status string) int {
+	var name string
+	var count int
+	row := this.Ferry.TargetDB.QueryRow("SHOW GLOBAL STATUS LIKE ?", status)
+	this.Require().Nil(row.Scan(&name, &count))
+	return count
+}
+
+func TestBinlogWriterTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &BinlogWriterTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type CharsetConversionTestSuite struct {
+	suite.Suite
+
+	table *schema.Table
+}
+
+func (this *CharsetConversionTestSuite) SetupTest() {
+	this.table = &schema.Table{Schema: "gftest", Name: "latin1_table"}
+	this.table.AddColumn("id", "bigint(20)", "", "")
+	this.table.AddColumn("name", "varchar(255)", "latin1_swedish_ci", "")
+	this.table.AddColumn("body", "text", "latin1_swedish_ci", "")
+	this.table.AddColumn("kind", "enum('a','b')", "latin1_swedish_ci", "")
+	this.table.AddColumn("data", "varchar(255)", "utf8mb4_unicode_ci", "")
+	this.table.PKColumns = []int{0}
+}
+
+func (this *CharsetConversionTestSuite) TestConvertsLatin1ValuesOfBinlogEvents() {
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.UPDATE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{
+				{int64(1), "caf\xe9", []byte("\x80 \x81"), int64(1), "caf\xc3\xa9"},
+				{int64(1), "na\xefve", []byte("\xff"), int64(2), "d"},
+			},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.table, ev, mysql.Position{})
+	this.Require().Nil(err)
+
+	converted := ghostferry.ConvertLatin1Events(dmlEvents)
+	this.Require().Equal(1, len(converted))
+	this.Require().Equal(ghostferry.RowData{int64(1), "café", []byte("€ \u0081"), int64(1), "café"}, converted[0].OldValues())
+	this.Require().Equal(ghostferry.RowData{int64(1), "naïve", []byte("ÿ"), int64(2), "d"}, converted[0].NewValues())
+
+	// The original event is not modified.
+	this.Require().Equal("caf\xe9", dmlEvents[0].OldValues()[1])
+}
+
+func (this *CharsetConversionTestSuite) TestFingerprintsLatin1ColumnsAsUtf8mb4() {
+	sql, _, err := ghostferry.GetMd5HashesSql("gftest", "latin1_table", "id", this.table.Columns[:2], []uint64{1})
+	this.Require().Nil(err)
+	this.Require().Contains(sql, "MD5(COALESCE(CONVERT(`name` USING utf8mb4), 'NULL'))")
+	this.Require().Contains(sql, "MD5(COALESCE(`id`, 'NULL'))")
+}
+
+func (this *CharsetConversionTestSuite) TestConvertsCreateTableToUtf8mb4() {
+	createTable := "CREATE TABLE `gftest`.`latin1_table` (\n" +
+		"  `id` bigint(20) NOT NULL,\n" +
+		"  `name` varchar(255) CHARACTER SET latin1 COLLATE latin1_bin DEFAULT NULL,\n" +
+		"  `body` text COLLATE latin1_german1_ci,\n" +
+		"  `data` varchar(255) CHARACTER SET utf8mb4 DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=latin1 COLLATE=latin1_swedish_ci"
+
+	this.Require().Equal(
+		"CREATE TABLE `gftest`.`latin1_table` (\n"+
+			"  `id` bigint(20) NOT NULL,\n"+
+			"  `name` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin DEFAULT NULL,\n"+
+			"  `body` text,\n"+
+			"  `data` varchar(255) CHARACTER SET utf8mb4 DEFAULT NULL,\n"+
+			"  PRIMARY KEY (`id`)\n"+
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		ghostferry.ConvertLatin1ToUtf8mb4CreateTable(createTable),
+	)
+}
+
+func TestCharsetConversionTestSuite(t *testing.T) {
+	suite.Run(t, new(CharsetConversionTestSuite))
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type CheckpointerTestSuite struct {
+	suite.Suite
+
+	dir          string
+	ferry        *ghostferry.Ferry
+	checkpointer *ghostferry.Checkpointer
+}
+
+func (this *CheckpointerTestSuite) SetupTest() {
+	var err error
+	this.dir, err = ioutil.TempDir("", "ghostferry-checkpoint")
+	this.Require().Nil(err)
+
+	binlogWriter := &ghostferry.BinlogWriter{}
+	this.Require().Nil(binlogWriter.Initialize())
+	binlogWriter.SetStartBinlogPosition(mysql.Position{Name: "mysql-bin.000001", Pos: 4})
+
+	dataIterator := &ghostferry.DataIterator{Concurrency: 1}
+	this.Require().Nil(dataIterator.Initialize())
+	dataIterator.CurrentState.UpdateLastSuccessfulPK("gftest.table1", 10)
+
+	this.ferry = &ghostferry.Ferry{
+		BinlogStreamer: &ghostferry.BinlogStreamer{},
+		BinlogWriter:   binlogWriter,
+		DataIterator:   dataIterator,
+	}
+
+	this.checkpointer = &ghostferry.Checkpointer{
+		Ferry:     this.ferry,
+		StateFile: filepath.Join(this.dir, "state.json"),
+	}
+	this.Require().Nil(this.checkpointer.Initialize())
+}
+
+func (this *CheckpointerTestSuite) TearDownTest() {
+	os.RemoveAll(this.dir)
+}
+
+func (this *CheckpointerTestSuite) TestCheckpointWritesResumableState() {
+	this.Require().Nil(this.checkpointer.Checkpoint())
+
+	data, err := ioutil.ReadFile(this.checkpointer.StateFile)
+	this.Require().Nil(err)
+
+	state, err := ghostferry.ParseStateDump(data)
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000001", Pos: 4}, state.LastSuccessfulBinlogPos)
+	this.Require().Equal(map[string]uint64{"gftest.table1": 10}, state.LastSuccessfulPrimaryKeys)
+
+	lastCheckpoint, err := this.checkpointer.LastCheckpoint()
+	this.Require().Nil(err)
+	this.Require().False(lastCheckpoint.IsZero())
+
+	files, err := ioutil.ReadDir(this.dir)
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(files))
+}
+
+func (this *CheckpointerTestSuite) TestFileStateStoreLoadsSavedState() {
+	store := &ghostferry.FileStateStore{Path: this.checkpointer.StateFile}
+	this.Require().Nil(store.SaveState(this.ferry.SerializeState()))
+
+	state, err := store.LoadState()
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000001", Pos: 4}, state.LastSuccessfulBinlogPos)
+
+	// No temporary file is left behind.
+	files, err := ioutil.ReadDir(this.dir)
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(files))
+}
+
+func (this *CheckpointerTestSuite) TestFileStateStoreRefusesTruncatedState() {
+	store := &ghostferry.FileStateStore{Path: this.checkpointer.StateFile}
+	this.Require().Nil(store.SaveState(this.ferry.SerializeState()))
+
+	data, err := ioutil.ReadFile(store.Path)
+	this.Require().Nil(err)
+	this.Require().Nil(ioutil.WriteFile(store.Path, data[:len(data)/2], 0644))
+
+	_, err = store.LoadState()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "refusing to resume from the state in "+store.Path)
+	this.Require().Contains(err.Error(), "it may be truncated")
+}
+
+func (this *CheckpointerTestSuite) TestFailedCheckpointIsReported() {
+	this.checkpointer.StateFile = filepath.Join(this.dir, "missing", "state.json")
+
+	this.Require().NotNil(this.checkpointer.Checkpoint())
+
+	_, err := this.checkpointer.LastCheckpoint()
+	this.Require().NotNil(err)
+}
+
+func (this *CheckpointerTestSuite) TestCheckpointOmitsPositionOfCompletedTables() {
+	this.ferry.DataIterator.CurrentState.UpdateLastSuccessfulPK("gftest.table2", 20)
+	this.ferry.DataIterator.CurrentState.MarkTableAsCompleted("gftest.table2")
+
+	state := this.ferry.SerializeState()
+	this.Require().Equal(map[string]uint64{"gftest.table1": 10}, state.LastSuccessfulPrimaryKeys)
+	this.Require().Equal(map[string]bool{"gftest.table2": true}, state.CompletedTables)
+}
+
+func (this *CheckpointerTestSuite) TestCopyProgressCountsTablesCompletedByPreviousRun() {
+	// A resumed run has no position for the tables completed before.
+	state := this.ferry.DataIterator.CurrentState
+	state.MarkTableAsCompleted("gftest.table2")
+	state.UpdateTargetPK("gftest.table1", 100)
+	state.UpdateTargetPK("gftest.table2", 50)
+	state.UpdateTargetPK("gftest.table3", 30)
+
+	copied, total := state.CopyProgress()
+	this.Require().Equal(uint64(60), copied)
+	this.Require().Equal(uint64(180), total)
+}
+
+func (this *CheckpointerTestSuite) TestCheckpointKeepsPositionOfPartitions() {
+	state := this.ferry.DataIterator.CurrentState
+	state.UpdateLastSuccessfulPartitionPK("gftest.table2", "p0", 30)
+	state.MarkPartitionAsCompleted("gftest.table2", "p0")
+	state.UpdateLastSuccessfulPartitionPK("gftest.table2", "p1", 120)
+	state.UpdateLastSuccessfulPartitionPK("gftest.table3", "p0", 5)
+	state.MarkPartitionAsCompleted("gftest.table3", "p0")
+	state.MarkTableAsCompleted("gftest.table3")
+
+	serialized := this.ferry.SerializeState()
+	this.Require().Equal(map[string]map[string]uint64{"gftest.table2": {"p1": 120}}, serialized.LastSuccessfulPartitionPrimaryKeys)
+	this.Require().Equal(map[string]map[string]bool{"gftest.table2": {"p0": true}}, serialized.CompletedPartitions)
+
+	this.Require().Nil(this.checkpointer.Checkpoint())
+	data, err := ioutil.ReadFile(this.checkpointer.StateFile)
+	this.Require().Nil(err)
+
+	resumed, err := ghostferry.ParseStateDump(data)
+	this.Require().Nil(err)
+	this.Require().Equal(serialized.LastSuccessfulPartitionPrimaryKeys, resumed.LastSuccessfulPartitionPrimaryKeys)
+	this.Require().Equal(serialized.CompletedPartitions, resumed.CompletedPartitions)
+}
+
+func TestCheckpointerTestSuite(t *testing.T) {
+	suite.Run(t, new(CheckpointerTestSuite))
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+// Prefixes the value with its format version, as written to the target.
+type versionedCodec struct{}
+
+func (versionedCodec) Encode(value interface{}) (interface{}, error) {
+	data, ok := value.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %T", value)
+	}
+	return append([]byte("v2:"), data...), nil
+}
+
+func (versionedCodec) Decode(value interface{}) (interface{}, error) {
+	data, ok := value.([]byte)
+	if !ok || len(data) < 3 {
+		return nil, fmt.Errorf("unexpected %v", value)
+	}
+	return data[3:], nil
+}
+
+type ColumnCodecTestSuite struct {
+	suite.Suite
+
+	table *schema.Table
+}
+
+func (this *ColumnCodecTestSuite) SetupSuite() {
+	this.table = &schema.Table{Schema: "gftest", Name: "codec_table"}
+	this.table.AddColumn("id", "bigint(20)", "", "")
+	this.table.AddColumn("payload", "blob", "", "")
+	this.table.AddColumn("data", "varchar(255)", "", "")
+	this.table.PKColumns = []int{0}
+
+	ghostferry.RegisterColumnCodec("gftest.codec_table", "payload", versionedCodec{})
+}
+
+func (this *ColumnCodecTestSuite) TestLooksUpRegisteredCodecs() {
+	this.Require().Equal(versionedCodec{}, ghostferry.ColumnCodecFor("gftest.codec_table", "payload"))
+	this.Require().Nil(ghostferry.ColumnCodecFor("gftest.codec_table", "data"))
+	this.Require().Nil(ghostferry.ColumnCodecFor("gftest.other_table", "payload"))
+}
+
+func (this *ColumnCodecTestSuite) TestRegisteringPanicsOnNilOrDuplicateCodec() {
+	this.Require().Panics(func() {
+		ghostferry.RegisterColumnCodec("gftest.codec_table", "data", nil)
+	})
+
+	this.Require().Panics(func() {
+		ghostferry.RegisterColumnCodec("gftest.codec_table", "payload", versionedCodec{})
+	})
+}
+
+func (this *ColumnCodecTestSuite) TestEncodesOnlyColumnsWithCodec() {
+	row := ghostferry.RowData{int64(1), []byte("abc"), []byte("abc")}
+
+	encoded, err := ghostferry.EncodeRow(this.table, row)
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.RowData{int64(1), []byte("v2:abc"), []byte("abc")}, encoded)
+
+	// The row is copied, not modified.
+	this.Require().Equal([]byte("abc"), row[1])
+}
+
+func (this *ColumnCodecTestSuite) TestDoesNotEncodeNulls() {
+	encoded, err := ghostferry.EncodeRow(this.table, ghostferry.RowData{int64(1), nil, nil})
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.RowData{int64(1), nil, nil}, encoded)
+}
+
+func (this *ColumnCodecTestSuite) TestReturnsEncodingErrors() {
+	_, err := ghostferry.EncodeRow(this.table, ghostferry.RowData{int64(1), "abc", nil})
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "failed to encode column payload of gftest.codec_table")
+}
+
+func (this *ColumnCodecTestSuite) TestDeadLetterStatementWritesEncodedValues() {
+	dir, err := ioutil.TempDir("", "ghostferry-column-codec")
+	this.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	sink := &ghostferry.DeadLetterSink{File: filepath.Join(dir, "dead_letters.jsonl")}
+	this.Require().Nil(sink.Initialize())
+
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{
+				{int64(1), []byte("abc"), []byte("d")},
+			},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.table, ev, mysql.Position{})
+	this.Require().Nil(err)
+	this.Require().Nil(sink.Record(dmlEvents[0], "gftest", "codec_table", errors.New("lock wait timeout")))
+	this.Require().Nil(sink.Close())
+
+	f, err := os.Open(sink.File)
+	this.Require().Nil(err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	this.Require().True(scanner.Scan())
+
+	var record ghostferry.DeadLetterRecord
+	this.Require().Nil(json.Unmarshal(scanner.Bytes(), &record))
+	this.Require().Equal("INSERT IGNORE INTO `gftest`.`codec_table` (`id`,`payload`,`data`) VALUES (1,_binary'v2:abc',_binary'd')", record.Statement)
+}
+
+func TestColumnCodecTestSuite(t *testing.T) {
+	suite.Run(t, new(ColumnCodecTestSuite))
+}
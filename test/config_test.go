@@ -3,12 +3,25 @@ package test
 import (
 	"testing"
 
+	sq "github.com/Masterminds/squirrel"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/Shopify/ghostferry/testhelpers"
 )
 
+type configTestCopyFilter struct{}
+
+func (configTestCopyFilter) BuildSelect(columns []string, table *schema.Table, lastPk, batchSize uint64) (sq.SelectBuilder, error) {
+	return ghostferry.DefaultBuildSelect(columns, table, lastPk, batchSize), nil
+}
+
+func (configTestCopyFilter) ApplicableEvent(ghostferry.DMLEvent) (bool, error) {
+	return true, nil
+}
+
 type ConfigTestSuite struct {
 	suite.Suite
 
@@ -90,9 +103,316 @@ func (this *ConfigTestSuite) TestDefaultValues() {
 	this.Require().Equal(5, this.config.DBWriteRetries)
 	this.Require().Equal(uint64(200), this.config.DataIterationBatchSize)
 	this.Require().Equal(4, this.config.DataIterationConcurrency)
+	this.Require().Equal(8, this.config.DataIterationTableConcurrency)
 	this.Require().Equal(5, this.config.DBReadRetries)
 	this.Require().Equal("0.0.0.0:8000", this.config.ServerBindAddr)
 	this.Require().Equal(".", this.config.WebBasedir)
+	this.Require().Equal(ghostferry.TableOrderAlphabetical, this.config.DataIterationOrder)
+}
+
+func (this *ConfigTestSuite) TestFerryIdDefaultsToNewId() {
+	this.Require().Nil(this.config.ValidateConfig())
+	ferryId := this.config.FerryId
+	this.Require().Len(ferryId, 36)
+
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(ferryId, this.config.FerryId)
+
+	this.Require().NotEqual(ferryId, ghostferry.NewFerryId())
+}
+
+func (this *ConfigTestSuite) TestCommentTargetStatements() {
+	this.config.CommentTargetStatements = true
+	this.config.FerryId = "ferry-1"
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.FerryId = "ferry */ DROP TABLE users; /*"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "FerryId cannot contain */ with CommentTargetStatements")
+}
+
+func (this *ConfigTestSuite) TestRequireTableOrderForExplicitOrder() {
+	this.config.DataIterationOrder = ghostferry.TableOrderExplicit
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DataIterationTableOrder must be provided when DataIterationOrder is explicit")
+
+	this.config.DataIterationTableOrder = []string{"gftest.table1"}
+	this.Require().Nil(this.config.ValidateConfig())
+}
+
+func (this *ConfigTestSuite) TestInvalidTableOrder() {
+	this.config.DataIterationOrder = "smallest-first"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "invalid DataIterationOrder smallest-first")
+}
+
+func (this *ConfigTestSuite) TestTableWeightsRequireMoreTablesThanBatches() {
+	this.config.DataIterationTableWeights = map[string]int{"gftest.table1": 3}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.DataIterationTableConcurrency = 4
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DataIterationTableWeights require DataIterationTableConcurrency 4 to be larger than DataIterationConcurrency 4")
+}
+
+func (this *ConfigTestSuite) TestInvalidTableBatchSize() {
+	this.config.DataIterationTableBatchSizes = map[string]uint64{"gftest.table1": 0}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "batch size of table gftest.table1 must be at least 1")
+}
+
+func (this *ConfigTestSuite) TestContinuousReplicationReconnectsByDefault() {
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(0, this.config.BinlogReconnectAttempts)
+
+	this.config.ContinuousReplication = true
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(10, this.config.BinlogReconnectAttempts)
+}
+
+func (this *ConfigTestSuite) TestRetryPoliciesDefaultToRetries() {
+	this.config.DBReadRetries = 3
+	this.config.RetryPolicies.Write = &ghostferry.RetryPolicy{Backoff: ghostferry.RetryBackoffExponential}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.Require().Equal(3, this.config.RetryPolicies.Read.MaxAttempts)
+	this.Require().Equal(ghostferry.RetryBackoffConstant, this.config.RetryPolicies.Read.Backoff)
+	this.Require().Equal(5, this.config.RetryPolicies.Write.MaxAttempts)
+	this.Require().Equal(ghostferry.RetryBackoffExponential, this.config.RetryPolicies.Write.Backoff)
+	this.Require().Equal(0, this.config.RetryPolicies.BinlogReconnect.MaxAttempts)
+	this.Require().Equal(ghostferry.RetryBackoffLinear, this.config.RetryPolicies.BinlogReconnect.Backoff)
+}
+
+func (this *ConfigTestSuite) TestInvalidRetryPolicy() {
+	this.config.RetryPolicies.Read = &ghostferry.RetryPolicy{Jitter: 2}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "RetryPolicies.Read: Jitter must be between 0 and 1, got 2")
+}
+
+func (this *ConfigTestSuite) TestReverseReplicationImpliesContinuousReplication() {
+	this.config.ReverseReplication = &ghostferry.ReverseReplicationConfig{}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ReverseReplication: StartPosition must be set")
+
+	this.config.ReverseReplication.StartPosition = mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().True(this.config.ContinuousReplication)
+	this.Require().Equal(10, this.config.BinlogReconnectAttempts)
+}
+
+func (this *ConfigTestSuite) TestSnapshotAtEitherGTIDSetOrPosition() {
+	this.config.Snapshot = &ghostferry.SnapshotConfig{}
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("1h", this.config.Snapshot.WaitTimeout)
+
+	this.config.Snapshot.GTIDSet = "not a gtid"
+	err := this.config.ValidateConfig()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "Snapshot: invalid GTIDSet")
+
+	this.config.Snapshot.GTIDSet = "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-100"
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Snapshot.Position = mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "Snapshot: only one of GTIDSet and Position can be set")
+}
+
+func (this *ConfigTestSuite) TestSnapshotCannotBeUsedWithReverseReplication() {
+	this.config.Snapshot = &ghostferry.SnapshotConfig{}
+	this.config.ReverseReplication = &ghostferry.ReverseReplicationConfig{
+		StartPosition: mysql.Position{Name: "mysql-bin.000002", Pos: 4},
+	}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Snapshot cannot be used with ReverseReplication, which copies no rows")
+}
+
+func (this *ConfigTestSuite) TestSnapshotGuard() {
+	this.config.Snapshot = &ghostferry.SnapshotConfig{Guard: &ghostferry.SnapshotGuardConfig{}}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "Snapshot: Guard: MaxHistoryLength or MaxTransactionAge must be set")
+
+	this.config.Snapshot.Guard.MaxHistoryLength = 1000000
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(ghostferry.SnapshotGuardAlert, this.config.Snapshot.Guard.Action)
+	this.Require().Equal("30s", this.config.Snapshot.Guard.CheckInterval)
+
+	this.config.Snapshot.Guard.Action = "kill"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "Snapshot: Guard: invalid Action kill, must be alert or rotate")
+
+	this.config.Snapshot.Guard.Action = ghostferry.SnapshotGuardRotate
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Snapshot.Position = mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "Snapshot: Guard: the snapshot taken at a requested GTIDSet or Position cannot be rotated")
+}
+
+func (this *ConfigTestSuite) TestIgnoredRowsMode() {
+	this.config.IgnoredRowsMode = ghostferry.IgnoredRowsStrict
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.IgnoredRowsMode = "warn"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "invalid IgnoredRowsMode warn, must be count or strict")
+}
+
+func (this *ConfigTestSuite) TestDeferSecondaryIndexes() {
+	this.config.DeferSecondaryIndexes = true
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.DeltaOnly = &ghostferry.DeltaOnlyConfig{StartPosition: mysql.Position{Name: "mysql-bin.000002", Pos: 4}}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DeferSecondaryIndexes cannot be used with DeltaOnly or ReverseReplication, which copy no rows")
+}
+
+func (this *ConfigTestSuite) TestReconcileRowCountsRejectsFilters() {
+	this.config.ReconcileRowCounts = true
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.CopyFilter = configTestCopyFilter{}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ReconcileRowCounts cannot be used with a CopyFilter, EventFilterExpressions or PrimaryKeyRemapping, as the row counts of the source and the target differ")
+
+	this.config.CopyFilter = nil
+	this.config.EventFilterExpressions = map[string]string{"gftest.orders": "new.status != 'draft'"}
+	this.Require().NotNil(this.config.ValidateConfig())
+
+	this.config.EventFilterExpressions = nil
+	this.config.PrimaryKeyRemapping = &ghostferry.PrimaryKeyRemappingConfig{Tables: []string{"gftest.orders"}, MappingDatabase: "gftest"}
+	this.Require().NotNil(this.config.ValidateConfig())
+}
+
+func (this *ConfigTestSuite) TestDeltaOnly() {
+	this.config.DeltaOnly = &ghostferry.DeltaOnlyConfig{}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "DeltaOnly: StartPosition must be set")
+
+	this.config.DeltaOnly.StartPosition = mysql.Position{Name: "mysql-bin.000002", Pos: 4}
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().False(this.config.ContinuousReplication)
+
+	this.config.Snapshot = &ghostferry.SnapshotConfig{}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "Snapshot cannot be used with DeltaOnly, which copies no rows")
+
+	this.config.Snapshot = nil
+	this.config.ReverseReplication = &ghostferry.ReverseReplicationConfig{StartPosition: this.config.DeltaOnly.StartPosition}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "DeltaOnly cannot be used with ReverseReplication")
+}
+
+func (this *ConfigTestSuite) TestReadReplica() {
+	this.config.ReadReplica = &ghostferry.ReadReplicaConfig{}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ReadReplica: Replica: host is empty")
+
+	this.config.ReadReplica.Replica = ghostferry.DatabaseConfig{Host: "example.com/replica", Port: 3306, User: "ghostferry"}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "ReadReplica: ReplicatedMasterPositionQuery or UseGTID must be set")
+
+	this.config.ReadReplica.UseGTID = true
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("10m", this.config.ReadReplica.CatchUpTimeout)
+
+	this.config.Snapshot = &ghostferry.SnapshotConfig{}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "Snapshot cannot be used with ReadReplica, as the snapshot is taken on the source")
+
+	this.config.Snapshot = nil
+	this.config.DeltaOnly = &ghostferry.DeltaOnlyConfig{StartPosition: mysql.Position{Name: "mysql-bin.000002", Pos: 4}}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "ReadReplica cannot be used with ReverseReplication or DeltaOnly, which copy no rows")
+}
+
+func (this *ConfigTestSuite) TestTargetRowGuard() {
+	this.config.TargetRowGuard = &ghostferry.TargetRowGuardConfig{}
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("10s", this.config.TargetRowGuard.Interval)
+
+	this.config.TargetRowGuard.Interval = "soon"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "TargetRowGuard: invalid Interval: time: invalid duration \"soon\"")
+}
+
+func (this *ConfigTestSuite) TestUnknownBinlogClient() {
+	this.config.BinlogClient = "unknown"
+	err := this.config.ValidateConfig()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "unknown binlog client unknown")
+}
+
+func (this *ConfigTestSuite) TestInvalidCheckpointInterval() {
+	this.config.CheckpointInterval = "soon"
+	err := this.config.ValidateConfig()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "invalid CheckpointInterval")
+}
+
+func (this *ConfigTestSuite) TestInvalidProgressLogInterval() {
+	this.config.ProgressLogInterval = "often"
+	err := this.config.ValidateConfig()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "invalid ProgressLogInterval")
+
+	this.config.ProgressLogInterval = "0s"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "ProgressLogInterval must be positive, got 0s")
+}
+
+func (this *ConfigTestSuite) TestInvalidMaxCutoverDowntime() {
+	this.config.MaxCutoverDowntime = "soon"
+	err := this.config.ValidateConfig()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "invalid MaxCutoverDowntime")
+
+	this.config.MaxCutoverDowntime = "-1s"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "MaxCutoverDowntime must be positive, got -1s")
+}
+
+func (this *ConfigTestSuite) TestIgnoredStorageEngines() {
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal([]string{"BLACKHOLE", "FEDERATED", "MEMORY"}, this.config.IgnoredStorageEngines)
+
+	this.config.IgnoredStorageEngines = []string{}
+	err = this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(0, len(this.config.IgnoredStorageEngines))
+
+	this.config.IgnoredStorageEngines = []string{"MyISAM", ""}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "IgnoredStorageEngines must not contain an empty engine")
+}
+
+func (this *ConfigTestSuite) TestOnlineSchemaChangeAction() {
+	err := this.config.ValidateConfig()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.OnlineSchemaChangeActionFail, this.config.OnlineSchemaChangeAction)
+	this.Require().Equal("10s", this.config.OnlineSchemaChangeCheckInterval)
+
+	this.config.OnlineSchemaChangeAction = "pause"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "invalid OnlineSchemaChangeAction pause, must be fail, wait or ignore")
+
+	this.config.OnlineSchemaChangeAction = ghostferry.OnlineSchemaChangeActionWait
+	this.config.OnlineSchemaChangeCheckInterval = "0s"
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "OnlineSchemaChangeCheckInterval must be positive, got 0s")
+}
+
+func (this *ConfigTestSuite) TestForeignKeyCopyMode() {
+	this.config.ForeignKeyCopyMode = ghostferry.ForeignKeyCopyOrdered
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.ForeignKeyCopyMode = ghostferry.ForeignKeyCopyDeferred
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.ForeignKeyCopyMode = "disabled"
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "invalid ForeignKeyCopyMode disabled, must be ordered or deferred")
 }
 
 func (this *ConfigTestSuite) TestCorruptCert() {
@@ -130,6 +450,110 @@ func (this *ConfigTestSuite) TestParamsAndCollationGetsPassedToMysqlConfig() {
 	this.Require().Equal("utf8mb4_general_ci", mysqlConfig.Collation)
 }
 
+func (this *ConfigTestSuite) TestRequireRegisteredPlugins() {
+	this.config.Plugins = map[string]*ghostferry.PluginConfig{
+		ghostferry.PluginKindThrottler: {Name: "missing"},
+	}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "throttler plugin missing is not registered")
+
+	this.config.Plugins = map[string]*ghostferry.PluginConfig{
+		"data_iterator": {Name: "missing"},
+	}
+	err = this.config.ValidateConfig()
+	this.Require().EqualError(err, "unknown plugin kind data_iterator")
+}
+
+func (this *ConfigTestSuite) TestPostgreSQLTargetRequiresDbname() {
+	this.config.TargetDialect = ghostferry.DialectPostgreSQL
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: dbname param must be set for a postgresql target")
+
+	this.config.Target.Params = map[string]string{"dbname": "target"}
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal("", this.config.Target.Params["sql_mode"])
+}
+
+func (this *ConfigTestSuite) TestFullRowMatchingIsNotSupportedWithPostgreSQLTarget() {
+	this.config.TargetDialect = ghostferry.DialectPostgreSQL
+	this.config.Target.Params = map[string]string{"dbname": "target"}
+	this.config.FullRowMatching = true
+
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "FullRowMatching is not supported with a postgresql target")
+}
+
+func (this *ConfigTestSuite) TestSessionSetsTargetSessionVariables() {
+	foreignKeyChecks := false
+	this.config.Target.Params = map[string]string{}
+	this.config.Target.Session = &ghostferry.SessionConfig{
+		SqlMode:               "STRICT_TRANS_TABLES,NO_BACKSLASH_ESCAPES",
+		ForeignKeyChecks:      &foreignKeyChecks,
+		InnodbLockWaitTimeout: 5,
+	}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	mysqlConfig, err := this.config.Target.MySQLConfig()
+	this.Require().Nil(err)
+
+	this.Require().Equal("'STRICT_TRANS_TABLES,NO_BACKSLASH_ESCAPES'", mysqlConfig.Params["sql_mode"])
+	this.Require().Equal("'+00:00'", mysqlConfig.Params["time_zone"])
+	this.Require().Equal("0", mysqlConfig.Params["foreign_key_checks"])
+	this.Require().Equal("5", mysqlConfig.Params["innodb_lock_wait_timeout"])
+	this.Require().NotContains(mysqlConfig.Params, "unique_checks")
+	this.Require().NotContains(this.config.Target.Params, "foreign_key_checks")
+}
+
+func (this *ConfigTestSuite) TestSessionSqlModeRequiresNoBackslashEscapes() {
+	this.config.Target.Session = &ghostferry.SessionConfig{SqlMode: "STRICT_ALL_TABLES"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: Session: SqlMode must include NO_BACKSLASH_ESCAPES")
+}
+
+func (this *ConfigTestSuite) TestSessionCannotOverrideParams() {
+	this.config.Target.Params = map[string]string{"unique_checks": "1"}
+	uniqueChecks := false
+	this.config.Target.Session = &ghostferry.SessionConfig{UniqueChecks: &uniqueChecks}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "target: unique_checks cannot be set in both Params and Session")
+}
+
+func (this *ConfigTestSuite) TestSessionTimeZoneMustMatchSource() {
+	this.config.Target.Session = &ghostferry.SessionConfig{TimeZone: "+01:00"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "the Session TimeZone of the source and the target must be the same, as the TIMESTAMP values are copied as read")
+}
+
+func (this *ConfigTestSuite) TestLatin1ConversionRequiresUtf8SourceCharset() {
+	this.config.ConvertLatin1ToUtf8mb4 = true
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Source.Params = map[string]string{"charset": "utf8mb4,utf8"}
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Source.Params = map[string]string{"charset": "latin1"}
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "ConvertLatin1ToUtf8mb4 requires a utf8 or utf8mb4 charset on the source, got latin1")
+}
+
+func (this *ConfigTestSuite) TestMaxMemoryBytesMustNotBeNegative() {
+	this.config.MaxMemoryBytes = -1
+	err := this.config.ValidateConfig()
+	this.Require().EqualError(err, "MaxMemoryBytes must not be negative")
+}
+
+func (this *ConfigTestSuite) TestBinlogInsertBatchSize() {
+	this.Require().Nil(this.config.ValidateConfig())
+	this.Require().Equal(1, this.config.BinlogInsertBatchSize)
+
+	this.config.BinlogInsertBatchSize = -1
+	this.Require().EqualError(this.config.ValidateConfig(), "BinlogInsertBatchSize must be positive")
+
+	this.config.BinlogInsertBatchSize = 100
+	this.config.TargetDialect = ghostferry.DialectVitess
+	this.Require().EqualError(this.config.ValidateConfig(), "BinlogInsertBatchSize is not supported with a vitess target")
+}
+
 func TestConfig(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, new(ConfigTestSuite))
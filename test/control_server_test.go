@@ -1 +1,138 @@
 package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type ControlServerAuthTestSuite struct {
+	suite.Suite
+
+	server *ghostferry.ControlServer
+}
+
+func (this *ControlServerAuthTestSuite) SetupTest() {
+	this.server = &ghostferry.ControlServer{
+		Addr:    "127.0.0.1:0",
+		Basedir: "..",
+		Auth: &ghostferry.ControlServerAuthConfig{
+			Username:     "ferry",
+			Password:     "secret",
+			BearerTokens: []string{"token"},
+			AllowedCIDRs: []string{"10.0.0.0/8"},
+		},
+	}
+
+	this.Require().Nil(this.server.Initialize())
+}
+
+func (this *ControlServerAuthTestSuite) serve(remoteAddr string, authorize func(*http.Request)) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", "/api/unknown", nil)
+	request.RemoteAddr = remoteAddr
+	if authorize != nil {
+		authorize(request)
+	}
+
+	response := httptest.NewRecorder()
+	this.server.ServeHTTP(response, request)
+	return response
+}
+
+func (this *ControlServerAuthTestSuite) TestRejectsClientsOutsideOfAllowedCIDRs() {
+	response := this.serve("192.168.1.1:1234", func(r *http.Request) {
+		r.SetBasicAuth("ferry", "secret")
+	})
+	this.Require().Equal(http.StatusForbidden, response.Code)
+}
+
+func (this *ControlServerAuthTestSuite) TestRejectsUnauthenticatedRequests() {
+	response := this.serve("10.1.2.3:1234", nil)
+	this.Require().Equal(http.StatusUnauthorized, response.Code)
+	this.Require().Equal(`Basic realm="ghostferry"`, response.Header().Get("WWW-Authenticate"))
+
+	response = this.serve("10.1.2.3:1234", func(r *http.Request) {
+		r.SetBasicAuth("ferry", "wrong")
+	})
+	this.Require().Equal(http.StatusUnauthorized, response.Code)
+
+	response = this.serve("10.1.2.3:1234", func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer wrong")
+	})
+	this.Require().Equal(http.StatusUnauthorized, response.Code)
+}
+
+func (this *ControlServerAuthTestSuite) TestServesAuthenticatedRequests() {
+	response := this.serve("10.1.2.3:1234", func(r *http.Request) {
+		r.SetBasicAuth("ferry", "secret")
+	})
+	this.Require().Equal(http.StatusNotFound, response.Code)
+
+	response = this.serve("10.1.2.3:1234", func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer token")
+	})
+	this.Require().Equal(http.StatusNotFound, response.Code)
+}
+
+func (this *ControlServerAuthTestSuite) TestValidate() {
+	auth := &ghostferry.ControlServerAuthConfig{Username: "ferry"}
+	this.Require().EqualError(auth.Validate(), "Username and Password must be set together")
+
+	auth = &ghostferry.ControlServerAuthConfig{ClientCAPath: "ca.pem"}
+	this.Require().EqualError(auth.Validate(), "ClientCAPath requires CertPath and KeyPath")
+
+	auth = &ghostferry.ControlServerAuthConfig{AllowedCIDRs: []string{"10.0.0.0"}}
+	this.Require().EqualError(auth.Validate(), "invalid allowed CIDR 10.0.0.0: invalid CIDR address: 10.0.0.0")
+}
+
+func (this *ControlServerAuthTestSuite) TestServesDebugEndpointsOnlyIfEnabled() {
+	response := httptest.NewRecorder()
+	this.server.ServeHTTP(response, this.authorizedRequest("/debug/pprof/"))
+	this.Require().Equal(http.StatusNotFound, response.Code)
+
+	binlogWriter := &ghostferry.BinlogWriter{BatchSize: 10}
+	this.Require().Nil(binlogWriter.Initialize())
+
+	server := &ghostferry.ControlServer{
+		F: &ghostferry.Ferry{
+			OverallState:   ghostferry.StateCopying,
+			BinlogStreamer: &ghostferry.BinlogStreamer{},
+			BinlogWriter:   binlogWriter,
+			ReadThrottler:  &ghostferry.PauserThrottler{},
+			WriteThrottler: &ghostferry.PauserThrottler{},
+		},
+		Addr:        "127.0.0.1:0",
+		Basedir:     "..",
+		EnableDebug: true,
+	}
+	this.Require().Nil(server.Initialize())
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, this.authorizedRequest("/debug/pprof/"))
+	this.Require().Equal(http.StatusOK, response.Code)
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, this.authorizedRequest("/debug/state"))
+	this.Require().Equal(http.StatusOK, response.Code)
+
+	var state ghostferry.DebugState
+	this.Require().Nil(json.NewDecoder(response.Body).Decode(&state))
+	this.Require().Equal(ghostferry.StateCopying, state.OverallState)
+	this.Require().True(state.Goroutines > 0)
+	this.Require().Equal(int64(0), state.BinlogWriter.BufferDepth)
+}
+
+func (this *ControlServerAuthTestSuite) authorizedRequest(path string) *http.Request {
+	request := httptest.NewRequest("GET", path, nil)
+	request.RemoteAddr = "10.1.2.3:1234"
+	request.SetBasicAuth("ferry", "secret")
+	return request
+}
+
+func TestControlServerAuthTestSuite(t *testing.T) {
+	suite.Run(t, new(ControlServerAuthTestSuite))
+}
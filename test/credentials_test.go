@@ -0,0 +1,199 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type CredentialsTestSuite struct {
+	suite.Suite
+
+	config ghostferry.DatabaseConfig
+}
+
+func (this *CredentialsTestSuite) SetupTest() {
+	this.config = ghostferry.DatabaseConfig{
+		Host: "example.com",
+		Port: 3306,
+		User: "ghostferry",
+	}
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	os.Setenv("AWS_REGION", "us-east-1")
+}
+
+func (this *CredentialsTestSuite) TearDownTest() {
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	os.Unsetenv("AWS_REGION")
+	os.Unsetenv("GHOSTFERRY_TEST_PASSWORD")
+}
+
+func (this *CredentialsTestSuite) useProvider(provider string, options interface{}) {
+	encoded, err := json.Marshal(options)
+	this.Require().Nil(err)
+
+	this.config.Credentials = &ghostferry.CredentialsConfig{
+		Provider: provider,
+		Options:  encoded,
+	}
+}
+
+func (this *CredentialsTestSuite) TestDefaultsToUserAndPass() {
+	this.config.Pass = "inline"
+
+	credentials, err := this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.Credentials{User: "ghostferry", Password: "inline"}, credentials)
+}
+
+func (this *CredentialsTestSuite) TestReadsThePasswordFromTheEnvironment() {
+	os.Setenv("GHOSTFERRY_TEST_PASSWORD", "from env")
+	this.useProvider(ghostferry.CredentialsProviderEnv, map[string]string{"Variable": "GHOSTFERRY_TEST_PASSWORD"})
+
+	credentials, err := this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.Credentials{User: "ghostferry", Password: "from env"}, credentials)
+}
+
+func (this *CredentialsTestSuite) TestRereadsTheFileOnceTheRefreshIntervalElapsed() {
+	dir, err := ioutil.TempDir("", "ghostferry-credentials")
+	this.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "password")
+	this.Require().Nil(ioutil.WriteFile(path, []byte("first\n"), 0600))
+
+	this.useProvider(ghostferry.CredentialsProviderFile, map[string]string{"Path": path})
+	this.config.Credentials.RefreshInterval = "100ms"
+
+	credentials, err := this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal("first", credentials.Password)
+
+	this.Require().Nil(ioutil.WriteFile(path, []byte("second\n"), 0600))
+
+	credentials, err = this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal("first", credentials.Password)
+
+	time.Sleep(150 * time.Millisecond)
+
+	credentials, err = this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal("second", credentials.Password)
+
+	// The previous credentials are kept if they cannot be read again.
+	this.Require().Nil(os.Remove(path))
+	time.Sleep(150 * time.Millisecond)
+
+	credentials, err = this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal("second", credentials.Password)
+}
+
+func (this *CredentialsTestSuite) TestReadsTheCredentialsFromVault() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/mysql" || r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Write([]byte(`{"data": {"data": {"username": "vault-user", "password": "vault-password"}, "metadata": {"version": 3}}}`))
+	}))
+	defer server.Close()
+
+	this.useProvider(ghostferry.CredentialsProviderVault, map[string]string{
+		"Address":   server.URL,
+		"Token":     "vault-token",
+		"Path":      "secret/data/mysql",
+		"UserField": "username",
+	})
+
+	credentials, err := this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.Credentials{User: "vault-user", Password: "vault-password"}, credentials)
+}
+
+func (this *CredentialsTestSuite) TestReadsTheCredentialsFromAWSSecretsManager() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(authorization, "/us-east-1/secretsmanager/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		this.Require().Equal("secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		body, _ := ioutil.ReadAll(r.Body)
+		this.Require().JSONEq(`{"SecretId": "prod/mysql"}`, string(body))
+
+		w.Write([]byte(`{"SecretString": "{\"username\": \"rds-user\", \"password\": \"rds-password\"}"}`))
+	}))
+	defer server.Close()
+
+	this.useProvider(ghostferry.CredentialsProviderAWSSecretsManager, map[string]string{
+		"SecretId":  "prod/mysql",
+		"UserField": "username",
+		"Endpoint":  server.URL,
+	})
+
+	credentials, err := this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.Credentials{User: "rds-user", Password: "rds-password"}, credentials)
+}
+
+func (this *CredentialsTestSuite) TestGeneratesRDSIAMTokens() {
+	this.config.TLS = &ghostferry.TLSConfig{CertPath: "/etc/ssl/rds.pem"}
+	this.useProvider(ghostferry.CredentialsProviderRDSIAM, map[string]string{})
+
+	credentials, err := this.config.ResolveCredentials()
+	this.Require().Nil(err)
+	this.Require().Equal("ghostferry", credentials.User)
+	this.Require().True(strings.HasPrefix(credentials.Password, "example.com:3306/?Action=connect&DBUser=ghostferry&"), credentials.Password)
+	this.Require().Contains(credentials.Password, "X-Amz-Credential=AKIDEXAMPLE%2F")
+	this.Require().Contains(credentials.Password, "%2Fus-east-1%2Frds-db%2Faws4_request")
+	this.Require().Contains(credentials.Password, "X-Amz-Expires=900")
+	this.Require().Regexp("&X-Amz-Signature=[0-9a-f]{64}$", credentials.Password)
+}
+
+func (this *CredentialsTestSuite) TestValidatesTheCredentials() {
+	this.useProvider(ghostferry.CredentialsProviderEnv, map[string]string{})
+	this.Require().EqualError(this.config.Validate(), "Credentials: invalid env credentials provider options: Variable is required")
+
+	this.useProvider("unknown", nil)
+	this.Require().EqualError(this.config.Validate(), "Credentials: credentials provider unknown is not registered, must be one of aws-secrets-manager, env, file, rds-iam, vault")
+
+	this.useProvider(ghostferry.CredentialsProviderEnv, map[string]string{"Variable": "GHOSTFERRY_TEST_PASSWORD"})
+	this.config.Pass = "inline"
+	this.Require().EqualError(this.config.Validate(), "Pass and Credentials cannot both be set")
+}
+
+func (this *CredentialsTestSuite) TestRejectsRDSIAMForTheSource() {
+	config := &ghostferry.Config{
+		Source:      this.config,
+		Target:      this.config,
+		TableFilter: &testhelpers.TestTableFilter{},
+	}
+
+	config.Source.TLS = &ghostferry.TLSConfig{CertPath: "/etc/ssl/rds.pem"}
+	config.Source.Credentials = &ghostferry.CredentialsConfig{Provider: ghostferry.CredentialsProviderRDSIAM}
+
+	err := config.ValidateConfig()
+	this.Require().EqualError(err, "source: the rds-iam credentials provider is not supported, as the binlog client cannot authenticate with its tokens")
+}
+
+func TestCredentialsTestSuite(t *testing.T) {
+	suite.Run(t, new(CredentialsTestSuite))
+}
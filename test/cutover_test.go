@@ -0,0 +1,95 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type CutoverStepsTestSuite struct {
+	suite.Suite
+
+	ferry    *ghostferry.Ferry
+	unlocked bool
+}
+
+func (this *CutoverStepsTestSuite) SetupTest() {
+	this.ferry = &ghostferry.Ferry{
+		Config: &ghostferry.Config{MaxCutoverDowntime: "200ms"},
+	}
+	this.unlocked = false
+}
+
+func (this *CutoverStepsTestSuite) unlock() error {
+	this.unlocked = true
+	return nil
+}
+
+func (this *CutoverStepsTestSuite) step(name string, duration time.Duration, ran *[]string) ghostferry.CutoverStep {
+	return ghostferry.CutoverStep{
+		Name: name,
+		Run: func() error {
+			time.Sleep(duration)
+			*ran = append(*ran, name)
+			return nil
+		},
+	}
+}
+
+func (this *CutoverStepsTestSuite) TestRunsTheStepsWithinTheDowntime() {
+	var ran []string
+	err := this.ferry.RunCutoverSteps(time.Now(), this.unlock, []ghostferry.CutoverStep{
+		this.step("drain", 10*time.Millisecond, &ran),
+		this.step("verify", 10*time.Millisecond, &ran),
+	})
+
+	this.Require().Nil(err)
+	this.Require().Equal([]string{"drain", "verify"}, ran)
+	this.Require().False(this.unlocked)
+}
+
+func (this *CutoverStepsTestSuite) TestAbortsTheCutoverOnceTheDowntimeIsExceeded() {
+	var ran []string
+	start := time.Now()
+	err := this.ferry.RunCutoverSteps(start, this.unlock, []ghostferry.CutoverStep{
+		this.step("drain", 100*time.Millisecond, &ran),
+		this.step("verify", 300*time.Millisecond, &ran),
+		this.step("unreached", 0, &ran),
+	})
+
+	this.Require().EqualError(err, "cutover aborted as verify did not complete within the MaxCutoverDowntime of 200ms")
+	this.Require().Equal(ghostferry.CutoverAbortedError{Step: "verify", MaxDowntime: 200 * time.Millisecond}, err)
+	this.Require().True(this.unlocked)
+
+	// The running step is waited for, but the following steps are not run.
+	this.Require().Equal([]string{"drain", "verify"}, ran)
+	this.Require().True(time.Since(start) >= 400*time.Millisecond)
+}
+
+func (this *CutoverStepsTestSuite) TestReturnsTheErrorsOfTheSteps() {
+	err := this.ferry.RunCutoverSteps(time.Now(), this.unlock, []ghostferry.CutoverStep{
+		{Name: "drain", Run: func() error { return errors.New("drain failed") }},
+	})
+
+	this.Require().EqualError(err, "drain failed")
+	this.Require().False(this.unlocked)
+}
+
+func (this *CutoverStepsTestSuite) TestDoesNotLimitTheDowntimeByDefault() {
+	this.ferry.Config.MaxCutoverDowntime = ""
+
+	var ran []string
+	err := this.ferry.RunCutoverSteps(time.Now().Add(-time.Hour), this.unlock, []ghostferry.CutoverStep{
+		this.step("drain", 10*time.Millisecond, &ran),
+	})
+
+	this.Require().Nil(err)
+	this.Require().Equal([]string{"drain"}, ran)
+}
+
+func TestCutoverStepsTestSuite(t *testing.T) {
+	suite.Run(t, new(CutoverStepsTestSuite))
+}
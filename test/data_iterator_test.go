@@ -126,6 +126,117 @@ func (this *DataIteratorTestSuite) TestDoneListenerGetsNotifiedWhenDone() {
 	this.Require().True(wasNotified)
 }
 
+func (this *DataIteratorTestSuite) TestReportsThePanicsOfTheTableIterations() {
+	var recovered interface{}
+	this.di.ReportPanic = func() {
+		recovered = recover()
+	}
+
+	this.di.AddBatchListener(func(ev *ghostferry.RowBatch) error {
+		panic("batch listener panic")
+	})
+
+	this.di.Run()
+
+	this.Require().Equal("batch listener panic", recovered)
+}
+
+func (this *DataIteratorTestSuite) TestRequestStopLeavesTablesIncomplete() {
+	wasNotified := false
+
+	this.di.AddBatchListener(func(ev *ghostferry.RowBatch) error {
+		this.di.RequestStop()
+		return nil
+	})
+
+	this.di.AddDoneListener(func() error {
+		wasNotified = true
+		return nil
+	})
+
+	this.di.Run()
+
+	table := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+	this.Require().Equal(2, len(this.receivedRows))
+	this.Require().Equal(uint64(2), this.di.CurrentState.LastSuccessfulPrimaryKeys()[table])
+	this.Require().Equal(0, len(this.di.CurrentState.CompletedTables()))
+	this.Require().False(wasNotified)
+}
+
+func (this *DataIteratorTestSuite) TestTableBatchSizeOverride() {
+	batchSizes := []int{}
+	this.di.TableBatchSizes = map[string]uint64{
+		fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name): 3,
+	}
+
+	this.di.AddBatchListener(func(ev *ghostferry.RowBatch) error {
+		batchSizes = append(batchSizes, ev.Size())
+		return nil
+	})
+
+	this.di.Run()
+
+	this.Require().Equal([]int{3, 2}, batchSizes)
+}
+
+func (this *DataIteratorTestSuite) TestIteratesByPartition() {
+	_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf(
+		"ALTER TABLE `%s`.`%s` PARTITION BY RANGE (id) (PARTITION p0 VALUES LESS THAN (3), PARTITION p1 VALUES LESS THAN MAXVALUE)",
+		testhelpers.TestSchemaName,
+		testhelpers.TestTable1Name,
+	))
+	this.Require().Nil(err)
+
+	this.di.ByPartition = true
+	this.di.TableConcurrency = 1
+
+	this.di.Run()
+
+	ids := make([]int64, 0, len(this.receivedRows))
+	for _, row := range this.receivedRows {
+		ids = append(ids, row[0].(int64))
+	}
+
+	table := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+	this.Require().Equal([]int64{1, 2, 3, 4, 5}, ids)
+	this.Require().Equal(map[string]bool{table: true}, this.di.CurrentState.CompletedTables())
+	this.Require().True(this.di.CurrentState.IsPartitionCompleted(table, "p0"))
+	this.Require().True(this.di.CurrentState.IsPartitionCompleted(table, "p1"))
+	this.Require().Equal(uint64(5), this.di.CurrentState.LastSuccessfulPartitionPK(table, "p1"))
+}
+
+func (this *DataIteratorTestSuite) TestIteratesInIndexOrder() {
+	table := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+
+	for _, query := range []string{
+		"ALTER TABLE %s ADD COLUMN position INT NOT NULL DEFAULT 0, ADD INDEX position_index (position)",
+		"UPDATE %s SET position = 10 - id",
+	} {
+		_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf(query, table))
+		this.Require().Nil(err)
+	}
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	this.di.Tables = tables.AsSlice()
+	this.di.Indexes = map[string]string{table: "position_index"}
+
+	// The first row in the order of the index was copied by a previous run.
+	this.di.CurrentState.UpdateLastSuccessfulPK(table, 5)
+
+	this.di.Run()
+
+	ids := make([]int64, 0, len(this.receivedRows))
+	for _, row := range this.receivedRows {
+		ids = append(ids, row[0].(int64))
+	}
+
+	this.Require().Equal([]int64{4, 3, 2, 1}, ids)
+	this.Require().Equal(map[string]bool{table: true}, this.di.CurrentState.CompletedTables())
+	this.Require().Equal(uint64(1), this.di.CurrentState.LastSuccessfulPK(table))
+}
+
 func (this *DataIteratorTestSuite) TestInitialize() {
 	this.Require().NotNil(this.di.CurrentState)
 }
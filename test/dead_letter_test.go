@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DeadLetterSinkTestSuite struct {
+	suite.Suite
+
+	dir   string
+	sink  *ghostferry.DeadLetterSink
+	table *schema.Table
+}
+
+func (this *DeadLetterSinkTestSuite) SetupTest() {
+	var err error
+	this.dir, err = ioutil.TempDir("", "ghostferry-dead-letter")
+	this.Require().Nil(err)
+
+	this.sink = &ghostferry.DeadLetterSink{File: filepath.Join(this.dir, "dead_letters.jsonl")}
+	this.Require().Nil(this.sink.Initialize())
+
+	this.table = &schema.Table{
+		Schema:    "gftest",
+		Name:      "table1",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "data"}},
+		PKColumns: []int{0},
+	}
+}
+
+func (this *DeadLetterSinkTestSuite) TearDownTest() {
+	os.RemoveAll(this.dir)
+}
+
+func (this *DeadLetterSinkTestSuite) TestRecordsFailedEventForReplay() {
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{{int64(1), []byte("data")}},
+		},
+	}
+
+	pos := mysql.Position{Name: "mysql-bin.000001", Pos: 1234}
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.table, ev, pos)
+	this.Require().Nil(err)
+
+	this.Require().Nil(this.sink.Record(dmlEvents[0], "gftest2", "table1", errors.New("duplicate entry")))
+	this.Require().Equal(int64(1), this.sink.Count())
+	this.Require().Nil(this.sink.Close())
+
+	f, err := os.Open(this.sink.File)
+	this.Require().Nil(err)
+	defer f.Close()
+
+	records := []ghostferry.DeadLetterRecord{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record ghostferry.DeadLetterRecord
+		this.Require().Nil(json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+
+	this.Require().Equal(1, len(records))
+	record := records[0]
+	this.Require().Equal("insert", record.Type)
+	this.Require().Equal("gftest", record.Database)
+	this.Require().Equal("gftest2", record.TargetDatabase)
+	this.Require().Equal("data", record.After["data"])
+	this.Require().Nil(record.Before)
+	this.Require().Equal(pos, record.BinlogPosition)
+	this.Require().Equal("INSERT IGNORE INTO `gftest2`.`table1` (`id`,`data`) VALUES (1,_binary'data')", record.Statement)
+	this.Require().Equal("duplicate entry", record.Error)
+}
+
+func (this *DeadLetterSinkTestSuite) TestRecordFailsOnceClosed() {
+	this.Require().Nil(this.sink.Close())
+
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.DELETE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{{int64(1), []byte("data")}},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.table, ev, mysql.Position{})
+	this.Require().Nil(err)
+	this.Require().NotNil(this.sink.Record(dmlEvents[0], "gftest", "table1", errors.New("lock wait timeout")))
+	this.Require().Equal(int64(0), this.sink.Count())
+}
+
+type recordingErrorHandler struct {
+	errs []error
+}
+
+func (h *recordingErrorHandler) Fatal(from string, err error) {
+	h.errs = append(h.errs, err)
+}
+
+func (this *DeadLetterSinkTestSuite) TestNetworkErrorsAreNotDeadLettered() {
+	// Nothing listens on port 1, so the connections are refused.
+	db, err := sql.Open("mysql", "ghostferry@tcp(127.0.0.1:1)/")
+	this.Require().Nil(err)
+	defer db.Close()
+
+	errorHandler := &recordingErrorHandler{}
+	writer := &ghostferry.BinlogWriter{
+		DB:                db,
+		BatchSize:         1,
+		WriteRetries:      1,
+		DeadLetterSink:    this.sink,
+		DeadLetterRetries: 1,
+		Throttler:         &ghostferry.PauserThrottler{},
+		ErrorHandler:      errorHandler,
+	}
+	this.Require().Nil(writer.Initialize())
+
+	events, err := ghostferry.NewBinlogInsertEvents(this.table, &replication.RowsEvent{Rows: [][]interface{}{{int64(1), "a"}}})
+	this.Require().Nil(err)
+
+	this.Require().Nil(writer.BufferBinlogEvents(events))
+	writer.Stop()
+	writer.Run()
+
+	this.Require().Equal(1, len(errorHandler.errs))
+	this.Require().Equal(ghostferry.ErrorClassNetwork, ghostferry.ClassifyError(errorHandler.errs[0]))
+	this.Require().Equal(int64(0), this.sink.Count())
+}
+
+func TestDeadLetterSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(DeadLetterSinkTestSuite))
+}
+
+func TestWithBackoffRetriesGivesUpAfterMaxRetries(t *testing.T) {
+	attempts := 0
+	err := ghostferry.WithBackoffRetries(3, time.Millisecond, 2*time.Millisecond, nil, "test", func() error {
+		attempts++
+		return errors.New("failure")
+	})
+
+	assert.EqualError(t, err, "failure")
+	assert.Equal(t, 3, attempts)
+}
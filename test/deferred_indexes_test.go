@@ -0,0 +1,52 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+const deferredIndexesCreateTable = "CREATE TABLE `users` (\n" +
+	"  `id` bigint(20) NOT NULL AUTO_INCREMENT,\n" +
+	"  `account_id` bigint(20) NOT NULL,\n" +
+	"  `email` varchar(255) NOT NULL,\n" +
+	"  `name` varchar(255) DEFAULT NULL,\n" +
+	"  `bio` text,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  UNIQUE KEY `index_users_on_email` (`email`),\n" +
+	"  KEY `index_users_on_account_id_and_name` (`account_id`,`name`),\n" +
+	"  KEY `index_users_on_name` (`name`(10)),\n" +
+	"  FULLTEXT KEY `index_users_on_bio` (`bio`),\n" +
+	"  CONSTRAINT `fk_users_accounts` FOREIGN KEY (`account_id`) REFERENCES `accounts` (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+type DeferredIndexesTestSuite struct {
+	suite.Suite
+}
+
+func (this *DeferredIndexesTestSuite) TestDeferrableIndexes() {
+	indexes := ghostferry.DeferrableIndexes("`db`.`users`", deferredIndexesCreateTable)
+
+	this.Require().Equal([]ghostferry.DeferredIndex{
+		{
+			Table:      "`db`.`users`",
+			Name:       "index_users_on_name",
+			Definition: "KEY `index_users_on_name` (`name`(10))",
+		},
+		{
+			Table:      "`db`.`users`",
+			Name:       "index_users_on_bio",
+			Definition: "FULLTEXT KEY `index_users_on_bio` (`bio`)",
+		},
+	}, indexes)
+}
+
+func (this *DeferredIndexesTestSuite) TestTableWithoutSecondaryIndexes() {
+	createTable := "CREATE TABLE `t` (\n  `id` bigint(20) NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"
+	this.Require().Empty(ghostferry.DeferrableIndexes("`db`.`t`", createTable))
+}
+
+func TestDeferredIndexesTestSuite(t *testing.T) {
+	suite.Run(t, new(DeferredIndexesTestSuite))
+}
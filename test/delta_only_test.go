@@ -0,0 +1,67 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type DeltaOnlyTestSuite struct {
+	suite.Suite
+}
+
+func (this *DeltaOnlyTestSuite) TestParsesXtrabackupBinlogInfo() {
+	pos, err := ghostferry.ParseBackupBinlogPosition("mysql-bin.000003\t1234\t3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,\n4e11fa47-71ca-11e1-9e33-c80aa9429562:1-7\n")
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000003", Pos: 1234}, pos)
+
+	pos, err = ghostferry.ParseBackupBinlogPosition("mysql-bin.000003\t1234\n")
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000003", Pos: 1234}, pos)
+}
+
+func (this *DeltaOnlyTestSuite) TestParsesMysqldumpMasterData() {
+	dump := "-- MySQL dump 10.13\n" +
+		"SET @@GLOBAL.GTID_PURGED='3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5';\n" +
+		"-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000007', MASTER_LOG_POS=154;\n"
+
+	pos, err := ghostferry.ParseBackupBinlogPosition(dump)
+	this.Require().Nil(err)
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000007", Pos: 154}, pos)
+}
+
+func (this *DeltaOnlyTestSuite) TestRejectsMetadataWithoutCoordinates() {
+	_, err := ghostferry.ParseBackupBinlogPosition("")
+	this.Require().EqualError(err, "no binlog coordinates found")
+
+	_, err = ghostferry.ParseBackupBinlogPosition("mysql-bin.000003\tsoon\n")
+	this.Require().EqualError(err, "invalid binlog position soon")
+}
+
+func (this *DeltaOnlyTestSuite) TestReadsStartPositionFromBackupMetadataFile() {
+	dir, err := ioutil.TempDir("", "ghostferry-delta-only")
+	this.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "xtrabackup_binlog_info")
+	this.Require().Nil(ioutil.WriteFile(path, []byte("mysql-bin.000003\t1234\n"), 0600))
+
+	config := &ghostferry.DeltaOnlyConfig{BackupMetadataFile: path}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal(mysql.Position{Name: "mysql-bin.000003", Pos: 1234}, config.StartPosition)
+
+	this.Require().Nil(config.Validate())
+
+	config = &ghostferry.DeltaOnlyConfig{BackupMetadataFile: path, StartPosition: mysql.Position{Name: "mysql-bin.000002", Pos: 4}}
+	this.Require().EqualError(config.Validate(), "StartPosition (mysql-bin.000002, 4) differs from (mysql-bin.000003, 1234) in BackupMetadataFile")
+}
+
+func TestDeltaOnlyTestSuite(t *testing.T) {
+	suite.Run(t, new(DeltaOnlyTestSuite))
+}
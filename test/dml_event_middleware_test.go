@@ -0,0 +1,135 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type DMLEventMiddlewareTestSuite struct {
+	suite.Suite
+
+	table  *schema.Table
+	events []ghostferry.DMLEvent
+}
+
+func (this *DMLEventMiddlewareTestSuite) SetupTest() {
+	this.table = &schema.Table{Schema: "test_schema", Name: "test_table"}
+	this.table.AddColumn("id", "bigint(20) unsigned", "", "auto_increment")
+	this.table.AddColumn("email", "varchar(255)", "", "")
+	this.table.PKColumns = []int{0}
+
+	inserts, err := ghostferry.NewBinlogInsertEvents(this.table, &replication.RowsEvent{
+		Rows: [][]interface{}{{uint64(1), "a@example.com"}},
+	})
+	this.Require().Nil(err)
+
+	updates, err := ghostferry.NewBinlogUpdateEvents(this.table, &replication.RowsEvent{
+		Rows: [][]interface{}{
+			{uint64(1), "a@example.com"},
+			{uint64(1), "b@example.com"},
+		},
+	})
+	this.Require().Nil(err)
+
+	deletes, err := ghostferry.NewBinlogDeleteEvents(this.table, &replication.RowsEvent{
+		Rows: [][]interface{}{{uint64(1), "b@example.com"}},
+	})
+	this.Require().Nil(err)
+
+	this.events = append(append(inserts, updates...), deletes...)
+}
+
+func (this *DMLEventMiddlewareTestSuite) TestChainsMiddlewaresInOrder() {
+	var calls []string
+	middleware := func(name string) ghostferry.DMLEventMiddleware {
+		return ghostferry.DMLEventMiddlewareFunc(func(events []ghostferry.DMLEvent, next ghostferry.DMLEventHandler) error {
+			calls = append(calls, name)
+			return next(events[1:])
+		})
+	}
+
+	var written []ghostferry.DMLEvent
+	handler := ghostferry.ChainDMLEventMiddlewares(func(events []ghostferry.DMLEvent) error {
+		calls = append(calls, "writer")
+		written = events
+		return nil
+	}, middleware("first"), middleware("second"))
+
+	this.Require().Nil(handler(this.events))
+	this.Require().Equal([]string{"first", "second", "writer"}, calls)
+	this.Require().Equal(this.events[2:], written)
+}
+
+func (this *DMLEventMiddlewareTestSuite) TestTransformsOldAndNewValues() {
+	var written []ghostferry.DMLEvent
+	handler := ghostferry.ChainDMLEventMiddlewares(func(events []ghostferry.DMLEvent) error {
+		written = events
+		return nil
+	}, ghostferry.TransformDMLEventRows(func(ev ghostferry.DMLEvent, row ghostferry.RowData) (ghostferry.RowData, error) {
+		return ghostferry.RowData{row[0], "redacted"}, nil
+	}))
+
+	this.Require().Nil(handler(this.events))
+	this.Require().Equal(3, len(written))
+
+	statement, err := written[1].AsSQLString(this.table)
+	this.Require().Nil(err)
+	this.Require().Equal("UPDATE `test_schema`.`test_table` SET `id`=1,`email`='redacted' WHERE `id`=1 AND `email`='redacted'", statement)
+	this.Require().Equal("delete", ghostferry.DMLEventType(written[2]))
+}
+
+func (this *DMLEventMiddlewareTestSuite) TestFilterPluginDropsTablesAndTypes() {
+	f := &ghostferry.Ferry{Config: &ghostferry.Config{
+		DMLEventMiddlewares: []*ghostferry.PluginConfig{
+			{Name: ghostferry.DMLEventMiddlewareFilter, Options: json.RawMessage(`{"Types": ["delete"]}`)},
+		},
+	}}
+
+	plugin, err := f.NewDMLEventMiddleware(f.Config.DMLEventMiddlewares[0])
+	this.Require().Nil(err)
+
+	var written []ghostferry.DMLEvent
+	handler := ghostferry.ChainDMLEventMiddlewares(func(events []ghostferry.DMLEvent) error {
+		written = events
+		return nil
+	}, plugin)
+
+	this.Require().Nil(handler(this.events))
+	this.Require().Equal(this.events[:2], written)
+
+	_, err = f.NewDMLEventMiddleware(&ghostferry.PluginConfig{
+		Name:    ghostferry.DMLEventMiddlewareFilter,
+		Options: json.RawMessage(`{"Types": ["truncate"]}`),
+	})
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "invalid event type truncate")
+}
+
+func (this *DMLEventMiddlewareTestSuite) TestValidatesMiddlewareConfigs() {
+	config := &ghostferry.Config{
+		Source:      ghostferry.DatabaseConfig{Host: "example.com", Port: 3306, User: "ghostferry"},
+		Target:      ghostferry.DatabaseConfig{Host: "example.com", Port: 3306, User: "ghostferry"},
+		MyServerId:  99399,
+		TableFilter: &testhelpers.TestTableFilter{},
+		DMLEventMiddlewares: []*ghostferry.PluginConfig{
+			{Name: ghostferry.DMLEventMiddlewareCount},
+			{Name: "unknown"},
+		},
+	}
+
+	err := config.ValidateConfig()
+	this.Require().EqualError(err, "DMLEventMiddlewares[1]: dml_event_middleware plugin unknown is not registered")
+
+	config.DMLEventMiddlewares = config.DMLEventMiddlewares[:1]
+	this.Require().Nil(config.ValidateConfig())
+}
+
+func TestDMLEventMiddlewareTestSuite(t *testing.T) {
+	suite.Run(t, new(DMLEventMiddlewareTestSuite))
+}
@@ -1,9 +1,14 @@
 package test
 
 import (
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/Shopify/ghostferry"
+	sqlmysql "github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/replication"
 	"github.com/siddontang/go-mysql/schema"
 	"github.com/stretchr/testify/suite"
@@ -240,6 +245,177 @@ func (this *DMLEventsTestSuite) TestBinlogDeleteEventMetadata() {
 	this.Require().Nil(dmlEvents[0].NewValues())
 }
 
+func (this *DMLEventsTestSuite) TestBinlogDMLEventsHaveTransactionPosition() {
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Table: this.tableMapEvent,
+			Rows:  [][]interface{}{{1000, []byte("val1"), true}, {1001, []byte("val2"), false}},
+		},
+	}
+
+	pos := mysql.Position{Name: "mysql-bin.000001", Pos: 1234}
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.sourceTable, ev, pos)
+	this.Require().Nil(err)
+	this.Require().Equal(2, len(dmlEvents))
+
+	for _, dmlEvent := range dmlEvents {
+		this.Require().Equal(pos, dmlEvent.BinlogPosition())
+	}
+}
+
+func (this *DMLEventsTestSuite) TestBinlogDMLEventsHaveEventTimestamp() {
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2, Timestamp: 1500000000},
+		Event: &replication.RowsEvent{
+			Table: this.tableMapEvent,
+			Rows:  [][]interface{}{{1000, []byte("val1"), true}},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.sourceTable, ev, mysql.Position{})
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(dmlEvents))
+	this.Require().Equal(time.Unix(1500000000, 0), dmlEvents[0].Timestamp())
+}
+
+func (this *DMLEventsTestSuite) escapedInsertValues(value interface{}) string {
+	rowsEvent := &replication.RowsEvent{
+		Table: this.tableMapEvent,
+		Rows:  [][]interface{}{{1000, value, nil}},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogInsertEvents(this.sourceTable, rowsEvent)
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(dmlEvents))
+
+	q, err := dmlEvents[0].AsSQLString(this.targetTable)
+	this.Require().Nil(err)
+
+	prefix := "INSERT IGNORE INTO `target_schema`.`target_table` (`col1`,`col2`,`col3`) VALUES (1000,"
+	suffix := ",NULL)"
+	this.Require().True(len(q) > len(prefix)+len(suffix), q)
+	return q[len(prefix) : len(q)-len(suffix)]
+}
+
+func (this *DMLEventsTestSuite) TestEscapesIntegerTypes() {
+	this.Require().Equal("-128", this.escapedInsertValues(int8(-128)))
+	this.Require().Equal("-32768", this.escapedInsertValues(int16(-32768)))
+	this.Require().Equal("-8388608", this.escapedInsertValues(int32(-8388608)))
+	this.Require().Equal("-9223372036854775808", this.escapedInsertValues(int64(-9223372036854775808)))
+	this.Require().Equal("255", this.escapedInsertValues(uint8(255)))
+	this.Require().Equal("18446744073709551615", this.escapedInsertValues(uint64(18446744073709551615)))
+}
+
+func (this *DMLEventsTestSuite) TestEscapesFloatAndDecimalTypes() {
+	this.Require().Equal("1.5", this.escapedInsertValues(float32(1.5)))
+	this.Require().Equal("3.14159", this.escapedInsertValues(float64(3.14159)))
+
+	d, err := decimal.NewFromString("-1234.5600")
+	this.Require().Nil(err)
+	this.Require().Equal("'-1234.56'", this.escapedInsertValues(d))
+}
+
+// Returns the escaped value of the second column, of the given type, of a
+// row inserted on the source as decoded from the binlog.
+func (this *DMLEventsTestSuite) escapedBinlogValue(column schema.TableColumn, value interface{}) string {
+	column.Name = "col2"
+	table := &schema.Table{
+		Schema:  "test_schema",
+		Name:    "test_table",
+		Columns: []schema.TableColumn{{Name: "col1"}, column, {Name: "col3"}},
+	}
+
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.WRITE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Table: this.tableMapEvent,
+			Rows:  [][]interface{}{{int64(1000), value, nil}},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(table, ev, mysql.Position{})
+	this.Require().Nil(err)
+
+	q, err := dmlEvents[0].AsSQLString(this.targetTable)
+	this.Require().Nil(err)
+
+	prefix := "INSERT IGNORE INTO `target_schema`.`target_table` (`col1`,`col2`,`col3`) VALUES (1000,"
+	suffix := ",NULL)"
+	this.Require().True(len(q) > len(prefix)+len(suffix), q)
+	return q[len(prefix) : len(q)-len(suffix)]
+}
+
+func (this *DMLEventsTestSuite) TestEscapesBitType() {
+	bit8 := schema.TableColumn{Type: schema.TYPE_BIT, RawType: "bit(8)"}
+	bit64 := schema.TableColumn{Type: schema.TYPE_BIT, RawType: "bit(64)"}
+
+	// The binlog decodes b'10100101' as an int64, and the driver reads it
+	// as a bit string.
+	this.Require().Equal("165", this.escapedBinlogValue(bit8, int64(165)))
+	this.Require().Equal("_binary'\xa5'", this.escapedInsertValues([]byte{0xa5}))
+
+	// b'1111...1' of a BIT(64) is decoded as -1.
+	this.Require().Equal("18446744073709551615", this.escapedBinlogValue(bit64, int64(-1)))
+	this.Require().Equal("_binary'\xff\xff\xff\xff\xff\xff\xff\xff'", this.escapedInsertValues([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+}
+
+func (this *DMLEventsTestSuite) TestEscapesEnumType() {
+	enum := schema.TableColumn{Type: schema.TYPE_ENUM, RawType: "enum('a','b','c')", EnumValues: []string{"a", "b", "c"}}
+
+	// The binlog decodes 'b' as its index in the definition, starting at
+	// 1, which MySQL inserts as the member of that index, and the driver
+	// reads it as its label.
+	this.Require().Equal("2", this.escapedBinlogValue(enum, int64(2)))
+	this.Require().Equal("_binary'b'", this.escapedInsertValues([]byte("b")))
+}
+
+func (this *DMLEventsTestSuite) TestEscapesSetType() {
+	set := schema.TableColumn{Type: schema.TYPE_SET, RawType: "set('a','b','c')", SetValues: []string{"a", "b", "c"}}
+
+	// The binlog decodes 'a,c' as the bitmask of its members, and the
+	// driver reads it as the comma separated members.
+	this.Require().Equal("5", this.escapedBinlogValue(set, int64(5)))
+	this.Require().Equal("_binary'a,c'", this.escapedInsertValues([]byte("a,c")))
+
+	// The bitmask of the 64th member of a SET is decoded as a negative
+	// int64.
+	this.Require().Equal("9223372036854775808", this.escapedBinlogValue(set, int64(-9223372036854775808)))
+}
+
+func (this *DMLEventsTestSuite) TestEscapesYearType() {
+	this.Require().Equal("2018", this.escapedInsertValues(int(2018)))
+}
+
+func (this *DMLEventsTestSuite) TestEscapesTemporalStrings() {
+	this.Require().Equal("'2018-03-04'", this.escapedInsertValues("2018-03-04"))
+	this.Require().Equal("'-838:59:59.000000'", this.escapedInsertValues("-838:59:59.000000"))
+	this.Require().Equal("'2018-03-04 05:06:07.123'", this.escapedInsertValues("2018-03-04 05:06:07.123"))
+	this.Require().Equal("'0000-00-00 00:00:00'", this.escapedInsertValues("0000-00-00 00:00:00"))
+}
+
+func (this *DMLEventsTestSuite) TestEscapesTimeValues() {
+	t := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	this.Require().Equal("'2018-03-04 05:06:07'", this.escapedInsertValues(t))
+	this.Require().Equal("'2018-03-04 05:06:07'", this.escapedInsertValues(&t))
+
+	t = time.Date(2018, 3, 4, 5, 6, 7, 120000000, time.UTC)
+	this.Require().Equal("'2018-03-04 05:06:07.12'", this.escapedInsertValues(t))
+
+	this.Require().Equal("'2018-03-04 05:06:07.12'", this.escapedInsertValues(sqlmysql.NullTime{Time: t, Valid: true}))
+	this.Require().Equal("NULL", this.escapedInsertValues(sqlmysql.NullTime{}))
+	this.Require().Equal("'2018-03-04 05:06:07.12'", this.escapedInsertValues(sql.NullTime{Time: t, Valid: true}))
+	this.Require().Equal("NULL", this.escapedInsertValues(sql.NullTime{}))
+	this.Require().Equal("NULL", this.escapedInsertValues((*time.Time)(nil)))
+}
+
+func (this *DMLEventsTestSuite) TestEscapesStringAndBinaryTypes() {
+	this.Require().Equal("'it''s'", this.escapedInsertValues("it's"))
+	this.Require().Equal("_binary'\x00''\xff'", this.escapedInsertValues([]byte{0, '\'', 0xff}))
+	this.Require().Equal("_binary'raw'", this.escapedInsertValues(sql.RawBytes("raw")))
+	this.Require().Equal("NULL", this.escapedInsertValues(sql.RawBytes(nil)))
+}
+
 func TestDMLEventsTestSuite(t *testing.T) {
 	suite.Run(t, new(DMLEventsTestSuite))
 }
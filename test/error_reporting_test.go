@@ -0,0 +1,173 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+)
+
+type ErrorReportingTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	mutex    sync.Mutex
+	paths    []string
+	headers  []http.Header
+	bodies   [][]byte
+	response int
+}
+
+func (this *ErrorReportingTestSuite) SetupTest() {
+	this.paths = nil
+	this.headers = nil
+	this.bodies = nil
+	this.response = http.StatusOK
+
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+
+		body, err := ioutil.ReadAll(r.Body)
+		this.Assert().Nil(err)
+
+		this.paths = append(this.paths, r.URL.Path)
+		this.headers = append(this.headers, r.Header)
+		this.bodies = append(this.bodies, body)
+		w.WriteHeader(this.response)
+	}))
+}
+
+func (this *ErrorReportingTestSuite) TearDownTest() {
+	this.server.Close()
+}
+
+func (this *ErrorReportingTestSuite) newReporter(config *ghostferry.ErrorReportingConfig) *ghostferry.ErrorReporter {
+	this.Require().Nil(config.Validate())
+
+	reporter := &ghostferry.ErrorReporter{Config: config}
+	reporter.Initialize()
+	return reporter
+}
+
+func (this *ErrorReportingTestSuite) newReport() *ghostferry.ErrorReport {
+	return &ghostferry.ErrorReport{
+		Time:                  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		GhostferryVersion:     "1.1.0",
+		From:                  "binlog_writer",
+		Class:                 "target_conflict",
+		Message:               "Error 1062: Duplicate entry '1' for key 'PRIMARY'",
+		OverallState:          ghostferry.StateCopying,
+		LastStreamedBinlogPos: "(mysql-bin.000002, 1234)",
+		LastWrittenBinlogPos:  "(mysql-bin.000002, 1000)",
+		TablesInProgress: []ghostferry.ErrorReportTable{
+			{Name: "shop.orders", LastSuccessfulPK: 200, TargetPK: 1000},
+		},
+		CompletedTableCount: 3,
+	}
+}
+
+func (this *ErrorReportingTestSuite) TestReportsToWebhook() {
+	reporter := this.newReporter(&ghostferry.ErrorReportingConfig{
+		Type:        ghostferry.ErrorReporterWebhook,
+		URL:         this.server.URL + "/errors",
+		Secret:      "secret",
+		Environment: "production",
+		Tags:        map[string]string{"tenant": "42"},
+	})
+
+	this.Require().Nil(reporter.Report(this.newReport()))
+
+	this.Require().Equal([]string{"/errors"}, this.paths)
+	this.Require().Equal("sha256="+ghostferry.SignWebhookBody("secret", this.bodies[0]), this.headers[0].Get(ghostferry.WebhookSignatureHeader))
+
+	var report ghostferry.ErrorReport
+	this.Require().Nil(json.Unmarshal(this.bodies[0], &report))
+	this.Require().Equal("binlog_writer", report.From)
+	this.Require().Equal("production", report.Environment)
+	this.Require().Equal(map[string]string{"tenant": "42"}, report.Tags)
+	this.Require().Equal("(mysql-bin.000002, 1000)", report.LastWrittenBinlogPos)
+	this.Require().Equal([]ghostferry.ErrorReportTable{{Name: "shop.orders", LastSuccessfulPK: 200, TargetPK: 1000}}, report.TablesInProgress)
+}
+
+func (this *ErrorReportingTestSuite) TestReportsToSentry() {
+	dsn := strings.Replace(this.server.URL, "http://", "http://public@", 1) + "/sentry/7"
+	reporter := this.newReporter(&ghostferry.ErrorReportingConfig{
+		Type: ghostferry.ErrorReporterSentry,
+		URL:  dsn,
+		Tags: map[string]string{"tenant": "42"},
+	})
+
+	report := this.newReport()
+	report.Panic = true
+	report.Stack = "goroutine 1 [running]:"
+	this.Require().Nil(reporter.Report(report))
+
+	this.Require().Equal([]string{"/sentry/api/7/store/"}, this.paths)
+	this.Require().Contains(this.headers[0].Get("X-Sentry-Auth"), "sentry_key=public")
+	this.Require().NotContains(this.headers[0].Get("X-Sentry-Auth"), "sentry_secret")
+
+	var event struct {
+		EventID   string `json:"event_id"`
+		Timestamp string
+		Level     string
+		Message   string
+		Tags      map[string]string
+		Extra     map[string]interface{}
+		Exception struct {
+			Values []map[string]string
+		}
+	}
+	this.Require().Nil(json.Unmarshal(this.bodies[0], &event))
+	this.Require().Len(event.EventID, 32)
+	this.Require().Equal("2020-01-02T03:04:05", event.Timestamp)
+	this.Require().Equal("fatal", event.Level)
+	this.Require().Equal(report.Message, event.Message)
+	this.Require().Equal("binlog_writer", event.Tags["errfrom"])
+	this.Require().Equal("42", event.Tags["tenant"])
+	this.Require().Equal("(mysql-bin.000002, 1234)", event.Extra["last_streamed_binlog_pos"])
+	this.Require().Equal("goroutine 1 [running]:", event.Extra["stack"])
+	this.Require().Equal("panic", event.Exception.Values[0]["type"])
+}
+
+func (this *ErrorReportingTestSuite) TestReturnsFailedReports() {
+	this.response = http.StatusInternalServerError
+	reporter := this.newReporter(&ghostferry.ErrorReportingConfig{
+		Type: ghostferry.ErrorReporterWebhook,
+		URL:  this.server.URL,
+	})
+
+	err := reporter.Report(this.newReport())
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "500")
+}
+
+func (this *ErrorReportingTestSuite) TestValidate() {
+	config := &ghostferry.ErrorReportingConfig{Type: "email", URL: "https://example.com"}
+	this.Require().EqualError(config.Validate(), "invalid Type email, must be sentry or webhook")
+
+	config = &ghostferry.ErrorReportingConfig{Type: ghostferry.ErrorReporterWebhook, URL: "ftp://example.com"}
+	this.Require().EqualError(config.Validate(), "URL must be an http or https URL, got ftp://example.com")
+
+	config = &ghostferry.ErrorReportingConfig{Type: ghostferry.ErrorReporterSentry, URL: "https://sentry.example.com/7"}
+	this.Require().EqualError(config.Validate(), "the sentry DSN has no public key")
+
+	config = &ghostferry.ErrorReportingConfig{Type: ghostferry.ErrorReporterSentry, URL: "https://public@sentry.example.com"}
+	this.Require().EqualError(config.Validate(), "the sentry DSN has no project")
+
+	config = &ghostferry.ErrorReportingConfig{Type: ghostferry.ErrorReporterSentry, URL: "https://public@sentry.example.com/7"}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("10s", config.Timeout)
+}
+
+func TestErrorReportingTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrorReportingTestSuite))
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	sqlmysql "github.com/go-sql-driver/mysql"
+	juju "github.com/juju/errors"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrorClassTestSuite struct {
+	suite.Suite
+}
+
+func (this *ErrorClassTestSuite) TestClassifiesMySQLErrorsByCode() {
+	classes := map[uint16]ghostferry.ErrorClass{
+		1062: ghostferry.ErrorClassTargetConflict,
+		1205: ghostferry.ErrorClassTargetConflict,
+		1142: ghostferry.ErrorClassPermission,
+		1366: ghostferry.ErrorClassDataConversion,
+		1406: ghostferry.ErrorClassDataConversion,
+		1146: ghostferry.ErrorClassSchemaMismatch,
+		1054: ghostferry.ErrorClassSchemaMismatch,
+		1158: ghostferry.ErrorClassNetwork,
+		1064: ghostferry.ErrorClassUnknown,
+	}
+
+	for number, class := range classes {
+		err := &sqlmysql.MySQLError{Number: number, Message: "error"}
+		this.Require().Equal(class, ghostferry.ClassifyError(err), "error %d", number)
+	}
+}
+
+func (this *ErrorClassTestSuite) TestClassifiesConnectionErrorsAsNetwork() {
+	this.Require().Equal(ghostferry.ErrorClassNetwork, ghostferry.ClassifyError(driver.ErrBadConn))
+	this.Require().Equal(ghostferry.ErrorClassNetwork, ghostferry.ClassifyError(sqlmysql.ErrInvalidConn))
+	this.Require().Equal(ghostferry.ErrorClassNetwork, ghostferry.ClassifyError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+}
+
+func (this *ErrorClassTestSuite) TestUnwrapsClassifiedAndTracedErrors() {
+	err := ghostferry.NewClassifiedError(ghostferry.ErrorClassPermission, errors.New("no grant"))
+	this.Require().Equal(ghostferry.ErrorClassPermission, ghostferry.ClassifyError(err))
+	this.Require().Equal("no grant", err.Error())
+
+	traced := juju.Trace(&sqlmysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	this.Require().Equal(ghostferry.ErrorClassTargetConflict, ghostferry.ClassifyError(traced))
+
+	this.Require().Equal(ghostferry.ErrorClassUnknown, ghostferry.ClassifyError(fmt.Errorf("something else")))
+	this.Require().Equal(ghostferry.ErrorClassUnknown, ghostferry.ClassifyError(nil))
+}
+
+func (this *ErrorClassTestSuite) TestEventsNotMatchingTheSchemaAreSchemaMismatches() {
+	table := &schema.Table{Schema: "gftest", Name: "table1"}
+	table.AddColumn("id", "bigint(20)", "", "")
+	table.AddColumn("data", "varchar(255)", "", "")
+	table.PKColumns = []int{0}
+
+	events, err := ghostferry.NewBinlogInsertEvents(table, &replication.RowsEvent{
+		Rows: [][]interface{}{{int64(1)}},
+	})
+	this.Require().Nil(err)
+
+	_, err = events[0].AsSQLString(table)
+	this.Require().EqualError(err, "table gftest.table1 has 2 columns but event has 1 columns instead")
+	this.Require().Equal(ghostferry.ErrorClassSchemaMismatch, ghostferry.ClassifyError(err))
+}
+
+func TestErrorClassTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrorClassTestSuite))
+}
@@ -0,0 +1,45 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplacesRowsEnteringTheExpressionFilterOnTheTarget(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.EventFilterExpressions = map[string]string{
+		"gftest.table1": "new.data != 'draft'",
+	}
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T: t,
+		SetupAction: func(f *testhelpers.TestFerry) {
+			setupSingleTableDatabase(f)
+
+			_, err := f.SourceDB.Exec("UPDATE gftest.table1 SET data = 'draft' WHERE id = 1")
+			testhelpers.PanicIfError(err)
+		},
+		AfterRowCopyIsComplete: func(f *testhelpers.TestFerry) {
+			// The DataIterator copies the row regardless of the expression,
+			// so the row entering the filter is already on the target.
+			var data string
+			row := f.TargetDB.QueryRow("SELECT data FROM gftest.table1 WHERE id = 1")
+			testhelpers.PanicIfError(row.Scan(&data))
+			require.Equal(t, "draft", data)
+
+			_, err := f.SourceDB.Exec("UPDATE gftest.table1 SET data = 'paid' WHERE id = 1")
+			testhelpers.PanicIfError(err)
+		},
+		CustomVerifyAction: func(f *testhelpers.TestFerry) {
+			var data string
+			row := f.TargetDB.QueryRow("SELECT data FROM gftest.table1 WHERE id = 1")
+			testhelpers.PanicIfError(row.Scan(&data))
+			require.Equal(t, "paid", data)
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+}
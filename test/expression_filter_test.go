@@ -0,0 +1,262 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExpressionFilterTestSuite struct {
+	suite.Suite
+
+	table *schema.Table
+}
+
+func (this *ExpressionFilterTestSuite) SetupTest() {
+	this.table = &schema.Table{
+		Schema: "gftest",
+		Name:   "orders",
+		Columns: []schema.TableColumn{
+			{Name: "id"},
+			{Name: "status"},
+			{Name: "amount"},
+		},
+	}
+}
+
+func (this *ExpressionFilterTestSuite) insertEvent(row []interface{}) ghostferry.DMLEvent {
+	events, err := ghostferry.NewBinlogInsertEvents(this.table, &replication.RowsEvent{Rows: [][]interface{}{row}})
+	this.Require().Nil(err)
+	return events[0]
+}
+
+func (this *ExpressionFilterTestSuite) updateEvent(oldRow, newRow []interface{}) ghostferry.DMLEvent {
+	events, err := ghostferry.NewBinlogUpdateEvents(this.table, &replication.RowsEvent{Rows: [][]interface{}{oldRow, newRow}})
+	this.Require().Nil(err)
+	return events[0]
+}
+
+func (this *ExpressionFilterTestSuite) matches(source string, ev ghostferry.DMLEvent) bool {
+	expression, err := ghostferry.CompileEventExpression(source)
+	this.Require().Nil(err)
+
+	matches, err := expression.Matches(ev)
+	this.Require().Nil(err)
+	return matches
+}
+
+func (this *ExpressionFilterTestSuite) TestComparesStrings() {
+	ev := this.insertEvent([]interface{}{int64(1), []byte("draft"), int64(50)})
+
+	this.Require().False(this.matches("new.status != 'draft'", ev))
+	this.Require().True(this.matches(`new.status == "draft"`, ev))
+	this.Require().True(this.matches("new.status < 'final'", ev))
+}
+
+func (this *ExpressionFilterTestSuite) TestComparesNumbers() {
+	ev := this.insertEvent([]interface{}{uint64(1), []byte("paid"), int32(50)})
+
+	this.Require().True(this.matches("new.amount > 10.5", ev))
+	this.Require().True(this.matches("new.amount >= 50 && new.id == 1", ev))
+	this.Require().False(this.matches("new.amount < -1", ev))
+}
+
+func (this *ExpressionFilterTestSuite) TestComparesEnumsAndSets() {
+	this.table.Columns[1] = schema.TableColumn{Name: "status", Type: schema.TYPE_ENUM, EnumValues: []string{"draft", "paid"}}
+	this.table.Columns = append(this.table.Columns, schema.TableColumn{Name: "flags", Type: schema.TYPE_SET, SetValues: []string{"gift", "rush", "fragile"}})
+
+	// The binlog gives the 1-based index of ENUM values and the bitmask of
+	// SET values.
+	ev := this.insertEvent([]interface{}{int64(1), int64(2), int64(50), int64(5)})
+
+	this.Require().True(this.matches("new.status != 'draft'", ev))
+	this.Require().True(this.matches("new.status == 'paid'", ev))
+	this.Require().True(this.matches("new.flags == 'gift,fragile'", ev))
+
+	ev = this.insertEvent([]interface{}{int64(1), int64(0), int64(50), int64(0)})
+
+	this.Require().True(this.matches("new.status == ''", ev))
+	this.Require().True(this.matches("new.flags == ''", ev))
+}
+
+func (this *ExpressionFilterTestSuite) TestComparesTemporalValues() {
+	this.table.Columns = append(this.table.Columns,
+		schema.TableColumn{Name: "created_at", Type: schema.TYPE_DATETIME, RawType: "datetime"},
+		schema.TableColumn{Name: "paid_at", Type: schema.TYPE_TIMESTAMP, RawType: "timestamp(6)"},
+		schema.TableColumn{Name: "due_on", Type: schema.TYPE_DATE, RawType: "date"},
+	)
+
+	ev := this.insertEvent([]interface{}{
+		int64(1), []byte("paid"), int64(50),
+		time.Date(2018, 1, 31, 10, 0, 0, 0, time.UTC),
+		time.Date(2018, 2, 1, 9, 30, 0, 500000000, time.UTC),
+		time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	this.Require().True(this.matches("new.created_at == '2018-01-31 10:00:00'", ev))
+	this.Require().True(this.matches("new.created_at >= '2018-01-31'", ev))
+	this.Require().True(this.matches("new.paid_at == '2018-02-01 09:30:00.500000'", ev))
+	this.Require().True(this.matches("new.paid_at > new.created_at", ev))
+	this.Require().True(this.matches("new.due_on == '2018-03-01'", ev))
+	this.Require().False(this.matches("new.due_on < '2018-02-28'", ev))
+}
+
+func (this *ExpressionFilterTestSuite) TestBooleanOperators() {
+	ev := this.updateEvent(
+		[]interface{}{int64(1), []byte("draft"), int64(50)},
+		[]interface{}{int64(1), []byte("paid"), int64(150)},
+	)
+
+	this.Require().True(this.matches("old.status == 'draft' && !(new.status == 'draft')", ev))
+	this.Require().True(this.matches("old.amount > 100 || new.amount > 100", ev))
+	this.Require().False(this.matches("!(old.amount > 100 || new.amount > 100)", ev))
+}
+
+func (this *ExpressionFilterTestSuite) TestMissingSideOfEventIsNull() {
+	ev := this.insertEvent([]interface{}{int64(1), nil, int64(50)})
+
+	this.Require().True(this.matches("old.status == null", ev))
+	this.Require().True(this.matches("new.status == null", ev))
+	this.Require().False(this.matches("old.amount > 10", ev))
+	this.Require().True(this.matches("old.id == null || old.id > 10", ev))
+}
+
+func (this *ExpressionFilterTestSuite) TestCompileErrors() {
+	for _, source := range []string{
+		"new.status ==",
+		"new.status == 'draft",
+		"(new.id == 1",
+		"new. == 1",
+		"status == 1",
+		"new.id == 1 new.id",
+		"new.id # 1",
+	} {
+		_, err := ghostferry.CompileEventExpression(source)
+		this.Require().NotNil(err, source)
+	}
+}
+
+func (this *ExpressionFilterTestSuite) TestEvaluationErrors() {
+	ev := this.insertEvent([]interface{}{int64(1), []byte("draft"), int64(50)})
+
+	for _, source := range []string{
+		"new.status > 1",
+		"new.status",
+		"!new.id",
+		"new.id && true",
+	} {
+		expression, err := ghostferry.CompileEventExpression(source)
+		this.Require().Nil(err, source)
+
+		_, err = expression.Matches(ev)
+		this.Require().NotNil(err, source)
+	}
+}
+
+func (this *ExpressionFilterTestSuite) TestFilterOnlyAppliesToConfiguredTables() {
+	filter, err := ghostferry.NewExpressionEventFilter(map[string]string{
+		"gftest.orders": "new.status != 'draft'",
+	})
+	this.Require().Nil(err)
+
+	evs, err := filter.FilterEvent(this.insertEvent([]interface{}{int64(1), []byte("draft"), int64(50)}))
+	this.Require().Nil(err)
+	this.Require().Empty(evs)
+
+	otherTable := &schema.Table{Schema: "gftest", Name: "other", Columns: this.table.Columns}
+	events, err := ghostferry.NewBinlogInsertEvents(otherTable, &replication.RowsEvent{Rows: [][]interface{}{{int64(1), []byte("draft"), int64(50)}}})
+	this.Require().Nil(err)
+
+	evs, err = filter.FilterEvent(events[0])
+	this.Require().Nil(err)
+	this.Require().Equal(events, evs)
+}
+
+func (this *ExpressionFilterTestSuite) TestFilterConvertsUpdatesOfRowsLeavingAndEnteringTheFilter() {
+	filter, err := ghostferry.NewExpressionEventFilter(map[string]string{
+		"gftest.orders": "new.status != 'draft'",
+	})
+	this.Require().Nil(err)
+
+	draft := []interface{}{int64(1), []byte("draft"), int64(50)}
+	paid := []interface{}{int64(1), []byte("paid"), int64(50)}
+	refunded := []interface{}{int64(1), []byte("refunded"), int64(50)}
+
+	evs, err := filter.FilterEvent(this.updateEvent(paid, draft))
+	this.Require().Nil(err)
+	this.Require().Equal(1, len(evs))
+	this.Require().IsType(&ghostferry.BinlogDeleteEvent{}, evs[0])
+	this.Require().Equal(ghostferry.RowData(paid), evs[0].OldValues())
+
+	query, err := evs[0].AsSQLString(this.table)
+	this.Require().Nil(err)
+	this.Require().Equal("DELETE FROM `gftest`.`orders` WHERE `id`=1 AND `status`=_binary'paid' AND `amount`=50", query)
+
+	// The row entering the filter is usually on the target already, as the
+	// DataIterator copies it regardless of the expression.
+	evs, err = filter.FilterEvent(this.updateEvent(draft, paid))
+	this.Require().Nil(err)
+	this.Require().Equal(2, len(evs))
+	this.Require().IsType(&ghostferry.BinlogDeleteEvent{}, evs[0])
+	this.Require().Equal(ghostferry.RowData(draft), evs[0].OldValues())
+	this.Require().IsType(&ghostferry.BinlogInsertEvent{}, evs[1])
+	this.Require().Equal(ghostferry.RowData(paid), evs[1].NewValues())
+
+	query, err = evs[0].AsSQLString(this.table)
+	this.Require().Nil(err)
+	this.Require().Equal("DELETE FROM `gftest`.`orders` WHERE `id`=1 AND `status`=_binary'draft' AND `amount`=50", query)
+
+	update := this.updateEvent(paid, refunded)
+	evs, err = filter.FilterEvent(update)
+	this.Require().Nil(err)
+	this.Require().Equal([]ghostferry.DMLEvent{update}, evs)
+
+	evs, err = filter.FilterEvent(this.updateEvent(draft, draft))
+	this.Require().Nil(err)
+	this.Require().Empty(evs)
+}
+
+func (this *ExpressionFilterTestSuite) TestFilterKeepsUpdatesMatchingTransitions() {
+	filter, err := ghostferry.NewExpressionEventFilter(map[string]string{
+		"gftest.orders": "old.amount != new.amount",
+	})
+	this.Require().Nil(err)
+
+	update := this.updateEvent(
+		[]interface{}{int64(1), []byte("paid"), int64(50)},
+		[]interface{}{int64(1), []byte("paid"), int64(150)},
+	)
+	evs, err := filter.FilterEvent(update)
+	this.Require().Nil(err)
+	this.Require().Equal([]ghostferry.DMLEvent{update}, evs)
+
+	evs, err = filter.FilterEvent(this.updateEvent(
+		[]interface{}{int64(1), []byte("paid"), int64(50)},
+		[]interface{}{int64(1), []byte("refunded"), int64(50)},
+	))
+	this.Require().Nil(err)
+	this.Require().Empty(evs)
+}
+
+func (this *ExpressionFilterTestSuite) TestFilterValidatesColumnsAndTables() {
+	tables := ghostferry.TableSchemaCache{"gftest.orders": this.table}
+
+	filter, err := ghostferry.NewExpressionEventFilter(map[string]string{"gftest.orders": "new.state != 'draft'"})
+	this.Require().Nil(err)
+	this.Require().EqualError(filter.Validate(tables), "invalid expression for table gftest.orders: table gftest.orders has no column state")
+
+	filter, err = ghostferry.NewExpressionEventFilter(map[string]string{"gftest.missing": "new.id > 1"})
+	this.Require().Nil(err)
+	this.Require().EqualError(filter.Validate(tables), "expression given for table gftest.missing which is not being ferried")
+
+	_, err = ghostferry.NewExpressionEventFilter(map[string]string{"gftest.orders": "new.id >"})
+	this.Require().NotNil(err)
+}
+
+func TestExpressionFilterTestSuite(t *testing.T) {
+	suite.Run(t, new(ExpressionFilterTestSuite))
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type FeaturesTestSuite struct {
+	suite.Suite
+}
+
+func (this *FeaturesTestSuite) TestParseServerVersion() {
+	v, err := ghostferry.ParseServerVersion("8.0.32-log")
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.FlavorMySQL, v.Flavor)
+	this.Require().Equal([]int{8, 0, 32}, []int{v.Major, v.Minor, v.Patch})
+
+	v, err = ghostferry.ParseServerVersion("10.6.12-MariaDB-log")
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.FlavorMariaDB, v.Flavor)
+	this.Require().Equal("mariadb 10.6.12", v.String())
+
+	v, err = ghostferry.ParseServerVersion("5.5.5-10.11.6-MariaDB-log")
+	this.Require().Nil(err)
+	this.Require().Equal("mariadb 10.11.6", v.String())
+
+	_, err = ghostferry.ParseServerVersion("unknown")
+	this.Require().EqualError(err, "cannot parse server version unknown")
+}
+
+func (this *FeaturesTestSuite) TestAtLeast() {
+	v, err := ghostferry.ParseServerVersion("5.7.8")
+	this.Require().Nil(err)
+
+	this.Require().True(v.AtLeast(5, 7, 8))
+	this.Require().True(v.AtLeast(5, 6, 40))
+	this.Require().False(v.AtLeast(5, 7, 9))
+	this.Require().False(v.AtLeast(8, 0, 0))
+}
+
+func (this *FeaturesTestSuite) TestFeaturesDependOnVersionAndFlavor() {
+	mysql57 := this.features("5.7.40-log")
+	mysql57.EnforceGTIDConsistency = "ON"
+	mysql57.GTIDMode = "ON"
+	this.Require().True(mysql57.SupportsJSON())
+	this.Require().True(mysql57.SupportsGeneratedColumns())
+	this.Require().False(mysql57.SupportsInvisiblePrimaryKeys())
+	this.Require().True(mysql57.GTIDEnabled())
+	this.Require().True(mysql57.RejectsTemporaryTablesInTransactions())
+
+	mysql8 := this.features("8.0.30")
+	mysql8.EnforceGTIDConsistency = "ON"
+	this.Require().True(mysql8.SupportsInvisiblePrimaryKeys())
+	this.Require().False(mysql8.RejectsTemporaryTablesInTransactions())
+
+	mariadb := this.features("10.1.48-MariaDB")
+	mariadb.GTIDMode = "ON"
+	this.Require().False(mariadb.SupportsJSON())
+	this.Require().False(mariadb.GTIDEnabled())
+}
+
+func (this *FeaturesTestSuite) TestMatrixListsBothServersAndDisabledFeatures() {
+	report := &ghostferry.FeatureReport{
+		Source: this.features("8.0.32"),
+	}
+	report.Source.BinlogFormat = "ROW"
+	report.Disable("StageRowBatches", "not today")
+
+	matrix := report.Matrix()
+	this.Require().Contains(matrix, "version                   mysql 8.0.32  n/a")
+	this.Require().Contains(matrix, "binlog_format             ROW           n/a")
+	this.Require().Contains(matrix, "gtid_mode                 -             n/a")
+	this.Require().Contains(matrix, "disabled StageRowBatches: not today")
+	this.Require().Equal([]string{"StageRowBatches: not today"}, report.Disabled())
+}
+
+func (this *FeaturesTestSuite) features(version string) *ghostferry.ServerFeatures {
+	v, err := ghostferry.ParseServerVersion(version)
+	this.Require().Nil(err)
+	return &ghostferry.ServerFeatures{Version: v}
+}
+
+func TestFeaturesTestSuite(t *testing.T) {
+	suite.Run(t, new(FeaturesTestSuite))
+}
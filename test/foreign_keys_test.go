@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type ForeignKeysTestSuite struct {
+	suite.Suite
+}
+
+func (this *ForeignKeysTestSuite) TestGroupsRelatedTables() {
+	groups := ghostferry.ForeignKeyGroups([]ghostferry.ForeignKey{
+		{Name: "fk_orders_users", Table: "shop.orders", ReferencedTable: "shop.users"},
+		{Name: "fk_line_items_orders", Table: "shop.line_items", ReferencedTable: "shop.orders"},
+		{Name: "fk_line_items_products", Table: "shop.line_items", ReferencedTable: "shop.products"},
+		{Name: "fk_posts_authors", Table: "blog.posts", ReferencedTable: "blog.authors"},
+	})
+
+	this.Require().Equal(map[string]string{
+		"shop.line_items": "shop.line_items",
+		"shop.orders":     "shop.line_items",
+		"shop.products":   "shop.line_items",
+		"shop.users":      "shop.line_items",
+		"blog.authors":    "blog.authors",
+		"blog.posts":      "blog.authors",
+	}, groups)
+}
+
+func (this *ForeignKeysTestSuite) TestSelfReferencingTable() {
+	groups := ghostferry.ForeignKeyGroups([]ghostferry.ForeignKey{
+		{Name: "fk_comments_parent", Table: "blog.comments", ReferencedTable: "blog.comments"},
+	})
+
+	this.Require().Equal(map[string]string{"blog.comments": "blog.comments"}, groups)
+}
+
+func (this *ForeignKeysTestSuite) TestNoForeignKeys() {
+	this.Require().Equal(0, len(ghostferry.ForeignKeyGroups(nil)))
+}
+
+func (this *ForeignKeysTestSuite) TestDependencies() {
+	dependencies := ghostferry.ForeignKeyDependencies([]ghostferry.ForeignKey{
+		{Name: "fk_orders_users", Table: "shop.orders", ReferencedTable: "shop.users"},
+		{Name: "fk_line_items_orders", Table: "shop.line_items", ReferencedTable: "shop.orders"},
+		{Name: "fk_line_items_refunded_orders", Table: "shop.line_items", ReferencedTable: "shop.orders"},
+		{Name: "fk_line_items_products", Table: "shop.line_items", ReferencedTable: "shop.products"},
+		{Name: "fk_comments_parent", Table: "blog.comments", ReferencedTable: "blog.comments"},
+	})
+
+	this.Require().Equal(map[string][]string{
+		"shop.orders":     {"shop.users"},
+		"shop.line_items": {"shop.orders", "shop.products"},
+	}, dependencies)
+}
+
+func TestForeignKeysTestSuite(t *testing.T) {
+	suite.Run(t, new(ForeignKeysTestSuite))
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumingAnInterruptedCopyOfATableWithoutAKeyDoesNotDuplicateRows(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.FullRowMatching = true
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T: t,
+		SetupAction: func(f *testhelpers.TestFerry) {
+			setupSingleTableDatabase(f)
+
+			_, err := f.SourceDB.Exec("CREATE TABLE gftest.keyless_table (id bigint(20), data varchar(255))")
+			testhelpers.PanicIfError(err)
+			_, err = f.TargetDB.Exec("CREATE TABLE gftest.keyless_table (id bigint(20), data varchar(255))")
+			testhelpers.PanicIfError(err)
+
+			for i := 1; i <= 10; i++ {
+				_, err = f.SourceDB.Exec("INSERT INTO gftest.keyless_table (id, data) VALUES (?, ?)", i, testhelpers.RandData())
+				testhelpers.PanicIfError(err)
+			}
+
+			// The rows written to the target by the copy interrupted before
+			// the table was marked as copied.
+			_, err = f.TargetDB.Exec("INSERT INTO gftest.keyless_table (id, data) VALUES (1, 'a'), (2, 'b')")
+			testhelpers.PanicIfError(err)
+
+			pos, err := ghostferry.ShowMasterStatusBinlogPosition(f.SourceDB)
+			testhelpers.PanicIfError(err)
+
+			f.StateToResumeFrom = &ghostferry.SerializableState{
+				GhostferryVersion:       ghostferry.VersionString,
+				LastSuccessfulBinlogPos: pos,
+			}
+		},
+		CustomVerifyAction: func(f *testhelpers.TestFerry) {
+			var count int
+			row := f.TargetDB.QueryRow("SELECT COUNT(*) FROM gftest.keyless_table")
+			testhelpers.PanicIfError(row.Scan(&count))
+			require.Equal(t, 10, count)
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type FullRowMatchingTestSuite struct {
+	suite.Suite
+
+	table *schema.Table
+	dir   string
+}
+
+func (this *FullRowMatchingTestSuite) SetupTest() {
+	this.table = &schema.Table{Schema: "gftest", Name: "keyless_table"}
+	this.table.AddColumn("id", "bigint(20)", "", "")
+	this.table.AddColumn("data", "varchar(255)", "", "")
+
+	var err error
+	this.dir, err = ioutil.TempDir("", "ghostferry-full-row-matching")
+	this.Require().Nil(err)
+}
+
+func (this *FullRowMatchingTestSuite) TearDownTest() {
+	os.RemoveAll(this.dir)
+}
+
+func (this *FullRowMatchingTestSuite) deleteEvent() ghostferry.DMLEvent {
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.DELETE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{
+				{int64(1), []byte("a")},
+			},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.table, ev, mysql.Position{})
+	this.Require().Nil(err)
+	return dmlEvents[0]
+}
+
+func (this *FullRowMatchingTestSuite) recordedStatement(sink *ghostferry.DeadLetterSink) string {
+	sink.File = filepath.Join(this.dir, "dead_letters.jsonl")
+	this.Require().Nil(sink.Initialize())
+	this.Require().Nil(sink.Record(this.deleteEvent(), "gftest", "keyless_table", errors.New("lock wait timeout")))
+	this.Require().Nil(sink.Close())
+
+	f, err := os.Open(sink.File)
+	this.Require().Nil(err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	this.Require().True(scanner.Scan())
+
+	var record ghostferry.DeadLetterRecord
+	this.Require().Nil(json.Unmarshal(scanner.Bytes(), &record))
+	return record.Statement
+}
+
+func (this *FullRowMatchingTestSuite) TestTablesWithoutPrimaryKeyAreMatchedByFullRows() {
+	this.Require().True(ghostferry.IsFullRowMatchTable(this.table))
+
+	this.table.PKColumns = []int{0}
+	this.Require().False(ghostferry.IsFullRowMatchTable(this.table))
+}
+
+func (this *FullRowMatchingTestSuite) TestEventsOfTablesWithoutPrimaryKeyHaveNoPK() {
+	_, err := this.deleteEvent().PK()
+	this.Require().EqualError(err, "table gftest.keyless_table has no primary key")
+}
+
+func (this *FullRowMatchingTestSuite) TestDeletesOneRowWithFullRowMatching() {
+	statement := this.recordedStatement(&ghostferry.DeadLetterSink{FullRowMatching: true})
+	this.Require().Equal("DELETE FROM `gftest`.`keyless_table` WHERE `id`=1 AND `data`=_binary'a' LIMIT 1", statement)
+}
+
+func (this *FullRowMatchingTestSuite) TestDoesNotLimitStatementsWithoutFullRowMatching() {
+	statement := this.recordedStatement(&ghostferry.DeadLetterSink{})
+	this.Require().Equal("DELETE FROM `gftest`.`keyless_table` WHERE `id`=1 AND `data`=_binary'a'", statement)
+}
+
+func TestFullRowMatchingTestSuite(t *testing.T) {
+	suite.Run(t, new(FullRowMatchingTestSuite))
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type GeneratedColumnsTestSuite struct {
+	suite.Suite
+
+	table *schema.Table
+}
+
+func (this *GeneratedColumnsTestSuite) SetupTest() {
+	this.table = &schema.Table{Schema: "gftest", Name: "table1"}
+	this.table.AddColumn("id", "bigint(20)", "", "auto_increment")
+	this.table.AddColumn("total", "int(11)", "", "VIRTUAL GENERATED")
+	this.table.AddColumn("data", "varchar(255)", "", "")
+	this.table.AddColumn("checksum", "int(11)", "", "STORED GENERATED")
+	this.table.PKColumns = []int{0}
+}
+
+func (this *GeneratedColumnsTestSuite) TestDetectsGeneratedColumns() {
+	this.Require().False(this.table.Columns[0].IsVirtual || this.table.Columns[0].IsStored)
+	this.Require().True(this.table.Columns[1].IsVirtual)
+	this.Require().True(this.table.Columns[3].IsStored)
+	this.Require().True(ghostferry.IsGeneratedColumn(&this.table.Columns[1]))
+	this.Require().True(ghostferry.HasGeneratedColumns(this.table))
+
+	// Columns with a default expression are not generated.
+	table := &schema.Table{Schema: "gftest", Name: "table2"}
+	table.AddColumn("created_at", "timestamp", "", "DEFAULT_GENERATED")
+	this.Require().False(ghostferry.HasGeneratedColumns(table))
+}
+
+func (this *GeneratedColumnsTestSuite) TestDeadLetterStatementOmitsGeneratedColumns() {
+	dir, err := ioutil.TempDir("", "ghostferry-generated-columns")
+	this.Require().Nil(err)
+	defer os.RemoveAll(dir)
+
+	sink := &ghostferry.DeadLetterSink{File: filepath.Join(dir, "dead_letters.jsonl")}
+	this.Require().Nil(sink.Initialize())
+
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.UPDATE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{
+				{int64(1), int64(2), []byte("a"), int64(3)},
+				{int64(1), int64(4), []byte("b"), int64(5)},
+			},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.table, ev, mysql.Position{})
+	this.Require().Nil(err)
+	this.Require().Nil(sink.Record(dmlEvents[0], "gftest", "table1", errors.New("lock wait timeout")))
+	this.Require().Nil(sink.Close())
+
+	f, err := os.Open(sink.File)
+	this.Require().Nil(err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	this.Require().True(scanner.Scan())
+
+	var record ghostferry.DeadLetterRecord
+	this.Require().Nil(json.Unmarshal(scanner.Bytes(), &record))
+	this.Require().Equal("UPDATE `gftest`.`table1` SET `id`=1,`data`=_binary'b' WHERE `id`=1 AND `data`=_binary'a'", record.Statement)
+
+	// The computed values are still recorded.
+	this.Require().Equal(float64(4), record.After["total"])
+}
+
+func TestGeneratedColumnsTestSuite(t *testing.T) {
+	suite.Run(t, new(GeneratedColumnsTestSuite))
+}
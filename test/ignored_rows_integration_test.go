@@ -0,0 +1,45 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountsRowsIgnoredByTheCopy(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.IgnoredRowsMode = ghostferry.IgnoredRowsCount
+
+	var conflicting int64
+	testcase := &testhelpers.IntegrationTestCase{
+		T: t,
+		SetupAction: func(f *testhelpers.TestFerry) {
+			setupSingleTableDatabase(f)
+
+			rows, err := f.SourceDB.Query("SELECT id, data FROM gftest.table1 ORDER BY id LIMIT 10")
+			testhelpers.PanicIfError(err)
+			defer rows.Close()
+
+			for rows.Next() {
+				var id int64
+				var data string
+				testhelpers.PanicIfError(rows.Scan(&id, &data))
+
+				_, err = f.TargetDB.Exec("INSERT INTO gftest.table1 (id, data) VALUES (?, ?)", id, data)
+				testhelpers.PanicIfError(err)
+				conflicting++
+			}
+			testhelpers.PanicIfError(rows.Err())
+		},
+		AfterRowCopyIsComplete: func(f *testhelpers.TestFerry) {
+			status := ghostferry.FetchStatus(f.Ferry, nil)
+			require.Equal(t, conflicting, status.CopyIgnoredRows)
+			require.Equal(t, int64(0), status.BinlogIgnoredRows)
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+}
@@ -0,0 +1,42 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type InvisiblePrimaryKeyTestSuite struct {
+	suite.Suite
+}
+
+func (this *InvisiblePrimaryKeyTestSuite) tableWithPK(pkColumn schema.TableColumn) *schema.Table {
+	return &schema.Table{
+		Schema:    "gftest",
+		Name:      "table1",
+		Columns:   []schema.TableColumn{pkColumn, {Name: "data"}},
+		PKColumns: []int{0},
+	}
+}
+
+func (this *InvisiblePrimaryKeyTestSuite) TestDetectsGeneratedInvisiblePrimaryKey() {
+	table := this.tableWithPK(schema.TableColumn{Name: "my_row_id", Type: schema.TYPE_NUMBER, IsAuto: true, IsUnsigned: true})
+	this.Require().True(ghostferry.HasGeneratedInvisiblePrimaryKey(table))
+}
+
+func (this *InvisiblePrimaryKeyTestSuite) TestIgnoresOtherPrimaryKeys() {
+	table := this.tableWithPK(schema.TableColumn{Name: "id", Type: schema.TYPE_NUMBER, IsAuto: true, IsUnsigned: true})
+	this.Require().False(ghostferry.HasGeneratedInvisiblePrimaryKey(table))
+
+	table = this.tableWithPK(schema.TableColumn{Name: "my_row_id", Type: schema.TYPE_NUMBER})
+	this.Require().False(ghostferry.HasGeneratedInvisiblePrimaryKey(table))
+
+	table.PKColumns = []int{}
+	this.Require().False(ghostferry.HasGeneratedInvisiblePrimaryKey(table))
+}
+
+func TestInvisiblePrimaryKeyTestSuite(t *testing.T) {
+	suite.Run(t, new(InvisiblePrimaryKeyTestSuite))
+}
@@ -82,6 +82,39 @@ func (t *IterativeVerifierTestSuite) TestVerifyOncePass() {
 	t.Require().Equal("", result.Message)
 }
 
+func (t *IterativeVerifierTestSuite) TestVerifyOnceNormalizesDifferentCollations() {
+	_, err := t.Ferry.SourceDB.Exec(fmt.Sprintf("ALTER TABLE %s.%s MODIFY data TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	t.Require().Nil(err)
+	_, err = t.Ferry.TargetDB.Exec(fmt.Sprintf("ALTER TABLE %s.%s MODIFY data TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_bin", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	t.Require().Nil(err)
+	t.reloadTables()
+
+	t.InsertRowInDb(42, "Foo ", t.Ferry.SourceDB)
+	t.InsertRowInDb(42, "foo", t.Ferry.TargetDB)
+
+	result, err := t.verifier.VerifyOnce()
+	t.Require().Nil(err)
+	t.Require().False(result.DataCorrect)
+
+	t.verifier.NormalizeCollations = true
+	result, err = t.verifier.VerifyOnce()
+	t.Require().Nil(err)
+	t.Require().True(result.DataCorrect)
+}
+
+func (t *IterativeVerifierTestSuite) TestVerifyOnceSkipsIgnoredColumns() {
+	t.InsertRowInDb(42, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(42, "bar", t.Ferry.TargetDB)
+
+	t.verifier.IgnoredColumns = map[string][]string{
+		fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name): {"data"},
+	}
+
+	result, err := t.verifier.VerifyOnce()
+	t.Require().Nil(err)
+	t.Require().True(result.DataCorrect)
+}
+
 func (t *IterativeVerifierTestSuite) TestBeforeCutoverFailuresFailAgainDuringCutover() {
 	t.InsertRowInDb(42, "foo", t.Ferry.SourceDB)
 	t.InsertRowInDb(42, "bar", t.Ferry.TargetDB)
@@ -119,6 +152,51 @@ func (t *IterativeVerifierTestSuite) TestBeforeCutoverFailuresPassDuringCutover(
 	t.Require().Equal("", result.Message)
 }
 
+func (t *IterativeVerifierTestSuite) TestResumedVerificationSkipsVerifiedRows() {
+	t.InsertRowInDb(42, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(42, "bar", t.Ferry.TargetDB)
+	t.InsertRowInDb(43, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(43, "bar", t.Ferry.TargetDB)
+
+	t.verifier.StateToResumeFrom = &ghostferry.IterativeVerifierState{
+		VerifiedPrimaryKeys: map[string]uint64{t.table.String(): 42},
+	}
+	err := t.verifier.Initialize()
+	t.Require().Nil(err)
+
+	err = t.verifier.VerifyBeforeCutover()
+	t.Require().Nil(err)
+
+	result, err := t.verifier.VerifyDuringCutover()
+	t.Require().Nil(err)
+	t.Require().False(result.DataCorrect)
+	t.Require().Equal("verification failed on table: gftest.test_table_1 for pks: 43", result.Message)
+}
+
+func (t *IterativeVerifierTestSuite) TestResumedVerificationReverifiesPendingRows() {
+	t.InsertRowInDb(42, "foo", t.Ferry.SourceDB)
+	t.InsertRowInDb(42, "bar", t.Ferry.TargetDB)
+
+	t.verifier.StateToResumeFrom = &ghostferry.IterativeVerifierState{
+		CompletedTables:     map[string]bool{t.table.String(): true},
+		ReverifyPrimaryKeys: map[string][]uint64{t.table.String(): []uint64{42}},
+	}
+	err := t.verifier.Initialize()
+	t.Require().Nil(err)
+
+	err = t.verifier.VerifyBeforeCutover()
+	t.Require().Nil(err)
+
+	state := t.verifier.SerializeState()
+	t.Require().Equal(map[string]bool{t.table.String(): true}, state.CompletedTables)
+	t.Require().Equal([]uint64{42}, state.ReverifyPrimaryKeys[t.table.String()])
+
+	result, err := t.verifier.VerifyDuringCutover()
+	t.Require().Nil(err)
+	t.Require().False(result.DataCorrect)
+	t.Require().Equal("verification failed on table: gftest.test_table_1 for pks: 42", result.Message)
+}
+
 func (t *IterativeVerifierTestSuite) TestChangingDataChangesHash() {
 	t.InsertRow(42, "foo")
 	old := t.GetHashes([]uint64{42})[0]
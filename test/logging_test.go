@@ -0,0 +1,95 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoggingTestSuite struct {
+	suite.Suite
+
+	output *bytes.Buffer
+}
+
+func (this *LoggingTestSuite) SetupTest() {
+	this.output = &bytes.Buffer{}
+	logrus.SetOutput(this.output)
+}
+
+func (this *LoggingTestSuite) TearDownTest() {
+	this.Require().Nil(ghostferry.ConfigureLogging(&ghostferry.Config{}))
+	logrus.SetFormatter(&logrus.TextFormatter{})
+	logrus.SetOutput(os.Stderr)
+}
+
+func (this *LoggingTestSuite) lastEntry() map[string]interface{} {
+	lines := bytes.Split(bytes.TrimSpace(this.output.Bytes()), []byte("\n"))
+
+	entry := map[string]interface{}{}
+	this.Require().Nil(json.Unmarshal(lines[len(lines)-1], &entry))
+	return entry
+}
+
+func (this *LoggingTestSuite) TestJSONEntriesHaveStructuredFields() {
+	err := ghostferry.ConfigureLogging(&ghostferry.Config{LogFormat: ghostferry.LogFormatJSON, FerryId: "ferry-1"})
+	this.Require().Nil(err)
+
+	logger := ghostferry.LogWithTable(logrus.WithField("tag", "test"), "gftest.table1")
+	logger = ghostferry.LogWithPkRange(logger, 100, 200)
+	logger = ghostferry.LogWithBinlogPosition(logger, mysql.Position{Name: "mysql-bin.000003", Pos: 4})
+	logger.Info("fetched batch")
+
+	entry := this.lastEntry()
+	this.Require().Equal("fetched batch", entry["msg"])
+	this.Require().Equal("ferry-1", entry[ghostferry.LogFieldFerryId])
+	this.Require().Equal("gftest.table1", entry[ghostferry.LogFieldTable])
+	this.Require().Equal(float64(100), entry[ghostferry.LogFieldPkStart])
+	this.Require().Equal(float64(200), entry[ghostferry.LogFieldPkEnd])
+	this.Require().Equal("mysql-bin.000003", entry[ghostferry.LogFieldBinlogFile])
+	this.Require().Equal(float64(4), entry[ghostferry.LogFieldBinlogPos])
+}
+
+func (this *LoggingTestSuite) TestFerryIdIsNotAddedWithoutId() {
+	err := ghostferry.ConfigureLogging(&ghostferry.Config{LogFormat: ghostferry.LogFormatJSON, FerryId: "ferry-1"})
+	this.Require().Nil(err)
+	err = ghostferry.ConfigureLogging(&ghostferry.Config{LogFormat: ghostferry.LogFormatJSON})
+	this.Require().Nil(err)
+
+	logrus.Info("no id")
+
+	entry := this.lastEntry()
+	this.Require().NotContains(entry, ghostferry.LogFieldFerryId)
+}
+
+func (this *LoggingTestSuite) TestFerryIdIsNotKeptByReusedEntries() {
+	err := ghostferry.ConfigureLogging(&ghostferry.Config{LogFormat: ghostferry.LogFormatJSON, FerryId: "ferry-1"})
+	this.Require().Nil(err)
+
+	logger := logrus.WithField("tag", "test")
+	logger.Info("first run")
+
+	err = ghostferry.ConfigureLogging(&ghostferry.Config{LogFormat: ghostferry.LogFormatJSON, FerryId: "ferry-2"})
+	this.Require().Nil(err)
+
+	logger.Info("second run")
+	this.Require().Equal("ferry-2", this.lastEntry()[ghostferry.LogFieldFerryId])
+
+	logrus.Info("second run")
+	this.Require().Equal("ferry-2", this.lastEntry()[ghostferry.LogFieldFerryId])
+}
+
+func (this *LoggingTestSuite) TestUnknownFormatIsRejected() {
+	err := ghostferry.ConfigureLogging(&ghostferry.Config{LogFormat: "xml"})
+	this.Require().EqualError(err, "unknown log format xml, must be text or json")
+}
+
+func TestLoggingTestSuite(t *testing.T) {
+	suite.Run(t, new(LoggingTestSuite))
+}
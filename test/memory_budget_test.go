@@ -0,0 +1,92 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type MemoryBudgetTestSuite struct {
+	suite.Suite
+
+	budget *ghostferry.MemoryBudget
+}
+
+func (this *MemoryBudgetTestSuite) SetupTest() {
+	this.budget = &ghostferry.MemoryBudget{Limit: 100}
+	this.budget.Initialize()
+}
+
+func (this *MemoryBudgetTestSuite) TestAccountsMemoryOfEveryComponent() {
+	this.budget.Add(ghostferry.MemoryCopy, 30)
+	this.budget.Add(ghostferry.MemoryBinlog, 20)
+	this.budget.Release(ghostferry.MemoryCopy, 10)
+	this.budget.AddSource(ghostferry.MemoryVerifier, func() int64 { return 5 })
+
+	this.Require().Equal(map[string]int64{
+		ghostferry.MemoryCopy:     20,
+		ghostferry.MemoryBinlog:   20,
+		ghostferry.MemoryVerifier: 5,
+	}, this.budget.Usage())
+	this.Require().Equal(int64(45), this.budget.Used())
+}
+
+func (this *MemoryBudgetTestSuite) TestWaitReturnsUnderLimit() {
+	this.budget.Add(ghostferry.MemoryCopy, 100)
+	this.assertWaitReturns(ghostferry.MemoryBinlog)
+}
+
+func (this *MemoryBudgetTestSuite) TestWaitReturnsWithoutRowsInFlight() {
+	this.budget.AddSource(ghostferry.MemoryVerifier, func() int64 { return 1000 })
+	this.assertWaitReturns(ghostferry.MemoryBinlog)
+}
+
+func (this *MemoryBudgetTestSuite) TestWaitReturnsWithoutLimit() {
+	this.budget.Limit = 0
+	this.budget.Add(ghostferry.MemoryCopy, 1000)
+	this.assertWaitReturns(ghostferry.MemoryBinlog)
+}
+
+func (this *MemoryBudgetTestSuite) TestWaitBlocksUntilMemoryIsReleased() {
+	this.budget.Add(ghostferry.MemoryCopy, 150)
+
+	done := make(chan struct{})
+	go func() {
+		this.budget.Wait(ghostferry.MemoryBinlog)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		this.Fail("Wait returned while the budget is exceeded")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	this.budget.Release(ghostferry.MemoryCopy, 100)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		this.Fail("Wait did not return after the memory was released")
+	}
+}
+
+func (this *MemoryBudgetTestSuite) assertWaitReturns(component string) {
+	done := make(chan struct{})
+	go func() {
+		this.budget.Wait(component)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		this.Fail("Wait blocked")
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	suite.Run(t, new(MemoryBudgetTestSuite))
+}
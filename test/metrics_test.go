@@ -184,6 +184,29 @@ func (this *MetricsTestSuite) TestDropMetricIfSinkFull() {
 	}
 }
 
+func (this *MetricsTestSuite) TestStatsDMetricsAreTagged() {
+	config := &ghostferry.Config{
+		Source:        ghostferry.DatabaseConfig{Host: "source.example"},
+		Target:        ghostferry.DatabaseConfig{Host: "target.example"},
+		StatsDAddress: "127.0.0.1:8125",
+		MetricTags:    map[string]string{"ferry": "ferry-1", "env": "test"},
+		FerryId:       "3c1d6f1e-8b4a-4c47-9f4e-2d0b6c7a5e91",
+	}
+
+	m, err := ghostferry.InitializeStatsDMetrics("test", config, []ghostferry.MetricTag{{Name: "SourceDB", Value: "db1"}})
+	this.Require().Nil(err)
+	defer ghostferry.StopAndFlushMetrics()
+
+	this.Require().Equal([]ghostferry.MetricTag{
+		{Name: "SourceDB", Value: "db1"},
+		{Name: "SourceHost", Value: "source.example"},
+		{Name: "TargetHost", Value: "target.example"},
+		{Name: "ferry_id", Value: "3c1d6f1e-8b4a-4c47-9f4e-2d0b6c7a5e91"},
+		{Name: "env", Value: "test"},
+		{Name: "ferry", Value: "ferry-1"},
+	}, m.DefaultTags)
+}
+
 func TestMetricsTestSuite(t *testing.T) {
 	suite.Run(t, new(MetricsTestSuite))
 }
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+)
+
+type NotifierTestSuite struct {
+	suite.Suite
+
+	server        *httptest.Server
+	mutex         sync.Mutex
+	notifications []ghostferry.Notification
+	signatures    []string
+	statusCodes   []int
+}
+
+func (this *NotifierTestSuite) SetupTest() {
+	this.notifications = nil
+	this.signatures = nil
+	this.statusCodes = nil
+
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+
+		body, err := ioutil.ReadAll(r.Body)
+		this.Assert().Nil(err)
+
+		var notification ghostferry.Notification
+		this.Assert().Nil(json.Unmarshal(body, &notification))
+		this.Assert().Equal(notification.Event, r.Header.Get("X-Ghostferry-Event"))
+
+		this.notifications = append(this.notifications, notification)
+		this.signatures = append(this.signatures, r.Header.Get(ghostferry.WebhookSignatureHeader))
+		if r.Header.Get(ghostferry.WebhookSignatureHeader) != "" {
+			this.Assert().Equal("sha256="+ghostferry.SignWebhookBody("secret", body), r.Header.Get(ghostferry.WebhookSignatureHeader))
+		}
+
+		if len(this.statusCodes) > 0 {
+			w.WriteHeader(this.statusCodes[0])
+			this.statusCodes = this.statusCodes[1:]
+		}
+	}))
+}
+
+func (this *NotifierTestSuite) TearDownTest() {
+	this.server.Close()
+}
+
+func (this *NotifierTestSuite) newNotifier(webhook *ghostferry.WebhookConfig) *ghostferry.Notifier {
+	if webhook.RetryPolicy == nil {
+		webhook.RetryPolicy = &ghostferry.RetryPolicy{MaxAttempts: 3, InitialDelay: "1ms"}
+	}
+	this.Require().Nil(webhook.Validate())
+
+	notifier := &ghostferry.Notifier{
+		Webhooks: []*ghostferry.WebhookConfig{webhook},
+		State:    func() string { return ghostferry.StateCopying },
+	}
+	notifier.Initialize()
+	return notifier
+}
+
+func (this *NotifierTestSuite) TestPostsSignedNotifications() {
+	notifier := this.newNotifier(&ghostferry.WebhookConfig{URL: this.server.URL, Secret: "secret"})
+	notifier.Notify(ghostferry.NotificationCopyStarted, "")
+	notifier.Wait()
+	notifier.Notify(ghostferry.NotificationFatalError, "binlog_writer: failed")
+	notifier.Wait()
+
+	this.Require().Equal(2, len(this.notifications))
+	this.Require().Equal(ghostferry.NotificationCopyStarted, this.notifications[0].Event)
+	this.Require().Equal(ghostferry.StateCopying, this.notifications[0].OverallState)
+	this.Require().Equal(int64(1), this.notifications[0].Sequence)
+	this.Require().Equal(ghostferry.NotificationFatalError, this.notifications[1].Event)
+	this.Require().Equal("binlog_writer: failed", this.notifications[1].Message)
+	this.Require().Equal(int64(2), this.notifications[1].Sequence)
+	this.Require().NotEqual("", this.signatures[0])
+}
+
+func (this *NotifierTestSuite) TestOnlyPostsSelectedEvents() {
+	notifier := this.newNotifier(&ghostferry.WebhookConfig{
+		URL:    this.server.URL,
+		Events: []string{ghostferry.NotificationVerificationFailed},
+	})
+	notifier.Notify(ghostferry.NotificationCopyStarted, "")
+	notifier.Notify(ghostferry.NotificationVerificationFailed, "mismatched rows")
+	notifier.Wait()
+
+	this.Require().Equal(1, len(this.notifications))
+	this.Require().Equal(ghostferry.NotificationVerificationFailed, this.notifications[0].Event)
+	this.Require().Equal("", this.signatures[0])
+}
+
+func (this *NotifierTestSuite) TestPostsTableEventsOnlyWhenSelected() {
+	stats := ghostferry.TableStats{Table: "gftest.table1", Rows: 42}
+
+	notifier := this.newNotifier(&ghostferry.WebhookConfig{URL: this.server.URL})
+	notifier.NotifyTable(ghostferry.NotificationTableCopied, stats)
+	notifier.Wait()
+	this.Require().Equal(0, len(this.notifications))
+
+	notifier = this.newNotifier(&ghostferry.WebhookConfig{
+		URL:    this.server.URL,
+		Events: []string{ghostferry.NotificationTableCopied},
+	})
+	notifier.NotifyTable(ghostferry.NotificationTableCopied, stats)
+	notifier.Notify(ghostferry.NotificationDone, "")
+	notifier.Wait()
+
+	this.Require().Equal(1, len(this.notifications))
+	this.Require().Equal(ghostferry.NotificationTableCopied, this.notifications[0].Event)
+	this.Require().Equal("gftest.table1", this.notifications[0].Table.Table)
+	this.Require().Equal(int64(42), this.notifications[0].Table.Rows)
+}
+
+func (this *NotifierTestSuite) TestRetriesServerErrors() {
+	this.statusCodes = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	notifier := this.newNotifier(&ghostferry.WebhookConfig{URL: this.server.URL})
+	notifier.Notify(ghostferry.NotificationDone, "")
+	notifier.Wait()
+
+	this.Require().Equal(3, len(this.notifications))
+}
+
+func (this *NotifierTestSuite) TestDoesNotRetryClientErrors() {
+	this.statusCodes = []int{http.StatusBadRequest}
+	notifier := this.newNotifier(&ghostferry.WebhookConfig{URL: this.server.URL})
+	notifier.Notify(ghostferry.NotificationDone, "")
+	notifier.Wait()
+
+	this.Require().Equal(1, len(this.notifications))
+}
+
+func (this *NotifierTestSuite) TestValidate() {
+	this.Require().EqualError((&ghostferry.WebhookConfig{URL: "ftp://example.com"}).Validate(), "URL must be an http or https URL, got ftp://example.com")
+	this.Require().EqualError((&ghostferry.WebhookConfig{URL: "https://example.com", Events: []string{"started"}}).Validate(), "invalid event started")
+	this.Require().Contains((&ghostferry.WebhookConfig{URL: "https://example.com", Timeout: "soon"}).Validate().Error(), "invalid Timeout")
+}
+
+func TestNotifierTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, new(NotifierTestSuite))
+}
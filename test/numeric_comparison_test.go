@@ -0,0 +1,92 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type NumericComparisonTestSuite struct {
+	suite.Suite
+
+	table *schema.Table
+}
+
+func (this *NumericComparisonTestSuite) SetupTest() {
+	this.table = &schema.Table{Schema: "gftest", Name: "numeric_table"}
+	this.table.AddColumn("id", "bigint(20)", "", "")
+	this.table.AddColumn("ratio", "double", "", "")
+	this.table.AddColumn("price", "decimal(10,3)", "", "")
+	this.table.PKColumns = []int{0}
+}
+
+func (this *NumericComparisonTestSuite) TestComparesFloatsWithinEpsilon() {
+	config := &ghostferry.NumericComparisonConfig{FloatEpsilon: 0.0001}
+	this.Require().Nil(config.Validate())
+
+	this.assertMatch(config, 1, float32(0.1), float64(0.1))
+	this.assertMatch(config, 1, float64(1.00005), float64(1))
+	this.assertMismatch(config, 1, float64(1.001), float64(1))
+}
+
+func (this *NumericComparisonTestSuite) TestNormalizesDecimalTrailingZeros() {
+	config := &ghostferry.NumericComparisonConfig{NormalizeDecimals: true}
+	this.Require().Nil(config.Validate())
+
+	this.assertMatch(config, 2, []byte("1.50"), []byte("1.500"))
+	this.assertMatch(config, 2, []byte("-0.0"), []byte("0"))
+	this.assertMismatch(config, 2, []byte("1.501"), []byte("1.500"))
+}
+
+func (this *NumericComparisonTestSuite) TestComparesDecimalsWithinEpsilon() {
+	config := &ghostferry.NumericComparisonConfig{DecimalEpsilon: "0.01"}
+	this.Require().Nil(config.Validate())
+
+	this.assertMatch(config, 2, []byte("10.005"), []byte("10.01"))
+	this.assertMatch(config, 2, []byte("10.00"), float64(10.01))
+	this.assertMismatch(config, 2, []byte("10.00"), []byte("10.02"))
+}
+
+func (this *NumericComparisonTestSuite) TestComparesNulls() {
+	config := &ghostferry.NumericComparisonConfig{NormalizeDecimals: true}
+
+	this.assertMatch(config, 2, nil, nil)
+	this.assertMismatch(config, 2, nil, []byte("0"))
+	this.assertMismatch(config, 2, []byte("0"), nil)
+}
+
+func (this *NumericComparisonTestSuite) TestErrorsOnNonNumericValues() {
+	config := &ghostferry.NumericComparisonConfig{NormalizeDecimals: true}
+
+	_, err := config.ValuesMatch(this.table.Columns[2], []byte("abc"), []byte("1"))
+	this.Require().EqualError(err, "unexpected numeric value [97 98 99] of type []uint8")
+}
+
+func (this *NumericComparisonTestSuite) TestValidate() {
+	config := &ghostferry.NumericComparisonConfig{FloatEpsilon: -1}
+	this.Require().EqualError(config.Validate(), "FloatEpsilon cannot be negative")
+
+	config = &ghostferry.NumericComparisonConfig{DecimalEpsilon: "abc"}
+	this.Require().EqualError(config.Validate(), `invalid DecimalEpsilon "abc"`)
+
+	config = &ghostferry.NumericComparisonConfig{DecimalEpsilon: "-0.1"}
+	this.Require().EqualError(config.Validate(), "DecimalEpsilon cannot be negative")
+}
+
+func (this *NumericComparisonTestSuite) assertMatch(config *ghostferry.NumericComparisonConfig, column int, source, target interface{}) {
+	match, err := config.ValuesMatch(this.table.Columns[column], source, target)
+	this.Require().Nil(err)
+	this.Require().True(match, "%v should match %v", source, target)
+}
+
+func (this *NumericComparisonTestSuite) assertMismatch(config *ghostferry.NumericComparisonConfig, column int, source, target interface{}) {
+	match, err := config.ValuesMatch(this.table.Columns[column], source, target)
+	this.Require().Nil(err)
+	this.Require().False(match, "%v should not match %v", source, target)
+}
+
+func TestNumericComparisonTestSuite(t *testing.T) {
+	suite.Run(t, new(NumericComparisonTestSuite))
+}
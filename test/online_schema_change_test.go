@@ -0,0 +1,104 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type OnlineSchemaChangeTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+}
+
+func (this *OnlineSchemaChangeTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedSourceDB(0)
+}
+
+func (this *OnlineSchemaChangeTestSuite) createTable(name string) {
+	_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf("CREATE TABLE `%s`.`%s` (id bigint(20) not null auto_increment, primary key(id))", testhelpers.TestSchemaName, name))
+	this.Require().Nil(err)
+}
+
+func (this *OnlineSchemaChangeTestSuite) detect() ([]ghostferry.OnlineSchemaChange, []string) {
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	changes, shadowTables, err := ghostferry.DetectOnlineSchemaChanges(this.Ferry.SourceDB, tables.AsSlice())
+	this.Require().Nil(err)
+
+	names := []string{}
+	for _, table := range shadowTables {
+		names = append(names, table.Name)
+	}
+
+	return changes, names
+}
+
+func (this *OnlineSchemaChangeTestSuite) TestNoOnlineSchemaChange() {
+	changes, shadowTables := this.detect()
+	this.Require().Equal(0, len(changes))
+	this.Require().Equal(0, len(shadowTables))
+}
+
+func (this *OnlineSchemaChangeTestSuite) TestDetectsGhostMigration() {
+	this.createTable("_" + testhelpers.TestTable1Name + "_gho")
+	this.createTable("_" + testhelpers.TestTable1Name + "_ghc")
+
+	changes, shadowTables := this.detect()
+	this.Require().ElementsMatch([]string{"_" + testhelpers.TestTable1Name + "_gho", "_" + testhelpers.TestTable1Name + "_ghc"}, shadowTables)
+	this.Require().Equal(2, len(changes))
+	this.Require().Equal(ghostferry.OnlineSchemaChangeToolGhost, changes[0].Tool)
+	this.Require().Equal(fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name), changes[0].Table)
+}
+
+func (this *OnlineSchemaChangeTestSuite) TestDetectsPtOscTriggers() {
+	this.createTable("_" + testhelpers.TestTable1Name + "_new")
+	_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf(
+		"CREATE TRIGGER `%s`.`pt_osc_%s_%s_ins` AFTER INSERT ON `%s`.`%s` FOR EACH ROW BEGIN END",
+		testhelpers.TestSchemaName, testhelpers.TestSchemaName, testhelpers.TestTable1Name,
+		testhelpers.TestSchemaName, testhelpers.TestTable1Name,
+	))
+	this.Require().Nil(err)
+
+	changes, shadowTables := this.detect()
+	this.Require().Equal([]string{"_" + testhelpers.TestTable1Name + "_new"}, shadowTables)
+	this.Require().Equal(2, len(changes))
+	for _, change := range changes {
+		this.Require().Equal(ghostferry.OnlineSchemaChangeToolPtOsc, change.Tool)
+	}
+}
+
+func (this *OnlineSchemaChangeTestSuite) TestLeftoverTablesAreExcludedOnly() {
+	this.createTable("_" + testhelpers.TestTable1Name + "_20180101120000_del")
+	this.createTable("lhma_2018_01_01_12_00_00_000_" + testhelpers.TestTable1Name)
+
+	changes, shadowTables := this.detect()
+	this.Require().Equal(0, len(changes))
+	this.Require().Equal(2, len(shadowTables))
+}
+
+func (this *OnlineSchemaChangeTestSuite) TestTablesWithoutOriginalAreNotShadowTables() {
+	this.createTable("_missing_gho")
+	this.createTable("lhmn_missing")
+
+	changes, shadowTables := this.detect()
+	this.Require().Equal(0, len(changes))
+	this.Require().Equal(0, len(shadowTables))
+}
+
+func (this *OnlineSchemaChangeTestSuite) TestErrorListsMigrations() {
+	err := ghostferry.OnlineSchemaChangeError{Changes: []ghostferry.OnlineSchemaChange{
+		{Tool: ghostferry.OnlineSchemaChangeToolLHM, Table: "gftest.users", Object: "lhmn_users"},
+	}}
+
+	this.Require().EqualError(err, "online schema changes are running on ferried tables, which would be renamed during the run: lhm on gftest.users (lhmn_users)")
+}
+
+func TestOnlineSchemaChangeTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &OnlineSchemaChangeTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
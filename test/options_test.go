@@ -0,0 +1,110 @@
+package test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FerryOptionsTestSuite struct {
+	suite.Suite
+}
+
+func (this *FerryOptionsTestSuite) TestRequiresConfig() {
+	_, err := ghostferry.NewFerry(nil)
+	this.Require().EqualError(err, "config must not be nil")
+}
+
+func (this *FerryOptionsTestSuite) TestAppliesOptions() {
+	config := &ghostferry.Config{}
+	errorHandler := &ghostferry.PanicErrorHandler{}
+	throttler := &ghostferry.PauserThrottler{}
+	state := &ghostferry.SerializableState{}
+
+	ferry, err := ghostferry.NewFerry(config,
+		ghostferry.WithErrorHandler(errorHandler),
+		ghostferry.WithThrottler(throttler),
+		ghostferry.WithStateToResumeFrom(state),
+	)
+	this.Require().Nil(err)
+
+	this.Require().Equal(config, ferry.Config)
+	this.Require().Equal(errorHandler, ferry.ErrorHandler)
+	this.Require().Equal(throttler, ferry.Throttler)
+	this.Require().Equal(state, ferry.Config.StateToResumeFrom)
+}
+
+func (this *FerryOptionsTestSuite) TestReturnsOptionErrors() {
+	failing := func(f *ghostferry.Ferry) error {
+		return errors.New("bad option")
+	}
+
+	_, err := ghostferry.NewFerry(&ghostferry.Config{}, failing)
+	this.Require().EqualError(err, "bad option")
+}
+
+func TestFerryOptionsTestSuite(t *testing.T) {
+	suite.Run(t, new(FerryOptionsTestSuite))
+}
+
+func TestHooksAreCalledDuringRun(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+
+	mutex := &sync.Mutex{}
+	var copiedTables []string
+	var writtenRows int
+	var states []string
+	var copiedStats []ghostferry.TableStats
+
+	options := []ghostferry.FerryOption{
+		ghostferry.OnTableCopied(func(table *schema.Table) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			copiedTables = append(copiedTables, table.String())
+		}),
+		ghostferry.OnBatchWritten(func(batch *ghostferry.RowBatch) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			writtenRows += batch.Size()
+		}),
+		ghostferry.OnTableCompleted(func(event string, stats ghostferry.TableStats) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if event == ghostferry.NotificationTableCopied {
+				copiedStats = append(copiedStats, stats)
+			}
+		}),
+		ghostferry.OnStateChange(func(from, to string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			states = append(states, to)
+		}),
+	}
+
+	for _, option := range options {
+		assert.Nil(t, option(ferry.Ferry))
+	}
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T:           t,
+		SetupAction: setupSingleTableDatabase,
+		Ferry:       ferry,
+	}
+
+	testcase.Run()
+
+	assert.Equal(t, []string{"gftest.table1"}, copiedTables)
+	assert.Equal(t, 1, len(copiedStats))
+	assert.Equal(t, "gftest.table1", copiedStats[0].Table)
+	assert.Equal(t, int64(writtenRows), copiedStats[0].Rows)
+	assert.False(t, copiedStats[0].EndTime.Before(copiedStats[0].StartTime))
+	assert.True(t, writtenRows > 0 && writtenRows <= 1111)
+	assert.Equal(t, ghostferry.StateStarting, states[0])
+	assert.Equal(t, ghostferry.StateDone, states[len(states)-1])
+}
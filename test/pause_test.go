@@ -0,0 +1,107 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type ComponentPauserTestSuite struct {
+	suite.Suite
+
+	pauser *ghostferry.ComponentPauser
+}
+
+func (this *ComponentPauserTestSuite) SetupTest() {
+	this.pauser = ghostferry.NewComponentPauser()
+}
+
+func (this *ComponentPauserTestSuite) TestPausesComponentsIndependently() {
+	this.Require().Nil(this.pauser.SetPaused(ghostferry.PauseVerifier, true))
+	this.Require().Nil(this.pauser.SetPaused(ghostferry.PauseCopy, true))
+
+	this.Require().True(this.pauser.Paused(ghostferry.PauseCopy))
+	this.Require().False(this.pauser.Paused(ghostferry.PauseBinlog))
+	this.Require().Equal([]string{ghostferry.PauseCopy, ghostferry.PauseVerifier}, this.pauser.PausedComponents())
+
+	this.Require().Nil(this.pauser.SetPaused(ghostferry.PauseCopy, false))
+	this.Require().Equal([]string{ghostferry.PauseVerifier}, this.pauser.PausedComponents())
+}
+
+func (this *ComponentPauserTestSuite) TestRejectsUnknownComponents() {
+	err := this.pauser.SetPaused("throttler", true)
+	this.Require().EqualError(err, "invalid component throttler, must be copy, binlog or verifier")
+}
+
+func (this *ComponentPauserTestSuite) TestWaitBlocksUntilResumed() {
+	this.Require().Nil(this.pauser.SetPaused(ghostferry.PauseBinlog, true))
+
+	done := make(chan struct{})
+	go func() {
+		this.pauser.Wait(ghostferry.PauseBinlog)
+		close(done)
+	}()
+
+	// The other components are not paused.
+	this.pauser.Wait(ghostferry.PauseCopy)
+
+	select {
+	case <-done:
+		this.Fail("Wait returned while the component was paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	this.Require().Nil(this.pauser.SetPaused(ghostferry.PauseBinlog, false))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		this.Fail("Wait did not return once the component was resumed")
+	}
+}
+
+func (this *ComponentPauserTestSuite) TestPausesComponentsThroughTheControlServer() {
+	server := &ghostferry.ControlServer{
+		F:       &ghostferry.Ferry{Pauser: this.pauser},
+		Addr:    "127.0.0.1:0",
+		Basedir: "..",
+	}
+	this.Require().Nil(server.Initialize())
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, httptest.NewRequest("POST", "/api/actions/pause?component=copy", nil))
+	this.Require().Equal(http.StatusSeeOther, response.Code)
+	this.Require().True(this.pauser.Paused(ghostferry.PauseCopy))
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, httptest.NewRequest("POST", "/api/actions/unpause?component=copy", nil))
+	this.Require().Equal(http.StatusSeeOther, response.Code)
+	this.Require().False(this.pauser.Paused(ghostferry.PauseCopy))
+
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, httptest.NewRequest("POST", "/api/actions/pause?component=unknown", nil))
+	this.Require().Equal(http.StatusBadRequest, response.Code)
+}
+
+func (this *ComponentPauserTestSuite) TestPausedComponentsAreKeptInTheState() {
+	state := &ghostferry.SerializableState{
+		LastSuccessfulBinlogPos: mysql.Position{Name: "mysql-bin.000001", Pos: 4},
+		PausedComponents:        []string{ghostferry.PauseCopy},
+	}
+
+	dump, err := state.Dump()
+	this.Require().Nil(err)
+
+	parsed, err := ghostferry.ParseStateDump(dump)
+	this.Require().Nil(err)
+	this.Require().Equal([]string{ghostferry.PauseCopy}, parsed.PausedComponents)
+}
+
+func TestComponentPauserTestSuite(t *testing.T) {
+	suite.Run(t, new(ComponentPauserTestSuite))
+}
@@ -0,0 +1,191 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type PrimaryKeyRemappingTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	config   *ghostferry.PrimaryKeyRemappingConfig
+	table    *schema.Table
+	children *schema.Table
+}
+
+func (this *PrimaryKeyRemappingTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedTargetDB(5)
+
+	this.config = &ghostferry.PrimaryKeyRemappingConfig{
+		Tables: []string{"gftest.test_table_1"},
+		ForeignKeys: map[string]map[string]string{
+			"gftest.children": {"parent_id": "gftest.test_table_1"},
+		},
+		MappingDatabase: testhelpers.TestSchemaName,
+	}
+
+	this.table = &schema.Table{
+		Schema:    testhelpers.TestSchemaName,
+		Name:      testhelpers.TestTable1Name,
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "data"}},
+		PKColumns: []int{0},
+	}
+
+	this.children = &schema.Table{
+		Schema:    testhelpers.TestSchemaName,
+		Name:      "children",
+		Columns:   []schema.TableColumn{{Name: "id"}, {Name: "parent_id"}},
+		PKColumns: []int{0},
+	}
+}
+
+func (this *PrimaryKeyRemappingTestSuite) newRemapper() *ghostferry.PrimaryKeyRemapper {
+	remapper := &ghostferry.PrimaryKeyRemapper{
+		DB:     this.Ferry.TargetDB,
+		Config: this.config,
+	}
+	this.Require().Nil(remapper.Initialize())
+	return remapper
+}
+
+func (this *PrimaryKeyRemappingTestSuite) TestAssignsPrimaryKeysAfterTheTargetRows() {
+	remapper := this.newRemapper()
+
+	batch := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{
+		{int64(1), "a"},
+		{int64(2), "b"},
+	}, 0)
+
+	remapped, err := remapper.RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(6), remapped.Values()[0][0])
+	this.Require().Equal(uint64(7), remapped.Values()[1][0])
+	this.Require().Equal("a", remapped.Values()[0][1])
+
+	// The original batch is left unchanged.
+	this.Require().Equal(int64(1), batch.Values()[0][0])
+
+	remapped, err = remapper.RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(6), remapped.Values()[0][0])
+	this.Require().Equal(uint64(7), remapped.Values()[1][0])
+}
+
+func (this *PrimaryKeyRemappingTestSuite) TestReservesTheAssignedPrimaryKeysOnTheTarget() {
+	this.config.ReservedPrimaryKeys = 10
+	remapper := this.newRemapper()
+
+	batch := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{{int64(1), "a"}}, 0)
+	remapped, err := remapper.RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(6), remapped.Values()[0][0])
+
+	// A row inserted by an application of the target.
+	result, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (data) VALUES ('live')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+	liveId, err := result.LastInsertId()
+	this.Require().Nil(err)
+	this.Require().Equal(int64(16), liveId)
+
+	batch = ghostferry.NewRowBatch(this.table, []ghostferry.RowData{{int64(2), "b"}}, 0)
+	remapped, err = remapper.RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(7), remapped.Values()[0][0])
+}
+
+func (this *PrimaryKeyRemappingTestSuite) TestAssignsPrimaryKeysAfterLargeUnsignedPrimaryKeys() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("ALTER TABLE `%s`.`%s` MODIFY id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+	_, err = this.Ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data) VALUES (9223372036854775810, 'large')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	batch := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{{int64(1), "a"}}, 0)
+	remapped, err := this.newRemapper().RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(9223372036854775811), remapped.Values()[0][0])
+}
+
+func (this *PrimaryKeyRemappingTestSuite) TestRewritesForeignKeys() {
+	remapper := this.newRemapper()
+
+	batch := ghostferry.NewRowBatch(this.children, []ghostferry.RowData{
+		{int64(1), int64(2)},
+		{int64(2), nil},
+	}, 0)
+
+	remapped, err := remapper.RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(int64(1), remapped.Values()[0][0])
+	this.Require().Equal(uint64(6), remapped.Values()[0][1])
+	this.Require().Nil(remapped.Values()[1][1])
+
+	parents := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{{int64(2), "b"}}, 0)
+	remapped, err = remapper.RemapRowBatch(parents)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(6), remapped.Values()[0][0])
+}
+
+func (this *PrimaryKeyRemappingTestSuite) TestRemapsBinlogEvents() {
+	remapper := this.newRemapper()
+
+	ev := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.UPDATE_ROWS_EVENTv2},
+		Event: &replication.RowsEvent{
+			Rows: [][]interface{}{
+				{int64(3), int64(1)},
+				{int64(3), int64(4)},
+			},
+		},
+	}
+
+	dmlEvents, err := ghostferry.NewBinlogDMLEvents(this.children, ev, mysql.Position{})
+	this.Require().Nil(err)
+
+	remapped, err := remapper.RemapDMLEvent(dmlEvents[0])
+	this.Require().Nil(err)
+	this.Require().IsType(&ghostferry.BinlogUpdateEvent{}, remapped)
+	this.Require().Equal(uint64(6), remapped.OldValues()[1])
+	this.Require().Equal(uint64(7), remapped.NewValues()[1])
+	this.Require().Equal(int64(3), remapped.NewValues()[0])
+}
+
+func (this *PrimaryKeyRemappingTestSuite) TestReusesRecordedMappings() {
+	batch := ghostferry.NewRowBatch(this.table, []ghostferry.RowData{{int64(1), "a"}}, 0)
+
+	_, err := this.newRemapper().RemapRowBatch(batch)
+	this.Require().Nil(err)
+
+	remapper := this.newRemapper()
+	remapped, err := remapper.RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(6), remapped.Values()[0][0])
+
+	batch = ghostferry.NewRowBatch(this.table, []ghostferry.RowData{{int64(2), "b"}}, 0)
+	remapped, err = remapper.RemapRowBatch(batch)
+	this.Require().Nil(err)
+	this.Require().Equal(uint64(7), remapped.Values()[0][0])
+}
+
+func (this *PrimaryKeyRemappingTestSuite) TestValidate() {
+	config := &ghostferry.PrimaryKeyRemappingConfig{MappingDatabase: "gftest"}
+	this.Require().EqualError(config.Validate(), "Tables must not be empty")
+
+	config = &ghostferry.PrimaryKeyRemappingConfig{Tables: []string{"gftest.table1"}}
+	this.Require().EqualError(config.Validate(), "MappingDatabase must be set")
+
+	this.config.Tables = []string{"gftest.other"}
+	this.Require().EqualError(this.config.Validate(), "column parent_id of gftest.children references gftest.test_table_1, which is not remapped")
+}
+
+func TestPrimaryKeyRemappingTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &PrimaryKeyRemappingTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
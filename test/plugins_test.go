@@ -0,0 +1,139 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type fakeStateStore struct {
+	Options map[string]string
+	Saved   []*ghostferry.SerializableState
+}
+
+func (s *fakeStateStore) SaveState(state *ghostferry.SerializableState) error {
+	s.Saved = append(s.Saved, state)
+	return nil
+}
+
+func init() {
+	ghostferry.RegisterPlugin(ghostferry.PluginKindStateStore, "test_store", func(f *ghostferry.Ferry, options json.RawMessage) (interface{}, error) {
+		store := &fakeStateStore{}
+		if len(options) > 0 {
+			err := json.Unmarshal(options, &store.Options)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return store, nil
+	})
+
+	ghostferry.RegisterPlugin(ghostferry.PluginKindThrottler, "test_not_a_throttler", func(f *ghostferry.Ferry, options json.RawMessage) (interface{}, error) {
+		return &fakeStateStore{}, nil
+	})
+
+	ghostferry.RegisterPlugin(ghostferry.PluginKindVerifier, "test_failing", func(f *ghostferry.Ferry, options json.RawMessage) (interface{}, error) {
+		return nil, errors.New("no verifier today")
+	})
+}
+
+type PluginsTestSuite struct {
+	suite.Suite
+
+	ferry *ghostferry.Ferry
+}
+
+func (this *PluginsTestSuite) SetupTest() {
+	this.ferry = &ghostferry.Ferry{
+		Config: &ghostferry.Config{},
+	}
+}
+
+func (this *PluginsTestSuite) TestCreatesSelectedPluginWithOptions() {
+	this.ferry.Config.Plugins = map[string]*ghostferry.PluginConfig{
+		ghostferry.PluginKindStateStore: {
+			Name:    "test_store",
+			Options: json.RawMessage(`{"bucket": "states"}`),
+		},
+	}
+
+	plugin, err := this.ferry.NewPlugin(ghostferry.PluginKindStateStore)
+	this.Require().Nil(err)
+	this.Require().Equal(map[string]string{"bucket": "states"}, plugin.(*fakeStateStore).Options)
+}
+
+func (this *PluginsTestSuite) TestNoPluginSelected() {
+	plugin, err := this.ferry.NewPlugin(ghostferry.PluginKindThrottler)
+	this.Require().Nil(err)
+	this.Require().Nil(plugin)
+}
+
+func (this *PluginsTestSuite) TestPluginMustImplementInterfaceOfKind() {
+	this.ferry.Config.Plugins = map[string]*ghostferry.PluginConfig{
+		ghostferry.PluginKindThrottler: {Name: "test_not_a_throttler"},
+	}
+
+	_, err := this.ferry.NewPlugin(ghostferry.PluginKindThrottler)
+	this.Require().EqualError(err, "throttler plugin test_not_a_throttler returned a *test.fakeStateStore, which does not implement ghostferry.Throttler")
+}
+
+func (this *PluginsTestSuite) TestFactoryErrorIsReturned() {
+	this.ferry.Config.Plugins = map[string]*ghostferry.PluginConfig{
+		ghostferry.PluginKindVerifier: {Name: "test_failing"},
+	}
+
+	_, err := this.ferry.NewPlugin(ghostferry.PluginKindVerifier)
+	this.Require().EqualError(err, "failed to create verifier plugin test_failing: no verifier today")
+}
+
+func (this *PluginsTestSuite) TestUnregisteredPlugin() {
+	this.ferry.Config.Plugins = map[string]*ghostferry.PluginConfig{
+		ghostferry.PluginKindVerifier: {Name: "missing"},
+	}
+
+	_, err := this.ferry.NewPlugin(ghostferry.PluginKindVerifier)
+	this.Require().EqualError(err, "verifier plugin missing is not registered")
+}
+
+func (this *PluginsTestSuite) TestRegisteredPluginsAreListed() {
+	this.Require().Contains(ghostferry.RegisteredPlugins(ghostferry.PluginKindStateStore), "test_store")
+}
+
+func (this *PluginsTestSuite) TestRegisteringTwiceOrUnknownKindPanics() {
+	factory := func(f *ghostferry.Ferry, options json.RawMessage) (interface{}, error) {
+		return nil, nil
+	}
+
+	this.Require().Panics(func() {
+		ghostferry.RegisterPlugin(ghostferry.PluginKindStateStore, "test_store", factory)
+	})
+
+	this.Require().Panics(func() {
+		ghostferry.RegisterPlugin("data_iterator", "test_iterator", factory)
+	})
+}
+
+func (this *PluginsTestSuite) TestCheckpointerUsesStore() {
+	store := &fakeStateStore{}
+	checkpointer := &ghostferry.Checkpointer{
+		Ferry: &ghostferry.Ferry{
+			BinlogStreamer: &ghostferry.BinlogStreamer{},
+			BinlogWriter:   &ghostferry.BinlogWriter{},
+			DataIterator:   &ghostferry.DataIterator{Concurrency: 1},
+		},
+		Store: store,
+	}
+	this.Require().Nil(checkpointer.Ferry.BinlogWriter.Initialize())
+	this.Require().Nil(checkpointer.Ferry.DataIterator.Initialize())
+	this.Require().Nil(checkpointer.Initialize())
+
+	this.Require().Nil(checkpointer.Checkpoint())
+	this.Require().Equal(1, len(store.Saved))
+}
+
+func TestPluginsTestSuite(t *testing.T) {
+	suite.Run(t, new(PluginsTestSuite))
+}
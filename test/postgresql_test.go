@@ -0,0 +1,136 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type PostgreSQLDialectTestSuite struct {
+	suite.Suite
+
+	dialect     ghostferry.PostgreSQLDialect
+	sourceTable *schema.Table
+	targetTable *schema.Table
+}
+
+func (this *PostgreSQLDialectTestSuite) SetupTest() {
+	this.sourceTable = &schema.Table{Schema: "test_schema", Name: "test_table"}
+	this.sourceTable.AddColumn("id", "bigint(20) unsigned", "", "auto_increment")
+	this.sourceTable.AddColumn("name", "varchar(255)", "", "")
+	this.sourceTable.AddColumn("size", "enum('small','large')", "", "")
+	this.sourceTable.AddColumn("data", "blob", "", "")
+	this.sourceTable.AddColumn("created_at", "datetime(6)", "", "")
+	this.sourceTable.PKColumns = []int{0}
+
+	this.targetTable = &schema.Table{Schema: "target_schema", Name: "target_table"}
+}
+
+func (this *PostgreSQLDialectTestSuite) TestRowBatchQueryUsesNumberedPlaceholders() {
+	batch := ghostferry.NewRowBatch(this.sourceTable, []ghostferry.RowData{
+		{int64(1), []byte("it's"), []byte("small"), []byte{0xde, 0xad}, []byte("2020-01-01 00:00:00")},
+		{int64(2), nil, []byte("large"), nil, []byte("0000-00-00 00:00:00")},
+	}, 0)
+
+	query, args, err := this.dialect.RowBatchQuery(batch, this.targetTable)
+	this.Require().Nil(err)
+	this.Require().Equal(`INSERT INTO "target_schema"."target_table" ("id","name","size","data","created_at") VALUES ($1,$2,$3,$4,$5),($6,$7,$8,$9,$10) ON CONFLICT DO NOTHING`, query)
+	this.Require().Equal([]interface{}{
+		int64(1), "it's", "small", []byte{0xde, 0xad}, "2020-01-01 00:00:00",
+		int64(2), nil, "large", nil, nil,
+	}, args)
+}
+
+func (this *PostgreSQLDialectTestSuite) TestInsertEventIgnoresConflicts() {
+	events, err := ghostferry.NewBinlogInsertEvents(this.sourceTable, &replication.RowsEvent{
+		Rows: [][]interface{}{{uint64(1), "it's", int64(2), []byte{0xde, 0xad}, "2020-01-01 00:00:00"}},
+	})
+	this.Require().Nil(err)
+
+	statement, err := this.dialect.DMLEventStatement(events[0], this.targetTable)
+	this.Require().Nil(err)
+	this.Require().Equal(`INSERT INTO "target_schema"."target_table" ("id","name","size","data","created_at") VALUES (1,'it''s','large','\xdead'::bytea,'2020-01-01 00:00:00') ON CONFLICT DO NOTHING`, statement)
+}
+
+func (this *PostgreSQLDialectTestSuite) TestUpdateEventMatchesOldRow() {
+	events, err := ghostferry.NewBinlogUpdateEvents(this.sourceTable, &replication.RowsEvent{
+		Rows: [][]interface{}{
+			{uint64(1), nil, int64(1), nil, "0000-00-00 00:00:00"},
+			{uint64(1), "new", int64(2), nil, "2020-01-01 00:00:00"},
+		},
+	})
+	this.Require().Nil(err)
+
+	statement, err := this.dialect.DMLEventStatement(events[0], this.targetTable)
+	this.Require().Nil(err)
+	this.Require().Equal(`UPDATE "target_schema"."target_table" SET "id"=1,"name"='new',"size"='large',"data"=NULL,"created_at"='2020-01-01 00:00:00' WHERE "id"=1 AND "name" IS NULL AND "size"='small' AND "data" IS NULL AND "created_at" IS NULL`, statement)
+}
+
+func (this *PostgreSQLDialectTestSuite) TestDeleteEventMatchesOldRow() {
+	events, err := ghostferry.NewBinlogDeleteEvents(this.sourceTable, &replication.RowsEvent{
+		Rows: [][]interface{}{{uint64(1), "a", int64(1), nil, "2020-01-01 00:00:00"}},
+	})
+	this.Require().Nil(err)
+
+	statement, err := this.dialect.DMLEventStatement(events[0], this.targetTable)
+	this.Require().Nil(err)
+	this.Require().Equal(`DELETE FROM "target_schema"."target_table" WHERE "id"=1 AND "name"='a' AND "size"='small' AND "data" IS NULL AND "created_at"='2020-01-01 00:00:00'`, statement)
+}
+
+func (this *PostgreSQLDialectTestSuite) TestCreateTableStatementMapsTypes() {
+	this.sourceTable.AddColumn("amount", "decimal(10,2)", "", "")
+	this.sourceTable.AddColumn("flags", "set('a','b')", "", "")
+	this.sourceTable.AddColumn("doc", "json", "", "")
+	this.sourceTable.AddColumn(`odd"name`, "int(11) unsigned", "", "")
+
+	statement := this.dialect.CreateTableStatement(this.sourceTable, this.targetTable)
+	this.Require().Equal(`CREATE TABLE IF NOT EXISTS "target_schema"."target_table" ("id" numeric(20,0), "name" varchar(255), "size" text, "data" bytea, "created_at" timestamp(6), "amount" numeric(10,2), "flags" text, "doc" jsonb, "odd""name" bigint, PRIMARY KEY ("id"))`, statement)
+}
+
+func (this *PostgreSQLDialectTestSuite) TestConnectionString() {
+	config := ghostferry.DatabaseConfig{
+		Host:   "example.com",
+		Port:   5432,
+		User:   "ghostferry",
+		Pass:   `it's`,
+		Params: map[string]string{"dbname": "target", "sslmode": "disable"},
+	}
+
+	this.Require().Equal(`dbname='target' host='example.com' password='it\'s' port='5432' sslmode='disable' user='ghostferry'`, config.PostgreSQLConnectionString())
+}
+
+func (this *PostgreSQLDialectTestSuite) TestConnectionStringVerifiesServerName() {
+	config := ghostferry.DatabaseConfig{
+		Host:   "10.0.0.1",
+		Port:   5432,
+		User:   "ghostferry",
+		TLS:    &ghostferry.TLSConfig{CertPath: "/etc/ssl/ca.pem", ServerName: "db.example.com"},
+		Params: map[string]string{"dbname": "target"},
+	}
+
+	this.Require().Equal(`dbname='target' host='db.example.com' password='' port='5432' sslmode='verify-full' sslrootcert='/etc/ssl/ca.pem' user='ghostferry'`, config.PostgreSQLConnectionString())
+
+	db, err := config.PostgreSQLDB(nil)
+	this.Require().Nil(err)
+	this.Require().Nil(db.Close())
+}
+
+func (this *PostgreSQLDialectTestSuite) TestNewSQLDialect() {
+	dialect, err := ghostferry.NewSQLDialect("")
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.DialectMySQL, dialect.Name())
+
+	dialect, err = ghostferry.NewSQLDialect(ghostferry.DialectPostgreSQL)
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.DialectPostgreSQL, dialect.Name())
+
+	_, err = ghostferry.NewSQLDialect("oracle")
+	this.Require().EqualError(err, "unknown SQL dialect oracle, must be mysql, postgresql or vitess")
+}
+
+func TestPostgreSQLDialectTestSuite(t *testing.T) {
+	suite.Run(t, new(PostgreSQLDialectTestSuite))
+}
@@ -0,0 +1,170 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type PreflightTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	preflight *ghostferry.Preflight
+}
+
+func (this *PreflightTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedSourceDB(0)
+	this.SeedTargetDB(0)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	this.preflight = &ghostferry.Preflight{
+		SourceDB: this.Ferry.SourceDB,
+		TargetDB: this.Ferry.TargetDB,
+		Tables:   tables,
+	}
+}
+
+func (this *PreflightTestSuite) TestPreflightPassesWithIdenticalSchemas() {
+	report := this.preflight.Run()
+	this.Require().Nil(report.Err())
+}
+
+func (this *PreflightTestSuite) TestPreflightReportsAllSchemaDifferences() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("ALTER TABLE `%s`.`%s` MODIFY data VARCHAR(255), ADD extra INT", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	report := this.preflight.Run()
+	this.Require().Equal(2, len(report.Problems))
+	this.Require().Equal("schema", report.Problems[0].Check)
+	this.Require().Contains(report.Problems[0].Message, "source has 2 columns but target has 3 columns")
+	this.Require().Contains(report.Problems[1].Message, "column data is text on source but varchar(255) on target")
+}
+
+func (this *PreflightTestSuite) TestPreflightWarnsAboutDifferentCollations() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("ALTER TABLE `%s`.`%s` MODIFY data TEXT CHARACTER SET utf8mb4 COLLATE utf8mb4_bin", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	report := this.preflight.Run()
+	this.Require().Nil(report.Err())
+	this.Require().Equal(1, len(report.Warnings))
+	this.Require().Equal("collation", report.Warnings[0].Check)
+	this.Require().Contains(report.Warnings[0].Message, "utf8mb4_bin on target")
+}
+
+func (this *PreflightTestSuite) TestPreflightReportsMissingTargetTable() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("DROP TABLE `%s`.`%s`", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	report := this.preflight.Run()
+	this.Require().NotNil(report.Err())
+	this.Require().Contains(report.Err().Error(), "failed to load target table")
+
+	this.preflight.SkipSchemaComparison = true
+	this.Require().Nil(this.preflight.Run().Err())
+}
+
+func (this *PreflightTestSuite) TestPreflightWarnsAboutStorageEngines() {
+	_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf("ALTER TABLE `%s`.`%s` ENGINE=MyISAM", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	_, err = this.Ferry.SourceDB.Exec(fmt.Sprintf("CREATE TABLE `%s`.`sessions` (id bigint(20) not null auto_increment, primary key(id)) ENGINE=MEMORY", testhelpers.TestSchemaName))
+	this.Require().Nil(err)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	skipped, err := tables.RemoveStorageEngines(this.Ferry.SourceDB, ghostferry.DefaultIgnoredStorageEngines)
+	this.Require().Nil(err)
+	this.Require().Equal(map[string]string{testhelpers.TestSchemaName + ".sessions": "MEMORY"}, skipped)
+	this.Require().Nil(tables.Get(testhelpers.TestSchemaName, "sessions"))
+
+	this.preflight.Tables = tables
+	this.preflight.SkippedEngineTables = skipped
+	this.preflight.SkipSchemaComparison = true
+
+	report := this.preflight.Run()
+	this.Require().Nil(report.Err())
+	this.Require().Equal(2, len(report.Warnings))
+	this.Require().Equal("storage_engine", report.Warnings[0].Check)
+	this.Require().Contains(report.Warnings[0].Message, "sessions uses the MEMORY storage engine and is not ferried")
+	this.Require().Contains(report.Warnings[1].Message, "uses the MYISAM storage engine rather than InnoDB")
+}
+
+func (this *PreflightTestSuite) TestPreflightRequiresEmptyTarget() {
+	this.preflight.RequireEmptyTarget = true
+	this.Require().Nil(this.preflight.Run().Err())
+
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data) VALUES (1, 'unexpected')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	report := this.preflight.Run()
+	this.Require().Equal(1, len(report.Problems))
+	this.Require().Equal("target_rows", report.Problems[0].Check)
+	this.Require().Contains(report.Problems[0].Message, "is not empty, its rows were not written by the ferry")
+
+	this.preflight.SkipSchemaComparison = true
+	this.Require().Nil(this.preflight.Run().Err())
+}
+
+func TestPreflightTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &PreflightTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
+
+type GrantedPrivilegesTestSuite struct {
+	suite.Suite
+}
+
+func (this *GrantedPrivilegesTestSuite) TestParsesGlobalAndDatabaseGrants() {
+	grants := ghostferry.ParseGrants([]string{
+		"GRANT SELECT, REPLICATION SLAVE ON *.* TO `ghostferry`@`%`",
+		"GRANT ALL PRIVILEGES ON `gftest`.* TO `ghostferry`@`%`",
+		"GRANT INSERT ON `other`.`table1` TO `ghostferry`@`%`",
+	})
+
+	this.Require().True(grants.Has("REPLICATION SLAVE", ""))
+	this.Require().True(grants.Has("SELECT", "other"))
+	this.Require().True(grants.Has("DELETE", "gftest"))
+	this.Require().False(grants.Has("DELETE", ""))
+	this.Require().False(grants.Has("INSERT", "other"))
+	this.Require().Empty(grants.Roles)
+}
+
+func (this *GrantedPrivilegesTestSuite) TestMatchesDatabasePatterns() {
+	grants := ghostferry.ParseGrants([]string{
+		"GRANT SELECT ON `shop\\_%`.* TO `ghostferry`@`%`",
+		"GRANT INSERT ON `app_`.* TO `ghostferry`@`%`",
+	})
+
+	this.Require().True(grants.Has("SELECT", "shop_1"))
+	this.Require().True(grants.Has("SELECT", "shop_"))
+	this.Require().False(grants.Has("SELECT", "shopx1"))
+	this.Require().False(grants.Has("SELECT", "other"))
+	this.Require().False(grants.Has("SELECT", ""))
+
+	// An unescaped underscore matches any character.
+	this.Require().True(grants.Has("INSERT", "app_"))
+	this.Require().True(grants.Has("INSERT", "app1"))
+	this.Require().False(grants.Has("INSERT", "app12"))
+}
+
+func (this *GrantedPrivilegesTestSuite) TestParsesRoles() {
+	grants := ghostferry.ParseGrants([]string{
+		"GRANT USAGE ON *.* TO `ghostferry`@`%`",
+		"GRANT `reader`@`%`,`writer`@`%` TO `ghostferry`@`%`",
+		"GRANT `admin` TO `ghostferry`@`%` WITH ADMIN OPTION",
+	})
+
+	this.Require().Equal([]string{"`reader`@`%`", "`writer`@`%`", "`admin`"}, grants.Roles)
+	this.Require().False(grants.Has("SELECT", "gftest"))
+}
+
+func TestGrantedPrivilegesTestSuite(t *testing.T) {
+	suite.Run(t, new(GrantedPrivilegesTestSuite))
+}
@@ -0,0 +1,34 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProgressTestSuite struct {
+	suite.Suite
+}
+
+func (this *ProgressTestSuite) TestSummaryIsASingleLine() {
+	summary := ghostferry.ProgressSummary{
+		CompletedTables:  3,
+		TotalTables:      10,
+		RowsCopied:       12345,
+		RowsPerSecond:    1234.56,
+		ReplicationLag:   1234 * time.Millisecond,
+		ETA:              5 * time.Minute,
+		ThrottledPercent: 12.5,
+	}
+
+	this.Require().Equal(
+		"tables 3/10, rows copied 12345 (1234.6 rows/s), replication lag 1.2s, ETA 5m0s, throttled 12%",
+		summary.String(),
+	)
+}
+
+func TestProgressTestSuite(t *testing.T) {
+	suite.Run(t, new(ProgressTestSuite))
+}
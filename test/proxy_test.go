@@ -0,0 +1,237 @@
+package test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+// A minimal SOCKS5 server, which only supports CONNECT to domain names.
+type socks5Server struct {
+	listener net.Listener
+	user     string
+	pass     string
+
+	mutex     sync.Mutex
+	requested []string
+}
+
+func newSOCKS5Server(user, pass string) (*socks5Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &socks5Server{listener: listener, user: user, pass: pass}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server, nil
+}
+
+func (s *socks5Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	method := byte(0)
+	if s.user != "" {
+		method = 2
+	}
+	conn.Write([]byte{5, method})
+
+	if method == 2 {
+		version := make([]byte, 2)
+		io.ReadFull(conn, version)
+		user := make([]byte, version[1])
+		io.ReadFull(conn, user)
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		pass := make([]byte, length[0])
+		io.ReadFull(conn, pass)
+
+		if string(user) != s.user || string(pass) != s.pass {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	request := make([]byte, 5)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	host := make([]byte, request[4])
+	io.ReadFull(conn, host)
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+
+	address := net.JoinHostPort(string(host), strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	s.mutex.Lock()
+	s.requested = append(s.requested, address)
+	s.mutex.Unlock()
+
+	remote, err := net.Dial("tcp", address)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer remote.Close()
+
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	go io.Copy(remote, conn)
+	io.Copy(conn, remote)
+}
+
+type ProxyTestSuite struct {
+	suite.Suite
+
+	echo net.Listener
+}
+
+func (this *ProxyTestSuite) SetupTest() {
+	var err error
+	this.echo, err = net.Listen("tcp", "127.0.0.1:0")
+	this.Require().Nil(err)
+
+	go func() {
+		for {
+			conn, err := this.echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+}
+
+func (this *ProxyTestSuite) TearDownTest() {
+	this.echo.Close()
+}
+
+// The echo server, by a name resolved by the proxy.
+func (this *ProxyTestSuite) echoAddress() string {
+	_, port, err := net.SplitHostPort(this.echo.Addr().String())
+	this.Require().Nil(err)
+	return net.JoinHostPort("localhost", port)
+}
+
+func (this *ProxyTestSuite) assertEchoes(conn net.Conn) {
+	defer conn.Close()
+
+	_, err := conn.Write([]byte("ghostferry"))
+	this.Require().Nil(err)
+
+	echoed := make([]byte, len("ghostferry"))
+	_, err = io.ReadFull(conn, echoed)
+	this.Require().Nil(err)
+	this.Require().Equal("ghostferry", string(echoed))
+}
+
+func (this *ProxyTestSuite) TestDialsThroughSOCKS5() {
+	server, err := newSOCKS5Server("", "")
+	this.Require().Nil(err)
+	defer server.listener.Close()
+
+	proxy := &ghostferry.ProxyConfig{Type: ghostferry.ProxyTypeSOCKS5, Address: server.listener.Addr().String()}
+	this.Require().Nil(proxy.Validate())
+
+	conn, err := proxy.Dial(this.echoAddress())
+	this.Require().Nil(err)
+	this.assertEchoes(conn)
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	this.Require().Equal([]string{this.echoAddress()}, server.requested)
+}
+
+func (this *ProxyTestSuite) TestDialsThroughSOCKS5WithPassword() {
+	server, err := newSOCKS5Server("ghostferry", "secret")
+	this.Require().Nil(err)
+	defer server.listener.Close()
+
+	proxy := &ghostferry.ProxyConfig{
+		Type:    ghostferry.ProxyTypeSOCKS5,
+		Address: server.listener.Addr().String(),
+		User:    "ghostferry",
+		Pass:    "secret",
+	}
+
+	conn, err := proxy.Dial(this.echoAddress())
+	this.Require().Nil(err)
+	this.assertEchoes(conn)
+
+	proxy.Pass = "wrong"
+	_, err = proxy.Dial(this.echoAddress())
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "authentication failed")
+}
+
+func (this *ProxyTestSuite) TestSOCKS5ConnectionRefused() {
+	server, err := newSOCKS5Server("", "")
+	this.Require().Nil(err)
+	defer server.listener.Close()
+
+	address := this.echoAddress()
+	this.echo.Close()
+
+	proxy := &ghostferry.ProxyConfig{Type: ghostferry.ProxyTypeSOCKS5, Address: server.listener.Addr().String()}
+	_, err = proxy.Dial(address)
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "connection refused with reply code 5")
+}
+
+func (this *ProxyTestSuite) TestValidate() {
+	proxy := &ghostferry.ProxyConfig{Type: "http", Address: "bastion:22"}
+	this.Require().EqualError(proxy.Validate(), "invalid Type http, must be ssh or socks5")
+
+	proxy = &ghostferry.ProxyConfig{Type: ghostferry.ProxyTypeSOCKS5}
+	this.Require().EqualError(proxy.Validate(), "Address is required")
+
+	proxy = &ghostferry.ProxyConfig{Type: ghostferry.ProxyTypeSSH, Address: "bastion:22"}
+	this.Require().EqualError(proxy.Validate(), "User is required for ssh")
+
+	proxy.User = "ghostferry"
+	proxy.PrivateKeyPath = "/home/ghostferry/.ssh/id_ed25519"
+	this.Require().EqualError(proxy.Validate(), "KnownHostsPath is required for ssh, unless InsecureIgnoreHostKey")
+
+	proxy.KnownHostsPath = "/home/ghostferry/.ssh/known_hosts"
+	this.Require().Nil(proxy.Validate())
+}
+
+func (this *ProxyTestSuite) TestDatabaseConfigValidatesProxy() {
+	config := ghostferry.DatabaseConfig{
+		Host:  "example.com",
+		Port:  3306,
+		User:  "ghostferry",
+		Proxy: &ghostferry.ProxyConfig{Type: ghostferry.ProxyTypeSOCKS5},
+	}
+
+	this.Require().EqualError(config.Validate(), "Proxy: Address is required")
+}
+
+func TestProxyTestSuite(t *testing.T) {
+	suite.Run(t, new(ProxyTestSuite))
+}
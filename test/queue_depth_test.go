@@ -0,0 +1,58 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type QueueDepthMonitorTestSuite struct {
+	suite.Suite
+
+	monitor *ghostferry.QueueDepthMonitor
+}
+
+func (this *QueueDepthMonitorTestSuite) SetupTest() {
+	this.monitor = &ghostferry.QueueDepthMonitor{
+		Thresholds: map[string]int64{
+			ghostferry.QueueReverify:     100,
+			ghostferry.QueueBinlogBuffer: 10,
+		},
+	}
+	this.monitor.Initialize()
+}
+
+func (this *QueueDepthMonitorTestSuite) TestReportsDepthOfEveryQueue() {
+	this.monitor.AddQueue(ghostferry.QueueReverify, func() int64 { return 42 })
+	this.monitor.AddQueue("other", func() int64 { return 7 })
+
+	this.Require().Equal(map[string]int64{ghostferry.QueueReverify: 42, "other": 7}, this.monitor.Depths())
+}
+
+func (this *QueueDepthMonitorTestSuite) TestQueuesDeeperThanThresholdAreProblems() {
+	this.monitor.AddQueue(ghostferry.QueueReverify, func() int64 { return 101 })
+	this.monitor.AddQueue(ghostferry.QueueBinlogBuffer, func() int64 { return 10 })
+	this.monitor.AddQueue("other", func() int64 { return 1000 })
+
+	this.Require().Equal([]string{"reverify queue depth 101 exceeds 100"}, this.monitor.Problems())
+}
+
+func (this *QueueDepthMonitorTestSuite) TestHealthReportsQueueDepths() {
+	this.monitor.AddQueue(ghostferry.QueueBinlogBuffer, func() int64 { return 11 })
+
+	ferry := &ghostferry.Ferry{
+		Config:            &ghostferry.Config{},
+		OverallState:      ghostferry.StateStarting,
+		QueueDepthMonitor: this.monitor,
+	}
+
+	health := ferry.Health()
+	this.Require().False(health.Healthy)
+	this.Require().Equal(map[string]int64{ghostferry.QueueBinlogBuffer: 11}, health.QueueDepths)
+	this.Require().Equal([]string{"binlog_buffer queue depth 11 exceeds 10"}, health.Problems)
+}
+
+func TestQueueDepthMonitorTestSuite(t *testing.T) {
+	suite.Run(t, new(QueueDepthMonitorTestSuite))
+}
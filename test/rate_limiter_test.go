@@ -0,0 +1,62 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type RateLimiterTestSuite struct {
+	suite.Suite
+}
+
+func (this *RateLimiterTestSuite) TestLimitsCanBeChanged() {
+	limiter := ghostferry.NewRateLimiter(100, 1000)
+
+	rows, bytes := limiter.Limits()
+	this.Require().Equal(int64(100), rows)
+	this.Require().Equal(int64(1000), bytes)
+
+	limiter.SetLimits(0, 50)
+
+	rows, bytes = limiter.Limits()
+	this.Require().Equal(int64(0), rows)
+	this.Require().Equal(int64(50), bytes)
+}
+
+func (this *RateLimiterTestSuite) TestUnlimitedDoesNotWait() {
+	limiter := ghostferry.NewRateLimiter(0, 0)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		limiter.Wait(1000000, 1000000)
+	}
+
+	this.Require().True(time.Since(start) < 100*time.Millisecond)
+}
+
+func (this *RateLimiterTestSuite) TestWaitsForRowsToBePaidBack() {
+	limiter := ghostferry.NewRateLimiter(100, 0)
+
+	start := time.Now()
+	limiter.Wait(20, 1000000)
+	this.Require().True(time.Since(start) < 50*time.Millisecond)
+
+	limiter.Wait(1, 0)
+	this.Require().True(time.Since(start) >= 150*time.Millisecond)
+}
+
+func (this *RateLimiterTestSuite) TestWaitsForBytesToBePaidBack() {
+	limiter := ghostferry.NewRateLimiter(0, 1000)
+
+	start := time.Now()
+	limiter.Wait(1000000, 200)
+	limiter.Wait(1000000, 1)
+	this.Require().True(time.Since(start) >= 150*time.Millisecond)
+}
+
+func TestRateLimiterTestSuite(t *testing.T) {
+	suite.Run(t, new(RateLimiterTestSuite))
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	sqlmysql "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+)
+
+type RetryPolicyTestSuite struct {
+	suite.Suite
+}
+
+func (this *RetryPolicyTestSuite) TestDelays() {
+	policy := &ghostferry.RetryPolicy{InitialDelay: "1s", MaxDelay: "5s"}
+	this.Require().Nil(policy.Validate())
+	this.Require().Equal(ghostferry.RetryBackoffConstant, policy.Backoff)
+	this.Require().Equal(time.Second, policy.DelayAfter(1))
+	this.Require().Equal(time.Second, policy.DelayAfter(4))
+
+	policy.Backoff = ghostferry.RetryBackoffLinear
+	this.Require().Equal(time.Second, policy.DelayAfter(1))
+	this.Require().Equal(3*time.Second, policy.DelayAfter(3))
+	this.Require().Equal(5*time.Second, policy.DelayAfter(10))
+
+	policy.Backoff = ghostferry.RetryBackoffExponential
+	this.Require().Equal(time.Second, policy.DelayAfter(1))
+	this.Require().Equal(4*time.Second, policy.DelayAfter(3))
+	this.Require().Equal(5*time.Second, policy.DelayAfter(100))
+}
+
+func (this *RetryPolicyTestSuite) TestValidate() {
+	this.Require().EqualError((&ghostferry.RetryPolicy{Backoff: "random"}).Validate(), "invalid Backoff random, must be constant, linear or exponential")
+	this.Require().EqualError((&ghostferry.RetryPolicy{MaxAttempts: -1}).Validate(), "MaxAttempts must not be negative")
+	this.Require().Contains((&ghostferry.RetryPolicy{InitialDelay: "soon"}).Validate().Error(), "invalid InitialDelay")
+	this.Require().EqualError((&ghostferry.RetryPolicy{Jitter: -0.5}).Validate(), "Jitter must be between 0 and 1, got -0.5")
+}
+
+func (this *RetryPolicyTestSuite) TestRespectsMaxAttempts() {
+	policy := &ghostferry.RetryPolicy{MaxAttempts: 3, InitialDelay: "1ms", Jitter: 0.5}
+	this.Require().Nil(policy.Validate())
+
+	called := 0
+	err := policy.Do(context.Background(), nil, "test", func() error {
+		called++
+		return fmt.Errorf("test error")
+	})
+
+	this.Require().EqualError(err, "test error")
+	this.Require().Equal(3, called)
+}
+
+func (this *RetryPolicyTestSuite) TestSucceedsAfterRetries() {
+	policy := &ghostferry.RetryPolicy{}
+	this.Require().Nil(policy.Validate())
+
+	called := 0
+	err := policy.Do(context.Background(), nil, "test", func() error {
+		called++
+		if called < 10 {
+			return fmt.Errorf("test error")
+		}
+		return nil
+	})
+
+	this.Require().Nil(err)
+	this.Require().Equal(10, called)
+}
+
+func (this *RetryPolicyTestSuite) TestDoesNotRetryNonRetryableErrors() {
+	policy := &ghostferry.RetryPolicy{MaxAttempts: 5, NonRetryableErrorCodes: []uint16{1146}}
+	this.Require().Nil(policy.Validate())
+
+	called := 0
+	err := policy.Do(context.Background(), nil, "test", func() error {
+		called++
+		return &sqlmysql.MySQLError{Number: 1146, Message: "Table 'gftest.missing' doesn't exist"}
+	})
+
+	this.Require().NotNil(err)
+	this.Require().Equal(1, called)
+
+	this.Require().True(policy.Retryable(&sqlmysql.MySQLError{Number: 1205}))
+	this.Require().False(policy.Retryable(context.Canceled))
+
+	policy.IsRetryable = func(err error) bool { return false }
+	this.Require().False(policy.Retryable(&sqlmysql.MySQLError{Number: 1205}))
+}
+
+func (this *RetryPolicyTestSuite) TestStopsWaitingWhenContextIsDone() {
+	policy := &ghostferry.RetryPolicy{InitialDelay: "1h"}
+	this.Require().Nil(policy.Validate())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	called := 0
+	err := policy.Do(ctx, nil, "test", func() error {
+		called++
+		cancel()
+		return fmt.Errorf("test error")
+	})
+
+	this.Require().Equal(context.Canceled, err)
+	this.Require().Equal(1, called)
+}
+
+func TestRetryPolicyTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, new(RetryPolicyTestSuite))
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type RowCountVerifierTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	verifier *ghostferry.RowCountVerifier
+}
+
+func (this *RowCountVerifierTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedSourceDB(5)
+	this.SeedTargetDB(5)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	this.verifier = &ghostferry.RowCountVerifier{
+		Tables:   tables.AsSlice(),
+		SourceDB: this.Ferry.SourceDB,
+		TargetDB: this.Ferry.TargetDB,
+	}
+}
+
+func (this *RowCountVerifierTestSuite) TestMatchingCounts() {
+	result, err := this.verifier.Verify()
+	this.Require().Nil(err)
+	this.Require().True(result.DataCorrect)
+	this.Require().Equal("", result.Message)
+}
+
+func (this *RowCountVerifierTestSuite) TestReportsMismatchedTablesAndTotals() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("DELETE FROM `%s`.`%s` WHERE id = 1", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	result, err := this.verifier.Verify()
+	this.Require().Nil(err)
+	this.Require().False(result.DataCorrect)
+	this.Require().Contains(result.Message, "5 rows in total on the source and 4 on the target")
+	this.Require().Contains(result.Message, fmt.Sprintf("table `%s`.`%s`", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+}
+
+func (this *RowCountVerifierTestSuite) TestOnlyCountsCopiedRange() {
+	_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data) VALUES (100, 'new')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	this.verifier.MaxPrimaryKeys = map[string]uint64{
+		fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name): 5,
+	}
+
+	result, err := this.verifier.Verify()
+	this.Require().Nil(err)
+	this.Require().True(result.DataCorrect)
+}
+
+func (this *RowCountVerifierTestSuite) TestRunsInBackground() {
+	err := this.verifier.StartInBackground()
+	this.Require().Nil(err)
+	this.verifier.Wait()
+
+	result, err := this.verifier.Result()
+	this.Require().Nil(err)
+	this.Require().True(result.IsDone())
+	this.Require().True(result.DataCorrect)
+}
+
+func TestRowCountVerifierTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &RowCountVerifierTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type SamplingTestSuite struct {
+	suite.Suite
+}
+
+func (this *SamplingTestSuite) TestSamplesPercentageOfRanges() {
+	rnd := rand.New(rand.NewSource(1))
+	ranges := ghostferry.SamplePrimaryKeyRanges(1, 100000, 1000, 10, rnd)
+
+	this.Require().Equal(10, len(ranges))
+	for i, pkRange := range ranges {
+		this.Require().Equal(uint64(999), pkRange.End-pkRange.Start)
+		this.Require().Equal(uint64(1), pkRange.Start%1000)
+		if i > 0 {
+			this.Require().True(ranges[i-1].End < pkRange.Start)
+		}
+	}
+}
+
+func (this *SamplingTestSuite) TestSamplesAtLeastOneRange() {
+	rnd := rand.New(rand.NewSource(1))
+	ranges := ghostferry.SamplePrimaryKeyRanges(5, 10, 1000, 0.001, rnd)
+
+	this.Require().Equal([]ghostferry.PrimaryKeyRange{{Start: 5, End: 1004}}, ranges)
+}
+
+func (this *SamplingTestSuite) TestSamplesAllRanges() {
+	rnd := rand.New(rand.NewSource(1))
+	ranges := ghostferry.SamplePrimaryKeyRanges(0, 2999, 1000, 100, rnd)
+
+	this.Require().Equal([]ghostferry.PrimaryKeyRange{
+		{Start: 0, End: 999},
+		{Start: 1000, End: 1999},
+		{Start: 2000, End: 2999},
+	}, ranges)
+}
+
+func (this *SamplingTestSuite) TestMismatchRateBounds() {
+	stats := ghostferry.SampleTableStats{SampledRows: 1000}
+	this.Require().Equal(0.0, stats.MismatchRate())
+	this.Require().InDelta(0.0038, stats.MismatchRateUpperBound(), 0.0001)
+
+	stats.MismatchedRows = 100
+	this.Require().Equal(0.1, stats.MismatchRate())
+	this.Require().InDelta(0.1202, stats.MismatchRateUpperBound(), 0.0001)
+
+	this.Require().Equal(1.0, ghostferry.SampleTableStats{}.MismatchRateUpperBound())
+}
+
+func TestSamplingTestSuite(t *testing.T) {
+	suite.Run(t, new(SamplingTestSuite))
+}
+
+type SamplingVerifierTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	verifier *ghostferry.SamplingVerifier
+}
+
+func (this *SamplingVerifierTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedSourceDB(100)
+
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", testhelpers.TestSchemaName))
+	this.Require().Nil(err)
+	_, err = this.Ferry.TargetDB.Exec(fmt.Sprintf("CREATE TABLE `%s`.`%s` (id bigint(20) not null auto_increment, data TEXT, primary key(id))", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	rows, err := this.Ferry.SourceDB.Query(fmt.Sprintf("SELECT id, data FROM `%s`.`%s`", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var data string
+		this.Require().Nil(rows.Scan(&id, &data))
+
+		_, err = this.Ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data) VALUES (?, ?)", testhelpers.TestSchemaName, testhelpers.TestTable1Name), id, data)
+		this.Require().Nil(err)
+	}
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	this.verifier = &ghostferry.SamplingVerifier{
+		SourceDB:  this.Ferry.SourceDB,
+		TargetDB:  this.Ferry.TargetDB,
+		Tables:    tables.AsSlice(),
+		RangeSize: 10,
+		Seed:      1,
+	}
+}
+
+func (this *SamplingVerifierTestSuite) TestMatchingSample() {
+	this.verifier.SamplePercentage = 50
+
+	result, err := this.verifier.Verify()
+	this.Require().Nil(err)
+	this.Require().True(result.DataCorrect)
+	this.Require().Equal(50, this.verifier.Stats()[0].SampledRows)
+}
+
+func (this *SamplingVerifierTestSuite) TestFullSampleFindsMismatch() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("UPDATE `%s`.`%s` SET data = 'changed' WHERE id = 42", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	this.verifier.SamplePercentage = 100
+
+	result, err := this.verifier.Verify()
+	this.Require().Nil(err)
+	this.Require().False(result.DataCorrect)
+	this.Require().Contains(result.Message, "1 of 100 sampled rows mismatched")
+	this.Require().Equal([]uint64{42}, this.verifier.Stats()[0].MismatchedPks)
+}
+
+func (this *SamplingVerifierTestSuite) TestSamplesRandomRows() {
+	this.verifier.RowsPerTable = 20
+
+	result, err := this.verifier.Verify()
+	this.Require().Nil(err)
+	this.Require().True(result.DataCorrect)
+	this.Require().True(this.verifier.Stats()[0].SampledRows > 0)
+	this.Require().True(this.verifier.Stats()[0].SampledRows <= 20)
+}
+
+func TestSamplingVerifierTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &SamplingVerifierTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,56 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type SchemaDriftDetectorTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	detector *ghostferry.SchemaDriftDetector
+}
+
+func (this *SchemaDriftDetectorTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedSourceDB(0)
+	this.SeedTargetDB(0)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	this.detector = &ghostferry.SchemaDriftDetector{
+		SourceDB: this.Ferry.SourceDB,
+		TargetDB: this.Ferry.TargetDB,
+		Tables:   tables.AsSlice(),
+	}
+	this.detector.Initialize()
+	this.Require().Nil(this.detector.Capture())
+}
+
+func (this *SchemaDriftDetectorTestSuite) TestUnchangedSchemasPass() {
+	_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (data) VALUES ('new row')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	this.Require().Nil(this.detector.Check())
+}
+
+func (this *SchemaDriftDetectorTestSuite) TestReportsDiffOfAlteredTable() {
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("ALTER TABLE `%s`.`%s` ADD extra INT", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	err = this.detector.Check()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), fmt.Sprintf("target `%s`.`%s` changed", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Contains(err.Error(), "+ `extra` int")
+	this.Require().NotContains(err.Error(), "source `")
+}
+
+func TestSchemaDriftDetectorTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &SchemaDriftDetectorTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
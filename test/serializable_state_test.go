@@ -0,0 +1,140 @@
+package test
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/suite"
+)
+
+type SerializableStateTestSuite struct {
+	suite.Suite
+
+	state *ghostferry.SerializableState
+}
+
+func (this *SerializableStateTestSuite) SetupTest() {
+	this.state = &ghostferry.SerializableState{
+		GhostferryVersion:         "1.1.0+test",
+		LastSuccessfulBinlogPos:   mysql.Position{Name: "mysql-bin.000002", Pos: 4242},
+		LastSuccessfulPrimaryKeys: map[string]uint64{"gftest.table1": 100},
+		CompletedTables:           map[string]bool{"gftest.table2": true},
+	}
+}
+
+func (this *SerializableStateTestSuite) TestDumpAndParseRoundTrip() {
+	data, err := this.state.Dump()
+	this.Require().Nil(err)
+
+	parsed, err := ghostferry.ParseStateDump(data)
+	this.Require().Nil(err)
+	this.Require().Equal(this.state, parsed)
+}
+
+func (this *SerializableStateTestSuite) TestDumpAndParseIterativeVerifierState() {
+	this.state.IterativeVerifierState = &ghostferry.IterativeVerifierState{
+		VerifiedPrimaryKeys: map[string]uint64{"gftest.table1": 50},
+		CompletedTables:     map[string]bool{"gftest.table2": true},
+		ReverifyPrimaryKeys: map[string][]uint64{"gftest.table2": []uint64{3, 7}},
+	}
+
+	data, err := this.state.Dump()
+	this.Require().Nil(err)
+
+	parsed, err := ghostferry.ParseStateDump(data)
+	this.Require().Nil(err)
+	this.Require().Equal(this.state, parsed)
+}
+
+func (this *SerializableStateTestSuite) TestDumpIsVersioned() {
+	data, err := this.state.Dump()
+	this.Require().Nil(err)
+
+	dump := ghostferry.StateDump{}
+	this.Require().Nil(json.Unmarshal(data, &dump))
+	this.Require().Equal(ghostferry.CurrentStateVersion, dump.StateVersion)
+}
+
+func (this *SerializableStateTestSuite) TestParseRejectsChecksumMismatch() {
+	data, err := this.state.Dump()
+	this.Require().Nil(err)
+
+	dump := ghostferry.StateDump{}
+	this.Require().Nil(json.Unmarshal(data, &dump))
+	dump.State = json.RawMessage(`{"GhostferryVersion":"tampered"}`)
+	data, err = json.Marshal(dump)
+	this.Require().Nil(err)
+
+	_, err = ghostferry.ParseStateDump(data)
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "state dump checksum mismatch")
+}
+
+func (this *SerializableStateTestSuite) TestParseRejectsNewerVersions() {
+	data, err := json.Marshal(ghostferry.StateDump{
+		StateVersion: ghostferry.CurrentStateVersion + 1,
+		State:        json.RawMessage(`{}`),
+	})
+	this.Require().Nil(err)
+
+	_, err = ghostferry.ParseStateDump(data)
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "is newer than the supported version")
+}
+
+func (this *SerializableStateTestSuite) TestParseRejectsStateWithoutBinlogPosition() {
+	_, err := ghostferry.ParseStateDump([]byte(`{"CompletedTables": {"gftest.table2": true}}`))
+	this.Require().EqualError(err, "state has no binlog position to resume from")
+}
+
+func (this *SerializableStateTestSuite) TestParseMigratesLegacyDump() {
+	legacy := []byte(`{
+		"CompletedTables": {"gftest.table2": true},
+		"LastSuccessfulBinlogPos": {"Name": "mysql-bin.000002", "Pos": 4242},
+		"LastSuccessfulPrimaryKeys": {"gftest.table1": 100}
+	}`)
+
+	parsed, err := ghostferry.ParseStateDump(legacy)
+	this.Require().Nil(err)
+
+	this.state.GhostferryVersion = ""
+	this.Require().Equal(this.state, parsed)
+}
+
+func (this *SerializableStateTestSuite) TestParseMigratesVersion2Dump() {
+	state := []byte(`{"GhostferryVersion":"1.1.0+test","LastSuccessfulBinlogPos":{"Name":"mysql-bin.000002","Pos":4242},"LastSuccessfulPrimaryKeys":{"gftest.table1":100},"CompletedTables":{"gftest.table2":true}}`)
+	data, err := json.Marshal(ghostferry.StateDump{
+		StateVersion: 2,
+		Checksum:     crc32.ChecksumIEEE(state),
+		State:        json.RawMessage(state),
+	})
+	this.Require().Nil(err)
+
+	parsed, err := ghostferry.ParseStateDump(data)
+	this.Require().Nil(err)
+	this.Require().Equal(this.state, parsed)
+}
+
+func (this *SerializableStateTestSuite) TestDumpAndParseDeferredIndexes() {
+	this.state.DeferredIndexes = []ghostferry.DeferredIndex{
+		{Table: "`gftest`.`table1`", Name: "idx_data", Definition: "KEY `idx_data` (`data`)"},
+	}
+
+	data, err := this.state.Dump()
+	this.Require().Nil(err)
+
+	dump := ghostferry.StateDump{}
+	this.Require().Nil(json.Unmarshal(data, &dump))
+	this.Require().True(dump.StateVersion >= 3)
+
+	parsed, err := ghostferry.ParseStateDump(data)
+	this.Require().Nil(err)
+	this.Require().Equal(this.state, parsed)
+}
+
+func TestSerializableStateTestSuite(t *testing.T) {
+	suite.Run(t, new(SerializableStateTestSuite))
+}
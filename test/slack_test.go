@@ -0,0 +1,85 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type SlackTestSuite struct {
+	suite.Suite
+
+	server   *httptest.Server
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (this *SlackTestSuite) SetupTest() {
+	this.messages = nil
+
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+
+		var message struct{ Text string }
+		this.Assert().Nil(json.NewDecoder(r.Body).Decode(&message))
+		this.messages = append(this.messages, message.Text)
+	}))
+}
+
+func (this *SlackTestSuite) TearDownTest() {
+	this.server.Close()
+}
+
+func (this *SlackTestSuite) newNotifier(slack *ghostferry.SlackConfig) *ghostferry.Notifier {
+	slack.WebhookURL = this.server.URL
+	slack.RetryPolicy = &ghostferry.RetryPolicy{MaxAttempts: 3, InitialDelay: "1ms"}
+	this.Require().Nil(slack.Validate())
+
+	notifier := &ghostferry.Notifier{
+		Webhooks: []*ghostferry.WebhookConfig{slack.Webhook()},
+		State:    func() string { return ghostferry.StateCutover },
+	}
+	notifier.Initialize()
+	return notifier
+}
+
+func (this *SlackTestSuite) TestPostsKeyEventsByDefault() {
+	notifier := this.newNotifier(&ghostferry.SlackConfig{Name: "shop-1"})
+	notifier.Notify(ghostferry.NotificationCopyStarted, "")
+	notifier.Notify(ghostferry.NotificationTableCopied, "")
+	notifier.Notify(ghostferry.NotificationFatalError, "binlog_writer: failed")
+	notifier.Wait()
+
+	this.Require().Equal([]string{
+		"*shop-1* :rotating_light: Fatal error\nState: cutover\n```binlog_writer: failed```",
+	}, this.messages)
+}
+
+func (this *SlackTestSuite) TestPostsSelectedEvents() {
+	notifier := this.newNotifier(&ghostferry.SlackConfig{
+		Events: []string{ghostferry.NotificationCopyStarted},
+	})
+	notifier.Notify(ghostferry.NotificationCopyStarted, "")
+	notifier.Notify(ghostferry.NotificationFatalError, "binlog_writer: failed")
+	notifier.Wait()
+
+	this.Require().Equal([]string{":arrow_forward: Copy started\nState: cutover"}, this.messages)
+}
+
+func (this *SlackTestSuite) TestValidate() {
+	slack := &ghostferry.SlackConfig{}
+	this.Require().EqualError(slack.Validate(), "WebhookURL is required")
+
+	slack = &ghostferry.SlackConfig{WebhookURL: "https://hooks.slack.com/services/T0/B0/X", Events: []string{"unknown"}}
+	this.Require().EqualError(slack.Validate(), "invalid event unknown")
+}
+
+func TestSlackTestSuite(t *testing.T) {
+	suite.Run(t, new(SlackTestSuite))
+}
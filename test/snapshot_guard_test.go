@@ -0,0 +1,41 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type SnapshotGuardTestSuite struct {
+	suite.Suite
+}
+
+func (this *SnapshotGuardTestSuite) TestExceededThresholds() {
+	config := &ghostferry.SnapshotGuardConfig{MaxHistoryLength: 1000, MaxTransactionAge: "1h"}
+	this.Require().Nil(config.Validate())
+
+	this.Require().Equal("", config.Exceeded(1000, time.Hour))
+	this.Require().Equal("history list length 1001 is above 1000", config.Exceeded(1001, time.Minute))
+	this.Require().Equal("snapshot age 1h30m0s is above 1h0m0s", config.Exceeded(10, 90*time.Minute))
+	this.Require().Equal("history list length 5000 is above 1000, snapshot age 2h0m0s is above 1h0m0s", config.Exceeded(5000, 2*time.Hour))
+}
+
+func (this *SnapshotGuardTestSuite) TestUnsetThresholdsAreNotChecked() {
+	config := &ghostferry.SnapshotGuardConfig{MaxTransactionAge: "1h"}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal("", config.Exceeded(1000000000, time.Minute))
+}
+
+func (this *SnapshotGuardTestSuite) TestInvalidDurations() {
+	config := &ghostferry.SnapshotGuardConfig{MaxTransactionAge: "an hour"}
+	this.Require().Contains(config.Validate().Error(), "invalid MaxTransactionAge")
+
+	config = &ghostferry.SnapshotGuardConfig{MaxHistoryLength: 1, CheckInterval: "0s"}
+	this.Require().EqualError(config.Validate(), "CheckInterval must be positive")
+}
+
+func TestSnapshotGuardTestSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotGuardTestSuite))
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type StatusSnapshotTestSuite struct {
+	suite.Suite
+
+	ferry  *ghostferry.Ferry
+	server *ghostferry.ControlServer
+}
+
+func (this *StatusSnapshotTestSuite) SetupTest() {
+	binlogWriter := &ghostferry.BinlogWriter{BatchSize: 10}
+	this.Require().Nil(binlogWriter.Initialize())
+
+	dataIterator := &ghostferry.DataIterator{Concurrency: 1}
+	this.Require().Nil(dataIterator.Initialize())
+
+	this.ferry = &ghostferry.Ferry{
+		Config: &ghostferry.Config{
+			Source: ghostferry.DatabaseConfig{Host: "source", Port: 3306},
+			Target: ghostferry.DatabaseConfig{Host: "target", Port: 3306},
+		},
+		OverallState:   ghostferry.StateCopying,
+		BinlogStreamer: &ghostferry.BinlogStreamer{},
+		BinlogWriter:   binlogWriter,
+		DataIterator:   dataIterator,
+		ReadThrottler:  &ghostferry.PauserThrottler{},
+		WriteThrottler: &ghostferry.PauserThrottler{},
+		Tables: ghostferry.TableSchemaCache{
+			"gftest.users":  newStatusSnapshotTable("users"),
+			"gftest.orders": newStatusSnapshotTable("orders"),
+		},
+	}
+
+	this.server = &ghostferry.ControlServer{
+		F:       this.ferry,
+		Addr:    "127.0.0.1:0",
+		Basedir: "..",
+	}
+	this.Require().Nil(this.server.Initialize())
+}
+
+func newStatusSnapshotTable(name string) *schema.Table {
+	return &schema.Table{
+		Schema:    "gftest",
+		Name:      name,
+		Columns:   []schema.TableColumn{{Name: "id", Type: schema.TYPE_NUMBER}},
+		PKColumns: []int{0},
+	}
+}
+
+func (this *StatusSnapshotTestSuite) TestReportsTableProgress() {
+	state := this.ferry.DataIterator.CurrentState
+	state.UpdateTargetPK("gftest.users", 100)
+	state.UpdateLastSuccessfulPK("gftest.users", 100)
+	state.MarkTableAsCompleted("gftest.users")
+	state.UpdateTargetPK("gftest.orders", 200)
+	state.UpdateLastSuccessfulPK("gftest.orders", 50)
+
+	snapshot := this.ferry.StatusSnapshot(nil)
+	this.Require().Equal(ghostferry.StatusSnapshotVersion, snapshot.Version)
+	this.Require().Equal(ghostferry.StateCopying, snapshot.Phase)
+	this.Require().Equal(2, snapshot.Tables.Total)
+	this.Require().Equal(1, snapshot.Tables.Completed)
+
+	this.Require().Equal(2, len(snapshot.Tables.Items))
+	this.Require().Equal("gftest.users", snapshot.Tables.Items[0].Name)
+	this.Require().Equal("complete", snapshot.Tables.Items[0].Status)
+	this.Require().Equal(1.0, snapshot.Tables.Items[0].Progress)
+	this.Require().Equal("gftest.orders", snapshot.Tables.Items[1].Name)
+	this.Require().Equal("copying", snapshot.Tables.Items[1].Status)
+	this.Require().Equal(0.25, snapshot.Tables.Items[1].Progress)
+
+	this.Require().Nil(snapshot.Binlog.TargetPosition)
+	this.Require().Nil(snapshot.Errors.Fatal)
+	this.Require().False(snapshot.Verification.Supported)
+}
+
+func (this *StatusSnapshotTestSuite) TestServesStableJSONDocument() {
+	response := httptest.NewRecorder()
+	this.server.ServeHTTP(response, httptest.NewRequest("GET", "/api/status", nil))
+	this.Require().Equal(http.StatusOK, response.Code)
+	this.Require().Equal("application/json", response.Header().Get("Content-Type"))
+
+	var document map[string]interface{}
+	this.Require().Nil(json.Unmarshal(response.Body.Bytes(), &document))
+
+	for _, field := range []string{"version", "ghostferry_version", "time", "phase", "start_time", "elapsed_seconds", "automatic_cutover", "eta_seconds", "tables", "binlog", "throttle", "errors", "verification"} {
+		this.Require().Contains(document, field)
+	}
+
+	this.Require().Equal(float64(1), document["version"])
+	this.Require().Nil(document["eta_seconds"])
+	this.Require().Equal([]interface{}{}, document["throttle"].(map[string]interface{})["paused_components"])
+	this.Require().Nil(document["binlog"].(map[string]interface{})["target_position"])
+}
+
+func (this *StatusSnapshotTestSuite) TestReportsTimeOfResumedBinlogPosition() {
+	snapshot := this.ferry.StatusSnapshot(nil)
+	this.Require().Nil(snapshot.Binlog.ApplyingEventsFrom)
+
+	eventTime := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	this.ferry.BinlogTimeline = &ghostferry.BinlogTimeline{}
+	this.ferry.BinlogTimeline.Restore([]ghostferry.BinlogTimelineEntry{
+		{Position: mysql.Position{Name: "mysql-bin.000002", Pos: 4}, EventTime: eventTime},
+	})
+	this.ferry.BinlogWriter.SetStartBinlogPosition(mysql.Position{Name: "mysql-bin.000002", Pos: 1000})
+
+	snapshot = this.ferry.StatusSnapshot(nil)
+	this.Require().NotNil(snapshot.Binlog.ApplyingEventsFrom)
+	this.Require().True(eventTime.Equal(*snapshot.Binlog.ApplyingEventsFrom))
+}
+
+func (this *StatusSnapshotTestSuite) TestServesJSONSchema() {
+	response := httptest.NewRecorder()
+	this.server.ServeHTTP(response, httptest.NewRequest("GET", "/api/status/schema", nil))
+	this.Require().Equal(http.StatusOK, response.Code)
+
+	var schema map[string]interface{}
+	this.Require().Nil(json.Unmarshal(response.Body.Bytes(), &schema))
+	this.Require().Equal(float64(ghostferry.StatusSnapshotVersion), schema["properties"].(map[string]interface{})["version"].(map[string]interface{})["const"])
+}
+
+func TestStatusSnapshotTestSuite(t *testing.T) {
+	suite.Run(t, new(StatusSnapshotTestSuite))
+}
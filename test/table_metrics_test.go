@@ -0,0 +1,92 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type TableMetricsTestSuite struct {
+	suite.Suite
+
+	sink    chan interface{}
+	metrics *ghostferry.Metrics
+	config  *ghostferry.TableMetricsConfig
+}
+
+func (this *TableMetricsTestSuite) SetupTest() {
+	this.sink = make(chan interface{}, 50)
+
+	this.config = &ghostferry.TableMetricsConfig{
+		Tables:    []string{"gftest.important"},
+		MaxTables: 1,
+		MinRows:   100,
+	}
+	this.Require().Nil(this.config.Validate())
+
+	this.metrics = &ghostferry.Metrics{
+		Prefix:    "test",
+		Sink:      this.sink,
+		TableTags: ghostferry.NewTableTagLimiter(this.config),
+	}
+}
+
+func (this *TableMetricsTestSuite) TestCountsLowTrafficTablesAsOther() {
+	this.metrics.CountTable("Table.RowsCopied", "gftest.important", 1)
+	this.Require().Equal("gftest.important", this.nextTableTag())
+
+	this.metrics.CountTable("Table.RowsCopied", "gftest.small", 60)
+	this.Require().Equal(ghostferry.OtherTablesTag, this.nextTableTag())
+
+	this.metrics.CountTable("Table.RowsCopied", "gftest.small", 60)
+	this.Require().Equal("gftest.small", this.nextTableTag())
+
+	this.metrics.CountTable("Table.EventsApplied", "gftest.small", 1)
+	this.Require().Equal("gftest.small", this.nextTableTag())
+}
+
+func (this *TableMetricsTestSuite) TestCountsTablesOverMaxTablesAsOther() {
+	this.metrics.CountTable("Table.RowsCopied", "gftest.first", 500)
+	this.Require().Equal("gftest.first", this.nextTableTag())
+
+	this.metrics.CountTable("Table.RowsCopied", "gftest.second", 500)
+	this.Require().Equal(ghostferry.OtherTablesTag, this.nextTableTag())
+
+	this.metrics.CountTable("Table.RowsCopied", "gftest.important", 1)
+	this.Require().Equal("gftest.important", this.nextTableTag())
+}
+
+func (this *TableMetricsTestSuite) TestTagsEveryTableWithoutLimiter() {
+	this.metrics.TableTags = nil
+
+	this.metrics.CountTable("Table.VerifyMismatches", "gftest.small", 1)
+
+	expected := ghostferry.CountMetric{
+		MetricBase: ghostferry.MetricBase{
+			Key:        "test.Table.VerifyMismatches",
+			Tags:       []ghostferry.MetricTag{{Name: "table", Value: "gftest.small"}},
+			SampleRate: 1.0,
+		},
+		Value: 1,
+	}
+	this.Require().Equal(expected, <-this.sink)
+}
+
+func (this *TableMetricsTestSuite) TestValidate() {
+	config := &ghostferry.TableMetricsConfig{}
+	this.Require().Nil(config.Validate())
+	this.Require().Equal(100, config.MaxTables)
+
+	config = &ghostferry.TableMetricsConfig{MinRows: -1}
+	this.Require().EqualError(config.Validate(), "MinRows cannot be negative")
+}
+
+func (this *TableMetricsTestSuite) nextTableTag() string {
+	metric := (<-this.sink).(ghostferry.CountMetric)
+	return metric.Tags[0].Value
+}
+
+func TestTableMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(TableMetricsTestSuite))
+}
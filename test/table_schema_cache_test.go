@@ -62,6 +62,41 @@ func (this *TableSchemaCacheTestSuite) TestLoadTablesWithoutFiltering() {
 	}
 }
 
+func (this *TableSchemaCacheTestSuite) TestLoadTablesLoadsSchemasLikeShowColumnsAndIndex() {
+	query := fmt.Sprintf(
+		"CREATE TABLE %s.%s (id bigint(20) unsigned not null auto_increment, status enum('draft','paid') not null, "+
+			"code varchar(20) collate utf8mb4_bin not null, created_at datetime(6), data TEXT, "+
+			"primary key(id), key status_created_at (status, created_at), unique key code (code))",
+		testhelpers.TestSchemaName, "test_table_4",
+	)
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter)
+	this.Require().Nil(err)
+
+	expected, err := sqlSchema.NewTableFromSqlDB(this.Ferry.SourceDB, testhelpers.TestSchemaName, "test_table_4")
+	this.Require().Nil(err)
+
+	table := tables.Get(testhelpers.TestSchemaName, "test_table_4")
+	this.Require().Equal(expected.Columns, table.Columns)
+	this.Require().Equal(expected.PKColumns, table.PKColumns)
+	this.Require().Equal(len(expected.Indexes), len(table.Indexes))
+	for i, index := range table.Indexes {
+		this.Require().Equal(expected.Indexes[i].Name, index.Name)
+		this.Require().Equal(expected.Indexes[i].Columns, index.Columns)
+	}
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesIgnoresGhostferryTables() {
+	testhelpers.SeedInitialData(this.Ferry.SourceDB, testhelpers.TestSchemaName, ghostferry.GhostferryTablePrefix+"state", 0)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter)
+	this.Require().Nil(err)
+	this.Require().Equal(len(this.tablenames), len(tables))
+	this.Require().Nil(tables.Get(testhelpers.TestSchemaName, ghostferry.GhostferryTablePrefix+"state"))
+}
+
 func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectTablesWithoutNumericPK() {
 	query := fmt.Sprintf("CREATE TABLE %s.%s (id varchar(20) not null, data TEXT, primary key(id))", testhelpers.TestSchemaName, "test_table_4")
 	_, err := this.Ferry.SourceDB.Exec(query)
@@ -85,6 +120,35 @@ func (this *TableSchemaCacheTestSuite) TestLoadTablesRejectTablesWithoutAnyPK()
 	this.Require().Contains(err.Error(), "table test_table_4 has 0 primary key columns")
 }
 
+func (this *TableSchemaCacheTestSuite) TestLoadTablesUsesUniqueKeyWithoutPK() {
+	query := fmt.Sprintf("CREATE TABLE %s.%s (data TEXT, code varchar(20) not null, id bigint(20) not null, unique key code (code), unique key id (id))", testhelpers.TestSchemaName, "test_table_4")
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter)
+	this.Require().Nil(err)
+
+	table := tables.Get(testhelpers.TestSchemaName, "test_table_4")
+	this.Require().Equal([]int{2}, table.PKColumns)
+	this.Require().False(ghostferry.IsFullRowMatchTable(table))
+}
+
+func (this *TableSchemaCacheTestSuite) TestLoadTablesWithFullRowMatchingAcceptsTablesWithoutAnyKey() {
+	query := fmt.Sprintf("CREATE TABLE %s.%s (id bigint(20), data TEXT, unique key id (id))", testhelpers.TestSchemaName, "test_table_4")
+	_, err := this.Ferry.SourceDB.Exec(query)
+	this.Require().Nil(err)
+
+	_, err = ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter)
+	this.Require().NotNil(err)
+
+	tables, err := ghostferry.LoadTablesWithFullRowMatching(this.Ferry.SourceDB, this.tableFilter)
+	this.Require().Nil(err)
+
+	table := tables.Get(testhelpers.TestSchemaName, "test_table_4")
+	this.Require().True(ghostferry.IsFullRowMatchTable(table))
+	this.Require().Equal(len(this.tablenames)+1, len(tables))
+}
+
 func (this *TableSchemaCacheTestSuite) TestAllTableNames() {
 	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter)
 	this.Require().Nil(err)
@@ -154,6 +218,35 @@ func (this *TableSchemaCacheTestSuite) TestQuotedTableNameFromString() {
 	this.Require().Equal("``.``", ghostferry.QuotedTableNameFromString("", ""))
 }
 
+func (this *TableSchemaCacheTestSuite) TestSmallTables() {
+	for i := 0; i < 50; i++ {
+		_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`test_table_1` (data) VALUES (?)", testhelpers.TestSchemaName), testhelpers.RandData())
+		this.Require().Nil(err)
+	}
+
+	// The row count estimates are only refreshed by ANALYZE TABLE.
+	for _, tablename := range this.tablenames {
+		_, err := this.Ferry.SourceDB.Exec(fmt.Sprintf("ANALYZE TABLE `%s`.`%s`", testhelpers.TestSchemaName, tablename))
+		this.Require().Nil(err)
+	}
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.tableFilter)
+	this.Require().Nil(err)
+
+	smallTables, err := ghostferry.SmallTables(this.Ferry.SourceDB, tables.AsSlice(), 10, 0)
+	this.Require().Nil(err)
+
+	smallTableNames := []string{}
+	for _, table := range smallTables {
+		smallTableNames = append(smallTableNames, table.Name)
+	}
+	this.Require().ElementsMatch([]string{"test_table_2", "test_table_3"}, smallTableNames)
+
+	smallTables, err = ghostferry.SmallTables(this.Ferry.SourceDB, tables.AsSlice(), 1000, 1)
+	this.Require().Nil(err)
+	this.Require().Equal(0, len(smallTables))
+}
+
 func TestTableSchemaCache(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, &TableSchemaCacheTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/stretchr/testify/suite"
+)
+
+type TargetRowGuardTestSuite struct {
+	*testhelpers.GhostferryUnitTestSuite
+
+	guard *ghostferry.TargetRowGuard
+}
+
+func (this *TargetRowGuardTestSuite) SetupTest() {
+	this.GhostferryUnitTestSuite.SetupTest()
+	this.SeedSourceDB(0)
+	this.SeedTargetDB(0)
+
+	tables, err := ghostferry.LoadTables(this.Ferry.SourceDB, this.Ferry.TableFilter)
+	this.Require().Nil(err)
+
+	this.guard = &ghostferry.TargetRowGuard{
+		TargetDB: this.Ferry.TargetDB,
+		Tables:   tables.AsSlice(),
+		Writes:   ghostferry.NewTargetWriteCounter(),
+	}
+}
+
+func (this *TargetRowGuardTestSuite) TestDetectsAutocommitWriteOfAnotherWriter() {
+	this.Require().Nil(this.guard.Check())
+
+	// Written without a default database and outside of a transaction.
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data) VALUES (1, 'unexpected')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+
+	err = this.guard.Check()
+	this.Require().NotNil(err)
+	this.Require().Contains(err.Error(), "unexpected writes on the target by another writer")
+	this.Require().Equal(ghostferry.ErrorClassTargetConflict, ghostferry.ClassifyError(err))
+}
+
+func (this *TargetRowGuardTestSuite) TestAllowsTheWritesOfTheFerry() {
+	this.Require().Nil(this.guard.Check())
+
+	table := fmt.Sprintf("%s.%s", testhelpers.TestSchemaName, testhelpers.TestTable1Name)
+	this.guard.Writes.Start(table, 2)
+	_, err := this.Ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data) VALUES (1, 'a'), (2, 'b')", testhelpers.TestSchemaName, testhelpers.TestTable1Name))
+	this.Require().Nil(err)
+	this.guard.Writes.Finish(table, 2)
+
+	this.Require().Nil(this.guard.Check())
+}
+
+func TestTargetRowGuardTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, &TargetRowGuardTestSuite{GhostferryUnitTestSuite: &testhelpers.GhostferryUnitTestSuite{}})
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type ThrottleScheduleTestSuite struct {
+	suite.Suite
+
+	businessHours *ghostferry.ThrottleSchedule
+	nights        *ghostferry.ThrottleSchedule
+	scheduler     *ghostferry.ThrottleScheduler
+}
+
+func (this *ThrottleScheduleTestSuite) SetupTest() {
+	this.businessHours = &ghostferry.ThrottleSchedule{
+		Days:              []string{"weekdays"},
+		Start:             "09:00",
+		End:               "18:00",
+		CopyRowsPerSecond: 1000,
+	}
+	this.Require().Nil(this.businessHours.Validate())
+
+	this.nights = &ghostferry.ThrottleSchedule{
+		Days:  []string{"fri"},
+		Start: "22:00",
+		End:   "06:00",
+	}
+	this.Require().Nil(this.nights.Validate())
+
+	this.scheduler = &ghostferry.ThrottleScheduler{
+		Schedules:         []*ghostferry.ThrottleSchedule{this.businessHours, this.nights},
+		Default:           ghostferry.ThrottleSchedule{CopyRowsPerSecond: 5000, BinlogRowsPerSecond: 2000},
+		Location:          time.UTC,
+		CopyRateLimiter:   ghostferry.NewRateLimiter(0, 0),
+		BinlogRateLimiter: ghostferry.NewRateLimiter(0, 0),
+	}
+}
+
+// 2020-01-06 is a Monday.
+func scheduleTime(day, hour, minute int) time.Time {
+	return time.Date(2020, 1, day, hour, minute, 0, 0, time.UTC)
+}
+
+func (this *ThrottleScheduleTestSuite) TestWindow() {
+	this.Require().True(this.businessHours.Includes(scheduleTime(6, 9, 0)))
+	this.Require().True(this.businessHours.Includes(scheduleTime(10, 17, 59)))
+	this.Require().False(this.businessHours.Includes(scheduleTime(6, 18, 0)))
+	this.Require().False(this.businessHours.Includes(scheduleTime(6, 8, 59)))
+	this.Require().False(this.businessHours.Includes(scheduleTime(11, 12, 0)))
+}
+
+func (this *ThrottleScheduleTestSuite) TestWindowSpanningMidnight() {
+	this.Require().True(this.nights.Includes(scheduleTime(10, 22, 0)))
+	this.Require().True(this.nights.Includes(scheduleTime(11, 5, 59)))
+	this.Require().False(this.nights.Includes(scheduleTime(11, 6, 0)))
+	this.Require().False(this.nights.Includes(scheduleTime(11, 22, 0)))
+	this.Require().False(this.nights.Includes(scheduleTime(10, 5, 0)))
+}
+
+func (this *ThrottleScheduleTestSuite) TestWholeDay() {
+	schedule := &ghostferry.ThrottleSchedule{Days: []string{"weekends"}}
+	this.Require().Nil(schedule.Validate())
+	this.Require().True(schedule.Includes(scheduleTime(11, 0, 0)))
+	this.Require().True(schedule.Includes(scheduleTime(12, 23, 59)))
+	this.Require().False(schedule.Includes(scheduleTime(13, 12, 0)))
+}
+
+func (this *ThrottleScheduleTestSuite) TestAppliesTheLimitsOfTheActiveSchedule() {
+	this.scheduler.Apply(scheduleTime(6, 12, 0))
+	rows, _ := this.scheduler.CopyRateLimiter.Limits()
+	this.Require().Equal(int64(1000), rows)
+	rows, _ = this.scheduler.BinlogRateLimiter.Limits()
+	this.Require().Equal(int64(0), rows)
+
+	this.scheduler.Apply(scheduleTime(6, 20, 0))
+	rows, _ = this.scheduler.CopyRateLimiter.Limits()
+	this.Require().Equal(int64(5000), rows)
+	rows, _ = this.scheduler.BinlogRateLimiter.Limits()
+	this.Require().Equal(int64(2000), rows)
+}
+
+func (this *ThrottleScheduleTestSuite) TestKeepsTheLimitsChangedDuringTheWindow() {
+	this.scheduler.Apply(scheduleTime(6, 12, 0))
+	this.scheduler.CopyRateLimiter.SetLimits(10, 0)
+
+	this.scheduler.Apply(scheduleTime(6, 13, 0))
+	rows, _ := this.scheduler.CopyRateLimiter.Limits()
+	this.Require().Equal(int64(10), rows)
+
+	this.scheduler.Apply(scheduleTime(6, 18, 0))
+	rows, _ = this.scheduler.CopyRateLimiter.Limits()
+	this.Require().Equal(int64(5000), rows)
+}
+
+func (this *ThrottleScheduleTestSuite) TestValidate() {
+	schedule := &ghostferry.ThrottleSchedule{Days: []string{"someday"}}
+	this.Require().EqualError(schedule.Validate(), "invalid day someday, must be mon, tue, wed, thu, fri, sat, sun, weekdays or weekends")
+
+	schedule = &ghostferry.ThrottleSchedule{Start: "09:00"}
+	this.Require().EqualError(schedule.Validate(), "Start and End must be set together")
+
+	schedule = &ghostferry.ThrottleSchedule{Start: "09:00", End: "25:00"}
+	this.Require().EqualError(schedule.Validate(), "invalid End: 25:00 is not a HH:MM time")
+
+	schedule = &ghostferry.ThrottleSchedule{CopyRowsPerSecond: -1}
+	this.Require().EqualError(schedule.Validate(), "the rate limits cannot be negative")
+}
+
+func TestThrottleScheduleTestSuite(t *testing.T) {
+	suite.Run(t, new(ThrottleScheduleTestSuite))
+}
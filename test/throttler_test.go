@@ -60,6 +60,31 @@ func (t *ThrottlerTestSuite) TestEnableDisable() {
 	}
 }
 
+func (t *ThrottlerTestSuite) TestReadsAndWritesAreThrottledIndependently() {
+	readThrottler := &ghostferry.PauserThrottler{}
+	ferry := &ghostferry.Ferry{
+		Throttler:      t.throttler,
+		ReadThrottler:  readThrottler,
+		WriteThrottler: t.throttler,
+	}
+
+	readThrottler.SetPaused(true)
+	t.Require().True(ferry.ReadThrottler.Throttled())
+	t.Require().False(ferry.WriteThrottler.Throttled())
+
+	ferry.SetThrottlersPaused(false)
+	t.Require().False(ferry.ReadThrottler.Throttled())
+
+	ferry.SetThrottlersPaused(true)
+	t.Require().True(ferry.ReadThrottler.Throttled())
+	t.Require().True(ferry.WriteThrottler.Throttled())
+
+	ferry.SetThrottlersDisabled(true)
+	t.Require().True(readThrottler.Disabled())
+	t.Require().True(t.throttler.Disabled())
+	ferry.WaitForThrottlers()
+}
+
 func TestThrottlerTestSuite(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, new(ThrottlerTestSuite))
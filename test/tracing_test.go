@@ -0,0 +1,91 @@
+package test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type TracingTestSuite struct {
+	suite.Suite
+
+	server *httptest.Server
+	bodies chan string
+}
+
+func (this *TracingTestSuite) SetupTest() {
+	this.bodies = make(chan string, 16)
+	this.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		this.Require().Equal("/v1/traces", r.URL.Path)
+		this.Require().Equal("secret", r.Header.Get("X-Api-Key"))
+		this.bodies <- string(body)
+	}))
+}
+
+func (this *TracingTestSuite) TearDownTest() {
+	ghostferry.StopAndFlushTracing()
+	this.server.Close()
+	os.Unsetenv("TRACEPARENT")
+}
+
+func (this *TracingTestSuite) TestSendsSpansToTheCollector() {
+	os.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	_, err := ghostferry.InitializeTracing("ghostferry-test", &ghostferry.TracingConfig{
+		Endpoint: this.server.URL,
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+	})
+	this.Require().Nil(err)
+
+	span := ghostferry.StartSpan("Cursor.Batch", []ghostferry.MetricTag{{Name: "table", Value: "gftest.table1"}})
+	this.Require().NotNil(span)
+	span.End(nil)
+
+	err = ghostferry.Trace("VerifyBeforeCutover", nil, func() error {
+		return errors.New("verification failed")
+	})
+	this.Require().EqualError(err, "verification failed")
+
+	ghostferry.StopAndFlushTracing()
+
+	var body string
+	select {
+	case body = <-this.bodies:
+	default:
+		this.Fail("no spans were sent")
+	}
+
+	this.Require().Contains(body, `"stringValue":"ghostferry-test"`)
+	this.Require().Contains(body, `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	this.Require().Contains(body, `"parentSpanId":"00f067aa0ba902b7"`)
+	this.Require().Contains(body, `"name":"Cursor.Batch"`)
+	this.Require().Contains(body, `"stringValue":"gftest.table1"`)
+	this.Require().Contains(body, `"message":"verification failed"`)
+}
+
+func (this *TracingTestSuite) TestSpansAreNotStartedWithoutTracing() {
+	span := ghostferry.StartSpan("Cursor.Batch", nil)
+	this.Require().Nil(span)
+
+	// Ending a nil span does nothing.
+	span.End(nil)
+}
+
+func (this *TracingTestSuite) TestEndpointIsRequired() {
+	os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	os.Unsetenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+
+	_, err := ghostferry.InitializeTracing("ghostferry-test", &ghostferry.TracingConfig{})
+	this.Require().EqualError(err, "Endpoint is required")
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
@@ -37,6 +37,66 @@ func TestCopyDataWithInsertLoad(t *testing.T) {
 	testcase.Run()
 }
 
+func TestCopyDataThroughStagingTables(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.StageRowBatches = true
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T:           t,
+		SetupAction: setupSingleTableDatabase,
+		DataWriter: &testhelpers.MixedActionDataWriter{
+			ProbabilityOfInsert: 1.0,
+			ProbabilityOfUpdate: 0.0,
+			ProbabilityOfDelete: 0.0,
+			NumberOfWriters:     2,
+			Tables:              []string{"gftest.table1"},
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+}
+
+func TestCopyDataWithLoadDataInfile(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.LoadDataInfile = true
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T:           t,
+		SetupAction: setupSingleTableDatabase,
+		DataWriter: &testhelpers.MixedActionDataWriter{
+			ProbabilityOfInsert: 1.0,
+			ProbabilityOfUpdate: 0.0,
+			ProbabilityOfDelete: 0.0,
+			NumberOfWriters:     2,
+			Tables:              []string{"gftest.table1"},
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+}
+
+func TestCopyDataWithPreserveSourceTransactions(t *testing.T) {
+	ferry := testhelpers.NewTestFerry()
+	ferry.Config.PreserveSourceTransactions = true
+
+	testcase := &testhelpers.IntegrationTestCase{
+		T:           t,
+		SetupAction: setupSingleTableDatabase,
+		DataWriter: &testhelpers.MixedActionDataWriter{
+			ProbabilityOfInsert: 1.0 / 3.0,
+			ProbabilityOfUpdate: 1.0 / 3.0,
+			ProbabilityOfDelete: 1.0 / 3.0,
+			NumberOfWriters:     4,
+			Tables:              []string{"gftest.table1"},
+		},
+		Ferry: ferry,
+	}
+
+	testcase.Run()
+}
+
 func TestCopyDataWithUpdateLoad(t *testing.T) {
 	testcase := &testhelpers.IntegrationTestCase{
 		T:           t,
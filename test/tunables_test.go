@@ -0,0 +1,123 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/stretchr/testify/suite"
+)
+
+type maxLagThrottler struct {
+	ghostferry.PauserThrottler
+	maxLag int
+}
+
+func (t *maxLagThrottler) MaxLag() int {
+	return t.maxLag
+}
+
+func (t *maxLagThrottler) SetMaxLag(maxLag int) {
+	t.maxLag = maxLag
+}
+
+type TunablesTestSuite struct {
+	suite.Suite
+
+	ferry  *ghostferry.Ferry
+	server *ghostferry.ControlServer
+}
+
+func (this *TunablesTestSuite) SetupTest() {
+	dataIterator := &ghostferry.DataIterator{
+		CursorConfig: &ghostferry.CursorConfig{BatchSize: 100},
+		Concurrency:  2,
+	}
+	this.Require().Nil(dataIterator.Initialize())
+
+	this.ferry = &ghostferry.Ferry{
+		DataIterator:      dataIterator,
+		CopyRateLimiter:   ghostferry.NewRateLimiter(0, 0),
+		BinlogRateLimiter: ghostferry.NewRateLimiter(500, 0),
+		Throttler:         &ghostferry.PauserThrottler{},
+	}
+
+	this.server = &ghostferry.ControlServer{
+		F:       this.ferry,
+		Addr:    "127.0.0.1:0",
+		Basedir: "..",
+	}
+	this.Require().Nil(this.server.Initialize())
+}
+
+func (this *TunablesTestSuite) TestAppliesTunablesThroughTheControlServer() {
+	response := this.post(`{"DataIterationBatchSize": 500, "CopyRowsPerSecond": 1000}`)
+	this.Require().Equal(http.StatusOK, response.Code)
+
+	var tunables ghostferry.TunableConfig
+	this.Require().Nil(json.NewDecoder(response.Body).Decode(&tunables))
+	this.Require().Equal(uint64(500), tunables.DataIterationBatchSize)
+	this.Require().Equal(2, tunables.DataIterationConcurrency)
+	this.Require().Equal(int64(1000), tunables.CopyRowsPerSecond)
+	this.Require().Equal(int64(500), tunables.BinlogRowsPerSecond)
+
+	this.Require().Equal(uint64(500), this.ferry.DataIterator.CursorConfig.SharedBatchSize.Get())
+	rows, _ := this.ferry.CopyRateLimiter.Limits()
+	this.Require().Equal(int64(1000), rows)
+}
+
+func (this *TunablesTestSuite) TestRejectsInvalidTunables() {
+	response := this.post(`{"DataIterationBatchSize": 500, "CopyRowsPerSecond": -1}`)
+	this.Require().Equal(http.StatusBadRequest, response.Code)
+	this.Require().Contains(response.Body.String(), "CopyRowsPerSecond must not be negative")
+	this.Require().Equal(uint64(100), this.ferry.DataIterator.CursorConfig.SharedBatchSize.Get())
+
+	response = this.post(`{"DataIterationBatchSize": "many"}`)
+	this.Require().Equal(http.StatusBadRequest, response.Code)
+}
+
+func (this *TunablesTestSuite) TestBatchSizeCannotChangeWhenAdjusted() {
+	this.ferry.DataIterator.CursorConfig.BatchSizer = &ghostferry.AdaptiveBatchSizer{}
+
+	tunables := this.ferry.Tunables()
+	this.Require().Nil(this.ferry.ApplyTunables(tunables))
+
+	tunables.DataIterationBatchSize = 1000
+	err := this.ferry.ApplyTunables(tunables)
+	this.Require().EqualError(err, "DataIterationBatchSize cannot be changed when the batch sizes are adjusted")
+}
+
+func (this *TunablesTestSuite) TestChangesMaxLagOfThrottlers() {
+	tunables := this.ferry.Tunables()
+	tunables.ThrottleMaxLag = 10
+	err := this.ferry.ApplyTunables(tunables)
+	this.Require().EqualError(err, "ThrottleMaxLag cannot be set as no throttler has a maximum lag")
+
+	throttler := &maxLagThrottler{maxLag: 5}
+	this.ferry.Throttler = throttler
+	this.Require().Equal(5, this.ferry.Tunables().ThrottleMaxLag)
+
+	this.Require().Nil(this.ferry.ApplyTunables(tunables))
+	this.Require().Equal(10, throttler.MaxLag())
+}
+
+func (this *TunablesTestSuite) TestDefaultsOfConfigTunables() {
+	tunables := (&ghostferry.Config{CopyBytesPerSecond: 4096}).Tunables()
+	this.Require().Nil(tunables.Validate())
+	this.Require().Equal(uint64(ghostferry.DefaultDataIterationBatchSize), tunables.DataIterationBatchSize)
+	this.Require().Equal(ghostferry.DefaultDataIterationConcurrency, tunables.DataIterationConcurrency)
+	this.Require().Equal(int64(4096), tunables.CopyBytesPerSecond)
+}
+
+func (this *TunablesTestSuite) post(body string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	this.server.ServeHTTP(response, httptest.NewRequest("POST", "/api/actions/tunables", strings.NewReader(body)))
+	return response
+}
+
+func TestTunablesTestSuite(t *testing.T) {
+	suite.Run(t, new(TunablesTestSuite))
+}
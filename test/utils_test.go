@@ -2,8 +2,10 @@ package test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/siddontang/go-mysql/mysql"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/suite"
 
@@ -65,6 +67,51 @@ func (this *UtilsTestSuite) Test0UnlimitedRetries() {
 	this.Require().Equal(10, called)
 }
 
+func (this *UtilsTestSuite) TestWorkerPoolReportsThePanicsOfTheWorkers() {
+	var mutex sync.Mutex
+	var recovered []interface{}
+
+	pool := &ghostferry.WorkerPool{
+		Concurrency: 2,
+		Process: func(i int) (interface{}, error) {
+			if i == 1 {
+				panic("worker panic")
+			}
+			return nil, nil
+		},
+		ReportPanic: func() {
+			if r := recover(); r != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				recovered = append(recovered, r)
+			}
+		},
+	}
+
+	_, err := pool.Run(2)
+	this.Require().Nil(err)
+	this.Require().Equal([]interface{}{"worker panic"}, recovered)
+}
+
+func (this *UtilsTestSuite) TestCheckBinlogPositionAvailable() {
+	files := []ghostferry.BinlogFile{
+		{Name: "mysql-bin.000005", Size: 1000},
+		{Name: "mysql-bin.000006", Size: 500},
+	}
+
+	this.Require().Nil(ghostferry.CheckBinlogPositionAvailable(files, mysql.Position{Name: "mysql-bin.000005", Pos: 1000}))
+	this.Require().Nil(ghostferry.CheckBinlogPositionAvailable(files, mysql.Position{Name: "mysql-bin.000006", Pos: 4}))
+
+	err := ghostferry.CheckBinlogPositionAvailable(files, mysql.Position{Name: "mysql-bin.000002", Pos: 4})
+	this.Require().EqualError(err, "cannot resume from (mysql-bin.000002, 4), binlogs purged (the oldest binlog of the source is mysql-bin.000005), restart required")
+
+	err = ghostferry.CheckBinlogPositionAvailable(files, mysql.Position{Name: "mysql-bin.000006", Pos: 501})
+	this.Require().EqualError(err, "cannot resume from (mysql-bin.000006, 501), it is past the end of mysql-bin.000006 (500 bytes)")
+
+	err = ghostferry.CheckBinlogPositionAvailable(files, mysql.Position{Name: "other-bin.000001", Pos: 4})
+	this.Require().EqualError(err, "cannot resume from (other-bin.000001, 4), the binlog file does not exist on the source")
+}
+
 func TestUtils(t *testing.T) {
 	testhelpers.SetupTest()
 	suite.Run(t, new(UtilsTestSuite))
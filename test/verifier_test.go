@@ -97,6 +97,30 @@ func (this *ChecksumTableVerifierTestSuite) TestVerifyWithRewrites() {
 	this.AssertVerifierMatched()
 }
 
+func (this *ChecksumTableVerifierTestSuite) TestVerifyConcurrentlyReportsEveryMismatch() {
+	testhelpers.SeedInitialData(this.Ferry.SourceDB, testhelpers.TestSchemaName, "table2", 3)
+	testhelpers.SeedInitialData(this.Ferry.TargetDB, testhelpers.TestSchemaName, testhelpers.TestTable1Name, 1)
+	testhelpers.SeedInitialData(this.Ferry.TargetDB, testhelpers.TestSchemaName, "table2", 1)
+
+	this.verifier.Tables = append(this.verifier.Tables, &schema.Table{
+		Name:   "table2",
+		Schema: testhelpers.TestSchemaName,
+	})
+	this.verifier.Concurrency = 2
+
+	err := this.verifier.StartInBackground()
+	this.Require().Nil(err)
+	this.verifier.Wait()
+	this.AssertVerifierNotMatched()
+
+	result, _ := this.verifier.Result()
+	this.Require().Equal(
+		"data on table `gftest`.`test_table_1` (`gftest`.`test_table_1`) mismatched\n"+
+			"data on table `gftest`.`table2` (`gftest`.`table2`) mismatched",
+		result.Message,
+	)
+}
+
 func (this *ChecksumTableVerifierTestSuite) AssertVerifierMatched() {
 	result, err := this.verifier.Result()
 	this.Require().True(result.IsStarted())
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/siddontang/go-mysql/replication"
+	"github.com/siddontang/go-mysql/schema"
+	"github.com/stretchr/testify/suite"
+)
+
+type VitessDialectTestSuite struct {
+	suite.Suite
+
+	dialect     ghostferry.VitessDialect
+	sourceTable *schema.Table
+	targetTable *schema.Table
+	config      ghostferry.Config
+}
+
+func (this *VitessDialectTestSuite) SetupTest() {
+	this.sourceTable = &schema.Table{Schema: "test_schema", Name: "test_table"}
+	this.sourceTable.AddColumn("id", "bigint(20) unsigned", "", "auto_increment")
+	this.sourceTable.AddColumn("name", "varchar(255)", "", "")
+	this.sourceTable.PKColumns = []int{0}
+
+	this.targetTable = &schema.Table{Schema: "customers", Name: "test_table"}
+
+	this.config = ghostferry.Config{
+		Source:        ghostferry.DatabaseConfig{Host: "source", Port: 3306, User: "ghostferry"},
+		Target:        ghostferry.DatabaseConfig{Host: "vtgate", Port: 15306, User: "ghostferry"},
+		TargetDialect: ghostferry.DialectVitess,
+		MyServerId:    99399,
+		TableFilter:   &testhelpers.TestTableFilter{},
+	}
+}
+
+func (this *VitessDialectTestSuite) TestNewSQLDialect() {
+	dialect, err := ghostferry.NewSQLDialect(ghostferry.DialectVitess)
+	this.Require().Nil(err)
+	this.Require().Equal(ghostferry.VitessDialect{}, dialect)
+}
+
+func (this *VitessDialectTestSuite) TestRowBatchQueryCommitsEveryShardOnItsOwn() {
+	batch := ghostferry.NewRowBatch(this.sourceTable, []ghostferry.RowData{
+		{int64(1), []byte("a")},
+		{int64(2), []byte("b")},
+	}, 0)
+
+	query, args, err := this.dialect.RowBatchQuery(batch, this.targetTable)
+	this.Require().Nil(err)
+	this.Require().Equal("INSERT /*vt+ MULTI_SHARD_AUTOCOMMIT=1 */ IGNORE INTO `customers`.`test_table` (`id`,`name`) VALUES (?,?),(?,?)", query)
+	this.Require().Equal([]interface{}{int64(1), []byte("a"), int64(2), []byte("b")}, args)
+}
+
+func (this *VitessDialectTestSuite) TestEventStatementsAreSingleRowMySQLStatements() {
+	events, err := ghostferry.NewBinlogUpdateEvents(this.sourceTable, &replication.RowsEvent{
+		Rows: [][]interface{}{
+			{uint64(1), "a"},
+			{uint64(1), "b"},
+		},
+	})
+	this.Require().Nil(err)
+
+	statement, err := this.dialect.DMLEventStatement(events[0], this.targetTable)
+	this.Require().Nil(err)
+	this.Require().Equal("UPDATE `customers`.`test_table` SET `id`=1,`name`='b' WHERE `id`=1 AND `name`='a'", statement)
+}
+
+func (this *VitessDialectTestSuite) TestValidatesTargetLikeMySQL() {
+	this.Require().Nil(this.config.ValidateConfig())
+
+	this.config.Target.User = ""
+	this.Require().EqualError(this.config.ValidateConfig(), "target: user is empty")
+}
+
+func (this *VitessDialectTestSuite) TestRejectsCrossShardOptions() {
+	this.config.PreserveSourceTransactions = true
+	this.Require().EqualError(this.config.ValidateConfig(), "PreserveSourceTransactions is not supported with a vitess target")
+
+	this.config.PreserveSourceTransactions = false
+	this.config.StageRowBatches = true
+	this.Require().EqualError(this.config.ValidateConfig(), "StageRowBatches is not supported with a vitess target")
+}
+
+func TestVitessDialectTestSuite(t *testing.T) {
+	suite.Run(t, new(VitessDialectTestSuite))
+}
@@ -1,8 +1,12 @@
 package test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Shopify/ghostferry"
 	"github.com/Shopify/ghostferry/testhelpers"
@@ -75,6 +79,246 @@ func (s *WaitUntilReplicaIsCaughtUpToMasterSuite) TestIsCaughtUpIsCorrect() {
 	s.Require().True(isCaughtUp)
 }
 
+func (s *WaitUntilReplicaIsCaughtUpToMasterSuite) TestWaitTimesOut() {
+	s.w.Timeout = 50 * time.Millisecond
+	s.w.PollInterval = 10 * time.Millisecond
+
+	err := s.w.Wait()
+	s.Require().EqualError(err, "timeout reached before replica is caught up to master")
+}
+
+func (s *WaitUntilReplicaIsCaughtUpToMasterSuite) TestWaitCanBeCancelled() {
+	s.w.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := s.w.WaitContext(ctx)
+	s.Require().Equal(context.DeadlineExceeded, err)
+}
+
+func (s *WaitUntilReplicaIsCaughtUpToMasterSuite) TestWaitReportsProgress() {
+	currentPosition, err := ghostferry.ShowMasterStatusBinlogPosition(s.w.MasterDB)
+	s.Require().Nil(err)
+	s.updateHeartbeatMasterPos(s.w.ReplicaDB, currentPosition)
+
+	progress := []ghostferry.ReplicaProgress{}
+	s.w.ProgressCallback = func(p ghostferry.ReplicaProgress) {
+		progress = append(progress, p)
+	}
+
+	s.Require().Nil(s.w.Wait())
+	s.Require().Equal(1, len(progress))
+	s.Require().Equal(currentPosition, progress[0].ReplicatedMasterPosition)
+	s.Require().Equal(int64(0), progress[0].BinlogBytesBehind)
+}
+
 func TestWaitUntilReplicaIsCaughtUpToMaster(t *testing.T) {
 	suite.Run(t, new(WaitUntilReplicaIsCaughtUpToMasterSuite))
 }
+
+type fakePositionFetcher struct {
+	pos mysql.Position
+	err error
+}
+
+func (f fakePositionFetcher) Current(*sql.DB) (mysql.Position, error) {
+	return f.pos, f.err
+}
+
+type fakeGTIDSetFetcher struct {
+	gtidSet string
+}
+
+func (f fakeGTIDSetFetcher) CurrentGTIDSet(*sql.DB) (mysql.GTIDSet, error) {
+	return mysql.ParseMysqlGTIDSet(f.gtidSet)
+}
+
+type fakeReplicaPool struct {
+	replicas [][]ghostferry.Replica
+	resolved int
+}
+
+func (p *fakeReplicaPool) Replicas() ([]ghostferry.Replica, error) {
+	replicas := p.replicas[p.resolved]
+	if p.resolved < len(p.replicas)-1 {
+		p.resolved++
+	}
+	return replicas, nil
+}
+
+type WaitUntilReplicaQuorumSuite struct {
+	suite.Suite
+
+	target mysql.Position
+	behind ghostferry.ReplicatedMasterPositionFetcher
+	ahead  ghostferry.ReplicatedMasterPositionFetcher
+	broken ghostferry.ReplicatedMasterPositionFetcher
+}
+
+func (s *WaitUntilReplicaQuorumSuite) SetupTest() {
+	s.target = mysql.Position{Name: "mysql-bin.000002", Pos: 100}
+	s.behind = fakePositionFetcher{pos: mysql.Position{Name: "mysql-bin.000002", Pos: 50}}
+	s.ahead = fakePositionFetcher{pos: mysql.Position{Name: "mysql-bin.000002", Pos: 150}}
+	s.broken = fakePositionFetcher{err: errors.New("replica is down")}
+}
+
+// The fetchers are either ReplicatedMasterPositionFetchers or
+// ReplicatedMasterGTIDSetFetchers.
+func (s *WaitUntilReplicaQuorumSuite) waiter(quorum int, fetchers ...interface{}) *ghostferry.WaitUntilReplicaIsCaughtUpToMaster {
+	w := &ghostferry.WaitUntilReplicaIsCaughtUpToMaster{
+		Quorum:       quorum,
+		ReadRetries:  1,
+		PollInterval: time.Millisecond,
+	}
+
+	for i, fetcher := range fetchers {
+		replica := ghostferry.Replica{Name: fmt.Sprintf("replica%d", i)}
+		switch fetcher := fetcher.(type) {
+		case ghostferry.ReplicatedMasterGTIDSetFetcher:
+			replica.ReplicatedMasterGTIDSetFetcher = fetcher
+		case ghostferry.ReplicatedMasterPositionFetcher:
+			replica.ReplicatedMasterPositionFetcher = fetcher
+		}
+		w.Replicas = append(w.Replicas, replica)
+	}
+
+	return w
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestAllReplicasMustCatchUpByDefault() {
+	isCaughtUp, err := s.waiter(0, s.ahead, s.behind).IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().False(isCaughtUp)
+
+	isCaughtUp, err = s.waiter(0, s.ahead, s.ahead).IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().True(isCaughtUp)
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestQuorumOfReplicas() {
+	isCaughtUp, err := s.waiter(2, s.ahead, s.behind, s.ahead).IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().True(isCaughtUp)
+
+	isCaughtUp, err = s.waiter(2, s.ahead, s.behind, s.behind).IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().False(isCaughtUp)
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestQuorumLargerThanReplicasFails() {
+	_, err := s.waiter(3, s.ahead, s.ahead).IsCaughtUp(s.target)
+	s.Require().EqualError(err, "quorum of 3 replicas cannot be reached with 2 replicas")
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestUnreadableReplicasCountAsNotCaughtUp() {
+	isCaughtUp, err := s.waiter(2, s.broken, s.ahead, s.ahead).IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().True(isCaughtUp)
+
+	_, err = s.waiter(2, s.broken, s.broken, s.ahead).IsCaughtUp(s.target)
+	s.Require().EqualError(err, "replica is down")
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestProgressIsReportedPerReplica() {
+	w := s.waiter(0, s.ahead, s.behind)
+
+	progress := []ghostferry.ReplicaProgress{}
+	w.ProgressCallback = func(p ghostferry.ReplicaProgress) {
+		progress = append(progress, p)
+	}
+
+	_, err := w.IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().Equal(2, len(progress))
+	s.Require().Equal("replica0", progress[0].Replica)
+	s.Require().Equal(int64(0), progress[0].BinlogBytesBehind)
+	s.Require().Equal("replica1", progress[1].Replica)
+	s.Require().Equal(int64(50), progress[1].BinlogBytesBehind)
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestReplicasComparedByGTIDSet() {
+	target, err := mysql.ParseMysqlGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-100")
+	s.Require().Nil(err)
+
+	ahead := fakeGTIDSetFetcher{gtidSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-120,\n4a6f3a0e-71ca-11e1-9e33-c80aa9429562:1-5"}
+	behind := fakeGTIDSetFetcher{gtidSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-99"}
+
+	isCaughtUp, err := s.waiter(0, ahead, s.ahead).IsCaughtUpToGTIDSet(s.target, target)
+	s.Require().Nil(err)
+	s.Require().True(isCaughtUp)
+
+	isCaughtUp, err = s.waiter(0, ahead, behind).IsCaughtUpToGTIDSet(s.target, target)
+	s.Require().Nil(err)
+	s.Require().False(isCaughtUp)
+
+	_, err = s.waiter(0, ahead).IsCaughtUpToGTIDSet(s.target, nil)
+	s.Require().EqualError(err, "no master GTID set to compare the replica against")
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestReplicaPoolIsResolvedOnEveryCheck() {
+	w := s.waiter(0)
+	w.ReplicaPool = &fakeReplicaPool{
+		replicas: [][]ghostferry.Replica{
+			{
+				{Name: "10.0.0.1:3306", ReplicatedMasterPositionFetcher: s.ahead},
+				{Name: "10.0.0.2:3306", ReplicatedMasterPositionFetcher: s.behind},
+			},
+			{
+				{Name: "10.0.0.1:3306", ReplicatedMasterPositionFetcher: s.ahead},
+				{Name: "10.0.0.3:3306", ReplicatedMasterPositionFetcher: s.ahead},
+			},
+		},
+	}
+
+	isCaughtUp, err := w.IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().False(isCaughtUp)
+	s.Require().Equal([]ghostferry.ReplicaStatus{
+		{Name: "10.0.0.1:3306", CaughtUp: true},
+		{Name: "10.0.0.2:3306", CaughtUp: false},
+	}, w.ReplicaStatuses())
+
+	isCaughtUp, err = w.IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().True(isCaughtUp)
+	s.Require().Equal([]ghostferry.ReplicaStatus{
+		{Name: "10.0.0.1:3306", CaughtUp: true},
+		{Name: "10.0.0.3:3306", CaughtUp: true},
+	}, w.ReplicaStatuses())
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestStatusOfUnreadableReplicaHasError() {
+	w := s.waiter(1, s.ahead, s.broken)
+
+	isCaughtUp, err := w.IsCaughtUp(s.target)
+	s.Require().Nil(err)
+	s.Require().True(isCaughtUp)
+
+	statuses := w.ReplicaStatuses()
+	s.Require().Equal(2, len(statuses))
+	s.Require().True(statuses[0].CaughtUp)
+	s.Require().False(statuses[1].CaughtUp)
+	s.Require().EqualError(statuses[1].Err, "replica is down")
+}
+
+func TestWaitUntilReplicaQuorum(t *testing.T) {
+	suite.Run(t, new(WaitUntilReplicaQuorumSuite))
+}
+
+func (s *WaitUntilReplicaQuorumSuite) TestTimeoutStopsRetryingTheReads() {
+	masterDB, err := sql.Open("mysql", "root@tcp(127.0.0.1:1)/")
+	s.Require().Nil(err)
+	defer masterDB.Close()
+
+	w := s.waiter(0, s.ahead)
+	w.MasterDB = masterDB
+	w.ReadRetries = 1000
+	w.PollInterval = 10 * time.Millisecond
+	w.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	err = w.Wait()
+	s.Require().EqualError(err, "timeout reached before replica is caught up to master")
+	s.Require().True(time.Since(start) < 5*time.Second)
+}
@@ -0,0 +1,220 @@
+package ghostferry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var throttleScheduleDays = map[string][]time.Weekday{
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"sun":      {time.Sunday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// A time window during which the writes to the target are limited to
+// different rates than the rates of the Config, such as business hours.
+type ThrottleSchedule struct {
+	// The days of the week the window starts on: mon, tue, wed, thu, fri,
+	// sat, sun, weekdays or weekends.
+	//
+	// Optional: defaults to every day.
+	Days []string
+
+	// The start and the end of the window, as HH:MM. The window spans
+	// midnight if it ends before it starts, such as from 22:00 to 06:00.
+	//
+	// Optional: defaults to the whole day.
+	Start string
+	End   string
+
+	// The rate limits during the window, see the same fields of the Config.
+	// A limit of 0 disables the limit.
+	CopyRowsPerSecond    int64
+	CopyBytesPerSecond   int64
+	BinlogRowsPerSecond  int64
+	BinlogBytesPerSecond int64
+
+	days  map[time.Weekday]bool
+	start int
+	end   int
+}
+
+func (s *ThrottleSchedule) Validate() error {
+	s.days = make(map[time.Weekday]bool)
+	for _, day := range s.Days {
+		weekdays, exists := throttleScheduleDays[day]
+		if !exists {
+			return fmt.Errorf("invalid day %s, must be mon, tue, wed, thu, fri, sat, sun, weekdays or weekends", day)
+		}
+
+		for _, weekday := range weekdays {
+			s.days[weekday] = true
+		}
+	}
+
+	if len(s.days) == 0 {
+		for _, weekday := range throttleScheduleDays["weekdays"] {
+			s.days[weekday] = true
+		}
+		for _, weekday := range throttleScheduleDays["weekends"] {
+			s.days[weekday] = true
+		}
+	}
+
+	if (s.Start == "") != (s.End == "") {
+		return fmt.Errorf("Start and End must be set together")
+	}
+
+	var err error
+	s.start, err = parseScheduleTime(s.Start)
+	if err != nil {
+		return fmt.Errorf("invalid Start: %s", err)
+	}
+
+	s.end, err = parseScheduleTime(s.End)
+	if err != nil {
+		return fmt.Errorf("invalid End: %s", err)
+	}
+
+	if s.CopyRowsPerSecond < 0 || s.CopyBytesPerSecond < 0 || s.BinlogRowsPerSecond < 0 || s.BinlogBytesPerSecond < 0 {
+		return fmt.Errorf("the rate limits cannot be negative")
+	}
+
+	return nil
+}
+
+// Returns the minutes since midnight of a HH:MM time, 0 if empty.
+func parseScheduleTime(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a HH:MM time", value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Returns true if the time, in the location of the schedule, is within the
+// window. A window spanning midnight belongs to the day it starts on.
+func (s *ThrottleSchedule) Includes(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+
+	switch {
+	case s.start == s.end:
+		return s.days[t.Weekday()]
+	case s.start < s.end:
+		return s.days[t.Weekday()] && minute >= s.start && minute < s.end
+	default:
+		if minute >= s.start {
+			return s.days[t.Weekday()]
+		}
+		return minute < s.end && s.days[t.AddDate(0, 0, -1).Weekday()]
+	}
+}
+
+func (s *ThrottleSchedule) String() string {
+	window := "all day"
+	if s.Start != "" {
+		window = s.Start + "-" + s.End
+	}
+
+	days := "every day"
+	if len(s.Days) > 0 {
+		days = fmt.Sprintf("%v", s.Days)
+	}
+
+	return days + " " + window
+}
+
+// ThrottleScheduler changes the limits of the rate limiters of the copy and
+// of the binlog writes according to the ThrottleSchedules, so the long runs
+// yield to the traffic of the source and the target during the busy hours.
+// The first schedule including the current time applies, the Default limits
+// apply outside of the schedules.
+//
+// The limits are only changed when another schedule applies, so the limits
+// changed through the ControlServer are kept until the end of the window.
+type ThrottleScheduler struct {
+	Schedules []*ThrottleSchedule
+	Default   ThrottleSchedule
+	Location  *time.Location
+
+	CopyRateLimiter   *RateLimiter
+	BinlogRateLimiter *RateLimiter
+
+	// How often the schedules are evaluated.
+	Interval time.Duration
+
+	logger *logrus.Entry
+	active *ThrottleSchedule
+}
+
+// Returns the schedule applying at the time, or the Default schedule.
+func (s *ThrottleScheduler) Active(now time.Time) *ThrottleSchedule {
+	now = now.In(s.Location)
+	for _, schedule := range s.Schedules {
+		if schedule.Includes(now) {
+			return schedule
+		}
+	}
+
+	return &s.Default
+}
+
+// Applies the limits of the schedule applying at the time, if another
+// schedule applied before.
+func (s *ThrottleScheduler) Apply(now time.Time) {
+	if s.logger == nil {
+		s.logger = logrus.WithField("tag", "throttle_schedule")
+	}
+
+	schedule := s.Active(now)
+	if schedule == s.active {
+		return
+	}
+	s.active = schedule
+
+	s.CopyRateLimiter.SetLimits(schedule.CopyRowsPerSecond, schedule.CopyBytesPerSecond)
+	s.BinlogRateLimiter.SetLimits(schedule.BinlogRowsPerSecond, schedule.BinlogBytesPerSecond)
+
+	scheduleName := "default"
+	if schedule != &s.Default {
+		scheduleName = schedule.String()
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"schedule":             scheduleName,
+		"copyRowsPerSecond":    schedule.CopyRowsPerSecond,
+		"copyBytesPerSecond":   schedule.CopyBytesPerSecond,
+		"binlogRowsPerSecond":  schedule.BinlogRowsPerSecond,
+		"binlogBytesPerSecond": schedule.BinlogBytesPerSecond,
+	}).Info("applying the rate limits of the throttle schedule")
+}
+
+func (s *ThrottleScheduler) Run(ctx context.Context) error {
+	s.Apply(time.Now())
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			s.Apply(now)
+		}
+	}
+}
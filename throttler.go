@@ -85,6 +85,7 @@ type LagThrottler struct {
 
 	DB       *sql.DB
 	lag      int
+	maxLag   int64
 	logger   *logrus.Entry
 	interval time.Duration
 }
@@ -119,6 +120,7 @@ func NewLagThrottler(config *LagThrottlerConfig) (*LagThrottler, error) {
 
 	return &LagThrottler{
 		config:   config,
+		maxLag:   int64(config.MaxLag),
 		DB:       db,
 		logger:   logger,
 		interval: interval,
@@ -126,7 +128,16 @@ func NewLagThrottler(config *LagThrottlerConfig) (*LagThrottler, error) {
 }
 
 func (t *LagThrottler) Throttled() bool {
-	return t.PauserThrottler.Throttled() || t.lag > t.config.MaxLag
+	return t.PauserThrottler.Throttled() || t.lag > t.MaxLag()
+}
+
+func (t *LagThrottler) MaxLag() int {
+	return int(atomic.LoadInt64(&t.maxLag))
+}
+
+// Changes the lag above which the throttler throttles, see MaxLagThrottler.
+func (t *LagThrottler) SetMaxLag(maxLag int) {
+	atomic.StoreInt64(&t.maxLag, int64(maxLag))
 }
 
 func (t *LagThrottler) Run(ctx context.Context) error {
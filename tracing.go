@@ -0,0 +1,412 @@
+package ghostferry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The tracer the spans are sent to, nil unless InitializeTracing was called.
+var tracer *Tracer
+
+// TracingConfig configures the export of the spans of a run to an
+// OpenTelemetry collector, with the OTLP/HTTP protocol in JSON. The steps
+// timed by the metrics, such as the batches written by the DataIterator and
+// the BinlogWriter, the batches fingerprinted by the IterativeVerifier and
+// the steps of the cutover, are traced as children of a span covering the
+// whole run.
+//
+// The options default to the standard OpenTelemetry environment variables.
+// If TRACEPARENT is set, as a W3C trace context, the run is traced as a
+// child of that span, so the run appears in the trace of the deployment
+// that started it.
+type TracingConfig struct {
+	// The base URL of the collector, to which /v1/traces is appended.
+	//
+	// Required, unless either OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, used as
+	// is, or OTEL_EXPORTER_OTLP_ENDPOINT is set.
+	Endpoint string
+
+	// Optional: defaults to OTEL_SERVICE_NAME, or the name of the
+	// application, such as ghostferry-copydb.
+	ServiceName string
+
+	// The headers of the requests to the collector, such as the credentials.
+	//
+	// Optional: defaults to the key=value pairs, separated by commas, of
+	// OTEL_EXPORTER_OTLP_HEADERS.
+	Headers map[string]string
+
+	// How often the spans are sent to the collector.
+	//
+	// Optional: defaults to 5s.
+	FlushInterval string
+}
+
+func (c *TracingConfig) initialize(serviceName string) error {
+	if c.Endpoint == "" {
+		if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+			c.Endpoint = endpoint
+		} else if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+			c.Endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+		}
+	} else {
+		c.Endpoint = strings.TrimSuffix(c.Endpoint, "/") + "/v1/traces"
+	}
+
+	if c.Endpoint == "" {
+		return fmt.Errorf("Endpoint is required")
+	}
+
+	if c.ServiceName == "" {
+		c.ServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = serviceName
+	}
+
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+		for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+			parts := strings.SplitN(header, "=", 2)
+			if len(parts) == 2 {
+				c.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	if c.FlushInterval == "" {
+		c.FlushInterval = "5s"
+	}
+
+	_, err := time.ParseDuration(c.FlushInterval)
+	if err != nil {
+		return fmt.Errorf("invalid FlushInterval: %v", err)
+	}
+
+	return nil
+}
+
+// Span is a timed step of the run. The methods of a nil Span do nothing, so
+// the spans can be started whether tracing is enabled or not.
+type Span struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   []MetricTag
+	Err          error
+
+	tracer *Tracer
+}
+
+// Starts a child span of the span.
+func (s *Span) StartChild(name string, attributes []MetricTag) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return &Span{
+		Name:         name,
+		TraceID:      s.TraceID,
+		SpanID:       newSpanID(),
+		ParentSpanID: s.SpanID,
+		StartTime:    time.Now(),
+		Attributes:   attributes,
+		tracer:       s.tracer,
+	}
+}
+
+// Ends the span, marking it as failed if the error is not nil, and sends it.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.EndTime = time.Now()
+	s.Err = err
+	s.tracer.send(s)
+}
+
+// Starts a span of the run, or returns nil if tracing is not enabled.
+func StartSpan(name string, attributes []MetricTag) *Span {
+	t := tracer
+	if t == nil {
+		return nil
+	}
+
+	return t.root.StartChild(name, attributes)
+}
+
+// Runs the function in a span of the run.
+func Trace(name string, attributes []MetricTag, f func() error) error {
+	span := StartSpan(name, attributes)
+	err := f()
+	span.End(err)
+	return err
+}
+
+// Tracer batches the ended spans and sends them to the collector.
+type Tracer struct {
+	config *TracingConfig
+	root   *Span
+
+	spans    chan *Span
+	client   *http.Client
+	interval time.Duration
+	logger   *logrus.Entry
+
+	wg sync.WaitGroup
+}
+
+// Traces the steps of the run until StopAndFlushTracing is called.
+func InitializeTracing(serviceName string, config *TracingConfig) (*Tracer, error) {
+	err := config.initialize(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	interval, _ := time.ParseDuration(config.FlushInterval)
+	t := &Tracer{
+		config:   config,
+		spans:    make(chan *Span, 1024),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: interval,
+		logger:   logrus.WithField("tag", "tracing"),
+	}
+
+	t.root = &Span{
+		Name:      config.ServiceName,
+		TraceID:   newTraceID(),
+		SpanID:    newSpanID(),
+		StartTime: time.Now(),
+		Attributes: []MetricTag{
+			{"ghostferry.version", VersionString},
+		},
+		tracer: t,
+	}
+
+	if traceID, parentSpanID, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		t.root.TraceID = traceID
+		t.root.ParentSpanID = parentSpanID
+	}
+
+	t.wg.Add(1)
+	go t.run()
+
+	tracer = t
+	return t, nil
+}
+
+// Ends the span of the run and sends the spans still buffered. The spans
+// started afterwards are discarded.
+func StopAndFlushTracing() {
+	t := tracer
+	if t == nil {
+		return
+	}
+
+	t.root.End(nil)
+	tracer = nil
+	close(t.spans)
+	t.wg.Wait()
+}
+
+func (t *Tracer) send(span *Span) {
+	defer func() {
+		// The tracer was stopped while the span was running.
+		recover()
+	}()
+
+	select {
+	case t.spans <- span:
+	default:
+		t.logger.WithField("span", span.Name).Warn("tracing buffer full, dropping span")
+	}
+}
+
+func (t *Tracer) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case span, ok := <-t.spans:
+			if !ok {
+				t.export(batch)
+				return
+			}
+
+			batch = append(batch, span)
+			if len(batch) >= 512 {
+				t.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.export(batch)
+			batch = nil
+		}
+	}
+}
+
+func (t *Tracer) export(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(t.otlpRequest(spans))
+	if err != nil {
+		t.logger.WithError(err).Error("failed to encode spans")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request, err := http.NewRequest("POST", t.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		t.logger.WithError(err).Error("failed to create request")
+		return
+	}
+	request = request.WithContext(ctx)
+
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range t.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		t.logger.WithError(err).WithField("spans", len(spans)).Warn("failed to export spans")
+		return
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		t.logger.WithFields(logrus.Fields{
+			"spans":  len(spans),
+			"status": response.StatusCode,
+		}).Warn("collector rejected spans")
+	}
+}
+
+// The ExportTraceServiceRequest of OTLP, in its JSON encoding.
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func newOtlpAttributes(tags []MetricTag) []otlpAttribute {
+	attributes := make([]otlpAttribute, len(tags))
+	for i, tag := range tags {
+		attributes[i].Key = tag.Name
+		attributes[i].Value.StringValue = tag.Value
+	}
+	return attributes
+}
+
+func (t *Tracer) otlpRequest(spans []*Span) interface{} {
+	otlpSpans := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		otlpSpans[i] = otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              1, // SPAN_KIND_INTERNAL
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        newOtlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: 1}, // STATUS_CODE_OK
+		}
+
+		if span.Err != nil {
+			otlpSpans[i].Status = otlpStatus{Code: 2, Message: span.Err.Error()} // STATUS_CODE_ERROR
+		}
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": newOtlpAttributes([]MetricTag{{"service.name", t.config.ServiceName}}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{
+							"name":    "github.com/Shopify/ghostferry",
+							"version": VersionString,
+						},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Parses a W3C traceparent header, such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(traceparent string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+			return "", "", false
+		}
+	}
+
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), true
+}
+
+func newTraceID() string {
+	return randomHex(16)
+}
+
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,185 @@
+package ghostferry
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultDataIterationBatchSize   = 200
+	DefaultDataIterationConcurrency = 4
+)
+
+// TunableConfig holds the settings of the Config that can be changed while
+// the ferry runs, through Ferry.ApplyTunables, so a run of several days can
+// be sped up or slowed down without being restarted and losing its progress.
+// The ControlServer changes them under /api/actions/tunables and the copydb
+// command reloads them from its config file on SIGHUP.
+type TunableConfig struct {
+	// The number of rows selected per batch, from the next batch of each
+	// table. The tables of DataIterationTableBatchSizes keep their batch
+	// size. Cannot be changed when the batch sizes are adjusted, see
+	// DataIterationTargetBatchDuration.
+	//
+	// Optional: defaults to 200.
+	DataIterationBatchSize uint64
+
+	// The number of batches copied at the same time. A table copies a
+	// single batch at a time, so no more batches than tables being copied,
+	// see DataIterationTableConcurrency, are copied at the same time.
+	//
+	// Optional: defaults to 4.
+	DataIterationConcurrency int
+
+	// The limits of the rate limiters, see Config.CopyRowsPerSecond. The
+	// ThrottleSchedules replace them once another schedule applies.
+	//
+	// Optional: defaults to no limit.
+	CopyRowsPerSecond    int64
+	CopyBytesPerSecond   int64
+	BinlogRowsPerSecond  int64
+	BinlogBytesPerSecond int64
+
+	// The replication lag in seconds above which the throttlers implementing
+	// MaxLagThrottler, such as the LagThrottler, throttle.
+	//
+	// Optional: defaults to 0, which leaves the throttlers unchanged.
+	ThrottleMaxLag int
+}
+
+func (t *TunableConfig) Validate() error {
+	if t.DataIterationBatchSize == 0 {
+		t.DataIterationBatchSize = DefaultDataIterationBatchSize
+	}
+
+	if t.DataIterationConcurrency == 0 {
+		t.DataIterationConcurrency = DefaultDataIterationConcurrency
+	}
+
+	if t.DataIterationConcurrency < 0 {
+		return fmt.Errorf("DataIterationConcurrency must not be negative")
+	}
+
+	for name, limit := range map[string]int64{
+		"CopyRowsPerSecond":    t.CopyRowsPerSecond,
+		"CopyBytesPerSecond":   t.CopyBytesPerSecond,
+		"BinlogRowsPerSecond":  t.BinlogRowsPerSecond,
+		"BinlogBytesPerSecond": t.BinlogBytesPerSecond,
+	} {
+		if limit < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if t.ThrottleMaxLag < 0 {
+		return fmt.Errorf("ThrottleMaxLag must not be negative")
+	}
+
+	return nil
+}
+
+// Returns the tunable settings of the config.
+func (c *Config) Tunables() TunableConfig {
+	return TunableConfig{
+		DataIterationBatchSize:   c.DataIterationBatchSize,
+		DataIterationConcurrency: c.DataIterationConcurrency,
+		CopyRowsPerSecond:        c.CopyRowsPerSecond,
+		CopyBytesPerSecond:       c.CopyBytesPerSecond,
+		BinlogRowsPerSecond:      c.BinlogRowsPerSecond,
+		BinlogBytesPerSecond:     c.BinlogBytesPerSecond,
+	}
+}
+
+// Implemented by the throttlers throttling above a maximum replication lag
+// that can be changed while they run.
+type MaxLagThrottler interface {
+	MaxLag() int
+	SetMaxLag(maxLag int)
+}
+
+// The batch size shared by the cursors of a DataIterator, which can be
+// changed while they iterate.
+type SharedBatchSize struct {
+	size uint64
+}
+
+func NewSharedBatchSize(size uint64) *SharedBatchSize {
+	return &SharedBatchSize{size: size}
+}
+
+func (s *SharedBatchSize) Get() uint64 {
+	return atomic.LoadUint64(&s.size)
+}
+
+func (s *SharedBatchSize) Set(size uint64) {
+	atomic.StoreUint64(&s.size, size)
+}
+
+// Returns the tunable settings in use.
+func (f *Ferry) Tunables() TunableConfig {
+	tunables := TunableConfig{
+		DataIterationBatchSize:   f.DataIterator.CursorConfig.SharedBatchSize.Get(),
+		DataIterationConcurrency: f.DataIterator.Scheduler.Concurrency(),
+	}
+
+	tunables.CopyRowsPerSecond, tunables.CopyBytesPerSecond = f.CopyRateLimiter.Limits()
+	tunables.BinlogRowsPerSecond, tunables.BinlogBytesPerSecond = f.BinlogRateLimiter.Limits()
+
+	for _, throttler := range f.throttlers() {
+		if lagThrottler, ok := throttler.(MaxLagThrottler); ok {
+			tunables.ThrottleMaxLag = lagThrottler.MaxLag()
+			break
+		}
+	}
+
+	return tunables
+}
+
+// Changes the tunable settings of the running ferry. Nothing is changed if
+// the settings are invalid.
+func (f *Ferry) ApplyTunables(tunables TunableConfig) error {
+	err := tunables.Validate()
+	if err != nil {
+		return err
+	}
+
+	batchSize := f.DataIterator.CursorConfig.SharedBatchSize
+	if f.DataIterator.CursorConfig.BatchSizer != nil && tunables.DataIterationBatchSize != batchSize.Get() {
+		return fmt.Errorf("DataIterationBatchSize cannot be changed when the batch sizes are adjusted")
+	}
+
+	var lagThrottlers []MaxLagThrottler
+	if tunables.ThrottleMaxLag > 0 {
+		for _, throttler := range f.throttlers() {
+			if lagThrottler, ok := throttler.(MaxLagThrottler); ok {
+				lagThrottlers = append(lagThrottlers, lagThrottler)
+			}
+		}
+
+		if len(lagThrottlers) == 0 {
+			return fmt.Errorf("ThrottleMaxLag cannot be set as no throttler has a maximum lag")
+		}
+	}
+
+	batchSize.Set(tunables.DataIterationBatchSize)
+	f.DataIterator.Scheduler.SetConcurrency(tunables.DataIterationConcurrency)
+	f.CopyRateLimiter.SetLimits(tunables.CopyRowsPerSecond, tunables.CopyBytesPerSecond)
+	f.BinlogRateLimiter.SetLimits(tunables.BinlogRowsPerSecond, tunables.BinlogBytesPerSecond)
+	for _, lagThrottler := range lagThrottlers {
+		lagThrottler.SetMaxLag(tunables.ThrottleMaxLag)
+	}
+
+	logrus.WithField("tag", "tunables").WithFields(logrus.Fields{
+		"batchSize":            tunables.DataIterationBatchSize,
+		"concurrency":          tunables.DataIterationConcurrency,
+		"copyRowsPerSecond":    tunables.CopyRowsPerSecond,
+		"copyBytesPerSecond":   tunables.CopyBytesPerSecond,
+		"binlogRowsPerSecond":  tunables.BinlogRowsPerSecond,
+		"binlogBytesPerSecond": tunables.BinlogBytesPerSecond,
+		"maxLag":               tunables.ThrottleMaxLag,
+	}).Info("applied tunable config")
+
+	return nil
+}
@@ -54,6 +54,34 @@ func WithRetriesContext(ctx context.Context, maxRetries int, sleep time.Duration
 	return
 }
 
+// Same as WithRetries, but the sleep between the attempts doubles after every
+// attempt, up to maxSleep.
+func WithBackoffRetries(maxRetries int, sleep, maxSleep time.Duration, logger *logrus.Entry, verb string, f func() error) (err error) {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	for try := 1; ; try++ {
+		err = f()
+		if err == nil {
+			return nil
+		}
+
+		if maxRetries != 0 && try >= maxRetries {
+			logger.WithError(err).Errorf("failed to %s after %d attempts, retry limit exceeded", verb, try)
+			return err
+		}
+
+		logger.WithError(err).Errorf("failed to %s, %d of %d max retries, retrying in %s", verb, try, maxRetries, sleep)
+		time.Sleep(sleep)
+
+		sleep *= 2
+		if sleep > maxSleep {
+			sleep = maxSleep
+		}
+	}
+}
+
 func randomServerId() uint32 {
 	var buf [4]byte
 	if _, err := rand.Read(buf[:]); err != nil {
@@ -81,6 +109,10 @@ func (a *AtomicBoolean) Get() bool {
 type WorkerPool struct {
 	Concurrency int
 	Process     func(int) (interface{}, error)
+
+	// If set, deferred in the workers, such as Ferry.ReportPanic, so the
+	// panics of the workers are reported.
+	ReportPanic func()
 }
 
 // Returns a list of results of the size same as the concurrency number.
@@ -91,12 +123,18 @@ func (p *WorkerPool) Run(n int) ([]interface{}, error) {
 	errCh := make(chan error, p.Concurrency)
 	workQueue := make(chan int)
 
+	reportPanic := p.ReportPanic
+	if reportPanic == nil {
+		reportPanic = func() {}
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(p.Concurrency)
 
 	for j := 0; j < p.Concurrency; j++ {
 		go func(j int) {
 			defer wg.Done()
+			defer reportPanic()
 
 			for workIndex := range workQueue {
 				result, err := p.Process(workIndex)
@@ -152,6 +190,66 @@ func ShowMasterStatusBinlogPosition(db *sql.DB) (mysql.Position, error) {
 	return NewMysqlPosition(file, position, err)
 }
 
+// A binlog file of a server, as listed by SHOW BINARY LOGS.
+type BinlogFile struct {
+	Name string
+	Size uint64
+}
+
+// Returns the binlog files of the server, oldest first.
+func ShowBinaryLogs(db *sql.DB) ([]BinlogFile, error) {
+	rows, err := db.Query("SHOW BINARY LOGS")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// MySQL 8.0 added an Encrypted column.
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []BinlogFile
+	for rows.Next() {
+		var file BinlogFile
+		values := make([]interface{}, len(columns))
+		values[0] = &file.Name
+		values[1] = &file.Size
+		for i := 2; i < len(values); i++ {
+			values[i] = new(sql.RawBytes)
+		}
+
+		err = rows.Scan(values...)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// Returns an error if the position is not in the binlog files anymore, as
+// the binlog streaming cannot resume from it. Resuming from the next
+// available position would silently skip the purged events.
+func CheckBinlogPositionAvailable(files []BinlogFile, pos mysql.Position) error {
+	for _, file := range files {
+		if file.Name == pos.Name {
+			if uint64(pos.Pos) > file.Size {
+				return fmt.Errorf("cannot resume from %s, it is past the end of %s (%d bytes)", pos, file.Name, file.Size)
+			}
+			return nil
+		}
+	}
+
+	if len(files) > 0 && pos.Name < files[0].Name {
+		return fmt.Errorf("cannot resume from %s, binlogs purged (the oldest binlog of the source is %s), restart required", pos, files[0].Name)
+	}
+
+	return fmt.Errorf("cannot resume from %s, the binlog file does not exist on the source", pos)
+}
+
 func NewMysqlPosition(file string, position uint32, err error) (mysql.Position, error) {
 	switch {
 	case err == sql.ErrNoRows:
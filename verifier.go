@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +21,9 @@ func (e IncompleteVerificationError) Error() string {
 type VerificationResult struct {
 	DataCorrect bool
 	Message     string
+
+	// The number of rows found mismatched, if the verifier counts them.
+	MismatchedRows int64
 }
 
 func (e VerificationResult) Error() string {
@@ -66,9 +70,9 @@ type Verifier interface {
 	//
 	// If the verification has been completed successfully (without errors) and
 	// the data checks out to be "correct", the result will be
-	// VerificationResult{true, ""}, with error = nil.
-	// Otherwise, the result will be VerificationResult{false, "message"}, with
-	// error = nil.
+	// VerificationResult{DataCorrect: true}, with error = nil.
+	// Otherwise, the result will be VerificationResult{DataCorrect: false,
+	// Message: "message"}, with error = nil.
 	//
 	// If the verification is "done" but experienced an error during the check,
 	// the result will be VerificationResult{}, with err = yourErr.
@@ -82,6 +86,14 @@ type ChecksumTableVerifier struct {
 	SourceDB         *sql.DB
 	TargetDB         *sql.DB
 
+	// The number of tables checksummed at the same time, on both the source
+	// and the target, so that the verification of hundreds of tables does
+	// not take most of the cutover. Each table is still checksummed with a
+	// single query, which locks it for its duration.
+	//
+	// Optional: defaults to 1.
+	Concurrency int
+
 	started *AtomicBoolean
 
 	verificationResultAndStatus VerificationResultAndStatus
@@ -96,75 +108,124 @@ func (v *ChecksumTableVerifier) Verify() (VerificationResult, error) {
 		v.logger = logrus.WithField("tag", "checksum_verifier")
 	}
 
-	for _, table := range v.Tables {
-		sourceTable := QuotedTableName(table)
+	concurrency := v.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(v.Tables) {
+		concurrency = len(v.Tables)
+	}
 
-		targetDbName := table.Schema
-		if v.DatabaseRewrites != nil {
-			if rewrittenName, exists := v.DatabaseRewrites[table.Schema]; exists {
-				targetDbName = rewrittenName
-			}
-		}
+	if concurrency == 0 {
+		return VerificationResult{DataCorrect: true}, nil
+	}
 
-		targetTableName := table.Name
-		if v.TableRewrites != nil {
-			if rewrittenName, exists := v.TableRewrites[table.Name]; exists {
-				targetTableName = rewrittenName
-			}
-		}
+	// The mismatches are reported in the order of the tables, whichever
+	// finishes first.
+	mismatches := make([]string, len(v.Tables))
+	pool := &WorkerPool{
+		Concurrency: concurrency,
+		Process: func(tableIndex int) (interface{}, error) {
+			var err error
+			mismatches[tableIndex], err = v.verifyTable(v.Tables[tableIndex])
+			return nil, err
+		},
+	}
 
-		targetTable := QuotedTableNameFromString(targetDbName, targetTableName)
-
-		logWithTable := v.logger.WithFields(logrus.Fields{
-			"sourceTable": sourceTable,
-			"targetTable": targetTable,
-		})
-		logWithTable.Info("checking table")
-
-		wg := sync.WaitGroup{}
-		var sourceChecksum, targetChecksum int64
-		var sourceErr, targetErr error
-
-		wg.Add(2)
-		go func() {
-			defer wg.Done()
-			query := fmt.Sprintf("CHECKSUM TABLE %s EXTENDED", sourceTable)
-			sourceRow := v.SourceDB.QueryRow(query)
-			sourceChecksum, sourceErr = v.fetchChecksumValueFromRow(sourceRow)
-		}()
-
-		go func() {
-			defer wg.Done()
-			query := fmt.Sprintf("CHECKSUM TABLE %s EXTENDED", targetTable)
-			targetRow := v.TargetDB.QueryRow(query)
-			targetChecksum, targetErr = v.fetchChecksumValueFromRow(targetRow)
-		}()
-		wg.Wait()
-
-		if sourceErr != nil {
-			logWithTable.WithError(sourceErr).Error("failed to checksum table on the source")
-			return VerificationResult{}, sourceErr
-		}
+	_, err := pool.Run(len(v.Tables))
+	if err != nil {
+		return VerificationResult{}, err
+	}
 
-		if targetErr != nil {
-			logWithTable.WithError(targetErr).Error("failed to checksum table on the target")
-			return VerificationResult{}, targetErr
+	var messages []string
+	for _, mismatch := range mismatches {
+		if mismatch != "" {
+			messages = append(messages, mismatch)
 		}
+	}
+
+	if len(messages) > 0 {
+		return VerificationResult{DataCorrect: false, Message: strings.Join(messages, "\n")}, nil
+	}
 
-		logFields := logrus.Fields{
-			"sourceChecksum": sourceChecksum,
-			"targetChecksum": targetChecksum,
+	return VerificationResult{DataCorrect: true}, nil
+}
+
+// Checksums the table on the source and the target at the same time,
+// returning a message if they do not match.
+func (v *ChecksumTableVerifier) verifyTable(table *schema.Table) (string, error) {
+	sourceTable := QuotedTableName(table)
+
+	targetDbName := table.Schema
+	if v.DatabaseRewrites != nil {
+		if rewrittenName, exists := v.DatabaseRewrites[table.Schema]; exists {
+			targetDbName = rewrittenName
 		}
+	}
 
-		if sourceChecksum == targetChecksum {
-			logWithTable.WithFields(logFields).Info("tables on source and target verified to match")
-		} else {
-			logWithTable.WithFields(logFields).Error("tables on source and target DOES NOT MATCH")
-			return VerificationResult{false, fmt.Sprintf("data on table %s (%s) mismatched", sourceTable, targetTable)}, nil
+	targetTableName := table.Name
+	if v.TableRewrites != nil {
+		if rewrittenName, exists := v.TableRewrites[table.Name]; exists {
+			targetTableName = rewrittenName
 		}
 	}
 
-	return VerificationResult{true, ""}, nil
+	targetTable := QuotedTableNameFromString(targetDbName, targetTableName)
+
+	logWithTable := v.logger.WithFields(logrus.Fields{
+		"sourceTable": sourceTable,
+		"targetTable": targetTable,
+	})
+	logWithTable.Info("checking table")
+
+	start := time.Now()
+
+	wg := sync.WaitGroup{}
+	var sourceChecksum, targetChecksum int64
+	var sourceErr, targetErr error
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		query := fmt.Sprintf("CHECKSUM TABLE %s EXTENDED", sourceTable)
+		sourceRow := v.SourceDB.QueryRow(query)
+		sourceChecksum, sourceErr = v.fetchChecksumValueFromRow(sourceRow)
+	}()
+
+	go func() {
+		defer wg.Done()
+		query := fmt.Sprintf("CHECKSUM TABLE %s EXTENDED", targetTable)
+		targetRow := v.TargetDB.QueryRow(query)
+		targetChecksum, targetErr = v.fetchChecksumValueFromRow(targetRow)
+	}()
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	metrics.Timer("ChecksumTableVerifier.TableTime", elapsed, []MetricTag{{"table", table.Name}}, 1.0)
+
+	if sourceErr != nil {
+		logWithTable.WithError(sourceErr).Error("failed to checksum table on the source")
+		return "", sourceErr
+	}
+
+	if targetErr != nil {
+		logWithTable.WithError(targetErr).Error("failed to checksum table on the target")
+		return "", targetErr
+	}
+
+	logFields := logrus.Fields{
+		"sourceChecksum": sourceChecksum,
+		"targetChecksum": targetChecksum,
+		"elapsed":        elapsed,
+	}
+
+	if sourceChecksum != targetChecksum {
+		logWithTable.WithFields(logFields).Error("tables on source and target DOES NOT MATCH")
+		return fmt.Sprintf("data on table %s (%s) mismatched", sourceTable, targetTable), nil
+	}
+
+	logWithTable.WithFields(logFields).Info("tables on source and target verified to match")
+	return "", nil
 }
 
 func (v *ChecksumTableVerifier) fetchChecksumValueFromRow(row *sql.Row) (int64, error) {
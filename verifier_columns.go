@@ -0,0 +1,96 @@
+package ghostferry
+
+import (
+	"fmt"
+
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// Validates that the columns ignored by the verifiers exist and are not
+// primary key columns, as the rows are matched by their primary key. See
+// Config.VerifierIgnoredColumns.
+func validateVerifierIgnoredColumns(tables TableSchemaCache, ignoredColumns map[string][]string) error {
+	for tableName, columns := range ignoredColumns {
+		table, exists := tables[tableName]
+		if !exists {
+			continue
+		}
+
+		for _, column := range columns {
+			index := table.FindColumn(column)
+			if index < 0 {
+				return fmt.Errorf("column %s of %s is ignored by the verifier but does not exist", column, tableName)
+			}
+
+			for _, pkIndex := range table.PKColumns {
+				if pkIndex == index {
+					return fmt.Errorf("primary key column %s of %s cannot be ignored by the verifier", column, tableName)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func isIgnoredColumn(table *schema.Table, column string, ignoredColumns map[string][]string) bool {
+	for _, ignored := range ignoredColumns[table.String()] {
+		if ignored == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the columns without the columns ignored for the table.
+func withoutIgnoredColumns(table *schema.Table, columns []schema.TableColumn, ignoredColumns map[string][]string) []schema.TableColumn {
+	if len(ignoredColumns[table.String()]) == 0 {
+		return columns
+	}
+
+	verified := make([]schema.TableColumn, 0, len(columns))
+	for _, column := range columns {
+		if !isIgnoredColumn(table, column.Name, ignoredColumns) {
+			verified = append(verified, column)
+		}
+	}
+	return verified
+}
+
+// Returns the columns without the columns of the table with the given
+// indexes.
+func withoutColumnIndexes(table *schema.Table, columns []schema.TableColumn, indexes []int) []schema.TableColumn {
+	if len(indexes) == 0 {
+		return columns
+	}
+
+	excluded := make(map[string]bool, len(indexes))
+	for _, i := range indexes {
+		excluded[table.Columns[i].Name] = true
+	}
+
+	remaining := make([]schema.TableColumn, 0, len(columns))
+	for _, column := range columns {
+		if !excluded[column.Name] {
+			remaining = append(remaining, column)
+		}
+	}
+	return remaining
+}
+
+// Returns the codecs of the columns of the table, see tableColumnCodecs,
+// without the codecs of the columns ignored for the table.
+func verifiedColumnCodecs(table *schema.Table, ignoredColumns map[string][]string) map[int]ColumnCodec {
+	codecs := tableColumnCodecs(table)
+	for i := range codecs {
+		if isIgnoredColumn(table, table.Columns[i].Name, ignoredColumns) {
+			delete(codecs, i)
+		}
+	}
+
+	if len(codecs) == 0 {
+		return nil
+	}
+	return codecs
+}
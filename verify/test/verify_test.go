@@ -0,0 +1,105 @@
+package test
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/ghostferry/copydb"
+	"github.com/Shopify/ghostferry/testhelpers"
+	"github.com/Shopify/ghostferry/verify"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	testSchemaName = "gftest"
+	testTableName  = "test_table_1"
+)
+
+type VerifyTestSuite struct {
+	suite.Suite
+	config *copydb.Config
+}
+
+func (t *VerifyTestSuite) SetupTest() {
+	t.config = &copydb.Config{
+		Config: testhelpers.NewTestConfig(),
+		Databases: copydb.FilterAndRewriteConfigs{
+			Whitelist: []string{testSchemaName},
+		},
+		Tables: copydb.FilterAndRewriteConfigs{
+			Whitelist: []string{testTableName},
+		},
+
+		VerifierType: copydb.VerifierTypeChecksumTable,
+	}
+
+	// TODO: remove this hack
+	t.config.WebBasedir = "../.."
+	t.config.ServerBindAddr = "127.0.0.1:0"
+}
+
+func (t *VerifyTestSuite) newVerifyFerry() *verify.VerifyFerry {
+	t.Require().Nil(t.config.InitializeAndValidateConfig())
+
+	verifyFerry := verify.NewFerry(t.config)
+	t.Require().Nil(verifyFerry.Initialize())
+	return verifyFerry
+}
+
+func (t *VerifyTestSuite) TearDownTest() {
+	ferry := t.newVerifyFerry().Ferry
+
+	for _, db := range []*sql.DB{ferry.SourceDB, ferry.TargetDB} {
+		_, err := db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", testSchemaName))
+		t.Require().Nil(err)
+	}
+}
+
+func (t *VerifyTestSuite) TestRejectsNoVerification() {
+	t.config.VerifierType = copydb.VerifierTypeNoVerification
+	t.Require().Nil(t.config.InitializeAndValidateConfig())
+
+	err := verify.NewFerry(t.config).Initialize()
+	t.Require().EqualError(err, "the NoVerification VerifierType cannot be used to verify")
+}
+
+func (t *VerifyTestSuite) TestVerifiesTargetCopiedByAnotherTool() {
+	verifyFerry := t.newVerifyFerry()
+	ferry := verifyFerry.Ferry
+
+	testhelpers.SeedInitialData(ferry.SourceDB, testSchemaName, testTableName, 10)
+	testhelpers.SeedInitialData(ferry.TargetDB, testSchemaName, testTableName, 0)
+
+	// Copy the rows as another tool would.
+	rows, err := ferry.SourceDB.Query(fmt.Sprintf("SELECT id, data FROM `%s`.`%s`", testSchemaName, testTableName))
+	t.Require().Nil(err)
+	for rows.Next() {
+		var id int64
+		var data string
+		t.Require().Nil(rows.Scan(&id, &data))
+
+		_, err = ferry.TargetDB.Exec(fmt.Sprintf("INSERT INTO `%s`.`%s` (id, data) VALUES (?, ?)", testSchemaName, testTableName), id, data)
+		t.Require().Nil(err)
+	}
+	t.Require().Nil(rows.Close())
+
+	t.Require().Nil(verifyFerry.Start())
+	result, err := verifyFerry.Run()
+	t.Require().Nil(err)
+	t.Require().True(result.DataCorrect)
+
+	_, err = ferry.TargetDB.Exec(fmt.Sprintf("UPDATE `%s`.`%s` SET data = 'changed' WHERE id = 1", testSchemaName, testTableName))
+	t.Require().Nil(err)
+
+	verifyFerry = t.newVerifyFerry()
+	t.Require().Nil(verifyFerry.Start())
+	result, err = verifyFerry.Run()
+	t.Require().Nil(err)
+	t.Require().False(result.DataCorrect)
+}
+
+func TestVerifyTestSuite(t *testing.T) {
+	testhelpers.SetupTest()
+	suite.Run(t, new(VerifyTestSuite))
+}
@@ -0,0 +1,151 @@
+package verify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/ghostferry"
+	"github.com/Shopify/ghostferry/copydb"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyFerry only verifies that the target matches the source, without
+// copying anything, so the targets copied by other tools can be validated as
+// well. It is configured like copydb, with the databases and tables to
+// verify and their rewrites.
+//
+// With the Iterative VerifierType, the tables are verified while the source
+// is live, and the rows changed in the binlog are reverified. The final
+// verification waits for the cutover to be allowed through the ControlServer,
+// or for AutomaticCutover, once the writes to the source are stopped and the
+// target caught up. The other verifiers expect the source to not be written
+// to during the verification.
+type VerifyFerry struct {
+	Ferry         *ghostferry.Ferry
+	controlServer *ghostferry.ControlServer
+	config        *copydb.Config
+	verifier      ghostferry.Verifier
+	logger        *logrus.Entry
+}
+
+// The events streamed from the binlog are only used for reverification.
+type discardingEventWriter struct{}
+
+func (discardingEventWriter) BufferBinlogEvents([]ghostferry.DMLEvent) error {
+	return nil
+}
+
+func NewFerry(config *copydb.Config) *VerifyFerry {
+	ferry := &ghostferry.Ferry{
+		Config:         config.Config,
+		DMLEventWriter: discardingEventWriter{},
+	}
+
+	controlServer := &ghostferry.ControlServer{
+		F:       ferry,
+		Addr:    config.ServerBindAddr,
+		Basedir: config.WebBasedir,
+		Auth:    config.ServerAuth,
+
+		EnableDebug: config.ServerDebugEndpoints,
+	}
+
+	return &VerifyFerry{
+		Ferry:         ferry,
+		controlServer: controlServer,
+		config:        config,
+	}
+}
+
+func (this *VerifyFerry) Initialize() error {
+	this.logger = logrus.WithField("tag", "verify")
+
+	if this.config.VerifierType == copydb.VerifierTypeNoVerification {
+		return fmt.Errorf("the %s VerifierType cannot be used to verify", copydb.VerifierTypeNoVerification)
+	}
+
+	err := this.Ferry.Initialize()
+	if err != nil {
+		return err
+	}
+
+	return this.controlServer.Initialize()
+}
+
+func (this *VerifyFerry) Start() error {
+	err := this.Ferry.Start()
+	if err != nil {
+		return err
+	}
+
+	this.verifier, err = copydb.NewVerifier(this.Ferry, this.config)
+	if err != nil {
+		return err
+	}
+
+	this.controlServer.Verifier = this.verifier
+	return nil
+}
+
+// Verifies the target and returns the result of the verification. The
+// ControlServer runs until the verification is done.
+func (this *VerifyFerry) Run() (ghostferry.VerificationResult, error) {
+	serverWG := &sync.WaitGroup{}
+	serverWG.Add(1)
+	go this.controlServer.Run(serverWG)
+
+	defer func() {
+		err := this.controlServer.Shutdown()
+		if err != nil {
+			this.logger.WithError(err).Error("failed to shutdown control server")
+		}
+		serverWG.Wait()
+	}()
+
+	result, err := this.verify()
+	this.Ferry.NotifyVerificationResult(result, err)
+	this.Ferry.Notify(ghostferry.NotificationDone, "")
+	this.Ferry.WaitForNotifications()
+	return result, err
+}
+
+func (this *VerifyFerry) verify() (ghostferry.VerificationResult, error) {
+	if iterativeVerifier, ok := this.verifier.(*ghostferry.IterativeVerifier); ok {
+		return this.runIterativeVerifier(iterativeVerifier)
+	}
+
+	err := this.verifier.StartInBackground()
+	if err != nil {
+		return ghostferry.VerificationResult{}, err
+	}
+
+	this.verifier.Wait()
+	result, err := this.verifier.Result()
+	return result.VerificationResult, err
+}
+
+func (this *VerifyFerry) runIterativeVerifier(verifier *ghostferry.IterativeVerifier) (ghostferry.VerificationResult, error) {
+	streamerWG := &sync.WaitGroup{}
+	streamerWG.Add(1)
+	go func() {
+		defer streamerWG.Done()
+		this.Ferry.BinlogStreamer.Run()
+	}()
+
+	err := verifier.VerifyBeforeCutover()
+	if err != nil {
+		return ghostferry.VerificationResult{}, err
+	}
+
+	this.logger.Info("waiting for the cutover to be allowed, stop the writes to the source and wait for the target to catch up first")
+	for !this.Ferry.AutomaticCutover {
+		time.Sleep(1 * time.Second)
+	}
+
+	this.Ferry.WaitUntilBinlogStreamerCatchesUp()
+	this.Ferry.FlushBinlogAndStopStreaming()
+	streamerWG.Wait()
+
+	return verifier.VerifyDuringCutover()
+}
@@ -0,0 +1,48 @@
+package ghostferry
+
+import (
+	"github.com/siddontang/go-mysql/schema"
+)
+
+// The VTGate directive committing the rows of a statement on every shard on
+// its own, instead of in a transaction spanning the shards.
+const vitessMultiShardAutocommit = "/*vt+ MULTI_SHARD_AUTOCOMMIT=1 */"
+
+// VitessDialect writes to a Vitess cluster through VTGate, which speaks the
+// MySQL protocol and routes every statement to the shards owning its rows.
+// The databases of the target are the keyspaces, to which the databases of
+// the source can be mapped with DatabaseRewrites. The keyspaces and their
+// VSchema must exist before the copy.
+//
+// No statement writes to several shards in a transaction: the rows of a
+// batch are inserted by a single statement that VTGate splits by shard, and
+// that every shard commits on its own, and the binlog events are written by
+// single row statements, outside of any transaction. All the statements
+// are idempotent, so a batch that partially failed is safely written again
+// when it is retried.
+type VitessDialect struct{}
+
+func (VitessDialect) Name() string {
+	return DialectVitess
+}
+
+func (VitessDialect) RowBatchQuery(batch *RowBatch, target *schema.Table) (string, []interface{}, error) {
+	return batch.asInsertQuery("INSERT "+vitessMultiShardAutocommit+" IGNORE INTO ", target)
+}
+
+func (VitessDialect) DMLEventStatement(ev DMLEvent, target *schema.Table) (string, error) {
+	return ev.AsSQLString(target)
+}
+
+// Returns true if the statements applying the events are written in a
+// transaction. VTGate cannot atomically commit the events of several
+// shards, so the events are written in autocommit to a Vitess target.
+func writesEventsInTransaction(dialect SQLDialect) bool {
+	return dialect.Name() != DialectVitess
+}
+
+// Returns true if the target runs the statements on MySQL, which rejects
+// the values of the generated columns.
+func writesToMySQL(dialect SQLDialect) bool {
+	return dialect.Name() == DialectMySQL || dialect.Name() == DialectVitess
+}
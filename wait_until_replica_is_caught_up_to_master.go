@@ -1,9 +1,11 @@
 package ghostferry
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"math"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/siddontang/go-mysql/mysql"
@@ -41,27 +43,259 @@ func (r ReplicatedMasterPositionViaCustomQuery) Current(replicaDB *sql.DB) (mysq
 	return NewMysqlPosition(file, pos, err)
 }
 
+// Fetches the GTIDs of the master executed on the replica, which are compared
+// against those executed on the master, rather than binlog positions. Unlike
+// binlog positions, GTIDs are preserved through intermediate relays and do not
+// depend on the replica logging its updates with log_slave_updates, which
+// makes them the only option on some GTID-only topologies. A replica with a
+// ReplicatedMasterGTIDSetFetcher is compared by GTID set instead of by its
+// ReplicatedMasterPositionFetcher.
+type ReplicatedMasterGTIDSetFetcher interface {
+	CurrentGTIDSet(*sql.DB) (mysql.GTIDSet, error)
+}
+
+// Reads the GTIDs executed on the replica from gtid_executed. As the replica
+// applies the transactions of the master with their original GTIDs, it has
+// replicated a master GTID set once its own gtid_executed contains it.
+type ReplicatedMasterGTIDSetViaGTIDExecuted struct{}
+
+func (r ReplicatedMasterGTIDSetViaGTIDExecuted) CurrentGTIDSet(replicaDB *sql.DB) (mysql.GTIDSet, error) {
+	return GTIDExecuted(replicaDB)
+}
+
+func GTIDExecuted(db *sql.DB) (mysql.GTIDSet, error) {
+	var gtidExecuted string
+	err := db.QueryRow("SELECT @@GLOBAL.gtid_executed").Scan(&gtidExecuted)
+	if err != nil {
+		return nil, err
+	}
+
+	return mysql.ParseMysqlGTIDSet(gtidExecuted)
+}
+
+// The progress of the replica towards the target master position, as
+// reported to WaitUntilReplicaIsCaughtUpToMaster.ProgressCallback.
+type ReplicaProgress struct {
+	// The name of the replica, see Replica.Name.
+	Replica string
+
+	ReplicatedMasterPosition mysql.Position
+	TargetMasterPosition     mysql.Position
+
+	// The number of bytes of binlog the replica still has to replicate, or -1
+	// if it is replicating an older binlog file than the target position.
+	// Replicas compared by GTID set report 0 once caught up and -1 until then.
+	BinlogBytesBehind int64
+
+	// Only set for the replicas compared by GTID set.
+	ReplicatedGTIDSet mysql.GTIDSet
+	TargetGTIDSet     mysql.GTIDSet
+
+	Waited time.Duration
+}
+
+// A replica of the master, in addition to the ReplicaDB.
+type Replica struct {
+	// Identifies the replica in the logs and in ReplicaProgress.
+	Name string
+
+	DB                              *sql.DB
+	ReplicatedMasterPositionFetcher ReplicatedMasterPositionFetcher
+
+	// If set, the replica is compared by GTID set, and the
+	// ReplicatedMasterPositionFetcher is not used.
+	ReplicatedMasterGTIDSetFetcher ReplicatedMasterGTIDSetFetcher
+}
+
+// Whether a replica was caught up the last time the replicas were checked.
+type ReplicaStatus struct {
+	Name     string
+	CaughtUp bool
+
+	// Set if the replicated master position could not be read.
+	Err error
+}
+
+// The name of the ReplicaDB in the logs and in ReplicaProgress.
+const PrimaryReplicaName = "replica"
+
 // Only set the MasterDB and ReplicatedMasterPosition options in your code as
 // the others will be overwritten by the ferry.
 type WaitUntilReplicaIsCaughtUpToMaster struct {
 	MasterDB                        *sql.DB
 	ReplicatedMasterPositionFetcher ReplicatedMasterPositionFetcher
-	Timeout                         time.Duration
+
+	// If set, the ReplicaDB is compared by GTID set against the GTIDs
+	// executed on the master, and the ReplicatedMasterPositionFetcher is not
+	// used.
+	ReplicatedMasterGTIDSetFetcher ReplicatedMasterGTIDSetFetcher
+
+	// Other replicas to wait for in addition to the ReplicaDB, each with
+	// its own way to fetch the replicated master position.
+	//
+	// Optional: defaults to only waiting for the ReplicaDB.
+	Replicas []Replica
+
+	// A pool of replicas to wait for in addition to the others, for
+	// instance the replicas behind a proxy. The pool is resolved every time
+	// the replicas are checked, and each of its replicas counts towards the
+	// Quorum.
+	//
+	// Optional: defaults to no pool.
+	ReplicaPool ReplicaPool
+
+	// How many of the replicas, including the ReplicaDB, must have
+	// replicated the target master position. A replica whose position
+	// cannot be read counts as not caught up. Checking the replicas fails if
+	// there are fewer replicas than the Quorum, such as when the ReplicaPool
+	// resolves to fewer replicas than expected.
+	//
+	// Optional: defaults to all the replicas.
+	Quorum int
+
+	// Optional: defaults to no timeout.
+	Timeout time.Duration
+
+	// How often the replicated master position is checked.
+	//
+	// Optional: defaults to 600ms.
+	PollInterval time.Duration
+
+	// How many times reading a binlog position is attempted before giving
+	// up.
+	//
+	// Optional: defaults to 100.
+	ReadRetries int
+
+	// Called every time the replicated master position is checked, for
+	// logging or metrics.
+	ProgressCallback func(ReplicaProgress)
 
 	ReplicaDB *sql.DB
 
-	logger *logrus.Entry
+	logger    *logrus.Entry
+	waitStart time.Time
+
+	statusMutex   sync.Mutex
+	replicaStatus []ReplicaStatus
 }
 
+// Returns true once a quorum of the replicas has replicated the target
+// master position. Returns an error if the positions of so many replicas
+// cannot be read that the quorum cannot be reached. The replicas compared by
+// GTID set are compared against the GTIDs executed on the master when this
+// is called.
 func (w *WaitUntilReplicaIsCaughtUpToMaster) IsCaughtUp(targetMasterPos mysql.Position) (bool, error) {
 	if w.logger == nil {
 		w.logger = logrus.WithField("tag", "wait_replica")
 	}
 
+	ctx := context.Background()
+	replicas, err := w.allReplicas(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var targetGTIDSet mysql.GTIDSet
+	if usesGTIDSets(replicas) {
+		targetGTIDSet, err = w.readMasterGTIDSet(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return w.isCaughtUp(ctx, replicas, targetMasterPos, targetGTIDSet)
+}
+
+// Same as IsCaughtUp, but compares the replicas using GTID sets against the
+// given master GTID set.
+func (w *WaitUntilReplicaIsCaughtUpToMaster) IsCaughtUpToGTIDSet(targetMasterPos mysql.Position, targetGTIDSet mysql.GTIDSet) (bool, error) {
+	if w.logger == nil {
+		w.logger = logrus.WithField("tag", "wait_replica")
+	}
+
+	return w.isCaughtUpToGTIDSet(context.Background(), targetMasterPos, targetGTIDSet)
+}
+
+// The reads of the replicas stop being retried once the context is done.
+func (w *WaitUntilReplicaIsCaughtUpToMaster) isCaughtUpToGTIDSet(ctx context.Context, targetMasterPos mysql.Position, targetGTIDSet mysql.GTIDSet) (bool, error) {
+	replicas, err := w.allReplicas(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return w.isCaughtUp(ctx, replicas, targetMasterPos, targetGTIDSet)
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) isCaughtUp(ctx context.Context, replicas []Replica, targetMasterPos mysql.Position, targetGTIDSet mysql.GTIDSet) (bool, error) {
+	if len(replicas) == 0 {
+		return false, errors.New("no replica to wait for")
+	}
+	if w.Quorum > len(replicas) {
+		return false, fmt.Errorf("quorum of %d replicas cannot be reached with %d replicas", w.Quorum, len(replicas))
+	}
+	quorum := w.quorum(len(replicas))
+
+	caughtUp := 0
+	failed := 0
+	var lastErr error
+	statuses := make([]ReplicaStatus, 0, len(replicas))
+
+	// All the replicas are checked, even once the quorum is reached, so
+	// the status of each of them is known.
+	for _, replica := range replicas {
+		var isCaughtUp bool
+		var err error
+		if replica.ReplicatedMasterGTIDSetFetcher != nil {
+			isCaughtUp, err = w.replicaHasGTIDSet(ctx, replica, targetGTIDSet)
+		} else {
+			isCaughtUp, err = w.replicaIsCaughtUp(ctx, replica, targetMasterPos)
+		}
+
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		if err != nil {
+			w.logger.WithError(err).WithField("replica", replica.Name).Warn("failed to read replicated master binlog position")
+			failed++
+			lastErr = err
+		} else if isCaughtUp {
+			caughtUp++
+		}
+
+		statuses = append(statuses, ReplicaStatus{Name: replica.Name, CaughtUp: isCaughtUp, Err: err})
+	}
+
+	w.statusMutex.Lock()
+	w.replicaStatus = statuses
+	w.statusMutex.Unlock()
+
+	if caughtUp >= quorum {
+		w.logger.Infof("target master position reached by %d/%d replicas", caughtUp, len(replicas))
+		return true, nil
+	}
+
+	if len(replicas)-failed < quorum {
+		return false, lastErr
+	}
+
+	return false, nil
+}
+
+// The status of every replica, as of the last time they were checked.
+func (w *WaitUntilReplicaIsCaughtUpToMaster) ReplicaStatuses() []ReplicaStatus {
+	w.statusMutex.Lock()
+	defer w.statusMutex.Unlock()
+
+	return append([]ReplicaStatus(nil), w.replicaStatus...)
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) replicaIsCaughtUp(ctx context.Context, replica Replica, targetMasterPos mysql.Position) (bool, error) {
 	var currentReplicatedMasterPos mysql.Position
-	err := WithRetries(100, 600*time.Millisecond, w.logger, "read replicated master binlog position", func() error {
+	err := WithRetriesContext(ctx, w.readRetries(), w.pollInterval(), w.logger, "read replicated master binlog position", func() error {
 		var err error
-		currentReplicatedMasterPos, err = w.ReplicatedMasterPositionFetcher.Current(w.ReplicaDB)
+		currentReplicatedMasterPos, err = replica.ReplicatedMasterPositionFetcher.Current(replica.DB)
 		return err
 	})
 
@@ -69,26 +303,141 @@ func (w *WaitUntilReplicaIsCaughtUpToMaster) IsCaughtUp(targetMasterPos mysql.Po
 		return false, err
 	}
 
+	if w.ProgressCallback != nil {
+		progress := newReplicaProgress(currentReplicatedMasterPos, targetMasterPos, w.waitStart)
+		progress.Replica = replica.Name
+		w.ProgressCallback(progress)
+	}
+
+	logger := w.logger.WithField("replica", replica.Name)
 	if currentReplicatedMasterPos.Compare(targetMasterPos) >= 0 {
-		w.logger.Infof("target master position reached by replica: %v >= %v\n", currentReplicatedMasterPos, targetMasterPos)
+		logger.Infof("target master position reached by replica: %v >= %v\n", currentReplicatedMasterPos, targetMasterPos)
+		return true, nil
+	}
+
+	logger.Debugf("replicated master position is: %v < %v\n", currentReplicatedMasterPos, targetMasterPos)
+	return false, nil
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) replicaHasGTIDSet(ctx context.Context, replica Replica, targetGTIDSet mysql.GTIDSet) (bool, error) {
+	if targetGTIDSet == nil {
+		return false, errors.New("no master GTID set to compare the replica against")
+	}
+
+	var currentGTIDSet mysql.GTIDSet
+	err := WithRetriesContext(ctx, w.readRetries(), w.pollInterval(), w.logger, "read replicated master GTID set", func() error {
+		var err error
+		currentGTIDSet, err = replica.ReplicatedMasterGTIDSetFetcher.CurrentGTIDSet(replica.DB)
+		return err
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	isCaughtUp := currentGTIDSet.Contain(targetGTIDSet)
+
+	if w.ProgressCallback != nil {
+		progress := ReplicaProgress{
+			Replica:           replica.Name,
+			BinlogBytesBehind: -1,
+			ReplicatedGTIDSet: currentGTIDSet,
+			TargetGTIDSet:     targetGTIDSet,
+		}
+		if isCaughtUp {
+			progress.BinlogBytesBehind = 0
+		}
+		if !w.waitStart.IsZero() {
+			progress.Waited = time.Since(w.waitStart)
+		}
+		w.ProgressCallback(progress)
+	}
+
+	logger := w.logger.WithField("replica", replica.Name)
+	if isCaughtUp {
+		logger.Infof("target master GTID set reached by replica: %v contains %v\n", currentGTIDSet, targetGTIDSet)
 		return true, nil
 	}
 
-	w.logger.Debugf("replicated master position is: %v < %v\n", currentReplicatedMasterPos, targetMasterPos)
+	logger.Debugf("replicated master GTID set is: %v does not contain %v\n", currentGTIDSet, targetGTIDSet)
 	return false, nil
 }
 
+func usesGTIDSets(replicas []Replica) bool {
+	for _, replica := range replicas {
+		if replica.ReplicatedMasterGTIDSetFetcher != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) readMasterGTIDSet(ctx context.Context) (mysql.GTIDSet, error) {
+	var gtidSet mysql.GTIDSet
+	err := WithRetriesContext(ctx, w.readRetries(), w.pollInterval(), w.logger, "read master GTID set", func() error {
+		var err error
+		gtidSet, err = GTIDExecuted(w.MasterDB)
+		return err
+	})
+	return gtidSet, err
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) allReplicas(ctx context.Context) ([]Replica, error) {
+	replicas := []Replica{}
+	if w.ReplicaDB != nil {
+		replicas = append(replicas, Replica{
+			Name:                            PrimaryReplicaName,
+			DB:                              w.ReplicaDB,
+			ReplicatedMasterPositionFetcher: w.ReplicatedMasterPositionFetcher,
+			ReplicatedMasterGTIDSetFetcher:  w.ReplicatedMasterGTIDSetFetcher,
+		})
+	}
+
+	replicas = append(replicas, w.Replicas...)
+
+	if w.ReplicaPool != nil {
+		var poolReplicas []Replica
+		err := WithRetriesContext(ctx, w.readRetries(), w.pollInterval(), w.logger, "resolve replica pool", func() error {
+			var err error
+			poolReplicas, err = w.ReplicaPool.Replicas()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		replicas = append(replicas, poolReplicas...)
+	}
+
+	return replicas, nil
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) quorum(replicaCount int) int {
+	if w.Quorum <= 0 {
+		return replicaCount
+	}
+	return w.Quorum
+}
+
 func (w *WaitUntilReplicaIsCaughtUpToMaster) Wait() error {
+	return w.WaitContext(context.Background())
+}
+
+// Waits until the replica has replicated the current master position, the
+// Timeout is reached or the context is cancelled.
+func (w *WaitUntilReplicaIsCaughtUpToMaster) WaitContext(ctx context.Context) error {
 	w.logger = logrus.WithField("tag", "wait_replica")
-	// Essentially not timeout
-	if w.Timeout == time.Duration(0) {
-		w.Timeout = time.Duration(math.MaxInt64)
-	}
+	w.waitStart = time.Now()
 
-	start := time.Now()
+	waitCtx := ctx
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
 
 	var targetMasterPos mysql.Position
-	err := WithRetries(100, 600*time.Millisecond, w.logger, "read master binlog position", func() error {
+	err := WithRetriesContext(waitCtx, w.readRetries(), w.pollInterval(), w.logger, "read master binlog position", func() error {
 		var err error
 		targetMasterPos, err = ShowMasterStatusBinlogPosition(w.MasterDB)
 		return err
@@ -96,29 +445,96 @@ func (w *WaitUntilReplicaIsCaughtUpToMaster) Wait() error {
 
 	if err != nil {
 		w.logger.WithError(err).Error("failed to get master binlog coordinates")
-		return err
+		return w.waitError(ctx, waitCtx, err)
 	}
 
 	w.logger.Infof("target master position is: %v\n", targetMasterPos)
 
+	// The GTID set is read after the binlog position, so that it includes
+	// at least all the transactions up to that position.
+	replicas, err := w.allReplicas(waitCtx)
+	if err != nil {
+		w.logger.WithError(err).Error("failed to resolve replicas")
+		return w.waitError(ctx, waitCtx, err)
+	}
+
+	var targetGTIDSet mysql.GTIDSet
+	if usesGTIDSets(replicas) {
+		targetGTIDSet, err = w.readMasterGTIDSet(waitCtx)
+		if err != nil {
+			w.logger.WithError(err).Error("failed to get master GTID set")
+			return w.waitError(ctx, waitCtx, err)
+		}
+
+		w.logger.Infof("target master GTID set is: %v\n", targetGTIDSet)
+	}
+
+	ticker := time.NewTicker(w.pollInterval())
+	defer ticker.Stop()
+
 	for {
-		isCaughtUp, err := w.IsCaughtUp(targetMasterPos)
+		isCaughtUp, err := w.isCaughtUpToGTIDSet(waitCtx, targetMasterPos, targetGTIDSet)
 		if err != nil {
 			w.logger.WithError(err).Error("failed to get replica binlog coordinates")
-			return err
+			return w.waitError(ctx, waitCtx, err)
 		}
 
 		if isCaughtUp {
-			break
+			return nil
 		}
 
-		timeTaken := time.Now().Sub(start)
-		if timeTaken >= w.Timeout {
-			return errors.New("timeout reached before replica is caught up to master")
+		select {
+		case <-waitCtx.Done():
+			return w.waitError(ctx, waitCtx, waitCtx.Err())
+		case <-ticker.C:
 		}
+	}
+}
+
+// The reads stop being retried once the wait context is done, in which case
+// the cancellation of the context or the Timeout is reported rather than the
+// error of the read.
+func (w *WaitUntilReplicaIsCaughtUpToMaster) waitError(ctx, waitCtx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if waitCtx.Err() != nil {
+		return errors.New("timeout reached before replica is caught up to master")
+	}
+	return err
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) pollInterval() time.Duration {
+	if w.PollInterval > 0 {
+		return w.PollInterval
+	}
+	return 600 * time.Millisecond
+}
+
+func (w *WaitUntilReplicaIsCaughtUpToMaster) readRetries() int {
+	if w.ReadRetries > 0 {
+		return w.ReadRetries
+	}
+	return 100
+}
+
+func newReplicaProgress(current, target mysql.Position, waitStart time.Time) ReplicaProgress {
+	progress := ReplicaProgress{
+		ReplicatedMasterPosition: current,
+		TargetMasterPosition:     target,
+		BinlogBytesBehind:        -1,
+	}
+
+	if !waitStart.IsZero() {
+		progress.Waited = time.Since(waitStart)
+	}
 
-		time.Sleep(600 * time.Millisecond)
+	switch {
+	case current.Compare(target) >= 0:
+		progress.BinlogBytesBehind = 0
+	case current.Name == target.Name:
+		progress.BinlogBytesBehind = int64(target.Pos) - int64(current.Pos)
 	}
 
-	return nil
+	return progress
 }